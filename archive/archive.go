@@ -0,0 +1,345 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/plugin"
+)
+
+const (
+	kindTar     = "tar"
+	kindTarGzip = "tar.gz"
+	kindZip     = "zip"
+)
+
+// extensions maps file extensions to kinds of archives.
+// Longer extensions must come first.
+var extensions = []struct {
+	ext  string
+	kind string
+}{
+	{".tar.gz", kindTarGzip},
+	{".tgz", kindTarGzip},
+	{".tar", kindTar},
+	{".zip", kindZip},
+}
+
+// meta is stored in the Meta field of the Codecs of members.
+type meta struct {
+	// Archive is the Codec of the archive as returned by the wrapped source.
+	Archive *ingest.Codec `json:"archive"`
+	Member  string        `json:"member"`
+	// Last is true for the last member of the archive.
+	Last bool `json:"last"`
+}
+
+var _ plugin.Source = &Source{}
+
+// Source wraps a plugin.Source and expands tar and zip archives,
+// so that every regular file in an archive is yielded as an individual object.
+// Archives are recognized by the extension of their names,
+// i.e. .tar, .tar.gz, .tgz and .zip.
+// All other objects and archives without any files are passed through unchanged.
+//
+// The archive is cleaned up once its last member is cleaned up.
+// Members are named after the archive without its extension followed by the path of the member,
+// e.g. the member foo/bar.csv of the archive baz.zip is named baz/foo/bar.csv.
+type Source struct {
+	plugin.Source
+
+	mu sync.Mutex
+	// members is the queue of members of the current archive
+	// that were not yet returned.
+	members []ingest.Codec
+
+	cmu sync.Mutex
+	// cached is the path of a temporary file holding
+	// the archive that was downloaded most recently,
+	// so that an archive is not downloaded again for every member.
+	cached struct {
+		id   string
+		path string
+	}
+}
+
+// NewSource wraps the given source.
+func NewSource(s plugin.Source) *Source {
+	return &Source{Source: s}
+}
+
+// Reset resets the wrapped source and drops the remaining members of the current archive.
+func (s *Source) Reset(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.members = nil
+	return s.Source.Reset(ctx)
+}
+
+// Next returns the members of an archive one at a time.
+// When all members were returned, the next object of the wrapped source is requested.
+func (s *Source) Next(ctx context.Context) (*ingest.Codec, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(s.members) == 0 {
+		c, err := s.Source.Next(ctx)
+		if err != nil {
+			return nil, err
+		}
+		k, base := kindOf(c.Name)
+		if k == "" {
+			return c, nil
+		}
+		f, err := s.fetch(ctx, *c)
+		if err != nil {
+			return nil, err
+		}
+		names, err := list(f, k)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list archive %q: %w", c.Name, err)
+		}
+		if len(names) == 0 {
+			return c, nil
+		}
+		for j, n := range names {
+			buf, err := json.Marshal(meta{Archive: c, Member: n, Last: j == len(names)-1})
+			if err != nil {
+				return nil, err
+			}
+			s.members = append(s.members, ingest.NewCodec(c.ID+"/"+n, base+"/"+n, buf))
+		}
+	}
+
+	c := s.members[0]
+	s.members = s.members[1:]
+	return &c, nil
+}
+
+// CleanUp cleans up the archive when the last member is cleaned up.
+// Other objects are cleaned up by the wrapped source.
+func (s *Source) CleanUp(ctx context.Context, i ingest.Codec) error {
+	m, ok := parse(i)
+	if !ok {
+		return s.Source.CleanUp(ctx, i)
+	}
+	if !m.Last {
+		return nil
+	}
+	return s.Source.CleanUp(ctx, *m.Archive)
+}
+
+// Download extracts a member from its archive.
+// Other objects are downloaded by the wrapped source.
+func (s *Source) Download(ctx context.Context, i ingest.Codec) (*ingest.Object, error) {
+	m, ok := parse(i)
+	if !ok {
+		return s.Source.Download(ctx, i)
+	}
+	k, _ := kindOf(m.Archive.Name)
+	f, err := s.fetch(ctx, *m.Archive)
+	if err != nil {
+		return nil, err
+	}
+	r, n, err := open(f, k, m.Member)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to open member %q of archive %q: %w", m.Member, m.Archive.Name, err)
+	}
+
+	return &ingest.Object{
+		Reader:   &readCloser{Reader: r, f: f},
+		Len:      n,
+		MimeType: mime.TypeByExtension(path.Ext(m.Member)),
+	}, nil
+}
+
+// fetch returns an open file with the content of the archive.
+// The archive is only downloaded if it is not the one that was downloaded most recently.
+func (s *Source) fetch(ctx context.Context, c ingest.Codec) (*os.File, error) {
+	s.cmu.Lock()
+	defer s.cmu.Unlock()
+
+	if s.cached.id != c.ID || s.cached.path == "" {
+		p, err := s.download(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		if s.cached.path != "" {
+			// Files that are still open for other members remain readable.
+			os.Remove(s.cached.path)
+		}
+		s.cached.id = c.ID
+		s.cached.path = p
+	}
+	return os.Open(s.cached.path)
+}
+
+// download stores the archive in a temporary file and returns its path.
+func (s *Source) download(ctx context.Context, c ingest.Codec) (string, error) {
+	o, err := s.Source.Download(ctx, c)
+	if err != nil {
+		return "", fmt.Errorf("failed to download archive %q: %w", c.Name, err)
+	}
+	if rc, ok := o.Reader.(io.Closer); ok {
+		defer rc.Close()
+	}
+	f, err := os.CreateTemp("", "ingest-archive-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, o.Reader); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to download archive %q: %w", c.Name, err)
+	}
+	return f.Name(), nil
+}
+
+// parse returns the meta of the Codec of a member.
+// It returns false if the Codec is not a member of an archive.
+func parse(i ingest.Codec) (*meta, bool) {
+	m := new(meta)
+	if err := json.Unmarshal(i.Meta, m); err != nil || m.Archive == nil || m.Member == "" {
+		return nil, false
+	}
+	return m, true
+}
+
+// kindOf returns the kind of the archive with the given name and the name without its extension.
+// The kind is empty if the name is not the name of an archive.
+func kindOf(name string) (string, string) {
+	l := strings.ToLower(name)
+	for _, e := range extensions {
+		if strings.HasSuffix(l, e.ext) && len(name) > len(e.ext) {
+			return e.kind, name[:len(name)-len(e.ext)]
+		}
+	}
+	return "", name
+}
+
+// clean returns the path of a member relative to the root of the archive.
+// Paths that point outside of the archive are resolved as if they started at the root.
+// It returns an empty string for the root itself.
+func clean(name string) string {
+	p := strings.TrimPrefix(path.Clean("/"+name), "/")
+	if p == "" || p == "." {
+		return ""
+	}
+	return p
+}
+
+// list returns the paths of all regular files in the archive.
+func list(f *os.File, kind string) ([]string, error) {
+	var names []string
+	if kind == kindZip {
+		zr, err := newZipReader(f)
+		if err != nil {
+			return nil, err
+		}
+		for _, zf := range zr.File {
+			if p := clean(zf.Name); p != "" && zf.Mode().IsRegular() {
+				names = append(names, p)
+			}
+		}
+		return names, nil
+	}
+
+	tr, err := newTarReader(f, kind)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return names, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if p := clean(h.Name); p != "" && h.FileInfo().Mode().IsRegular() {
+			names = append(names, p)
+		}
+	}
+}
+
+// open returns a reader for the member with the given path and its size.
+// The reader is only valid as long as the file is open.
+func open(f *os.File, kind, member string) (io.Reader, int64, error) {
+	if kind == kindZip {
+		zr, err := newZipReader(f)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, zf := range zr.File {
+			if clean(zf.Name) == member && zf.Mode().IsRegular() {
+				r, err := zf.Open()
+				if err != nil {
+					return nil, 0, err
+				}
+				return r, int64(zf.UncompressedSize64), nil
+			}
+		}
+		return nil, 0, fs.ErrNotExist
+	}
+
+	tr, err := newTarReader(f, kind)
+	if err != nil {
+		return nil, 0, err
+	}
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil, 0, fs.ErrNotExist
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		if clean(h.Name) == member && h.FileInfo().Mode().IsRegular() {
+			return tr, h.Size, nil
+		}
+	}
+}
+
+func newZipReader(f *os.File) (*zip.Reader, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return zip.NewReader(f, fi.Size())
+}
+
+func newTarReader(f *os.File, kind string) (*tar.Reader, error) {
+	if kind == kindTarGzip {
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		return tar.NewReader(gr), nil
+	}
+	return tar.NewReader(f), nil
+}
+
+// readCloser closes the file of the archive when the member was read.
+type readCloser struct {
+	io.Reader
+	f *os.File
+}
+
+func (r *readCloser) Close() error {
+	return r.f.Close()
+}
@@ -0,0 +1,161 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/connylabs/ingest"
+)
+
+// fakeSource serves objects from memory and records clean ups.
+type fakeSource struct {
+	objects   map[string][]byte
+	order     []string
+	i         int
+	downloads map[string]int
+	cleanUps  []string
+}
+
+func (f *fakeSource) Configure(map[string]interface{}) error { return nil }
+
+func (f *fakeSource) Reset(context.Context) error {
+	f.i = 0
+	return nil
+}
+
+func (f *fakeSource) Next(context.Context) (*ingest.Codec, error) {
+	if f.i == len(f.order) {
+		return nil, io.EOF
+	}
+	c := ingest.NewCodec("id-"+f.order[f.i], f.order[f.i], []byte(`{"foo":"bar"}`))
+	f.i++
+	return &c, nil
+}
+
+func (f *fakeSource) CleanUp(_ context.Context, c ingest.Codec) error {
+	f.cleanUps = append(f.cleanUps, c.ID)
+	return nil
+}
+
+func (f *fakeSource) Download(_ context.Context, c ingest.Codec) (*ingest.Object, error) {
+	f.downloads[c.Name]++
+	buf := f.objects[c.Name]
+	return &ingest.Object{Reader: bytes.NewReader(buf), Len: int64(len(buf))}, nil
+}
+
+func zipArchive(t *testing.T, files map[string]string) []byte {
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	_, err := w.Create("dir/")
+	require.NoError(t, err)
+	for _, n := range []string{"a.txt", "dir/b.csv"} {
+		fw, err := w.Create(n)
+		require.NoError(t, err)
+		_, err = fw.Write([]byte(files[n]))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func tarGzipArchive(t *testing.T, files map[string]string) []byte {
+	buf := new(bytes.Buffer)
+	gw := gzip.NewWriter(buf)
+	w := tar.NewWriter(gw)
+	require.NoError(t, w.WriteHeader(&tar.Header{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0o755}))
+	for _, n := range []string{"a.txt", "dir/b.csv"} {
+		require.NoError(t, w.WriteHeader(&tar.Header{Name: n, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(files[n]))}))
+		_, err := w.Write([]byte(files[n]))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	require.NoError(t, gw.Close())
+	return buf.Bytes()
+}
+
+func TestSource(t *testing.T) {
+	files := map[string]string{"a.txt": "foo", "dir/b.csv": "bar,baz"}
+	fs := &fakeSource{
+		objects: map[string][]byte{
+			"x.zip":    zipArchive(t, files),
+			"y.tar.gz": tarGzipArchive(t, files),
+			"z.txt":    []byte("qux"),
+		},
+		order:     []string{"x.zip", "y.tar.gz", "z.txt"},
+		downloads: make(map[string]int),
+	}
+	s := NewSource(fs)
+	ctx := context.Background()
+	require.NoError(t, s.Reset(ctx))
+
+	var cs []ingest.Codec
+	for {
+		c, err := s.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		cs = append(cs, *c)
+	}
+	names := make([]string, len(cs))
+	for i := range cs {
+		names[i] = cs[i].Name
+	}
+	assert.Equal(t, []string{"x/a.txt", "x/dir/b.csv", "y/a.txt", "y/dir/b.csv", "z.txt"}, names)
+	assert.Equal(t, "id-x.zip/dir/b.csv", cs[1].ID)
+	assert.Equal(t, `{"foo":"bar"}`, string(cs[4].Meta))
+
+	for _, c := range cs {
+		o, err := s.Download(ctx, c)
+		require.NoError(t, err)
+		buf, err := io.ReadAll(o.Reader)
+		require.NoError(t, err)
+		if rc, ok := o.Reader.(io.Closer); ok {
+			assert.NoError(t, rc.Close())
+		}
+		assert.Equal(t, int64(len(buf)), o.Len)
+		switch c.Name {
+		case "z.txt":
+			assert.Equal(t, "qux", string(buf))
+		case "x/a.txt", "y/a.txt":
+			assert.Equal(t, files["a.txt"], string(buf))
+		default:
+			assert.Equal(t, files["dir/b.csv"], string(buf))
+		}
+	}
+	// The archives were downloaded once for listing and once for the members.
+	assert.Equal(t, 2, fs.downloads["x.zip"])
+	assert.Equal(t, 2, fs.downloads["y.tar.gz"])
+
+	for _, c := range cs {
+		require.NoError(t, s.CleanUp(ctx, c))
+	}
+	assert.Equal(t, []string{"id-x.zip", "id-y.tar.gz", "id-z.txt"}, fs.cleanUps)
+}
+
+func TestKindOf(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		kind string
+		base string
+	}{
+		{"foo/bar.zip", kindZip, "foo/bar"},
+		{"bar.TAR.GZ", kindTarGzip, "bar"},
+		{"bar.tgz", kindTarGzip, "bar"},
+		{"bar.tar", kindTar, "bar"},
+		{"bar.gz", "", "bar.gz"},
+		{".zip", "", ".zip"},
+	} {
+		k, b := kindOf(tc.name)
+		assert.Equal(t, tc.kind, k, tc.name)
+		assert.Equal(t, tc.base, b, tc.name)
+	}
+}
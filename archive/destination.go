@@ -0,0 +1,412 @@
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/internal/spool"
+	"github.com/connylabs/ingest/plugin"
+	"github.com/connylabs/ingest/storage"
+)
+
+const (
+	defaultInterval   = time.Minute
+	defaultMaxObjects = 1000
+	defaultMaxBytes   = 1 << 30
+	// defaultRetryWait is the duration before the first retry of storing an archive, which doubles with every retry up to the interval.
+	defaultRetryWait = time.Second
+
+	indexFile  = "index"
+	spoolExt   = ".tar"
+	timeFormat = "20060102T150405.000000000Z"
+)
+
+// DestinationOptions configure how objects are batched into archives.
+type DestinationOptions struct {
+	// Directory is the directory in which archives are spooled until they are stored and in which the index of archived objects is kept.
+	// It is required and must not be shared with other destinations or processes.
+	Directory string
+	// Prefix is prepended to the names of the archives.
+	Prefix string
+	// Interval is the maximum time that an object waits for its archive to be stored.
+	// It defaults to one minute.
+	Interval time.Duration
+	// MaxObjects is the maximum number of objects in an archive. It defaults to 1000.
+	MaxObjects int
+	// MaxBytes is the size of the content of an archive after which it is stored. It defaults to 1 GiB.
+	MaxBytes int64
+}
+
+var _ plugin.Destination = &Destination{}
+
+// Destination wraps a plugin.Destination and accumulates objects in tar.gz archives,
+// which are stored in the wrapped destination once they are full or the interval elapsed.
+//
+// Objects are appended to an archive in the spool directory and Store returns as soon as the object was synced to disk,
+// so objects are acknowledged without waiting for their archive, which can thus reach its maximum size regardless of
+// the concurrency of the workflow. Archives that cannot be stored are retried until they are stored,
+// and archives that are left in the spool directory by a previous process are stored when the destination is created.
+// Since the archive is only stored later, the returned URL has the scheme archive and names the archive
+// with the name of the member as fragment, e.g. archive:<Prefix>20230102T030405.000000000Z.tar.gz#foo.csv.
+//
+// Archives are named after the time at which they were started,
+// e.g. <Prefix>20230102T030405.000000000Z.tar.gz.
+// The names of archived objects are recorded in an index in the spool directory, from which Stat answers,
+// so objects that are listed again are not archived again.
+type Destination struct {
+	plugin.Destination
+	o         DestinationOptions
+	now       func() time.Time
+	retryWait time.Duration
+
+	mu sync.Mutex
+	// current is the archive to which objects are currently added.
+	current *batch
+	// index is the file to which the names of archived objects are appended.
+	index *os.File
+	// archived maps the names of archived objects to their URLs.
+	archived map[string]string
+}
+
+// entry is a line of the index.
+type entry struct {
+	Name string `json:"name"`
+	URI  string `json:"uri"`
+}
+
+// batch is an archive that is being spooled to a tar file.
+type batch struct {
+	name  string
+	path  string
+	f     *os.File
+	tw    *tar.Writer
+	n     int
+	size  int64
+	timer *time.Timer
+}
+
+// spooling holds the paths of the spooled archives that are written or stored by a destination of this process,
+// so that a destination that is created for the same directory, e.g. after a reload, does not store them again.
+var spooling sync.Map
+
+// NewDestination wraps the given destination.
+// It loads the index of archived objects and stores the archives that are left in the spool directory.
+func NewDestination(d plugin.Destination, o DestinationOptions) (*Destination, error) {
+	if o.Directory == "" {
+		return nil, errors.New("the spool directory of the archive is required")
+	}
+	if o.Interval <= 0 {
+		o.Interval = defaultInterval
+	}
+	if o.MaxObjects <= 0 {
+		o.MaxObjects = defaultMaxObjects
+	}
+	if o.MaxBytes <= 0 {
+		o.MaxBytes = defaultMaxBytes
+	}
+	if err := os.MkdirAll(o.Directory, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+	dd := &Destination{Destination: d, o: o, now: time.Now, retryWait: defaultRetryWait, archived: make(map[string]string)}
+	if err := dd.loadIndex(); err != nil {
+		return nil, fmt.Errorf("failed to load index of archived objects: %w", err)
+	}
+	spooled, err := filepath.Glob(filepath.Join(o.Directory, "*"+spoolExt))
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range spooled {
+		if _, ok := spooling.LoadOrStore(p, struct{}{}); ok {
+			continue
+		}
+		go dd.flush(&batch{name: o.Prefix + strings.TrimSuffix(filepath.Base(p), spoolExt) + ".tar.gz", path: p})
+	}
+	return dd, nil
+}
+
+// loadIndex reads the index of archived objects and opens it to append to it.
+// A line that was not completely written, e.g. because the process was killed, is cut off.
+func (d *Destination) loadIndex() error {
+	f, err := os.OpenFile(filepath.Join(d.o.Directory, indexFile), os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(f)
+	var off int64
+	for {
+		var e entry
+		if err := dec.Decode(&e); err != nil {
+			break
+		}
+		d.archived[e.Name] = e.URI
+		off = dec.InputOffset()
+	}
+	if err := f.Truncate(off); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Seek(off, io.SeekStart); err != nil {
+		f.Close()
+		return err
+	}
+	d.index = f
+	return nil
+}
+
+// Stat reports the URL of the object if it was archived and otherwise that it does not exist.
+func (d *Destination) Stat(_ context.Context, element ingest.Codec) (*storage.ObjectInfo, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	u, ok := d.archived[memberName(element)]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return &storage.ObjectInfo{URI: u}, nil
+}
+
+// Store adds the object to the current archive in the spool directory.
+func (d *Destination) Store(_ context.Context, element ingest.Codec, obj ingest.Object) (*url.URL, error) {
+	// The object is spooled to a temporary file first, because tar headers
+	// require the exact size and objects are written to the archive one at a time.
+	f, n, err := spool.Temp(obj.Reader, "ingest-object-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object: %w", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	return d.add(memberName(element), f, n)
+}
+
+// memberName returns the name of the element in an archive.
+func memberName(element ingest.Codec) string {
+	return path.Join("/", element.Name)[1:]
+}
+
+// add appends the content of the reader to the current archive, syncs it to disk and records it in the index.
+// It returns the URL of the member.
+func (d *Destination) add(name string, r io.Reader, n int64) (*url.URL, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.current == nil {
+		b, err := d.newBatch()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create archive: %w", err)
+		}
+		b.timer = time.AfterFunc(d.o.Interval, func() {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			if d.current == b {
+				d.close(b)
+			}
+		})
+		d.current = b
+	}
+	b := d.current
+	off, err := b.f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		d.close(b)
+		return nil, fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := func() error {
+		if err := b.tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Size:     n,
+			Mode:     0o644,
+			ModTime:  d.now(),
+		}); err != nil {
+			return err
+		}
+		if _, err := io.Copy(b.tw, r); err != nil {
+			return err
+		}
+		if err := b.tw.Flush(); err != nil {
+			return err
+		}
+		return b.f.Sync()
+	}(); err != nil {
+		d.rollback(b, off)
+		return nil, fmt.Errorf("failed to write archive: %w", err)
+	}
+
+	u := &url.URL{Scheme: "archive", Opaque: b.name, Fragment: name}
+	buf, err := json.Marshal(entry{Name: name, URI: u.String()})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := d.index.Write(append(buf, '\n')); err != nil {
+		return nil, fmt.Errorf("failed to write index: %w", err)
+	}
+	if err := d.index.Sync(); err != nil {
+		return nil, fmt.Errorf("failed to sync index: %w", err)
+	}
+	d.archived[name] = u.String()
+
+	b.n++
+	b.size += n
+	if b.n >= d.o.MaxObjects || b.size >= d.o.MaxBytes {
+		d.close(b)
+	}
+	return u, nil
+}
+
+// rollback removes the member that failed to be written from the archive.
+// If the archive cannot be cut off, then no more members are added to it,
+// since the incomplete member is skipped when the archive is stored.
+// It must be called with the lock held.
+func (d *Destination) rollback(b *batch, off int64) {
+	if err := b.f.Truncate(off); err != nil {
+		d.close(b)
+		return
+	}
+	if _, err := b.f.Seek(off, io.SeekStart); err != nil {
+		d.close(b)
+		return
+	}
+	b.tw = tar.NewWriter(b.f)
+}
+
+// close stops adding objects to the current archive and stores it.
+// It must be called with the lock held.
+func (d *Destination) close(b *batch) {
+	b.timer.Stop()
+	d.current = nil
+	// Errors are ignored, since members that were synced are read from incomplete archives, too.
+	b.tw.Close() //nolint:errcheck
+	b.f.Close()  //nolint:errcheck
+	go d.flush(b)
+}
+
+func (d *Destination) newBatch() (*batch, error) {
+	stamp := d.now().UTC().Format(timeFormat)
+	p := filepath.Join(d.o.Directory, stamp+spoolExt)
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	spooling.Store(p, struct{}{})
+	return &batch{
+		name: d.o.Prefix + stamp + ".tar.gz",
+		path: p,
+		f:    f,
+		tw:   tar.NewWriter(f),
+	}, nil
+}
+
+// flush stores the spooled archive in the wrapped destination and retries until it is stored.
+func (d *Destination) flush(b *batch) {
+	defer spooling.Delete(b.path)
+	for i := 0; ; i++ {
+		err := d.store(b)
+		if err == nil {
+			break
+		}
+		w := d.o.Interval
+		if i < 16 && d.retryWait<<i < w {
+			w = d.retryWait << i
+		}
+		time.Sleep(w)
+	}
+	os.Remove(b.path)
+}
+
+// store compresses the members of the spooled archive and stores the archive in the wrapped destination.
+func (d *Destination) store(b *batch) error {
+	n, err := members(b.path)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return nil
+	}
+	f, err := os.Open(b.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := os.CreateTemp("", "ingest-archive-*.tar.gz")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(gz.Name())
+	defer gz.Close()
+
+	gw := gzip.NewWriter(gz)
+	tw := tar.NewWriter(gw)
+	tr := tar.NewReader(f)
+	for i := 0; i < n; i++ {
+		h, err := tr.Next()
+		if err != nil {
+			return err
+		}
+		if err := tw.WriteHeader(h); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gw.Close(); err != nil {
+		return err
+	}
+	size, err := gz.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := gz.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	c := ingest.NewCodec(b.name, b.name, nil)
+	_, err = d.Destination.Store(context.Background(), c, ingest.Object{
+		Reader:   gz,
+		Len:      size,
+		MimeType: "application/gzip",
+	})
+	return err
+}
+
+// members returns the number of complete members of the spooled archive at the given path.
+// An archive that was spooled by a process that was killed ends without a trailer and possibly with an incomplete member.
+func members(p string) (int, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	tr := tar.NewReader(f)
+	var n int
+	for {
+		if _, err := tr.Next(); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, tar.ErrHeader) {
+				return n, nil
+			}
+			return 0, err
+		}
+		if _, err := io.Copy(io.Discard, tr); err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return n, nil
+			}
+			return 0, err
+		}
+		n++
+	}
+}
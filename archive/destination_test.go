@@ -0,0 +1,194 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/storage"
+)
+
+// fakeDestination stores objects in memory.
+type fakeDestination struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	// failures is the number of calls to Store that fail before objects are stored.
+	failures int
+}
+
+func (f *fakeDestination) Configure(map[string]interface{}) error { return nil }
+
+func (f *fakeDestination) Stat(context.Context, ingest.Codec) (*storage.ObjectInfo, error) {
+	return nil, os.ErrNotExist
+}
+
+func (f *fakeDestination) Store(_ context.Context, c ingest.Codec, obj ingest.Object) (*url.URL, error) {
+	buf, err := io.ReadAll(obj.Reader)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failures > 0 {
+		f.failures--
+		return nil, errors.New("failed to store object")
+	}
+	f.objects[c.Name] = buf
+	return &url.URL{Scheme: "fake", Path: "/" + c.Name}, nil
+}
+
+// archives returns the stored archives once the given number of archives was stored.
+func (f *fakeDestination) archives(t *testing.T, n int) map[string][]byte {
+	var objects map[string][]byte
+	require.Eventually(t, func() bool {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		objects = make(map[string][]byte, len(f.objects))
+		for k, v := range f.objects {
+			objects[k] = v
+		}
+		return len(objects) == n
+	}, 5*time.Second, time.Millisecond)
+	return objects
+}
+
+func untar(t *testing.T, buf []byte) map[string]string {
+	gr, err := gzip.NewReader(bytes.NewReader(buf))
+	require.NoError(t, err)
+	tr := tar.NewReader(gr)
+	files := make(map[string]string)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		require.NoError(t, err)
+		b, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		files[h.Name] = string(b)
+	}
+}
+
+func TestDestination(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("max objects", func(t *testing.T) {
+		fd := &fakeDestination{objects: make(map[string][]byte)}
+		d, err := NewDestination(fd, DestinationOptions{Directory: t.TempDir(), Prefix: "archives/", Interval: time.Hour, MaxObjects: 3})
+		require.NoError(t, err)
+
+		_, err = d.Stat(ctx, ingest.NewCodec("a", "a", nil))
+		assert.True(t, os.IsNotExist(err))
+
+		// Store does not wait for the archive, so an archive holds more objects than are stored concurrently.
+		urls := make([]string, 3)
+		for i := range urls {
+			n := fmt.Sprintf("dir/%d.txt", i)
+			u, err := d.Store(ctx, ingest.NewCodec(n, n, nil), ingest.Object{Reader: strings.NewReader(n), Len: -1})
+			require.NoError(t, err)
+			urls[i] = u.String()
+		}
+
+		objects := fd.archives(t, 1)
+		for name, buf := range objects {
+			assert.True(t, strings.HasPrefix(name, "archives/"))
+			assert.True(t, strings.HasSuffix(name, ".tar.gz"))
+			assert.Equal(t, map[string]string{
+				"dir/0.txt": "dir/0.txt",
+				"dir/1.txt": "dir/1.txt",
+				"dir/2.txt": "dir/2.txt",
+			}, untar(t, buf))
+			for i, u := range urls {
+				assert.Equal(t, fmt.Sprintf("archive:%s#dir/%d.txt", name, i), u)
+			}
+		}
+	})
+
+	t.Run("interval", func(t *testing.T) {
+		fd := &fakeDestination{objects: make(map[string][]byte)}
+		d, err := NewDestination(fd, DestinationOptions{Directory: t.TempDir(), Interval: 10 * time.Millisecond, MaxObjects: 100})
+		require.NoError(t, err)
+
+		_, err = d.Store(ctx, ingest.NewCodec("a", "../a.txt", nil), ingest.Object{Reader: strings.NewReader("foo"), Len: 3})
+		require.NoError(t, err)
+		for _, buf := range fd.archives(t, 1) {
+			assert.Equal(t, map[string]string{"a.txt": "foo"}, untar(t, buf))
+		}
+	})
+
+	t.Run("stat", func(t *testing.T) {
+		dir := t.TempDir()
+		fd := &fakeDestination{objects: make(map[string][]byte)}
+		d, err := NewDestination(fd, DestinationOptions{Directory: dir, Interval: time.Hour})
+		require.NoError(t, err)
+
+		c := ingest.NewCodec("a", "a.txt", nil)
+		u, err := d.Store(ctx, c, ingest.Object{Reader: strings.NewReader("foo"), Len: 3})
+		require.NoError(t, err)
+		oi, err := d.Stat(ctx, c)
+		require.NoError(t, err)
+		assert.Equal(t, u.String(), oi.URI)
+
+		// The index outlives the destination.
+		d, err = NewDestination(fd, DestinationOptions{Directory: dir, Interval: time.Hour})
+		require.NoError(t, err)
+		oi, err = d.Stat(ctx, c)
+		require.NoError(t, err)
+		assert.Equal(t, u.String(), oi.URI)
+		_, err = d.Stat(ctx, ingest.NewCodec("b", "b.txt", nil))
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("retry", func(t *testing.T) {
+		fd := &fakeDestination{objects: make(map[string][]byte), failures: 2}
+		d, err := NewDestination(fd, DestinationOptions{Directory: t.TempDir(), MaxObjects: 1})
+		require.NoError(t, err)
+		d.retryWait = time.Millisecond
+
+		_, err = d.Store(ctx, ingest.NewCodec("a", "a.txt", nil), ingest.Object{Reader: strings.NewReader("foo"), Len: 3})
+		require.NoError(t, err)
+		for _, buf := range fd.archives(t, 1) {
+			assert.Equal(t, map[string]string{"a.txt": "foo"}, untar(t, buf))
+		}
+	})
+
+	t.Run("recover", func(t *testing.T) {
+		// A process was killed while it wrote the second member of an archive.
+		dir := t.TempDir()
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		require.NoError(t, tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "a.txt", Size: 3, Mode: 0o644}))
+		_, err := tw.Write([]byte("foo"))
+		require.NoError(t, err)
+		require.NoError(t, tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "b.txt", Size: 1024, Mode: 0o644}))
+		_, err = tw.Write([]byte("bar"))
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "20230102T030405.000000000Z.tar"), buf.Bytes(), 0o600))
+
+		fd := &fakeDestination{objects: make(map[string][]byte)}
+		_, err = NewDestination(fd, DestinationOptions{Directory: dir, Prefix: "archives/"})
+		require.NoError(t, err)
+		objects := fd.archives(t, 1)
+		require.Contains(t, objects, "archives/20230102T030405.000000000Z.tar.gz")
+		assert.Equal(t, map[string]string{"a.txt": "foo"}, untar(t, objects["archives/20230102T030405.000000000Z.tar.gz"]))
+		require.Eventually(t, func() bool {
+			_, err := os.Stat(filepath.Join(dir, "20230102T030405.000000000Z.tar"))
+			return os.IsNotExist(err)
+		}, 5*time.Second, time.Millisecond)
+	})
+}
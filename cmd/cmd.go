@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -9,6 +10,7 @@ import (
 	"github.com/go-kit/log/level"
 
 	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/cron"
 )
 
 // NewEnqueuerRunner produces a runnable function from an ingest.Enqueuer.
@@ -46,6 +48,41 @@ func NewEnqueuerRunner(ctx context.Context, e ingest.Enqueuer, interval time.Dur
 	}
 }
 
+// NewScheduledEnqueuerRunner produces a runnable function from an ingest.Enqueuer.
+// The Enqueue method will be executed at the times of the schedule until the given context is cancelled.
+// Every run times out at the next scheduled time.
+func NewScheduledEnqueuerRunner(ctx context.Context, e ingest.Enqueuer, s *cron.Schedule, l log.Logger) func() error {
+	if l == nil {
+		l = log.NewNopLogger()
+	}
+
+	return func() error {
+		level.Info(l).Log("msg", "starting the enqueuer")
+
+		next := s.Next(time.Now())
+		for {
+			if next.IsZero() {
+				return errors.New("enqueuer exited unexpectedly: the schedule does not match any future time")
+			}
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return nil
+			}
+			next = s.Next(next)
+			{
+				ctx, cancel := context.WithDeadline(ctx, next)
+				if err := e.Enqueue(ctx); err != nil {
+					level.Error(l).Log("msg", "failed to enqueue", "err", err.Error())
+				}
+				cancel()
+			}
+		}
+	}
+}
+
 // NewDequeuerRunner produces a runnable function from an ingest.Dequeuer.
 // The Dequeue method will run until the given context is cancelled.
 func NewDequeuerRunner(ctx context.Context, d ingest.Dequeuer, l log.Logger) func() error {
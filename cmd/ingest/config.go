@@ -0,0 +1,31 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// configCommand is the subcommand that shows the configuration, e.g. to debug why a workflow behaves unexpectedly.
+	configCommand = "config"
+
+	configUsage = `usage: ingest config render`
+)
+
+// runConfigCommand prints the configuration as ingest uses it with the secrets redacted.
+func runConfigCommand(appFlags *flags, args []string, w io.Writer) error {
+	if len(args) != 1 || args[0] != "render" {
+		return errors.New(configUsage)
+	}
+	c, err := loadConfig(appFlags, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create configuration: %w", err)
+	}
+	buf, err := c.Render()
+	if err != nil {
+		return fmt.Errorf("failed to render configuration: %w", err)
+	}
+	_, err = w.Write(buf)
+	return err
+}
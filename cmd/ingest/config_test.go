@@ -0,0 +1,26 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunConfigCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	appFlags := &flags{configPath: toPtr(path), strictConfig: toPtr(false)}
+
+	var b bytes.Buffer
+	assert.Error(t, runConfigCommand(appFlags, nil, &b))
+	assert.Error(t, runConfigCommand(appFlags, []string{"foo"}, &b))
+	assert.Error(t, runConfigCommand(appFlags, []string{"render"}, &b), "the configuration file does not exist")
+
+	require.NoError(t, os.WriteFile(path, []byte(reloadConfig), 0o600))
+	require.NoError(t, runConfigCommand(appFlags, []string{"render"}, &b))
+	assert.Contains(t, b.String(), "name: foo-baz")
+	assert.Contains(t, b.String(), "batchSize: 8")
+}
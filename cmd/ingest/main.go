@@ -2,12 +2,14 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	stdlog "log"
 	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"syscall"
 	"time"
@@ -19,15 +21,23 @@ import (
 	"github.com/oklog/run"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	flag "github.com/spf13/pflag"
 
 	"github.com/connylabs/ingest"
 	"github.com/connylabs/ingest/cmd"
 	"github.com/connylabs/ingest/config"
+	"github.com/connylabs/ingest/cron"
 	"github.com/connylabs/ingest/dequeue"
 	"github.com/connylabs/ingest/enqueue"
+	"github.com/connylabs/ingest/history"
 	"github.com/connylabs/ingest/plugin"
+	// Register the built-in plugins.
+	_ "github.com/connylabs/ingest/plugin/drive"
+	_ "github.com/connylabs/ingest/plugin/s3"
 	"github.com/connylabs/ingest/queue"
+	"github.com/connylabs/ingest/secret"
+	"github.com/connylabs/ingest/state"
 	"github.com/connylabs/ingest/storage"
 	"github.com/connylabs/ingest/storage/multi"
 	"github.com/connylabs/ingest/version"
@@ -54,13 +64,22 @@ var availableLogLevels = strings.Join([]string{
 const (
 	dequeueMode = "dequeue"
 	enqueueMode = "enqueue"
+	// allMode runs the enqueuers and dequeuers in the same process,
+	// e.g. to use the in-memory queue.
+	allMode = "all"
 
 	watchPluginInterval = 5 * time.Second
+
+	// prioritySuffix is appended to the subjects and consumers of workflows for priority messages.
+	prioritySuffix = "priority"
+	// deadLetterSuffix is appended to the subjects of workflows for messages whose last delivery failed.
+	deadLetterSuffix = "dead-letter"
 )
 
 var availableModes = strings.Join([]string{
 	dequeueMode,
 	enqueueMode,
+	allMode,
 }, ", ")
 
 func main() {
@@ -73,19 +92,55 @@ func main() {
 type flags struct {
 	listenInternal    *string
 	queueEndpoint     *string
+	queueCreds        *string
+	queueNKey         *string
+	queueUser         *string
+	queuePassword     *string
+	queueToken        *string
+	queueEmbedded     *bool
+	queueEmbeddedDir  *string
 	replicas          *int
 	stream            *string
 	subject           *string
 	consumer          *string
 	maxMsgs           *int64
+	dedupWindow       *time.Duration
+	publishRetries    *int
+	publishRetryWait  *time.Duration
+	publishBufferSize *int
+	maxAge            *time.Duration
+	maxBytes          *int64
+	retention         *string
+	discard           *string
 	printVersion      *bool
 	logLevel          *string
 	mode              *string
 	help              *bool
 	pluginDirectories *[]string
+	pluginRestarts    *int
+	pluginBackoff     *time.Duration
+	pluginCgroup      *string
+	pluginHotSwap     *bool
 	configPath        *string
 	dryRun            *bool
 	strictWorkflows   *bool
+	historyBucket     *string
+	stateBucket       *string
+	watchConfig       *bool
+	configRefresh     *time.Duration
+	strictConfig      *bool
+}
+
+// loadConfig reads the configuration from the path given by --config
+// or, if there is no configuration at the path, derives it from the environment.
+func loadConfig(appFlags *flags, r prometheus.Registerer) (*config.Config, error) {
+	if config.FromEnv(*appFlags.configPath) {
+		return config.NewFromEnv(os.Environ(), r)
+	}
+	if *appFlags.strictConfig {
+		return config.NewFromPathStrict(*appFlags.configPath, r)
+	}
+	return config.NewFromPath(*appFlags.configPath, r)
 }
 
 // Main is a convenience function that serves as a main that can return an error.
@@ -97,20 +152,44 @@ func Main() error {
 
 	appFlags := &flags{
 		listenInternal:    flag.String("listen", ":9090", "The address at which to listen for health and metrics"),
-		queueEndpoint:     flag.String("queue-endpoint", "nats://localhost:4222", "The queue endpoint to which to connect"),
+		queueEndpoint:     flag.String("queue-endpoint", "nats://localhost:4222", "The URL of the queue to which to connect. The scheme selects the queue driver, e.g. nats://"),
+		queueCreds:        flag.String("queue-creds", "", "The path of a NATS credentials file with which to authenticate"),
+		queueNKey:         flag.String("queue-nkey", "", "The path of a NATS NKey seed file with which to authenticate"),
+		queueUser:         flag.String("queue-user", "", "The NATS user with which to authenticate"),
+		queuePassword:     flag.String("queue-password", "", "The password of the NATS user"),
+		queueToken:        flag.String("queue-token", "", "The NATS token with which to authenticate"),
+		queueEmbedded:     flag.Bool("queue-embedded", false, "Start a NATS server with JetStream in the process that listens at the address of --queue-endpoint, e.g. for single-node installations"),
+		queueEmbeddedDir:  flag.String("queue-embedded-dir", filepath.Join(hd, ".local/share/ingest/nats"), "The directory in which the embedded NATS server stores its data"),
 		replicas:          flag.Int("stream-replicas", 1, "The replicas of the NATS stream"),
 		stream:            flag.String("stream", "ingest", "The stream name to which to connect"),
 		subject:           flag.String("subject", "ingest", "The subject name to which to connect"),
 		consumer:          flag.String("consumer", "ingest", "The prefix to use for dynamically created consumer names"),
 		maxMsgs:           flag.Int64("max-msgs", 0, "The maximum amount of messages in the jet stream. Set to 0 to remove limit"),
+		maxAge:            flag.Duration("max-age", 0, "The maximum age of messages in the jet stream. Set to 0 to remove limit"),
+		maxBytes:          flag.Int64("max-bytes", 0, "The maximum size of the jet stream in bytes. Set to 0 to remove limit"),
+		retention:         flag.String("stream-retention", "interest", "The retention policy of the jet stream. Possible values: interest, limits, workqueue"),
+		discard:           flag.String("stream-discard", "old", "Which messages to discard when the jet stream reaches a limit. Possible values: old, new"),
+		dedupWindow:       flag.Duration("dedup-window", 0, "The duration for which the queue drops messages of elements that were already enqueued. It should exceed the interval of the workflows. Set to 0 to use the default of the queue"),
+		publishRetries:    flag.Int("publish-retries", 3, "The number of times that publishing a message to NATS is retried after a transient error"),
+		publishRetryWait:  flag.Duration("publish-retry-wait", 100*time.Millisecond, "The duration before the first retry of publishing a message to NATS, which doubles with every retry"),
+		publishBufferSize: flag.Int("publish-buffer-size", 1000, "The maximum number of messages that are buffered while the connection to NATS is interrupted. Set to 0 to fail publishing instead"),
 		printVersion:      flag.Bool("version", false, "Show version"),
 		logLevel:          flag.String("log-level", logLevelInfo, fmt.Sprintf("Log level to use. Possible values: %s", availableLogLevels)),
 		mode:              flag.String("mode", "", fmt.Sprintf("Mode of the service. Possible values: %s", availableModes)),
 		help:              flag.Bool("h", false, "Show usage"),
 		pluginDirectories: flag.StringSlice("plugins", []string{filepath.Join(hd, ".config/ingest/plugins")}, "The directories in which to look for plugins. Directories are searched in the order specified with the first match taking precedence"),
-		configPath:        flag.String("config", filepath.Join(hd, ".config/ingest/config"), "The path to the configuration file for ingest"),
+		pluginRestarts:    flag.Int("plugin-max-restarts", 5, "The number of times that a plugin that stops responding is restarted within ten minutes before ingest gives up and exits. Set to 0 to exit as soon as a plugin stops responding"),
+		pluginBackoff:     flag.Duration("plugin-restart-backoff", time.Second, "The duration before the first restart of a plugin that stopped responding, which doubles with every further restart up to a minute"),
+		pluginCgroup:      flag.String("plugin-cgroup", "", "A cgroup v2 directory, e.g. /sys/fs/cgroup/ingest, in which the plugins with resource limits get their own cgroups on Linux. Without it, only the memory of plugins is limited with an rlimit and CPU limits are refused"),
+		pluginHotSwap:     flag.Bool("plugin-hot-swap", true, "Swap plugins whose files were replaced, e.g. by an upgrade, for new plugins with the same configuration without restarting ingest"),
+		configPath:        flag.String("config", filepath.Join(hd, ".config/ingest/config"), "The path to the configuration file for ingest, to a directory of YAML configuration files that are merged or an http(s):// or s3:// URL of a configuration or a k8s://namespace?selector=... URL of ConfigMaps. If it does not exist and INGEST_SOURCE_TYPE is set, then the configuration is derived from INGEST_* environment variables"),
 		dryRun:            flag.Bool("dry-run", false, "Only load the configuration and exit without performing any copy operations"),
 		strictWorkflows:   flag.Bool("strict-workflows", true, "Fail if any of the workflows cannot be started due to a configuration problem."),
+		strictConfig:      flag.Bool("strict-config", false, "Fail if the configuration contains unknown fields, e.g. typos like batchsize instead of batchSize. Unknown fields of sources and destinations in v1 configurations are passed to their plugins"),
+		historyBucket:     flag.String("history-bucket", "ingest_runs", "The NATS key-value bucket in which to record the run history of workflows. Set to an empty string to disable the run history. The run history is disabled if the queue is not NATS"),
+		watchConfig:       flag.Bool("watch-config", true, "Reload the configuration when the configuration file or the configuration at the URL changes. The configuration is always reloaded on SIGHUP"),
+		configRefresh:     flag.Duration("config-refresh-interval", time.Minute, "The interval at which a configuration URL given by --config is fetched again to apply its changes if --watch-config is set"),
+		stateBucket:       flag.String("state-bucket", "", "The NATS key-value bucket in which to persist the checkpoints of sources, so that their listings stay incremental across restarts. Set to an empty string to disable checkpoints"),
 	}
 
 	flag.Parse()
@@ -145,13 +224,23 @@ func Main() error {
 		return nil
 	}
 
+	if flag.Arg(0) == validateCommand {
+		return runValidateCommand(appFlags, flag.Args()[1:], os.Stdout, logger)
+	}
+	if flag.Arg(0) == configCommand {
+		return runConfigCommand(appFlags, flag.Args()[1:], os.Stdout)
+	}
+	if flag.Arg(0) == pluginsCommand {
+		return runPluginsCommand(context.Background(), appFlags, flag.Args()[1:], os.Stdout)
+	}
+
 	reg := prometheus.NewRegistry()
 	reg.MustRegister(
 		collectors.NewGoCollector(),
 		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
 	)
 
-	c, err := config.NewFromPath(*appFlags.configPath, reg)
+	c, err := loadConfig(appFlags, reg)
 	if err != nil {
 		return fmt.Errorf("failed to create configuration: %w", err)
 	}
@@ -159,8 +248,43 @@ func Main() error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	auth := queue.NATSAuth{
+		CredentialsFile: *appFlags.queueCreds,
+		NKeySeedFile:    *appFlags.queueNKey,
+		User:            *appFlags.queueUser,
+		Password:        *appFlags.queuePassword,
+		Token:           *appFlags.queueToken,
+	}
+	var k *queue.Keyring
+	if c.Encryption != nil {
+		if k, err = c.Encryption.Keyring(); err != nil {
+			return err
+		}
+	}
+	if flag.Arg(0) == queueCommand {
+		return runQueueCommand(ctx, appFlags, c.Workflows, auth, k, flag.Args()[1:], os.Stdout)
+	}
+
 	pm := plugin.NewPluginManager(watchPluginInterval, logger)
-	gatheres := prometheus.Gatherers{pm, reg}
+	pm.Secrets = secret.NewResolver()
+	if *appFlags.pluginRestarts > 0 {
+		pm.Restart = &plugin.RestartPolicy{
+			Backoff:     *appFlags.pluginBackoff,
+			MaxBackoff:  time.Minute,
+			MaxRestarts: *appFlags.pluginRestarts,
+			Window:      10 * time.Minute,
+		}
+	}
+	if pm.Verifier, err = c.PluginVerifier(); err != nil {
+		return err
+	}
+	if pm.Limits, err = c.PluginLimits(); err != nil {
+		return err
+	}
+	pm.Cgroup = *appFlags.pluginCgroup
+	pm.HotSwap = *appFlags.pluginHotSwap
+	// The metrics of plugins are gathered with the metrics of the workflows that use them.
+	gatheres := prometheus.Gatherers{reg}
 	sources, destinations, err := c.ConfigurePlugins(pm, *appFlags.pluginDirectories, *appFlags.strictWorkflows)
 	if err != nil {
 		return err
@@ -168,10 +292,36 @@ func Main() error {
 	if *appFlags.dryRun {
 		return nil
 	}
-	q, err := queue.New(*appFlags.queueEndpoint, *appFlags.stream, *appFlags.replicas, []string{strings.Join([]string{*appFlags.subject, "*"}, ".")}, *appFlags.maxMsgs, reg)
+	if *appFlags.mode != allMode {
+		local, err := queue.Local(*appFlags.queueEndpoint)
+		if err != nil {
+			return err
+		}
+		// Messages of local queues would never reach a process that runs in the other mode.
+		if local {
+			return fmt.Errorf("the queue %q cannot be shared between processes, so it requires --mode=%s", *appFlags.queueEndpoint, allMode)
+		}
+	}
+	if *appFlags.queueEmbedded {
+		if *appFlags.replicas > 1 {
+			return errors.New("the embedded NATS server does not support more than one stream replica")
+		}
+		e, err := queue.StartEmbedded(*appFlags.queueEndpoint, *appFlags.queueEmbeddedDir, auth, logger)
+		if err != nil {
+			return fmt.Errorf("failed to start embedded NATS server: %w", err)
+		}
+		defer e.Shutdown()
+		*appFlags.queueEndpoint = e.ClientURL()
+	}
+	o := queueOptions(appFlags, c.Workflows, auth)
+	o.Logger = log.With(logger, "component", "queue")
+	q, err := queue.Open(*appFlags.queueEndpoint, o, reg)
 	if err != nil {
 		return fmt.Errorf("failed to instantiate queue: %w", err)
 	}
+	if k != nil {
+		q = queue.NewEncrypted(q, k)
+	}
 	defer func() {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
 		defer cancel()
@@ -179,21 +329,103 @@ func Main() error {
 			level.Error(logger).Log("msg", "failed to close queue", "err", err.Error())
 		}
 	}()
+	isNATS, err := queue.IsNATS(*appFlags.queueEndpoint)
+	if err != nil {
+		return err
+	}
+	var hs history.Store
+	if *appFlags.historyBucket != "" && !isNATS {
+		// The run history is on by default, so it must not prevent other queues from starting.
+		level.Info(logger).Log("msg", "run history is disabled because the queue is not NATS")
+	}
+	if *appFlags.historyBucket != "" && isNATS {
+		opts, err := auth.Options()
+		if err != nil {
+			return err
+		}
+		hs, err = history.New(*appFlags.queueEndpoint, *appFlags.historyBucket, *appFlags.replicas, opts...)
+		if err != nil {
+			return fmt.Errorf("failed to instantiate run history: %w", err)
+		}
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+			defer cancel()
+			if err := hs.Close(ctx); err != nil {
+				level.Error(logger).Log("msg", "failed to close run history", "err", err.Error())
+			}
+		}()
+	}
+	var ss state.Store
+	if *appFlags.stateBucket != "" {
+		opts, err := auth.Options()
+		if err != nil {
+			return err
+		}
+		ss, err = state.New(*appFlags.queueEndpoint, *appFlags.stateBucket, *appFlags.replicas, opts...)
+		if err != nil {
+			return fmt.Errorf("failed to instantiate state store: %w", err)
+		}
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+			defer cancel()
+			if err := ss.Close(ctx); err != nil {
+				level.Error(logger).Log("msg", "failed to close state store", "err", err.Error())
+			}
+		}()
+	}
 	var g run.Group
-	if err := runGroup(ctx, &g, q, appFlags, sources, destinations, c.Workflows, logger, reg); err != nil {
+	s, err := runGroup(ctx, &g, q, hs, ss, appFlags, c, pm, sources, destinations, logger)
+	if err != nil {
 		return err
 	}
+	gatheres = append(gatheres, s)
+
+	// Reload the configuration on SIGHUP and when the configuration file changes.
+	{
+		logger := log.With(logger, "component", "config")
+		reloadsTotal := promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "ingest_config_reloads_total",
+			Help: "Number of reloads of the configuration.",
+		}, []string{"result"})
+		for _, r := range []string{"error", "success"} {
+			reloadsTotal.WithLabelValues(r).Add(0)
+		}
+		reload := func() {
+			c, err := loadConfig(appFlags, reg)
+			if err == nil {
+				err = s.reload(pm, c)
+			}
+			if err != nil {
+				reloadsTotal.WithLabelValues("error").Inc()
+				level.Error(logger).Log("msg", "failed to reload configuration", "err", err.Error())
+				return
+			}
+			reloadsTotal.WithLabelValues("success").Inc()
+		}
+		ctx, cancel := context.WithCancel(ctx)
+		g.Add(func() error {
+			// A configuration that is derived from the environment cannot change.
+			return watchConfig(ctx, *appFlags.configPath, *appFlags.watchConfig && !config.FromEnv(*appFlags.configPath), *appFlags.configRefresh, reload, logger)
+		}, func(error) {
+			cancel()
+		})
+	}
 
 	{
 		// Run the internal HTTP server.
 		logger := log.With(logger, "component", "internal-server")
 		healthchecks := healthcheck.NewMetricsHandler(healthcheck.NewHandler(), reg)
+		// Degraded and unhealthy sources and destinations make ingest unready, e.g. when their credentials expired.
+		healthchecks.AddReadinessCheck("plugins", pm.Healthy)
 		h := internalserver.NewHandler(
 			internalserver.WithName("Internal - ingest"),
 			internalserver.WithHealthchecks(healthchecks),
 			internalserver.WithPrometheusGatherer(gatheres),
 			internalserver.WithPProf(),
 		)
+		if hs != nil {
+			h.AddEndpoint("/workflows/", "Exposes the run history of workflows under /workflows/{name}/runs", history.NewHandler(hs))
+		}
 		l, err := net.Listen("tcp", *appFlags.listenInternal)
 		if err != nil {
 			return fmt.Errorf("failed to listen on %s: %v", *appFlags.listenInternal, err)
@@ -210,7 +442,7 @@ func Main() error {
 			l.Close()
 		})
 
-		// Stop the application if a plugin has crashed.
+		// Restart plugins that stopped responding and stop the application if a plugin is crash-looping.
 		{
 			ctx, cancel := context.WithCancel(ctx)
 			g.Add(func() error {
@@ -235,71 +467,334 @@ func Main() error {
 	return g.Run()
 }
 
-func runGroup(ctx context.Context, g *run.Group, q ingest.Queue, appFlags *flags, sources map[string]plugin.Source, destinations map[string]plugin.Destination, workflows []config.Workflow, logger log.Logger, reg prometheus.Registerer) error {
+// queueOptions returns the options of the queue.
+// Workflows with their own stream are excluded from the shared stream,
+// which then lists the subjects of the remaining workflows instead of a wildcard,
+// as it does if workflows override their subjects. Workflows that name the same stream share it.
+func queueOptions(appFlags *flags, workflows []config.Workflow, auth queue.NATSAuth) queue.Options {
+	o := queue.Options{
+		Stream:            *appFlags.stream,
+		Replicas:          *appFlags.replicas,
+		Subjects:          []string{strings.Join([]string{*appFlags.subject, "*"}, ".")},
+		MaxMsgs:           *appFlags.maxMsgs,
+		MaxAge:            *appFlags.maxAge,
+		MaxBytes:          *appFlags.maxBytes,
+		Retention:         *appFlags.retention,
+		Discard:           *appFlags.discard,
+		DedupWindow:       *appFlags.dedupWindow,
+		NATSAuth:          auth,
+		PublishRetries:    *appFlags.publishRetries,
+		PublishRetryWait:  *appFlags.publishRetryWait,
+		PublishBufferSize: *appFlags.publishBufferSize,
+	}
+	var shared []string
+	var priority, dead, custom bool
+	streams := make(map[string]int)
 	for _, w := range workflows {
-		logger = log.With(logger, "workflow", w.Name)
-		reg := prometheus.WrapRegistererWith(prometheus.Labels{
-			"source":   w.Source,
-			"workflow": w.Name,
-		}, reg)
-		switch *appFlags.mode {
-		case enqueueMode:
-			ctx, cancel := context.WithCancel(ctx)
-			logger := log.With(logger, "mode", enqueueMode, "source", w.Source)
-			qc, err := enqueue.New(sources[w.Source], strings.Join([]string{*appFlags.subject, w.Name}, "."), q, reg, logger)
+		subjects := []string{workflowSubject(appFlags, w)}
+		if w.Priority != "" {
+			subjects = append(subjects, prioritySubject(appFlags, w))
+		}
+		if deadLetter(w) {
+			subjects = append(subjects, deadLetterSubject(appFlags, w))
+		}
+		if w.Consumer != nil {
+			c := queue.Consumer{
+				Name:       workflowConsumer(appFlags, w),
+				AckWait:    time.Duration(w.Consumer.AckWait),
+				MaxDeliver: w.Consumer.MaxDeliver,
+			}
+			for _, b := range w.Consumer.Backoff {
+				c.Backoff = append(c.Backoff, time.Duration(b))
+			}
+			o.Consumers = append(o.Consumers, c)
+			if w.Priority != "" {
+				c.Name = priorityConsumer(appFlags, w)
+				o.Consumers = append(o.Consumers, c)
+			}
+		}
+		if w.Stream == nil {
+			shared = append(shared, subjects...)
+			priority = priority || w.Priority != ""
+			dead = dead || deadLetter(w)
+			custom = custom || w.Subject != ""
+			continue
+		}
+		if i, ok := streams[workflowStream(appFlags, w)]; ok {
+			o.Streams[i].Subjects = append(o.Streams[i].Subjects, subjects...)
+			continue
+		}
+		streams[workflowStream(appFlags, w)] = len(o.Streams)
+		o.Streams = append(o.Streams, queue.Stream{
+			Name:      workflowStream(appFlags, w),
+			Subjects:  subjects,
+			Replicas:  w.Stream.Replicas,
+			MaxMsgs:   w.Stream.MaxMsgs,
+			MaxAge:    time.Duration(w.Stream.MaxAge),
+			MaxBytes:  w.Stream.MaxBytes,
+			Retention: w.Stream.Retention,
+			Discard:   w.Stream.Discard,
+		})
+	}
+	if len(o.Streams) > 0 || custom {
+		o.Subjects = shared
+	} else {
+		if priority {
+			o.Subjects = append(o.Subjects, strings.Join([]string{*appFlags.subject, "*", prioritySuffix}, "."))
+		}
+		if dead {
+			o.Subjects = append(o.Subjects, strings.Join([]string{*appFlags.subject, "*", deadLetterSuffix}, "."))
+		}
+	}
+	return o
+}
+
+// workflowSubject returns the subject of the messages of the workflow.
+func workflowSubject(appFlags *flags, w config.Workflow) string {
+	if w.Subject != "" {
+		return w.Subject
+	}
+	return strings.Join([]string{*appFlags.subject, w.Name}, ".")
+}
+
+// prioritySubject returns the subject of the priority messages of the workflow.
+func prioritySubject(appFlags *flags, w config.Workflow) string {
+	return strings.Join([]string{workflowSubject(appFlags, w), prioritySuffix}, ".")
+}
+
+// deadLetter returns true if the workflow publishes messages whose last delivery failed to its dead-letter subject.
+func deadLetter(w config.Workflow) bool {
+	return w.Consumer != nil && w.Consumer.DeadLetter
+}
+
+// deadLetterSubject returns the subject of the messages of the workflow whose last delivery failed.
+func deadLetterSubject(appFlags *flags, w config.Workflow) string {
+	return strings.Join([]string{workflowSubject(appFlags, w), deadLetterSuffix}, ".")
+}
+
+// workflowConsumer returns the name of the durable consumer of the messages of the workflow.
+func workflowConsumer(appFlags *flags, w config.Workflow) string {
+	return strings.Join([]string{*appFlags.consumer, w.Name}, "__")
+}
+
+// priorityConsumer returns the name of the durable consumer of the priority messages of the workflow.
+func priorityConsumer(appFlags *flags, w config.Workflow) string {
+	return strings.Join([]string{*appFlags.consumer, w.Name, prioritySuffix}, "__")
+}
+
+// dependencyConsumers maps the durable consumers of the workflows on which the workflow depends to their subjects.
+func dependencyConsumers(appFlags *flags, w config.Workflow, workflows []config.Workflow) map[string]string {
+	consumers := make(map[string]string)
+	for _, d := range w.DependsOn {
+		for _, dw := range workflows {
+			if dw.Name != d {
+				continue
+			}
+			consumers[workflowConsumer(appFlags, dw)] = workflowSubject(appFlags, dw)
+			if dw.Priority != "" {
+				consumers[priorityConsumer(appFlags, dw)] = prioritySubject(appFlags, dw)
+			}
+		}
+	}
+	return consumers
+}
+
+// workflowStream returns the name of the stream that holds the messages of the workflow.
+func workflowStream(appFlags *flags, w config.Workflow) string {
+	if w.Stream == nil {
+		return *appFlags.stream
+	}
+	if w.Stream.Name != "" {
+		return w.Stream.Name
+	}
+	return strings.Join([]string{*appFlags.stream, w.Name}, "_")
+}
+
+// runGroup adds an actor to the group that runs the workflows of the configuration
+// and returns the supervisor of the workflows, which applies changes of the configuration.
+// The metrics of the plugins of the given manager, which may be nil, are labeled with the workflows that use them.
+func runGroup(ctx context.Context, g *run.Group, q ingest.Queue, hs history.Store, ss state.Store, appFlags *flags, c *config.Config, pm *plugin.PluginManager, sources map[string]plugin.Source, destinations map[string]plugin.Destination, logger log.Logger) (*supervisor, error) {
+	switch *appFlags.mode {
+	case enqueueMode, dequeueMode, allMode:
+	default:
+		flag.Usage()
+		return nil, fmt.Errorf("unsupported mode %q", *appFlags.mode)
+	}
+	s := &supervisor{
+		q:            q,
+		hs:           hs,
+		ss:           ss,
+		appFlags:     appFlags,
+		l:            logger,
+		errs:         make(chan error),
+		ready:        make(chan struct{}),
+		c:            c,
+		sources:      sources,
+		destinations: destinations,
+		workflows:    make(map[string]*workflowRun),
+		pm:           pm,
+	}
+	if c.MaxTransfers > 0 {
+		s.limiter = dequeue.NewLimiter(c.MaxTransfers)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	g.Add(func() error {
+		return s.run(ctx)
+	}, func(error) {
+		cancel()
+	})
+	return s, nil
+}
+
+// addWorkflow adds the enqueuer and dequeuer of the workflow to the group
+// and registers their metrics with the given registerer.
+// The given workflows are the workflows of the configuration, on which the workflow may depend,
+// and the given limiter, which may be nil, is shared by the dequeuers of all workflows.
+func addWorkflow(ctx context.Context, g *run.Group, q ingest.Queue, hs history.Store, ss state.Store, appFlags *flags, sources map[string]plugin.Source, destinations map[string]plugin.Destination, w config.Workflow, workflows []config.Workflow, limiter *dequeue.Limiter, logger log.Logger, reg prometheus.Registerer) error {
+	logger = log.With(logger, "workflow", w.Name)
+	reg = prometheus.WrapRegistererWith(prometheus.Labels{
+		"source":   w.Source,
+		"workflow": w.Name,
+	}, reg)
+	if i, ok := queue.AsInspector(q); ok {
+		consumers := map[string]string{workflowConsumer(appFlags, w): workflowSubject(appFlags, w)}
+		if w.Priority != "" {
+			consumers[priorityConsumer(appFlags, w)] = prioritySubject(appFlags, w)
+		}
+		if err := reg.Register(queue.NewCollector(i, consumers)); err != nil {
+			return fmt.Errorf("failed to register queue collector: %w", err)
+		}
+	}
+	if *appFlags.mode != dequeueMode {
+		ctx, cancel := context.WithCancel(ctx)
+		logger := log.With(logger, "mode", enqueueMode, "source", w.Source)
+		opts := []enqueue.Option{enqueue.WithHeader(ingest.Header{ingest.HeaderSource: w.Source, ingest.HeaderWorkflow: w.Name})}
+		if w.Priority != "" {
+			opts = append(opts, enqueue.WithPriority(regexp.MustCompile(w.Priority), prioritySubject(appFlags, w)))
+		}
+		if w.Filters != nil {
+			f, err := w.Filters.Filter()
 			if err != nil {
 				cancel()
-				return fmt.Errorf("failed to connect to the queue: %v", err)
+				return fmt.Errorf("failed to configure the filters: %v", err)
 			}
-			g.Add(
-				cmd.NewEnqueuerRunner(ctx, qc, time.Duration(*w.Interval), logger),
-				func(error) {
-					cancel()
-				},
-			)
-		case dequeueMode:
-			logger := log.With(logger, "mode", dequeueMode)
-			ss := make([]storage.Storage, 0, len(w.Destinations))
-			for _, d := range w.Destinations {
-				t := "unknown"
-				if dt, ok := destinations[d].(*config.DestinationTyper); ok {
-					t = dt.Type()
-				}
-				reg := prometheus.WrapRegistererWith(prometheus.Labels{
-					"destination": d,
-					"plugin":      t,
-				}, reg)
-				ss = append(ss, storage.NewInstrumentedStorage(destinations[d], reg))
+			opts = append(opts, enqueue.WithFilter(f))
+		}
+		if ss != nil {
+			opts = append(opts, enqueue.WithCheckpoints(state.NewCheckpoints(ss, w.Name)))
+		}
+		if len(w.DependsOn) != 0 {
+			if i, ok := queue.AsInspector(q); ok {
+				opts = append(opts, enqueue.WithDependencies(i, dependencyConsumers(appFlags, w, workflows)))
+			} else {
+				level.Warn(logger).Log("msg", "the queue driver cannot report pending messages, so the dependencies are ignored")
 			}
-			s := multi.NewMultiStorage(ss...)
-			if len(ss) > 1 {
-				s = storage.NewInstrumentedStorage(s, prometheus.WrapRegistererWith(prometheus.Labels{"destination": "multi", "plugin": "multi"}, reg))
+		}
+		qc, err := enqueue.New(sources[w.Source], workflowSubject(appFlags, w), q, history.NewRecorder(hs, w.Name), reg, logger, opts...)
+		if err != nil {
+			cancel()
+			return fmt.Errorf("failed to connect to the queue: %v", err)
+		}
+		var run func() error
+		if w.Schedule != "" {
+			s, err := cron.Parse(w.Schedule)
+			if err != nil {
+				cancel()
+				return fmt.Errorf("failed to parse the schedule: %v", err)
 			}
-			d := dequeue.New(
-				w.Webhook, sources[w.Source],
-				s,
-				q,
-				*appFlags.stream,
-				strings.Join([]string{*appFlags.consumer, w.Name}, "__"),
-				strings.Join([]string{*appFlags.subject, w.Name}, "."),
-				w.BatchSize,
-				w.Concurrency,
-				w.CleanUp,
-				logger,
-				reg,
-			)
-			ctx, cancel := context.WithCancel(ctx)
-			g.Add(
-				cmd.NewDequeuerRunner(ctx, d, logger),
-				func(error) {
-					cancel()
-				},
-			)
-
-		default:
-			flag.Usage()
-			return fmt.Errorf("unsupported mode %q", *appFlags.mode)
+			run = cmd.NewScheduledEnqueuerRunner(ctx, qc, s, logger)
+		} else {
+			run = cmd.NewEnqueuerRunner(ctx, qc, time.Duration(*w.Interval), logger)
+		}
+		g.Add(
+			run,
+			func(error) {
+				cancel()
+			},
+		)
+	}
+	if *appFlags.mode != enqueueMode {
+		logger := log.With(logger, "mode", dequeueMode)
+		ss := make([]storage.Storage, 0, len(w.Destinations))
+		for _, d := range w.Destinations {
+			t := "unknown"
+			if dt, ok := destinations[d].(*config.DestinationTyper); ok {
+				t = dt.Type()
+			}
+			reg := prometheus.WrapRegistererWith(prometheus.Labels{
+				"destination": d,
+				"plugin":      t,
+			}, reg)
+			ss = append(ss, storage.NewInstrumentedStorage(destinations[d], reg))
 		}
+		s := multi.NewMultiStorage(ss...)
+		if len(ss) > 1 {
+			s = storage.NewInstrumentedStorage(s, prometheus.WrapRegistererWith(prometheus.Labels{"destination": "multi", "plugin": "multi"}, reg))
+		}
+		var opts []dequeue.Option
+		if w.Priority != "" {
+			opts = append(opts, dequeue.WithPriority(prioritySubject(appFlags, w), priorityConsumer(appFlags, w)))
+		}
+		if w.PathTemplate != "" {
+			t, err := dequeue.ParsePathTemplate(w.PathTemplate)
+			if err != nil {
+				return fmt.Errorf("failed to parse the path template: %v", err)
+			}
+			opts = append(opts, dequeue.WithPathTemplate(t, w.Source, w.Name))
+		}
+		if limiter != nil {
+			opts = append(opts, dequeue.WithLimiter(limiter))
+		}
+		if w.Consumer != nil {
+			// Failed messages are delivered again like messages that were not acknowledged.
+			delays := make([]time.Duration, 0, len(w.Consumer.Backoff))
+			for _, b := range w.Consumer.Backoff {
+				delays = append(delays, time.Duration(b))
+			}
+			if len(delays) == 0 && w.Consumer.AckWait > 0 {
+				delays = append(delays, time.Duration(w.Consumer.AckWait))
+			}
+			opts = append(opts, dequeue.WithRedelivery(w.Consumer.MaxDeliver, delays...))
+			if w.Consumer.DeadLetter {
+				opts = append(opts, dequeue.WithDeadLetter(deadLetterSubject(appFlags, w)))
+			}
+		}
+		if w.Retry != nil {
+			retries := -1
+			if w.Retry.Retries != nil {
+				retries = *w.Retry.Retries
+			}
+			opts = append(opts, dequeue.WithRetries(retries, time.Duration(w.Retry.Wait), time.Duration(w.Retry.MaxWait)))
+		}
+		if w.MaxConcurrency > w.Concurrency {
+			if i, ok := queue.AsInspector(q); ok {
+				opts = append(opts, dequeue.WithAutoscaling(i, w.Concurrency, w.MaxConcurrency))
+			} else {
+				level.Warn(logger).Log("msg", "the queue driver cannot report pending messages, so the concurrency is not scaled")
+			}
+		}
+		d := dequeue.New(
+			w.Webhook, sources[w.Source],
+			s,
+			q,
+			history.NewRecorder(hs, w.Name),
+			workflowStream(appFlags, w),
+			workflowConsumer(appFlags, w),
+			workflowSubject(appFlags, w),
+			w.BatchSize,
+			w.Concurrency,
+			w.CleanUp != nil && *w.CleanUp,
+			logger,
+			reg,
+			opts...,
+		)
+		ctx, cancel := context.WithCancel(ctx)
+		g.Add(
+			cmd.NewDequeuerRunner(ctx, d, logger),
+			func(error) {
+				cancel()
+			},
+		)
 	}
 	return nil
 }
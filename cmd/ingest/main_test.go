@@ -266,7 +266,7 @@ workflows:
 	sources, destintations, err := c.ConfigurePlugins(pm, []string{fmt.Sprintf("../../bin/plugin/%s/%s", runtime.GOOS, runtime.GOARCH)}, true)
 	require.NoError(t, err)
 
-	q, err := queue.New(natsEndpoint, stream, 1, []string{fmt.Sprintf("%s.*", subject)}, 1000, reg)
+	q, err := queue.New(natsEndpoint, queue.Options{Stream: stream, Replicas: 1, Subjects: []string{fmt.Sprintf("%s.*", subject)}, MaxMsgs: 1000}, reg)
 	require.NoError(t, err)
 
 	l := log.NewJSONLogger(os.Stdout)
@@ -291,7 +291,8 @@ workflows:
 			mode:     toPtr(enqueueMode),
 			subject:  toPtr(subject),
 		}
-		require.NoError(t, runGroup(tctx, &g, q, appFlags, sources, destintations, c.Workflows, l, reg))
+		_, err := runGroup(tctx, &g, q, nil, nil, appFlags, c, nil, sources, destintations, l)
+		require.NoError(t, err)
 
 		wg.Add(1)
 		go func() {
@@ -308,7 +309,8 @@ workflows:
 			consumer:          toPtr(consumer),
 			pluginDirectories: toPtr([]string{fmt.Sprintf("../../bin/plugin/%s/%s", runtime.GOOS, runtime.GOARCH)}),
 		}
-		require.NoError(t, runGroup(tctx, &g, q, appFlags, sources, destintations, c.Workflows, l, reg))
+		_, err := runGroup(tctx, &g, q, nil, nil, appFlags, c, nil, sources, destintations, l)
+		require.NoError(t, err)
 
 		wg.Add(1)
 		go func() {
@@ -377,6 +379,67 @@ workflows:
 	}
 }
 
+func TestQueueOptions(t *testing.T) {
+	appFlags := &flags{
+		stream:            toPtr("ingest"),
+		subject:           toPtr("ingest"),
+		replicas:          toPtr(3),
+		maxMsgs:           toPtr(int64(10)),
+		dedupWindow:       toPtr(time.Duration(0)),
+		publishRetries:    toPtr(0),
+		publishRetryWait:  toPtr(time.Duration(0)),
+		publishBufferSize: toPtr(0),
+		maxAge:            toPtr(time.Duration(0)),
+		maxBytes:          toPtr(int64(0)),
+		retention:         toPtr("interest"),
+		discard:           toPtr("old"),
+	}
+	o := queueOptions(appFlags, []config.Workflow{{Name: "a"}, {Name: "b"}}, queue.NATSAuth{})
+	assert.Equal(t, []string{"ingest.*"}, o.Subjects)
+	assert.Empty(t, o.Streams)
+
+	o = queueOptions(appFlags, []config.Workflow{{Name: "a"}, {Name: "b", Stream: &config.Stream{MaxMsgs: 5, MaxAge: config.Duration(time.Hour), Retention: "limits"}}}, queue.NATSAuth{})
+	assert.Equal(t, []string{"ingest.a"}, o.Subjects)
+	assert.Equal(t, []queue.Stream{{Name: "ingest_b", Subjects: []string{"ingest.b"}, MaxMsgs: 5, MaxAge: time.Hour, Retention: "limits"}}, o.Streams)
+
+	o = queueOptions(appFlags, []config.Workflow{{Name: "a", Priority: "^urgent/"}, {Name: "b"}}, queue.NATSAuth{})
+	assert.Equal(t, []string{"ingest.*", "ingest.*.priority"}, o.Subjects)
+
+	o = queueOptions(appFlags, []config.Workflow{{Name: "a", Priority: "^urgent/"}, {Name: "b", Priority: "^urgent/", Stream: &config.Stream{}}}, queue.NATSAuth{})
+	assert.Equal(t, []string{"ingest.a", "ingest.a.priority"}, o.Subjects)
+	assert.Equal(t, []string{"ingest.b", "ingest.b.priority"}, o.Streams[0].Subjects)
+	assert.Empty(t, o.Consumers)
+
+	// Workflows can override their subjects and share named streams.
+	o = queueOptions(appFlags, []config.Workflow{
+		{Name: "a", Subject: "critical.a", Priority: "^urgent/"},
+		{Name: "b"},
+	}, queue.NATSAuth{})
+	assert.Equal(t, []string{"critical.a", "critical.a.priority", "ingest.b"}, o.Subjects)
+	assert.Empty(t, o.Streams)
+	o = queueOptions(appFlags, []config.Workflow{
+		{Name: "a", Subject: "critical.a", Stream: &config.Stream{Name: "critical", Replicas: 5}},
+		{Name: "b", Stream: &config.Stream{Name: "critical", Replicas: 5}},
+		{Name: "c"},
+	}, queue.NATSAuth{})
+	assert.Equal(t, []string{"ingest.c"}, o.Subjects)
+	assert.Equal(t, []queue.Stream{{Name: "critical", Subjects: []string{"critical.a", "ingest.b"}, Replicas: 5}}, o.Streams)
+
+	appFlags.consumer = toPtr("ingest")
+	o = queueOptions(appFlags, []config.Workflow{{Name: "a", Priority: "^urgent/", Consumer: &config.Consumer{MaxDeliver: 3, Backoff: []config.Duration{config.Duration(time.Minute)}}}, {Name: "b", Consumer: &config.Consumer{AckWait: config.Duration(time.Hour)}}}, queue.NATSAuth{})
+	assert.Equal(t, []queue.Consumer{
+		{Name: "ingest__a", MaxDeliver: 3, Backoff: []time.Duration{time.Minute}},
+		{Name: "ingest__a__priority", MaxDeliver: 3, Backoff: []time.Duration{time.Minute}},
+		{Name: "ingest__b", AckWait: time.Hour},
+	}, o.Consumers)
+	// Workflows with dead letters add their dead-letter subjects to their streams.
+	o = queueOptions(appFlags, []config.Workflow{{Name: "a", Consumer: &config.Consumer{DeadLetter: true}}, {Name: "b"}}, queue.NATSAuth{})
+	assert.Equal(t, []string{"ingest.*", "ingest.*.dead-letter"}, o.Subjects)
+	o = queueOptions(appFlags, []config.Workflow{{Name: "a", Consumer: &config.Consumer{DeadLetter: true}, Stream: &config.Stream{}}, {Name: "b"}}, queue.NATSAuth{})
+	assert.Equal(t, []string{"ingest.b"}, o.Subjects)
+	assert.Equal(t, []string{"ingest.a", "ingest.a.dead-letter"}, o.Streams[0].Subjects)
+}
+
 func toPtr[T any](t T) *T {
 	return &t
 }
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"golang.org/x/mod/semver"
+
+	"github.com/connylabs/ingest/plugin"
+	"github.com/connylabs/ingest/version"
+)
+
+const (
+	// pluginsCommand is the subcommand that manages the plugins in the plugin directories.
+	pluginsCommand = "plugins"
+
+	installTimeout = 10 * time.Minute
+
+	pluginsUsage = `usage: ingest plugins install oci://registry/repository[:tag|@digest]...
+       ingest plugins scaffold name module [directory]`
+)
+
+// runPluginsCommand installs plugins or generates the module of a new plugin.
+func runPluginsCommand(ctx context.Context, appFlags *flags, args []string, w io.Writer) error {
+	if len(args) < 2 {
+		return errors.New(pluginsUsage)
+	}
+	switch args[0] {
+	case "install":
+		return runPluginsInstall(ctx, appFlags, args[1:], w)
+	case "scaffold":
+		return runPluginsScaffold(args[1:], w)
+	}
+	return errors.New(pluginsUsage)
+}
+
+// runPluginsInstall installs plugins from OCI registries into the first of the plugin directories,
+// which takes precedence over the others.
+// The registry credentials are read from INGEST_REGISTRY_USERNAME and INGEST_REGISTRY_PASSWORD.
+func runPluginsInstall(ctx context.Context, appFlags *flags, refs []string, w io.Writer) error {
+	if len(*appFlags.pluginDirectories) == 0 {
+		return errors.New("no plugin directory is given with --plugins")
+	}
+	ctx, cancel := context.WithTimeout(ctx, installTimeout)
+	defer cancel()
+
+	in := &plugin.Installer{
+		Username: os.Getenv("INGEST_REGISTRY_USERNAME"),
+		Password: os.Getenv("INGEST_REGISTRY_PASSWORD"),
+	}
+	for _, ref := range refs {
+		p, err := in.Install(ctx, ref, (*appFlags.pluginDirectories)[0])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "installed plugin %q to %q\n", ref, p)
+	}
+	return nil
+}
+
+// runPluginsScaffold writes the Go module of a new plugin to the directory, which defaults to the name of the plugin.
+// Release builds of ingest make the module require their own version of ingest.
+func runPluginsScaffold(args []string, w io.Writer) error {
+	if len(args) < 2 || len(args) > 3 {
+		return errors.New(pluginsUsage)
+	}
+	s := &plugin.Scaffold{Name: args[0], Module: args[1]}
+	if semver.IsValid(version.Version) && semver.Prerelease(version.Version) == "" && semver.Build(version.Version) == "" {
+		s.Version = version.Version
+	}
+	dir := s.Name
+	if len(args) == 3 {
+		dir = args[2]
+	}
+	paths, err := s.Write(dir)
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		fmt.Fprintf(w, "created %q\n", p)
+	}
+	fmt.Fprintf(w, "run \"go mod tidy\" and \"make build\" in %q to build the plugin\n", dir)
+	return nil
+}
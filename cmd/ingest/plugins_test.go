@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunPluginsCommand(t *testing.T) {
+	appFlags := &flags{pluginDirectories: toPtr([]string{filepath.Join(t.TempDir(), "plugins")})}
+	var b bytes.Buffer
+	assert.EqualError(t, runPluginsCommand(context.Background(), appFlags, nil, &b), pluginsUsage)
+	assert.EqualError(t, runPluginsCommand(context.Background(), appFlags, []string{"install"}, &b), pluginsUsage)
+	assert.Error(t, runPluginsCommand(context.Background(), appFlags, []string{"install", "ghcr.io/connylabs/ingest-plugin-sftp"}, &b))
+	assert.Error(t, runPluginsCommand(context.Background(), &flags{pluginDirectories: toPtr([]string{})}, []string{"install", "oci://ghcr.io/connylabs/ingest-plugin-sftp"}, &b))
+	assert.Empty(t, b.String())
+}
+
+func TestRunPluginsScaffold(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "foo")
+	var b bytes.Buffer
+	assert.EqualError(t, runPluginsCommand(context.Background(), &flags{}, []string{"scaffold", "foo"}, &b), pluginsUsage)
+	require.NoError(t, runPluginsCommand(context.Background(), &flags{}, []string{"scaffold", "foo", "github.com/example/ingest-plugin-foo", dir}, &b))
+	assert.Contains(t, b.String(), fmt.Sprintf("created %q\n", filepath.Join(dir, "main.go")))
+	assert.FileExists(t, filepath.Join(dir, "go.mod"))
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/config"
+	"github.com/connylabs/ingest/queue"
+)
+
+const (
+	// queueCommand is the subcommand that administrates the NATS JetStream queue.
+	queueCommand = "queue"
+
+	defaultPeekCount = 10
+	queueTimeout     = 30 * time.Second
+
+	queueUsage = `usage: ingest queue info [workflow...]
+       ingest queue purge workflow...
+       ingest queue peek workflow [count]`
+)
+
+// queueTarget is a subject of a workflow and the durable consumer of the subject.
+type queueTarget struct {
+	workflow string
+	stream   string
+	subject  string
+	consumer string
+}
+
+// queueTargets returns the targets of the workflows with the given names or of all workflows if no names are given.
+func queueTargets(appFlags *flags, workflows []config.Workflow, names []string) ([]queueTarget, error) {
+	selected := make(map[string]bool, len(names))
+	for _, n := range names {
+		selected[n] = false
+	}
+	var ts []queueTarget
+	for _, w := range workflows {
+		if _, ok := selected[w.Name]; !ok && len(names) > 0 {
+			continue
+		}
+		selected[w.Name] = true
+		ts = append(ts, queueTarget{workflow: w.Name, stream: workflowStream(appFlags, w), subject: workflowSubject(appFlags, w), consumer: workflowConsumer(appFlags, w)})
+		if w.Priority != "" {
+			ts = append(ts, queueTarget{workflow: w.Name, stream: workflowStream(appFlags, w), subject: prioritySubject(appFlags, w), consumer: priorityConsumer(appFlags, w)})
+		}
+	}
+	for n, ok := range selected {
+		if !ok {
+			return nil, fmt.Errorf("unknown workflow %q", n)
+		}
+	}
+	return ts, nil
+}
+
+// runQueueCommand inspects and purges the subjects of workflows, so that operators do not need the NATS CLI.
+// Peeked messages are decrypted with the keyring if it is not nil.
+func runQueueCommand(ctx context.Context, appFlags *flags, workflows []config.Workflow, auth queue.NATSAuth, k *queue.Keyring, args []string, w io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(queueUsage)
+	}
+	ctx, cancel := context.WithTimeout(ctx, queueTimeout)
+	defer cancel()
+
+	var names []string
+	count := defaultPeekCount
+	switch args[0] {
+	case "info":
+		names = args[1:]
+	case "purge":
+		if len(args) < 2 {
+			return errors.New(queueUsage)
+		}
+		names = args[1:]
+	case "peek":
+		if len(args) < 2 || len(args) > 3 {
+			return errors.New(queueUsage)
+		}
+		names = args[1:2]
+		if len(args) == 3 {
+			var err error
+			if count, err = strconv.Atoi(args[2]); err != nil || count < 1 {
+				return fmt.Errorf("invalid count %q: must be a positive integer", args[2])
+			}
+		}
+	default:
+		return fmt.Errorf("unknown queue command %q\n%s", args[0], queueUsage)
+	}
+	ts, err := queueTargets(appFlags, workflows, names)
+	if err != nil {
+		return err
+	}
+
+	a, err := queue.NewAdmin(*appFlags.queueEndpoint, auth)
+	if err != nil {
+		return fmt.Errorf("failed to connect to queue: %w", err)
+	}
+	defer a.Close()
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	switch args[0] {
+	case "info":
+		err = queueInfo(ctx, a, ts, tw)
+	case "purge":
+		err = queuePurge(ctx, a, ts, tw)
+	case "peek":
+		err = queuePeek(ctx, a, k, ts[0], count, tw)
+	}
+	if err != nil {
+		return err
+	}
+	return tw.Flush()
+}
+
+func queueInfo(ctx context.Context, a *queue.Admin, ts []queueTarget, w io.Writer) error {
+	fmt.Fprintln(w, "WORKFLOW\tSTREAM\tMESSAGES\tBYTES\tSUBJECT\tCONSUMER\tPENDING\tACK PENDING\tREDELIVERED")
+	for _, t := range ts {
+		s, err := a.StreamState(ctx, t.stream)
+		if err != nil {
+			return err
+		}
+		c, err := a.ConsumerStats(ctx, t.stream, t.consumer)
+		if err != nil {
+			return err
+		}
+		pending, ackPending, redelivered := "-", "-", "-"
+		if c != nil {
+			pending, ackPending, redelivered = strconv.FormatUint(c.Pending, 10), strconv.Itoa(c.AckPending), strconv.Itoa(c.Redelivered)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%s\t%s\t%s\t%s\n", t.workflow, t.stream, s.Messages, s.Bytes, t.subject, t.consumer, pending, ackPending, redelivered)
+	}
+	return nil
+}
+
+func queuePurge(ctx context.Context, a *queue.Admin, ts []queueTarget, w io.Writer) error {
+	fmt.Fprintln(w, "WORKFLOW\tSTREAM\tSUBJECT\tPURGED")
+	for _, t := range ts {
+		n, err := a.Purge(ctx, t.stream, t.subject)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\n", t.workflow, t.stream, t.subject, n)
+	}
+	return nil
+}
+
+// queuePeek prints the messages that the consumer of the target did not yet acknowledge.
+func queuePeek(ctx context.Context, a *queue.Admin, k *queue.Keyring, t queueTarget, count int, w io.Writer) error {
+	var after uint64
+	c, err := a.ConsumerStats(ctx, t.stream, t.consumer)
+	if err != nil {
+		return err
+	}
+	if c != nil {
+		after = c.AckFloor
+	}
+	ms, err := a.Peek(ctx, t.stream, t.subject, after, count)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, "SEQUENCE\tID\tNAME\tSOURCE\tENQUEUED AT")
+	for _, m := range ms {
+		data := m.Data
+		if k != nil {
+			if data, err = k.Decrypt(m.Subject, m.Header, m.Data); err != nil {
+				fmt.Fprintf(w, "%d\tfailed to decrypt message: %v\n", m.Sequence, err)
+				continue
+			}
+		}
+		item := new(ingest.Codec)
+		if err := item.Unmarshal(data); err != nil {
+			fmt.Fprintf(w, "%d\tfailed to decode message: %v\n", m.Sequence, err)
+			continue
+		}
+		source, enqueuedAt := "-", "-"
+		if v, ok := m.Header[ingest.HeaderSource]; ok {
+			source = v
+		}
+		if v, ok := m.Header[ingest.HeaderEnqueuedAt]; ok {
+			enqueuedAt = v
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", m.Sequence, item.ID, item.Name, source, enqueuedAt)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/config"
+	"github.com/connylabs/ingest/queue"
+)
+
+func TestRunQueueCommand(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	e, err := queue.StartEmbedded("nats://127.0.0.1:0", t.TempDir(), queue.NATSAuth{}, nil)
+	require.NoError(t, err)
+	t.Cleanup(e.Shutdown)
+
+	appFlags := &flags{
+		queueEndpoint:     toPtr(e.ClientURL()),
+		stream:            toPtr("ingest"),
+		subject:           toPtr("ingest"),
+		consumer:          toPtr("ingest"),
+		replicas:          toPtr(1),
+		maxMsgs:           toPtr(int64(0)),
+		dedupWindow:       toPtr(time.Duration(0)),
+		publishRetries:    toPtr(0),
+		publishRetryWait:  toPtr(time.Duration(0)),
+		publishBufferSize: toPtr(0),
+		maxAge:            toPtr(time.Duration(0)),
+		maxBytes:          toPtr(int64(0)),
+		retention:         toPtr("limits"),
+		discard:           toPtr("old"),
+	}
+	workflows := []config.Workflow{{Name: "a", Source: "s3"}, {Name: "b", Priority: "^urgent/"}}
+	q, err := queue.New(e.ClientURL(), queueOptions(appFlags, workflows, queue.NATSAuth{}), prometheus.NewRegistry())
+	require.NoError(t, err)
+	t.Cleanup(func() { q.Close(ctx) }) //nolint:errcheck
+	for _, id := range []string{"1", "2"} {
+		c := ingest.NewCodec(id, "foo/"+id, nil)
+		data, err := c.Marshal()
+		require.NoError(t, err)
+		require.NoError(t, q.Publish("ingest.a", data, ingest.Header{ingest.HeaderSource: "s3"}))
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, runQueueCommand(ctx, appFlags, workflows, queue.NATSAuth{}, nil, []string{"info"}, &out))
+	assert.Contains(t, out.String(), "ingest.b.priority")
+	assert.Regexp(t, `a\s+ingest\s+2\s+\d+\s+ingest.a\s+ingest__a\s+-`, out.String())
+
+	out.Reset()
+	require.NoError(t, runQueueCommand(ctx, appFlags, workflows, queue.NATSAuth{}, nil, []string{"peek", "a", "1"}, &out))
+	assert.Regexp(t, `1\s+1\s+foo/1\s+s3`, out.String())
+	assert.NotContains(t, out.String(), "foo/2")
+
+	out.Reset()
+	require.NoError(t, runQueueCommand(ctx, appFlags, workflows, queue.NATSAuth{}, nil, []string{"purge", "a"}, &out))
+	assert.Regexp(t, `a\s+ingest\s+ingest.a\s+2`, out.String())
+
+	for _, args := range [][]string{nil, {"unknown"}, {"purge"}, {"peek", "a", "0"}, {"info", "c"}} {
+		assert.Error(t, runQueueCommand(ctx, appFlags, workflows, queue.NATSAuth{}, nil, args, &out), "%v", args)
+	}
+}
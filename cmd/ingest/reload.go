@@ -0,0 +1,361 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/oklog/run"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/config"
+	"github.com/connylabs/ingest/dequeue"
+	"github.com/connylabs/ingest/history"
+	"github.com/connylabs/ingest/plugin"
+	"github.com/connylabs/ingest/queue"
+	"github.com/connylabs/ingest/state"
+)
+
+// reloadDelay is the duration for which to wait for further changes of the configuration file
+// before it is reloaded, because editors and Kubernetes replace files in several steps.
+const reloadDelay = time.Second
+
+// reloadFetchTimeout is the maximum duration of fetching a remote configuration to check it for changes.
+const reloadFetchTimeout = 30 * time.Second
+
+// supervisor runs the workflows of a configuration and applies changes of the configuration
+// without restarting the process: it starts new workflows, stops removed ones and restarts
+// the workflows whose configuration, source or destinations changed.
+type supervisor struct {
+	q        ingest.Queue
+	hs       history.Store
+	ss       state.Store
+	appFlags *flags
+	l        log.Logger
+	// errs receives the errors of workflows that exited unexpectedly.
+	errs chan error
+	// ready is closed once the workflows of the initial configuration were started.
+	ready chan struct{}
+	// limiter limits the transfers of all workflows if the configuration sets max transfers.
+	limiter *dequeue.Limiter
+	// pm manages the plugins of the workflows, whose metrics are collected with the metrics of the workflows.
+	// It may be nil.
+	pm *plugin.PluginManager
+
+	mu           sync.Mutex
+	ctx          context.Context
+	c            *config.Config
+	sources      map[string]plugin.Source
+	destinations map[string]plugin.Destination
+	workflows    map[string]*workflowRun
+}
+
+// workflowRun is a running workflow.
+type workflowRun struct {
+	w config.Workflow
+	// reg holds the metrics of the workflow, so that they can be registered again when it is restarted.
+	reg  *prometheus.Registry
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+// run starts the workflows of the initial configuration and stops all workflows when ctx is done.
+// It returns when a workflow exits, e.g. an enqueuer without an interval.
+func (s *supervisor) run(ctx context.Context) error {
+	s.mu.Lock()
+	s.ctx = ctx
+	err := func() error {
+		defer close(s.ready)
+		for _, w := range s.c.Workflows {
+			if err := s.start(w); err != nil {
+				return err
+			}
+		}
+		return nil
+	}()
+	s.mu.Unlock()
+
+	if err == nil {
+		select {
+		case <-ctx.Done():
+		case err = <-s.errs:
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for n := range s.workflows {
+		s.stop(n)
+	}
+	return err
+}
+
+// start starts the workflow. It must be called with the lock held.
+func (s *supervisor) start(w config.Workflow) error {
+	reg := prometheus.NewRegistry()
+	// ctx is done when the workflow is stopped and
+	// runCtx is done when the workflow is stopped or one of its runners exits.
+	ctx, stop := context.WithCancel(s.ctx)
+	runCtx, cancel := context.WithCancel(ctx)
+	var g run.Group
+	if err := addWorkflow(runCtx, &g, s.q, s.hs, s.ss, s.appFlags, s.sources, s.destinations, w, s.c.Workflows, s.limiter, s.l, reg); err != nil {
+		cancel()
+		stop()
+		return err
+	}
+	if s.pm != nil {
+		if err := prometheus.WrapRegistererWith(prometheus.Labels{"workflow": w.Name}, reg).Register(s.pm.Collector(s.plugins(w)...)); err != nil {
+			cancel()
+			stop()
+			return fmt.Errorf("failed to register plugin collector: %w", err)
+		}
+	}
+	g.Add(func() error {
+		<-runCtx.Done()
+		return nil
+	}, func(error) {
+		cancel()
+	})
+
+	wr := &workflowRun{w: w, reg: reg, stop: stop, done: make(chan struct{})}
+	s.workflows[w.Name] = wr
+	go func() {
+		defer close(wr.done)
+		err := g.Run()
+		cancel()
+		if ctx.Err() != nil {
+			// The workflow was stopped.
+			return
+		}
+		if err != nil {
+			err = fmt.Errorf("workflow %q: %w", w.Name, err)
+		}
+		select {
+		case s.errs <- err:
+		case <-ctx.Done():
+		}
+	}()
+	return nil
+}
+
+// stop stops the workflow and waits until its runners exited. It must be called with the lock held.
+func (s *supervisor) stop(name string) {
+	wr := s.workflows[name]
+	wr.stop()
+	<-wr.done
+	delete(s.workflows, name)
+}
+
+// reload applies the configuration. Plugins whose configuration did not change are reused.
+// If the configuration cannot be applied, then the previous configuration keeps running.
+func (s *supervisor) reload(pm *plugin.PluginManager, c *config.Config) error {
+	select {
+	case <-s.ready:
+	default:
+		return errors.New("the workflows were not started yet")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ctx.Err() != nil {
+		return s.ctx.Err()
+	}
+
+	v, err := c.PluginVerifier()
+	if err != nil {
+		return err
+	}
+	limits, err := c.PluginLimits()
+	if err != nil {
+		return err
+	}
+	// The plugins of the previous configuration that are reused were verified and limited when they were started.
+	prev, prevLimits := pm.SetVerification(v, limits)
+	sources, destinations, err := c.Reconfigure(pm, *s.appFlags.pluginDirectories, *s.appFlags.strictWorkflows, s.c, s.sources, s.destinations)
+	if err != nil {
+		pm.SetVerification(prev, prevLimits)
+		return err
+	}
+	if !reflect.DeepEqual(queueOptions(s.appFlags, s.c.Workflows, queue.NATSAuth{}), queueOptions(s.appFlags, c.Workflows, queue.NATSAuth{})) {
+		level.Warn(s.l).Log("msg", "changes of the streams, subjects and consumers of workflows are only applied to the queue after a restart")
+	}
+	if !reflect.DeepEqual(s.c.Encryption, c.Encryption) {
+		level.Warn(s.l).Log("msg", "changes of the encryption are only applied after a restart")
+	}
+	if s.c.MaxTransfers != c.MaxTransfers {
+		level.Warn(s.l).Log("msg", "changes of the max transfers are only applied after a restart")
+	}
+
+	workflows := make(map[string]config.Workflow, len(c.Workflows))
+	for _, w := range c.Workflows {
+		workflows[w.Name] = w
+	}
+	var stopped, started []string
+	for _, n := range sortedKeys(s.workflows) {
+		w, ok := workflows[n]
+		if ok && !s.changed(s.workflows[n].w, w, sources, destinations) {
+			delete(workflows, n)
+			continue
+		}
+		s.stop(n)
+		stopped = append(stopped, n)
+	}
+	config.Release(pm, s.sources, sources, s.destinations, destinations)
+	s.c, s.sources, s.destinations = c, sources, destinations
+
+	var errs []error
+	for _, n := range sortedKeys(workflows) {
+		if err := s.start(workflows[n]); err != nil {
+			errs = append(errs, fmt.Errorf("failed to start workflow %q: %w", n, err))
+			continue
+		}
+		started = append(started, n)
+	}
+	level.Info(s.l).Log("msg", "reloaded configuration", "stopped", fmt.Sprint(stopped), "started", fmt.Sprint(started))
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to apply configuration: %v", errs)
+	}
+	return nil
+}
+
+// changed returns true if the workflow must be restarted to apply the new configuration.
+func (s *supervisor) changed(old, w config.Workflow, sources map[string]plugin.Source, destinations map[string]plugin.Destination) bool {
+	if !reflect.DeepEqual(old, w) || s.sources[w.Source] != sources[w.Source] {
+		return true
+	}
+	for _, d := range w.Destinations {
+		if s.destinations[d] != destinations[d] {
+			return true
+		}
+	}
+	return false
+}
+
+// plugins returns the plugins of the source and destinations of the workflow as they were returned by the plugin manager.
+// It must be called with the lock held.
+func (s *supervisor) plugins(w config.Workflow) []any {
+	var ps []any
+	if st, ok := s.sources[w.Source].(*config.SourceTyper); ok {
+		ps = append(ps, st.Plugin())
+	}
+	for _, d := range w.Destinations {
+		if dt, ok := s.destinations[d].(*config.DestinationTyper); ok {
+			ps = append(ps, dt.Plugin())
+		}
+	}
+	return ps
+}
+
+// Gather implements the prometheus.Gatherer interface for the metrics of the running workflows.
+func (s *supervisor) Gather() ([]*dto.MetricFamily, error) {
+	s.mu.Lock()
+	gs := make(prometheus.Gatherers, 0, len(s.workflows))
+	for _, wr := range s.workflows {
+		gs = append(gs, wr.reg)
+	}
+	s.mu.Unlock()
+	return gs.Gather()
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// watchConfig calls reload when the process receives SIGHUP
+// and, if watch is true, when the configuration file at path or a file in the configuration directory at path changes.
+// Included files outside of the configuration directory are not watched.
+// If path is a URL, then the remote configuration is fetched every refresh interval instead
+// and reload is called when its content changed.
+func watchConfig(ctx context.Context, path string, watch bool, refresh time.Duration, reload func(), l log.Logger) error {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var events chan fsnotify.Event
+	var errs chan error
+	var poll <-chan time.Time
+	var sum [sha256.Size]byte
+	// Watch the directory, because editors and Kubernetes replace the file instead of writing it.
+	dir, isDir := filepath.Dir(path), false
+	if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+		dir, isDir = path, true
+	}
+	switch {
+	case watch && config.IsURL(path) && refresh > 0:
+		if buf, err := fetchConfig(ctx, path); err == nil {
+			sum = sha256.Sum256(buf)
+		}
+		t := time.NewTicker(refresh)
+		defer t.Stop()
+		poll = t.C
+	case watch && !config.IsURL(path):
+		w, err := fsnotify.NewWatcher()
+		if err != nil {
+			return fmt.Errorf("failed to watch configuration file: %w", err)
+		}
+		defer w.Close()
+		if err := w.Add(dir); err != nil {
+			return fmt.Errorf("failed to watch configuration file: %w", err)
+		}
+		events, errs = w.Events, w.Errors
+	}
+
+	t := time.NewTimer(reloadDelay)
+	t.Stop()
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-hup:
+			level.Info(l).Log("msg", "received SIGHUP, reloading configuration")
+			reload()
+		case e := <-events:
+			// Kubernetes swaps the ..data symlink of mounted ConfigMaps.
+			if isDir || filepath.Clean(e.Name) == filepath.Clean(path) || filepath.Base(e.Name) == "..data" {
+				t.Reset(reloadDelay)
+			}
+		case err := <-errs:
+			level.Warn(l).Log("msg", "failed to watch configuration file", "err", err.Error())
+		case <-t.C:
+			level.Info(l).Log("msg", "configuration file changed, reloading configuration")
+			reload()
+		case <-poll:
+			buf, err := fetchConfig(ctx, path)
+			if err != nil {
+				level.Warn(l).Log("msg", "failed to fetch configuration", "err", err.Error())
+				continue
+			}
+			if s := sha256.Sum256(buf); s != sum {
+				sum = s
+				level.Info(l).Log("msg", "remote configuration changed, reloading configuration")
+				reload()
+			}
+		}
+	}
+}
+
+// fetchConfig fetches the remote configuration at the URL.
+func fetchConfig(ctx context.Context, rawURL string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, reloadFetchTimeout)
+	defer cancel()
+	return config.Fetch(ctx, rawURL)
+}
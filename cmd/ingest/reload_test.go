@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/oklog/run"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/connylabs/ingest/config"
+	"github.com/connylabs/ingest/plugin"
+	"github.com/connylabs/ingest/queue"
+)
+
+const reloadConfig = `plugins:
+  allowUnverified: true
+sources:
+- name: foo
+  type: noop
+- name: bar
+  type: noop
+destinations:
+- name: baz
+  type: noop
+workflows:
+- name: foo-baz
+  source: foo
+  destinations:
+  - baz
+  interval: 1s
+- name: bar-baz
+  source: bar
+  destinations:
+  - baz
+  interval: 1s
+`
+
+func TestSupervisor(t *testing.T) {
+	appFlags := &flags{
+		mode:              toPtr(allMode),
+		stream:            toPtr("ingest"),
+		subject:           toPtr("ingest"),
+		consumer:          toPtr("ingest"),
+		pluginDirectories: toPtr([]string{fmt.Sprintf("../../bin/plugin/%s/%s", runtime.GOOS, runtime.GOARCH)}),
+		strictWorkflows:   toPtr(true),
+		replicas:          toPtr(1),
+		maxMsgs:           toPtr(int64(0)),
+		dedupWindow:       toPtr(time.Duration(0)),
+		publishRetries:    toPtr(0),
+		publishRetryWait:  toPtr(time.Duration(0)),
+		publishBufferSize: toPtr(0),
+		maxAge:            toPtr(time.Duration(0)),
+		maxBytes:          toPtr(int64(0)),
+		retention:         toPtr("interest"),
+		discard:           toPtr("old"),
+	}
+	reg := prometheus.NewRegistry()
+	c, err := config.New([]byte(reloadConfig), reg)
+	require.NoError(t, err)
+	pm := plugin.NewPluginManager(0, nil)
+	t.Cleanup(pm.Stop)
+	sources, destinations, err := c.ConfigurePlugins(pm, *appFlags.pluginDirectories, true)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var g run.Group
+	s, err := runGroup(ctx, &g, queue.NewMemory(0, prometheus.NewRegistry()), nil, nil, appFlags, c, nil, sources, destinations, log.NewNopLogger())
+	require.NoError(t, err)
+	done := make(chan error)
+	go func() {
+		done <- g.Run()
+	}()
+	<-s.ready
+
+	running := func() map[string]*workflowRun {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		ws := make(map[string]*workflowRun, len(s.workflows))
+		for n, wr := range s.workflows {
+			ws[n] = wr
+		}
+		return ws
+	}
+	before := running()
+	require.Len(t, before, 2)
+
+	// Remove bar-baz, add foo-qux and change the source of foo-baz.
+	c, err = config.New([]byte(`plugins:
+  allowUnverified: true
+sources:
+- name: foo
+  type: noop
+  changed: true
+destinations:
+- name: baz
+  type: noop
+- name: qux
+  type: noop
+workflows:
+- name: foo-baz
+  source: foo
+  destinations:
+  - baz
+  interval: 1s
+- name: foo-qux
+  source: foo
+  destinations:
+  - qux
+  interval: 1s
+`), reg)
+	require.NoError(t, err)
+	require.NoError(t, s.reload(pm, c))
+	after := running()
+	assert.Equal(t, []string{"foo-baz", "foo-qux"}, sortedKeys(after))
+	assert.NotSame(t, before["foo-baz"], after["foo-baz"])
+
+	// A configuration that cannot be applied keeps the previous configuration running.
+	c, err = config.New([]byte(`workflows:
+- name: foo-baz
+  source: missing
+`), reg)
+	require.NoError(t, err)
+	assert.Error(t, s.reload(pm, c))
+	assert.Equal(t, after, running())
+
+	// Unchanged workflows keep running.
+	c, err = config.New([]byte(reloadConfig), reg)
+	require.NoError(t, err)
+	require.NoError(t, s.reload(pm, c))
+	final := running()
+	assert.Equal(t, []string{"bar-baz", "foo-baz"}, sortedKeys(final))
+	assert.NotSame(t, after["foo-baz"], final["foo-baz"])
+	c, err = config.New([]byte(reloadConfig), reg)
+	require.NoError(t, err)
+	require.NoError(t, s.reload(pm, c))
+	assert.Equal(t, final, running())
+
+	// The metrics of restarted workflows are registered again.
+	_, err = s.Gather()
+	assert.NoError(t, err)
+
+	cancel()
+	assert.NoError(t, <-done)
+	assert.Empty(t, running())
+}
+
+func TestWatchConfig(t *testing.T) {
+	dir := t.TempDir()
+	for name, path := range map[string]string{
+		"file":      filepath.Join(dir, "config"),
+		"directory": dir,
+	} {
+		t.Run(name, func(t *testing.T) {
+			file := path
+			if name == "directory" {
+				file = filepath.Join(dir, "workflows.yaml")
+			}
+			require.NoError(t, os.WriteFile(file, []byte(reloadConfig), 0o600))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			reloads := make(chan struct{}, 10)
+			done := make(chan error)
+			go func() {
+				done <- watchConfig(ctx, path, true, time.Minute, func() { reloads <- struct{}{} }, log.NewNopLogger())
+			}()
+
+			// Replace the file like editors do a few times,
+			// so that the watcher picks it up even if it was not started yet.
+			tick := time.NewTicker(100 * time.Millisecond)
+			defer tick.Stop()
+			timeout := time.After(10 * time.Second)
+		loop:
+			for writes := 0; ; {
+				select {
+				case <-reloads:
+					break loop
+				case <-tick.C:
+					if writes < 3 {
+						require.NoError(t, os.WriteFile(file+".tmp", []byte(reloadConfig), 0o600))
+						require.NoError(t, os.Rename(file+".tmp", file))
+						writes++
+					}
+				case <-timeout:
+					t.Fatal("the configuration was not reloaded")
+				}
+			}
+
+			cancel()
+			assert.NoError(t, <-done)
+		})
+	}
+}
+
+func TestWatchConfigURL(t *testing.T) {
+	var mu sync.Mutex
+	content := reloadConfig
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprint(w, content)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reloads := make(chan struct{}, 10)
+	done := make(chan error)
+	go func() {
+		done <- watchConfig(ctx, srv.URL, true, 10*time.Millisecond, func() { reloads <- struct{}{} }, log.NewNopLogger())
+	}()
+
+	// The configuration is not reloaded while it does not change.
+	select {
+	case <-reloads:
+		t.Fatal("the configuration was reloaded although it did not change")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	mu.Lock()
+	content += "# changed\n"
+	mu.Unlock()
+	select {
+	case <-reloads:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the configuration was not reloaded")
+	}
+
+	cancel()
+	assert.NoError(t, <-done)
+	assert.Empty(t, reloads)
+}
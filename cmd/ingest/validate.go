@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/go-kit/log"
+
+	"github.com/connylabs/ingest/config"
+	"github.com/connylabs/ingest/plugin"
+	"github.com/connylabs/ingest/secret"
+)
+
+const (
+	// validateCommand is the subcommand that validates the configuration, e.g. in CI before it is deployed.
+	validateCommand = "validate"
+
+	validateUsage = `usage: ingest validate
+       ingest validate schema`
+)
+
+// runValidateCommand validates the configuration file with the plugins
+// or prints the JSON schema of the configuration format.
+func runValidateCommand(appFlags *flags, args []string, w io.Writer, logger log.Logger) error {
+	switch {
+	case len(args) == 0:
+	case len(args) == 1 && args[0] == "schema":
+		_, err := w.Write(config.Schema())
+		return err
+	default:
+		return errors.New(validateUsage)
+	}
+
+	pm := plugin.NewPluginManager(0, logger)
+	pm.Secrets = secret.NewResolver()
+	pm.Cgroup = *appFlags.pluginCgroup
+	defer pm.Stop()
+	if err := config.Validate(*appFlags.configPath, pm, *appFlags.pluginDirectories); err != nil {
+		return fmt.Errorf("configuration %q is invalid: %w", *appFlags.configPath, err)
+	}
+	fmt.Fprintf(w, "configuration %q is valid\n", *appFlags.configPath)
+	return nil
+}
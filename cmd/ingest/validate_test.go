@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunValidateCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	appFlags := &flags{
+		configPath:        toPtr(path),
+		pluginDirectories: toPtr([]string{fmt.Sprintf("../../bin/plugin/%s/%s", runtime.GOOS, runtime.GOARCH)}),
+		pluginCgroup:      toPtr(""),
+	}
+
+	var b bytes.Buffer
+	require.NoError(t, runValidateCommand(appFlags, []string{"schema"}, &b, log.NewNopLogger()))
+	assert.True(t, json.Valid(b.Bytes()))
+	assert.Error(t, runValidateCommand(appFlags, []string{"foo"}, &b, log.NewNopLogger()))
+	assert.Error(t, runValidateCommand(appFlags, nil, &b, log.NewNopLogger()), "the configuration file does not exist")
+
+	require.NoError(t, os.WriteFile(path, []byte(reloadConfig), 0o600))
+	b.Reset()
+	require.NoError(t, runValidateCommand(appFlags, nil, &b, log.NewNopLogger()))
+	assert.Contains(t, b.String(), "is valid")
+
+	require.NoError(t, os.WriteFile(path, append([]byte(reloadConfig), "  unknown: true\n"...), 0o600))
+	assert.Error(t, runValidateCommand(appFlags, nil, &b, log.NewNopLogger()))
+}
@@ -1,6 +1,9 @@
 package ingest
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"time"
+)
 
 // Codec implements the Identifiable and Codec interfaces
 // and is used as the default marshaler/unmarshaler for Identifiables.
@@ -13,6 +16,18 @@ type Codec struct {
 	Name string `json:"name"`
 	// Meta can optionally store additional data that can be consumed by the dequeuer.
 	Meta []byte `json:"meta"`
+	// Size is the size of the resource in bytes, if the source reports it.
+	Size int64 `json:"size,omitempty"`
+	// MimeType is the HTTP-style Content-Type of the resource, if the source reports it.
+	MimeType string `json:"mimeType,omitempty"`
+	// LastModified is the time at which the resource was last modified, if the source reports it.
+	LastModified *time.Time `json:"lastModified,omitempty"`
+	// Hash is an opaque digest of the content of the resource, if the source reports it, e.g. the ETag of an S3 object.
+	// Hashes are only compared for equality, so destinations can skip objects that they stored with the same hash.
+	Hash string `json:"hash,omitempty"`
+	// Tags are source-specific key-value pairs that describe the resource, e.g. the labels of a mail.
+	// Destinations that support it store them with the object, e.g. as the tags of an S3 object.
+	Tags map[string]string `json:"tags,omitempty"`
 }
 
 // Marshal serializes the Identifiable so it can be sent on the queue.
@@ -8,6 +8,8 @@ import (
 
 func TestCodecMarshalling(t *testing.T) {
 	c := NewCodec("id", "name", []byte(`{"meta":"value"}`))
+	c.Hash = "d41d8cd98f00b204e9800998ecf8427e"
+	c.Tags = map[string]string{"team": "a"}
 
 	d, err := c.Marshal()
 	assert.NoError(t, err)
@@ -1,81 +1,218 @@
 package config
 
 import (
-	"encoding/json"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
 	"syscall"
 	"time"
 
-	"github.com/ghodss/yaml"
-	"github.com/mitchellh/mapstructure"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 
 	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/archive"
+	"github.com/connylabs/ingest/cron"
+	"github.com/connylabs/ingest/dequeue"
+	"github.com/connylabs/ingest/enqueue"
 	"github.com/connylabs/ingest/plugin"
+	"github.com/connylabs/ingest/queue"
 )
 
 var defaultInterval = Duration(5 * time.Minute)
 
 // NewFromPath creates a new Config from the given file path.
+// If the path is a directory, then the YAML files in it are merged in lexical order.
 func NewFromPath(path string, r prometheus.Registerer) (*Config, error) {
-	f, err := os.ReadFile(path)
+	return newFromPath(path, false, r)
+}
+
+// NewFromPathStrict creates a new Config like NewFromPath but rejects unknown fields
+// and fields whose case differs from the documented name, e.g. batchsize instead of batchSize.
+// The fields of v1 configurations that are passed to plugins are not checked.
+func NewFromPathStrict(path string, r prometheus.Registerer) (*Config, error) {
+	return newFromPath(path, true, r)
+}
+
+func newFromPath(path string, strict bool, r prometheus.Registerer) (*Config, error) {
+	c, err := newLoader(strict).loadPath(path)
 	if err != nil {
-		return nil, fmt.Errorf("cannot read tenant configuration file from path %q: %w", path, err)
+		return nil, err
 	}
-	return New(f, r)
+	c.applyDefaults()
+	if err := c.applyCredentials(); err != nil {
+		return nil, err
+	}
+	if err := c.register(r); err != nil {
+		return nil, err
+	}
+	return c, nil
 }
 
 // New creates a new Config from the given file content.
+// Relative paths of included files are relative to the working directory.
 func New(buf []byte, r prometheus.Registerer) (*Config, error) {
-	c := new(Config)
-
-	buf = []byte(os.ExpandEnv(string(buf)))
-
-	if err := yaml.Unmarshal(buf, c); err != nil {
-		return nil, fmt.Errorf("unable to read configuration YAML: %w", err)
+	c, err := newLoader(false).load(buf, ".")
+	if err != nil {
+		return nil, err
+	}
+	c.applyDefaults()
+	if err := c.applyCredentials(); err != nil {
+		return nil, err
+	}
+	if err := c.register(r); err != nil {
+		return nil, err
 	}
-	c.workflowInstantiationFailuresTotal = promauto.With(r).NewCounter(prometheus.CounterOpts{
+	return c, nil
+}
+
+// register creates the metrics of the configuration and registers them with r.
+func (c *Config) register(r prometheus.Registerer) error {
+	c.workflowInstantiationFailuresTotal = prometheus.NewCounter(prometheus.CounterOpts{
 		Name: "ingest_workflow_instantiation_failures_total",
 		Help: "Number of failures while instantiating workflows.",
 	})
-
-	return c, nil
+	if r != nil {
+		if err := r.Register(c.workflowInstantiationFailuresTotal); err != nil {
+			are := prometheus.AlreadyRegisteredError{}
+			if !errors.As(err, &are) {
+				return err
+			}
+			// The configuration was reloaded, so keep counting with the registered counter.
+			c.workflowInstantiationFailuresTotal = are.ExistingCollector.(prometheus.Counter)
+		}
+	}
+	return nil
 }
 
 // Source is used to configure source plugins in the ingest configuration.
 type Source struct {
-	Name   string
-	Type   string
-	Config map[string]interface{} `json:"-" mapstructure:",remain"`
+	Name string
+	Type string
+	// ExplodeArchives expands tar and zip archives, so that
+	// the files they contain are ingested as individual objects.
+	ExplodeArchives bool
+	// Credentials names the credentials whose configuration is added to the configuration of the plugin.
+	Credentials string
+	// Timeouts limit the calls to the plugin.
+	Timeouts *SourceTimeouts
+	// MaxInstances is the maximum number of processes of the plugin, which download objects in turn.
+	// The number of processes is also limited by the largest concurrency of the workflows of the source.
+	// It defaults to one process.
+	MaxInstances int
+	// Config is passed to the plugin.
+	Config map[string]interface{}
+}
+
+// Destination is used to configure destination plugins in the ingest configuration.
+type Destination struct {
+	Name string
+	Type string
+	// Archive batches objects into tar.gz archives before they are stored.
+	Archive *Archive
+	// Dedup stores the content of objects only once under its digest.
+	Dedup *Dedup
+	// Credentials names the credentials whose configuration is added to the configuration of the plugin.
+	Credentials string
+	// Timeouts limit the calls to the plugin.
+	Timeouts *DestinationTimeouts
+	// MaxInstances is the maximum number of processes of the plugin, which store objects in turn.
+	// The number of processes is also limited by the largest concurrency of the workflows of the destination.
+	// It defaults to one process.
+	MaxInstances int
+	// Config is passed to the plugin.
+	Config map[string]interface{}
 }
 
-// UnmarshalJSON allows the source configuration to collect all unknown fields into the `Config` field.
-func (s *Source) UnmarshalJSON(b []byte) error {
-	raw := make(map[string]interface{})
-	if err := json.Unmarshal(b, &raw); err != nil {
-		return err
+// SourceTimeouts is used to configure the timeouts of the calls to a source plugin.
+// A value of 0 means that the default of the plugin manager is used.
+type SourceTimeouts struct {
+	Configure Duration
+	Next      Duration
+	// Download includes reading the content of the object.
+	Download Duration
+}
+
+func (t *SourceTimeouts) timeouts() (plugin.Timeouts, error) {
+	if t == nil {
+		return plugin.Timeouts{}, nil
 	}
-	return mapstructure.Decode(raw, s)
+	if t.Configure < 0 || t.Next < 0 || t.Download < 0 {
+		return plugin.Timeouts{}, errors.New("timeouts must not be negative")
+	}
+	return plugin.Timeouts{Configure: time.Duration(t.Configure), Next: time.Duration(t.Next), Download: time.Duration(t.Download)}, nil
 }
 
-// Destination is used to configure destination plugins in the ingest configuration.
-type Destination struct {
-	Name   string
-	Type   string
-	Config map[string]interface{} `json:"-" mapstructure:",remain"`
+// DestinationTimeouts is used to configure the timeouts of the calls to a destination plugin.
+// A value of 0 means that the default of the plugin manager is used.
+type DestinationTimeouts struct {
+	Configure Duration
+	// Store includes reading the content of the object.
+	Store Duration
+}
+
+func (t *DestinationTimeouts) timeouts() (plugin.Timeouts, error) {
+	if t == nil {
+		return plugin.Timeouts{}, nil
+	}
+	if t.Configure < 0 || t.Store < 0 {
+		return plugin.Timeouts{}, errors.New("timeouts must not be negative")
+	}
+	return plugin.Timeouts{Configure: time.Duration(t.Configure), Store: time.Duration(t.Store)}, nil
+}
+
+// Credentials is used to share fields of the plugin configurations, e.g. the access keys of an S3 account,
+// between the sources and destinations that reference the credentials by name.
+type Credentials struct {
+	Name string
+	// Config is added to the configurations of the plugins.
+	Config map[string]interface{}
+}
+
+// Dedup is used to configure content-addressable storage of objects.
+type Dedup struct {
+	// BlobPrefix defaults to blobs/sha256/.
+	BlobPrefix    string
+	PointerPrefix string
+}
+
+// Archive is used to configure the batching of objects into archives.
+type Archive struct {
+	// Directory is the directory in which objects are spooled until their archive is stored.
+	// It must not be shared with other destinations or processes and
+	// defaults to ~/.local/share/ingest/archive/<destination>.
+	Directory string
+	Prefix    string
+	// Interval is the maximum time that an object waits for its archive to be stored, e.g. 1m.
+	Interval   *Duration
+	MaxObjects int
+	MaxBytes   int64
 }
 
-// UnmarshalJSON allows the destination configuration to collect all unknown fields into the `Config` field.
-func (d *Destination) UnmarshalJSON(b []byte) error {
-	raw := make(map[string]interface{})
-	if err := json.Unmarshal(b, &raw); err != nil {
-		return err
+// options returns the options of the archive of the destination with the given name.
+func (a *Archive) options(name string) (archive.DestinationOptions, error) {
+	o := archive.DestinationOptions{
+		Directory:  a.Directory,
+		Prefix:     a.Prefix,
+		MaxObjects: a.MaxObjects,
+		MaxBytes:   a.MaxBytes,
+	}
+	if a.Interval != nil {
+		o.Interval = time.Duration(*a.Interval)
 	}
-	return mapstructure.Decode(raw, d)
+	if o.Directory == "" {
+		hd, err := os.UserHomeDir()
+		if err != nil {
+			return o, fmt.Errorf("failed to find home directory for the spool directory of the archive: %w", err)
+		}
+		o.Directory = filepath.Join(hd, ".local/share/ingest/archive", name)
+	}
+	return o, nil
 }
 
 // Workflow is used to configure ingestion pipelines between sources and destinations in the ingest configuration.
@@ -83,33 +220,524 @@ type Workflow struct {
 	Name         string
 	Source       string
 	Destinations []string
-	CleanUp      bool
+	CleanUp      *bool
 	Interval     *Duration
-	Concurrency  int
-	BatchSize    int
-	Webhook      string
+	// Schedule is a cron expression that controls when the source is listed, e.g. 0 2 * * * for every night at 2:00 UTC,
+	// instead of every Interval. It may be prefixed with a time zone, e.g. CRON_TZ=Europe/Berlin 0 2 * * *.
+	Schedule    string
+	Concurrency int
+	// MaxConcurrency enables the autoscaling of the concurrency of the dequeuer
+	// between Concurrency and MaxConcurrency based on the backlog of the workflow.
+	MaxConcurrency int
+	BatchSize      int
+	Webhook        string
+	// PathTemplate is a Go template that produces the name under which elements are stored,
+	// e.g. {{ .Date }}/{{ .Source }}/{{ .Name }}. It defaults to the name given by the source.
+	PathTemplate string
+	// Subject overrides the subject of the messages of the workflow,
+	// which defaults to the subject given by the flags followed by the name of the workflow.
+	Subject string
+	// Stream isolates the messages of the workflow in its own stream.
+	Stream *Stream
+	// Priority is a regular expression. Elements whose names match it
+	// are published to a priority subject that is drained first.
+	Priority string
+	// Consumer configures when messages of the workflow are delivered again,
+	// e.g. to avoid redelivering elements whose download takes long.
+	Consumer *Consumer
+	// Retry configures how often the dequeuer retries the transfer of an element
+	// before the message of the element fails, e.g. because of transient errors of S3.
+	Retry *Retry
+	// Filters selects the elements of the source that are enqueued.
+	Filters *Filters
+	// DependsOn names workflows whose queues must be drained before the source of the workflow is listed,
+	// e.g. so that a transform workflow only starts once the upstream workflow stored all elements.
+	DependsOn []string
+}
+
+// Filters is used to configure the elements of the source that a workflow enqueues.
+// An element is enqueued if it matches all of the configured filters.
+type Filters struct {
+	// Names are glob patterns, e.g. *.csv, of which one must match the name or the base name of the element.
+	Names []string
+	// Pattern is a regular expression that must match the name of the element.
+	Pattern string
+	// MinSize and MaxSize bound the size of the element in bytes.
+	MinSize int64
+	MaxSize int64
+	// MimeTypes are MIME types, e.g. text/csv or image/*, of which the element must have one.
+	MimeTypes []string
+	// ModifiedAfter is either a time in RFC 3339 format, e.g. 2023-01-01T00:00:00Z,
+	// or a duration, e.g. 24h, that is subtracted from the time of every listing.
+	ModifiedAfter string
+}
+
+var (
+	// sizeSources are the types of the sources that report the sizes of their elements,
+	// which the minSize and maxSize filters compare.
+	sizeSources = map[string]bool{"azblob": true, "b2": true, "fs": true, "ftp": true, "gcs": true, "natsobject": true, "onedrive": true, "s3": true, "sftp": true, "webdav": true}
+	// modificationTimeSources are the types of the sources that report the modification times of their elements,
+	// which the modifiedAfter filter compares.
+	modificationTimeSources = map[string]bool{"azblob": true, "b2": true, "fs": true, "gcs": true, "natsobject": true, "onedrive": true, "s3": true, "sftp": true, "webdav": true}
+)
+
+// supports returns an error if the filters compare the size or the modification time of elements
+// of a type of source that does not report them, because the filters would drop all of its elements.
+func (f *Filters) supports(sourceType string) error {
+	if (f.MinSize != 0 || f.MaxSize != 0) && !sizeSources[sourceType] {
+		return fmt.Errorf("sources of type %q do not report the sizes of their elements, so minSize and maxSize cannot be used", sourceType)
+	}
+	if f.ModifiedAfter != "" && !modificationTimeSources[sourceType] {
+		return fmt.Errorf("sources of type %q do not report the modification times of their elements, so modifiedAfter cannot be used", sourceType)
+	}
+	return nil
+}
+
+// Filter converts the configuration into an enqueue.Filter.
+func (f *Filters) Filter() (*enqueue.Filter, error) {
+	ef := &enqueue.Filter{
+		Names:     f.Names,
+		MinSize:   f.MinSize,
+		MaxSize:   f.MaxSize,
+		MimeTypes: f.MimeTypes,
+	}
+	for _, p := range append(append([]string{}, f.Names...), f.MimeTypes...) {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", p, err)
+		}
+	}
+	if f.Pattern != "" {
+		var err error
+		if ef.Pattern, err = regexp.Compile(f.Pattern); err != nil {
+			return nil, fmt.Errorf("invalid pattern: %w", err)
+		}
+	}
+	if f.MinSize < 0 || f.MaxSize < 0 || (f.MaxSize != 0 && f.MaxSize < f.MinSize) {
+		return nil, errors.New("sizes must not be negative and max size must not be lower than min size")
+	}
+	if f.ModifiedAfter != "" {
+		t, err := time.Parse(time.RFC3339, f.ModifiedAfter)
+		if err != nil {
+			d, derr := time.ParseDuration(f.ModifiedAfter)
+			if derr != nil || d <= 0 {
+				return nil, fmt.Errorf("modified after must be a time in RFC 3339 format or a positive duration: %q", f.ModifiedAfter)
+			}
+			ef.ModifiedWithin = d
+		}
+		ef.ModifiedAfter = t
+	}
+	return ef, nil
+}
+
+// setDefaults sets the interval, the batch size and the concurrency of the workflow to their defaults if they are not configured.
+func (w *Workflow) setDefaults() {
+	if w.Interval == nil && w.Schedule == "" {
+		w.Interval = &defaultInterval
+	}
+	if w.BatchSize == 0 {
+		w.BatchSize = ingest.DefaultBatchSize
+	}
+	if w.Concurrency == 0 {
+		w.Concurrency = w.BatchSize
+	}
+}
+
+// validateDependencies checks that the workflows on which the named workflow depends exist
+// and that they do not depend on the named workflow themselves.
+// The given dependencies map the names of all workflows to the workflows on which they depend.
+func validateDependencies(name string, dependencies map[string][]string) error {
+	for _, d := range dependencies[name] {
+		if _, ok := dependencies[d]; !ok {
+			return fmt.Errorf("workflow %q does not exist", d)
+		}
+	}
+	seen := map[string]struct{}{name: {}}
+	for next := dependencies[name]; len(next) > 0; {
+		var deps []string
+		for _, d := range next {
+			if d == name {
+				return errors.New("workflow depends on itself")
+			}
+			if _, ok := seen[d]; ok {
+				continue
+			}
+			seen[d] = struct{}{}
+			deps = append(deps, dependencies[d]...)
+		}
+		next = deps
+	}
+	return nil
+}
+
+// Consumer is used to configure the redelivery of messages of a workflow.
+// A value of 0 means that the default of the queue is used.
+type Consumer struct {
+	// AckWait is the duration after which a message that was not acknowledged is delivered again.
+	AckWait Duration
+	// MaxDeliver is the maximum number of times that a message is delivered.
+	MaxDeliver int
+	// Backoff are the durations after which a message is delivered again
+	// for consecutive deliveries. It takes precedence over AckWait.
+	Backoff []Duration
+	// DeadLetter publishes messages whose last delivery failed to be processed
+	// to the dead-letter subject of the workflow instead of dropping them.
+	DeadLetter bool
+}
+
+// validate checks that the queue accepts the configuration.
+func (c *Consumer) validate() error {
+	if c.AckWait < 0 || c.MaxDeliver < 0 {
+		return errors.New("ack wait and max deliver must not be negative")
+	}
+	for _, b := range c.Backoff {
+		if b <= 0 {
+			return errors.New("backoff durations must be positive")
+		}
+	}
+	if len(c.Backoff) > 0 && c.MaxDeliver <= len(c.Backoff) {
+		return fmt.Errorf("a backoff requires max deliver to exceed the number of its %d durations", len(c.Backoff))
+	}
+	return nil
+}
+
+// Retry is used to configure the retries of transfers of a workflow with an exponential backoff.
+type Retry struct {
+	// Retries is the maximum number of retries of a transfer. 0 disables retries and nil uses the default of 2.
+	Retries *int
+	// Wait is the duration before the first retry, which doubles with every further retry.
+	// 0 uses the default of 1s.
+	Wait Duration
+	// MaxWait bounds the duration between retries. 0 uses the default of 30s.
+	MaxWait Duration
+}
+
+// validate checks that the retries and the durations are not negative.
+func (r *Retry) validate() error {
+	if (r.Retries != nil && *r.Retries < 0) || r.Wait < 0 || r.MaxWait < 0 {
+		return errors.New("retries and wait durations must not be negative")
+	}
+	if r.MaxWait != 0 && r.MaxWait < r.Wait {
+		return errors.New("max wait must not be lower than wait")
+	}
+	return nil
+}
+
+// validateSubject checks that the subject names a single subject without wildcards.
+func validateSubject(subject string) error {
+	if strings.ContainsAny(subject, "*> \t") {
+		return errors.New("subject must not contain wildcards or whitespace")
+	}
+	for _, t := range strings.Split(subject, ".") {
+		if t == "" {
+			return errors.New("subject must not contain empty tokens")
+		}
+	}
+	return nil
+}
+
+// Stream is used to configure an isolated stream for a workflow.
+// The limits default to 0, i.e. no limit.
+type Stream struct {
+	// Name overrides the name of the stream, which defaults to the name of the shared stream
+	// followed by the name of the workflow. Workflows with the same stream name share the stream
+	// and must configure it identically.
+	Name string
+	// Replicas defaults to the replicas of the shared stream.
+	Replicas int
+	MaxMsgs  int64
+	MaxAge   Duration
+	MaxBytes int64
+	// Retention defaults to the retention policy of the shared stream.
+	Retention string
+	// Discard defaults to the discard policy of the shared stream.
+	Discard string
+}
+
+// Defaults is used to configure the settings that all workflows inherit unless they override them.
+type Defaults struct {
+	Interval    *Duration
+	BatchSize   int
+	Concurrency int
+	CleanUp     *bool
+	Webhook     string
+}
+
+// applyDefaults sets the fields that the workflows do not set to the defaults.
+func (c *Config) applyDefaults() {
+	if c.Defaults == nil {
+		return
+	}
+	d := c.Defaults
+	for i := range c.Workflows {
+		w := &c.Workflows[i]
+		// Workflows with a schedule do not inherit the interval, because they are mutually exclusive.
+		if w.Interval == nil && w.Schedule == "" {
+			w.Interval = d.Interval
+		}
+		if w.BatchSize == 0 {
+			w.BatchSize = d.BatchSize
+		}
+		if w.Concurrency == 0 {
+			w.Concurrency = d.Concurrency
+		}
+		if w.CleanUp == nil {
+			w.CleanUp = d.CleanUp
+		}
+		if w.Webhook == "" {
+			w.Webhook = d.Webhook
+		}
+	}
+}
+
+// applyCredentials adds the fields of the referenced credentials to the configurations of the sources and destinations.
+// Fields that a source or destination sets itself take precedence.
+func (c *Config) applyCredentials() error {
+	credentials := make(map[string]map[string]interface{}, len(c.Credentials))
+	for _, cr := range c.Credentials {
+		if _, ok := credentials[cr.Name]; ok {
+			return fmt.Errorf("found duplicate credentials %q", cr.Name)
+		}
+		credentials[cr.Name] = cr.Config
+	}
+	apply := func(name string, config map[string]interface{}) (map[string]interface{}, error) {
+		if name == "" {
+			return config, nil
+		}
+		cr, ok := credentials[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown credentials %q", name)
+		}
+		m := make(map[string]interface{}, len(cr)+len(config))
+		for k, v := range cr {
+			m[k] = v
+		}
+		for k, v := range config {
+			m[k] = v
+		}
+		return m, nil
+	}
+	for i := range c.Sources {
+		s := &c.Sources[i]
+		var err error
+		if s.Config, err = apply(s.Credentials, s.Config); err != nil {
+			return fmt.Errorf("source %q references %w", s.Name, err)
+		}
+	}
+	for i := range c.Destinations {
+		d := &c.Destinations[i]
+		var err error
+		if d.Config, err = apply(d.Credentials, d.Config); err != nil {
+			return fmt.Errorf("destination %q references %w", d.Name, err)
+		}
+	}
+	return nil
+}
+
+// Encryption is used to configure the encryption of messages on the queue.
+// Keys are base64-encoded AES keys of 16, 24 or 32 bytes and are best
+// read from the environment, e.g. key: $INGEST_ENCRYPTION_KEY.
+type Encryption struct {
+	// Key encrypts and decrypts messages.
+	Key string
+	// PreviousKeys only decrypt messages, so that keys can be rotated
+	// while messages that were encrypted with them are still queued.
+	PreviousKeys []string
+}
+
+// Keyring decodes the keys of the configuration.
+func (e *Encryption) Keyring() (*queue.Keyring, error) {
+	if e.Key == "" {
+		return nil, errors.New("encryption key must not be empty")
+	}
+	key, err := base64.StdEncoding.DecodeString(e.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode encryption key: %w", err)
+	}
+	previous := make([][]byte, len(e.PreviousKeys))
+	for i := range e.PreviousKeys {
+		if previous[i], err = base64.StdEncoding.DecodeString(e.PreviousKeys[i]); err != nil {
+			return nil, fmt.Errorf("failed to decode previous encryption key %d: %w", i, err)
+		}
+	}
+	return queue.NewKeyring(key, previous...)
+}
+
+// Plugins is used to verify the plugin files before they are started.
+type Plugins struct {
+	// AllowUnverified starts plugin files for which Verify declares no checksum or key.
+	AllowUnverified bool
+	// Verify declares the checksums and the keys of the signatures of the plugin files.
+	Verify []PluginVerification
+	// Limits declares the resource limits of the processes of plugin files.
+	Limits []PluginLimits
+}
+
+// PluginLimits declares the resource limits of every process of the plugin file of a type of sources and destinations.
+type PluginLimits struct {
+	// Name is the name of the plugin file, i.e. the type of the sources and destinations.
+	Name string
+	// Memory is the maximum memory of every process of the plugin in bytes.
+	Memory int64
+	// CPU is the maximum number of CPUs that every process of the plugin uses, e.g. 0.5 for half of a CPU.
+	// CPU limits require a cgroup for plugins.
+	CPU float64
+}
+
+// PluginVerification declares how the plugin file of a type of sources and destinations is verified.
+type PluginVerification struct {
+	// Name is the name of the plugin file, i.e. the type of the sources and destinations.
+	Name string
+	// Sha256 is the hex-encoded sha256 checksum of the plugin file.
+	Sha256 string
+	// MinisignKey is a minisign public key. The signature is read from the file next to the plugin file
+	// with the extension .minisig.
+	MinisignKey string
+}
+
+// pluginVerifier verifies plugin files with the verifications of their names.
+type pluginVerifier struct {
+	allowUnverified bool
+	verifications   map[string]plugin.Verification
+}
+
+func (v *pluginVerifier) Verify(path string) error {
+	name := filepath.Base(path)
+	pv, ok := v.verifications[name]
+	if !ok {
+		if v.allowUnverified {
+			return nil
+		}
+		return fmt.Errorf("%w: no checksum or key is declared for plugin %q in plugins.verify and plugins.allowUnverified is not set", plugin.ErrUnverified, name)
+	}
+	return pv.Verify(path)
+}
+
+// PluginVerifier returns the verifier of the plugin files of the configuration for the plugin manager.
+// Plugin files without a declared checksum or key are refused unless unverified plugins are allowed.
+func (c *Config) PluginVerifier() (plugin.Verifier, error) {
+	v := &pluginVerifier{verifications: make(map[string]plugin.Verification)}
+	if c.Plugins == nil {
+		return v, nil
+	}
+	v.allowUnverified = c.Plugins.AllowUnverified
+	for _, pv := range c.Plugins.Verify {
+		if pv.Name == "" {
+			return nil, errors.New("plugin verifications require a name")
+		}
+		if _, ok := v.verifications[pv.Name]; ok {
+			return nil, fmt.Errorf("found duplicate verification of plugin %q", pv.Name)
+		}
+		vv := plugin.Verification{SHA256: pv.Sha256, MinisignKey: pv.MinisignKey}
+		if err := vv.Validate(); err != nil {
+			return nil, fmt.Errorf("verification of plugin %q is invalid: %w", pv.Name, err)
+		}
+		v.verifications[pv.Name] = vv
+	}
+	return v, nil
+}
+
+// PluginLimits returns the resource limits of the plugin files of the configuration by their names for the plugin manager.
+func (c *Config) PluginLimits() (map[string]plugin.Limits, error) {
+	limits := make(map[string]plugin.Limits)
+	if c.Plugins == nil {
+		return limits, nil
+	}
+	for _, pl := range c.Plugins.Limits {
+		if pl.Name == "" {
+			return nil, errors.New("plugin limits require a name")
+		}
+		if _, ok := limits[pl.Name]; ok {
+			return nil, fmt.Errorf("found duplicate limits of plugin %q", pl.Name)
+		}
+		l := plugin.Limits{Memory: pl.Memory, CPU: pl.CPU}
+		if err := l.Validate(); err != nil {
+			return nil, fmt.Errorf("limits of plugin %q are invalid: %w", pl.Name, err)
+		}
+		limits[pl.Name] = l
+	}
+	return limits, nil
 }
 
 // Config represents a configuration of sources, workflows and destinations.
 type Config struct {
-	Version      string
+	Version string
+	// Include lists further configuration files or directories that are merged into the configuration.
+	// Relative paths are relative to the directory of the file and may contain wildcards, e.g. teams/*.yaml.
+	Include      []string
 	Sources      []Source
 	Destinations []Destination
 	Workflows    []Workflow
+	// Encryption encrypts the messages of all workflows on the queue,
+	// e.g. when the NATS cluster is shared infrastructure.
+	Encryption *Encryption
+	// Defaults are inherited by all workflows that do not set the respective fields.
+	Defaults *Defaults
+	// Credentials are shared by the sources and destinations that reference them.
+	Credentials []Credentials
+	// MaxTransfers limits the number of elements that the workflows download and store at the same time
+	// in addition to their concurrency. A value of 0 means no limit.
+	MaxTransfers int
+	// Plugins declares how the plugin files are verified before they are started and limits their resources.
+	Plugins *Plugins
 
 	workflowInstantiationFailuresTotal prometheus.Counter
 }
 
 // ConfigurePlugins configures the plugins found in path.
 func (c *Config) ConfigurePlugins(pm *plugin.PluginManager, paths []string, strict bool) (map[string]plugin.Source, map[string]plugin.Destination, error) {
+	return c.configurePlugins(pm, paths, strict, nil, nil)
+}
+
+// Reconfigure configures the plugins like ConfigurePlugins but reuses the given sources and destinations
+// of the previous configuration whose configuration did not change instead of starting new plugins.
+// If the configuration fails, then the plugins that were started are killed,
+// so that the previous configuration keeps working.
+// The plugins of the previous configuration that are no longer used must be killed with Release.
+func (c *Config) Reconfigure(pm *plugin.PluginManager, paths []string, strict bool, prev *Config, sources map[string]plugin.Source, destinations map[string]plugin.Destination) (map[string]plugin.Source, map[string]plugin.Destination, error) {
+	reuseSources := make(map[string]plugin.Source)
+	for _, s := range c.Sources {
+		for _, ps := range prev.Sources {
+			if ps.Name == s.Name && reflect.DeepEqual(ps, s) && sources[s.Name] != nil {
+				reuseSources[s.Name] = sources[s.Name]
+			}
+		}
+	}
+	reuseDestinations := make(map[string]plugin.Destination)
+	for _, d := range c.Destinations {
+		for _, pd := range prev.Destinations {
+			if pd.Name == d.Name && reflect.DeepEqual(pd, d) && destinations[d.Name] != nil {
+				reuseDestinations[d.Name] = destinations[d.Name]
+			}
+		}
+	}
+	return c.configurePlugins(pm, paths, strict, reuseSources, reuseDestinations)
+}
+
+// configurePlugins configures the plugins found in path and reuses the given sources and destinations.
+// If it fails, then it kills the plugins that it started.
+func (c *Config) configurePlugins(pm *plugin.PluginManager, paths []string, strict bool, reuseSources map[string]plugin.Source, reuseDestinations map[string]plugin.Destination) (_ map[string]plugin.Source, _ map[string]plugin.Destination, err error) {
+	if c.MaxTransfers < 0 {
+		return nil, nil, errors.New("max transfers must not be negative")
+	}
 	// Collect all of the named pluginPaths.
 	pluginPaths := make(map[string]string)
 	sources := make(map[string]plugin.Source)
 	destinations := make(map[string]plugin.Destination)
+	started := &startedPlugins{}
+	defer func() {
+		if err != nil {
+			Release(pm, sources, reuseSources, destinations, reuseDestinations)
+		}
+		// Kill the plugins that were started for workflows that turned out to be invalid.
+		Release(pm, started.sources, sources, started.destinations, destinations)
+	}()
 	pluginNames := make(map[string]struct{})
 	sourceNames := make(map[string]int)
 	destinationNames := make(map[string]int)
 	workflowNames := make(map[string]struct{})
+	// subjects and streams hold the overridden subjects and named streams of valid workflows.
+	subjects := make(map[string]string)
+	streams := make(map[string]*Stream)
 	// Validate the sources.
 	for i, s := range c.Sources {
 		pluginNames[s.Type] = struct{}{}
@@ -128,12 +756,39 @@ func (c *Config) ConfigurePlugins(pm *plugin.PluginManager, paths []string, stri
 	}
 	// Find plugin paths
 	for pn := range pluginNames {
-		pp, err := firstPath(paths, pn)
+		pp, err := pluginPath(paths, pn)
 		if err != nil {
 			return nil, nil, fmt.Errorf("none of the given paths contains the filename %s: %w", pn, err)
 		}
 		pluginPaths[pn] = pp
 	}
+	dependencies := make(map[string][]string, len(c.Workflows))
+	for _, w := range c.Workflows {
+		dependencies[w.Name] = w.DependsOn
+	}
+	// Start the plugins of the sources and destinations that the workflows reference and that are not reused.
+	// Their pools of plugin instances are sized by the largest concurrency of the workflows that use them.
+	startSources := make(map[int]int)
+	startDestinations := make(map[int]int)
+	for _, w := range c.Workflows {
+		w.setDefaults()
+		concurrency := w.Concurrency
+		if w.MaxConcurrency > concurrency {
+			concurrency = w.MaxConcurrency
+		}
+		if j, ok := sourceNames[w.Source]; ok && reuseSources[w.Source] == nil && concurrency > startSources[j] {
+			startSources[j] = concurrency
+		}
+		for _, d := range w.Destinations {
+			if j, ok := destinationNames[d]; ok && reuseDestinations[d] == nil && concurrency > startDestinations[j] {
+				startDestinations[j] = concurrency
+			}
+		}
+	}
+	started = c.startPlugins(pm, pluginPaths, startSources, startDestinations)
+	if err := started.err(c); err != nil && strict {
+		return nil, nil, err
+	}
 	i := 0
 	// Validate the workflows.
 workflow:
@@ -148,25 +803,109 @@ workflow:
 			c.workflowInstantiationFailuresTotal.Inc()
 			continue
 		}
-		// Instantiate the source.
-		// Ensure a source is only instantiated once.
-		if _, ok := sources[w.Source]; !ok {
-			s, err := pm.NewSource(
-				pluginPaths[c.Sources[sourceNames[w.Source]].Type],
-				c.Sources[sourceNames[w.Source]].Config,
-				prometheus.Labels{
-					"component": "source",
-					"plugin":    c.Sources[sourceNames[w.Source]].Type,
-					"name":      c.Sources[sourceNames[w.Source]].Name,
-				})
+		if w.Priority != "" {
+			if _, err := regexp.Compile(w.Priority); err != nil {
+				if strict {
+					return nil, nil, fmt.Errorf("workflow %q has an invalid priority pattern: %w", w.Name, err)
+				}
+				c.workflowInstantiationFailuresTotal.Inc()
+				continue
+			}
+		}
+		if w.Schedule != "" {
+			_, err := cron.Parse(w.Schedule)
+			if err == nil && w.Interval != nil {
+				err = errors.New("interval and schedule are mutually exclusive")
+			}
+			if err != nil {
+				if strict {
+					return nil, nil, fmt.Errorf("workflow %q has an invalid schedule: %w", w.Name, err)
+				}
+				c.workflowInstantiationFailuresTotal.Inc()
+				continue
+			}
+		}
+		if w.PathTemplate != "" {
+			if _, err := dequeue.ParsePathTemplate(w.PathTemplate); err != nil {
+				if strict {
+					return nil, nil, fmt.Errorf("workflow %q has an invalid path template: %w", w.Name, err)
+				}
+				c.workflowInstantiationFailuresTotal.Inc()
+				continue
+			}
+		}
+		if w.Filters != nil {
+			_, err := w.Filters.Filter()
+			if err == nil {
+				err = w.Filters.supports(c.Sources[sourceNames[w.Source]].Type)
+			}
+			if err != nil {
+				if strict {
+					return nil, nil, fmt.Errorf("workflow %q has invalid filters: %w", w.Name, err)
+				}
+				c.workflowInstantiationFailuresTotal.Inc()
+				continue
+			}
+		}
+		if w.Subject != "" {
+			err := validateSubject(w.Subject)
+			if n, ok := subjects[w.Subject]; ok && err == nil {
+				err = fmt.Errorf("subject is already used by workflow %q", n)
+			}
 			if err != nil {
 				if strict {
-					return nil, nil, fmt.Errorf("cannot instantiate source %q: %w", w.Source, err)
+					return nil, nil, fmt.Errorf("workflow %q has an invalid subject: %w", w.Name, err)
+				}
+				c.workflowInstantiationFailuresTotal.Inc()
+				continue
+			}
+		}
+		if w.Stream != nil && w.Stream.Name != "" {
+			if s, ok := streams[w.Stream.Name]; ok && !reflect.DeepEqual(s, w.Stream) {
+				if strict {
+					return nil, nil, fmt.Errorf("workflow %q configures stream %q differently than other workflows", w.Name, w.Stream.Name)
+				}
+				c.workflowInstantiationFailuresTotal.Inc()
+				continue
+			}
+		}
+		if w.Consumer != nil {
+			if err := w.Consumer.validate(); err != nil {
+				if strict {
+					return nil, nil, fmt.Errorf("workflow %q has an invalid consumer: %w", w.Name, err)
 				}
 				c.workflowInstantiationFailuresTotal.Inc()
 				continue
 			}
-			sources[w.Source] = &SourceTyper{s, c.Sources[sourceNames[w.Source]].Type}
+		}
+		if w.Retry != nil {
+			if err := w.Retry.validate(); err != nil {
+				if strict {
+					return nil, nil, fmt.Errorf("workflow %q has an invalid retry: %w", w.Name, err)
+				}
+				c.workflowInstantiationFailuresTotal.Inc()
+				continue
+			}
+		}
+		if err := validateDependencies(w.Name, dependencies); err != nil {
+			if strict {
+				return nil, nil, fmt.Errorf("workflow %q has invalid dependencies: %w", w.Name, err)
+			}
+			c.workflowInstantiationFailuresTotal.Inc()
+			continue
+		}
+		// Use the reused or started source.
+		if s, ok := reuseSources[w.Source]; ok {
+			sources[w.Source] = s
+		}
+		if _, ok := sources[w.Source]; !ok {
+			// The errors of the sources and destinations that could not be started were already returned in strict mode.
+			s, ok := started.sources[w.Source]
+			if !ok {
+				c.workflowInstantiationFailuresTotal.Inc()
+				continue
+			}
+			sources[w.Source] = s
 		}
 
 		for _, d := range w.Destinations {
@@ -177,40 +916,35 @@ workflow:
 				c.workflowInstantiationFailuresTotal.Inc()
 				continue workflow
 			}
-			// Instantiate the destinations.
-			// Ensure a destination is only instantiated once.
+			// Use the reused or started destinations.
+			if dd, ok := reuseDestinations[d]; ok {
+				destinations[d] = dd
+			}
 			if _, ok := destinations[d]; !ok {
-				if _, ok := destinations[d]; !ok {
-					dd, err := pm.NewDestination(
-						pluginPaths[c.Destinations[destinationNames[d]].Type],
-						c.Destinations[destinationNames[d]].Config,
-						prometheus.Labels{
-							"component": "destination",
-							"plugin":    c.Destinations[destinationNames[d]].Type,
-							"name":      c.Destinations[destinationNames[d]].Name,
-						})
-					if err != nil {
-						if strict {
-							return nil, nil, fmt.Errorf("cannot instantiate destination %q: %w", d, err)
-						}
-						c.workflowInstantiationFailuresTotal.Inc()
-						continue workflow
-					}
-					destinations[d] = &DestinationTyper{dd, c.Destinations[i].Type}
+				dd, ok := started.destinations[d]
+				if !ok {
+					c.workflowInstantiationFailuresTotal.Inc()
+					continue workflow
 				}
+				destinations[d] = dd
 			}
 		}
-		if w.Interval == nil {
-			w.Interval = &defaultInterval
-		}
-		if w.BatchSize == 0 {
-			w.BatchSize = ingest.DefaultBatchSize
-		}
-		if w.Concurrency == 0 {
-			w.Concurrency = w.BatchSize
+		w.setDefaults()
+		if w.MaxConcurrency != 0 && w.MaxConcurrency < w.Concurrency {
+			if strict {
+				return nil, nil, fmt.Errorf("workflow %q has a max concurrency of %d that is lower than its concurrency of %d", w.Name, w.MaxConcurrency, w.Concurrency)
+			}
+			c.workflowInstantiationFailuresTotal.Inc()
+			continue
 		}
 		c.Workflows[i] = w
 		workflowNames[w.Name] = struct{}{}
+		if w.Subject != "" {
+			subjects[w.Subject] = w.Name
+		}
+		if w.Stream != nil && w.Stream.Name != "" {
+			streams[w.Stream.Name] = w.Stream
+		}
 		i++
 	}
 	// Clean up unused workflows.
@@ -222,6 +956,18 @@ workflow:
 	return sources, destinations, nil
 }
 
+// pluginPath returns the path of the first plugin file of the given name in paths
+// or, if there is no such file, the path of the built-in plugin of the name.
+func pluginPath(paths []string, name string) (string, error) {
+	pp, err := firstPath(paths, name)
+	if errors.Is(err, os.ErrNotExist) {
+		if bp, ok := plugin.BuiltinPath(name); ok {
+			return bp, nil
+		}
+	}
+	return pp, err
+}
+
 func firstPath(paths []string, filename string) (string, error) {
 	for _, p := range paths {
 		fpath := filepath.Join(p, filename)
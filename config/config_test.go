@@ -1,12 +1,18 @@
 package config
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"runtime"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/connylabs/ingest/plugin"
+	"github.com/hashicorp/go-hclog"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -32,6 +38,39 @@ sources:
 	assert.Equal(t, secret, s)
 }
 
+func TestNewWithTemplate(t *testing.T) {
+	t.Setenv("INGEST_ENVIRONMENT", "Prod")
+	t.Setenv("INGEST_PREFIXES", "foo,bar")
+
+	c, err := New([]byte(`
+sources:
+- name: foo_1
+  type: s3
+  bucket: {% env "INGEST_ENVIRONMENT" | lower %}-ingest
+  region: {% env "INGEST_REGION" | default "eu-central-1" %}
+  prefix: {% env "INGEST_PREFIXES" | split "," | join "/" %}/
+  year: "{% now.Year %}"
+destinations:
+- name: bar_1
+  type: smtp
+  subject: "{{.Name}}"
+`), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "prod-ingest", c.Sources[0].Config["bucket"])
+	assert.Equal(t, "eu-central-1", c.Sources[0].Config["region"])
+	assert.Equal(t, "foo/bar/", c.Sources[0].Config["prefix"])
+	assert.Equal(t, fmt.Sprint(time.Now().Year()), c.Sources[0].Config["year"])
+	assert.Equal(t, "{{.Name}}", c.Destinations[0].Config["subject"], "the templates of plugins must be kept")
+
+	_, err = New([]byte(`
+sources:
+- name: foo_1
+  type: s3
+  bucket: {% env "INGEST_BUCKET" | required "INGEST_BUCKET must be set" %}
+`), nil)
+	assert.ErrorContains(t, err, "INGEST_BUCKET must be set")
+}
+
 func TestNew(t *testing.T) {
 	for _, tc := range []struct {
 		name          string
@@ -96,6 +135,25 @@ workflows:
   destinations:
   - bar_1
   - bar_2
+`),
+		},
+		{
+			name:          "built-in plugin",
+			paths:         []string{"../bin/plugin/to/nowhere"},
+			nSources:      1,
+			nDestinations: 1,
+			config: []byte(`
+sources:
+- name: foo
+  type: noop
+destinations:
+- name: bar
+  type: noop
+workflows:
+- name: foo-bar
+  source: foo
+  destinations:
+  - bar
 `),
 		},
 		{
@@ -352,6 +410,88 @@ workflows:
   destinations:
   - bar_1
   - bar_2
+`),
+		},
+		{
+			name:          "workflows overriding subjects and sharing a stream",
+			paths:         []string{fmt.Sprintf("../bin/plugin/%s/%s", runtime.GOOS, runtime.GOARCH)},
+			strict:        true,
+			nSources:      1,
+			nDestinations: 0,
+			config: []byte(`
+sources:
+- name: foo_1
+  type: s3
+workflows:
+- name: foo_1-a
+  source: foo_1
+  subject: critical.a
+  stream:
+    name: critical
+    replicas: 3
+- name: foo_1-b
+  source: foo_1
+  subject: critical.b
+  stream:
+    name: critical
+    replicas: 3
+`),
+		},
+		{
+			name:     "workflows with the same subject",
+			paths:    []string{fmt.Sprintf("../bin/plugin/%s/%s", runtime.GOOS, runtime.GOARCH)},
+			strict:   true,
+			err:      errors.New(`workflow "foo_1-b" has an invalid subject: subject is already used by workflow "foo_1-a"`),
+			nSources: 0,
+			config: []byte(`
+sources:
+- name: foo_1
+  type: s3
+workflows:
+- name: foo_1-a
+  source: foo_1
+  subject: critical
+- name: foo_1-b
+  source: foo_1
+  subject: critical
+`),
+		},
+		{
+			name:     "workflow with wildcard subject",
+			paths:    []string{fmt.Sprintf("../bin/plugin/%s/%s", runtime.GOOS, runtime.GOARCH)},
+			strict:   true,
+			err:      errors.New(`workflow "foo_1-a" has an invalid subject`),
+			nSources: 0,
+			config: []byte(`
+sources:
+- name: foo_1
+  type: s3
+workflows:
+- name: foo_1-a
+  source: foo_1
+  subject: critical.*
+`),
+		},
+		{
+			name:     "workflows configuring a shared stream differently",
+			paths:    []string{fmt.Sprintf("../bin/plugin/%s/%s", runtime.GOOS, runtime.GOARCH)},
+			strict:   true,
+			err:      errors.New(`workflow "foo_1-b" configures stream "critical" differently than other workflows`),
+			nSources: 0,
+			config: []byte(`
+sources:
+- name: foo_1
+  type: s3
+workflows:
+- name: foo_1-a
+  source: foo_1
+  stream:
+    name: critical
+    replicas: 3
+- name: foo_1-b
+  source: foo_1
+  stream:
+    name: critical
 `),
 		},
 	} {
@@ -384,3 +524,495 @@ workflows:
 		})
 	}
 }
+
+func TestConsumerValidate(t *testing.T) {
+	c, err := New([]byte(`
+workflows:
+- name: foo
+  consumer:
+    ackWait: 10m
+    maxDeliver: 4
+    backoff:
+    - 1m
+    - 5m
+`), nil)
+	require.NoError(t, err)
+	require.NotNil(t, c.Workflows[0].Consumer)
+	assert.Equal(t, Consumer{AckWait: Duration(10 * time.Minute), MaxDeliver: 4, Backoff: []Duration{Duration(time.Minute), Duration(5 * time.Minute)}}, *c.Workflows[0].Consumer)
+	assert.NoError(t, c.Workflows[0].Consumer.validate())
+
+	for _, c := range []Consumer{
+		{AckWait: Duration(-time.Second)},
+		{MaxDeliver: -1},
+		{MaxDeliver: 3, Backoff: []Duration{0}},
+		{MaxDeliver: 2, Backoff: []Duration{Duration(time.Minute), Duration(time.Minute)}},
+		{Backoff: []Duration{Duration(time.Minute)}},
+	} {
+		assert.Error(t, c.validate(), "%+v", c)
+	}
+}
+
+func TestRetryValidate(t *testing.T) {
+	c, err := New([]byte(`
+workflows:
+- name: foo
+  retry:
+    retries: 0
+    wait: 500ms
+    maxWait: 10s
+`), nil)
+	require.NoError(t, err)
+	require.NotNil(t, c.Workflows[0].Retry)
+	assert.Equal(t, Retry{Retries: toPtr(0), Wait: Duration(500 * time.Millisecond), MaxWait: Duration(10 * time.Second)}, *c.Workflows[0].Retry)
+	assert.NoError(t, c.Workflows[0].Retry.validate())
+
+	for _, r := range []Retry{
+		{Retries: toPtr(-1)},
+		{Wait: Duration(-time.Second)},
+		{MaxWait: Duration(-time.Second)},
+		{Wait: Duration(time.Minute), MaxWait: Duration(time.Second)},
+	} {
+		assert.Error(t, r.validate(), "%+v", r)
+	}
+}
+
+func TestNewWithDefaults(t *testing.T) {
+	c, err := New([]byte(`
+defaults:
+  interval: 1h
+  batchSize: 4
+  concurrency: 2
+  cleanUp: true
+  webhook: http://localhost:8080
+workflows:
+- name: foo
+- name: bar
+  interval: 1m
+  batchSize: 8
+  concurrency: 8
+  cleanUp: false
+  webhook: http://localhost:9090
+- name: baz
+  schedule: "@daily"
+`), nil)
+	require.NoError(t, err)
+	require.Len(t, c.Workflows, 3)
+	hour, minute := Duration(time.Hour), Duration(time.Minute)
+	assert.Equal(t, Workflow{Name: "foo", Interval: &hour, BatchSize: 4, Concurrency: 2, CleanUp: toPtr(true), Webhook: "http://localhost:8080"}, c.Workflows[0])
+	assert.Equal(t, Workflow{Name: "bar", Interval: &minute, BatchSize: 8, Concurrency: 8, CleanUp: toPtr(false), Webhook: "http://localhost:9090"}, c.Workflows[1])
+	assert.Equal(t, Workflow{Name: "baz", Schedule: "@daily", BatchSize: 4, Concurrency: 2, CleanUp: toPtr(true), Webhook: "http://localhost:8080"}, c.Workflows[2])
+}
+
+func TestNewWithCredentials(t *testing.T) {
+	c, err := New([]byte(`
+credentials:
+- name: account
+  accessKeyID: key
+  secretAccessKey: secret
+  endpoint: s3.amazonaws.com
+sources:
+- name: foo
+  type: s3
+  credentials: account
+  bucket: foo
+- name: bar
+  type: s3
+  credentials: account
+  bucket: bar
+  endpoint: minio:9000
+destinations:
+- name: baz
+  type: s3
+  credentials: account
+  bucket: baz
+- name: qux
+  type: fs
+`), nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"accessKeyID": "key", "secretAccessKey": "secret", "endpoint": "s3.amazonaws.com", "bucket": "foo"}, c.Sources[0].Config)
+	// Fields of the source take precedence.
+	assert.Equal(t, map[string]interface{}{"accessKeyID": "key", "secretAccessKey": "secret", "endpoint": "minio:9000", "bucket": "bar"}, c.Sources[1].Config)
+	assert.Equal(t, map[string]interface{}{"accessKeyID": "key", "secretAccessKey": "secret", "endpoint": "s3.amazonaws.com", "bucket": "baz"}, c.Destinations[0].Config)
+	assert.Empty(t, c.Destinations[1].Config)
+
+	for _, config := range []string{
+		"{sources: [{name: foo, type: s3, credentials: missing}]}",
+		"{destinations: [{name: foo, type: s3, credentials: missing}]}",
+		"{credentials: [{name: account}, {name: account}]}",
+	} {
+		_, err := New([]byte(config), nil)
+		assert.Error(t, err, config)
+	}
+}
+
+func TestValidateDependencies(t *testing.T) {
+	dependencies := map[string][]string{
+		"raw":       nil,
+		"transform": {"raw"},
+		"report":    {"transform", "raw"},
+		"missing":   {"foo"},
+		"self":      {"self"},
+		"a":         {"b"},
+		"b":         {"c"},
+		"c":         {"a"},
+		"d":         {"a"},
+	}
+	for name, valid := range map[string]bool{
+		"raw":       true,
+		"transform": true,
+		"report":    true,
+		"missing":   false,
+		"self":      false,
+		"a":         false,
+		"c":         false,
+		// Only the workflows of a cycle depend on themselves.
+		"d": true,
+	} {
+		err := validateDependencies(name, dependencies)
+		if valid {
+			assert.NoError(t, err, name)
+		} else {
+			assert.Error(t, err, name)
+		}
+	}
+}
+
+func TestFiltersFilter(t *testing.T) {
+	c, err := New([]byte(`
+workflows:
+- name: foo
+  filters:
+    names:
+    - "*.csv"
+    pattern: ^reports/
+    minSize: 1
+    maxSize: 1024
+    mimeTypes:
+    - text/*
+    modifiedAfter: 2023-01-01T00:00:00Z
+- name: bar
+  filters:
+    modifiedAfter: 24h
+`), nil)
+	require.NoError(t, err)
+	require.NotNil(t, c.Workflows[0].Filters)
+	f, err := c.Workflows[0].Filters.Filter()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"*.csv"}, f.Names)
+	assert.Equal(t, "^reports/", f.Pattern.String())
+	assert.Equal(t, int64(1), f.MinSize)
+	assert.Equal(t, int64(1024), f.MaxSize)
+	assert.Equal(t, []string{"text/*"}, f.MimeTypes)
+	assert.Equal(t, time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), f.ModifiedAfter)
+	f, err = c.Workflows[1].Filters.Filter()
+	require.NoError(t, err)
+	assert.Equal(t, 24*time.Hour, f.ModifiedWithin)
+	assert.True(t, f.ModifiedAfter.IsZero())
+
+	for _, f := range []Filters{
+		{Names: []string{"[.csv"}},
+		{MimeTypes: []string{"text/["}},
+		{Pattern: "("},
+		{MinSize: -1},
+		{MinSize: 10, MaxSize: 1},
+		{ModifiedAfter: "yesterday"},
+		{ModifiedAfter: "-1h"},
+	} {
+		_, err := f.Filter()
+		assert.Error(t, err, "%+v", f)
+	}
+
+	// Sources that do not report sizes or modification times cannot be filtered by them.
+	assert.NoError(t, (&Filters{MinSize: 1, ModifiedAfter: "24h"}).supports("s3"))
+	assert.NoError(t, (&Filters{MaxSize: 1}).supports("ftp"))
+	assert.Error(t, (&Filters{ModifiedAfter: "24h"}).supports("ftp"))
+	assert.Error(t, (&Filters{MinSize: 1}).supports("http"))
+	assert.NoError(t, (&Filters{Names: []string{"*.csv"}}).supports("http"))
+}
+
+func TestEncryptionKeyring(t *testing.T) {
+	t.Setenv("INGEST_ENCRYPTION_KEY", "AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=")
+	c, err := New([]byte(`
+encryption:
+  key: $INGEST_ENCRYPTION_KEY
+  previousKeys:
+  - AgICAgICAgICAgICAgICAg==
+`), nil)
+	require.NoError(t, err)
+	require.NotNil(t, c.Encryption)
+	k, err := c.Encryption.Keyring()
+	require.NoError(t, err)
+	assert.NotNil(t, k)
+
+	for _, e := range []Encryption{
+		{},
+		{Key: "not base64"},
+		{Key: "AQID"},
+		{Key: "AgICAgICAgICAgICAgICAg==", PreviousKeys: []string{"AQID"}},
+	} {
+		_, err := e.Keyring()
+		assert.Error(t, err, "%+v", e)
+	}
+}
+
+func TestReconfigure(t *testing.T) {
+	paths := []string{fmt.Sprintf("../bin/plugin/%s/%s", runtime.GOOS, runtime.GOARCH)}
+	r := prometheus.NewRegistry()
+	prev, err := New([]byte(`
+sources:
+- name: foo_1
+  type: s3
+- name: foo_2
+  type: s3
+destinations:
+- name: bar_1
+  type: s3
+workflows:
+- name: foo_1-bar_1
+  source: foo_1
+  destinations:
+  - bar_1
+- name: foo_2-bar_1
+  source: foo_2
+  destinations:
+  - bar_1
+`), r)
+	require.NoError(t, err)
+
+	pm := plugin.NewPluginManager(0, nil)
+	t.Cleanup(pm.Stop)
+	ss, ds, err := prev.ConfigurePlugins(pm, paths, true)
+	require.NoError(t, err)
+
+	changed := []byte(`
+sources:
+- name: foo_1
+  type: s3
+- name: foo_2
+  type: s3
+  prefix: foo/
+destinations:
+- name: bar_1
+  type: s3
+workflows:
+- name: foo_1-bar_1
+  source: foo_1
+  destinations:
+  - bar_1
+- name: foo_2-bar_1
+  source: foo_2
+  destinations:
+  - bar_1
+  - bar_2
+`)
+	// The configuration is reloaded with the same registry.
+	c, err := New(changed, r)
+	require.NoError(t, err)
+	_, _, err = c.Reconfigure(pm, paths, true, prev, ss, ds)
+	assert.Error(t, err)
+	for _, s := range ss {
+		_, err := s.(*SourceTyper).p.(prometheus.Gatherer).Gather()
+		assert.NoError(t, err, "the plugins of the previous configuration must keep working")
+	}
+
+	c, err = New(bytes.Replace(changed, []byte("  - bar_2\n"), nil, 1), r)
+	require.NoError(t, err)
+	ss2, ds2, err := c.Reconfigure(pm, paths, true, prev, ss, ds)
+	require.NoError(t, err)
+	assert.Same(t, ss["foo_1"], ss2["foo_1"])
+	assert.NotSame(t, ss["foo_2"], ss2["foo_2"])
+	assert.Same(t, ds["bar_1"], ds2["bar_1"])
+
+	Release(pm, ss, ss2, ds, ds2)
+	_, err = ss["foo_2"].(*SourceTyper).p.(prometheus.Gatherer).Gather()
+	assert.Error(t, err, "the changed source must be killed")
+	for _, s := range ss2 {
+		_, err := s.(*SourceTyper).p.(prometheus.Gatherer).Gather()
+		assert.NoError(t, err)
+	}
+}
+
+func TestConfigurePluginsSharedDestinations(t *testing.T) {
+	paths := []string{fmt.Sprintf("../bin/plugin/%s/%s", runtime.GOOS, runtime.GOARCH)}
+	config := []byte(`
+sources:
+- name: foo
+  type: s3
+destinations:
+- name: bar_1
+  type: s3
+  bucket: bar
+- name: bar_2
+  type: s3
+  dedup: {}
+  bucket: bar
+- name: bar_3
+  type: s3
+  bucket: baz
+workflows:
+- name: foo-bar
+  source: foo
+  destinations:
+  - bar_1
+  - bar_2
+  - bar_3
+`)
+	prev, err := New(config, nil)
+	require.NoError(t, err)
+	pm := plugin.NewPluginManager(0, nil)
+	t.Cleanup(pm.Stop)
+	ss, ds, err := prev.ConfigurePlugins(pm, paths, true)
+	require.NoError(t, err)
+
+	// Destinations with identical plugin configurations share the plugin, but not their deduplication.
+	plugins := func(ds map[string]plugin.Destination) map[string]plugin.Destination {
+		ps := make(map[string]plugin.Destination)
+		for n, d := range ds {
+			ps[n] = d.(*DestinationTyper).p
+		}
+		return ps
+	}
+	ps := plugins(ds)
+	assert.Same(t, ps["bar_1"], ps["bar_2"])
+	assert.NotSame(t, ps["bar_1"], ps["bar_3"])
+	assert.NotSame(t, ds["bar_1"], ds["bar_2"])
+	// The shared plugin carries the labels of the first of its destinations.
+	mfs, err := pm.Gather()
+	require.NoError(t, err)
+	var labeled []string
+	for _, mf := range mfs {
+		if mf.GetName() != "ingest_plugin_health_status" {
+			continue
+		}
+		for _, m := range mf.Metric {
+			labels := make(map[string]string)
+			for _, lp := range m.Label {
+				labels[lp.GetName()] = lp.GetValue()
+			}
+			if labels["component"] == "destination" {
+				labeled = append(labeled, labels["name"])
+			}
+		}
+	}
+	assert.ElementsMatch(t, []string{"bar_1", "bar_3"}, labeled)
+
+	// The plugin keeps running for the destination that did not change.
+	c, err := New(bytes.Replace(config, []byte("dedup: {}\n  bucket: bar"), []byte("bucket: qux"), 1), nil)
+	require.NoError(t, err)
+	ss2, ds2, err := c.Reconfigure(pm, paths, true, prev, ss, ds)
+	require.NoError(t, err)
+	ps2 := plugins(ds2)
+	assert.Same(t, ps["bar_1"], ps2["bar_1"])
+	assert.NotSame(t, ps["bar_2"], ps2["bar_2"])
+	Release(pm, ss, ss2, ds, ds2)
+	for n, p := range ps2 {
+		_, err := p.(prometheus.Gatherer).Gather()
+		assert.NoError(t, err, n)
+	}
+}
+
+func toPtr[T any](t T) *T {
+	return &t
+}
+
+// slowSource is a noop source whose configuration takes a while,
+// so that it records how many sources are configured at the same time.
+type slowSource struct {
+	plugin.Source
+	mu      *sync.Mutex
+	current *int
+	max     *int
+}
+
+func (s *slowSource) Configure(config map[string]any) error {
+	s.mu.Lock()
+	*s.current++
+	if *s.current > *s.max {
+		*s.max = *s.current
+	}
+	s.mu.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	s.mu.Lock()
+	*s.current--
+	s.mu.Unlock()
+	return s.Source.Configure(config)
+}
+
+func TestConfigurePluginsConcurrently(t *testing.T) {
+	var mu sync.Mutex
+	var current, max int
+	plugin.RegisterBuiltin("test-slow", plugin.Builtin{
+		NewSource: func(l hclog.Logger, _ prometheus.Registerer) plugin.Source {
+			return &slowSource{Source: plugin.NewNoopSource(l), mu: &mu, current: &current, max: &max}
+		},
+	})
+	var b bytes.Buffer
+	b.WriteString("version: v2\nsources:\n")
+	for i := 0; i < 3*pluginStartConcurrency; i++ {
+		fmt.Fprintf(&b, "- name: foo_%d\n  type: test-slow\n", i)
+	}
+	b.WriteString("- name: error_1\n  type: test-slow\n  config:\n    error: an error\n")
+	b.WriteString("- name: error_2\n  type: test-slow\n  config:\n    error: another error\n")
+	b.WriteString("workflows:\n")
+	for i := 0; i < 3*pluginStartConcurrency; i++ {
+		fmt.Fprintf(&b, "- name: foo_%d\n  source: foo_%d\n", i, i)
+	}
+	b.WriteString("- name: error_1\n  source: error_1\n- name: error_2\n  source: error_2\n")
+
+	c, err := New(b.Bytes(), nil)
+	require.NoError(t, err)
+	pm := plugin.NewPluginManager(0, nil)
+	t.Cleanup(pm.Stop)
+	_, _, err = c.ConfigurePlugins(pm, nil, true)
+	// The errors of all sources that could not be started are returned.
+	assert.ErrorContains(t, err, `cannot instantiate source "error_1": failed to configure source: an error`)
+	assert.ErrorContains(t, err, `cannot instantiate source "error_2": failed to configure source: another error`)
+	assert.Greater(t, max, 1)
+	assert.LessOrEqual(t, max, pluginStartConcurrency)
+
+	c, err = New(b.Bytes(), nil)
+	require.NoError(t, err)
+	ss, _, err := c.ConfigurePlugins(pm, nil, false)
+	require.NoError(t, err)
+	assert.Len(t, ss, 3*pluginStartConcurrency)
+	assert.Len(t, c.Workflows, 3*pluginStartConcurrency)
+}
+
+func TestConfigurePluginsInstances(t *testing.T) {
+	c, err := New([]byte(`
+version: v2
+sources:
+- name: foo
+  type: noop
+  maxInstances: 4
+destinations:
+- name: bar
+  type: noop
+  maxInstances: 3
+- name: baz
+  type: noop
+workflows:
+- name: foo-bar
+  source: foo
+  destinations:
+  - bar
+  concurrency: 2
+- name: foo-baz
+  source: foo
+  destinations:
+  - baz
+  concurrency: 1
+  maxConcurrency: 8
+`), nil)
+	require.NoError(t, err)
+	pm := plugin.NewPluginManager(0, nil)
+	t.Cleanup(pm.Stop)
+	_, _, err = c.ConfigurePlugins(pm, []string{fmt.Sprintf("../bin/plugin/%s/%s", runtime.GOOS, runtime.GOARCH)}, true)
+	require.NoError(t, err)
+	// The pools are limited by maxInstances and by the concurrency of the workflows.
+	instances := make(map[string]int)
+	for _, h := range pm.Health(context.Background()) {
+		instances[h.Labels["name"]]++
+	}
+	assert.Equal(t, map[string]int{"foo": 4, "bar": 2, "baz": 1}, instances)
+}
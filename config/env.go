@@ -0,0 +1,125 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Prefixes of the environment variables from which NewFromEnv derives the configuration.
+const (
+	EnvSourcePrefix      = "INGEST_SOURCE_"
+	EnvDestinationPrefix = "INGEST_DESTINATION_"
+	EnvWorkflowPrefix    = "INGEST_WORKFLOW_"
+	EnvEncryptionPrefix  = "INGEST_ENCRYPTION_"
+)
+
+// FromEnv checks whether the configuration should be derived from the environment,
+// which is the case if there is no local configuration at path and INGEST_SOURCE_TYPE is set.
+func FromEnv(path string) bool {
+	if IsURL(path) {
+		return false
+	}
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		return false
+	}
+	return os.Getenv(EnvSourcePrefix+"TYPE") != ""
+}
+
+// NewFromEnv creates a Config with a single source, destination and workflow
+// from environment variables in the form of os.Environ.
+// Variables with the prefix INGEST_SOURCE_ configure the source and the remainder of their name
+// in camel case names the field, e.g. INGEST_SOURCE_ACCESS_KEY_ID sets accessKeyId;
+// INGEST_DESTINATION_, INGEST_WORKFLOW_ and INGEST_ENCRYPTION_ configure the destination, the workflow and the encryption.
+// Values are parsed as YAML, so that e.g. INGEST_WORKFLOW_CLEAN_UP=true is a boolean;
+// values that must be strings can be quoted.
+// The source and the destination are named source and destination unless their NAME is set
+// and the workflow is named after them.
+func NewFromEnv(environ []string, r prometheus.Registerer) (*Config, error) {
+	c, err := fromEnv(environ)
+	if err != nil {
+		return nil, err
+	}
+	c.applyDefaults()
+	if err := c.register(r); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func fromEnv(environ []string) (*Config, error) {
+	source := map[string]interface{}{"name": "source"}
+	destination := map[string]interface{}{"name": "destination"}
+	workflow := make(map[string]interface{})
+	encryption := make(map[string]interface{})
+	for _, e := range environ {
+		k, v, _ := strings.Cut(e, "=")
+		for prefix, m := range map[string]map[string]interface{}{
+			EnvSourcePrefix:      source,
+			EnvDestinationPrefix: destination,
+			EnvWorkflowPrefix:    workflow,
+			EnvEncryptionPrefix:  encryption,
+		} {
+			if strings.HasPrefix(k, prefix) && len(k) > len(prefix) {
+				m[camelCase(strings.TrimPrefix(k, prefix))] = envValue(v)
+			}
+		}
+	}
+	if _, ok := source["type"]; !ok {
+		return nil, fmt.Errorf("the type of the source must be set with %sTYPE", EnvSourcePrefix)
+	}
+	if _, ok := destination["type"]; !ok {
+		return nil, fmt.Errorf("the type of the destination must be set with %sTYPE", EnvDestinationPrefix)
+	}
+	if _, ok := workflow["name"]; !ok {
+		workflow["name"] = fmt.Sprintf("%v-%v", source["name"], destination["name"])
+	}
+	workflow["source"] = source["name"]
+	workflow["destinations"] = []interface{}{destination["name"]}
+	raw := map[string]interface{}{
+		"sources":      []interface{}{source},
+		"destinations": []interface{}{destination},
+		"workflows":    []interface{}{workflow},
+	}
+	if len(encryption) != 0 {
+		raw["encryption"] = encryption
+	}
+
+	buf, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	c := new(Config)
+	if err := decode(buf, true, c); err != nil {
+		return nil, fmt.Errorf("invalid configuration in environment: %w", err)
+	}
+	return c, nil
+}
+
+// envValue parses the value of an environment variable as YAML.
+// Values that are empty or not valid YAML are kept as strings.
+func envValue(v string) interface{} {
+	var i interface{}
+	if v == "" || yaml.Unmarshal([]byte(v), &i) != nil || i == nil {
+		return v
+	}
+	return i
+}
+
+// camelCase converts a name like ACCESS_KEY_ID to accessKeyId.
+func camelCase(name string) string {
+	var b strings.Builder
+	for i, w := range strings.Split(strings.ToLower(name), "_") {
+		if i != 0 && w != "" {
+			w = strings.ToUpper(w[:1]) + w[1:]
+		}
+		b.WriteString(w)
+	}
+	return b.String()
+}
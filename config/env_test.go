@@ -0,0 +1,81 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewFromEnv(t *testing.T) {
+	c, err := NewFromEnv([]string{
+		"HOME=/root",
+		"INGEST_SOURCE_TYPE=s3",
+		"INGEST_SOURCE_BUCKET=foo",
+		"INGEST_SOURCE_ACCESS_KEY_ID=key",
+		"INGEST_SOURCE_RECURSIVE=true",
+		`INGEST_SOURCE_SECRET_ACCESS_KEY="1234"`,
+		"INGEST_DESTINATION_NAME=bar",
+		"INGEST_DESTINATION_TYPE=fs",
+		"INGEST_DESTINATION_DIRECTORY=/data",
+		"INGEST_WORKFLOW_INTERVAL=10m",
+		"INGEST_WORKFLOW_CLEAN_UP=true",
+		"INGEST_WORKFLOW_BATCH_SIZE=4",
+		"INGEST_WORKFLOW_PATH_TEMPLATE={{ .Date }}/{{ .Name }}",
+		"INGEST_WORKFLOW_FILTERS={names: ['*.csv']}",
+		"INGEST_ENCRYPTION_KEY=AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=",
+	}, nil)
+	require.NoError(t, err)
+
+	require.Len(t, c.Sources, 1)
+	assert.Equal(t, "source", c.Sources[0].Name)
+	assert.Equal(t, "s3", c.Sources[0].Type)
+	assert.Equal(t, map[string]interface{}{
+		"bucket":          "foo",
+		"accessKeyId":     "key",
+		"recursive":       true,
+		"secretAccessKey": "1234",
+	}, c.Sources[0].Config)
+
+	require.Len(t, c.Destinations, 1)
+	assert.Equal(t, "bar", c.Destinations[0].Name)
+	assert.Equal(t, "fs", c.Destinations[0].Type)
+	assert.Equal(t, map[string]interface{}{"directory": "/data"}, c.Destinations[0].Config)
+
+	require.Len(t, c.Workflows, 1)
+	interval := Duration(10 * time.Minute)
+	assert.Equal(t, Workflow{
+		Name:         "source-bar",
+		Source:       "source",
+		Destinations: []string{"bar"},
+		Interval:     &interval,
+		CleanUp:      toPtr(true),
+		BatchSize:    4,
+		PathTemplate: "{{ .Date }}/{{ .Name }}",
+		Filters:      &Filters{Names: []string{"*.csv"}},
+	}, c.Workflows[0])
+
+	require.NotNil(t, c.Encryption)
+	assert.Equal(t, "AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=", c.Encryption.Key)
+
+	for _, environ := range [][]string{
+		{"INGEST_DESTINATION_TYPE=fs"},
+		{"INGEST_SOURCE_TYPE=s3"},
+		{"INGEST_SOURCE_TYPE=s3", "INGEST_DESTINATION_TYPE=fs", "INGEST_WORKFLOW_UNKNOWN=foo"},
+		{"INGEST_SOURCE_TYPE=s3", "INGEST_DESTINATION_TYPE=fs", "INGEST_WORKFLOW_INTERVAL=often"},
+	} {
+		_, err := NewFromEnv(environ, nil)
+		assert.Error(t, err, environ)
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	dir := t.TempDir()
+	assert.False(t, FromEnv(filepath.Join(dir, "config")))
+	t.Setenv("INGEST_SOURCE_TYPE", "s3")
+	assert.True(t, FromEnv(filepath.Join(dir, "config")))
+	// An existing configuration takes precedence.
+	assert.False(t, FromEnv(dir))
+}
@@ -0,0 +1,283 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ghodss/yaml"
+
+	"github.com/connylabs/ingest/secret"
+)
+
+// loader reads configurations that are split across several files.
+type loader struct {
+	// strict rejects unknown fields.
+	strict bool
+	// seen holds the files that were read, so that every file is read only once.
+	seen map[string]struct{}
+}
+
+func newLoader(strict bool) *loader {
+	return &loader{strict: strict, seen: make(map[string]struct{})}
+}
+
+// loadPath reads the configuration file at path or, if path is a directory,
+// the YAML files in the directory, which are merged in lexical order.
+// If path is a URL, then the remote configuration is fetched.
+func (l *loader) loadPath(path string) (*Config, error) {
+	if IsURL(path) {
+		return l.loadURL(path)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read configuration from path %q: %w", path, err)
+	}
+	if !fi.IsDir() {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := l.seen[abs]; ok {
+			return nil, fmt.Errorf("configuration file %q is included more than once", path)
+		}
+		l.seen[abs] = struct{}{}
+		buf, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read configuration file from path %q: %w", path, err)
+		}
+		c, err := l.load(buf, filepath.Dir(path))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return c, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read configuration directory from path %q: %w", path, err)
+	}
+	c := new(Config)
+	for _, e := range entries {
+		if e.IsDir() || !isYAML(e.Name()) {
+			continue
+		}
+		f, err := l.loadPath(filepath.Join(path, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if err := c.merge(f); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// loadURL fetches the remote configuration at the URL.
+// The configuration files in the ConfigMaps that a k8s:// URL selects are merged.
+func (l *loader) loadURL(rawURL string) (*Config, error) {
+	name := rawURL
+	if u, err := url.Parse(rawURL); err == nil {
+		// Do not leak credentials in errors.
+		name = u.Redacted()
+	}
+	if _, ok := l.seen[rawURL]; ok {
+		return nil, fmt.Errorf("configuration %q is included more than once", name)
+	}
+	l.seen[rawURL] = struct{}{}
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+	var docs []document
+	if strings.HasPrefix(rawURL, kubernetesPrefix) {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid configuration URL: %w", err)
+		}
+		if docs, err = fetchConfigMaps(ctx, u); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	} else {
+		buf, err := Fetch(ctx, rawURL)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		docs = []document{{name: name, data: buf}}
+	}
+	c := new(Config)
+	for _, d := range docs {
+		f, err := l.load(d.data, "")
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", d.name, err)
+		}
+		if err := c.merge(f); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// load parses the configuration in buf and merges the files that it includes.
+// Relative paths of included files are relative to dir.
+// If dir is empty, e.g. for remote configurations, then only URLs can be included,
+// environment variables are not expanded and secrets cannot be read from files.
+func (l *loader) load(buf []byte, dir string) (*Config, error) {
+	buf, err := render(buf, dir == "")
+	if err != nil {
+		return nil, err
+	}
+	j, err := yaml.YAMLToJSON(buf)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read configuration YAML: %w", err)
+	}
+	c := new(Config)
+	if err := decode(j, l.strict, c); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	if dir == "" {
+		if err := c.checkFileSecrets(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, pattern := range c.Include {
+		if IsURL(pattern) {
+			f, err := l.loadPath(pattern)
+			if err != nil {
+				return nil, err
+			}
+			if err := c.merge(f); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if dir == "" {
+			return nil, fmt.Errorf("cannot include %q: remote configurations can only include URLs", pattern)
+		}
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid include pattern %q: %w", pattern, err)
+		}
+		// Patterns without wildcards name a file that must exist.
+		if len(matches) == 0 && !strings.ContainsAny(pattern, `*?[\`) {
+			matches = []string{pattern}
+		}
+		for _, m := range matches {
+			f, err := l.loadPath(m)
+			if err != nil {
+				return nil, err
+			}
+			if err := c.merge(f); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return c, nil
+}
+
+// decode migrates the JSON configuration in buf to the current version and decodes it into c.
+// If strict is true, then unknown fields are rejected.
+func decode(buf []byte, strict bool, c *Config) error {
+	buf, err := migrate(buf)
+	if err != nil {
+		return err
+	}
+	if strict {
+		return decodeStrict(buf, c)
+	}
+	return json.Unmarshal(buf, c)
+}
+
+// merge appends the sources, destinations and workflows of f to the configuration.
+// The encryption, the defaults, the max transfers and the plugins may only be set by one of the files.
+func (c *Config) merge(f *Config) error {
+	// Every file was migrated to the current version.
+	c.Version = f.Version
+	if f.Encryption != nil {
+		if c.Encryption != nil {
+			return errors.New("encryption is configured more than once")
+		}
+		c.Encryption = f.Encryption
+	}
+	if f.Defaults != nil {
+		if c.Defaults != nil {
+			return errors.New("defaults are configured more than once")
+		}
+		c.Defaults = f.Defaults
+	}
+	if f.MaxTransfers != 0 {
+		if c.MaxTransfers != 0 {
+			return errors.New("max transfers are configured more than once")
+		}
+		c.MaxTransfers = f.MaxTransfers
+	}
+	if f.Plugins != nil {
+		if c.Plugins != nil {
+			return errors.New("plugins are configured more than once")
+		}
+		c.Plugins = f.Plugins
+	}
+	c.Sources = append(c.Sources, f.Sources...)
+	c.Destinations = append(c.Destinations, f.Destinations...)
+	c.Workflows = append(c.Workflows, f.Workflows...)
+	c.Credentials = append(c.Credentials, f.Credentials...)
+	return nil
+}
+
+// checkFileSecrets rejects references to secrets in files in the configurations of the plugins,
+// because a remote configuration must not make ingest send local files to its plugins.
+func (c *Config) checkFileSecrets() error {
+	for _, s := range c.Sources {
+		if err := checkFileSecrets(s.Config); err != nil {
+			return fmt.Errorf("source %q: %w", s.Name, err)
+		}
+	}
+	for _, d := range c.Destinations {
+		if err := checkFileSecrets(d.Config); err != nil {
+			return fmt.Errorf("destination %q: %w", d.Name, err)
+		}
+	}
+	for _, cr := range c.Credentials {
+		if err := checkFileSecrets(cr.Config); err != nil {
+			return fmt.Errorf("credentials %q: %w", cr.Name, err)
+		}
+	}
+	return nil
+}
+
+func checkFileSecrets(v any) error {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, v := range t {
+			if len(k) > len(secret.FileSuffix) && strings.HasSuffix(k, secret.FileSuffix) {
+				return fmt.Errorf("%s: remote configurations cannot read secrets from files", k)
+			}
+			if err := checkFileSecrets(v); err != nil {
+				return fmt.Errorf("%s: %w", k, err)
+			}
+		}
+	case []any:
+		for i := range t {
+			if err := checkFileSecrets(t[i]); err != nil {
+				return fmt.Errorf("%d: %w", i, err)
+			}
+		}
+	case string:
+		if strings.HasPrefix(t, secret.FilePrefix) {
+			return errors.New("remote configurations cannot read secrets from files")
+		}
+	}
+	return nil
+}
+
+func isYAML(name string) bool {
+	ext := filepath.Ext(name)
+	return ext == ".yaml" || ext == ".yml"
+}
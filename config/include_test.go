@@ -0,0 +1,156 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewFromPath(t *testing.T) {
+	write := func(t *testing.T, path, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o700))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+	names := func(c *Config) (sources, destinations, workflows []string) {
+		for _, s := range c.Sources {
+			sources = append(sources, s.Name)
+		}
+		for _, d := range c.Destinations {
+			destinations = append(destinations, d.Name)
+		}
+		for _, w := range c.Workflows {
+			workflows = append(workflows, w.Name)
+		}
+		return
+	}
+
+	t.Run("directory", func(t *testing.T) {
+		dir := t.TempDir()
+		write(t, filepath.Join(dir, "b.yaml"), `
+sources:
+- name: foo_2
+  type: s3
+workflows:
+- name: foo_2-bar_1
+  source: foo_2
+`)
+		write(t, filepath.Join(dir, "a.yml"), `
+version: v1
+sources:
+- name: foo_1
+  type: s3
+destinations:
+- name: bar_1
+  type: s3
+`)
+		write(t, filepath.Join(dir, "README.md"), "not a configuration")
+		write(t, filepath.Join(dir, "nested", "c.yaml"), "not: included")
+
+		c, err := NewFromPath(dir, nil)
+		require.NoError(t, err)
+		sources, destinations, workflows := names(c)
+		assert.Equal(t, CurrentVersion, c.Version)
+		assert.Equal(t, []string{"foo_1", "foo_2"}, sources)
+		assert.Equal(t, []string{"bar_1"}, destinations)
+		assert.Equal(t, []string{"foo_2-bar_1"}, workflows)
+	})
+
+	t.Run("include", func(t *testing.T) {
+		dir := t.TempDir()
+		write(t, filepath.Join(dir, "config"), `
+include:
+- destinations.yaml
+- teams/*.yaml
+- missing/*.yaml
+encryption:
+  key: $INGEST_ENCRYPTION_KEY
+sources:
+- name: foo_1
+  type: s3
+`)
+		write(t, filepath.Join(dir, "destinations.yaml"), `
+destinations:
+- name: bar_1
+  type: s3
+`)
+		write(t, filepath.Join(dir, "teams", "a.yaml"), `
+include:
+- ../sources
+workflows:
+- name: foo_1-bar_1
+  source: foo_1
+`)
+		write(t, filepath.Join(dir, "sources", "foo_2.yaml"), `
+sources:
+- name: foo_2
+  type: s3
+`)
+
+		c, err := NewFromPath(filepath.Join(dir, "config"), nil)
+		require.NoError(t, err)
+		sources, destinations, workflows := names(c)
+		assert.Equal(t, []string{"foo_1", "foo_2"}, sources)
+		assert.Equal(t, []string{"bar_1"}, destinations)
+		assert.Equal(t, []string{"foo_1-bar_1"}, workflows)
+		assert.NotNil(t, c.Encryption)
+	})
+
+	for _, tc := range []struct {
+		name  string
+		files map[string]string
+	}{
+		{
+			name: "cycle",
+			files: map[string]string{
+				"config": "include: [b.yaml]",
+				"b.yaml": "include: [config]",
+			},
+		},
+		{
+			name: "missing file",
+			files: map[string]string{
+				"config": "include: [missing.yaml]",
+			},
+		},
+		{
+			name: "encryption configured twice",
+			files: map[string]string{
+				"config": "{include: [b.yaml], encryption: {key: foo}}",
+				"b.yaml": "encryption: {key: bar}",
+			},
+		},
+		{
+			name: "defaults configured twice",
+			files: map[string]string{
+				"config": "{include: [b.yaml], defaults: {batchSize: 1}}",
+				"b.yaml": "defaults: {batchSize: 2}",
+			},
+		},
+		{
+			name: "max transfers configured twice",
+			files: map[string]string{
+				"config": "{include: [b.yaml], maxTransfers: 1}",
+				"b.yaml": "maxTransfers: 2",
+			},
+		},
+		{
+			name: "unsupported version",
+			files: map[string]string{
+				"config": "{include: [b.yaml], version: v1}",
+				"b.yaml": "version: v0",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tc.files {
+				write(t, filepath.Join(dir, name), content)
+			}
+			_, err := NewFromPath(filepath.Join(dir, "config"), nil)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// kubernetesPrefix is the prefix of URLs that select ConfigMaps in a Kubernetes namespace,
+	// e.g. k8s://ingest?selector=team%3Ddata.
+	kubernetesPrefix = "k8s://"
+	// DefaultKubernetesSelector selects the ConfigMaps that hold configuration files
+	// if the URL does not give a selector.
+	DefaultKubernetesSelector = "ingest.connylabs.io/config=true"
+	// serviceAccountDir holds the credentials of the service account of a pod.
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+)
+
+// kubernetesClient reads ConfigMaps from the API server of a Kubernetes cluster.
+type kubernetesClient struct {
+	host      string
+	token     string
+	namespace string
+	c         *http.Client
+}
+
+// newKubernetesClient creates a client for the cluster in which the process runs.
+// It is a variable, so that tests can replace the cluster.
+var newKubernetesClient = func() (*kubernetesClient, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in a Kubernetes cluster: KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT must be set")
+	}
+	token, err := os.ReadFile(filepath.Join(serviceAccountDir, "token"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account token: %w", err)
+	}
+	namespace, err := os.ReadFile(filepath.Join(serviceAccountDir, "namespace"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account namespace: %w", err)
+	}
+	ca, err := os.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cluster CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("invalid cluster CA")
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	return &kubernetesClient{
+		host:      "https://" + net.JoinHostPort(host, port),
+		token:     strings.TrimSpace(string(token)),
+		namespace: strings.TrimSpace(string(namespace)),
+		c:         &http.Client{Transport: t},
+	}, nil
+}
+
+// document is a configuration file in a ConfigMap.
+type document struct {
+	name string
+	data []byte
+}
+
+// fetchConfigMaps reads the YAML files in the ConfigMaps that the k8s:// URL selects.
+// The host of the URL names the namespace, which defaults to the namespace of the pod,
+// and the query parameter selector is a label selector, which defaults to DefaultKubernetesSelector.
+// The files are ordered by the names of their ConfigMaps and keys.
+func fetchConfigMaps(ctx context.Context, u *url.URL) ([]document, error) {
+	k, err := newKubernetesClient()
+	if err != nil {
+		return nil, err
+	}
+	namespace := u.Host
+	if namespace == "" {
+		namespace = k.namespace
+	}
+	selector := u.Query().Get("selector")
+	if selector == "" {
+		selector = DefaultKubernetesSelector
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/api/v1/namespaces/%s/configmaps?%s", k.host, url.PathEscape(namespace), url.Values{"labelSelector": {selector}}.Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+k.token)
+	req.Header.Set("Accept", "application/json")
+	res, err := k.c.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ConfigMaps: %w", err)
+	}
+	defer res.Body.Close()
+	buf, err := io.ReadAll(io.LimitReader(res.Body, maxRemoteSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ConfigMaps: %w", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to list ConfigMaps in namespace %q: unexpected status code %d: %s", namespace, res.StatusCode, bytes.TrimSpace(buf))
+	}
+	if len(buf) > maxRemoteSize {
+		return nil, fmt.Errorf("ConfigMaps exceed %d bytes", maxRemoteSize)
+	}
+	var list struct {
+		Items []struct {
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+			Data map[string]string `json:"data"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(buf, &list); err != nil {
+		return nil, fmt.Errorf("failed to decode ConfigMaps: %w", err)
+	}
+	var docs []document
+	for _, cm := range list.Items {
+		for k, v := range cm.Data {
+			if !isYAML(k) {
+				continue
+			}
+			docs = append(docs, document{name: fmt.Sprintf("configmap %s/%s/%s", namespace, cm.Metadata.Name, k), data: []byte(v)})
+		}
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i].name < docs[j].name })
+	return docs, nil
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewFromKubernetes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		selector := r.URL.Query().Get("labelSelector")
+		switch {
+		case r.URL.Path == "/api/v1/namespaces/ingest/configmaps" && selector == DefaultKubernetesSelector:
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"items": []interface{}{
+					map[string]interface{}{
+						"metadata": map[string]interface{}{"name": "team-b"},
+						"data": map[string]string{
+							"workflows.yaml": "workflows: [{name: foo-bar, source: foo, destinations: [bar]}]",
+							"README":         "not a configuration",
+						},
+					},
+					map[string]interface{}{
+						"metadata": map[string]interface{}{"name": "team-a"},
+						"data": map[string]string{
+							"plugins.yaml": "{sources: [{name: foo, type: s3}], destinations: [{name: bar, type: s3}]}",
+						},
+					},
+				},
+			})
+		case r.URL.Path == "/api/v1/namespaces/other/configmaps" && selector == "team=c":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"items": []interface{}{
+					map[string]interface{}{
+						"metadata": map[string]interface{}{"name": "team-c"},
+						"data":     map[string]string{"config.yaml": "{include: [local.yaml]}"},
+					},
+				},
+			})
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer srv.Close()
+	newKubernetesClient = func() (*kubernetesClient, error) {
+		return &kubernetesClient{host: srv.URL, token: "token", namespace: "ingest", c: srv.Client()}, nil
+	}
+	t.Cleanup(func() { newKubernetesClient = nil })
+
+	c, err := NewFromPath("k8s://", nil)
+	require.NoError(t, err)
+	require.Len(t, c.Sources, 1)
+	require.Len(t, c.Workflows, 1)
+	assert.Equal(t, "foo-bar", c.Workflows[0].Name)
+
+	buf, err := Fetch(context.Background(), "k8s://ingest")
+	require.NoError(t, err)
+	assert.Equal(t, `---
+# configmap ingest/team-a/plugins.yaml
+{sources: [{name: foo, type: s3}], destinations: [{name: bar, type: s3}]}
+---
+# configmap ingest/team-b/workflows.yaml
+workflows: [{name: foo-bar, source: foo, destinations: [bar]}]
+`, string(buf))
+
+	// ConfigMaps cannot include local files.
+	_, err = NewFromPath("k8s://other?selector=team%3Dc", nil)
+	assert.ErrorContains(t, err, "configmap other/team-c/config.yaml")
+
+	_, err = NewFromPath("k8s://forbidden", nil)
+	assert.ErrorContains(t, err, "unexpected status code 403")
+}
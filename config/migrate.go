@@ -0,0 +1,100 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// CurrentVersion is the current version of the configuration format.
+// Configurations of older versions are migrated to it when they are read.
+const CurrentVersion = "v2"
+
+// defaultVersion is the version of configurations that do not set one.
+const defaultVersion = "v1"
+
+// migrations upgrade configurations from one version of the configuration format to the next.
+var migrations = []struct {
+	from, to string
+	migrate  func(map[string]interface{}) error
+}{
+	{"v1", "v2", migrateV1},
+}
+
+// migrate upgrades the JSON configuration in buf to the current version.
+func migrate(buf []byte) ([]byte, error) {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(buf, &raw); err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		// The configuration is empty.
+		raw = make(map[string]interface{})
+	}
+	v, ok := raw["version"].(string)
+	if rv, set := raw["version"]; set && !ok {
+		return nil, fmt.Errorf("version must be a string, got %v", rv)
+	}
+	if v == "" {
+		v = defaultVersion
+	}
+	if v == CurrentVersion {
+		return buf, nil
+	}
+next:
+	for v != CurrentVersion {
+		for _, m := range migrations {
+			if m.from != v {
+				continue
+			}
+			if err := m.migrate(raw); err != nil {
+				return nil, fmt.Errorf("failed to migrate configuration from version %s to %s: %w", m.from, m.to, err)
+			}
+			v = m.to
+			continue next
+		}
+		return nil, fmt.Errorf("unsupported configuration version %q", v)
+	}
+	raw["version"] = CurrentVersion
+	return json.Marshal(raw)
+}
+
+// migrateV1 moves the fields of sources, destinations and credentials that are passed to plugins,
+// which v1 inlines, into their config fields.
+func migrateV1(raw map[string]interface{}) error {
+	for _, m := range []struct {
+		key    string
+		fields []string
+	}{
+		{"sources", []string{"name", "type", "explodeArchives", "credentials", "timeouts", "maxInstances"}},
+		{"destinations", []string{"name", "type", "archive", "dedup", "credentials", "timeouts", "maxInstances"}},
+		{"credentials", []string{"name"}},
+	} {
+		l, ok := raw[m.key].([]interface{})
+		if !ok {
+			continue
+		}
+		for i := range l {
+			p, ok := l[i].(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%s[%d] must be an object", m.key, i)
+			}
+			config := make(map[string]interface{})
+		field:
+			for k, v := range p {
+				// v1 matches the names of fields case-insensitively.
+				for _, f := range m.fields {
+					if strings.EqualFold(k, f) {
+						continue field
+					}
+				}
+				config[k] = v
+				delete(p, k)
+			}
+			if len(config) != 0 {
+				p["config"] = config
+			}
+		}
+	}
+	return nil
+}
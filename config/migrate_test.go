@@ -0,0 +1,102 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrate(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		config string
+		out    string
+		err    bool
+	}{
+		{
+			name:   "empty",
+			config: "null",
+			out:    `{"version":"v2"}`,
+		},
+		{
+			name:   "v1",
+			config: `{"sources":[{"name":"foo","type":"s3","explodeArchives":true,"bucket":"foo"}],"destinations":[{"name":"bar","type":"fs","archive":{},"directory":"/data"}],"credentials":[{"name":"aws","accessKeyID":"key"}],"workflows":[{"name":"foo-bar","source":"foo"}]}`,
+			out:    `{"credentials":[{"config":{"accessKeyID":"key"},"name":"aws"}],"destinations":[{"archive":{},"config":{"directory":"/data"},"name":"bar","type":"fs"}],"sources":[{"config":{"bucket":"foo"},"explodeArchives":true,"name":"foo","type":"s3"}],"version":"v2","workflows":[{"name":"foo-bar","source":"foo"}]}`,
+		},
+		{
+			name:   "v1 fields in another case",
+			config: `{"version":"v1","sources":[{"Name":"foo","type":"s3","explodearchives":true}]}`,
+			out:    `{"sources":[{"Name":"foo","explodearchives":true,"type":"s3"}],"version":"v2"}`,
+		},
+		{
+			name:   "v2",
+			config: `{"version":"v2","sources":[{"name":"foo","type":"s3","bucket":"foo"}]}`,
+			out:    `{"version":"v2","sources":[{"name":"foo","type":"s3","bucket":"foo"}]}`,
+		},
+		{
+			name:   "unsupported version",
+			config: `{"version":"v0"}`,
+			err:    true,
+		},
+		{
+			name:   "invalid version",
+			config: `{"version":2}`,
+			err:    true,
+		},
+		{
+			name:   "invalid source",
+			config: `{"sources":["foo"]}`,
+			err:    true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := migrate([]byte(tc.config))
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.out, string(out))
+		})
+	}
+}
+
+func TestNewV2(t *testing.T) {
+	v1, err := New([]byte(`
+sources:
+- name: foo
+  type: s3
+  bucket: foo
+destinations:
+- name: bar
+  type: fs
+  directory: /data
+`), nil)
+	require.NoError(t, err)
+	v2, err := New([]byte(`
+version: v2
+sources:
+- name: foo
+  type: s3
+  config:
+    bucket: foo
+destinations:
+- name: bar
+  type: fs
+  config:
+    directory: /data
+`), nil)
+	require.NoError(t, err)
+	assert.Equal(t, v1.Sources, v2.Sources)
+	assert.Equal(t, v1.Destinations, v2.Destinations)
+	assert.Equal(t, CurrentVersion, v1.Version)
+
+	// Fields of v1 are unknown in v2.
+	path := filepath.Join(t.TempDir(), "config")
+	require.NoError(t, os.WriteFile(path, []byte("{version: v2, sources: [{name: foo, type: s3, bucket: foo}]}"), 0o600))
+	_, err = NewFromPathStrict(path, nil)
+	assert.Error(t, err)
+}
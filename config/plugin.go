@@ -1,12 +1,33 @@
 package config
 
-import "github.com/connylabs/ingest/plugin"
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/archive"
+	"github.com/connylabs/ingest/dedup"
+	"github.com/connylabs/ingest/plugin"
+	"github.com/connylabs/ingest/storage"
+)
 
 // SourceTyper implements the plugin.Source interface and exposes an additional method
 // to determine the kind of plugin that is wrapped.
 type SourceTyper struct {
 	plugin.Source
 	t string
+	// p is the plugin that the source wraps as it was returned by the plugin manager.
+	p plugin.Source
 }
 
 // Type exposes the kind of plugin.
@@ -14,14 +35,312 @@ func (st *SourceTyper) Type() string {
 	return st.t
 }
 
+// Plugin returns the plugin that the source wraps as it was returned by the plugin manager.
+func (st *SourceTyper) Plugin() plugin.Source {
+	return st.p
+}
+
+// NextN lists a page of elements with the plugin if it implements ingest.BatchNexter.
+func (st *SourceTyper) NextN(ctx context.Context, n int) ([]ingest.Codec, error) {
+	return ingest.NextN(ctx, st.Source, n)
+}
+
+// Locate locates the object with the plugin if it implements ingest.Locator.
+// Sources that explode archives return ingest.ErrLocateNotSupported, since their objects are members of archives.
+func (st *SourceTyper) Locate(ctx context.Context, c ingest.Codec) (*url.URL, error) {
+	return ingest.Locate(ctx, st.Source, c)
+}
+
 // DestinationTyper implements the plugin.Typer interface and exposes an additional method
 // to determine the kind of plugin that is wrapped.
 type DestinationTyper struct {
 	plugin.Destination
 	t string
+	// p is the plugin that the destination wraps as it was returned by the plugin manager.
+	p plugin.Destination
 }
 
 // Type exposes the kind of plugin.
 func (dt *DestinationTyper) Type() string {
 	return dt.t
 }
+
+// Plugin returns the plugin that the destination wraps as it was returned by the plugin manager.
+func (dt *DestinationTyper) Plugin() plugin.Destination {
+	return dt.p
+}
+
+// CopyFrom copies the object with the plugin if it implements storage.Copier.
+// Destinations that deduplicate or archive objects return storage.ErrCopyNotImplemented,
+// since they must read the content of the objects.
+func (dt *DestinationTyper) CopyFrom(ctx context.Context, c ingest.Codec, uri *url.URL) (*url.URL, error) {
+	return storage.CopyFrom(ctx, dt.Destination, c, uri)
+}
+
+// Release kills the plugins of the given sources and destinations that were configured by a Config
+// and that are not part of the sources and destinations to keep, e.g. after a reconfiguration.
+// Plugins that destinations to keep share with released destinations keep running.
+func Release(pm *plugin.PluginManager, sources, keepSources map[string]plugin.Source, destinations, keepDestinations map[string]plugin.Destination) {
+	for n, s := range sources {
+		if st, ok := s.(*SourceTyper); ok && keepSources[n] != s {
+			pm.Kill(st.p)
+		}
+	}
+	keep := make(map[plugin.Destination]struct{})
+	for _, d := range keepDestinations {
+		if dt, ok := d.(*DestinationTyper); ok {
+			keep[dt.p] = struct{}{}
+		}
+	}
+	for n, d := range destinations {
+		if dt, ok := d.(*DestinationTyper); ok && keepDestinations[n] != d {
+			if _, ok := keep[dt.p]; ok {
+				continue
+			}
+			// Destinations that share a plugin kill it once.
+			keep[dt.p] = struct{}{}
+			pm.Kill(dt.p)
+		}
+	}
+}
+
+// pluginStartConcurrency is the maximum number of plugins that are started and configured at the same time.
+const pluginStartConcurrency = 8
+
+// startedPlugins are the sources and destinations that startPlugins started by their names
+// and the errors of the ones that it could not start.
+type startedPlugins struct {
+	sources           map[string]plugin.Source
+	destinations      map[string]plugin.Destination
+	sourceErrors      map[string]error
+	destinationErrors map[string]error
+}
+
+// err returns the errors of all sources and destinations that could not be started in the order of the configuration.
+func (sp *startedPlugins) err(c *Config) error {
+	var errs *multierror.Error
+	for _, s := range c.Sources {
+		if err, ok := sp.sourceErrors[s.Name]; ok {
+			errs = multierror.Append(errs, fmt.Errorf("cannot instantiate source %q: %w", s.Name, err))
+		}
+	}
+	for _, d := range c.Destinations {
+		if err, ok := sp.destinationErrors[d.Name]; ok {
+			errs = multierror.Append(errs, fmt.Errorf("cannot instantiate destination %q: %w", d.Name, err))
+		}
+	}
+	return errs.ErrorOrNil()
+}
+
+// startPlugins starts and configures the plugins of the sources and destinations concurrently,
+// at most pluginStartConcurrency at a time, because the plugins of large configurations take minutes to start one by one.
+// The sources and destinations are given by their indices and mapped to the largest concurrency of the workflows that use them.
+func (c *Config) startPlugins(pm *plugin.PluginManager, pluginPaths map[string]string, sources, destinations map[int]int) *startedPlugins {
+	sp := &startedPlugins{
+		sources:           make(map[string]plugin.Source),
+		destinations:      make(map[string]plugin.Destination),
+		sourceErrors:      make(map[string]error),
+		destinationErrors: make(map[string]error),
+	}
+	var mu sync.Mutex
+	slots := make(chan struct{}, pluginStartConcurrency)
+	g := multierror.Group{}
+	for i, concurrency := range sources {
+		s, concurrency := c.Sources[i], concurrency
+		slots <- struct{}{}
+		g.Go(func() error {
+			defer func() { <-slots }()
+			st, err := s.start(pm, pluginPaths[s.Type], concurrency)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				sp.sourceErrors[s.Name] = err
+				return nil
+			}
+			sp.sources[s.Name] = st
+			return nil
+		})
+	}
+	for _, group := range c.shareDestinations(destinations) {
+		group := group
+		slots <- struct{}{}
+		g.Go(func() error {
+			defer func() { <-slots }()
+			dts, errs := group.start(pm, pluginPaths[group.destinations[0].Type])
+			mu.Lock()
+			defer mu.Unlock()
+			for i, d := range group.destinations {
+				if errs[i] != nil {
+					sp.destinationErrors[d.Name] = errs[i]
+					continue
+				}
+				sp.destinations[d.Name] = dts[i]
+			}
+			return nil
+		})
+	}
+	// None of the go routines in the group return errors.
+	g.Wait() //nolint:errcheck
+	return sp
+}
+
+// instances returns the number of instances of a plugin, which is at most the concurrency of the workflows that use it.
+func instances(maxInstances, concurrency int) (int, error) {
+	if maxInstances < 0 {
+		return 0, errors.New("max instances must not be negative")
+	}
+	if maxInstances > concurrency {
+		return concurrency, nil
+	}
+	return maxInstances, nil
+}
+
+// start starts and configures the plugin of the source for workflows with the given concurrency.
+func (s Source) start(pm *plugin.PluginManager, path string, concurrency int) (plugin.Source, error) {
+	t, err := s.Timeouts.timeouts()
+	if err != nil {
+		return nil, fmt.Errorf("invalid timeouts: %w", err)
+	}
+	n, err := instances(s.MaxInstances, concurrency)
+	if err != nil {
+		return nil, err
+	}
+	p, err := pm.NewSourceWithOptions(path, s.Config, prometheus.Labels{
+		"component": "source",
+		"plugin":    s.Type,
+		"name":      s.Name,
+	}, plugin.Options{Timeouts: t, Instances: n})
+	if err != nil {
+		return nil, err
+	}
+	ss := p
+	if s.ExplodeArchives {
+		ss = archive.NewSource(ss)
+	}
+	return &SourceTyper{Source: ss, t: s.Type, p: p}, nil
+}
+
+// destinationGroup are destinations with identical plugin configurations, which share the processes of their plugin.
+type destinationGroup struct {
+	destinations []Destination
+	// concurrency is the largest concurrency of the workflows of the destinations.
+	concurrency int
+}
+
+// shareDestinations groups the destinations that are given by their indices and mapped to the largest concurrency
+// of the workflows that use them by the keys of their plugin configurations in the order of the configuration.
+// Sources are not shared, since the plugin of a source holds the state of its listing,
+// which sources with identical configurations would reset and advance for each other.
+func (c *Config) shareDestinations(destinations map[int]int) []*destinationGroup {
+	indices := make([]int, 0, len(destinations))
+	for i := range destinations {
+		indices = append(indices, i)
+	}
+	sort.Ints(indices)
+	var groups []*destinationGroup
+	byKey := make(map[string]*destinationGroup)
+	for _, i := range indices {
+		d := c.Destinations[i]
+		k := d.key()
+		g, ok := byKey[k]
+		if !ok {
+			g = &destinationGroup{}
+			byKey[k] = g
+			groups = append(groups, g)
+		}
+		g.destinations = append(g.destinations, d)
+		if destinations[i] > g.concurrency {
+			g.concurrency = destinations[i]
+		}
+	}
+	return groups
+}
+
+// start starts and configures the plugin of the destinations once, labeled with the name of the first valid destination,
+// and returns the destinations or the errors of the destinations that could not be started by the positions of the destinations.
+func (g *destinationGroup) start(pm *plugin.PluginManager, path string) ([]plugin.Destination, []error) {
+	dts := make([]plugin.Destination, len(g.destinations))
+	errs := make([]error, len(g.destinations))
+	opts := make([]archive.DestinationOptions, len(g.destinations))
+	valid := -1
+	for i, d := range g.destinations {
+		if d.Archive != nil {
+			if opts[i], errs[i] = d.Archive.options(d.Name); errs[i] != nil {
+				continue
+			}
+		}
+		if valid < 0 {
+			valid = i
+		}
+	}
+	if valid < 0 {
+		return dts, errs
+	}
+	p, err := g.destinations[valid].start(pm, path, g.concurrency)
+	for i, d := range g.destinations {
+		if errs[i] != nil {
+			continue
+		}
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		dt, werr := d.wrap(p, opts[i])
+		if werr != nil {
+			errs[i] = werr
+			continue
+		}
+		dts[i] = dt
+	}
+	return dts, errs
+}
+
+// key identifies the plugin configuration of the destination.
+// Destinations with the same key share the processes of their plugin, since their names, deduplication and archives
+// are implemented outside of the plugin.
+func (d Destination) key() string {
+	buf, err := json.Marshal(struct {
+		Type         string
+		Timeouts     *DestinationTimeouts
+		MaxInstances int
+		Config       map[string]interface{}
+	}{d.Type, d.Timeouts, d.MaxInstances, d.Config})
+	if err != nil {
+		// Destinations whose configurations cannot be compared have a plugin of their own.
+		return "destination:" + d.Name
+	}
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:])
+}
+
+// start starts and configures the plugin of the destination for workflows with the given concurrency.
+func (d Destination) start(pm *plugin.PluginManager, path string, concurrency int) (plugin.Destination, error) {
+	t, err := d.Timeouts.timeouts()
+	if err != nil {
+		return nil, fmt.Errorf("invalid timeouts: %w", err)
+	}
+	n, err := instances(d.MaxInstances, concurrency)
+	if err != nil {
+		return nil, err
+	}
+	return pm.NewDestinationWithOptions(path, d.Config, prometheus.Labels{
+		"component": "destination",
+		"plugin":    d.Type,
+		"name":      d.Name,
+	}, plugin.Options{Timeouts: t, Instances: n})
+}
+
+// wrap adds the deduplication and the archive of the destination to its plugin.
+func (d Destination) wrap(p plugin.Destination, o archive.DestinationOptions) (*DestinationTyper, error) {
+	dd := p
+	if d.Dedup != nil {
+		dd = dedup.NewDestination(dd, d.Dedup.BlobPrefix, d.Dedup.PointerPrefix)
+	}
+	if d.Archive != nil {
+		var err error
+		if dd, err = archive.NewDestination(dd, o); err != nil {
+			return nil, fmt.Errorf("failed to create archive: %w", err)
+		}
+	}
+	return &DestinationTyper{Destination: dd, t: d.Type, p: p}, nil
+}
@@ -0,0 +1,132 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+const (
+	// fetchTimeout is the maximum duration of fetching a remote configuration.
+	fetchTimeout = 30 * time.Second
+	// maxRemoteSize is the maximum size of a remote configuration.
+	maxRemoteSize     = 10 << 20
+	defaultS3Endpoint = "s3.amazonaws.com"
+)
+
+// IsURL checks whether the path is the URL of a remote configuration,
+// e.g. https://example.com/ingest.yaml, s3://bucket/ingest.yaml or k8s://namespace.
+func IsURL(path string) bool {
+	for _, p := range []string{"http://", "https://", "s3://", kubernetesPrefix} {
+		if strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Fetch reads the remote configuration at the URL.
+// HTTP URLs may contain basic authentication credentials.
+// S3 URLs name the bucket and the key of the object, e.g. s3://bucket/ingest.yaml,
+// and accept the query parameters endpoint, region and insecure, e.g. s3://bucket/ingest.yaml?endpoint=minio:9000&insecure=true.
+// The credentials for S3 are read from the environment, the shared credentials file or the IAM role of the instance.
+// For k8s:// URLs, which select ConfigMaps in a namespace of the Kubernetes cluster in which the process runs,
+// Fetch returns the configuration files in the ConfigMaps as a stream of YAML documents.
+func Fetch(ctx context.Context, rawURL string) ([]byte, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration URL: %w", err)
+	}
+	var r io.ReadCloser
+	switch u.Scheme {
+	case "http", "https":
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch configuration: %w", err)
+		}
+		if res.StatusCode != http.StatusOK {
+			res.Body.Close()
+			return nil, fmt.Errorf("failed to fetch configuration: unexpected status code %d", res.StatusCode)
+		}
+		r = res.Body
+	case "s3":
+		if r, err = fetchS3(ctx, u); err != nil {
+			return nil, fmt.Errorf("failed to fetch configuration: %w", err)
+		}
+	case "k8s":
+		docs, err := fetchConfigMaps(ctx, u)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch configuration: %w", err)
+		}
+		var buf bytes.Buffer
+		for _, d := range docs {
+			fmt.Fprintf(&buf, "---\n# %s\n%s\n", d.name, d.data)
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unsupported configuration URL scheme %q", u.Scheme)
+	}
+	defer r.Close()
+	buf, err := io.ReadAll(io.LimitReader(r, maxRemoteSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration: %w", err)
+	}
+	if len(buf) > maxRemoteSize {
+		return nil, fmt.Errorf("configuration exceeds %d bytes", maxRemoteSize)
+	}
+	return buf, nil
+}
+
+func fetchS3(ctx context.Context, u *url.URL) (io.ReadCloser, error) {
+	q := u.Query()
+	endpoint := q.Get("endpoint")
+	if endpoint == "" {
+		endpoint = defaultS3Endpoint
+	}
+	var insecure bool
+	if v := q.Get("insecure"); v != "" {
+		var err error
+		if insecure, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("invalid insecure parameter: %w", err)
+		}
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || key == "" {
+		return nil, fmt.Errorf("S3 URL %q must name a bucket and a key", u.Redacted())
+	}
+	mc, err := minio.New(endpoint, &minio.Options{
+		Creds: credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.FileAWSCredentials{},
+			&credentials.IAM{Client: &http.Client{Transport: http.DefaultTransport}},
+		}),
+		Secure: !insecure,
+		Region: q.Get("region"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	o, err := mc.GetObject(ctx, u.Host, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	// GetObject only sends the request when the object is read.
+	if _, err := o.Stat(); err != nil {
+		o.Close()
+		return nil, err
+	}
+	return o, nil
+}
@@ -0,0 +1,125 @@
+package config
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/config":
+			w.Write([]byte("version: v1"))
+		case "/large":
+			w.Write([]byte(strings.Repeat("#", maxRemoteSize+1)))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	buf, err := Fetch(context.Background(), srv.URL+"/config")
+	require.NoError(t, err)
+	assert.Equal(t, "version: v1", string(buf))
+
+	for _, u := range []string{srv.URL + "/missing", srv.URL + "/large", "ftp://example.com/config", "s3://bucket"} {
+		_, err := Fetch(context.Background(), u)
+		assert.Error(t, err, u)
+	}
+}
+
+func TestNewFromURL(t *testing.T) {
+	files := map[string]string{
+		"/config": `
+include:
+- {{ .URL }}/workflows
+sources:
+- name: foo
+  type: s3
+destinations:
+- name: bar
+  type: s3
+`,
+		"/workflows": `
+workflows:
+- name: foo-bar
+  source: foo
+  destinations:
+  - bar
+`,
+		"/local": `
+include:
+- workflows.yaml
+`,
+		"/expand": `
+sources:
+- name: $INGEST_TEST_SECRET
+  type: s3
+`,
+		"/env": `
+sources:
+- name: {% env "INGEST_TEST_SECRET" %}
+  type: s3
+`,
+		"/file": `
+sources:
+- name: foo
+  type: s3
+  config:
+    secretAccessKey_file: /etc/passwd
+`,
+		"/file-prefix": `
+destinations:
+- name: bar
+  type: s3
+  config:
+    headers:
+    - file:///etc/passwd
+`,
+	}
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(strings.ReplaceAll(content, "{{ .URL }}", srv.URL)))
+	}))
+	defer srv.Close()
+
+	c, err := NewFromPath(srv.URL+"/config", nil)
+	require.NoError(t, err)
+	require.Len(t, c.Workflows, 1)
+	assert.Equal(t, "foo-bar", c.Workflows[0].Name)
+
+	// Remote configurations cannot include local files.
+	_, err = NewFromPath(srv.URL+"/local", nil)
+	assert.Error(t, err)
+
+	// Remote configurations cannot read the environment or local files.
+	t.Setenv("INGEST_TEST_SECRET", "secret")
+	c, err = NewFromPath(srv.URL+"/expand", nil)
+	require.NoError(t, err)
+	require.Len(t, c.Sources, 1)
+	assert.Equal(t, "$INGEST_TEST_SECRET", c.Sources[0].Name)
+	for _, path := range []string{"/env", "/file", "/file-prefix"} {
+		_, err = NewFromPath(srv.URL+path, nil)
+		assert.Error(t, err, path)
+	}
+
+	// Local configurations can include remote ones.
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config"), []byte("include: ["+srv.URL+"/config]"), 0o600))
+	c, err = NewFromPath(filepath.Join(dir, "config"), nil)
+	require.NoError(t, err)
+	assert.Len(t, c.Sources, 1)
+}
@@ -0,0 +1,150 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/ghodss/yaml"
+
+	"github.com/connylabs/ingest/secret"
+)
+
+// redacted replaces the values of secrets in rendered configurations.
+const redacted = "<redacted>"
+
+// sensitive matches the keys of plugin configurations whose values are redacted.
+var sensitive = regexp.MustCompile(`(?i)secret|password|passwd|token|credential|key`)
+
+// Render returns the configuration as YAML as ingest uses it,
+// i.e. with included files merged, environment variables expanded and defaults applied.
+// Secrets, i.e. the encryption keys and the values of plugin configurations whose keys look sensitive,
+// e.g. secretAccessKey, are redacted unless they reference a secret in a file or in a secret manager.
+func (c *Config) Render() ([]byte, error) {
+	r := *c
+	r.Include = nil
+	// The defaults were inherited by the workflows and the credentials by the sources and destinations.
+	r.Defaults = nil
+	r.Credentials = nil
+	r.Sources = make([]Source, len(c.Sources))
+	for i := range c.Sources {
+		r.Sources[i] = c.Sources[i]
+		r.Sources[i].Credentials = ""
+		r.Sources[i].Config = redact(c.Sources[i].Config, false)
+	}
+	r.Destinations = make([]Destination, len(c.Destinations))
+	for i := range c.Destinations {
+		r.Destinations[i] = c.Destinations[i]
+		r.Destinations[i].Credentials = ""
+		r.Destinations[i].Config = redact(c.Destinations[i].Config, false)
+	}
+	r.Workflows = make([]Workflow, len(c.Workflows))
+	for i := range c.Workflows {
+		r.Workflows[i] = c.Workflows[i]
+		r.Workflows[i].setDefaults()
+	}
+	if c.Encryption != nil {
+		e := Encryption{Key: redacted, PreviousKeys: make([]string, len(c.Encryption.PreviousKeys))}
+		for i := range e.PreviousKeys {
+			e.PreviousKeys[i] = redacted
+		}
+		r.Encryption = &e
+	}
+	v, err := renderValue(reflect.ValueOf(r))
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(v)
+}
+
+// renderValue converts v into maps, lists and scalars.
+// The fields of structs are named in camel case like in configuration files,
+// and empty fields are omitted.
+func renderValue(v reflect.Value) (interface{}, error) {
+	if m, ok := v.Interface().(json.Marshaler); ok {
+		buf, err := m.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		var i interface{}
+		return i, json.Unmarshal(buf, &i)
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return renderValue(v.Elem())
+	case reflect.Slice:
+		l := make([]interface{}, v.Len())
+		for i := range l {
+			var err error
+			if l[i], err = renderValue(v.Index(i)); err != nil {
+				return nil, err
+			}
+		}
+		return l, nil
+	case reflect.Map:
+		m := make(map[string]interface{}, v.Len())
+		for _, k := range v.MapKeys() {
+			e, err := renderValue(v.MapIndex(k))
+			if err != nil {
+				return nil, err
+			}
+			m[k.String()] = e
+		}
+		return m, nil
+	case reflect.Struct:
+		m := make(map[string]interface{})
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if !f.IsExported() || v.Field(i).IsZero() {
+				continue
+			}
+			e, err := renderValue(v.Field(i))
+			if err != nil {
+				return nil, err
+			}
+			m[strings.ToLower(f.Name[:1])+f.Name[1:]] = e
+		}
+		return m, nil
+	default:
+		return v.Interface(), nil
+	}
+}
+
+// redact returns a copy of the plugin configuration in which sensitive values are redacted.
+// If all is true, then all values are redacted.
+func redact(config map[string]interface{}, all bool) map[string]interface{} {
+	r := make(map[string]interface{}, len(config))
+	for k, v := range config {
+		// Keys like password_file hold the paths of files with secrets.
+		r[k] = redactValue(v, all || (sensitive.MatchString(k) && !strings.HasSuffix(k, secret.FileSuffix)))
+	}
+	return r
+}
+
+func redactValue(v interface{}, sensitive bool) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		return redact(t, sensitive)
+	case []interface{}:
+		l := make([]interface{}, len(t))
+		for i := range t {
+			l[i] = redactValue(t[i], sensitive)
+		}
+		return l
+	case string:
+		// References to secrets do not hold the secrets.
+		for _, p := range []string{secret.FilePrefix, secret.VaultPrefix, secret.AWSPrefix, secret.GCPPrefix} {
+			if strings.HasPrefix(t, p) {
+				return t
+			}
+		}
+	}
+	if sensitive {
+		return redacted
+	}
+	return v
+}
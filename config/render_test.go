@@ -0,0 +1,109 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRender(t *testing.T) {
+	t.Setenv("INGEST_BUCKET", "foo")
+	c, err := New([]byte(`
+defaults:
+  cleanUp: true
+encryption:
+  key: AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=
+  previousKeys:
+  - AgICAgICAgICAgICAgICAg==
+sources:
+- name: foo
+  type: s3
+  bucket: $INGEST_BUCKET
+  accessKeyID: key
+  secretAccessKey: vault:secret/data/s3#secretAccessKey
+  password_file: /run/secrets/password
+  secrets:
+    user: foo
+credentials:
+- name: account
+  region: eu-west-1
+  secretAccessKey: secret
+destinations:
+- name: bar
+  type: s3
+  credentials: account
+  token: secret
+  archive:
+    interval: 1m
+workflows:
+- name: foo-bar
+  source: foo
+  destinations:
+  - bar
+  batchSize: 4
+  consumer:
+    ackWait: 10m
+- name: foo-bar-nightly
+  source: foo
+  destinations:
+  - bar
+  schedule: 0 2 * * *
+  cleanUp: false
+`), nil)
+	require.NoError(t, err)
+	buf, err := c.Render()
+	require.NoError(t, err)
+	assert.Equal(t, `destinations:
+- archive:
+    interval: 1m0s
+  config:
+    region: eu-west-1
+    secretAccessKey: <redacted>
+    token: <redacted>
+  name: bar
+  type: s3
+encryption:
+  key: <redacted>
+  previousKeys:
+  - <redacted>
+sources:
+- config:
+    accessKeyID: <redacted>
+    bucket: foo
+    password_file: /run/secrets/password
+    secretAccessKey: vault:secret/data/s3#secretAccessKey
+    secrets:
+      user: <redacted>
+  name: foo
+  type: s3
+version: v2
+workflows:
+- batchSize: 4
+  cleanUp: true
+  concurrency: 4
+  consumer:
+    ackWait: 10m0s
+  destinations:
+  - bar
+  interval: 5m0s
+  name: foo-bar
+  source: foo
+- batchSize: 8
+  cleanUp: false
+  concurrency: 8
+  destinations:
+  - bar
+  name: foo-bar-nightly
+  schedule: 0 2 * * *
+  source: foo
+`, string(buf))
+
+	// Rendering does not modify the configuration.
+	assert.Nil(t, c.Workflows[0].Interval)
+	assert.Equal(t, "AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=", c.Encryption.Key)
+
+	// The rendered configuration can be read again.
+	_, err = New(buf, nil)
+	assert.NoError(t, err)
+}
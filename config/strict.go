@@ -0,0 +1,83 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// decodeStrict decodes the JSON configuration in buf and rejects unknown fields.
+// Unlike encoding/json, it also rejects fields whose case differs from the documented name,
+// e.g. batchsize instead of batchSize, because they are likely typos.
+func decodeStrict(buf []byte, c *Config) error {
+	var raw interface{}
+	if err := json.Unmarshal(buf, &raw); err != nil {
+		return err
+	}
+	if err := checkFields(raw, reflect.TypeOf(c).Elem(), ""); err != nil {
+		return err
+	}
+	d := json.NewDecoder(bytes.NewReader(buf))
+	d.DisallowUnknownFields()
+	return d.Decode(c)
+}
+
+// checkFields checks that the keys of the objects in v name the fields of t in camel case.
+// Values that do not have the type that t expects are left to the decoder.
+func checkFields(v interface{}, t reflect.Type, path string) error {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Slice:
+		l, ok := v.([]interface{})
+		if !ok {
+			return nil
+		}
+		for i := range l {
+			if err := checkFields(l[i], t.Elem(), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		fields := make(map[string]reflect.Type)
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() || f.Tag.Get("json") == "-" {
+				continue
+			}
+			fields[strings.ToLower(f.Name[:1])+f.Name[1:]] = f.Type
+		}
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			name := k
+			if path != "" {
+				name = path + "." + k
+			}
+			ft, ok := fields[k]
+			if !ok {
+				for f := range fields {
+					if strings.EqualFold(f, k) {
+						return fmt.Errorf("unknown field %q, did you mean %q?", name, f)
+					}
+				}
+				return fmt.Errorf("unknown field %q", name)
+			}
+			if err := checkFields(m[k], ft, name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
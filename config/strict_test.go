@@ -0,0 +1,98 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewFromPathStrict(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{
+			name: "valid",
+			config: `
+sources:
+- name: foo
+  type: s3
+  bucket: foo
+  accessKeyID: key
+destinations:
+- name: bar
+  type: s3
+workflows:
+- name: foo-bar
+  source: foo
+  destinations:
+  - bar
+  batchSize: 10
+  filters:
+    names:
+    - '*.csv'
+`,
+		},
+		{
+			name:   "unknown top-level field",
+			config: "workflow: []",
+			err:    `unknown field "workflow"`,
+		},
+		{
+			name: "unknown workflow field",
+			config: `
+workflows:
+- name: foo-bar
+  destination: bar
+`,
+			err: `unknown field "workflows[0].destination"`,
+		},
+		{
+			name: "workflow field with wrong case",
+			config: `
+workflows:
+- name: foo-bar
+  batchsize: 10
+`,
+			err: `unknown field "workflows[0].batchsize", did you mean "batchSize"?`,
+		},
+		{
+			name: "nested field with wrong case",
+			config: `
+workflows:
+- name: foo-bar
+  filters:
+    minsize: 10
+`,
+			err: `unknown field "workflows[0].filters.minsize", did you mean "minSize"?`,
+		},
+		{
+			name: "source field with wrong case",
+			config: `
+sources:
+- name: foo
+  type: s3
+  explodearchives: true
+`,
+			err: `unknown field "sources[0].explodearchives", did you mean "explodeArchives"?`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config")
+			require.NoError(t, os.WriteFile(path, []byte(tc.config), 0o600))
+			_, err := NewFromPathStrict(path, nil)
+			if tc.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tc.err)
+			// Without the strict mode, unknown fields are ignored.
+			_, err = NewFromPath(path, nil)
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// The configuration is a template with the delimiters {% and %}, because plugins
+// accept Go templates with the default delimiters in their configuration, e.g. {{.Name}}.
+const (
+	templateLeftDelim  = "{%"
+	templateRightDelim = "%}"
+)
+
+// templateFuncs are the functions that can be used in the configuration, so that
+// one configuration file can be reused across environments, e.g.
+// bucket: {% env "ENVIRONMENT" | default "dev" | lower %}-ingest.
+var templateFuncs = template.FuncMap{
+	"default":  defaultValue,
+	"env":      os.Getenv,
+	"join":     join,
+	"lower":    strings.ToLower,
+	"now":      time.Now,
+	"required": required,
+	"split":    split,
+}
+
+// remoteTemplateFuncs are the functions that can be used in remote configurations.
+// Remote configurations cannot read the environment of ingest, which holds its credentials.
+var remoteTemplateFuncs = template.FuncMap{
+	"env": func(string) (string, error) {
+		return "", errors.New("remote configurations cannot read environment variables")
+	},
+}
+
+// render expands the environment variables in the configuration and then executes it as a template.
+// Environment variables are expanded first, so that the configuration can keep using them,
+// which means that template variables, which start with $, cannot be used.
+// The environment variables of remote configurations are not expanded.
+func render(buf []byte, remote bool) ([]byte, error) {
+	funcs := templateFuncs
+	if remote {
+		funcs = remoteTemplateFuncs
+	} else {
+		buf = []byte(os.ExpandEnv(string(buf)))
+	}
+	t, err := template.New("config").Delims(templateLeftDelim, templateRightDelim).Funcs(templateFuncs).Funcs(funcs).Parse(string(buf))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse configuration template: %w", err)
+	}
+	var b bytes.Buffer
+	if err := t.Execute(&b, nil); err != nil {
+		return nil, fmt.Errorf("unable to execute configuration template: %w", err)
+	}
+	return b.Bytes(), nil
+}
+
+// defaultValue returns v if it is not empty and d otherwise.
+func defaultValue(d, v any) any {
+	if empty(v) {
+		return d
+	}
+	return v
+}
+
+// required returns v and fails with the message if v is empty.
+func required(msg string, v any) (any, error) {
+	if empty(v) {
+		return nil, errors.New(msg)
+	}
+	return v, nil
+}
+
+// join concatenates the elements of a list with the separator.
+func join(sep string, v any) (string, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return "", fmt.Errorf("cannot join %T", v)
+	}
+	s := make([]string, rv.Len())
+	for i := range s {
+		s[i] = fmt.Sprint(rv.Index(i).Interface())
+	}
+	return strings.Join(s, sep), nil
+}
+
+// split slices a string into all substrings separated by the separator.
+func split(sep, s string) []string {
+	return strings.Split(s, sep)
+}
+
+func empty(v any) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	}
+	return rv.IsZero()
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+
+	"github.com/connylabs/ingest/plugin"
+)
+
+//go:embed schema.json
+var schema []byte
+
+// Schema returns the JSON schema of the configuration format.
+func Schema() []byte {
+	return schema
+}
+
+// Validate checks the configuration at path, which is a file or a directory, or the configuration in the environment
+// if FromEnv reports so, more thoroughly than NewFromPath and ConfigurePlugins:
+// it rejects unknown fields, resolves the plugins of all sources and destinations in paths,
+// checks the workflows strictly, verifies the plugin files with the verifier of the configuration
+// and configures every source and destination with its plugin, including the ones that no workflow references.
+// The plugins are killed before Validate returns.
+func Validate(path string, pm *plugin.PluginManager, paths []string) error {
+	var c *Config
+	var err error
+	if FromEnv(path) {
+		c, err = fromEnv(os.Environ())
+	} else {
+		c, err = newLoader(true).loadPath(path)
+	}
+	if err != nil {
+		return err
+	}
+	c.applyDefaults()
+	if err := c.applyCredentials(); err != nil {
+		return err
+	}
+	if err := c.register(nil); err != nil {
+		return err
+	}
+	if c.Encryption != nil {
+		if _, err := c.Encryption.Keyring(); err != nil {
+			return err
+		}
+	}
+	if pm.Verifier, err = c.PluginVerifier(); err != nil {
+		return err
+	}
+	if pm.Limits, err = c.PluginLimits(); err != nil {
+		return err
+	}
+	sources, destinations, err := c.ConfigurePlugins(pm, paths, true)
+	if err != nil {
+		return err
+	}
+	defer Release(pm, sources, nil, destinations, nil)
+
+	// Start the sources and destinations that no workflow references.
+	pluginPaths := make(map[string]string)
+	// A single instance of their plugins suffices to validate their configurations.
+	unusedSources := make(map[int]int)
+	unusedDestinations := make(map[int]int)
+	for i, s := range c.Sources {
+		if _, ok := sources[s.Name]; ok {
+			continue
+		}
+		pp, err := pluginPath(paths, s.Type)
+		if err != nil {
+			return fmt.Errorf("none of the given paths contains the filename %s: %w", s.Type, err)
+		}
+		pluginPaths[s.Type] = pp
+		unusedSources[i] = 1
+	}
+	for i, d := range c.Destinations {
+		if _, ok := destinations[d.Name]; ok {
+			continue
+		}
+		pp, err := pluginPath(paths, d.Type)
+		if err != nil {
+			return fmt.Errorf("none of the given paths contains the filename %s: %w", d.Type, err)
+		}
+		pluginPaths[d.Type] = pp
+		unusedDestinations[i] = 1
+	}
+	started := c.startPlugins(pm, pluginPaths, unusedSources, unusedDestinations)
+	Release(pm, started.sources, nil, started.destinations, nil)
+	return started.err(c)
+}
@@ -0,0 +1,487 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/connylabs/ingest/plugin"
+)
+
+func TestValidate(t *testing.T) {
+	// Archives are spooled in the home directory by default.
+	t.Setenv("HOME", t.TempDir())
+	paths := []string{fmt.Sprintf("../bin/plugin/%s/%s", runtime.GOOS, runtime.GOARCH)}
+	buf, err := os.ReadFile(filepath.Join(paths[0], "s3"))
+	require.NoError(t, err)
+	checksum := fmt.Sprintf("%x", sha256.Sum256(buf))
+	for _, tc := range []struct {
+		name   string
+		config string
+		err    bool
+	}{
+		{
+			name: "valid",
+			config: `
+plugins:
+  allowUnverified: true
+sources:
+- name: foo
+  type: s3
+  prefix: foo/
+destinations:
+- name: bar
+  type: s3
+  archive:
+    interval: 1m
+workflows:
+- name: foo-bar
+  source: foo
+  destinations:
+  - bar
+  interval: 1m
+  pathTemplate: "{{ .Date }}/{{ .Source }}/{{ .Name }}"
+- name: foo-bar-nightly
+  source: foo
+  destinations:
+  - bar
+  schedule: CRON_TZ=Europe/Berlin 0 2 * * *
+  dependsOn:
+  - foo-bar
+  filters:
+    names:
+    - "*.csv"
+    mimeTypes:
+    - text/*
+    minSize: 1
+    modifiedAfter: 24h
+`,
+		},
+		{
+			name: "verified plugin",
+			config: fmt.Sprintf(`
+plugins:
+  verify:
+  - name: s3
+    sha256: %s
+sources:
+- name: foo
+  type: s3
+`, checksum),
+		},
+		{
+			name: "unknown plugin field",
+			config: `
+version: v2
+plugins:
+  allowUnverified: true
+sources:
+- name: foo
+  type: s3
+  config:
+    secertAccessKey: secret
+`,
+			err: true,
+		},
+		{
+			name: "limited plugin",
+			config: `
+plugins:
+  allowUnverified: true
+  limits:
+  - name: s3
+    memory: 536870912
+sources:
+- name: foo
+  type: s3
+`,
+		},
+		{
+			name: "negative limits",
+			config: `
+plugins:
+  allowUnverified: true
+  limits:
+  - name: s3
+    memory: -1
+sources:
+- name: foo
+  type: s3
+`,
+			err: true,
+		},
+		{
+			name: "timeouts",
+			config: `
+plugins:
+  allowUnverified: true
+sources:
+- name: foo
+  type: s3
+  timeouts:
+    configure: 10s
+    next: 5m
+    download: 6h
+destinations:
+- name: bar
+  type: s3
+  timeouts:
+    store: 10m
+`,
+		},
+		{
+			name: "negative timeouts",
+			config: `
+plugins:
+  allowUnverified: true
+sources:
+- name: foo
+  type: s3
+  timeouts:
+    next: -1m
+`,
+			err: true,
+		},
+		{
+			name: "CPU limits without cgroup",
+			config: `
+plugins:
+  allowUnverified: true
+  limits:
+  - name: s3
+    cpu: 0.5
+sources:
+- name: foo
+  type: s3
+`,
+			err: true,
+		},
+		{
+			name: "unverified plugin",
+			config: `
+sources:
+- name: foo
+  type: s3
+`,
+			err: true,
+		},
+		{
+			name: "wrong checksum",
+			config: fmt.Sprintf(`
+plugins:
+  verify:
+  - name: s3
+    sha256: %x
+sources:
+- name: foo
+  type: s3
+`, sha256.Sum256(nil)),
+			err: true,
+		},
+		{
+			name: "invalid checksum",
+			config: `
+plugins:
+  allowUnverified: true
+  verify:
+  - name: s3
+    sha256: foo
+`,
+			err: true,
+		},
+		{
+			name: "unknown field",
+			config: `
+sources:
+- name: foo
+  type: s3
+workflows:
+- name: foo
+  source: foo
+  destination:
+  - bar
+`,
+			err: true,
+		},
+		{
+			name: "non-existent destination",
+			config: `
+sources:
+- name: foo
+  type: s3
+workflows:
+- name: foo
+  source: foo
+  destinations:
+  - bar
+`,
+			err: true,
+		},
+		{
+			name: "field with wrong case",
+			config: `
+sources:
+- name: foo
+  type: s3
+workflows:
+- name: foo
+  source: foo
+  batchsize: 10
+`,
+			err: true,
+		},
+		{
+			name: "unknown plugin",
+			config: `
+sources:
+- name: foo
+  type: missing
+`,
+			err: true,
+		},
+		{
+			name: "destination plugin as source",
+			config: `
+plugins:
+  allowUnverified: true
+sources:
+- name: foo
+  type: drive
+`,
+			err: true,
+		},
+		{
+			name: "unreferenced destination fails to configure",
+			config: `
+sources:
+- name: foo
+  type: s3
+destinations:
+- name: bar
+  type: s3
+- name: baz
+  type: s3
+  storageClass: foo
+workflows:
+- name: foo-bar
+  source: foo
+  destinations:
+  - bar
+`,
+			err: true,
+		},
+		{
+			name: "invalid schedule",
+			config: `
+sources:
+- name: foo
+  type: s3
+workflows:
+- name: foo
+  source: foo
+  schedule: 0 25 * * *
+`,
+			err: true,
+		},
+		{
+			name: "interval and schedule",
+			config: `
+sources:
+- name: foo
+  type: s3
+workflows:
+- name: foo
+  source: foo
+  interval: 1m
+  schedule: "@daily"
+`,
+			err: true,
+		},
+		{
+			name: "invalid path template",
+			config: `
+sources:
+- name: foo
+  type: s3
+workflows:
+- name: foo
+  source: foo
+  pathTemplate: "{{ .Date }}/{{ .Missing }}"
+`,
+			err: true,
+		},
+		{
+			name: "invalid filters",
+			config: `
+sources:
+- name: foo
+  type: s3
+workflows:
+- name: foo
+  source: foo
+  filters:
+    names:
+    - "[.csv"
+`,
+			err: true,
+		},
+		{
+			name: "name filters of a source without sizes",
+			config: `
+plugins:
+  allowUnverified: true
+sources:
+- name: foo
+  type: noop
+destinations:
+- name: bar
+  type: noop
+workflows:
+- name: foo
+  source: foo
+  destinations:
+  - bar
+  filters:
+    names:
+    - "*.csv"
+`,
+		},
+		{
+			name: "size filters of a source without sizes",
+			config: `
+plugins:
+  allowUnverified: true
+sources:
+- name: foo
+  type: noop
+destinations:
+- name: bar
+  type: noop
+workflows:
+- name: foo
+  source: foo
+  destinations:
+  - bar
+  filters:
+    minSize: 1
+`,
+			err: true,
+		},
+		{
+			name: "non-existent dependency",
+			config: `
+sources:
+- name: foo
+  type: s3
+workflows:
+- name: foo
+  source: foo
+  dependsOn:
+  - bar
+`,
+			err: true,
+		},
+		{
+			name: "cyclic dependencies",
+			config: `
+sources:
+- name: foo
+  type: s3
+workflows:
+- name: foo
+  source: foo
+  dependsOn:
+  - bar
+- name: bar
+  source: foo
+  dependsOn:
+  - foo
+`,
+			err: true,
+		},
+		{
+			name: "negative max transfers",
+			config: `
+maxTransfers: -1
+`,
+			err: true,
+		},
+		{
+			name: "invalid encryption key",
+			config: `
+encryption:
+  key: foo
+`,
+			err: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			pm := plugin.NewPluginManager(0, nil)
+			t.Cleanup(pm.Stop)
+			path := filepath.Join(t.TempDir(), "config")
+			require.NoError(t, os.WriteFile(path, []byte(tc.config), 0o600))
+			err := Validate(path, pm, paths)
+			if tc.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			// Validate kills the plugins that it started.
+			mfs, err := pm.Gather()
+			require.NoError(t, err)
+			assert.Empty(t, mfs)
+		})
+	}
+}
+
+func TestSchema(t *testing.T) {
+	var s struct {
+		Properties map[string]json.RawMessage
+		Defs       map[string]struct {
+			Properties map[string]json.RawMessage
+		} `json:"$defs"`
+	}
+	require.NoError(t, json.Unmarshal(Schema(), &s))
+
+	// The schema must describe all fields of the configuration.
+	for _, tc := range []struct {
+		properties map[string]json.RawMessage
+		t          reflect.Type
+	}{
+		{s.Properties, reflect.TypeOf(Config{})},
+		{s.Defs["source"].Properties, reflect.TypeOf(Source{})},
+		{s.Defs["destination"].Properties, reflect.TypeOf(Destination{})},
+		{s.Defs["workflow"].Properties, reflect.TypeOf(Workflow{})},
+		{s.Defs["encryption"].Properties, reflect.TypeOf(Encryption{})},
+		{s.Defs["defaults"].Properties, reflect.TypeOf(Defaults{})},
+		{s.Defs["credentials"].Properties, reflect.TypeOf(Credentials{})},
+		{s.Defs["plugins"].Properties, reflect.TypeOf(Plugins{})},
+		{s.Defs["pluginVerification"].Properties, reflect.TypeOf(PluginVerification{})},
+	} {
+		var fields []string
+		for i := 0; i < tc.t.NumField(); i++ {
+			f := tc.t.Field(i)
+			if !f.IsExported() || f.Tag.Get("json") == "-" {
+				continue
+			}
+			fields = append(fields, strings.ToLower(f.Name[:1])+f.Name[1:])
+		}
+		properties := make([]string, 0, len(tc.properties))
+		for p := range tc.properties {
+			properties = append(properties, p)
+		}
+		sort.Strings(fields)
+		sort.Strings(properties)
+		assert.Equal(t, fields, properties, tc.t.Name())
+	}
+}
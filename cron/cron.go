@@ -0,0 +1,188 @@
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// domStar and dowStar are true if the day of the month or the day of the week is unrestricted.
+	// If both are restricted, then a day matches if either of them matches, like in cron.
+	domStar, dowStar bool
+	loc              *time.Location
+}
+
+type bounds struct {
+	min, max uint
+	names    map[string]uint
+}
+
+var (
+	minutes = bounds{0, 59, nil}
+	hours   = bounds{0, 23, nil}
+	doms    = bounds{1, 31, nil}
+	months  = bounds{1, 12, map[string]uint{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// Sunday is 0 or 7.
+	dows = bounds{0, 7, map[string]uint{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+
+	descriptors = map[string]string{
+		"@yearly":   "0 0 1 1 *",
+		"@annually": "0 0 1 1 *",
+		"@monthly":  "0 0 1 * *",
+		"@weekly":   "0 0 * * 0",
+		"@daily":    "0 0 * * *",
+		"@midnight": "0 0 * * *",
+		"@hourly":   "0 * * * *",
+	}
+)
+
+// Parse parses a cron expression with the five fields minute, hour, day of the month, month and day of the week,
+// e.g. 0 2 * * * for every night at 2:00, or one of the descriptors @yearly, @monthly, @weekly, @daily and @hourly.
+// Fields can be lists of values, ranges and steps, e.g. 1,15 or 1-5 or */10, and months and days of the week can be named, e.g. MON-FRI.
+// The expression is evaluated in UTC unless it is prefixed with a time zone, e.g. CRON_TZ=Europe/Berlin 0 2 * * *.
+func Parse(spec string) (*Schedule, error) {
+	s := &Schedule{loc: time.UTC}
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "CRON_TZ=") || strings.HasPrefix(spec, "TZ=") {
+		tz, rest, _ := strings.Cut(spec, " ")
+		_, name, _ := strings.Cut(tz, "=")
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time zone %q: %w", name, err)
+		}
+		s.loc, spec = loc, strings.TrimSpace(rest)
+	}
+	if d, ok := descriptors[strings.ToLower(spec)]; ok {
+		spec = d
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron expression %q: expected 5 fields, got %d", spec, len(fields))
+	}
+	var err error
+	for i, f := range []struct {
+		bits *uint64
+		b    bounds
+		name string
+	}{
+		{&s.minute, minutes, "minute"},
+		{&s.hour, hours, "hour"},
+		{&s.dom, doms, "day of the month"},
+		{&s.month, months, "month"},
+		{&s.dow, dows, "day of the week"},
+	} {
+		if *f.bits, err = parseField(fields[i], f.b); err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %w", f.name, fields[i], err)
+		}
+	}
+	// Sunday can be given as 7.
+	if s.dow&(1<<7) != 0 {
+		s.dow = s.dow&^(1<<7) | 1
+	}
+	s.domStar = strings.HasPrefix(fields[2], "*")
+	s.dowStar = strings.HasPrefix(fields[4], "*")
+	if s.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("cron expression %q never matches", spec)
+	}
+	return s, nil
+}
+
+// parseField returns the set bits of the values of a comma-separated list of ranges.
+func parseField(field string, b bounds) (uint64, error) {
+	var bits uint64
+	for _, r := range strings.Split(field, ",") {
+		rng, step, hasStep := strings.Cut(r, "/")
+		var lo, hi uint
+		switch {
+		case rng == "*":
+			lo, hi = b.min, b.max
+		case strings.Contains(rng, "-"):
+			l, h, _ := strings.Cut(rng, "-")
+			var err error
+			if lo, err = parseValue(l, b); err != nil {
+				return 0, err
+			}
+			if hi, err = parseValue(h, b); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("range %q is reversed", rng)
+			}
+		default:
+			v, err := parseValue(rng, b)
+			if err != nil {
+				return 0, err
+			}
+			lo, hi = v, v
+			// A step after a single value, e.g. 5/15, starts at the value.
+			if hasStep {
+				hi = b.max
+			}
+		}
+		n := uint64(1)
+		if hasStep {
+			var err error
+			if n, err = strconv.ParseUint(step, 10, 8); err != nil || n == 0 {
+				return 0, fmt.Errorf("invalid step %q", step)
+			}
+		}
+		for v := lo; v <= hi; v += uint(n) {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func parseValue(s string, b bounds) (uint, error) {
+	if v, ok := b.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.ParseUint(s, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	if uint(v) < b.min || uint(v) > b.max {
+		return 0, fmt.Errorf("value %d is out of range [%d, %d]", v, b.min, b.max)
+	}
+	return uint(v), nil
+}
+
+// Next returns the first time after t that matches the schedule.
+// It returns the zero time if the schedule does not match within the next five years, e.g. for 0 0 30 2 *.
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.In(s.loc).Truncate(time.Minute).Add(time.Minute)
+	end := t.AddDate(5, 0, 0)
+	for t.Before(end) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.loc)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.loc)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, s.loc)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Truncate(time.Minute).Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
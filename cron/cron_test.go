@@ -0,0 +1,114 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"foo * * * *",
+		"@reboot",
+		"CRON_TZ=Mars/Olympus 0 0 * * *",
+		"0 0 30 2 *",
+	} {
+		_, err := Parse(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestNext(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	// 2023-01-10 is a Tuesday.
+	now := time.Date(2023, 1, 10, 14, 30, 15, 0, time.UTC)
+	for _, tc := range []struct {
+		spec     string
+		expected []time.Time
+	}{
+		{
+			spec: "* * * * *",
+			expected: []time.Time{
+				time.Date(2023, 1, 10, 14, 31, 0, 0, time.UTC),
+				time.Date(2023, 1, 10, 14, 32, 0, 0, time.UTC),
+			},
+		},
+		{
+			spec: "0 2 * * *",
+			expected: []time.Time{
+				time.Date(2023, 1, 11, 2, 0, 0, 0, time.UTC),
+				time.Date(2023, 1, 12, 2, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			spec: "*/20 9-17 * * mon-fri",
+			expected: []time.Time{
+				time.Date(2023, 1, 10, 14, 40, 0, 0, time.UTC),
+				time.Date(2023, 1, 10, 15, 0, 0, 0, time.UTC),
+				time.Date(2023, 1, 10, 15, 20, 0, 0, time.UTC),
+			},
+		},
+		{
+			spec: "0 0 * * 7",
+			expected: []time.Time{
+				time.Date(2023, 1, 15, 0, 0, 0, 0, time.UTC),
+				time.Date(2023, 1, 22, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			spec: "@monthly",
+			expected: []time.Time{
+				time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC),
+				time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			// Either the day of the month or the day of the week must match.
+			spec: "0 0 13 * FRI",
+			expected: []time.Time{
+				time.Date(2023, 1, 13, 0, 0, 0, 0, time.UTC),
+				time.Date(2023, 1, 20, 0, 0, 0, 0, time.UTC),
+				time.Date(2023, 1, 27, 0, 0, 0, 0, time.UTC),
+				time.Date(2023, 2, 3, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			spec: "0 0 29 2 *",
+			expected: []time.Time{
+				time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC),
+				time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			spec: "CRON_TZ=Europe/Berlin 0 2 1,15 jan,jul *",
+			expected: []time.Time{
+				time.Date(2023, 1, 15, 2, 0, 0, 0, berlin),
+				time.Date(2023, 7, 1, 2, 0, 0, 0, berlin),
+				time.Date(2023, 7, 15, 2, 0, 0, 0, berlin),
+			},
+		},
+	} {
+		t.Run(tc.spec, func(t *testing.T) {
+			s, err := Parse(tc.spec)
+			require.NoError(t, err)
+			next := now
+			for _, e := range tc.expected {
+				next = s.Next(next)
+				assert.True(t, e.Equal(next), "expected %s, got %s", e, next)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package dedup
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/internal/spool"
+	"github.com/connylabs/ingest/plugin"
+	"github.com/connylabs/ingest/storage"
+)
+
+// DefaultBlobPrefix is the default prefix of the names of blobs.
+const DefaultBlobPrefix = "blobs/sha256/"
+
+// Pointer is the record that is stored under the name of every object.
+type Pointer struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Digest   string `json:"digest"`
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType,omitempty"`
+	// URI is the location of the blob with the content of the object.
+	URI string `json:"uri"`
+}
+
+var _ plugin.Destination = &Destination{}
+
+// Destination wraps a plugin.Destination and stores the content of every object
+// only once under its SHA-256 digest, e.g. blobs/sha256/<hex>.
+// For every object, a JSON encoded Pointer to the blob is stored under
+// the pointer prefix followed by the name of the object.
+// Objects with identical content share the same blob,
+// even across workflows that use the same destination.
+type Destination struct {
+	plugin.Destination
+	blobPrefix    string
+	pointerPrefix string
+}
+
+// NewDestination wraps the given destination.
+// If blobPrefix is empty, then DefaultBlobPrefix is used.
+func NewDestination(d plugin.Destination, blobPrefix, pointerPrefix string) *Destination {
+	if blobPrefix == "" {
+		blobPrefix = DefaultBlobPrefix
+	}
+	return &Destination{Destination: d, blobPrefix: blobPrefix, pointerPrefix: pointerPrefix}
+}
+
+// Stat considers an object to exist if its pointer exists.
+func (d *Destination) Stat(ctx context.Context, element ingest.Codec) (*storage.ObjectInfo, error) {
+	return d.Destination.Stat(ctx, d.pointer(element))
+}
+
+// Store stores the blob unless it already exists and then stores the pointer.
+func (d *Destination) Store(ctx context.Context, element ingest.Codec, obj ingest.Object) (*url.URL, error) {
+	// The object is spooled to a temporary file first,
+	// because the digest must be known before the blob can be stored.
+	h := sha256.New()
+	f, n, err := spool.Temp(obj.Reader, "ingest-dedup-*", h)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object: %w", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	digest := hex.EncodeToString(h.Sum(nil))
+
+	blob := ingest.NewCodec(digest, d.blobPrefix+digest, nil)
+	var uri string
+	oi, err := d.Destination.Stat(ctx, blob)
+	switch {
+	case err == nil:
+		uri = oi.URI
+	case os.IsNotExist(err):
+		u, err := d.Destination.Store(ctx, blob, ingest.Object{Reader: f, Len: n, MimeType: obj.MimeType})
+		if err != nil {
+			return nil, fmt.Errorf("failed to store blob: %w", err)
+		}
+		uri = u.String()
+	default:
+		return nil, fmt.Errorf("failed to stat blob: %w", err)
+	}
+
+	buf, err := json.Marshal(Pointer{
+		ID:       element.ID,
+		Name:     element.Name,
+		Digest:   "sha256:" + digest,
+		Size:     n,
+		MimeType: obj.MimeType,
+		URI:      uri,
+	})
+	if err != nil {
+		return nil, err
+	}
+	u, err := d.Destination.Store(ctx, d.pointer(element), ingest.Object{
+		Reader:   bytes.NewReader(buf),
+		Len:      int64(len(buf)),
+		MimeType: "application/json",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to store pointer: %w", err)
+	}
+	return u, nil
+}
+
+// pointer returns the Codec under which the pointer of the element is stored.
+func (d *Destination) pointer(element ingest.Codec) ingest.Codec {
+	c := element
+	c.Name = path.Join(d.pointerPrefix, element.Name)
+	return c
+}
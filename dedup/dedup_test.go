@@ -0,0 +1,78 @@
+package dedup
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/storage"
+)
+
+// fakeDestination stores objects in memory and counts stores.
+type fakeDestination struct {
+	objects map[string][]byte
+	stores  int
+}
+
+func (f *fakeDestination) Configure(map[string]interface{}) error { return nil }
+
+func (f *fakeDestination) Stat(_ context.Context, c ingest.Codec) (*storage.ObjectInfo, error) {
+	if _, ok := f.objects[c.Name]; !ok {
+		return nil, os.ErrNotExist
+	}
+	return &storage.ObjectInfo{URI: "fake:///" + c.Name}, nil
+}
+
+func (f *fakeDestination) Store(_ context.Context, c ingest.Codec, obj ingest.Object) (*url.URL, error) {
+	buf, err := io.ReadAll(obj.Reader)
+	if err != nil {
+		return nil, err
+	}
+	f.stores++
+	f.objects[c.Name] = buf
+	return &url.URL{Scheme: "fake", Path: "/" + c.Name}, nil
+}
+
+func TestDestination(t *testing.T) {
+	ctx := context.Background()
+	fd := &fakeDestination{objects: make(map[string][]byte)}
+	d := NewDestination(fd, "", "pointers")
+	const digest = "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"
+
+	a := ingest.NewCodec("a", "a.txt", nil)
+	_, err := d.Stat(ctx, a)
+	assert.True(t, os.IsNotExist(err))
+
+	u, err := d.Store(ctx, a, ingest.Object{Reader: strings.NewReader("foo"), Len: 3, MimeType: "text/plain"})
+	require.NoError(t, err)
+	assert.Equal(t, "fake:///pointers/a.txt", u.String())
+	assert.Equal(t, "foo", string(fd.objects["blobs/sha256/"+digest]))
+	var p Pointer
+	require.NoError(t, json.Unmarshal(fd.objects["pointers/a.txt"], &p))
+	assert.Equal(t, Pointer{
+		ID:       "a",
+		Name:     "a.txt",
+		Digest:   "sha256:" + digest,
+		Size:     3,
+		MimeType: "text/plain",
+		URI:      "fake:///blobs/sha256/" + digest,
+	}, p)
+
+	oi, err := d.Stat(ctx, a)
+	require.NoError(t, err)
+	assert.Equal(t, u.String(), oi.URI)
+
+	// An object with the same content only stores a pointer.
+	_, err = d.Store(ctx, ingest.NewCodec("b", "b.txt", nil), ingest.Object{Reader: strings.NewReader("foo"), Len: 3})
+	require.NoError(t, err)
+	assert.Equal(t, 3, fd.stores)
+	assert.Len(t, fd.objects, 3)
+}
@@ -2,6 +2,7 @@ package dequeue
 
 import (
 	"context"
+	"net/url"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
@@ -52,3 +53,8 @@ func (c *instrumentedClient) CleanUp(ctx context.Context, item ingest.Codec) (er
 	c.operationsTotal.WithLabelValues("cleanup", "success").Inc()
 	return
 }
+
+// Locate returns ingest.ErrLocateNotSupported if the client does not implement ingest.Locator.
+func (c *instrumentedClient) Locate(ctx context.Context, item ingest.Codec) (*url.URL, error) {
+	return ingest.Locate(ctx, c.Client, item)
+}
@@ -3,30 +3,62 @@ package dequeue
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
 	"net/url"
 	"os"
+	"sync/atomic"
+	"text/template"
+	"time"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
-	"github.com/nats-io/nats.go"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"golang.org/x/sync/errgroup"
 
 	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/history"
+	"github.com/connylabs/ingest/queue"
 	"github.com/connylabs/ingest/storage"
 )
 
+const (
+	// priorityPollInterval is the duration for which the dequeuer waits for priority messages.
+	priorityPollInterval = 100 * time.Millisecond
+	// pollInterval is the maximum duration for which the dequeuer waits for regular messages
+	// before it checks for priority messages again.
+	pollInterval = time.Second
+	// autoscaleInterval is the minimum duration between two adjustments of the concurrency.
+	autoscaleInterval = 10 * time.Second
+	// defaultMaxDeliver is the maximum number of deliveries of a message that failed to be processed,
+	// unless it is configured with WithRedelivery.
+	defaultMaxDeliver = 5
+	// defaultNakDelay is the duration after which a message that failed to be processed is delivered again,
+	// unless it is configured with WithRedelivery.
+	defaultNakDelay = 30 * time.Second
+	// defaultRetries is the maximum number of retries of a transfer, unless it is configured with WithRetries.
+	defaultRetries = 2
+	// defaultRetryWait is the duration before the first retry of a transfer, unless it is configured with WithRetries.
+	defaultRetryWait = time.Second
+	// defaultMaxRetryWait bounds the exponential backoff between retries of a transfer,
+	// unless it is configured with WithRetries.
+	defaultMaxRetryWait = 30 * time.Second
+)
+
 type dequeuer struct {
 	c                    ingest.Client
 	s                    storage.Storage
 	l                    log.Logger
 	r                    prometheus.Registerer
 	q                    ingest.Queue
+	h                    history.Recorder
 	cleanUp              bool
 	webhookURL           string
 	batchSize            int
@@ -34,15 +66,115 @@ type dequeuer struct {
 	streamName           string
 	consumerName         string
 	subjectName          string
+	prioritySubjectName  string
+	priorityConsumerName string
+	inspector            queue.Inspector
+	minConcurrency       int
+	maxConcurrency       int
+	scaledAt             time.Time
 	dequeueAttemptsTotal *prometheus.CounterVec
 	webhookRequestsTotal *prometheus.CounterVec
+	messageAgeSeconds    prometheus.Histogram
+	concurrencyGauge     prometheus.Gauge
+	failedMessagesTotal  *prometheus.CounterVec
+	retriesTotal         prometheus.Counter
+	retries              int
+	retryWait            time.Duration
+	maxRetryWait         time.Duration
+	maxDeliver           int
+	nakDelays            []time.Duration
+	deadLetterSubject    string
+	pathTemplate         *template.Template
+	pathSource           string
+	pathWorkflow         string
+	limiter              *Limiter
+	// noCopy is 1 once the source turned out to not implement ingest.Locator or the storage to not implement storage.Copier,
+	// after which all objects are downloaded and stored.
+	noCopy int32
+}
+
+// Option configures an ingest.Dequeuer.
+type Option func(*dequeuer)
+
+// WithPriority makes the dequeuer drain the given priority subject with the given consumer
+// before it dequeues messages of the regular subject.
+func WithPriority(subject, consumer string) Option {
+	return func(d *dequeuer) {
+		d.prioritySubjectName = subject
+		d.priorityConsumerName = consumer
+	}
+}
+
+// WithAutoscaling scales the concurrency between min and max, so that one message is processed
+// concurrently for every batch of messages that are pending for the consumer.
+// The number of pending messages is queried from the given queue.Inspector.
+// If the concurrency exceeds the batch size, then the dequeuer pops as many messages as it processes concurrently.
+func WithAutoscaling(i queue.Inspector, min, max int) Option {
+	return func(d *dequeuer) {
+		d.inspector = i
+		d.minConcurrency = min
+		d.maxConcurrency = max
+	}
+}
+
+// WithLimiter makes the dequeuer share the given Limiter with other dequeuers,
+// so that their elements are only processed while the Limiter allows another transfer.
+func WithLimiter(l *Limiter) Option {
+	return func(d *dequeuer) {
+		d.limiter = l
+	}
+}
+
+// WithRedelivery configures how often messages that failed to be processed are delivered again.
+// A message is delivered at most maxDeliver times and the nth delay is the duration after which it is delivered
+// for the n+1th time. The last delay is used for all further deliveries.
+// It defaults to 5 deliveries that are 30s apart.
+func WithRedelivery(maxDeliver int, delays ...time.Duration) Option {
+	return func(d *dequeuer) {
+		if maxDeliver > 0 {
+			d.maxDeliver = maxDeliver
+		}
+		if len(delays) > 0 {
+			d.nakDelays = delays
+		}
+	}
+}
+
+// WithDeadLetter makes the dequeuer publish messages to the given subject
+// once their last delivery failed to be processed, instead of dropping them.
+func WithDeadLetter(subject string) Option {
+	return func(d *dequeuer) {
+		d.deadLetterSubject = subject
+	}
+}
+
+// WithRetries configures how often the transfer of an element is retried before the message of the element fails.
+// The duration before the first retry is wait and it doubles with every further retry up to maxWait.
+// Half of every duration is randomized. Durations of 0 keep their defaults of 1s and 30s.
+// It defaults to 2 retries, which negative retries keep, and 0 disables retries.
+func WithRetries(retries int, wait, maxWait time.Duration) Option {
+	return func(d *dequeuer) {
+		if retries >= 0 {
+			d.retries = retries
+		}
+		if wait > 0 {
+			d.retryWait = wait
+		}
+		if maxWait > 0 {
+			d.maxRetryWait = maxWait
+		}
+	}
 }
 
 // New creates a new ingest.Dequeuer.
-func New(webhookURL string, c ingest.Client, s storage.Storage, q ingest.Queue, streamName, consumerName, subjectName string, batchSize, concurrency int, cleanUp bool, l log.Logger, r prometheus.Registerer) ingest.Dequeuer {
+// Every processed batch is recorded with the given history.Recorder, which may be nil.
+func New(webhookURL string, c ingest.Client, s storage.Storage, q ingest.Queue, h history.Recorder, streamName, consumerName, subjectName string, batchSize, concurrency int, cleanUp bool, l log.Logger, r prometheus.Registerer, opts ...Option) ingest.Dequeuer {
 	if l == nil {
 		l = log.NewNopLogger()
 	}
+	if h == nil {
+		h = history.NewNopRecorder()
+	}
 
 	dequeueAttemptsTotal := promauto.With(r).NewCounterVec(prometheus.CounterOpts{
 		Name: "ingest_dequeue_attempts_total",
@@ -54,18 +186,43 @@ func New(webhookURL string, c ingest.Client, s storage.Storage, q ingest.Queue,
 		Help: "The number webhook HTTP requests.",
 	}, []string{"result"})
 
+	messageAgeSeconds := promauto.With(r).NewHistogram(prometheus.HistogramOpts{
+		Name:    "ingest_dequeue_message_age_seconds",
+		Help:    "Duration between enqueueing and dequeueing messages.",
+		Buckets: prometheus.ExponentialBuckets(0.1, 4, 10),
+	})
+
+	concurrencyGauge := promauto.With(r).NewGauge(prometheus.GaugeOpts{
+		Name: "ingest_dequeue_concurrency",
+		Help: "The number of messages that are processed concurrently.",
+	})
+
+	failedMessagesTotal := promauto.With(r).NewCounterVec(prometheus.CounterOpts{
+		Name: "ingest_dequeue_failed_messages_total",
+		Help: "Number of messages that failed to be processed by the action that was taken.",
+	}, []string{"action"})
+	for _, a := range []string{actionNak, actionDeadLetter, actionDrop} {
+		failedMessagesTotal.WithLabelValues(a).Add(0)
+	}
+
+	retriesTotal := promauto.With(r).NewCounter(prometheus.CounterOpts{
+		Name: "ingest_dequeue_retries_total",
+		Help: "Number of retries of transfers that failed.",
+	})
+
 	for _, c := range []*prometheus.CounterVec{dequeueAttemptsTotal, webhookRequestsTotal} {
 		for _, r := range []string{"error", "success"} {
 			c.WithLabelValues(r).Add(0)
 		}
 	}
 
-	return &dequeuer{
+	d := &dequeuer{
 		c:                    newInstrumentedClient(c, r),
 		s:                    s,
 		l:                    l,
 		r:                    r,
 		q:                    q,
+		h:                    h,
 		cleanUp:              cleanUp,
 		webhookURL:           webhookURL,
 		batchSize:            batchSize,
@@ -75,53 +232,83 @@ func New(webhookURL string, c ingest.Client, s storage.Storage, q ingest.Queue,
 		subjectName:          subjectName,
 		dequeueAttemptsTotal: dequeueAttemptsTotal,
 		webhookRequestsTotal: webhookRequestsTotal,
+		messageAgeSeconds:    messageAgeSeconds,
+		concurrencyGauge:     concurrencyGauge,
+		failedMessagesTotal:  failedMessagesTotal,
+		retriesTotal:         retriesTotal,
+		retries:              defaultRetries,
+		retryWait:            defaultRetryWait,
+		maxRetryWait:         defaultMaxRetryWait,
+		maxDeliver:           defaultMaxDeliver,
+		nakDelays:            []time.Duration{defaultNakDelay},
+	}
+	for _, o := range opts {
+		o(d)
 	}
+	if d.inspector != nil {
+		d.concurrency = d.minConcurrency
+	}
+	concurrencyGauge.Set(float64(d.concurrency))
+	return d
 }
 
 func (d *dequeuer) Dequeue(ctx context.Context) error {
 	level.Debug(d.l).Log("msg", "subscribing to stream", "consumer", d.consumerName, "stream", d.streamName)
-	sub, err := d.q.PullSubscribe(d.subjectName, d.consumerName, nats.BindStream(d.streamName))
+	sub, err := d.q.PullSubscribe(d.subjectName, d.consumerName)
 	if err != nil {
 		return fmt.Errorf("failed to subscribe to stream: %w", err)
 	}
+	var psub ingest.Subscription
+	if d.prioritySubjectName != "" {
+		if psub, err = d.q.PullSubscribe(d.prioritySubjectName, d.priorityConsumerName); err != nil {
+			sub.Close()
+			return fmt.Errorf("failed to subscribe to priority subject: %w", err)
+		}
+	}
 
 	for {
 		select {
 		case <-ctx.Done():
+			if psub != nil {
+				if err := psub.Close(); err != nil {
+					level.Warn(d.l).Log("msg", "failed to close priority subscription", "err", err.Error())
+				}
+			}
 			return sub.Close()
 		default:
 		}
 
-		msgs, err := sub.Pop(ctx, d.batchSize)
+		d.scale(ctx)
+		msgs, err := d.pop(ctx, sub, psub)
 		if err != nil {
 			level.Error(d.l).Log("msg", "failed to dequeue messages from queue", "err", err.Error())
 			continue
 
 		}
+		if len(msgs) == 0 {
+			continue
+		}
 		level.Info(d.l).Log("msg", fmt.Sprintf("dequeued %d messages from queue", len(msgs)))
 
-		g, egCtx := errgroup.WithContext(ctx)
+		run := history.Run{Mode: history.ModeDequeue, Start: time.Now(), Count: len(msgs)}
+		var errs int32
+		var stored int64
+		// Messages that fail are settled individually, so a failure must not cancel the transfers of the other messages.
+		var g errgroup.Group
 		g.SetLimit(d.concurrency)
-		uris := make([]string, d.batchSize)
+		uris := make([]string, len(msgs))
 		for i, raw := range msgs {
 			i, raw := i, raw
 			g.Go(func() error {
-				item := new(ingest.Codec)
-				if err := item.Unmarshal(raw.Data); err != nil {
-					level.Error(d.l).Log("msg", "failed to marshal message", "err", err.Error())
-					return err
-				}
-				u, err := d.process(egCtx, *item)
+				u, err := d.handle(ctx, raw, &stored)
 				if err != nil {
-					level.Error(d.l).Log("msg", "failed to process message", "id", item.ID, "name", item.Name, "err", err.Error())
-				} else {
-					level.Info(d.l).Log("msg", "successfully processed message", "id", item.ID, "name", item.Name, "data", string(raw.Data))
-				}
-				if err := raw.AckSync(); err != nil {
-					level.Error(d.l).Log("msg", "failed to ack message", "id", item.ID, "name", item.Name, "err", err.Error())
-					return err
+					atomic.AddInt32(&errs, 1)
+					if err := d.fail(ctx, raw); err != nil {
+						level.Error(d.l).Log("msg", "failed to settle failed message", "id", raw.Header()[ingest.HeaderID], "err", err.Error())
+						return err
+					}
+					return nil
 				}
-				level.Debug(d.l).Log("msg", "acked message", "id", item.ID, "name", item.Name, "data", string(raw.Data))
 				if u != nil {
 					uris[i] = u.String()
 				}
@@ -130,10 +317,19 @@ func (d *dequeuer) Dequeue(ctx context.Context) error {
 		}
 
 		if err := g.Wait(); err != nil {
+			run.Error = err.Error()
 			level.Error(d.l).Log("msg", "at least one go routine returned an error", "err", err.Error())
 		}
+		if len(msgs) > 0 {
+			run.End = time.Now()
+			run.Errors = int(errs)
+			run.Bytes = stored
+			if err := d.h.Record(ctx, run); err != nil {
+				level.Warn(d.l).Log("msg", "failed to record run", "err", err.Error())
+			}
+		}
 
-		filteredUIRs := make([]string, 0, d.batchSize)
+		filteredUIRs := make([]string, 0, len(uris))
 		for _, uri := range uris {
 			if uri != "" {
 				filteredUIRs = append(filteredUIRs, uri)
@@ -151,10 +347,234 @@ func (d *dequeuer) Dequeue(ctx context.Context) error {
 	}
 }
 
-func (d *dequeuer) process(ctx context.Context, item ingest.Codec) (*url.URL, error) {
+// handle processes and acknowledges the message and adds the number of stored bytes to stored.
+// It returns the URL of the stored object. Messages for which it returns an error must be settled with fail.
+func (d *dequeuer) handle(ctx context.Context, raw ingest.Message, stored *int64) (*url.URL, error) {
+	if err := d.inspect(raw); err != nil {
+		level.Error(d.l).Log("msg", "failed to inspect message", "err", err.Error())
+		return nil, err
+	}
+	item := new(ingest.Codec)
+	if err := item.Unmarshal(raw.Data()); err != nil {
+		level.Error(d.l).Log("msg", "failed to marshal message", "err", err.Error())
+		return nil, err
+	}
+	dst, err := d.destination(*item, raw.Header())
 	var u *url.URL
+	var n int64
+	if err == nil {
+		u, n, err = d.transfer(ctx, *item, dst)
+		atomic.AddInt64(stored, n)
+	}
+	if err != nil {
+		level.Error(d.l).Log("msg", "failed to process message", "id", item.ID, "name", item.Name, "err", err.Error())
+		return nil, err
+	}
+	level.Info(d.l).Log("msg", "successfully processed message", "id", item.ID, "name", item.Name, "data", string(raw.Data()))
+	if err := raw.Ack(ctx); err != nil {
+		level.Error(d.l).Log("msg", "failed to ack message", "id", item.ID, "name", item.Name, "err", err.Error())
+		return nil, err
+	}
+	level.Debug(d.l).Log("msg", "acked message", "id", item.ID, "name", item.Name, "data", string(raw.Data()))
+	return u, nil
+}
+
+// Actions that are taken for messages that failed to be processed.
+const (
+	actionNak        = "nak"
+	actionDeadLetter = "dead-letter"
+	actionDrop       = "drop"
+)
+
+// fail settles a message that failed to be processed.
+// Unless it was delivered for the last time, the message is negatively acknowledged, so that it is delivered again
+// after a delay. Messages whose last delivery failed and messages of queues that cannot deliver them again
+// are published to the dead-letter subject, if there is one, and acknowledged.
+func (d *dequeuer) fail(ctx context.Context, m ingest.Message) error {
+	if n := ingest.Deliveries(m); n < d.maxDeliver {
+		err := ingest.Nak(ctx, m, d.nakDelay(n))
+		if err == nil {
+			d.failedMessagesTotal.WithLabelValues(actionNak).Inc()
+			return nil
+		}
+		if !errors.Is(err, ingest.ErrNakNotSupported) {
+			return fmt.Errorf("failed to nak message: %w", err)
+		}
+	}
+	action := actionDrop
+	if d.deadLetterSubject != "" {
+		h := make(ingest.Header, len(m.Header()))
+		for k, v := range m.Header() {
+			h[k] = v
+		}
+		// Queues that deduplicate messages must not drop the dead letter as a duplicate of the message.
+		if id, ok := h[ingest.HeaderID]; ok {
+			h[ingest.HeaderID] = actionDeadLetter + ":" + id
+		}
+		if err := d.q.Publish(d.deadLetterSubject, m.Data(), h); err != nil {
+			return fmt.Errorf("failed to publish message to dead-letter subject: %w", err)
+		}
+		action = actionDeadLetter
+	}
+	if err := m.Ack(ctx); err != nil {
+		return fmt.Errorf("failed to ack message: %w", err)
+	}
+	d.failedMessagesTotal.WithLabelValues(action).Inc()
+	level.Warn(d.l).Log("msg", "gave up on message that failed to be processed", "action", action, "deliveries", ingest.Deliveries(m))
+	return nil
+}
+
+// nakDelay returns the duration after which a message that failed to be processed in its nth delivery is delivered again.
+// Messages whose number of deliveries is unknown are delayed as if they were delivered for the first time.
+func (d *dequeuer) nakDelay(n int) time.Duration {
+	if n < 1 {
+		n = 1
+	}
+	if n > len(d.nakDelays) {
+		n = len(d.nakDelays)
+	}
+	return d.nakDelays[n-1]
+}
+
+// pop pops a batch of messages.
+// If there is a priority subscription, then it is drained first
+// and regular messages are only waited for until the poll interval elapsed.
+func (d *dequeuer) pop(ctx context.Context, sub, psub ingest.Subscription) ([]ingest.Message, error) {
+	if psub == nil {
+		return sub.Pop(ctx, d.popSize())
+	}
+	pctx, cancel := context.WithTimeout(ctx, priorityPollInterval)
+	msgs, err := psub.Pop(pctx, d.popSize())
+	cancel()
+	if err == nil && len(msgs) > 0 {
+		return msgs, nil
+	}
+	if err != nil && pctx.Err() == nil {
+		return nil, err
+	}
+
+	rctx, cancel := context.WithTimeout(ctx, pollInterval)
+	defer cancel()
+	msgs, err = sub.Pop(rctx, d.popSize())
+	if err != nil && rctx.Err() != nil && ctx.Err() == nil {
+		// There were no regular messages within the poll interval.
+		return nil, nil
+	}
+	return msgs, err
+}
+
+// inspect observes the age of the message and verifies its data against its hash.
+// Messages without headers, e.g. published by older versions, are not inspected.
+func (d *dequeuer) inspect(m ingest.Message) error {
+	// Messages of encrypted queues carry the error that prevented their decryption.
+	if e, ok := m.(interface{ Err() error }); ok && e.Err() != nil {
+		return e.Err()
+	}
+	h := m.Header()
+	if v, ok := h[ingest.HeaderEnqueuedAt]; ok {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return fmt.Errorf("invalid %s header %q: %w", ingest.HeaderEnqueuedAt, v, err)
+		}
+		d.messageAgeSeconds.Observe(time.Since(t).Seconds())
+	}
+	if v, ok := h[ingest.HeaderHash]; ok {
+		sum := sha256.Sum256(m.Data())
+		if v != "sha256:"+hex.EncodeToString(sum[:]) {
+			return fmt.Errorf("message of workflow %q from source %q does not match its hash %q", h[ingest.HeaderWorkflow], h[ingest.HeaderSource], v)
+		}
+	}
+	return nil
+}
+
+// popSize returns the number of messages to pop at once.
+func (d *dequeuer) popSize() int {
+	if d.concurrency > d.batchSize {
+		return d.concurrency
+	}
+	return d.batchSize
+}
+
+// scale adjusts the concurrency to the number of pending messages if autoscaling is enabled.
+func (d *dequeuer) scale(ctx context.Context) {
+	if d.inspector == nil || time.Since(d.scaledAt) < autoscaleInterval {
+		return
+	}
+	d.scaledAt = time.Now()
+	s, err := d.inspector.ConsumerStats(ctx, d.subjectName, d.consumerName)
+	if err != nil {
+		level.Warn(d.l).Log("msg", "failed to get pending messages", "err", err.Error())
+		return
+	}
+	if s == nil {
+		return
+	}
+	c := int((s.Pending + uint64(d.batchSize) - 1) / uint64(d.batchSize))
+	if c < d.minConcurrency {
+		c = d.minConcurrency
+	}
+	if c > d.maxConcurrency {
+		c = d.maxConcurrency
+	}
+	if c == d.concurrency {
+		return
+	}
+	level.Info(d.l).Log("msg", "scaling concurrency", "pending", s.Pending, "from", d.concurrency, "to", c)
+	d.concurrency = c
+	d.concurrencyGauge.Set(float64(c))
+}
+
+// transfer processes the item and retries failed attempts with an exponential backoff with jitter,
+// so that transient errors, e.g. 503s of S3, do not fail the message.
+// The limiter is released while the transfer waits for its next attempt.
+func (d *dequeuer) transfer(ctx context.Context, item, dst ingest.Codec) (*url.URL, int64, error) {
+	for i := 0; ; i++ {
+		u, n, err := d.attempt(ctx, item, dst)
+		if err == nil || i >= d.retries || ctx.Err() != nil {
+			return u, n, err
+		}
+		d.retriesTotal.Inc()
+		wait := d.backoff(i)
+		level.Warn(d.l).Log("msg", "retrying transfer", "id", item.ID, "name", item.Name, "retry", i+1, "wait", wait, "err", err.Error())
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, n, err
+		case <-t.C:
+		}
+	}
+}
+
+// backoff returns the duration to wait before the given retry of a transfer.
+// The duration doubles with every retry and half of it is randomized,
+// so that transfers that failed together do not retry in lockstep.
+func (d *dequeuer) backoff(retry int) time.Duration {
+	w := d.maxRetryWait
+	if retry < 16 && d.retryWait<<retry < d.maxRetryWait {
+		w = d.retryWait << retry
+	}
+	return w/2 + time.Duration(rand.Int63n(int64(w/2)+1))
+}
+
+// attempt processes the item once the limiter, if any, allows another transfer.
+func (d *dequeuer) attempt(ctx context.Context, item, dst ingest.Codec) (*url.URL, int64, error) {
+	if d.limiter != nil {
+		if err := d.limiter.acquire(ctx); err != nil {
+			return nil, 0, err
+		}
+		defer d.limiter.release()
+	}
+	return d.process(ctx, item, dst)
+}
+
+// process copies the item from the source to the storage, where it is stored as dst.
+// It returns the URL of the stored object and the number of stored bytes.
+func (d *dequeuer) process(ctx context.Context, item, dst ingest.Codec) (*url.URL, int64, error) {
+	var u *url.URL
+	var n int64
 	operation := func() error {
-		_, err := d.s.Stat(ctx, item)
+		_, err := d.s.Stat(ctx, dst)
 		if err == nil {
 			if d.cleanUp {
 				return d.c.CleanUp(ctx, item)
@@ -165,14 +585,27 @@ func (d *dequeuer) process(ctx context.Context, item ingest.Codec) (*url.URL, er
 		if !os.IsNotExist(err) {
 			return err
 		}
+		copied, err := d.copy(ctx, item, dst)
+		if err != nil {
+			return err
+		}
+		if copied != nil {
+			// The content of copied objects is not read, so their size is taken from the listing.
+			u, n = copied, item.Size
+			if d.cleanUp {
+				return d.c.CleanUp(ctx, item)
+			}
+			return nil
+		}
 		obj, err := d.c.Download(ctx, item)
 		if err != nil {
 			return err
 		}
-		u, err = d.s.Store(ctx, item, *obj)
+		u, err = d.s.Store(ctx, dst, *obj)
 		if err != nil {
 			return err
 		}
+		n = obj.Len
 
 		if d.cleanUp {
 			return d.c.CleanUp(ctx, item)
@@ -183,11 +616,45 @@ func (d *dequeuer) process(ctx context.Context, item ingest.Codec) (*url.URL, er
 
 	if err := operation(); err != nil {
 		d.dequeueAttemptsTotal.WithLabelValues("error").Inc()
-		return nil, err
+		return nil, n, err
 	}
 
 	d.dequeueAttemptsTotal.WithLabelValues("success").Inc()
-	return u, nil
+	return u, n, nil
+}
+
+// copy copies the item from its location in the source to the storage, where it is stored as dst,
+// if the source implements ingest.Locator and the storage implements storage.Copier, e.g. with a server-side copy.
+// It returns nil if the item must be downloaded and stored instead.
+// Only if the source or the storage cannot copy any item are all following items downloaded and stored, too.
+func (d *dequeuer) copy(ctx context.Context, item, dst ingest.Codec) (*url.URL, error) {
+	if atomic.LoadInt32(&d.noCopy) == 1 {
+		return nil, nil
+	}
+	loc, err := ingest.Locate(ctx, d.c, item)
+	if errors.Is(err, ingest.ErrLocateNotSupported) {
+		level.Info(d.l).Log("msg", "source cannot locate objects; downloading objects instead")
+		atomic.StoreInt32(&d.noCopy, 1)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if loc == nil {
+		level.Debug(d.l).Log("msg", "source cannot locate object; downloading object instead", "item", item.ID)
+		return nil, nil
+	}
+	u, err := storage.CopyFrom(ctx, d.s, dst, loc)
+	switch {
+	case errors.Is(err, storage.ErrCopyNotImplemented):
+		level.Info(d.l).Log("msg", "storage cannot copy objects; downloading objects instead")
+		atomic.StoreInt32(&d.noCopy, 1)
+		return nil, nil
+	case errors.Is(err, storage.ErrCopyNotSupported):
+		level.Info(d.l).Log("msg", "storage cannot copy from the source; downloading object instead", "location", loc.String())
+		return nil, nil
+	}
+	return u, err
 }
 
 func (d *dequeuer) callWebhook(ctx context.Context, data []string) error {
@@ -2,15 +2,18 @@ package dequeue
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"io/fs"
 	"net/url"
 	"os"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/go-kit/log"
-	"github.com/nats-io/nats.go"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
@@ -18,10 +21,25 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/history"
 	"github.com/connylabs/ingest/mocks"
+	"github.com/connylabs/ingest/queue"
 	"github.com/connylabs/ingest/storage"
 )
 
+func TestParsePathTemplate(t *testing.T) {
+	for _, text := range []string{
+		"{{ .Name",
+		"{{ .Missing }}/{{ .Name }}",
+		"{{ missing .Name }}",
+		"",
+		"../{{ .Name }}",
+	} {
+		_, err := ParsePathTemplate(text)
+		assert.Error(t, err, text)
+	}
+}
+
 func TestDequeue(t *testing.T) {
 	t.Run("empty", func(t *testing.T) {
 		reg := prometheus.NewRegistry()
@@ -33,11 +51,11 @@ func TestDequeue(t *testing.T) {
 
 		q.On("PullSubscribe", "sub", "con", mock.Anything).Return(sub, nil).Once()
 
-		sub.On("Pop", mock.Anything, 1).Return([]*nats.Msg{}, nil).Once().
-			On("Pop", mock.Anything, 1).Return([]*nats.Msg{}, nil).After(time.Millisecond).
+		sub.On("Pop", mock.Anything, 1).Return([]ingest.Message{}, nil).Once().
+			On("Pop", mock.Anything, 1).Return([]ingest.Message{}, nil).After(time.Millisecond).
 			On("Close").Return(nil).Once()
 
-		d := New("", c, s, q, "str", "con", "sub", 1, 1, true, logger, reg)
+		d := New("", c, s, q, nil, "str", "con", "sub", 1, 1, true, logger, reg)
 
 		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
 		defer cancel()
@@ -58,12 +76,19 @@ func TestDequeue(t *testing.T) {
 		sub := new(mocks.Subscription)
 		_t := ingest.NewCodec("bar", "foo", nil)
 		data, _ := _t.Marshal()
-		msg := &nats.Msg{Data: data}
+		sum := sha256.Sum256(data)
+		msg := new(mocks.Message)
+		msg.On("Data").Return(data).
+			On("Header").Return(ingest.Header{
+			ingest.HeaderEnqueuedAt: time.Now().Add(-time.Minute).UTC().Format(time.RFC3339Nano),
+			ingest.HeaderHash:       "sha256:" + hex.EncodeToString(sum[:]),
+		}).
+			On("Ack", mock.Anything).Return(nil).Once()
 
 		q.On("PullSubscribe", "sub", "con", mock.Anything).Return(sub, nil).Once()
 
-		sub.On("Pop", mock.Anything, 1).Return([]*nats.Msg{msg}, nil).Once().
-			On("Pop", mock.Anything, 1).Return([]*nats.Msg{}, nil).
+		sub.On("Pop", mock.Anything, 1).Return([]ingest.Message{msg}, nil).Once().
+			On("Pop", mock.Anything, 1).Return([]ingest.Message{}, nil).
 			On("Close").Return(nil).Once()
 
 		c.On("CleanUp", mock.Anything, mock.Anything).Return(nil).Once()
@@ -72,7 +97,7 @@ func TestDequeue(t *testing.T) {
 		s.On("Stat", mock.Anything, _t).Return((*storage.ObjectInfo)(nil), fs.ErrNotExist).Once()
 		s.On("Store", mock.Anything, _t, mock.Anything).Return(&url.URL{Scheme: "s3", Host: "bucket", Path: "prefix/foo"}, nil).Once()
 
-		d := New("", c, s, q, "str", "con", "sub", 1, 1, true, logger, reg)
+		d := New("", c, s, q, nil, "str", "con", "sub", 1, 1, true, logger, reg)
 
 		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
 		defer cancel()
@@ -82,6 +107,7 @@ func TestDequeue(t *testing.T) {
 
 		q.AssertExpectations(t)
 		sub.AssertExpectations(t)
+		msg.AssertExpectations(t)
 		s.AssertExpectations(t)
 		c.AssertExpectations(t)
 
@@ -110,6 +136,11 @@ func TestDequeue(t *testing.T) {
 			assert.Equal(t, 2, c, "ingest_webhook_http_client_requests_total")
 
 		}
+		{
+			c, err := testutil.GatherAndCount(reg, "ingest_dequeue_message_age_seconds")
+			require.Nil(t, err)
+			assert.Equal(t, 1, c)
+		}
 	})
 	t.Run("one object exists", func(t *testing.T) {
 		reg := prometheus.NewRegistry()
@@ -120,19 +151,22 @@ func TestDequeue(t *testing.T) {
 		sub := new(mocks.Subscription)
 		_t := ingest.NewCodec("bar", "foo", nil)
 		data, _ := _t.Marshal()
-		msg := &nats.Msg{Data: data}
+		msg := new(mocks.Message)
+		msg.On("Data").Return(data).
+			On("Header").Return(ingest.Header(nil)).
+			On("Ack", mock.Anything).Return(nil).Once()
 
 		q.On("PullSubscribe", "sub", "con", mock.Anything).Return(sub, nil).Once()
 
-		sub.On("Pop", mock.Anything, 1).Return([]*nats.Msg{msg}, nil).Once().
-			On("Pop", mock.Anything, 1).Return([]*nats.Msg{}, nil).
+		sub.On("Pop", mock.Anything, 1).Return([]ingest.Message{msg}, nil).Once().
+			On("Pop", mock.Anything, 1).Return([]ingest.Message{}, nil).
 			On("Close").Return(nil).Once()
 
 		c.On("CleanUp", mock.Anything, mock.Anything).Return(nil).Once()
 
 		s.On("Stat", mock.Anything, _t).Return((*storage.ObjectInfo)(nil), nil).Once()
 
-		d := New("", c, s, q, "str", "con", "sub", 1, 1, true, logger, reg)
+		d := New("", c, s, q, nil, "str", "con", "sub", 1, 1, true, logger, reg)
 
 		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
 		defer cancel()
@@ -140,9 +174,516 @@ func TestDequeue(t *testing.T) {
 			t.Error(err)
 		}
 
+		q.AssertExpectations(t)
+		sub.AssertExpectations(t)
+		msg.AssertExpectations(t)
+		s.AssertExpectations(t)
+		c.AssertExpectations(t)
+	})
+	t.Run("path template", func(t *testing.T) {
+		c := new(mocks.Client)
+		q := new(mocks.Queue)
+		s := new(mocks.Storage)
+		sub := new(mocks.Subscription)
+		_t := ingest.NewCodec("bar", "foo/bar.CSV", nil)
+		renamed := ingest.NewCodec("bar", "2023-02-01/src/wf/bar.csv", nil)
+		data, _ := _t.Marshal()
+		msg := new(mocks.Message)
+		msg.On("Data").Return(data).
+			On("Header").Return(ingest.Header{ingest.HeaderEnqueuedAt: "2023-01-31T23:30:00-02:00"}).
+			On("Ack", mock.Anything).Return(nil).Once()
+
+		q.On("PullSubscribe", "sub", "con", mock.Anything).Return(sub, nil).Once()
+
+		sub.On("Pop", mock.Anything, 1).Return([]ingest.Message{msg}, nil).Once().
+			On("Pop", mock.Anything, 1).Return([]ingest.Message{}, nil).
+			On("Close").Return(nil).Once()
+
+		// The source is asked for the element under its original name.
+		c.On("Download", mock.Anything, _t).Return(&ingest.Object{Reader: strings.NewReader("hello")}, nil).Once()
+		c.On("CleanUp", mock.Anything, _t).Return(nil).Once()
+
+		s.On("Stat", mock.Anything, renamed).Return((*storage.ObjectInfo)(nil), fs.ErrNotExist).Once()
+		s.On("Store", mock.Anything, renamed, mock.Anything).Return(&url.URL{Scheme: "s3", Host: "bucket", Path: "2023-02-01/src/wf/bar.csv"}, nil).Once()
+
+		pt, err := ParsePathTemplate("/{{ .Date }}/{{ .Source }}/{{ .Workflow }}/{{ base .Name | lower }}")
+		require.NoError(t, err)
+		d := New("", c, s, q, nil, "str", "con", "sub", 1, 1, true, nil, prometheus.NewRegistry(), WithPathTemplate(pt, "src", "wf"))
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		defer cancel()
+		require.NoError(t, d.Dequeue(ctx))
+
+		q.AssertExpectations(t)
+		sub.AssertExpectations(t)
+		msg.AssertExpectations(t)
+		s.AssertExpectations(t)
+		c.AssertExpectations(t)
+	})
+	t.Run("priority", func(t *testing.T) {
+		c := new(mocks.Client)
+		q := new(mocks.Queue)
+		s := new(mocks.Storage)
+		sub := new(mocks.Subscription)
+		psub := new(mocks.Subscription)
+		regular := ingest.NewCodec("bar", "bulk/bar", nil)
+		data, _ := regular.Marshal()
+		msg := new(mocks.Message)
+		msg.On("Data").Return(data).
+			On("Header").Return(ingest.Header(nil)).
+			On("Ack", mock.Anything).Return(nil).Once()
+		urgent := ingest.NewCodec("foo", "legal-hold/foo", nil)
+		pdata, _ := urgent.Marshal()
+		pmsg := new(mocks.Message)
+		pmsg.On("Data").Return(pdata).
+			On("Header").Return(ingest.Header(nil)).
+			On("Ack", mock.Anything).Return(nil).Once()
+		wait := func(ctx context.Context, _ int) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+
+		q.On("PullSubscribe", "sub", "con").Return(sub, nil).Once().
+			On("PullSubscribe", "sub.priority", "con__priority").Return(psub, nil).Once()
+		psub.On("Pop", mock.Anything, 1).Return([]ingest.Message{pmsg}, nil).Once().
+			On("Pop", mock.Anything, 1).Return(nil, wait).
+			On("Close").Return(nil).Once()
+		sub.On("Pop", mock.Anything, 1).Return([]ingest.Message{msg}, nil).Once().
+			On("Pop", mock.Anything, 1).Return(nil, wait).
+			On("Close").Return(nil).Once()
+
+		var order []string
+		s.On("Stat", mock.Anything, mock.Anything).Return((*storage.ObjectInfo)(nil), fs.ErrNotExist).
+			On("Store", mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			order = append(order, args.Get(1).(ingest.Codec).Name)
+		}).Return(&url.URL{Scheme: "s3", Host: "bucket"}, nil)
+		c.On("Download", mock.Anything, mock.Anything).Return(&ingest.Object{Reader: strings.NewReader("hello")}, nil)
+
+		d := New("", c, s, q, nil, "str", "con", "sub", 1, 1, false, nil, prometheus.NewRegistry(), WithPriority("sub.priority", "con__priority"))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+		require.NoError(t, d.Dequeue(ctx))
+		assert.Equal(t, []string{"legal-hold/foo", "bulk/bar"}, order)
+
+		q.AssertExpectations(t)
+		sub.AssertExpectations(t)
+		psub.AssertExpectations(t)
+		msg.AssertExpectations(t)
+		pmsg.AssertExpectations(t)
+	})
+	t.Run("autoscaling", func(t *testing.T) {
+		c := new(mocks.Client)
+		q := new(mocks.Queue)
+		s := new(mocks.Storage)
+		sub := new(mocks.Subscription)
+		msgs := make([]ingest.Message, 3)
+		for i := range msgs {
+			item := ingest.NewCodec(fmt.Sprint(i), fmt.Sprint(i), nil)
+			data, _ := item.Marshal()
+			msg := new(mocks.Message)
+			msg.On("Data").Return(data).
+				On("Header").Return(ingest.Header(nil)).
+				On("Ack", mock.Anything).Return(nil).Once()
+			msgs[i] = msg
+		}
+
+		q.On("PullSubscribe", "sub", "con").Return(sub, nil).Once()
+		// With 5 pending messages and a batch size of 2, the concurrency is scaled to the maximum of 3.
+		sub.On("Pop", mock.Anything, 3).Return(msgs, nil).Once().
+			On("Pop", mock.Anything, 3).Return([]ingest.Message{}, nil).
+			On("Close").Return(nil).Once()
+		s.On("Stat", mock.Anything, mock.Anything).Return((*storage.ObjectInfo)(nil), nil)
+
+		reg := prometheus.NewRegistry()
+		d := New("", c, s, q, nil, "str", "con", "sub", 2, 2, false, nil, reg, WithAutoscaling(fakeInspector{Pending: 5}, 1, 3))
+		assert.Equal(t, 1.0, testutil.ToFloat64(d.(*dequeuer).concurrencyGauge))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		require.NoError(t, d.Dequeue(ctx))
+		assert.Equal(t, 3.0, testutil.ToFloat64(d.(*dequeuer).concurrencyGauge))
+
+		q.AssertExpectations(t)
+		sub.AssertExpectations(t)
+		for _, msg := range msgs {
+			msg.(*mocks.Message).AssertExpectations(t)
+		}
+	})
+	t.Run("limiter", func(t *testing.T) {
+		c := new(mocks.Client)
+		q := new(mocks.Queue)
+		s := new(mocks.Storage)
+		sub := new(mocks.Subscription)
+		msgs := make([]ingest.Message, 3)
+		for i := range msgs {
+			item := ingest.NewCodec(fmt.Sprint(i), fmt.Sprint(i), nil)
+			data, _ := item.Marshal()
+			msg := new(mocks.Message)
+			msg.On("Data").Return(data).
+				On("Header").Return(ingest.Header(nil)).
+				On("Ack", mock.Anything).Return(nil).Once()
+			msgs[i] = msg
+		}
+
+		q.On("PullSubscribe", "sub", "con").Return(sub, nil).Once()
+		sub.On("Pop", mock.Anything, 3).Return(msgs, nil).Once().
+			On("Pop", mock.Anything, 3).Return([]ingest.Message{}, nil).
+			On("Close").Return(nil).Once()
+		var inFlight, maxInFlight int32
+		s.On("Stat", mock.Anything, mock.Anything).Run(func(mock.Arguments) {
+			n := atomic.AddInt32(&inFlight, 1)
+			for m := atomic.LoadInt32(&maxInFlight); n > m && !atomic.CompareAndSwapInt32(&maxInFlight, m, n); m = atomic.LoadInt32(&maxInFlight) {
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&inFlight, -1)
+		}).Return((*storage.ObjectInfo)(nil), nil)
+
+		d := New("", c, s, q, nil, "str", "con", "sub", 3, 3, false, nil, prometheus.NewRegistry(), WithLimiter(NewLimiter(1)))
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		require.NoError(t, d.Dequeue(ctx))
+		// The limiter only allows one of the three concurrent transfers at a time.
+		assert.Equal(t, int32(1), atomic.LoadInt32(&maxInFlight))
+
+		q.AssertExpectations(t)
+		sub.AssertExpectations(t)
+		s.AssertNumberOfCalls(t, "Stat", 3)
+		for _, msg := range msgs {
+			msg.(*mocks.Message).AssertExpectations(t)
+		}
+	})
+	t.Run("server-side copy", func(t *testing.T) {
+		c := locatingClient{new(mocks.Client)}
+		q := new(mocks.Queue)
+		s := copyingStorage{new(mocks.Storage)}
+		sub := new(mocks.Subscription)
+		items := []ingest.Codec{ingest.NewCodec("a", "a", nil), ingest.NewCodec("b", "b", nil)}
+		items[0].Size = 64
+		msgs := make([]ingest.Message, len(items))
+		for i := range items {
+			data, _ := items[i].Marshal()
+			msg := new(mocks.Message)
+			msg.On("Data").Return(data).
+				On("Header").Return(ingest.Header(nil)).
+				On("Ack", mock.Anything).Return(nil).Once()
+			msgs[i] = msg
+		}
+
+		q.On("PullSubscribe", "sub", "con").Return(sub, nil).Once()
+		sub.On("Pop", mock.Anything, 1).Return(msgs[:1], nil).Once().
+			On("Pop", mock.Anything, 1).Return(msgs[1:], nil).Once().
+			On("Pop", mock.Anything, 1).Return([]ingest.Message{}, nil).
+			On("Close").Return(nil).Once()
+		s.On("Stat", mock.Anything, mock.Anything).Return((*storage.ObjectInfo)(nil), fs.ErrNotExist)
+
+		// The first object is copied without downloading it.
+		loc := &url.URL{Scheme: "s3", Host: "src", Path: "/a", RawQuery: "endpoint=s3.amazonaws.com"}
+		c.On("Locate", mock.Anything, items[0]).Return(loc, nil).Once()
+		s.On("CopyFrom", mock.Anything, items[0], loc).Return(&url.URL{Scheme: "s3", Host: "dst", Path: "a"}, nil).Once()
+		// The second object cannot be located, so it is downloaded and stored.
+		c.On("Locate", mock.Anything, items[1]).Return((*url.URL)(nil), nil).Once()
+		c.On("Download", mock.Anything, items[1]).Return(&ingest.Object{Reader: strings.NewReader("hello"), Len: 5}, nil).Once()
+		s.On("Store", mock.Anything, items[1], mock.Anything).Return(&url.URL{Scheme: "s3", Host: "dst", Path: "b"}, nil).Once()
+
+		h := new(runRecorder)
+		d := New("", c, s, q, h, "str", "con", "sub", 1, 1, false, nil, prometheus.NewRegistry())
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		require.NoError(t, d.Dequeue(ctx))
+
+		q.AssertExpectations(t)
+		sub.AssertExpectations(t)
+		s.AssertExpectations(t)
+		c.AssertExpectations(t)
+		for _, msg := range msgs {
+			msg.(*mocks.Message).AssertExpectations(t)
+		}
+		// The size of copied objects is recorded from their codecs.
+		require.Len(t, *h, 2)
+		assert.Equal(t, int64(64), (*h)[0].Bytes)
+		assert.Equal(t, int64(5), (*h)[1].Bytes)
+	})
+	t.Run("server-side copy not supported", func(t *testing.T) {
+		for _, tc := range []struct {
+			name string
+			err  error
+			// locates is the number of objects that are located.
+			locates int
+		}{
+			// Objects that cannot be copied are downloaded, but the following ones are still located.
+			{name: "object", err: storage.ErrCopyNotSupported, locates: 2},
+			// Once the storage cannot copy any object, objects are no longer located.
+			{name: "storage", err: storage.ErrCopyNotImplemented, locates: 1},
+		} {
+			c := locatingClient{new(mocks.Client)}
+			q := new(mocks.Queue)
+			s := copyingStorage{new(mocks.Storage)}
+			sub := new(mocks.Subscription)
+			items := []ingest.Codec{ingest.NewCodec("a", "a", nil), ingest.NewCodec("b", "b", nil)}
+			msgs := make([]ingest.Message, len(items))
+			for i := range items {
+				data, _ := items[i].Marshal()
+				msg := new(mocks.Message)
+				msg.On("Data").Return(data).
+					On("Header").Return(ingest.Header(nil)).
+					On("Ack", mock.Anything).Return(nil).Once()
+				msgs[i] = msg
+				c.On("Download", mock.Anything, items[i]).Return(&ingest.Object{Reader: strings.NewReader("hello"), Len: 5}, nil).Once()
+				s.On("Store", mock.Anything, items[i], mock.Anything).Return(&url.URL{Scheme: "s3", Host: "dst", Path: items[i].Name}, nil).Once()
+			}
+
+			q.On("PullSubscribe", "sub", "con").Return(sub, nil).Once()
+			sub.On("Pop", mock.Anything, 1).Return(msgs[:1], nil).Once().
+				On("Pop", mock.Anything, 1).Return(msgs[1:], nil).Once().
+				On("Pop", mock.Anything, 1).Return([]ingest.Message{}, nil).
+				On("Close").Return(nil).Once()
+			s.On("Stat", mock.Anything, mock.Anything).Return((*storage.ObjectInfo)(nil), fs.ErrNotExist)
+			loc := &url.URL{Scheme: "s3", Host: "src", Path: "/a", RawQuery: "endpoint=other.example.com"}
+			c.On("Locate", mock.Anything, items[0]).Return(loc, nil).Once()
+			s.On("CopyFrom", mock.Anything, items[0], loc).Return((*url.URL)(nil), tc.err).Once()
+			if tc.locates > 1 {
+				// Objects that cannot be located are downloaded, too.
+				c.On("Locate", mock.Anything, items[1]).Return((*url.URL)(nil), nil).Once()
+			}
+
+			d := New("", c, s, q, nil, "str", "con", "sub", 1, 1, false, nil, prometheus.NewRegistry())
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			require.NoError(t, d.Dequeue(ctx), tc.name)
+			cancel()
+
+			q.AssertExpectations(t)
+			sub.AssertExpectations(t)
+			s.AssertExpectations(t)
+			c.AssertExpectations(t)
+			c.AssertNumberOfCalls(t, "Locate", tc.locates)
+		}
+	})
+	t.Run("server-side copy not implemented by the source", func(t *testing.T) {
+		c := new(mocks.Client)
+		q := new(mocks.Queue)
+		s := copyingStorage{new(mocks.Storage)}
+		sub := new(mocks.Subscription)
+		item := ingest.NewCodec("a", "a", nil)
+		data, _ := item.Marshal()
+		msg := new(mocks.Message)
+		msg.On("Data").Return(data).
+			On("Header").Return(ingest.Header(nil)).
+			On("Ack", mock.Anything).Return(nil).Once()
+		c.On("Download", mock.Anything, item).Return(&ingest.Object{Reader: strings.NewReader("hello"), Len: 5}, nil).Once()
+		s.On("Stat", mock.Anything, item).Return((*storage.ObjectInfo)(nil), fs.ErrNotExist).
+			On("Store", mock.Anything, item, mock.Anything).Return(&url.URL{Scheme: "s3", Host: "dst", Path: item.Name}, nil).Once()
+		q.On("PullSubscribe", "sub", "con").Return(sub, nil).Once()
+		sub.On("Pop", mock.Anything, 1).Return([]ingest.Message{msg}, nil).Once().
+			On("Pop", mock.Anything, 1).Return([]ingest.Message{}, nil).
+			On("Close").Return(nil).Once()
+
+		d := New("", c, s, q, nil, "str", "con", "sub", 1, 1, false, nil, prometheus.NewRegistry())
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		require.NoError(t, d.Dequeue(ctx))
+		assert.Equal(t, int32(1), d.(*dequeuer).noCopy)
+
 		q.AssertExpectations(t)
 		sub.AssertExpectations(t)
 		s.AssertExpectations(t)
 		c.AssertExpectations(t)
+		s.AssertNotCalled(t, "CopyFrom", mock.Anything, mock.Anything, mock.Anything)
+	})
+	t.Run("failed messages", func(t *testing.T) {
+		reg := prometheus.NewRegistry()
+		c := new(mocks.Client)
+		q := new(mocks.Queue)
+		s := new(mocks.Storage)
+		sub := new(mocks.Subscription)
+		items := []ingest.Codec{ingest.NewCodec("a", "a", nil), ingest.NewCodec("b", "b", nil), ingest.NewCodec("c", "c", nil)}
+		msgs := make([]ingest.Message, len(items))
+		for i := range items {
+			data, _ := items[i].Marshal()
+			msg := new(mocks.Message)
+			msg.On("Data").Return(data).
+				On("Header").Return(ingest.Header{ingest.HeaderID: items[i].ID})
+			msgs[i] = msg
+			c.On("Download", mock.Anything, items[i]).Return((*ingest.Object)(nil), fmt.Errorf("unavailable")).Once()
+		}
+		// The first message is delivered again after the delay of its second delivery.
+		a := nakingMessage{msgs[0].(*mocks.Message)}
+		a.On("Deliveries").Return(2).
+			On("Nak", mock.Anything, time.Minute).Return(nil).Once()
+		msgs[0] = a
+		// The second message was delivered for the last time.
+		b := nakingMessage{msgs[1].(*mocks.Message)}
+		b.On("Deliveries").Return(3).
+			On("Ack", mock.Anything).Return(nil).Once()
+		msgs[1] = b
+		// The queue of the third message cannot deliver it again.
+		msgs[2].(*mocks.Message).On("Ack", mock.Anything).Return(nil).Once()
+		q.On("Publish", "dead", mock.Anything, ingest.Header{ingest.HeaderID: "dead-letter:b"}).Return(nil).Once().
+			On("Publish", "dead", mock.Anything, ingest.Header{ingest.HeaderID: "dead-letter:c"}).Return(nil).Once()
+
+		q.On("PullSubscribe", "sub", "con").Return(sub, nil).Once()
+		sub.On("Pop", mock.Anything, 3).Return(msgs, nil).Once().
+			On("Pop", mock.Anything, 3).Return([]ingest.Message{}, nil).
+			On("Close").Return(nil).Once()
+		s.On("Stat", mock.Anything, mock.Anything).Return((*storage.ObjectInfo)(nil), fs.ErrNotExist)
+
+		d := New("", c, s, q, nil, "str", "con", "sub", 3, 3, false, nil, reg, WithRedelivery(3, time.Second, time.Minute), WithDeadLetter("dead"), WithRetries(0, 0, 0))
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		require.NoError(t, d.Dequeue(ctx))
+
+		q.AssertExpectations(t)
+		sub.AssertExpectations(t)
+		c.AssertExpectations(t)
+		for _, msg := range []*mocks.Message{a.Message, b.Message, msgs[2].(*mocks.Message)} {
+			msg.AssertExpectations(t)
+		}
+		a.AssertNotCalled(t, "Ack", mock.Anything)
+		b.AssertNotCalled(t, "Nak", mock.Anything, mock.Anything)
+		n, err := testutil.GatherAndCount(reg, "ingest_dequeue_failed_messages_total")
+		require.NoError(t, err)
+		assert.Equal(t, 3, n)
+		failed := d.(*dequeuer).failedMessagesTotal
+		assert.Equal(t, float64(1), testutil.ToFloat64(failed.WithLabelValues(actionNak)))
+		assert.Equal(t, float64(2), testutil.ToFloat64(failed.WithLabelValues(actionDeadLetter)))
+		assert.Zero(t, testutil.ToFloat64(failed.WithLabelValues(actionDrop)))
 	})
+	t.Run("corrupted messages", func(t *testing.T) {
+		c := new(mocks.Client)
+		q := new(mocks.Queue)
+		s := new(mocks.Storage)
+		sub := new(mocks.Subscription)
+		item := ingest.NewCodec("a", "a", nil)
+		data, _ := item.Marshal()
+		sum := sha256.Sum256(data)
+		good := new(mocks.Message)
+		good.On("Data").Return(data).
+			On("Header").Return(ingest.Header{ingest.HeaderID: "a", ingest.HeaderHash: "sha256:" + hex.EncodeToString(sum[:])}).
+			On("Ack", mock.Anything).Return(nil).Once()
+		// The data of the second message does not match its hash.
+		bad := new(mocks.Message)
+		bad.On("Data").Return([]byte(`{"id":"b"`)).
+			On("Header").Return(ingest.Header{ingest.HeaderID: "b", ingest.HeaderHash: "sha256:" + hex.EncodeToString(sum[:])}).
+			On("Ack", mock.Anything).Return(nil).Once()
+		q.On("Publish", "dead", []byte(`{"id":"b"`), mock.MatchedBy(func(h ingest.Header) bool { return h[ingest.HeaderID] == "dead-letter:b" })).Return(nil).Once()
+
+		q.On("PullSubscribe", "sub", "con").Return(sub, nil).Once()
+		sub.On("Pop", mock.Anything, 2).Return([]ingest.Message{good, bad}, nil).Once().
+			On("Pop", mock.Anything, 2).Return([]ingest.Message{}, nil).
+			On("Close").Return(nil).Once()
+		s.On("Stat", mock.Anything, item).Return((*storage.ObjectInfo)(nil), fs.ErrNotExist).Once()
+		// The good message is still transferred after the corrupted message failed.
+		c.On("Download", mock.Anything, item).Return(&ingest.Object{Reader: strings.NewReader("hello"), Len: 5}, nil).WaitUntil(time.After(20 * time.Millisecond)).Once()
+		s.On("Store", mock.Anything, item, mock.Anything).Run(func(args mock.Arguments) {
+			assert.NoError(t, args.Get(0).(context.Context).Err())
+		}).Return(&url.URL{Scheme: "s3", Host: "dst", Path: "/a"}, nil).Once()
+
+		d := New("", c, s, q, nil, "str", "con", "sub", 2, 2, false, nil, prometheus.NewRegistry(), WithDeadLetter("dead"))
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		require.NoError(t, d.Dequeue(ctx))
+
+		q.AssertExpectations(t)
+		sub.AssertExpectations(t)
+		good.AssertExpectations(t)
+		bad.AssertExpectations(t)
+		s.AssertExpectations(t)
+		c.AssertExpectations(t)
+		assert.Equal(t, float64(1), testutil.ToFloat64(d.(*dequeuer).failedMessagesTotal.WithLabelValues(actionDeadLetter)))
+	})
+	t.Run("retries", func(t *testing.T) {
+		reg := prometheus.NewRegistry()
+		c := new(mocks.Client)
+		q := new(mocks.Queue)
+		s := new(mocks.Storage)
+		sub := new(mocks.Subscription)
+		item := ingest.NewCodec("a", "a", nil)
+		data, _ := item.Marshal()
+		msg := new(mocks.Message)
+		msg.On("Data").Return(data).
+			On("Header").Return(ingest.Header(nil)).
+			On("Ack", mock.Anything).Return(nil).Once()
+
+		q.On("PullSubscribe", "sub", "con").Return(sub, nil).Once()
+		sub.On("Pop", mock.Anything, 1).Return([]ingest.Message{msg}, nil).Once().
+			On("Pop", mock.Anything, 1).Return([]ingest.Message{}, nil).
+			On("Close").Return(nil).Once()
+		s.On("Stat", mock.Anything, item).Return((*storage.ObjectInfo)(nil), fs.ErrNotExist).Twice()
+		// The first download fails transiently and is retried.
+		c.On("Download", mock.Anything, item).Return((*ingest.Object)(nil), fmt.Errorf("503 Service Unavailable")).Once().
+			On("Download", mock.Anything, item).Return(&ingest.Object{Reader: strings.NewReader("hello"), Len: 5}, nil).Once()
+		s.On("Store", mock.Anything, item, mock.Anything).Return(&url.URL{Scheme: "s3", Host: "dst", Path: "/a"}, nil).Once()
+
+		d := New("", c, s, q, nil, "str", "con", "sub", 1, 1, false, nil, reg, WithRetries(2, time.Millisecond, 2*time.Millisecond))
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		require.NoError(t, d.Dequeue(ctx))
+
+		q.AssertExpectations(t)
+		sub.AssertExpectations(t)
+		msg.AssertExpectations(t)
+		s.AssertExpectations(t)
+		c.AssertExpectations(t)
+		assert.Equal(t, float64(1), testutil.ToFloat64(d.(*dequeuer).retriesTotal))
+		assert.Equal(t, float64(1), testutil.ToFloat64(d.(*dequeuer).dequeueAttemptsTotal.WithLabelValues("error")))
+		assert.Equal(t, float64(1), testutil.ToFloat64(d.(*dequeuer).dequeueAttemptsTotal.WithLabelValues("success")))
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	d := &dequeuer{retryWait: 100 * time.Millisecond, maxRetryWait: time.Second}
+	for i, max := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second} {
+		w := d.backoff(i)
+		assert.GreaterOrEqual(t, w, max/2)
+		assert.LessOrEqual(t, w, max)
+	}
+	assert.LessOrEqual(t, d.backoff(100), time.Second)
+}
+
+// nakingMessage is a message whose queue can deliver it again.
+type nakingMessage struct {
+	*mocks.Message
+}
+
+func (m nakingMessage) Nak(ctx context.Context, delay time.Duration) error {
+	return m.Called(ctx, delay).Error(0)
+}
+
+func (m nakingMessage) Deliveries() int {
+	return m.Called().Int(0)
+}
+
+// locatingClient is a client whose objects can be addressed with URIs.
+type locatingClient struct {
+	*mocks.Client
+}
+
+func (c locatingClient) Locate(ctx context.Context, item ingest.Codec) (*url.URL, error) {
+	args := c.Called(ctx, item)
+	return args.Get(0).(*url.URL), args.Error(1)
+}
+
+// copyingStorage is a storage that can copy objects from URIs.
+type copyingStorage struct {
+	*mocks.Storage
+}
+
+func (s copyingStorage) CopyFrom(ctx context.Context, element ingest.Codec, uri *url.URL) (*url.URL, error) {
+	args := s.Called(ctx, element, uri)
+	return args.Get(0).(*url.URL), args.Error(1)
+}
+
+// runRecorder records runs in memory.
+type runRecorder []history.Run
+
+func (r *runRecorder) Record(_ context.Context, run history.Run) error {
+	*r = append(*r, run)
+	return nil
+}
+
+type fakeInspector queue.ConsumerStats
+
+func (f fakeInspector) ConsumerStats(_ context.Context, _, _ string) (*queue.ConsumerStats, error) {
+	s := queue.ConsumerStats(f)
+	return &s, nil
 }
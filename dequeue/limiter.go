@@ -0,0 +1,29 @@
+package dequeue
+
+import "context"
+
+// Limiter limits the number of elements that several dequeuers
+// download and store at the same time, e.g. to avoid saturating the network.
+type Limiter struct {
+	slots chan struct{}
+}
+
+// NewLimiter creates a Limiter that allows n transfers at the same time.
+func NewLimiter(n int) *Limiter {
+	return &Limiter{slots: make(chan struct{}, n)}
+}
+
+// acquire blocks until another transfer is allowed or ctx is done.
+func (l *Limiter) acquire(ctx context.Context) error {
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release ends a transfer.
+func (l *Limiter) release() {
+	<-l.slots
+}
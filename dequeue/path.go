@@ -0,0 +1,94 @@
+package dequeue
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/connylabs/ingest"
+)
+
+// PathData is the data with which path templates are executed.
+type PathData struct {
+	ingest.Codec
+	// Source and Workflow are the names of the source and the workflow of the element.
+	Source   string
+	Workflow string
+	// Time is the time at which the element was enqueued, or the time at which it is dequeued
+	// if the message does not carry the time at which it was enqueued.
+	Time time.Time
+	// Date is the day of Time in UTC, e.g. 2006-01-02.
+	Date string
+}
+
+var pathFuncs = template.FuncMap{
+	"base":  path.Base,
+	"dir":   path.Dir,
+	"ext":   path.Ext,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+// ParsePathTemplate parses a template that produces the name under which an element is stored, e.g. {{ .Date }}/{{ .Source }}/{{ .Name }}.
+// The template is executed with PathData and can use the functions base, dir, ext, lower and upper.
+func ParsePathTemplate(text string) (*template.Template, error) {
+	t, err := template.New("path").Funcs(pathFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	// Catch references to fields that do not exist before the first element is stored.
+	if _, err := executePathTemplate(t, PathData{Codec: ingest.Codec{Name: "name"}}); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// WithPathTemplate stores every element under the name that the template produces
+// for the element and the given names of its source and workflow.
+// The template should be parsed with ParsePathTemplate.
+func WithPathTemplate(t *template.Template, source, workflow string) Option {
+	return func(d *dequeuer) {
+		d.pathTemplate = t
+		d.pathSource = source
+		d.pathWorkflow = workflow
+	}
+}
+
+// destination returns the element under whose name the item is stored.
+func (d *dequeuer) destination(item ingest.Codec, h ingest.Header) (ingest.Codec, error) {
+	if d.pathTemplate == nil {
+		return item, nil
+	}
+	data := PathData{Codec: item, Source: d.pathSource, Workflow: d.pathWorkflow, Time: time.Now()}
+	if v, ok := h[ingest.HeaderEnqueuedAt]; ok {
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			data.Time = t
+		}
+	}
+	data.Date = data.Time.UTC().Format("2006-01-02")
+	name, err := executePathTemplate(d.pathTemplate, data)
+	if err != nil {
+		return item, err
+	}
+	item.Name = name
+	return item, nil
+}
+
+func executePathTemplate(t *template.Template, data PathData) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to execute path template: %w", err)
+	}
+	name := strings.TrimPrefix(path.Clean(buf.String()), "/")
+	if name == "" || name == "." {
+		return "", errors.New("path template produced an empty name")
+	}
+	if name == ".." || strings.HasPrefix(name, "../") {
+		return "", fmt.Errorf("path template produced the name %q outside of the destination", name)
+	}
+	return name, nil
+}
@@ -2,9 +2,13 @@ package enqueue
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"regexp"
+	"time"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
@@ -12,21 +16,81 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promauto"
 
 	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/history"
+	"github.com/connylabs/ingest/queue"
+	"github.com/connylabs/ingest/state"
 )
 
+// dependencyInterval is the duration between two checks of the consumers of the dependencies.
+var dependencyInterval = 10 * time.Second
+
+// nextBatchSize is the maximum number of items that are listed with one call of a Nexter that implements ingest.BatchNexter.
+const nextBatchSize = 100
+
 type enqueuer struct {
 	q                    ingest.Queue
 	n                    ingest.Nexter
 	l                    log.Logger
+	h                    history.Recorder
 	queueSubject         string
+	priority             *regexp.Regexp
+	prioritySubject      string
+	filter               *Filter
+	header               ingest.Header
+	checkpoints          state.Checkpoints
+	restored             bool
+	inspector            queue.Inspector
+	dependencies         map[string]string
 	enqueueAttemptsTotal *prometheus.CounterVec
 }
 
+// Option configures an ingest.Enqueuer.
+type Option func(*enqueuer)
+
+// WithPriority publishes the elements whose names match the pattern
+// to the given priority subject instead of the queue subject.
+func WithPriority(pattern *regexp.Regexp, subject string) Option {
+	return func(e *enqueuer) {
+		e.priority = pattern
+		e.prioritySubject = subject
+	}
+}
+
+// WithHeader adds the given header to every published message,
+// e.g. the names of the source and the workflow.
+func WithHeader(header ingest.Header) Option {
+	return func(e *enqueuer) {
+		e.header = header
+	}
+}
+
+// WithCheckpoints persists the checkpoint of the Nexter if it implements ingest.Checkpointer.
+func WithCheckpoints(c state.Checkpoints) Option {
+	return func(e *enqueuer) {
+		e.checkpoints = c
+	}
+}
+
+// WithDependencies delays every run of the enqueuer until the given durable consumers,
+// which are mapped to their subjects, have no messages that are pending or not yet acknowledged,
+// e.g. so that a workflow only lists the elements that an upstream workflow stored once it is drained.
+// If the consumers are not drained before the context of the run is done, then the run is skipped.
+func WithDependencies(i queue.Inspector, consumers map[string]string) Option {
+	return func(e *enqueuer) {
+		e.inspector = i
+		e.dependencies = consumers
+	}
+}
+
 // New creates new ingest.Enqueuer.
-func New(n ingest.Nexter, queueSubject string, q ingest.Queue, r prometheus.Registerer, l log.Logger) (ingest.Enqueuer, error) {
+// Every run of Enqueue is recorded with the given history.Recorder, which may be nil.
+func New(n ingest.Nexter, queueSubject string, q ingest.Queue, h history.Recorder, r prometheus.Registerer, l log.Logger, opts ...Option) (ingest.Enqueuer, error) {
 	if l == nil {
 		l = log.NewNopLogger()
 	}
+	if h == nil {
+		h = history.NewNopRecorder()
+	}
 
 	enqueueAttemptsTotal := promauto.With(r).NewCounterVec(prometheus.CounterOpts{
 		Name: "ingest_enqueue_attempts_total",
@@ -37,20 +101,41 @@ func New(n ingest.Nexter, queueSubject string, q ingest.Queue, r prometheus.Regi
 		enqueueAttemptsTotal.WithLabelValues(r).Add(0)
 	}
 
-	return &enqueuer{
+	e := &enqueuer{
 		q:                    q,
 		n:                    n,
 		l:                    l,
+		h:                    h,
 		queueSubject:         queueSubject,
 		enqueueAttemptsTotal: enqueueAttemptsTotal,
-	}, nil
+	}
+	for _, o := range opts {
+		o(e)
+	}
+	return e, nil
 }
 
 // Enqueue will add all of the objects that the Nexter will produce into the queue.
 // Note: Enqueue is not safe to call concurrently because it modifies the state
 // of a single, shared Nexter.
 func (e *enqueuer) Enqueue(ctx context.Context) error {
-	if err := e.enqueue(ctx); err != nil {
+	if err := e.waitForDependencies(ctx); err != nil {
+		level.Info(e.l).Log("msg", "skipping run because the dependencies were not drained", "err", err.Error())
+		return nil
+	}
+	run := history.Run{Mode: history.ModeEnqueue, Start: time.Now()}
+	count, err := e.enqueue(ctx)
+	run.End = time.Now()
+	run.Count = count
+	if err != nil {
+		run.Errors = 1
+		run.Error = err.Error()
+	}
+	if err := e.h.Record(ctx, run); err != nil {
+		level.Warn(e.l).Log("msg", "failed to record run", "err", err.Error())
+	}
+
+	if err != nil {
 		e.enqueueAttemptsTotal.WithLabelValues("error").Inc()
 		level.Error(e.l).Log("msg", "failed to get next item", "err", err.Error())
 		return err
@@ -60,34 +145,129 @@ func (e *enqueuer) Enqueue(ctx context.Context) error {
 	return nil
 }
 
+// waitForDependencies returns when the consumers of the dependencies are drained
+// or with an error when ctx is done.
+func (e *enqueuer) waitForDependencies(ctx context.Context) error {
+	if e.inspector == nil {
+		return nil
+	}
+	for waiting := false; ; waiting = true {
+		drained, err := e.drained(ctx)
+		if err != nil {
+			level.Warn(e.l).Log("msg", "failed to check dependencies", "err", err.Error())
+		} else if drained {
+			return nil
+		} else if !waiting {
+			level.Info(e.l).Log("msg", "waiting for the dependencies to be drained")
+		}
+		t := time.NewTimer(dependencyInterval)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// drained checks whether the consumers of the dependencies have no pending or unacknowledged messages.
+// Consumers that do not exist yet are not drained, because their workflows did not run yet.
+func (e *enqueuer) drained(ctx context.Context) (bool, error) {
+	for durable, subject := range e.dependencies {
+		s, err := e.inspector.ConsumerStats(ctx, subject, durable)
+		if err != nil {
+			return false, fmt.Errorf("failed to get statistics of consumer %q: %w", durable, err)
+		}
+		if s == nil || s.Pending != 0 || s.AckPending != 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
 // enqueue will add all of the objects that the Nexter will produce into the queue.
+// It returns the number of published items.
 // Note: Enqueue is not safe to call concurrently because it modifies the state
 // of a single, shared Nexter.
-func (e *enqueuer) enqueue(ctx context.Context) error {
+func (e *enqueuer) enqueue(ctx context.Context) (int, error) {
+	cp, _ := e.n.(ingest.Checkpointer)
+	if cp != nil && e.checkpoints != nil && !e.restored {
+		c, err := e.checkpoints.Load(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("failed to load checkpoint: %w", err)
+		}
+		if c != nil {
+			if err := cp.Restore(ctx, c); err != nil {
+				return 0, fmt.Errorf("failed to restore checkpoint: %w", err)
+			}
+		}
+		e.restored = true
+	}
 	if err := e.n.Reset(ctx); err != nil {
-		return fmt.Errorf("failed to reset nexter: %w", err)
+		return 0, fmt.Errorf("failed to reset nexter: %w", err)
 	}
 	level.Info(e.l).Log("msg", "getting next items from source")
 
-	codec, err := e.n.Next(ctx)
-	count := 0
-	for ; err == nil; codec, err = e.n.Next(ctx) {
-		data, err := codec.Marshal()
-		if err != nil {
-			return fmt.Errorf("failed to marshal retrieved item: %w", err)
-		}
+	count, filtered := 0, 0
+	var err error
+	for err == nil {
+		// Nexters that implement ingest.BatchNexter list a page of items with one call.
+		var codecs []ingest.Codec
+		codecs, err = ingest.NextN(ctx, e.n, nextBatchSize)
+		for i := range codecs {
+			codec := &codecs[i]
+			if e.filter != nil && !e.filter.Match(codec, time.Now()) {
+				filtered++
+				continue
+			}
+			data, err := codec.Marshal()
+			if err != nil {
+				return count, fmt.Errorf("failed to marshal retrieved item: %w", err)
+			}
 
-		if err := e.q.Publish(e.queueSubject, data); err != nil {
-			return fmt.Errorf("failed to publish item to queue: %w", err)
+			subject := e.queueSubject
+			if e.priority != nil && e.priority.MatchString(codec.Name) {
+				subject = e.prioritySubject
+			}
+			if err := e.q.Publish(subject, data, e.messageHeader(codec.ID, data)); err != nil {
+				return count, fmt.Errorf("failed to publish item to queue: %w", err)
+			}
+			count++
 		}
-		count++
 	}
 
 	if errors.Is(err, io.EOF) {
-		level.Info(e.l).Log("msg", "successfully enqueued items", "items", count)
+		level.Info(e.l).Log("msg", "successfully enqueued items", "items", count, "filtered", filtered)
 
-		return nil
+		if cp != nil && e.checkpoints != nil {
+			// Only complete listings are checkpointed, so that a failed listing is repeated.
+			c, err := cp.Checkpoint(ctx)
+			if err != nil {
+				return count, fmt.Errorf("failed to get checkpoint: %w", err)
+			}
+			if c != nil {
+				if err := e.checkpoints.Save(ctx, c); err != nil {
+					return count, fmt.Errorf("failed to save checkpoint: %w", err)
+				}
+			}
+		}
+		return count, nil
 	}
 
-	return fmt.Errorf("failed to get next item: %w", err)
+	return count, fmt.Errorf("failed to get next item: %w", err)
+}
+
+// messageHeader returns the header of the message for the element with the given ID and data.
+// The ID of the element identifies the message, so that queues can drop
+// duplicates when the same element is listed again before it was synchronized.
+func (e *enqueuer) messageHeader(id string, data []byte) ingest.Header {
+	h := make(ingest.Header, len(e.header)+3)
+	for k, v := range e.header {
+		h[k] = v
+	}
+	sum := sha256.Sum256(data)
+	h[ingest.HeaderID] = id
+	h[ingest.HeaderEnqueuedAt] = time.Now().UTC().Format(time.RFC3339Nano)
+	h[ingest.HeaderHash] = "sha256:" + hex.EncodeToString(sum[:])
+	return h
 }
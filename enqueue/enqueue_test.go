@@ -2,10 +2,14 @@ package enqueue
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"io"
 	"os"
+	"regexp"
 	"testing"
+	"time"
 
 	"github.com/go-kit/log"
 	"github.com/prometheus/client_golang/prometheus"
@@ -16,8 +20,80 @@ import (
 
 	"github.com/connylabs/ingest"
 	"github.com/connylabs/ingest/mocks"
+	"github.com/connylabs/ingest/queue"
 )
 
+// withID matches the header of a message with the given ID.
+func withID(id string) interface{} {
+	return mock.MatchedBy(func(h ingest.Header) bool {
+		return h[ingest.HeaderID] == id
+	})
+}
+
+// checkpointNexter is a Nexter that implements ingest.Checkpointer.
+type checkpointNexter struct {
+	*mocks.Nexter
+	restored   [][]byte
+	checkpoint []byte
+}
+
+func (n *checkpointNexter) Checkpoint(context.Context) ([]byte, error) {
+	return n.checkpoint, nil
+}
+
+func (n *checkpointNexter) Restore(_ context.Context, c []byte) error {
+	n.restored = append(n.restored, c)
+	return nil
+}
+
+// pageNexter is a Nexter that implements ingest.BatchNexter and returns the given pages in order.
+type pageNexter struct {
+	*mocks.Nexter
+	pages [][]ingest.Codec
+}
+
+func (n *pageNexter) NextN(_ context.Context, size int) ([]ingest.Codec, error) {
+	page := n.pages[0]
+	n.pages = n.pages[1:]
+	if len(page) > size {
+		return nil, errors.New("page is too large")
+	}
+	if len(n.pages) == 0 {
+		return page, io.EOF
+	}
+	return page, nil
+}
+
+// sequenceInspector returns the given statistics in order and then the last one repeatedly.
+type sequenceInspector struct {
+	stats []*queue.ConsumerStats
+	calls int
+}
+
+func (i *sequenceInspector) ConsumerStats(_ context.Context, subject, durable string) (*queue.ConsumerStats, error) {
+	if subject != "sub.up" || durable != "up" {
+		return nil, errors.New("unknown consumer")
+	}
+	s := i.stats[i.calls]
+	if i.calls < len(i.stats)-1 {
+		i.calls++
+	}
+	return s, nil
+}
+
+type memoryCheckpoints struct {
+	c []byte
+}
+
+func (m *memoryCheckpoints) Load(context.Context) ([]byte, error) {
+	return m.c, nil
+}
+
+func (m *memoryCheckpoints) Save(_ context.Context, c []byte) error {
+	m.c = c
+	return nil
+}
+
 func TestEnqueue(t *testing.T) {
 	for _, tc := range []struct {
 		name   string
@@ -49,7 +125,7 @@ func TestEnqueue(t *testing.T) {
 				t := ingest.NewCodec("foo", "foo", []byte(`{"key":"value"}`))
 				data, _ := t.Marshal()
 				q := new(mocks.Queue)
-				q.On("Publish", "sub", data).Return(nil).Once()
+				q.On("Publish", "sub", data, withID("foo")).Return(nil).Once()
 				n := new(mocks.Nexter)
 				n.On("Reset", mock.Anything).Return(nil).
 					On("Next", mock.Anything).Once().Return(&t, nil).
@@ -66,8 +142,8 @@ func TestEnqueue(t *testing.T) {
 				data2, _ := t2.Marshal()
 				q := new(mocks.Queue)
 				q.
-					On("Publish", "sub", data).Return(nil).Once().
-					On("Publish", "sub", data2).Return(nil).Once()
+					On("Publish", "sub", data, withID("foo")).Return(nil).Once().
+					On("Publish", "sub", data2, withID("foo2")).Return(nil).Once()
 				n := new(mocks.Nexter)
 				n.
 					On("Reset", mock.Anything).Return(nil).Once().
@@ -85,7 +161,7 @@ func TestEnqueue(t *testing.T) {
 
 			q, n, _ := tc.expect()
 
-			e, err := New(n, "sub", q, reg, logger)
+			e, err := New(n, "sub", q, nil, reg, logger)
 			assert.NoError(t, err)
 			assert.NoError(t, e.Enqueue(ctx))
 
@@ -112,7 +188,7 @@ func TestEnqueue(t *testing.T) {
 		eerr := errors.New("some error")
 		n.On("Reset", mock.Anything).Return(eerr).Once()
 
-		e, err := New(n, "sub", q, reg, logger)
+		e, err := New(n, "sub", q, nil, reg, logger)
 		if err != nil {
 			t.Error(err)
 		}
@@ -124,4 +200,157 @@ func TestEnqueue(t *testing.T) {
 		require.Nil(t, err)
 		assert.Equal(2, c)
 	})
+	t.Run("priority", func(t *testing.T) {
+		t1 := ingest.NewCodec("foo", "legal-hold/foo", nil)
+		data1, _ := t1.Marshal()
+		t2 := ingest.NewCodec("bar", "bulk/bar", nil)
+		data2, _ := t2.Marshal()
+		q := new(mocks.Queue)
+		q.
+			On("Publish", "sub.priority", data1, withID("foo")).Return(nil).Once().
+			On("Publish", "sub", data2, withID("bar")).Return(nil).Once()
+		n := new(mocks.Nexter)
+		n.
+			On("Reset", mock.Anything).Return(nil).Once().
+			On("Next", mock.Anything).Return(&t1, nil).Once().
+			On("Next", mock.Anything).Return(&t2, nil).Once().
+			On("Next", mock.Anything).Return(nil, io.EOF).Once()
+
+		e, err := New(n, "sub", q, nil, prometheus.NewRegistry(), nil, WithPriority(regexp.MustCompile("^legal-hold/"), "sub.priority"))
+		require.NoError(t, err)
+		assert.NoError(t, e.Enqueue(context.Background()))
+
+		n.AssertExpectations(t)
+		q.AssertExpectations(t)
+	})
+	t.Run("filter", func(t *testing.T) {
+		t1 := ingest.NewCodec("foo", "foo.csv", nil)
+		data1, _ := t1.Marshal()
+		t2 := ingest.NewCodec("bar", "bar.json", nil)
+		q := new(mocks.Queue)
+		q.On("Publish", "sub", data1, withID("foo")).Return(nil).Once()
+		n := new(mocks.Nexter)
+		n.
+			On("Reset", mock.Anything).Return(nil).Once().
+			On("Next", mock.Anything).Return(&t1, nil).Once().
+			On("Next", mock.Anything).Return(&t2, nil).Once().
+			On("Next", mock.Anything).Return(nil, io.EOF).Once()
+
+		e, err := New(n, "sub", q, nil, prometheus.NewRegistry(), nil, WithFilter(&Filter{Names: []string{"*.csv"}}))
+		require.NoError(t, err)
+		assert.NoError(t, e.Enqueue(context.Background()))
+
+		n.AssertExpectations(t)
+		q.AssertExpectations(t)
+	})
+	t.Run("header", func(t *testing.T) {
+		c := ingest.NewCodec("foo", "foo", nil)
+		data, _ := c.Marshal()
+		var header ingest.Header
+		q := new(mocks.Queue)
+		q.On("Publish", "sub", data, mock.Anything).Run(func(args mock.Arguments) {
+			header = args.Get(2).(ingest.Header)
+		}).Return(nil).Once()
+		n := new(mocks.Nexter)
+		n.
+			On("Reset", mock.Anything).Return(nil).Once().
+			On("Next", mock.Anything).Return(&c, nil).Once().
+			On("Next", mock.Anything).Return(nil, io.EOF).Once()
+
+		start := time.Now()
+		e, err := New(n, "sub", q, nil, prometheus.NewRegistry(), nil, WithHeader(ingest.Header{ingest.HeaderSource: "s3", ingest.HeaderWorkflow: "wf"}))
+		require.NoError(t, err)
+		require.NoError(t, e.Enqueue(context.Background()))
+		q.AssertExpectations(t)
+
+		sum := sha256.Sum256(data)
+		assert.Equal(t, "foo", header[ingest.HeaderID])
+		assert.Equal(t, "s3", header[ingest.HeaderSource])
+		assert.Equal(t, "wf", header[ingest.HeaderWorkflow])
+		assert.Equal(t, "sha256:"+hex.EncodeToString(sum[:]), header[ingest.HeaderHash])
+		at, err := time.Parse(time.RFC3339Nano, header[ingest.HeaderEnqueuedAt])
+		require.NoError(t, err)
+		assert.False(t, at.Before(start.Truncate(time.Second)))
+	})
+	t.Run("batches", func(t *testing.T) {
+		t1 := ingest.NewCodec("foo", "foo", nil)
+		data1, _ := t1.Marshal()
+		t2 := ingest.NewCodec("bar", "bar", nil)
+		data2, _ := t2.Marshal()
+		t3 := ingest.NewCodec("baz", "baz", nil)
+		data3, _ := t3.Marshal()
+		q := new(mocks.Queue)
+		q.
+			On("Publish", "sub", data1, withID("foo")).Return(nil).Once().
+			On("Publish", "sub", data2, withID("bar")).Return(nil).Once().
+			On("Publish", "sub", data3, withID("baz")).Return(nil).Once()
+		// Next is never called, because the pages are listed with NextN.
+		n := &pageNexter{Nexter: new(mocks.Nexter), pages: [][]ingest.Codec{{t1, t2}, {t3}}}
+		n.On("Reset", mock.Anything).Return(nil).Once()
+
+		e, err := New(n, "sub", q, nil, prometheus.NewRegistry(), nil)
+		require.NoError(t, err)
+		assert.NoError(t, e.Enqueue(context.Background()))
+
+		n.AssertExpectations(t)
+		q.AssertExpectations(t)
+	})
+	t.Run("checkpoints", func(t *testing.T) {
+		c := ingest.NewCodec("foo", "foo", nil)
+		data, _ := c.Marshal()
+		q := new(mocks.Queue)
+		q.On("Publish", "sub", data, withID("foo")).Return(nil).Once()
+		n := &checkpointNexter{Nexter: new(mocks.Nexter), checkpoint: []byte("2")}
+		n.
+			On("Reset", mock.Anything).Return(nil).Twice().
+			On("Next", mock.Anything).Return(&c, nil).Once().
+			On("Next", mock.Anything).Return(nil, io.EOF).Once().
+			On("Next", mock.Anything).Return(nil, errors.New("some error")).Once()
+		cs := &memoryCheckpoints{c: []byte("1")}
+
+		e, err := New(n, "sub", q, nil, prometheus.NewRegistry(), nil, WithCheckpoints(cs))
+		require.NoError(t, err)
+		require.NoError(t, e.Enqueue(context.Background()))
+		assert.Equal(t, [][]byte{[]byte("1")}, n.restored)
+		assert.Equal(t, "2", string(cs.c))
+
+		// Failed listings are not checkpointed and the checkpoint is only restored once.
+		n.checkpoint = []byte("3")
+		assert.Error(t, e.Enqueue(context.Background()))
+		assert.Len(t, n.restored, 1)
+		assert.Equal(t, "2", string(cs.c))
+
+		n.AssertExpectations(t)
+		q.AssertExpectations(t)
+	})
+	t.Run("dependencies", func(t *testing.T) {
+		dependencyInterval = time.Millisecond
+		t.Cleanup(func() { dependencyInterval = 10 * time.Second })
+		c := ingest.NewCodec("foo", "foo", nil)
+		data, _ := c.Marshal()
+		q := new(mocks.Queue)
+		q.On("Publish", "sub", data, withID("foo")).Return(nil).Once()
+		n := new(mocks.Nexter)
+		n.
+			On("Reset", mock.Anything).Return(nil).Once().
+			On("Next", mock.Anything).Return(&c, nil).Once().
+			On("Next", mock.Anything).Return(nil, io.EOF).Once()
+		i := &sequenceInspector{stats: []*queue.ConsumerStats{nil, {Pending: 1}, {AckPending: 1}, {}}}
+
+		e, err := New(n, "sub", q, nil, prometheus.NewRegistry(), nil, WithDependencies(i, map[string]string{"up": "sub.up"}))
+		require.NoError(t, err)
+		require.NoError(t, e.Enqueue(context.Background()))
+		assert.Equal(t, 3, i.calls)
+		n.AssertExpectations(t)
+		q.AssertExpectations(t)
+
+		// Runs are skipped while the dependencies are not drained.
+		i = &sequenceInspector{stats: []*queue.ConsumerStats{{Pending: 1}}}
+		e, err = New(n, "sub", q, nil, prometheus.NewRegistry(), nil, WithDependencies(i, map[string]string{"up": "sub.up"}))
+		require.NoError(t, err)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		require.NoError(t, e.Enqueue(ctx))
+		n.AssertExpectations(t)
+	})
 }
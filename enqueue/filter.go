@@ -0,0 +1,82 @@
+package enqueue
+
+import (
+	"mime"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/connylabs/ingest"
+)
+
+// Filter selects the elements that the enqueuer publishes.
+// Every field that is set must match an element; the zero value matches all elements.
+// Elements whose source does not report their size or modification time
+// have a size of 0 and are never modified after a given time.
+type Filter struct {
+	// Names are glob patterns, e.g. *.csv, that match the name of the element or its base name.
+	// At least one of them must match.
+	Names []string
+	// Pattern is a regular expression that must match the name of the element.
+	Pattern *regexp.Regexp
+	// MinSize and MaxSize bound the size of the element in bytes. A MaxSize of 0 means no limit.
+	MinSize, MaxSize int64
+	// MimeTypes are MIME types, e.g. text/csv or image/*, of which the element must have one.
+	// If the source does not report the MIME type, then it is derived from the extension of the name.
+	MimeTypes []string
+	// ModifiedAfter is the time after which the element must have been modified.
+	ModifiedAfter time.Time
+	// ModifiedWithin is the duration before the listing within which the element must have been modified.
+	ModifiedWithin time.Duration
+}
+
+// WithFilter only publishes the elements that match the filter.
+func WithFilter(f *Filter) Option {
+	return func(e *enqueuer) {
+		e.filter = f
+	}
+}
+
+// Match checks whether the element matches the filter at the given time.
+func (f *Filter) Match(c *ingest.Codec, now time.Time) bool {
+	if len(f.Names) != 0 && !matchAny(f.Names, c.Name, path.Base(c.Name)) {
+		return false
+	}
+	if f.Pattern != nil && !f.Pattern.MatchString(c.Name) {
+		return false
+	}
+	if c.Size < f.MinSize || (f.MaxSize != 0 && c.Size > f.MaxSize) {
+		return false
+	}
+	if len(f.MimeTypes) != 0 {
+		mt := c.MimeType
+		if mt == "" {
+			mt = mime.TypeByExtension(path.Ext(c.Name))
+		}
+		// Parameters like charset=utf-8 are ignored.
+		mt, _, _ = strings.Cut(mt, ";")
+		if !matchAny(f.MimeTypes, strings.TrimSpace(mt)) {
+			return false
+		}
+	}
+	if !f.ModifiedAfter.IsZero() && (c.LastModified == nil || !c.LastModified.After(f.ModifiedAfter)) {
+		return false
+	}
+	if f.ModifiedWithin != 0 && (c.LastModified == nil || !c.LastModified.After(now.Add(-f.ModifiedWithin))) {
+		return false
+	}
+	return true
+}
+
+// matchAny checks whether any of the glob patterns matches any of the names.
+func matchAny(patterns []string, names ...string) bool {
+	for _, p := range patterns {
+		for _, n := range names {
+			if ok, _ := path.Match(p, n); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
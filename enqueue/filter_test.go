@@ -0,0 +1,117 @@
+package enqueue
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/connylabs/ingest"
+)
+
+func TestFilterMatch(t *testing.T) {
+	now := time.Date(2023, 1, 10, 12, 0, 0, 0, time.UTC)
+	yesterday := now.Add(-24 * time.Hour)
+	codec := func(name string, size int64, mimeType string, lastModified *time.Time) *ingest.Codec {
+		return &ingest.Codec{ID: name, Name: name, Size: size, MimeType: mimeType, LastModified: lastModified}
+	}
+	for _, tc := range []struct {
+		name     string
+		f        Filter
+		c        *ingest.Codec
+		expected bool
+	}{
+		{
+			name:     "empty filter",
+			c:        codec("foo", 0, "", nil),
+			expected: true,
+		},
+		{
+			name:     "base name matches",
+			f:        Filter{Names: []string{"*.json", "*.csv"}},
+			c:        codec("reports/2023/foo.csv", 0, "", nil),
+			expected: true,
+		},
+		{
+			name: "no name matches",
+			f:    Filter{Names: []string{"*.json"}},
+			c:    codec("reports/foo.csv", 0, "", nil),
+		},
+		{
+			name: "pattern does not match",
+			f:    Filter{Pattern: regexp.MustCompile("^invoices/")},
+			c:    codec("reports/foo.csv", 0, "", nil),
+		},
+		{
+			name:     "size within bounds",
+			f:        Filter{MinSize: 1, MaxSize: 10},
+			c:        codec("foo", 10, "", nil),
+			expected: true,
+		},
+		{
+			name: "too small",
+			f:    Filter{MinSize: 1},
+			c:    codec("foo", 0, "", nil),
+		},
+		{
+			name: "too large",
+			f:    Filter{MaxSize: 10},
+			c:    codec("foo", 11, "", nil),
+		},
+		{
+			name:     "reported MIME type matches wildcard",
+			f:        Filter{MimeTypes: []string{"image/*"}},
+			c:        codec("foo", 0, "image/png", nil),
+			expected: true,
+		},
+		{
+			name:     "MIME type with parameters",
+			f:        Filter{MimeTypes: []string{"text/csv"}},
+			c:        codec("foo", 0, "text/csv; charset=utf-8", nil),
+			expected: true,
+		},
+		{
+			name:     "MIME type derived from extension",
+			f:        Filter{MimeTypes: []string{"application/json"}},
+			c:        codec("foo.json", 0, "", nil),
+			expected: true,
+		},
+		{
+			name: "MIME type does not match",
+			f:    Filter{MimeTypes: []string{"application/json"}},
+			c:    codec("foo", 0, "", nil),
+		},
+		{
+			name:     "modified after",
+			f:        Filter{ModifiedAfter: yesterday.Add(-time.Hour)},
+			c:        codec("foo", 0, "", &yesterday),
+			expected: true,
+		},
+		{
+			name: "modified before",
+			f:    Filter{ModifiedAfter: now},
+			c:    codec("foo", 0, "", &yesterday),
+		},
+		{
+			name: "unknown modification time",
+			f:    Filter{ModifiedAfter: yesterday},
+			c:    codec("foo", 0, "", nil),
+		},
+		{
+			name:     "modified within",
+			f:        Filter{ModifiedWithin: 25 * time.Hour},
+			c:        codec("foo", 0, "", &yesterday),
+			expected: true,
+		},
+		{
+			name: "not modified within",
+			f:    Filter{ModifiedWithin: time.Hour},
+			c:    codec("foo", 0, "", &yesterday),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.f.Match(tc.c, now))
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// ModeEnqueue marks runs that listed a source and published items to the queue.
+	ModeEnqueue = "enqueue"
+	// ModeDequeue marks runs that processed a batch of messages from the queue.
+	ModeDequeue = "dequeue"
+
+	// DefaultLimit is the number of runs returned by the HTTP handler if no limit is given.
+	DefaultLimit = 20
+)
+
+// Run summarizes a single enqueue or dequeue batch of a workflow.
+type Run struct {
+	Workflow string    `json:"workflow"`
+	Mode     string    `json:"mode"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	// Count is the number of items that were enqueued or dequeued.
+	Count int `json:"count"`
+	// Bytes is the number of bytes that were stored in destinations.
+	Bytes int64 `json:"bytes"`
+	// Errors is the number of items that could not be processed.
+	Errors int `json:"errors"`
+	// Error holds the error that aborted the run, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// Recorder is able to persist the runs of a single workflow.
+type Recorder interface {
+	Record(context.Context, Run) error
+}
+
+// Store is able to persist and list the runs of all workflows.
+type Store interface {
+	Record(context.Context, Run) error
+	// List returns the recorded runs of the given workflow, most recent first.
+	List(context.Context, string) ([]Run, error)
+	Close(context.Context) error
+}
+
+type workflowRecorder struct {
+	s        Store
+	workflow string
+}
+
+func (w *workflowRecorder) Record(ctx context.Context, r Run) error {
+	r.Workflow = w.workflow
+	return w.s.Record(ctx, r)
+}
+
+// NewRecorder returns a Recorder that records runs of the given workflow into the Store.
+func NewRecorder(s Store, workflow string) Recorder {
+	if s == nil {
+		return NewNopRecorder()
+	}
+	return &workflowRecorder{s: s, workflow: workflow}
+}
+
+type nopRecorder struct{}
+
+func (nopRecorder) Record(context.Context, Run) error {
+	return nil
+}
+
+// NewNopRecorder returns a Recorder that discards all runs.
+func NewNopRecorder() Recorder {
+	return nopRecorder{}
+}
+
+// NewHandler returns an http.HandlerFunc that serves the run history
+// of a workflow under /workflows/{name}/runs.
+// The number of returned runs can be controlled with the `limit` query parameter.
+func NewHandler(s Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(parts) != 3 || parts[0] != "workflows" || parts[1] == "" || parts[2] != "runs" {
+			http.NotFound(w, r)
+			return
+		}
+		limit := DefaultLimit
+		if l := r.URL.Query().Get("limit"); l != "" {
+			var err error
+			if limit, err = strconv.Atoi(l); err != nil || limit < 1 {
+				http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+				return
+			}
+		}
+
+		runs, err := s.List(r.Context(), parts[1])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		sort.SliceStable(runs, func(i, j int) bool {
+			return runs[i].Start.After(runs[j].Start)
+		})
+		if len(runs) > limit {
+			runs = runs[:limit]
+		}
+		if runs == nil {
+			runs = []Run{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(runs) //nolint:errcheck
+	}
+}
@@ -0,0 +1,102 @@
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryStore map[string][]Run
+
+func (m memoryStore) Record(_ context.Context, r Run) error {
+	m[r.Workflow] = append(m[r.Workflow], r)
+	return nil
+}
+
+func (m memoryStore) List(_ context.Context, workflow string) ([]Run, error) {
+	return m[workflow], nil
+}
+
+func (m memoryStore) Close(context.Context) error {
+	return nil
+}
+
+func TestHandler(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := memoryStore{}
+	r := NewRecorder(s, "foo")
+	for i := 0; i < 3; i++ {
+		require.NoError(t, r.Record(context.Background(), Run{Mode: ModeDequeue, Start: start.Add(time.Duration(i) * time.Minute), Count: i}))
+	}
+
+	for _, tc := range []struct {
+		name   string
+		method string
+		path   string
+		status int
+		counts []int
+	}{
+		{
+			name:   "all runs",
+			method: http.MethodGet,
+			path:   "/workflows/foo/runs",
+			status: http.StatusOK,
+			counts: []int{2, 1, 0},
+		},
+		{
+			name:   "limit",
+			method: http.MethodGet,
+			path:   "/workflows/foo/runs?limit=1",
+			status: http.StatusOK,
+			counts: []int{2},
+		},
+		{
+			name:   "unknown workflow",
+			method: http.MethodGet,
+			path:   "/workflows/bar/runs",
+			status: http.StatusOK,
+			counts: []int{},
+		},
+		{
+			name:   "invalid limit",
+			method: http.MethodGet,
+			path:   "/workflows/foo/runs?limit=-1",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "invalid path",
+			method: http.MethodGet,
+			path:   "/workflows/foo",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "invalid method",
+			method: http.MethodPost,
+			path:   "/workflows/foo/runs",
+			status: http.StatusMethodNotAllowed,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			NewHandler(s)(w, httptest.NewRequest(tc.method, tc.path, nil))
+			require.Equal(t, tc.status, w.Code)
+			if tc.status != http.StatusOK {
+				return
+			}
+			var runs []Run
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&runs))
+			counts := make([]int, 0, len(runs))
+			for _, r := range runs {
+				assert.Equal(t, "foo", r.Workflow)
+				counts = append(counts, r.Count)
+			}
+			assert.Equal(t, tc.counts, counts)
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+)
+
+// maxHistory is the number of runs that are kept per workflow and mode.
+const maxHistory = nats.KeyValueMaxHistory
+
+type natsStore struct {
+	conn *nats.Conn
+	kv   nats.KeyValue
+}
+
+// New connects to NATS and returns a Store that persists runs in the given JetStream KV bucket.
+// The bucket is created if it does not exist yet.
+// The last 64 runs are kept per workflow and mode.
+func New(url, bucket string, replicas int, opts ...nats.Option) (Store, error) {
+	conn, err := nats.Connect(url, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	kv, err := js.KeyValue(bucket)
+	if errors.Is(err, nats.ErrBucketNotFound) {
+		kv, err = js.CreateKeyValue(&nats.KeyValueConfig{
+			Bucket:      bucket,
+			Description: "Run history of ingest workflows",
+			History:     maxHistory,
+			Replicas:    replicas,
+		})
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to open key-value bucket %q: %w", bucket, err)
+	}
+
+	return &natsStore{conn: conn, kv: kv}, nil
+}
+
+// Record stores the run as a new revision of the key of the workflow and mode.
+func (s *natsStore) Record(_ context.Context, r Run) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = s.kv.Put(key(r.Workflow, r.Mode), data)
+	return err
+}
+
+// List returns all retained runs of the given workflow, most recent first.
+func (s *natsStore) List(_ context.Context, workflow string) ([]Run, error) {
+	var runs []Run
+	for _, m := range []string{ModeDequeue, ModeEnqueue} {
+		es, err := s.kv.History(key(workflow, m))
+		if errors.Is(err, nats.ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for i := len(es) - 1; i >= 0; i-- {
+			if es[i].Operation() != nats.KeyValuePut {
+				continue
+			}
+			var r Run
+			if err := json.Unmarshal(es[i].Value(), &r); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal run: %w", err)
+			}
+			runs = append(runs, r)
+		}
+	}
+	return runs, nil
+}
+
+// Close closes the connection to NATS.
+func (s *natsStore) Close(ctx context.Context) error {
+	defer s.conn.Close()
+	return s.conn.FlushWithContext(ctx)
+}
+
+func key(workflow, mode string) string {
+	return workflow + "." + mode
+}
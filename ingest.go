@@ -2,27 +2,96 @@ package ingest
 
 import (
 	"context"
+	"errors"
 	"io"
-
-	"github.com/nats-io/nats.go"
+	"net/url"
+	"time"
 )
 
 // DefaultBatchSize default size of the batch of messages pulled from the queue
 const DefaultBatchSize = 8
 
+// Headers of the messages that the enqueuer publishes.
+const (
+	// HeaderID is the header that identifies a message.
+	// Queues that support deduplication drop messages with the same ID
+	// that are published within their deduplication window.
+	HeaderID = "Ingest-Id"
+	// HeaderSource is the name of the source of the element.
+	HeaderSource = "Ingest-Source"
+	// HeaderWorkflow is the name of the workflow of the element.
+	HeaderWorkflow = "Ingest-Workflow"
+	// HeaderEnqueuedAt is the time at which the message was published in RFC 3339 format.
+	HeaderEnqueuedAt = "Ingest-Enqueued-At"
+	// HeaderHash is the SHA-256 digest of the data of the message, e.g. sha256:<hex>.
+	HeaderHash = "Ingest-Hash"
+	// HeaderEncryptionKey is the ID of the key with which the data of the message was encrypted.
+	HeaderEncryptionKey = "Ingest-Encryption-Key"
+)
+
+// Header carries metadata of a message.
+type Header map[string]string
+
 // Queue is able to publish messages and subscribe to incoming messages
 type Queue interface {
 	Close(context.Context) error
-	Publish(string, []byte) error
-	PullSubscribe(string, string, ...nats.SubOpt) (Subscription, error)
+	// Publish publishes the data with the given header to the subject.
+	// Queues may ignore headers that they cannot represent.
+	Publish(string, []byte, Header) error
+	// PullSubscribe creates a Subscription for the given subject
+	// that is shared by all subscribers with the same durable name.
+	PullSubscribe(string, string) (Subscription, error)
 }
 
 // Subscription is able to pull a batch of messages from a stream for a pull consumer.
 type Subscription interface {
-	Pop(context.Context, int) ([]*nats.Msg, error)
+	Pop(context.Context, int) ([]Message, error)
 	Close() error
 }
 
+// Message is a message that was pulled from a Queue.
+type Message interface {
+	// Data returns the payload of the message.
+	Data() []byte
+	// Header returns the header of the message, which may be nil.
+	Header() Header
+	// Ack acknowledges the message, so that it is not delivered again.
+	Ack(context.Context) error
+}
+
+// ErrNakNotSupported is returned by Nak for messages whose queue cannot deliver them again on request.
+var ErrNakNotSupported = errors.New("message cannot be negatively acknowledged")
+
+// Naker can be implemented by a Message whose queue can deliver it again,
+// so that messages that could not be processed are retried instead of dropped.
+type Naker interface {
+	// Nak negatively acknowledges the message, so that it is delivered again after the given delay.
+	Nak(context.Context, time.Duration) error
+	// Deliveries returns the number of times that the message was delivered, including this delivery,
+	// or 0 if the number is unknown.
+	Deliveries() int
+}
+
+// Nak negatively acknowledges a message, so that it is delivered again after the given delay.
+// It returns ErrNakNotSupported if the Message does not implement Naker.
+func Nak(ctx context.Context, m Message, delay time.Duration) error {
+	n, ok := m.(Naker)
+	if !ok {
+		return ErrNakNotSupported
+	}
+	return n.Nak(ctx, delay)
+}
+
+// Deliveries returns the number of times that a message was delivered,
+// or 0 if the Message does not implement Naker.
+func Deliveries(m Message) int {
+	n, ok := m.(Naker)
+	if !ok {
+		return 0
+	}
+	return n.Deliveries()
+}
+
 // Nexter is able to list the elements available in the external API and returns them one by one.
 // A Nexter must be implemented for the specific service.
 type Nexter interface {
@@ -34,6 +103,48 @@ type Nexter interface {
 	Next(context.Context) (*Codec, error)
 }
 
+// Checkpointer can be implemented by a Nexter that lists elements incrementally,
+// e.g. only the elements that were modified after the last modified time it saw.
+// The enqueuer persists the checkpoint after every complete listing and restores it
+// before the first listing, so that listings stay incremental across restarts.
+type Checkpointer interface {
+	// Checkpoint returns an opaque cursor that describes the elements that were listed,
+	// or nil if there is nothing to persist.
+	Checkpoint(context.Context) ([]byte, error)
+	// Restore sets the cursor from a checkpoint. It is called before Reset.
+	Restore(context.Context, []byte) error
+}
+
+// BatchNexter can be implemented by a Nexter whose API returns pages of elements,
+// so that a page is listed with one call, e.g. one round trip to a plugin, instead of one call per element.
+type BatchNexter interface {
+	// NextN returns up to n next elements. Once all elements were returned,
+	// io.EOF must be returned together with the last elements, if any.
+	NextN(context.Context, int) ([]Codec, error)
+}
+
+// NextN returns up to n next elements of a Nexter, at least one.
+// Nexters that do not implement BatchNexter are listed with repeated calls of Next.
+// Like BatchNexter, it returns io.EOF together with the last elements and any other error
+// together with the elements that were listed before the error.
+func NextN(ctx context.Context, nx Nexter, n int) ([]Codec, error) {
+	if n < 1 {
+		n = 1
+	}
+	if b, ok := nx.(BatchNexter); ok {
+		return b.NextN(ctx, n)
+	}
+	codecs := make([]Codec, 0, n)
+	for len(codecs) < n {
+		c, err := nx.Next(ctx)
+		if err != nil {
+			return codecs, err
+		}
+		codecs = append(codecs, *c)
+	}
+	return codecs, nil
+}
+
 // Enqueuer is able to enqueue elements into NATS.
 type Enqueuer interface {
 	// Enqueue adds all of the elements that the Nexter will produce into the queue.
@@ -72,3 +183,27 @@ type Client interface {
 	// multiple times.
 	CleanUp(context.Context, Codec) error
 }
+
+// ErrLocateNotSupported is returned by Locate for Clients whose objects cannot be addressed with a URI at all.
+var ErrLocateNotSupported = errors.New("locate not supported")
+
+// Locator can be implemented by a Client whose objects can be addressed with a URI,
+// so that storages that can copy from the URI, e.g. with a server-side copy of S3,
+// store the objects without downloading them.
+type Locator interface {
+	// Locate returns the URI of the object of the Codec, e.g. s3://bucket/key?endpoint=s3.amazonaws.com,
+	// or nil if this object cannot be addressed with a URI.
+	// Locate returns ErrLocateNotSupported if no object of the Client can be addressed with a URI,
+	// e.g. because a wrapped Client does not implement Locator.
+	Locate(context.Context, Codec) (*url.URL, error)
+}
+
+// Locate returns the URI of the object of a Codec,
+// or ErrLocateNotSupported if the Client does not implement Locator.
+func Locate(ctx context.Context, c Client, codec Codec) (*url.URL, error) {
+	l, ok := c.(Locator)
+	if !ok {
+		return nil, ErrLocateNotSupported
+	}
+	return l.Locate(ctx, codec)
+}
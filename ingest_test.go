@@ -0,0 +1,64 @@
+package ingest
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// sliceNexter returns the elements of a slice one by one.
+type sliceNexter struct {
+	codecs []Codec
+	calls  int
+}
+
+func (n *sliceNexter) Reset(context.Context) error {
+	return nil
+}
+
+func (n *sliceNexter) Next(context.Context) (*Codec, error) {
+	n.calls++
+	if len(n.codecs) == 0 {
+		return nil, io.EOF
+	}
+	c := n.codecs[0]
+	n.codecs = n.codecs[1:]
+	return &c, nil
+}
+
+// pageNexter returns all elements with one call of NextN.
+type pageNexter struct {
+	sliceNexter
+}
+
+func (n *pageNexter) NextN(context.Context, int) ([]Codec, error) {
+	return n.codecs, io.EOF
+}
+
+func TestNextN(t *testing.T) {
+	ctx := context.Background()
+	a, b, c := NewCodec("a", "a", nil), NewCodec("b", "b", nil), NewCodec("c", "c", nil)
+
+	n := &sliceNexter{codecs: []Codec{a, b, c}}
+	codecs, err := NextN(ctx, n, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []Codec{a, b}, codecs)
+	codecs, err = NextN(ctx, n, 2)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, []Codec{c}, codecs)
+	assert.Equal(t, 4, n.calls)
+
+	// At least one element is listed.
+	n = &sliceNexter{codecs: []Codec{a, b}}
+	codecs, err = NextN(ctx, n, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []Codec{a}, codecs)
+
+	p := &pageNexter{sliceNexter{codecs: []Codec{a, b, c}}}
+	codecs, err = NextN(ctx, p, 10)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, []Codec{a, b, c}, codecs)
+	assert.Zero(t, p.calls)
+}
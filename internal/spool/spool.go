@@ -0,0 +1,28 @@
+// Package spool spools the content of readers to temporary files,
+// so that destinations can learn its size or checksum before storing it and read it more than once.
+package spool
+
+import (
+	"io"
+	"os"
+)
+
+// Temp copies the content of the reader into a temporary file, whose name is made from pattern like with os.CreateTemp,
+// and into the given writers, e.g. hashes, and returns the file positioned at its start together with its size.
+// The caller must close and remove the file.
+func Temp(r io.Reader, pattern string, w ...io.Writer) (*os.File, int64, error) {
+	f, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return nil, 0, err
+	}
+	n, err := io.Copy(io.MultiWriter(append([]io.Writer{f}, w...)...), r)
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, 0, err
+	}
+	return f, n, nil
+}
@@ -0,0 +1,41 @@
+package spool
+
+import (
+	"crypto/sha1" //nolint:gosec
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemp(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	h := sha1.New() //nolint:gosec
+	f, n, err := Temp(strings.NewReader("foo"), "ingest-test-*", h)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		f.Close()
+		os.Remove(f.Name())
+	})
+	assert.Equal(t, int64(3), n)
+	assert.Equal(t, "0beec7b5ea3f0fdbc95d0dd47f3c5bc275da8a33", hex.EncodeToString(h.Sum(nil)))
+	assert.True(t, strings.HasPrefix(filepath.Base(f.Name()), "ingest-test-"))
+	buf, err := io.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(buf))
+
+	// The temporary file is removed if the reader fails.
+	_, _, err = Temp(iotest.ErrReader(errors.New("failed")), "ingest-test-*")
+	assert.EqualError(t, err, "failed")
+	matches, err := filepath.Glob(filepath.Join(os.TempDir(), "ingest-test-*"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{f.Name()}, matches)
+}
@@ -0,0 +1,76 @@
+// Code generated by mockery v2.15.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	ingest "github.com/connylabs/ingest"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// Message is an autogenerated mock type for the Message type
+type Message struct {
+	mock.Mock
+}
+
+// Ack provides a mock function with given fields: _a0
+func (_m *Message) Ack(_a0 context.Context) error {
+	ret := _m.Called(_a0)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(_a0)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Data provides a mock function with given fields:
+func (_m *Message) Data() []byte {
+	ret := _m.Called()
+
+	var r0 []byte
+	if rf, ok := ret.Get(0).(func() []byte); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]byte)
+		}
+	}
+
+	return r0
+}
+
+// Header provides a mock function with given fields:
+func (_m *Message) Header() ingest.Header {
+	ret := _m.Called()
+
+	var r0 ingest.Header
+	if rf, ok := ret.Get(0).(func() ingest.Header); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(ingest.Header)
+		}
+	}
+
+	return r0
+}
+
+type mockConstructorTestingTNewMessage interface {
+	mock.TestingT
+	Cleanup(func())
+}
+
+// NewMessage creates a new instance of Message. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+func NewMessage(t mockConstructorTestingTNewMessage) *Message {
+	mock := &Message{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -16,6 +16,34 @@ type MinioClient struct {
 	mock.Mock
 }
 
+// ComposeObject provides a mock function with given fields: _a0, _a1, _a2
+func (_m *MinioClient) ComposeObject(_a0 context.Context, _a1 minio.CopyDestOptions, _a2 ...minio.CopySrcOptions) (minio.UploadInfo, error) {
+	_va := make([]interface{}, len(_a2))
+	for _i := range _a2 {
+		_va[_i] = _a2[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, _a0, _a1)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 minio.UploadInfo
+	if rf, ok := ret.Get(0).(func(context.Context, minio.CopyDestOptions, ...minio.CopySrcOptions) minio.UploadInfo); ok {
+		r0 = rf(_a0, _a1, _a2...)
+	} else {
+		r0 = ret.Get(0).(minio.UploadInfo)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, minio.CopyDestOptions, ...minio.CopySrcOptions) error); ok {
+		r1 = rf(_a0, _a1, _a2...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // PutObject provides a mock function with given fields: _a0, _a1, _a2, _a3, _a4, _a5
 func (_m *MinioClient) PutObject(_a0 context.Context, _a1 string, _a2 string, _a3 io.Reader, _a4 int64, _a5 minio.PutObjectOptions) (minio.UploadInfo, error) {
 	ret := _m.Called(_a0, _a1, _a2, _a3, _a4, _a5)
@@ -5,9 +5,8 @@ package mocks
 import (
 	context "context"
 
+	ingest "github.com/connylabs/ingest"
 	mock "github.com/stretchr/testify/mock"
-
-	nats "github.com/nats-io/nats.go"
 )
 
 // Subscription is an autogenerated mock type for the Subscription type
@@ -30,15 +29,15 @@ func (_m *Subscription) Close() error {
 }
 
 // Pop provides a mock function with given fields: _a0, _a1
-func (_m *Subscription) Pop(_a0 context.Context, _a1 int) ([]*nats.Msg, error) {
+func (_m *Subscription) Pop(_a0 context.Context, _a1 int) ([]ingest.Message, error) {
 	ret := _m.Called(_a0, _a1)
 
-	var r0 []*nats.Msg
-	if rf, ok := ret.Get(0).(func(context.Context, int) []*nats.Msg); ok {
+	var r0 []ingest.Message
+	if rf, ok := ret.Get(0).(func(context.Context, int) []ingest.Message); ok {
 		r0 = rf(_a0, _a1)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).([]*nats.Msg)
+			r0 = ret.Get(0).([]ingest.Message)
 		}
 	}
 
@@ -0,0 +1,220 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/storage"
+)
+
+// builtinPrefix marks the paths of plugins that are compiled into the binary, e.g. builtin:s3.
+const builtinPrefix = "builtin:"
+
+// A Builtin is a plugin that is compiled into the binary and runs in the same process,
+// so it does not need a plugin file and its calls do not cross process boundaries.
+// The PluginManager passes them a logger that logs with its own logger, like the logs of plugin files.
+type Builtin struct {
+	// NewSource creates a new source that logs with the given logger and registers its metrics with the given registerer.
+	// It is nil if the plugin does not implement a source.
+	NewSource func(hclog.Logger, prometheus.Registerer) Source
+	// NewDestination creates a new destination that logs with the given logger and registers its metrics with the given registerer.
+	// It is nil if the plugin does not implement a destination.
+	NewDestination func(hclog.Logger, prometheus.Registerer) Destination
+}
+
+var (
+	builtinsMu sync.RWMutex
+	builtins   = make(map[string]Builtin)
+)
+
+// RegisterBuiltin makes a plugin that is compiled into the binary available under the given name,
+// which sources and destinations select with their type.
+// It panics if the name is empty or a plugin is already registered for it.
+func RegisterBuiltin(name string, b Builtin) {
+	builtinsMu.Lock()
+	defer builtinsMu.Unlock()
+	if name == "" || (b.NewSource == nil && b.NewDestination == nil) {
+		panic("plugin: RegisterBuiltin requires a name and a source or destination")
+	}
+	if _, ok := builtins[name]; ok {
+		panic(fmt.Sprintf("plugin: RegisterBuiltin called twice for %q", name))
+	}
+	builtins[name] = b
+}
+
+// Builtins returns the sorted names of the registered built-in plugins.
+func Builtins() []string {
+	builtinsMu.RLock()
+	defer builtinsMu.RUnlock()
+	names := make([]string, 0, len(builtins))
+	for n := range builtins {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// BuiltinPath returns the path under which the PluginManager starts the built-in plugin of the given name.
+// It returns false if there is no such plugin.
+func BuiltinPath(name string) (string, bool) {
+	builtinsMu.RLock()
+	defer builtinsMu.RUnlock()
+	if _, ok := builtins[name]; !ok {
+		return "", false
+	}
+	return builtinPrefix + name, true
+}
+
+// builtin returns the built-in plugin for a path that BuiltinPath returned.
+func builtin(path string) (Builtin, bool) {
+	if !strings.HasPrefix(path, builtinPrefix) {
+		return Builtin{}, false
+	}
+	builtinsMu.RLock()
+	defer builtinsMu.RUnlock()
+	b, ok := builtins[strings.TrimPrefix(path, builtinPrefix)]
+	return b, ok
+}
+
+var (
+	_ Source              = &builtinSource{}
+	_ ingest.BatchNexter  = &builtinSource{}
+	_ ingest.Checkpointer = &builtinSource{}
+	_ ingest.Locator      = &builtinSource{}
+	_ prometheus.Gatherer = &builtinSource{}
+	_ Schemer             = &builtinSource{}
+	_ HealthChecker       = &builtinSource{}
+)
+
+// builtinSource behaves like the client of a source plugin:
+// it gathers the metrics of the source, implements ingest.Checkpointer
+// and calls the source with a context that outlives the calls, like the plugin server.
+// Next and Download get a context that is also canceled with the call, so that their timeouts apply.
+type builtinSource struct {
+	Source
+	g   prometheus.Gatherer
+	ctx context.Context
+}
+
+func (s *builtinSource) Gather() ([]*dto.MetricFamily, error) {
+	return s.g.Gather()
+}
+
+// Schema returns nil if the source does not implement Schemer.
+func (s *builtinSource) Schema() ([]byte, error) {
+	return schemaOf(s.Source)
+}
+
+// Health returns a healthy status if the source does not implement HealthChecker.
+func (s *builtinSource) Health(ctx context.Context) (Health, error) {
+	if hc, ok := s.Source.(HealthChecker); ok {
+		return hc.Health(ctx)
+	}
+	return Health{}, nil
+}
+
+func (s *builtinSource) Next(ctx context.Context) (*ingest.Codec, error) {
+	ctx, cancel := callContext(ctx, s.ctx)
+	defer cancel()
+	return s.Source.Next(ctx)
+}
+
+func (s *builtinSource) NextN(ctx context.Context, n int) ([]ingest.Codec, error) {
+	ctx, cancel := callContext(ctx, s.ctx)
+	defer cancel()
+	return ingest.NextN(ctx, s.Source, n)
+}
+
+func (s *builtinSource) Reset(context.Context) error {
+	return s.Source.Reset(s.ctx)
+}
+
+func (s *builtinSource) CleanUp(_ context.Context, c ingest.Codec) error {
+	return s.Source.CleanUp(s.ctx, c)
+}
+
+// Locate returns ingest.ErrLocateNotSupported if the source does not implement ingest.Locator.
+func (s *builtinSource) Locate(ctx context.Context, c ingest.Codec) (*url.URL, error) {
+	ctx, cancel := callContext(ctx, s.ctx)
+	defer cancel()
+	return ingest.Locate(ctx, s.Source, c)
+}
+
+// Checkpoint returns nil if the source does not implement ingest.Checkpointer.
+func (s *builtinSource) Checkpoint(context.Context) ([]byte, error) {
+	cp, ok := s.Source.(ingest.Checkpointer)
+	if !ok {
+		return nil, nil
+	}
+	return cp.Checkpoint(s.ctx)
+}
+
+// Restore is a no-op if the source does not implement ingest.Checkpointer.
+func (s *builtinSource) Restore(_ context.Context, c []byte) error {
+	cp, ok := s.Source.(ingest.Checkpointer)
+	if !ok {
+		return nil
+	}
+	return cp.Restore(s.ctx, c)
+}
+
+var (
+	_ Destination         = &builtinDestination{}
+	_ storage.Copier      = &builtinDestination{}
+	_ prometheus.Gatherer = &builtinDestination{}
+	_ Schemer             = &builtinDestination{}
+	_ HealthChecker       = &builtinDestination{}
+)
+
+// builtinDestination behaves like the client of a destination plugin.
+type builtinDestination struct {
+	Destination
+	g   prometheus.Gatherer
+	ctx context.Context
+}
+
+func (d *builtinDestination) Gather() ([]*dto.MetricFamily, error) {
+	return d.g.Gather()
+}
+
+// Schema returns nil if the destination does not implement Schemer.
+func (d *builtinDestination) Schema() ([]byte, error) {
+	return schemaOf(d.Destination)
+}
+
+// Health returns a healthy status if the destination does not implement HealthChecker.
+func (d *builtinDestination) Health(ctx context.Context) (Health, error) {
+	if hc, ok := d.Destination.(HealthChecker); ok {
+		return hc.Health(ctx)
+	}
+	return Health{}, nil
+}
+
+func (d *builtinDestination) Stat(_ context.Context, c ingest.Codec) (*storage.ObjectInfo, error) {
+	return d.Destination.Stat(d.ctx, c)
+}
+
+// CopyFrom returns storage.ErrCopyNotImplemented if the destination does not implement storage.Copier.
+func (d *builtinDestination) CopyFrom(ctx context.Context, c ingest.Codec, uri *url.URL) (*url.URL, error) {
+	ctx, cancel := callContext(ctx, d.ctx)
+	defer cancel()
+	return storage.CopyFrom(ctx, d.Destination, c, uri)
+}
+
+// schemaOf returns the schema of a plugin or nil if it does not implement Schemer.
+func schemaOf(p any) ([]byte, error) {
+	sc, ok := p.(Schemer)
+	if !ok {
+		return nil, nil
+	}
+	return sc.Schema()
+}
@@ -0,0 +1,108 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/hashicorp/go-hclog"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/connylabs/ingest"
+)
+
+func TestBuiltin(t *testing.T) {
+	RegisterBuiltin("test-destination", Builtin{
+		NewDestination: func(l hclog.Logger, _ prometheus.Registerer) Destination { return NewNoopDestination(l) },
+	})
+	assert.Panics(t, func() {
+		RegisterBuiltin("noop", Builtin{NewSource: func(hclog.Logger, prometheus.Registerer) Source { return nil }})
+	})
+	assert.Panics(t, func() { RegisterBuiltin("empty", Builtin{}) })
+	assert.Contains(t, Builtins(), "noop")
+	_, ok := BuiltinPath("unknown")
+	assert.False(t, ok)
+
+	noop, ok := BuiltinPath("noop")
+	require.True(t, ok)
+	pm := NewPluginManager(time.Millisecond, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(pm.Stop)
+	t.Cleanup(cancel)
+
+	s, err := pm.NewSource(noop, nil, prometheus.Labels{"plugin": "noop"})
+	require.NoError(t, err)
+	assert.Equal(t, 0, pm.ProtocolVersion(s))
+	require.NoError(t, s.Reset(ctx))
+	n, err := s.Next(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, defaultCodec, *n)
+	obj, err := s.Download(ctx, *n)
+	require.NoError(t, err)
+	buf, err := io.ReadAll(obj.Reader)
+	require.NoError(t, err)
+	assert.Equal(t, defaultObjContent, string(buf))
+	// Built-in sources behave like plugins.
+	cp, ok := s.(ingest.Checkpointer)
+	require.True(t, ok)
+	c, err := cp.Checkpoint(ctx)
+	assert.NoError(t, err)
+	assert.Nil(t, c)
+	_, ok = s.(prometheus.Gatherer)
+	assert.True(t, ok)
+	assert.Error(t, s.Configure(map[string]any{"error": "an error"}))
+
+	_, err = pm.NewSource(noop, map[string]any{"error": "an error"}, nil)
+	assert.EqualError(t, err, "failed to configure source: an error")
+
+	dst, ok := BuiltinPath("test-destination")
+	require.True(t, ok)
+	_, err = pm.NewSource(dst, nil, nil)
+	assert.ErrorIs(t, err, ErrNotImplemented)
+	d, err := pm.NewDestination(dst, nil, nil)
+	require.NoError(t, err)
+	u, err := d.Stat(ctx, defaultCodec)
+	require.NoError(t, err)
+	assert.Equal(t, defaultObjURL, u.URI)
+
+	// Built-in plugins are not pinged.
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		cancel()
+	}()
+	assert.NoError(t, pm.Watch(ctx))
+
+	pm.Kill(s)
+	pm.Kill(d)
+	assert.Empty(t, pm.sources)
+	assert.Empty(t, pm.destinations)
+}
+
+func TestBuiltinLogger(t *testing.T) {
+	noop, ok := BuiltinPath("noop")
+	require.True(t, ok)
+	var b bytes.Buffer
+	pm := NewPluginManager(time.Millisecond, level.NewFilter(log.NewLogfmtLogger(&b), level.AllowDebug()))
+	t.Cleanup(pm.Stop)
+
+	// Built-in plugins log with the logger of the manager.
+	s, err := pm.NewSource(noop, nil, nil)
+	require.NoError(t, err)
+	assert.Contains(t, b.String(), `level=debug plugin=noop msg="configuring plugin"`)
+	pm.Kill(s)
+
+	// The level filter of the manager applies to built-in plugins.
+	b.Reset()
+	pm = NewPluginManager(time.Millisecond, level.NewFilter(log.NewLogfmtLogger(&b), level.AllowInfo()))
+	t.Cleanup(pm.Stop)
+	s, err = pm.NewSource(noop, nil, nil)
+	require.NoError(t, err)
+	assert.NotContains(t, b.String(), "configuring plugin")
+	pm.Kill(s)
+}
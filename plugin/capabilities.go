@@ -0,0 +1,75 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+
+	hplugin "github.com/hashicorp/go-plugin"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/connylabs/ingest/plugin/proto"
+)
+
+// Capabilities describe whether a plugin implements a source, a destination or both.
+type Capabilities struct {
+	Source      bool
+	Destination bool
+}
+
+// allCapabilities are assumed for plugins that cannot report their capabilities,
+// e.g. plugins that were compiled with an older version of ingest.
+var allCapabilities = Capabilities{Source: true, Destination: true}
+
+// capabilitiesPlugin serves the capabilities of a plugin with the gRPC protocol.
+type capabilitiesPlugin struct {
+	hplugin.NetRPCUnsupportedPlugin
+	c Capabilities
+}
+
+func (p *capabilitiesPlugin) GRPCServer(_ *hplugin.GRPCBroker, s *grpc.Server) error {
+	proto.RegisterPluginServer(s, &capabilitiesGRPCServer{c: p.c})
+	return nil
+}
+
+func (p *capabilitiesPlugin) GRPCClient(ctx context.Context, _ *hplugin.GRPCBroker, c *grpc.ClientConn) (interface{}, error) {
+	return &capabilitiesGRPCClient{client: proto.NewPluginClient(c), ctx: ctx}, nil
+}
+
+type capabilitiesGRPCServer struct {
+	proto.UnimplementedPluginServer
+	c Capabilities
+}
+
+func (s *capabilitiesGRPCServer) Capabilities(context.Context, *emptypb.Empty) (*proto.CapabilitiesResponse, error) {
+	return &proto.CapabilitiesResponse{Source: s.c.Source, Destination: s.c.Destination}, nil
+}
+
+type capabilitiesGRPCClient struct {
+	client proto.PluginClient
+	ctx    context.Context
+}
+
+// Capabilities returns the capabilities of the plugin.
+func (c *capabilitiesGRPCClient) Capabilities() (Capabilities, error) {
+	res, err := c.client.Capabilities(c.ctx, &emptypb.Empty{})
+	if err != nil {
+		return Capabilities{}, fromStatus(err)
+	}
+	return Capabilities{Source: res.Source, Destination: res.Destination}, nil
+}
+
+// capabilities returns the capabilities of a plugin.
+// Plugins that do not implement the capabilities RPC are assumed to implement both a source and a destination.
+func capabilities(cp hplugin.ClientProtocol) (Capabilities, error) {
+	raw, err := cp.Dispense("plugin")
+	if err != nil {
+		// Plugins that use the net/rpc protocol do not serve their capabilities.
+		return allCapabilities, nil
+	}
+	c, err := raw.(*capabilitiesGRPCClient).Capabilities()
+	if errors.Is(err, ErrNotImplemented) {
+		return allCapabilities, nil
+	}
+	return c, err
+}
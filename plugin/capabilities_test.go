@@ -0,0 +1,59 @@
+package plugin
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+
+	hplugin "github.com/hashicorp/go-plugin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+// uncapablePlugin does not serve the capabilities RPC, like plugins that were built for earlier versions of ingest.
+type uncapablePlugin struct {
+	capabilitiesPlugin
+}
+
+func (p *uncapablePlugin) GRPCServer(*hplugin.GRPCBroker, *grpc.Server) error {
+	return nil
+}
+
+func TestCapabilities(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		p    hplugin.Plugin
+		c    Capabilities
+	}{
+		{name: "source", p: &capabilitiesPlugin{c: Capabilities{Source: true}}, c: Capabilities{Source: true}},
+		{name: "destination", p: &capabilitiesPlugin{c: Capabilities{Destination: true}}, c: Capabilities{Destination: true}},
+		{name: "both", p: &capabilitiesPlugin{c: allCapabilities}, c: allCapabilities},
+		{name: "not implemented", p: &uncapablePlugin{}, c: allCapabilities},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c, _ := hplugin.TestPluginGRPCConn(t, map[string]hplugin.Plugin{"plugin": tc.p})
+			t.Cleanup(func() { c.Close() })
+			caps, err := capabilities(c)
+			require.NoError(t, err)
+			assert.Equal(t, tc.c, caps)
+		})
+	}
+}
+
+func TestPluginManagerCapabilities(t *testing.T) {
+	pm := NewPluginManager(0, nil)
+	t.Cleanup(pm.Stop)
+	drive := fmt.Sprintf("../bin/plugin/%s/%s/drive", runtime.GOOS, runtime.GOARCH)
+
+	_, err := pm.NewSource(drive, nil, nil)
+	assert.ErrorIs(t, err, ErrNotImplemented)
+	assert.EqualError(t, err, `plugin "drive" does not implement a source: not implemented`)
+	// The plugin is not kept running.
+	assert.Empty(t, pm.sources)
+
+	_, err = pm.NewSource(noopPath, nil, nil)
+	assert.NoError(t, err)
+	_, err = pm.NewDestination(noopPath, nil, nil)
+	assert.NoError(t, err)
+}
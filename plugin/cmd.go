@@ -8,15 +8,19 @@ import (
 	hplugin "github.com/hashicorp/go-plugin"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/collectors"
+	"google.golang.org/grpc"
 )
 
 const (
 	// The Version needs to be changed, when there is a change in the plugin interface.
-	// This will fail loading old plugins with new version of ingest and vice versa.
-	// External plugins will need to update their ingest version and recompile.
-	PluginMagicProtocalVersion = 2
-	PluginCookieValue          = "d404b451-5a08-44eb-b705-15324b4ff720"
-	PluginMagicCookieKey       = "INGEST_PLUGIN"
+	// Ingest and plugins negotiate the newest version that both of them support,
+	// so the previous version should be kept in versionedPlugins until external plugins were recompiled.
+	PluginMagicProtocalVersion = 3
+	// PluginLegacyProtocolVersion is the version of the net/rpc plugin protocol,
+	// which is supported during the migration of plugins to gRPC.
+	PluginLegacyProtocolVersion = 2
+	PluginCookieValue           = "d404b451-5a08-44eb-b705-15324b4ff720"
+	PluginMagicCookieKey        = "INGEST_PLUGIN"
 )
 
 type Option func(c *configuration)
@@ -70,24 +74,55 @@ func RunPluginServer(s Source, d Destination, opts ...Option) {
 		MagicCookieValue: PluginCookieValue,
 	}
 
-	pluginMap := map[string]hplugin.Plugin{
-		"source": &pluginSource{
-			impl: s,
-			ctx:  ctx,
-			g:    c.g,
-			l:    c.l.With("component", "source"),
+	// The plugin measures the calls that it serves, so that they are reported next to the calls measured by ingest.
+	rpcs := newRPCMetrics("plugin")
+	hplugin.Serve(&hplugin.ServeConfig{
+		HandshakeConfig:  handshakeConfig,
+		VersionedPlugins: versionedPlugins(ctx, s, d, prometheus.Gatherers{c.g, rpcs.r}, c.l),
+		GRPCServer: func(opts []grpc.ServerOption) *grpc.Server {
+			return grpcServer(append(opts, rpcs.serverOptions()...))
 		},
-		"destination": &pluginDestination{
-			impl: d,
-			ctx:  ctx,
-			g:    c.g,
-			l:    c.l.With("component", "destination"),
+		Logger: c.l,
+	})
+}
+
+// versionedPlugins returns the plugins for every supported version of the plugin protocol.
+// Clients only need the types of the plugins, so all arguments can be empty.
+func versionedPlugins(ctx context.Context, s Source, d Destination, g prometheus.Gatherer, l hclog.Logger) map[int]hplugin.PluginSet {
+	if l == nil {
+		l = hclog.NewNullLogger()
+	}
+	return map[int]hplugin.PluginSet{
+		PluginLegacyProtocolVersion: {
+			"source": &rpcPluginSource{
+				impl: s,
+				ctx:  ctx,
+				g:    g,
+				l:    l.With("component", "source"),
+			},
+			"destination": &rpcPluginDestination{
+				impl: d,
+				ctx:  ctx,
+				g:    g,
+				l:    l.With("component", "destination"),
+			},
+		},
+		PluginMagicProtocalVersion: {
+			"source": &pluginSource{
+				impl: s,
+				ctx:  ctx,
+				g:    g,
+				l:    l.With("component", "source"),
+			},
+			"destination": &pluginDestination{
+				impl: d,
+				ctx:  ctx,
+				g:    g,
+				l:    l.With("component", "destination"),
+			},
+			"plugin": &capabilitiesPlugin{
+				c: Capabilities{Source: s != nil, Destination: d != nil},
+			},
 		},
 	}
-
-	hplugin.Serve(&hplugin.ServeConfig{
-		HandshakeConfig: handshakeConfig,
-		Plugins:         pluginMap,
-		Logger:          c.l,
-	})
 }
@@ -0,0 +1,98 @@
+package plugin
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"testing"
+
+	hclog "github.com/hashicorp/go-hclog"
+	hplugin "github.com/hashicorp/go-plugin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// legacyPluginEnv makes the test binary serve the noop plugin with the legacy protocol only,
+// like plugins that were built for earlier versions of ingest.
+const legacyPluginEnv = "INGEST_TEST_LEGACY_PLUGIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(legacyPluginEnv) != "" {
+		l := hclog.NewNullLogger()
+		hplugin.Serve(&hplugin.ServeConfig{
+			HandshakeConfig: hplugin.HandshakeConfig{
+				ProtocolVersion:  PluginLegacyProtocolVersion,
+				MagicCookieKey:   PluginMagicCookieKey,
+				MagicCookieValue: PluginCookieValue,
+			},
+			Plugins: versionedPlugins(context.Background(), NewNoopSource(l), NewNoopDestination(l), prometheus.NewRegistry(), l)[PluginLegacyProtocolVersion],
+			Logger:  l,
+		})
+		return
+	}
+	os.Exit(m.Run())
+}
+
+func TestProtocolVersion(t *testing.T) {
+	t.Run("current plugin", func(t *testing.T) {
+		pm := NewPluginManager(0, nil)
+		t.Cleanup(pm.Stop)
+
+		s, err := pm.NewSource(noopPath, nil, nil)
+		require.NoError(t, err)
+		assert.Equal(t, PluginMagicProtocalVersion, pm.ProtocolVersion(s))
+		assert.Equal(t, 0, pm.ProtocolVersion(&noopSource{}))
+	})
+
+	t.Run("legacy plugin", func(t *testing.T) {
+		t.Setenv(legacyPluginEnv, "true")
+		pm := NewPluginManager(0, nil)
+		ctx := context.Background()
+		t.Cleanup(pm.Stop)
+
+		s, err := pm.NewSource(os.Args[0], nil, nil)
+		require.NoError(t, err)
+		assert.Equal(t, PluginLegacyProtocolVersion, pm.ProtocolVersion(s))
+		n, err := s.Next(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, defaultCodec, *n)
+		obj, err := s.Download(ctx, *n)
+		require.NoError(t, err)
+		buf, err := io.ReadAll(obj.Reader)
+		require.NoError(t, err)
+		assert.Equal(t, defaultObjContent, string(buf))
+
+		d, err := pm.NewDestination(os.Args[0], nil, nil)
+		require.NoError(t, err)
+		assert.Equal(t, PluginLegacyProtocolVersion, pm.ProtocolVersion(d))
+		_, err = d.Stat(ctx, *n)
+		assert.NoError(t, err)
+	})
+
+	t.Run("legacy host", func(t *testing.T) {
+		// Hosts that were built for earlier versions of ingest only speak the legacy protocol.
+		c := hplugin.NewClient(&hplugin.ClientConfig{
+			HandshakeConfig: hplugin.HandshakeConfig{
+				ProtocolVersion:  PluginLegacyProtocolVersion,
+				MagicCookieKey:   PluginMagicCookieKey,
+				MagicCookieValue: PluginCookieValue,
+			},
+			Plugins: versionedPlugins(context.Background(), nil, nil, nil, nil)[PluginLegacyProtocolVersion],
+			Cmd:     exec.Command(noopPath),
+			Logger:  hclog.NewNullLogger(),
+		})
+		t.Cleanup(c.Kill)
+
+		cp, err := c.Client()
+		require.NoError(t, err)
+		assert.Equal(t, PluginLegacyProtocolVersion, c.NegotiatedVersion())
+		s, err := newSource(cp)
+		require.NoError(t, err)
+		require.NoError(t, s.Configure(nil))
+		n, err := s.Next(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, defaultCodec, *n)
+	})
+}
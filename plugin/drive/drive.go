@@ -0,0 +1,82 @@
+// Package drive implements the drive plugin, which stores objects in a Google Drive folder.
+package drive
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mitchellh/mapstructure"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/option"
+
+	"github.com/connylabs/ingest/plugin"
+	"github.com/connylabs/ingest/storage"
+	dstorage "github.com/connylabs/ingest/storage/drive"
+)
+
+type destinationConfig struct {
+	APIKey          string
+	CredentialsFile string
+	Folder          string
+}
+
+//go:embed destination.schema.json
+var destinationSchema []byte
+
+var (
+	_ plugin.Destination = &destination{}
+	_ plugin.Schemer     = &destination{}
+)
+
+type destination struct {
+	storage.Storage
+	l   hclog.Logger
+	reg prometheus.Registerer
+}
+
+// Schema returns the JSON schema of the configuration of the destination.
+func (d *destination) Schema() ([]byte, error) {
+	return destinationSchema, nil
+}
+
+// NewDestination implements the Plugin interface.
+func (d *destination) Configure(config map[string]interface{}) error {
+	dc := new(destinationConfig)
+	err := mapstructure.Decode(config, dc)
+	if err != nil {
+		return err
+	}
+	var o []option.ClientOption
+	if dc.APIKey != "" {
+		o = append(o, option.WithAPIKey(dc.APIKey))
+	}
+	if dc.CredentialsFile != "" {
+		o = append(o, option.WithCredentialsFile(dc.CredentialsFile))
+	}
+	ds, err := drive.NewService(context.TODO(), o...)
+	if err != nil {
+		return fmt.Errorf("failed to create drive service: %w", err)
+	}
+
+	drS, err := dstorage.New(dc.Folder, ds, d.l, d.reg)
+	if err != nil {
+		return fmt.Errorf("failed to create drive storage: %w", err)
+	}
+	d.Storage = drS
+	return nil
+}
+
+func init() {
+	plugin.RegisterBuiltin("drive", plugin.Builtin{
+		NewDestination: NewDestination,
+	})
+}
+
+// NewDestination returns a destination that logs with l, registers its metrics with reg
+// and that must be configured before it is used.
+func NewDestination(l hclog.Logger, reg prometheus.Registerer) plugin.Destination {
+	return &destination{l: l, reg: reg}
+}
@@ -0,0 +1,819 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"sync/atomic"
+
+	protobuf "github.com/golang/protobuf/proto" //nolint:staticcheck // The metric families of client_model are not APIv2 messages.
+	"github.com/hashicorp/go-hclog"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/plugin/proto"
+	"github.com/connylabs/ingest/storage"
+)
+
+// chunkSize is the maximum size of the chunks in which objects are streamed between ingest and plugins.
+const chunkSize = 64 << 10
+
+var ErrNotConfigured = errors.New("not configured")
+
+type sourceGRPCServer struct {
+	proto.UnimplementedSourceServer
+	impl Source
+
+	g prometheus.Gatherer
+	l hclog.Logger
+	// ctx is passed to the unary calls of the plugin instead of the context of the request,
+	// because plugins may keep it beyond the call, e.g. to list objects after Reset.
+	// Only Next and Download get a context that is also canceled with the request, see callContext.
+	ctx context.Context
+	// configured is 1 after the source was configured.
+	configured int32
+}
+
+func (s *sourceGRPCServer) Gather(context.Context, *emptypb.Empty) (*proto.GatherResponse, error) {
+	return gather(s.g)
+}
+
+func (s *sourceGRPCServer) Schema(context.Context, *emptypb.Empty) (*proto.SchemaResponse, error) {
+	return schema(s.impl)
+}
+
+// Health reports a healthy source if the source does not implement HealthChecker.
+func (s *sourceGRPCServer) Health(ctx context.Context, _ *emptypb.Empty) (*proto.HealthResponse, error) {
+	ctx, cancel := callContext(ctx, s.ctx)
+	defer cancel()
+	return health(ctx, s.impl)
+}
+
+func (s *sourceGRPCServer) Configure(_ context.Context, req *proto.ConfigureRequest) (*emptypb.Empty, error) {
+	c, err := decodeConfig(req.Config)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	if err := s.impl.Configure(c); err != nil {
+		return nil, toStatus(err)
+	}
+	atomic.StoreInt32(&s.configured, 1)
+	return &emptypb.Empty{}, nil
+}
+
+func (s *sourceGRPCServer) Next(ctx context.Context, _ *emptypb.Empty) (*proto.Codec, error) {
+	if atomic.LoadInt32(&s.configured) == 0 {
+		return nil, toStatus(ErrNotConfigured)
+	}
+	ctx, cancel := callContext(ctx, s.ctx)
+	defer cancel()
+	c, err := s.impl.Next(ctx)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return toCodec(*c), nil
+}
+
+// NextN lists the objects with repeated calls of Next if the source does not implement ingest.BatchNexter,
+// which still saves the round trips between ingest and the plugin.
+func (s *sourceGRPCServer) NextN(ctx context.Context, req *proto.NextNRequest) (*proto.NextNResponse, error) {
+	if atomic.LoadInt32(&s.configured) == 0 {
+		return nil, toStatus(ErrNotConfigured)
+	}
+	ctx, cancel := callContext(ctx, s.ctx)
+	defer cancel()
+	codecs, err := ingest.NextN(ctx, s.impl, int(req.N))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, toStatus(err)
+	}
+	res := &proto.NextNResponse{Codecs: make([]*proto.Codec, len(codecs)), Eof: err != nil}
+	for i := range codecs {
+		res.Codecs[i] = toCodec(codecs[i])
+	}
+	return res, nil
+}
+
+func (s *sourceGRPCServer) Reset(context.Context, *emptypb.Empty) (*emptypb.Empty, error) {
+	if atomic.LoadInt32(&s.configured) == 0 {
+		return nil, toStatus(ErrNotConfigured)
+	}
+	return &emptypb.Empty{}, toStatus(s.impl.Reset(s.ctx))
+}
+
+// Download sends the MIME type and length of the object in the first message
+// and the content of the object in the following messages.
+func (s *sourceGRPCServer) Download(c *proto.Codec, stream proto.Source_DownloadServer) error {
+	if atomic.LoadInt32(&s.configured) == 0 {
+		return toStatus(ErrNotConfigured)
+	}
+	ctx, cancel := callContext(stream.Context(), s.ctx)
+	defer cancel()
+	obj, err := s.impl.Download(ctx, fromCodec(c))
+	if err != nil {
+		return toStatus(err)
+	}
+	if c, ok := obj.Reader.(io.Closer); ok {
+		defer c.Close()
+	}
+	if err := stream.Send(&proto.DownloadResponse{MimeType: obj.MimeType, Len: obj.Len}); err != nil {
+		return err
+	}
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := obj.Reader.Read(buf)
+		if n > 0 {
+			if err := stream.Send(&proto.DownloadResponse{Chunk: buf[:n], Checksum: checksum(buf[:n])}); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			s.l.Error("failed to read object", "id", c.Id, "error", err.Error())
+			return toStatus(err)
+		}
+	}
+}
+
+func (s *sourceGRPCServer) CleanUp(_ context.Context, c *proto.Codec) (*emptypb.Empty, error) {
+	if atomic.LoadInt32(&s.configured) == 0 {
+		return nil, toStatus(ErrNotConfigured)
+	}
+	return &emptypb.Empty{}, toStatus(s.impl.CleanUp(s.ctx, fromCodec(c)))
+}
+
+// Locate fails with the code UNIMPLEMENTED if the source does not implement ingest.Locator.
+func (s *sourceGRPCServer) Locate(ctx context.Context, c *proto.Codec) (*proto.LocateResponse, error) {
+	if atomic.LoadInt32(&s.configured) == 0 {
+		return nil, toStatus(ErrNotConfigured)
+	}
+	ctx, cancel := callContext(ctx, s.ctx)
+	defer cancel()
+	u, err := ingest.Locate(ctx, s.impl, fromCodec(c))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	if u == nil {
+		return &proto.LocateResponse{}, nil
+	}
+	return &proto.LocateResponse{Uri: u.String()}, nil
+}
+
+// Checkpoint returns an empty checkpoint if the source does not implement ingest.Checkpointer.
+func (s *sourceGRPCServer) Checkpoint(context.Context, *emptypb.Empty) (*proto.CheckpointResponse, error) {
+	if atomic.LoadInt32(&s.configured) == 0 {
+		return nil, toStatus(ErrNotConfigured)
+	}
+	cp, ok := s.impl.(ingest.Checkpointer)
+	if !ok {
+		return &proto.CheckpointResponse{}, nil
+	}
+	c, err := cp.Checkpoint(s.ctx)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &proto.CheckpointResponse{Checkpoint: c}, nil
+}
+
+// Restore is a no-op if the source does not implement ingest.Checkpointer.
+func (s *sourceGRPCServer) Restore(_ context.Context, req *proto.RestoreRequest) (*emptypb.Empty, error) {
+	if atomic.LoadInt32(&s.configured) == 0 {
+		return nil, toStatus(ErrNotConfigured)
+	}
+	cp, ok := s.impl.(ingest.Checkpointer)
+	if !ok {
+		return &emptypb.Empty{}, nil
+	}
+	return &emptypb.Empty{}, toStatus(cp.Restore(s.ctx, req.Checkpoint))
+}
+
+var (
+	_ Source              = &sourceGRPCClient{}
+	_ ingest.BatchNexter  = &sourceGRPCClient{}
+	_ ingest.Checkpointer = &sourceGRPCClient{}
+	_ ingest.Locator      = &sourceGRPCClient{}
+	_ prometheus.Gatherer = &sourceGRPCClient{}
+	_ Schemer             = &sourceGRPCClient{}
+	_ HealthChecker       = &sourceGRPCClient{}
+)
+
+type sourceGRPCClient struct {
+	client proto.SourceClient
+	// ctx is canceled when the plugin exits.
+	ctx       context.Context
+	transfers *transferMetrics
+	rpcs      *rpcMetrics
+	// noNextN is 1 if the plugin was built before the NextN RPC was added.
+	noNextN int32
+}
+
+// Gather returns the metrics of the plugin and the metrics of the downloads from and the calls to the plugin.
+func (c *sourceGRPCClient) Gather() ([]*dto.MetricFamily, error) {
+	res, err := c.client.Gather(c.ctx, &emptypb.Empty{})
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+	mfs, err := decodeMetricFamilies(res)
+	if err != nil {
+		return nil, err
+	}
+	if mfs, err = c.transfers.gather(mfs); err != nil {
+		return nil, err
+	}
+	return c.rpcs.gather(mfs)
+}
+
+// Schema returns nil if the plugin does not describe its configuration.
+func (c *sourceGRPCClient) Schema() ([]byte, error) {
+	res, err := c.client.Schema(c.ctx, &emptypb.Empty{})
+	if err != nil {
+		if err = fromStatus(err); errors.Is(err, ErrNotImplemented) {
+			// Plugins that were built before the Schema RPC was added do not implement it.
+			return nil, nil
+		}
+		return nil, err
+	}
+	return res.Schema, nil
+}
+
+func (c *sourceGRPCClient) Health(ctx context.Context) (Health, error) {
+	return healthFromStatus(c.client.Health(ctx, &emptypb.Empty{}))
+}
+
+func (c *sourceGRPCClient) Configure(conf map[string]any) error {
+	buf, err := encodeConfig(conf)
+	if err != nil {
+		return err
+	}
+	_, err = c.client.Configure(c.ctx, &proto.ConfigureRequest{Config: buf})
+	return fromStatus(err)
+}
+
+func (c *sourceGRPCClient) Next(ctx context.Context) (*ingest.Codec, error) {
+	res, err := c.client.Next(ctx, &emptypb.Empty{})
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+	codec := fromCodec(res)
+	return &codec, nil
+}
+
+// NextN falls back to repeated calls of Next if the plugin does not implement the NextN RPC.
+func (c *sourceGRPCClient) NextN(ctx context.Context, n int) ([]ingest.Codec, error) {
+	if atomic.LoadInt32(&c.noNextN) == 1 {
+		return nextEach(ctx, c, n)
+	}
+	res, err := c.client.NextN(ctx, &proto.NextNRequest{N: int32(n)})
+	if err != nil {
+		if err = fromStatus(err); errors.Is(err, ErrNotImplemented) {
+			atomic.StoreInt32(&c.noNextN, 1)
+			return nextEach(ctx, c, n)
+		}
+		return nil, err
+	}
+	codecs := make([]ingest.Codec, len(res.Codecs))
+	for i := range res.Codecs {
+		codecs[i] = fromCodec(res.Codecs[i])
+	}
+	if res.Eof {
+		return codecs, io.EOF
+	}
+	return codecs, nil
+}
+
+// nextEach lists up to n objects with repeated calls of Next, even if the Nexter implements ingest.BatchNexter.
+func nextEach(ctx context.Context, nx ingest.Nexter, n int) ([]ingest.Codec, error) {
+	return ingest.NextN(ctx, struct{ ingest.Nexter }{nx}, n)
+}
+
+func (c *sourceGRPCClient) Reset(ctx context.Context) error {
+	_, err := c.client.Reset(ctx, &emptypb.Empty{})
+	return fromStatus(err)
+}
+
+// Download returns an object whose reader streams the content from the plugin.
+// The stream ends when ctx is done or the reader is closed.
+func (c *sourceGRPCClient) Download(ctx context.Context, s ingest.Codec) (*ingest.Object, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	stream, err := c.client.Download(ctx, toCodec(s))
+	if err != nil {
+		cancel()
+		return nil, fromStatus(err)
+	}
+	res, err := stream.Recv()
+	if err != nil {
+		cancel()
+		return nil, fromStatus(err)
+	}
+	return &ingest.Object{
+		MimeType: res.MimeType,
+		Len:      res.Len,
+		Reader:   &downloadReader{stream: stream, cancel: cancel, transfers: c.transfers},
+	}, nil
+}
+
+func (c *sourceGRPCClient) CleanUp(ctx context.Context, s ingest.Codec) error {
+	_, err := c.client.CleanUp(ctx, toCodec(s))
+	return fromStatus(err)
+}
+
+// Locate returns nil if the object cannot be addressed with a URI
+// and ingest.ErrLocateNotSupported if the plugin cannot address any object with a URI.
+func (c *sourceGRPCClient) Locate(ctx context.Context, s ingest.Codec) (*url.URL, error) {
+	res, err := c.client.Locate(ctx, toCodec(s))
+	if err != nil {
+		if err = fromStatus(err); errors.Is(err, ErrNotImplemented) {
+			// Plugins that were built before the Locate RPC was added do not implement it either.
+			return nil, ingest.ErrLocateNotSupported
+		}
+		return nil, err
+	}
+	if res.Uri == "" {
+		return nil, nil
+	}
+	return url.Parse(res.Uri)
+}
+
+func (c *sourceGRPCClient) Checkpoint(ctx context.Context) ([]byte, error) {
+	res, err := c.client.Checkpoint(ctx, &emptypb.Empty{})
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+	return res.Checkpoint, nil
+}
+
+func (c *sourceGRPCClient) Restore(ctx context.Context, cp []byte) error {
+	_, err := c.client.Restore(ctx, &proto.RestoreRequest{Checkpoint: cp})
+	return fromStatus(err)
+}
+
+// downloadReader reads the chunks of a download stream and verifies their checksums.
+type downloadReader struct {
+	stream    proto.Source_DownloadClient
+	cancel    context.CancelFunc
+	transfers *transferMetrics
+	buf       []byte
+	err       error
+}
+
+func (r *downloadReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		res, err := r.stream.Recv()
+		if err != nil {
+			if err != io.EOF {
+				err = fromStatus(err)
+			}
+			r.err = err
+			r.cancel()
+			continue
+		}
+		if err := verifyChecksum(res.Chunk, res.Checksum); err != nil {
+			r.transfers.checksumErrors.Inc()
+			r.err = err
+			r.cancel()
+			continue
+		}
+		r.transfers.observe(res.Chunk)
+		r.buf = res.Chunk
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// Close ends the stream, if it was not read to the end.
+func (r *downloadReader) Close() error {
+	r.cancel()
+	return nil
+}
+
+type destinationGRPCServer struct {
+	proto.UnimplementedDestinationServer
+	impl Destination
+
+	g prometheus.Gatherer
+	l hclog.Logger
+	// ctx is canceled when the plugin stops.
+	// Stat and Store get a context that is also canceled with the request, see callContext.
+	ctx context.Context
+	// configured is 1 after the destination was configured.
+	configured int32
+}
+
+func (s *destinationGRPCServer) Gather(context.Context, *emptypb.Empty) (*proto.GatherResponse, error) {
+	return gather(s.g)
+}
+
+func (s *destinationGRPCServer) Schema(context.Context, *emptypb.Empty) (*proto.SchemaResponse, error) {
+	return schema(s.impl)
+}
+
+// Health reports a healthy destination if the destination does not implement HealthChecker.
+func (s *destinationGRPCServer) Health(ctx context.Context, _ *emptypb.Empty) (*proto.HealthResponse, error) {
+	ctx, cancel := callContext(ctx, s.ctx)
+	defer cancel()
+	return health(ctx, s.impl)
+}
+
+func (s *destinationGRPCServer) Configure(_ context.Context, req *proto.ConfigureRequest) (*emptypb.Empty, error) {
+	c, err := decodeConfig(req.Config)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	if err := s.impl.Configure(c); err != nil {
+		return nil, toStatus(err)
+	}
+	atomic.StoreInt32(&s.configured, 1)
+	return &emptypb.Empty{}, nil
+}
+
+func (s *destinationGRPCServer) Stat(ctx context.Context, c *proto.Codec) (*proto.StatResponse, error) {
+	if atomic.LoadInt32(&s.configured) == 0 {
+		return nil, toStatus(ErrNotConfigured)
+	}
+	ctx, cancel := callContext(ctx, s.ctx)
+	defer cancel()
+	oi, err := s.impl.Stat(ctx, fromCodec(c))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &proto.StatResponse{Uri: oi.URI}, nil
+}
+
+// Store reads the codec, the MIME type and the length of the object from the first message
+// and streams the content of the object from the following messages to the destination.
+func (s *destinationGRPCServer) Store(stream proto.Destination_StoreServer) error {
+	if atomic.LoadInt32(&s.configured) == 0 {
+		return toStatus(ErrNotConfigured)
+	}
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	r := &storeReader{stream: stream, buf: req.Chunk}
+	if err := verifyChecksum(req.Chunk, req.Checksum); err != nil {
+		return toStatus(err)
+	}
+	obj := ingest.Object{
+		MimeType: req.MimeType,
+		Len:      req.Len,
+		Reader:   r,
+	}
+	ctx, cancel := callContext(stream.Context(), s.ctx)
+	defer cancel()
+	u, err := s.impl.Store(ctx, fromCodec(req.Codec), obj)
+	if err != nil {
+		if errors.Is(r.err, errChecksumMismatch) {
+			// Destinations may not wrap the errors of the reader, but the client needs to know that the object was corrupted.
+			err = r.err
+		}
+		return toStatus(err)
+	}
+	return stream.SendAndClose(&proto.StoreResponse{Url: u.String()})
+}
+
+// CopyFrom fails with the code ABORTED if the destination cannot copy from the URI
+// and with the code UNIMPLEMENTED if the destination does not implement storage.Copier.
+func (s *destinationGRPCServer) CopyFrom(ctx context.Context, req *proto.CopyFromRequest) (*proto.StoreResponse, error) {
+	if atomic.LoadInt32(&s.configured) == 0 {
+		return nil, toStatus(ErrNotConfigured)
+	}
+	uri, err := url.Parse(req.Uri)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	ctx, cancel := callContext(ctx, s.ctx)
+	defer cancel()
+	u, err := storage.CopyFrom(ctx, s.impl, fromCodec(req.Codec), uri)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &proto.StoreResponse{Url: u.String()}, nil
+}
+
+var (
+	_ Destination         = &destinationGRPCClient{}
+	_ storage.Copier      = &destinationGRPCClient{}
+	_ prometheus.Gatherer = &destinationGRPCClient{}
+	_ Schemer             = &destinationGRPCClient{}
+	_ HealthChecker       = &destinationGRPCClient{}
+)
+
+type destinationGRPCClient struct {
+	client proto.DestinationClient
+	// ctx is canceled when the plugin exits.
+	ctx       context.Context
+	transfers *transferMetrics
+	rpcs      *rpcMetrics
+}
+
+// Gather returns the metrics of the plugin and the metrics of the objects stored with and the calls to the plugin.
+func (c *destinationGRPCClient) Gather() ([]*dto.MetricFamily, error) {
+	res, err := c.client.Gather(c.ctx, &emptypb.Empty{})
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+	mfs, err := decodeMetricFamilies(res)
+	if err != nil {
+		return nil, err
+	}
+	if mfs, err = c.transfers.gather(mfs); err != nil {
+		return nil, err
+	}
+	return c.rpcs.gather(mfs)
+}
+
+// Schema returns nil if the plugin does not describe its configuration.
+func (c *destinationGRPCClient) Schema() ([]byte, error) {
+	res, err := c.client.Schema(c.ctx, &emptypb.Empty{})
+	if err != nil {
+		if err = fromStatus(err); errors.Is(err, ErrNotImplemented) {
+			// Plugins that were built before the Schema RPC was added do not implement it.
+			return nil, nil
+		}
+		return nil, err
+	}
+	return res.Schema, nil
+}
+
+func (c *destinationGRPCClient) Health(ctx context.Context) (Health, error) {
+	return healthFromStatus(c.client.Health(ctx, &emptypb.Empty{}))
+}
+
+func (c *destinationGRPCClient) Configure(conf map[string]any) error {
+	buf, err := encodeConfig(conf)
+	if err != nil {
+		return err
+	}
+	_, err = c.client.Configure(c.ctx, &proto.ConfigureRequest{Config: buf})
+	return fromStatus(err)
+}
+
+func (c *destinationGRPCClient) Stat(ctx context.Context, s ingest.Codec) (*storage.ObjectInfo, error) {
+	res, err := c.client.Stat(ctx, toCodec(s))
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+	return &storage.ObjectInfo{URI: res.Uri}, nil
+}
+
+func (c *destinationGRPCClient) Store(ctx context.Context, s ingest.Codec, obj ingest.Object) (*url.URL, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := c.client.Store(ctx)
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+	req := &proto.StoreRequest{Codec: toCodec(s), MimeType: obj.MimeType, Len: obj.Len}
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := obj.Reader.Read(buf)
+		if n > 0 {
+			req.Chunk, req.Checksum = buf[:n], checksum(buf[:n])
+		}
+		if n > 0 || req.Codec != nil {
+			if err := stream.Send(req); err == io.EOF {
+				// The plugin ended the stream; CloseAndRecv returns its error.
+				break
+			} else if err != nil {
+				return nil, fromStatus(err)
+			}
+			c.transfers.observe(req.Chunk)
+			req = &proto.StoreRequest{}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// Canceling the stream aborts the upload.
+			return nil, err
+		}
+	}
+	res, err := stream.CloseAndRecv()
+	if err != nil {
+		if err = fromStatus(err); errors.Is(err, errChecksumMismatch) {
+			c.transfers.checksumErrors.Inc()
+		}
+		return nil, err
+	}
+	return url.Parse(res.Url)
+}
+
+// CopyFrom returns storage.ErrCopyNotSupported if the plugin cannot copy from the URI
+// and storage.ErrCopyNotImplemented if it cannot copy from any URI or was built before the CopyFrom RPC was added.
+func (c *destinationGRPCClient) CopyFrom(ctx context.Context, s ingest.Codec, uri *url.URL) (*url.URL, error) {
+	res, err := c.client.CopyFrom(ctx, &proto.CopyFromRequest{Codec: toCodec(s), Uri: uri.String()})
+	if err != nil {
+		if err = fromStatus(err); errors.Is(err, ErrNotImplemented) {
+			return nil, storage.ErrCopyNotImplemented
+		}
+		return nil, err
+	}
+	return url.Parse(res.Url)
+}
+
+// storeReader reads the chunks of a store stream and verifies their checksums.
+type storeReader struct {
+	stream proto.Destination_StoreServer
+	buf    []byte
+	err    error
+}
+
+func (r *storeReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		req, err := r.stream.Recv()
+		if err != nil {
+			r.err = err
+			continue
+		}
+		if err := verifyChecksum(req.Chunk, req.Checksum); err != nil {
+			r.err = err
+			continue
+		}
+		r.buf = req.Chunk
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// callContext returns a context for a call of a plugin that carries the deadline of the request
+// and is canceled when the request is canceled, e.g. because the caller gave up, or when the plugin stops.
+// gRPC propagates the deadline and the cancellation of the context of the caller to the request.
+func callContext(req, plugin context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(req)
+	go func() {
+		select {
+		case <-plugin.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+func toCodec(c ingest.Codec) *proto.Codec {
+	p := &proto.Codec{
+		Id:       c.ID,
+		Name:     c.Name,
+		Meta:     c.Meta,
+		Size:     c.Size,
+		MimeType: c.MimeType,
+		Hash:     c.Hash,
+		Tags:     c.Tags,
+	}
+	if c.LastModified != nil {
+		p.LastModified = timestamppb.New(*c.LastModified)
+	}
+	return p
+}
+
+func fromCodec(p *proto.Codec) ingest.Codec {
+	c := ingest.Codec{
+		ID:       p.GetId(),
+		Name:     p.GetName(),
+		Meta:     p.GetMeta(),
+		Size:     p.GetSize(),
+		MimeType: p.GetMimeType(),
+		Hash:     p.GetHash(),
+		Tags:     p.GetTags(),
+	}
+	if p.GetLastModified() != nil {
+		t := p.LastModified.AsTime()
+		c.LastModified = &t
+	}
+	return c
+}
+
+// encodeConfig encodes the configuration of a plugin as a JSON object.
+func encodeConfig(conf map[string]any) ([]byte, error) {
+	if conf == nil {
+		conf = map[string]any{}
+	}
+	return json.Marshal(conf)
+}
+
+func decodeConfig(buf []byte) (map[string]any, error) {
+	c := map[string]any{}
+	if len(buf) == 0 {
+		return c, nil
+	}
+	if err := json.Unmarshal(buf, &c); err != nil {
+		return nil, err
+	}
+	if c == nil {
+		c = map[string]any{}
+	}
+	return c, nil
+}
+
+// schema returns the schema of the configuration of a plugin or an empty schema if it does not implement Schemer.
+func schema(impl any) (*proto.SchemaResponse, error) {
+	b, err := schemaOf(impl)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &proto.SchemaResponse{Schema: b}, nil
+}
+
+func gather(g prometheus.Gatherer) (*proto.GatherResponse, error) {
+	mfs, err := g.Gather()
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	res := &proto.GatherResponse{MetricFamilies: make([][]byte, 0, len(mfs))}
+	for _, mf := range mfs {
+		buf, err := protobuf.Marshal(mf)
+		if err != nil {
+			return nil, toStatus(err)
+		}
+		res.MetricFamilies = append(res.MetricFamilies, buf)
+	}
+	return res, nil
+}
+
+func decodeMetricFamilies(res *proto.GatherResponse) ([]*dto.MetricFamily, error) {
+	mfs := make([]*dto.MetricFamily, 0, len(res.MetricFamilies))
+	for _, buf := range res.MetricFamilies {
+		mf := new(dto.MetricFamily)
+		if err := protobuf.Unmarshal(buf, mf); err != nil {
+			return nil, err
+		}
+		mfs = append(mfs, mf)
+	}
+	return mfs, nil
+}
+
+// toStatus converts the errors that callers check for into gRPC status codes,
+// so that fromStatus can restore them on the other side of the connection.
+func toStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	code := codes.Unknown
+	switch {
+	case errors.Is(err, io.EOF):
+		code = codes.OutOfRange
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	case os.IsNotExist(err) || errors.Is(err, os.ErrNotExist):
+		code = codes.NotFound
+	case errors.Is(err, ErrNotConfigured):
+		code = codes.FailedPrecondition
+	case errors.Is(err, ErrNotImplemented) || errors.Is(err, ingest.ErrLocateNotSupported) || errors.Is(err, storage.ErrCopyNotImplemented):
+		code = codes.Unimplemented
+	case errors.Is(err, storage.ErrCopyNotSupported):
+		code = codes.Aborted
+	case errors.Is(err, errChecksumMismatch):
+		code = codes.DataLoss
+	}
+	return status.Error(code, err.Error())
+}
+
+// fromStatus returns the error that the status code of err stands for, e.g. io.EOF,
+// or an error with the message of the status.
+func fromStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	s, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	switch s.Code() {
+	case codes.OutOfRange:
+		return io.EOF
+	case codes.Canceled:
+		return context.Canceled
+	case codes.DeadlineExceeded:
+		return context.DeadlineExceeded
+	case codes.NotFound:
+		return os.ErrNotExist
+	case codes.FailedPrecondition:
+		return ErrNotConfigured
+	case codes.Unimplemented:
+		return ErrNotImplemented
+	case codes.Aborted:
+		return storage.ErrCopyNotSupported
+	case codes.DataLoss:
+		return errChecksumMismatch
+	}
+	return errors.New(s.Message())
+}
@@ -0,0 +1,264 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	hplugin "github.com/hashicorp/go-plugin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/storage"
+)
+
+// largeSource serves a single object that spans many chunks.
+type largeSource struct {
+	content []byte
+	codec   ingest.Codec
+	next    bool
+	// ctx is kept from Reset, like sources that list objects in the background.
+	ctx context.Context
+}
+
+func (s *largeSource) Configure(map[string]any) error { return nil }
+
+func (s *largeSource) Next(context.Context) (*ingest.Codec, error) {
+	if s.ctx != nil && s.ctx.Err() != nil {
+		return nil, s.ctx.Err()
+	}
+	if s.next {
+		return nil, io.EOF
+	}
+	s.next = true
+	return &s.codec, nil
+}
+
+func (s *largeSource) Reset(ctx context.Context) error {
+	s.next, s.ctx = false, ctx
+	return nil
+}
+
+func (s *largeSource) Download(_ context.Context, c ingest.Codec) (*ingest.Object, error) {
+	if c.ID != s.codec.ID {
+		return nil, os.ErrNotExist
+	}
+	return &ingest.Object{MimeType: "application/octet-stream", Len: int64(len(s.content)), Reader: bytes.NewReader(s.content)}, nil
+}
+
+func (s *largeSource) CleanUp(context.Context, ingest.Codec) error { return ErrNotImplemented }
+
+// bufferDestination keeps the last stored object.
+type bufferDestination struct {
+	codec ingest.Codec
+	obj   ingest.Object
+	buf   []byte
+}
+
+func (d *bufferDestination) Configure(map[string]any) error { return nil }
+
+func (d *bufferDestination) Schema() ([]byte, error) {
+	return []byte(`{"type":"object","properties":{"bucket":{"type":"string"}}}`), nil
+}
+
+func (d *bufferDestination) Stat(context.Context, ingest.Codec) (*storage.ObjectInfo, error) {
+	return nil, os.ErrNotExist
+}
+
+func (d *bufferDestination) Store(_ context.Context, c ingest.Codec, obj ingest.Object) (*url.URL, error) {
+	buf, err := io.ReadAll(obj.Reader)
+	if err != nil {
+		return nil, err
+	}
+	d.codec, d.obj, d.buf = c, obj, buf
+	return url.Parse("mem://" + c.Name)
+}
+
+func TestGRPC(t *testing.T) {
+	modified := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	content := bytes.Repeat([]byte("0123456789"), chunkSize/3)
+	s := &largeSource{content: content, codec: ingest.Codec{ID: "id", Name: "name", Meta: []byte("meta"), Size: 42, MimeType: "text/plain", LastModified: &modified, Hash: "hash", Tags: map[string]string{"team": "a"}}}
+	d := new(bufferDestination)
+	c, _ := hplugin.TestPluginGRPCConn(t, map[string]hplugin.Plugin{
+		"source":      &pluginSource{impl: s, g: prometheus.NewRegistry(), ctx: context.Background()},
+		"destination": &pluginDestination{impl: d, g: prometheus.NewRegistry(), ctx: context.Background()},
+	})
+	t.Cleanup(func() { c.Close() })
+	raw, err := c.Dispense("source")
+	require.NoError(t, err)
+	src := raw.(Source)
+	raw, err = c.Dispense("destination")
+	require.NoError(t, err)
+	dst := raw.(Destination)
+	ctx := context.Background()
+
+	// The schema can be read before the plugin is configured.
+	schema, err := src.(Schemer).Schema()
+	require.NoError(t, err)
+	assert.Empty(t, schema, "the source does not implement Schemer")
+	schema, err = dst.(Schemer).Schema()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"type":"object","properties":{"bucket":{"type":"string"}}}`, string(schema))
+
+	// Calls fail until the plugin is configured.
+	_, err = src.Next(ctx)
+	assert.ErrorIs(t, err, ErrNotConfigured)
+	require.NoError(t, src.Configure(nil))
+	require.NoError(t, dst.Configure(map[string]any{"bucket": "foo"}))
+
+	codec, err := src.Next(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, s.codec, *codec)
+	_, err = src.Next(ctx)
+	assert.ErrorIs(t, err, io.EOF)
+
+	// The context of Reset outlives the call.
+	resetCtx, cancel := context.WithCancel(ctx)
+	require.NoError(t, src.Reset(resetCtx))
+	cancel()
+	_, err = src.Next(ctx)
+	assert.NoError(t, err)
+
+	obj, err := src.Download(ctx, *codec)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), obj.Len)
+	assert.Equal(t, "application/octet-stream", obj.MimeType)
+
+	_, err = dst.Stat(ctx, *codec)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	u, err := dst.Store(ctx, *codec, *obj)
+	require.NoError(t, err)
+	assert.Equal(t, "mem://name", u.String())
+	assert.Equal(t, content, d.buf)
+	assert.Equal(t, obj.Len, d.obj.Len)
+	assert.Equal(t, s.codec, d.codec)
+
+	// The clients count the bytes that they transferred.
+	for _, g := range []prometheus.Gatherer{src.(prometheus.Gatherer), dst.(prometheus.Gatherer)} {
+		mfs, err := g.Gather()
+		require.NoError(t, err)
+		var found bool
+		for _, mf := range mfs {
+			if mf.GetName() == "ingest_plugin_transfer_bytes_total" {
+				found = true
+				assert.Equal(t, float64(len(content)), mf.Metric[0].GetCounter().GetValue())
+			}
+		}
+		assert.True(t, found)
+	}
+
+	_, err = src.Download(ctx, ingest.NewCodec("unknown", "unknown", nil))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.ErrorIs(t, src.CleanUp(ctx, *codec), ErrNotImplemented)
+
+	// Empty objects are stored, too.
+	u, err = dst.Store(ctx, ingest.NewCodec("empty", "empty", nil), ingest.Object{Reader: bytes.NewReader(nil)})
+	require.NoError(t, err)
+	assert.Equal(t, "mem://empty", u.String())
+	assert.Empty(t, d.buf)
+}
+
+// blockingPlugin blocks in Next, Download, Stat and Store until their contexts are done
+// and reports the errors of the contexts.
+type blockingPlugin struct {
+	errs chan error
+}
+
+func (p *blockingPlugin) block(ctx context.Context) error {
+	<-ctx.Done()
+	p.errs <- ctx.Err()
+	return ctx.Err()
+}
+
+func (p *blockingPlugin) Configure(map[string]any) error { return nil }
+
+func (p *blockingPlugin) Reset(context.Context) error { return nil }
+
+func (p *blockingPlugin) Next(ctx context.Context) (*ingest.Codec, error) {
+	return nil, p.block(ctx)
+}
+
+func (p *blockingPlugin) Download(ctx context.Context, _ ingest.Codec) (*ingest.Object, error) {
+	return nil, p.block(ctx)
+}
+
+func (p *blockingPlugin) CleanUp(context.Context, ingest.Codec) error { return nil }
+
+func (p *blockingPlugin) Stat(ctx context.Context, _ ingest.Codec) (*storage.ObjectInfo, error) {
+	return nil, p.block(ctx)
+}
+
+func (p *blockingPlugin) Store(ctx context.Context, _ ingest.Codec, _ ingest.Object) (*url.URL, error) {
+	return nil, p.block(ctx)
+}
+
+func TestGRPCContext(t *testing.T) {
+	p := &blockingPlugin{errs: make(chan error, 1)}
+	// The plugin context outlives the calls, so only the contexts of the callers can end them.
+	c, _ := hplugin.TestPluginGRPCConn(t, map[string]hplugin.Plugin{
+		"source":      &pluginSource{impl: p, g: prometheus.NewRegistry(), ctx: context.Background()},
+		"destination": &pluginDestination{impl: p, g: prometheus.NewRegistry(), ctx: context.Background()},
+	})
+	t.Cleanup(func() { c.Close() })
+	raw, err := c.Dispense("source")
+	require.NoError(t, err)
+	src := raw.(Source)
+	require.NoError(t, src.Configure(nil))
+	raw, err = c.Dispense("destination")
+	require.NoError(t, err)
+	dst := raw.(Destination)
+	require.NoError(t, dst.Configure(nil))
+
+	codec := ingest.NewCodec("id", "name", nil)
+	for name, call := range map[string]func(context.Context) error{
+		"next": func(ctx context.Context) error {
+			_, err := src.Next(ctx)
+			return err
+		},
+		"download": func(ctx context.Context) error {
+			_, err := src.Download(ctx, codec)
+			return err
+		},
+		"stat": func(ctx context.Context) error {
+			_, err := dst.Stat(ctx, codec)
+			return err
+		},
+		"store": func(ctx context.Context) error {
+			_, err := dst.Store(ctx, codec, ingest.Object{Reader: bytes.NewReader([]byte("content"))})
+			return err
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			// Deadlines are propagated to the plugin.
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			assert.ErrorIs(t, call(ctx), context.DeadlineExceeded)
+			select {
+			case err := <-p.errs:
+				assert.Error(t, err)
+			case <-time.After(5 * time.Second):
+				t.Fatal("the call was not aborted in the plugin")
+			}
+
+			// Cancellation is propagated to the plugin.
+			ctx, cancel = context.WithCancel(context.Background())
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+				cancel()
+			}()
+			assert.ErrorIs(t, call(ctx), context.Canceled)
+			select {
+			case err := <-p.errs:
+				assert.ErrorIs(t, err, context.Canceled)
+			case <-time.After(5 * time.Second):
+				t.Fatal("the call was not aborted in the plugin")
+			}
+		})
+	}
+}
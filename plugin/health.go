@@ -0,0 +1,201 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/connylabs/ingest/plugin/proto"
+)
+
+// healthTimeout is the time after which a plugin that does not report its health is unhealthy.
+const healthTimeout = 5 * time.Second
+
+// HealthStatus is the status of a source or destination.
+type HealthStatus int
+
+const (
+	// Healthy sources and destinations work as expected.
+	Healthy HealthStatus = iota
+	// Degraded sources and destinations work, but not as expected, e.g. because they are rate limited.
+	Degraded
+	// Unhealthy sources and destinations do not work, e.g. because their credentials expired.
+	Unhealthy
+)
+
+func (s HealthStatus) String() string {
+	switch s {
+	case Healthy:
+		return "healthy"
+	case Degraded:
+		return "degraded"
+	case Unhealthy:
+		return "unhealthy"
+	}
+	return fmt.Sprintf("HealthStatus(%d)", int(s))
+}
+
+// Common reasons for the status of a source or destination.
+const (
+	HealthReasonAuthExpired = "AuthExpired"
+	HealthReasonRateLimited = "RateLimited"
+	HealthReasonUnreachable = "Unreachable"
+)
+
+// Health is the health of a source or destination beyond whether its plugin responds.
+type Health struct {
+	Status HealthStatus
+	// Reason is a machine-readable reason for the status, e.g. HealthReasonRateLimited.
+	Reason string
+	// Message describes the status for humans.
+	Message string
+}
+
+// A HealthChecker reports its health, e.g. when its credentials expired.
+// Sources and destinations that do not implement HealthChecker are healthy as long as their plugins respond.
+type HealthChecker interface {
+	Health(context.Context) (Health, error)
+}
+
+// healthOf returns the health of a source or destination.
+// Sources and destinations that fail to report their health are unhealthy.
+func healthOf(ctx context.Context, t any) Health {
+	hc, ok := t.(HealthChecker)
+	if !ok {
+		return Health{}
+	}
+	ctx, cancel := context.WithTimeout(ctx, healthTimeout)
+	defer cancel()
+	h, err := hc.Health(ctx)
+	if err != nil {
+		return Health{Status: Unhealthy, Reason: HealthReasonUnreachable, Message: fmt.Sprintf("failed to get health: %v", err)}
+	}
+	return h
+}
+
+func toHealthResponse(h Health) *proto.HealthResponse {
+	return &proto.HealthResponse{Status: proto.HealthResponse_Status(h.Status), Reason: h.Reason, Message: h.Message}
+}
+
+func fromHealthResponse(res *proto.HealthResponse) Health {
+	return Health{Status: HealthStatus(res.GetStatus()), Reason: res.GetReason(), Message: res.GetMessage()}
+}
+
+// health returns the health that the server of a plugin reports for its source or destination.
+func health(ctx context.Context, impl any) (*proto.HealthResponse, error) {
+	hc, ok := impl.(HealthChecker)
+	if !ok {
+		return &proto.HealthResponse{}, nil
+	}
+	h, err := hc.Health(ctx)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return toHealthResponse(h), nil
+}
+
+// healthFromStatus returns the health from a Health RPC.
+// Plugins that were built before the Health RPC was added are healthy as long as they respond.
+func healthFromStatus(res *proto.HealthResponse, err error) (Health, error) {
+	if err != nil {
+		if err = fromStatus(err); errors.Is(err, ErrNotImplemented) {
+			return Health{}, nil
+		}
+		return Health{}, err
+	}
+	return fromHealthResponse(res), nil
+}
+
+// PluginHealth is the health of a source or destination that the PluginManager manages.
+type PluginHealth struct {
+	Health
+	Path string
+	// Mode is either source or destination.
+	Mode string
+	// Labels are the labels that were given when the source or destination was created.
+	Labels prometheus.Labels
+}
+
+func (ph PluginHealth) String() string {
+	keys := make([]string, 0, len(ph.Labels))
+	for k := range ph.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	labels := make([]string, 0, len(keys))
+	for _, k := range keys {
+		labels = append(labels, fmt.Sprintf("%s=%q", k, ph.Labels[k]))
+	}
+	s := fmt.Sprintf("%s plugin %q {%s} is %s", ph.Mode, strings.TrimPrefix(filepath.Base(ph.Path), builtinPrefix), strings.Join(labels, ","), ph.Status)
+	if ph.Reason != "" {
+		s += ": " + ph.Reason
+	}
+	if ph.Message != "" {
+		s += ": " + ph.Message
+	}
+	return s
+}
+
+// Health returns the health of all managed sources and destinations.
+func (pm *PluginManager) Health(ctx context.Context) []PluginHealth {
+	pm.m.Lock()
+	sources := append([]withClient[Source](nil), pm.sources...)
+	destinations := append([]withClient[Destination](nil), pm.destinations...)
+	pm.m.Unlock()
+
+	hs := make([]PluginHealth, len(sources)+len(destinations))
+	g := multierror.Group{}
+	for i := range sources {
+		i := i
+		g.Go(func() error {
+			hs[i] = PluginHealth{Health: healthOf(ctx, sources[i].t), Path: sources[i].path, Mode: "source", Labels: sources[i].labels}
+			return nil
+		})
+	}
+	for i := range destinations {
+		i := i
+		g.Go(func() error {
+			hs[len(sources)+i] = PluginHealth{Health: healthOf(ctx, destinations[i].t), Path: destinations[i].path, Mode: "destination", Labels: destinations[i].labels}
+			return nil
+		})
+	}
+	// None of the go routines in the group return errors.
+	g.Wait() //nolint:errcheck
+	return hs
+}
+
+// Healthy returns an error that lists the sources and destinations that are degraded or unhealthy.
+// It can be used as a healthcheck.
+func (pm *PluginManager) Healthy() error {
+	var errs []string
+	for _, h := range pm.Health(context.Background()) {
+		if h.Status != Healthy {
+			errs = append(errs, h.String())
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(errs, "; "))
+}
+
+// healthFamily returns the metric family with the health status of a source or destination.
+func healthFamily(h Health, labels prometheus.Labels) *dto.MetricFamily {
+	return &dto.MetricFamily{
+		Name: ptr("ingest_plugin_health_status"),
+		Help: ptr("The health status of the plugin: 0 is healthy, 1 is degraded and 2 is unhealthy."),
+		Type: dto.MetricType_GAUGE.Enum(),
+		Metric: []*dto.Metric{{
+			Label: relabel([]*dto.LabelPair{{Name: ptr("reason"), Value: ptr(h.Reason)}}, labels),
+			Gauge: &dto.Gauge{Value: ptr(float64(h.Status))},
+		}},
+	}
+}
@@ -0,0 +1,95 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	hplugin "github.com/hashicorp/go-plugin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// degradedSource is a noop source that reports its health.
+type degradedSource struct {
+	*noopSource
+	health Health
+}
+
+func (s *degradedSource) Health(context.Context) (Health, error) {
+	return s.health, nil
+}
+
+func TestGRPCHealth(t *testing.T) {
+	degraded := Health{Status: Degraded, Reason: HealthReasonRateLimited, Message: "429 Too Many Requests"}
+	c, _ := hplugin.TestPluginGRPCConn(t, map[string]hplugin.Plugin{
+		"source":      &pluginSource{impl: &degradedSource{NewNoopSource(hclog.NewNullLogger()), degraded}, g: prometheus.NewRegistry(), ctx: context.Background()},
+		"destination": &pluginDestination{impl: NewNoopDestination(hclog.NewNullLogger()), g: prometheus.NewRegistry(), ctx: context.Background()},
+	})
+	t.Cleanup(func() { c.Close() })
+	raw, err := c.Dispense("source")
+	require.NoError(t, err)
+	h, err := raw.(HealthChecker).Health(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, degraded, h)
+
+	// Destinations that do not implement HealthChecker are healthy.
+	raw, err = c.Dispense("destination")
+	require.NoError(t, err)
+	h, err = raw.(HealthChecker).Health(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, Health{}, h)
+
+	// Plugins that were built before the Health RPC was added are healthy.
+	h, err = healthFromStatus(nil, status.Error(codes.Unimplemented, "method Health not implemented"))
+	require.NoError(t, err)
+	assert.Equal(t, Health{}, h)
+}
+
+func TestPluginManagerHealth(t *testing.T) {
+	s := &degradedSource{noopSource: NewNoopSource(hclog.NewNullLogger())}
+	RegisterBuiltin("test-health", Builtin{
+		NewSource: func(hclog.Logger, prometheus.Registerer) Source { return s },
+	})
+	path, ok := BuiltinPath("test-health")
+	require.True(t, ok)
+	pm := NewPluginManager(time.Millisecond, nil)
+	t.Cleanup(pm.Stop)
+	_, err := pm.NewSource(path, nil, prometheus.Labels{"source": "foo"})
+	require.NoError(t, err)
+	_, err = pm.NewDestination(noopPath, nil, prometheus.Labels{"destination": "bar"})
+	require.NoError(t, err)
+	assert.NoError(t, pm.Healthy())
+
+	s.health = Health{Status: Unhealthy, Reason: HealthReasonAuthExpired, Message: "the token expired"}
+	assert.EqualError(t, pm.Healthy(), `source plugin "test-health" {source="foo"} is unhealthy: AuthExpired: the token expired`)
+
+	mfs, err := pm.Gather()
+	require.NoError(t, err)
+	var found bool
+	for _, mf := range mfs {
+		if mf.GetName() != "ingest_plugin_health_status" {
+			continue
+		}
+		found = true
+		require.Len(t, mf.Metric, 2)
+		for _, m := range mf.Metric {
+			labels := make(map[string]string)
+			for _, lp := range m.Label {
+				labels[lp.GetName()] = lp.GetValue()
+			}
+			if labels["source"] == "foo" {
+				assert.Equal(t, 2.0, m.GetGauge().GetValue())
+				assert.Equal(t, HealthReasonAuthExpired, labels["reason"])
+			} else {
+				assert.Equal(t, "bar", labels["destination"])
+				assert.Equal(t, 0.0, m.GetGauge().GetValue())
+			}
+		}
+	}
+	assert.True(t, found)
+}
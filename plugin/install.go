@@ -0,0 +1,464 @@
+package plugin
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const (
+	// ociPrefix is the prefix of references to plugins in OCI registries,
+	// e.g. oci://ghcr.io/connylabs/ingest-plugin-sftp:v1.2.0.
+	ociPrefix = "oci://"
+	// pluginRepositoryPrefix is trimmed from the name of a repository to get the name of its plugin.
+	pluginRepositoryPrefix = "ingest-plugin-"
+
+	mediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+	mediaTypeOCIManifest        = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	annotationTitle             = "org.opencontainers.image.title"
+
+	maxManifestSize = 4 << 20
+	maxPluginSize   = 512 << 20
+)
+
+// An Installer downloads plugins from OCI registries into a plugin directory.
+type Installer struct {
+	// Client is the HTTP client for the registry. If it is nil, http.DefaultClient is used.
+	Client *http.Client
+	// PlainHTTP connects to the registry with HTTP instead of HTTPS.
+	PlainHTTP bool
+	// Username and Password authenticate with the registry. Public plugins do not need them.
+	Username string
+	Password string
+}
+
+// ociReference is a parsed oci:// reference.
+type ociReference struct {
+	registry   string
+	repository string
+	// reference is a tag or a digest.
+	reference string
+}
+
+// parseOCIReference parses a reference like oci://registry/org/repository:tag or oci://registry/org/repository@sha256:....
+// The tag defaults to latest.
+func parseOCIReference(s string) (*ociReference, error) {
+	if !strings.HasPrefix(s, ociPrefix) {
+		return nil, fmt.Errorf("plugin reference %q must start with %q", s, ociPrefix)
+	}
+	s = strings.TrimPrefix(s, ociPrefix)
+	i := strings.Index(s, "/")
+	if i <= 0 || i == len(s)-1 {
+		return nil, fmt.Errorf("plugin reference %q must name a registry and a repository", ociPrefix+s)
+	}
+	r := &ociReference{registry: s[:i], repository: s[i+1:], reference: "latest"}
+	if j := strings.Index(r.repository, "@"); j >= 0 {
+		r.repository, r.reference = r.repository[:j], r.repository[j+1:]
+		if _, _, err := parseDigest(r.reference); err != nil {
+			return nil, err
+		}
+	} else if j := strings.LastIndex(r.repository, ":"); j >= 0 && !strings.Contains(r.repository[j:], "/") {
+		r.repository, r.reference = r.repository[:j], r.repository[j+1:]
+	}
+	if r.repository == "" || r.reference == "" {
+		return nil, fmt.Errorf("invalid plugin reference %q", ociPrefix+s)
+	}
+	return r, nil
+}
+
+// name returns the name of the plugin, which is the last element of the repository without the ingest-plugin- prefix.
+func (r *ociReference) name() string {
+	return strings.TrimPrefix(path.Base(r.repository), pluginRepositoryPrefix)
+}
+
+// parseDigest splits a digest into its algorithm and hex encoded value.
+// Only sha256 digests are supported.
+func parseDigest(d string) (string, []byte, error) {
+	alg, enc, ok := strings.Cut(d, ":")
+	if !ok || alg != "sha256" {
+		return "", nil, fmt.Errorf("unsupported digest %q: only sha256 digests are supported", d)
+	}
+	sum, err := hex.DecodeString(enc)
+	if err != nil || len(sum) != sha256.Size {
+		return "", nil, fmt.Errorf("invalid digest %q", d)
+	}
+	return alg, sum, nil
+}
+
+// descriptor describes content in a registry.
+type descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Platform    *struct {
+		OS           string `json:"os"`
+		Architecture string `json:"architecture"`
+	} `json:"platform,omitempty"`
+}
+
+// manifest is an image manifest or an image index.
+type manifest struct {
+	MediaType string       `json:"mediaType"`
+	Manifests []descriptor `json:"manifests"`
+	Layers    []descriptor `json:"layers"`
+}
+
+// Install downloads the plugin that the oci:// reference names into the directory and returns the path of the plugin.
+// The plugin is named after the repository without the ingest-plugin- prefix,
+// e.g. oci://ghcr.io/connylabs/ingest-plugin-sftp:v1.2.0 installs the plugin sftp.
+// If the reference names an image index, the manifest of the platform of the process is installed.
+// The plugin is the layer whose title annotation is the name of the plugin or the only layer of the manifest;
+// layers that are tar archives must contain a single file or a file named after the plugin.
+// The digests of the manifest and of the layer are verified and the plugin only replaces an installed plugin
+// of the same name once it was downloaded completely.
+func (in *Installer) Install(ctx context.Context, ref, dir string) (string, error) {
+	r, err := parseOCIReference(ref)
+	if err != nil {
+		return "", err
+	}
+	m, err := in.manifest(ctx, r, r.reference)
+	if err != nil {
+		return "", err
+	}
+	if len(m.Manifests) > 0 {
+		d, err := platformManifest(m.Manifests)
+		if err != nil {
+			return "", fmt.Errorf("failed to install plugin %q: %w", ref, err)
+		}
+		if m, err = in.manifest(ctx, r, d.Digest); err != nil {
+			return "", err
+		}
+	}
+	l, err := pluginLayer(m.Layers, r.name())
+	if err != nil {
+		return "", fmt.Errorf("failed to install plugin %q: %w", ref, err)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create plugin directory: %w", err)
+	}
+	f, err := os.CreateTemp(dir, "."+r.name()+"-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create plugin file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if err := in.blob(ctx, r, l, f); err != nil {
+		return "", err
+	}
+	if isTar(l.MediaType) {
+		if err := extractPlugin(f, l.MediaType, r.name()); err != nil {
+			return "", fmt.Errorf("failed to extract plugin %q: %w", ref, err)
+		}
+	}
+	if err := f.Chmod(0o755); err != nil {
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	p := filepath.Join(dir, r.name())
+	if err := os.Rename(f.Name(), p); err != nil {
+		return "", fmt.Errorf("failed to install plugin: %w", err)
+	}
+	return p, nil
+}
+
+// platformManifest selects the manifest of the platform of the process from an image index.
+func platformManifest(ds []descriptor) (descriptor, error) {
+	for _, d := range ds {
+		if d.Platform != nil && d.Platform.OS == runtime.GOOS && d.Platform.Architecture == runtime.GOARCH {
+			return d, nil
+		}
+	}
+	return descriptor{}, fmt.Errorf("no manifest for platform %s/%s", runtime.GOOS, runtime.GOARCH)
+}
+
+// pluginLayer selects the layer that holds the plugin.
+func pluginLayer(ls []descriptor, name string) (descriptor, error) {
+	for _, l := range ls {
+		if t := l.Annotations[annotationTitle]; t == name || t == pluginRepositoryPrefix+name {
+			return l, nil
+		}
+	}
+	if len(ls) == 1 {
+		return ls[0], nil
+	}
+	return descriptor{}, fmt.Errorf("expected a single layer or a layer titled %q, found %d layers", name, len(ls))
+}
+
+func isTar(mediaType string) bool {
+	return strings.HasSuffix(mediaType, ".tar") || strings.HasSuffix(mediaType, ".tar+gzip") || strings.HasSuffix(mediaType, ".tar.gzip")
+}
+
+// extractPlugin replaces the content of f, which is a tar archive, with the plugin in the archive.
+func extractPlugin(f *os.File, mediaType, name string) error {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	var r io.Reader = f
+	if !strings.HasSuffix(mediaType, ".tar") {
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gr.Close()
+		r = gr
+	}
+	var (
+		buf   bytes.Buffer
+		count int
+		found bool
+	)
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		count++
+		b := path.Base(h.Name)
+		if match := b == name || b == pluginRepositoryPrefix+name; match || count == 1 {
+			buf.Reset()
+			if _, err := io.Copy(&buf, io.LimitReader(tr, maxPluginSize)); err != nil {
+				return err
+			}
+			if match {
+				found = true
+				break
+			}
+		}
+	}
+	if count == 0 || (count > 1 && !found) {
+		return fmt.Errorf("expected a single file or a file named %q in the archive, found %d files", name, count)
+	}
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := f.Write(buf.Bytes())
+	return err
+}
+
+// manifest fetches the manifest of the reference, which is a tag or a digest.
+// The digest of the manifest is verified against the digest in the reference or the Docker-Content-Digest header.
+func (in *Installer) manifest(ctx context.Context, r *ociReference, reference string) (*manifest, error) {
+	res, err := in.get(ctx, r, "manifests/"+reference, strings.Join([]string{mediaTypeOCIIndex, mediaTypeOCIManifest, mediaTypeDockerManifestList, mediaTypeDockerManifest}, ", "))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch manifest %q: %w", reference, err)
+	}
+	defer res.Body.Close()
+	buf, err := io.ReadAll(io.LimitReader(res.Body, maxManifestSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch manifest %q: %w", reference, err)
+	}
+	if len(buf) > maxManifestSize {
+		return nil, fmt.Errorf("manifest %q exceeds %d bytes", reference, maxManifestSize)
+	}
+	digest := res.Header.Get("Docker-Content-Digest")
+	if strings.Contains(reference, ":") {
+		digest = reference
+	}
+	if digest != "" {
+		_, sum, err := parseDigest(digest)
+		if err != nil {
+			return nil, err
+		}
+		if s := sha256.Sum256(buf); !bytes.Equal(s[:], sum) {
+			return nil, fmt.Errorf("manifest %q does not match digest %q", reference, digest)
+		}
+	}
+	m := new(manifest)
+	if err := json.Unmarshal(buf, m); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest %q: %w", reference, err)
+	}
+	return m, nil
+}
+
+// blob downloads the content of the descriptor to w and verifies its size and digest.
+func (in *Installer) blob(ctx context.Context, r *ociReference, d descriptor, w io.Writer) error {
+	_, sum, err := parseDigest(d.Digest)
+	if err != nil {
+		return err
+	}
+	if d.Size > maxPluginSize {
+		return fmt.Errorf("plugin exceeds %d bytes", maxPluginSize)
+	}
+	res, err := in.get(ctx, r, "blobs/"+d.Digest, "")
+	if err != nil {
+		return fmt.Errorf("failed to download plugin: %w", err)
+	}
+	defer res.Body.Close()
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(w, h), io.LimitReader(res.Body, d.Size+1))
+	if err != nil {
+		return fmt.Errorf("failed to download plugin: %w", err)
+	}
+	if n != d.Size {
+		return fmt.Errorf("plugin has %d bytes but the manifest declares %d bytes", n, d.Size)
+	}
+	if !bytes.Equal(h.Sum(nil), sum) {
+		return fmt.Errorf("plugin does not match digest %q", d.Digest)
+	}
+	return nil
+}
+
+// get requests a path below /v2/<repository>/ of the registry.
+// If the registry challenges the request, it is retried with the credentials of the installer
+// or with a bearer token from the token service of the registry.
+func (in *Installer) get(ctx context.Context, r *ociReference, p, accept string) (*http.Response, error) {
+	scheme := "https"
+	if in.PlainHTTP {
+		scheme = "http"
+	}
+	u := fmt.Sprintf("%s://%s/v2/%s/%s", scheme, r.registry, r.repository, p)
+	do := func(auth string) (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		return in.client().Do(req)
+	}
+	res, err := do("")
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusUnauthorized {
+		challenge := res.Header.Get("WWW-Authenticate")
+		res.Body.Close()
+		auth, err := in.authorize(ctx, challenge)
+		if err != nil {
+			return nil, err
+		}
+		if res, err = do(auth); err != nil {
+			return nil, err
+		}
+	}
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		buf, _ := io.ReadAll(io.LimitReader(res.Body, 1<<10))
+		return nil, fmt.Errorf("unexpected status code %d: %s", res.StatusCode, bytes.TrimSpace(buf))
+	}
+	return res, nil
+}
+
+// authorize answers a WWW-Authenticate challenge with the value of an Authorization header.
+func (in *Installer) authorize(ctx context.Context, challenge string) (string, error) {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if in.Username == "" && in.Password == "" {
+			return "", errors.New("the registry requires credentials")
+		}
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		req.SetBasicAuth(in.Username, in.Password)
+		return req.Header.Get("Authorization"), nil
+	case "bearer":
+	default:
+		return "", fmt.Errorf("unsupported authentication challenge %q", challenge)
+	}
+	ps := parseChallenge(params)
+	realm, err := url.Parse(ps["realm"])
+	if err != nil || ps["realm"] == "" {
+		return "", fmt.Errorf("invalid authentication challenge %q", challenge)
+	}
+	q := realm.Query()
+	for _, k := range []string{"service", "scope"} {
+		if v, ok := ps[k]; ok {
+			q.Set(k, v)
+		}
+	}
+	realm.RawQuery = q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if in.Username != "" || in.Password != "" {
+		req.SetBasicAuth(in.Username, in.Password)
+	}
+	res, err := in.client().Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch registry token: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch registry token: unexpected status code %d", res.StatusCode)
+	}
+	var t struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(res.Body, maxManifestSize)).Decode(&t); err != nil {
+		return "", fmt.Errorf("failed to decode registry token: %w", err)
+	}
+	if t.Token == "" {
+		t.Token = t.AccessToken
+	}
+	if t.Token == "" {
+		return "", errors.New("the registry returned an empty token")
+	}
+	return "Bearer " + t.Token, nil
+}
+
+// parseChallenge parses the comma separated key="value" parameters of a WWW-Authenticate header.
+func parseChallenge(s string) map[string]string {
+	ps := make(map[string]string)
+	for len(s) > 0 {
+		s = strings.TrimLeft(s, " ,")
+		k, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			break
+		}
+		var v string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				break
+			}
+			v, s = rest[1:end+1], rest[end+2:]
+		} else {
+			v, s, _ = strings.Cut(rest, ",")
+		}
+		ps[strings.ToLower(strings.TrimSpace(k))] = v
+	}
+	return ps
+}
+
+func (in *Installer) client() *http.Client {
+	if in.Client != nil {
+		return in.Client
+	}
+	return http.DefaultClient
+}
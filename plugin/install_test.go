@@ -0,0 +1,182 @@
+package plugin
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func digest(b []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(b))
+}
+
+// testRegistry serves the blobs of a repository and requires a bearer token.
+type testRegistry struct {
+	blobs     map[string][]byte
+	manifests map[string][]byte
+	mediaType map[string]string
+}
+
+func (r *testRegistry) add(ref, mediaType string, v any) string {
+	b, _ := json.Marshal(v)
+	d := digest(b)
+	r.manifests[d] = b
+	r.mediaType[d] = mediaType
+	if ref != "" {
+		r.manifests[ref] = b
+		r.mediaType[ref] = mediaType
+	}
+	return d
+}
+
+func (r *testRegistry) blob(b []byte) string {
+	d := digest(b)
+	r.blobs[d] = b
+	return d
+}
+
+func (r *testRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/token" {
+		if req.URL.Query().Get("scope") != "repository:connylabs/ingest-plugin-test:pull" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, `{"token":"secret"}`)
+		return
+	}
+	if req.Header.Get("Authorization") != "Bearer secret" {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="https://%s/token",service="test",scope="repository:connylabs/ingest-plugin-test:pull"`, req.Host))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	p := strings.TrimPrefix(req.URL.Path, "/v2/connylabs/ingest-plugin-test/")
+	switch {
+	case strings.HasPrefix(p, "manifests/"):
+		b, ok := r.manifests[strings.TrimPrefix(p, "manifests/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", r.mediaType[strings.TrimPrefix(p, "manifests/")])
+		w.Write(b)
+	case strings.HasPrefix(p, "blobs/"):
+		b, ok := r.blobs[strings.TrimPrefix(p, "blobs/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(b)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestInstall(t *testing.T) {
+	r := &testRegistry{blobs: make(map[string][]byte), manifests: make(map[string][]byte), mediaType: make(map[string]string)}
+	s := httptest.NewTLSServer(r)
+	t.Cleanup(s.Close)
+	host := s.Listener.Addr().String()
+	in := &Installer{Client: s.Client()}
+
+	binary := []byte("#!/bin/sh\necho plugin\n")
+	r.add("raw", mediaTypeOCIManifest, manifest{
+		MediaType: mediaTypeOCIManifest,
+		Layers: []descriptor{
+			{MediaType: "application/vnd.oci.image.config.v1+json", Digest: r.blob([]byte("README")), Size: 6, Annotations: map[string]string{annotationTitle: "README.md"}},
+			{MediaType: "application/octet-stream", Digest: r.blob(binary), Size: int64(len(binary)), Annotations: map[string]string{annotationTitle: "test"}},
+		},
+	})
+
+	var archive bytes.Buffer
+	gw := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(gw)
+	for name, content := range map[string][]byte{"LICENSE": []byte("license"), "bin/ingest-plugin-test": binary} {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0o755, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write(content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gw.Close())
+	platform := r.add("", mediaTypeOCIManifest, manifest{
+		MediaType: mediaTypeOCIManifest,
+		Layers:    []descriptor{{MediaType: "application/vnd.oci.image.layer.v1.tar+gzip", Digest: r.blob(archive.Bytes()), Size: int64(archive.Len())}},
+	})
+	index := manifest{MediaType: mediaTypeOCIIndex, Manifests: []descriptor{{MediaType: mediaTypeOCIManifest, Digest: platform}}}
+	index.Manifests[0].Platform = &struct {
+		OS           string `json:"os"`
+		Architecture string `json:"architecture"`
+	}{OS: runtime.GOOS, Architecture: runtime.GOARCH}
+	indexDigest := r.add("index", mediaTypeOCIIndex, index)
+
+	r.add("corrupt", mediaTypeOCIManifest, manifest{
+		MediaType: mediaTypeOCIManifest,
+		Layers:    []descriptor{{MediaType: "application/octet-stream", Digest: digest([]byte("other")), Size: int64(len(binary))}},
+	})
+	r.blobs[digest([]byte("other"))] = binary
+
+	for _, tc := range []struct {
+		name string
+		ref  string
+		err  bool
+	}{
+		{name: "raw layer", ref: fmt.Sprintf("oci://%s/connylabs/ingest-plugin-test:raw", host)},
+		{name: "index with archive", ref: fmt.Sprintf("oci://%s/connylabs/ingest-plugin-test:index", host)},
+		{name: "digest", ref: fmt.Sprintf("oci://%s/connylabs/ingest-plugin-test@%s", host, indexDigest)},
+		{name: "wrong digest", ref: fmt.Sprintf("oci://%s/connylabs/ingest-plugin-test@%s", host, digest([]byte("other"))), err: true},
+		{name: "corrupt layer", ref: fmt.Sprintf("oci://%s/connylabs/ingest-plugin-test:corrupt", host), err: true},
+		{name: "unknown tag", ref: fmt.Sprintf("oci://%s/connylabs/ingest-plugin-test:unknown", host), err: true},
+		{name: "no oci prefix", ref: fmt.Sprintf("%s/connylabs/ingest-plugin-test:raw", host), err: true},
+		{name: "no repository", ref: "oci://" + host, err: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "plugins")
+			p, err := in.Install(context.Background(), tc.ref, dir)
+			if tc.err {
+				assert.Error(t, err)
+				entries, _ := os.ReadDir(dir)
+				assert.Empty(t, entries, "no plugin or temporary file is left behind")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, filepath.Join(dir, "test"), p)
+			b, err := os.ReadFile(p)
+			require.NoError(t, err)
+			assert.Equal(t, binary, b)
+			fi, err := os.Stat(p)
+			require.NoError(t, err)
+			assert.Equal(t, os.FileMode(0o755), fi.Mode().Perm())
+			entries, err := os.ReadDir(dir)
+			require.NoError(t, err)
+			assert.Len(t, entries, 1)
+		})
+	}
+}
+
+func TestParseOCIReference(t *testing.T) {
+	r, err := parseOCIReference("oci://localhost:5000/org/ingest-plugin-sftp")
+	require.NoError(t, err)
+	assert.Equal(t, &ociReference{registry: "localhost:5000", repository: "org/ingest-plugin-sftp", reference: "latest"}, r)
+	assert.Equal(t, "sftp", r.name())
+
+	r, err = parseOCIReference("oci://ghcr.io/org/sftp:v1.2.0")
+	require.NoError(t, err)
+	assert.Equal(t, &ociReference{registry: "ghcr.io", repository: "org/sftp", reference: "v1.2.0"}, r)
+	assert.Equal(t, "sftp", r.name())
+
+	_, err = parseOCIReference("oci://ghcr.io/org/sftp@md5:abc")
+	assert.Error(t, err)
+}
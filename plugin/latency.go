@@ -0,0 +1,93 @@
+package plugin
+
+import (
+	"context"
+	"path"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/grpc"
+)
+
+// rpcMetrics measure the durations of the gRPC calls between ingest and a plugin.
+// Ingest and plugins both measure the calls with the same metric and a side label,
+// so that the time spent in the plugin can be told apart from the time spent on the connection.
+type rpcMetrics struct {
+	r        *prometheus.Registry
+	duration *prometheus.HistogramVec
+}
+
+// newRPCMetrics returns the metrics of the calls measured on the given side, i.e. ingest or plugin.
+func newRPCMetrics(side string) *rpcMetrics {
+	m := &rpcMetrics{
+		r: prometheus.NewRegistry(),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:        "ingest_plugin_rpc_duration_seconds",
+			Help:        "How many seconds the calls to the plugin took. Streaming calls like Download and Store include the transfer of the object.",
+			Buckets:     []float64{0.001, 0.01, 0.1, 0.3, 1, 3, 10, 30, 60, 120, 300, 600, 1800, 3600},
+			ConstLabels: prometheus.Labels{"side": side},
+		}, []string{"rpc_method"}),
+	}
+	m.r.MustRegister(m.duration)
+	return m
+}
+
+// observe records a call to the gRPC method with the given full name, e.g. /proto.Source/Next.
+func (m *rpcMetrics) observe(method string, start time.Time) {
+	m.duration.WithLabelValues(path.Base(method)).Observe(time.Since(start).Seconds())
+}
+
+// gather appends the call metrics to the metric families of a plugin.
+func (m *rpcMetrics) gather(mfs []*dto.MetricFamily) ([]*dto.MetricFamily, error) {
+	rmfs, err := m.r.Gather()
+	if err != nil {
+		return nil, err
+	}
+	return append(mfs, rmfs...), nil
+}
+
+// instrument returns a connection to a plugin that measures the calls of the clients that use it.
+func (m *rpcMetrics) instrument(cc grpc.ClientConnInterface) grpc.ClientConnInterface {
+	return &instrumentedConn{ClientConnInterface: cc, m: m}
+}
+
+// serverOptions return the options of the gRPC server of a plugin that measure the calls that it serves.
+func (m *rpcMetrics) serverOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			defer m.observe(info.FullMethod, time.Now())
+			return handler(ctx, req)
+		}),
+		grpc.ChainStreamInterceptor(func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			defer m.observe(info.FullMethod, time.Now())
+			return handler(srv, ss)
+		}),
+	}
+}
+
+type instrumentedConn struct {
+	grpc.ClientConnInterface
+	m *rpcMetrics
+}
+
+func (c *instrumentedConn) Invoke(ctx context.Context, method string, args, reply any, opts ...grpc.CallOption) error {
+	defer c.m.observe(method, time.Now())
+	return c.ClientConnInterface.Invoke(ctx, method, args, reply, opts...)
+}
+
+// NewStream measures a streaming call until the stream ends, i.e. until its context is done,
+// which happens when the stream finished, failed or was canceled, e.g. because the reader of a download was closed.
+func (c *instrumentedConn) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	start := time.Now()
+	s, err := c.ClientConnInterface.NewStream(ctx, desc, method, opts...)
+	if err != nil {
+		c.m.observe(method, start)
+		return nil, err
+	}
+	go func() {
+		<-s.Context().Done()
+		c.m.observe(method, start)
+	}()
+	return s, nil
+}
@@ -0,0 +1,102 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/connylabs/ingest"
+)
+
+// rpcCounts returns the number of calls to the plugin by side and method.
+func rpcCounts(t *testing.T, g prometheus.Gatherer) map[string]map[string]uint64 {
+	mfs, err := g.Gather()
+	require.NoError(t, err)
+	counts := make(map[string]map[string]uint64)
+	for _, mf := range mfs {
+		if mf.GetName() != "ingest_plugin_rpc_duration_seconds" {
+			continue
+		}
+		for _, m := range mf.Metric {
+			var side, method string
+			for _, lp := range m.Label {
+				switch lp.GetName() {
+				case "side":
+					side = lp.GetValue()
+				case "rpc_method":
+					method = lp.GetValue()
+				}
+			}
+			if counts[side] == nil {
+				counts[side] = make(map[string]uint64)
+			}
+			counts[side][method] += m.GetHistogram().GetSampleCount()
+		}
+	}
+	return counts
+}
+
+func TestRPCDuration(t *testing.T) {
+	pm := NewPluginManager(time.Millisecond, nil)
+	t.Cleanup(pm.Stop)
+	ctx := context.Background()
+
+	s, err := pm.NewSource(noopPath, nil, prometheus.Labels{"source": "foo"})
+	require.NoError(t, err)
+	require.NoError(t, s.Reset(ctx))
+	c, err := s.Next(ctx)
+	require.NoError(t, err)
+	obj, err := s.Download(ctx, *c)
+	require.NoError(t, err)
+	_, err = io.ReadAll(obj.Reader)
+	require.NoError(t, err)
+
+	d, err := pm.NewDestination(noopPath, nil, prometheus.Labels{"destination": "bar"})
+	require.NoError(t, err)
+	_, err = d.Store(ctx, defaultCodec, ingest.Object{Reader: bytes.NewBufferString(defaultObjContent), Len: int64(len(defaultObjContent))})
+	require.NoError(t, err)
+
+	// Ingest and the plugin both measure every call, including the streams of objects once they ended.
+	assert.Eventually(t, func() bool {
+		counts := rpcCounts(t, s.(prometheus.Gatherer))
+		return counts["ingest"]["Download"] == 1 && counts["plugin"]["Download"] == 1
+	}, 5*time.Second, time.Millisecond)
+	counts := rpcCounts(t, s.(prometheus.Gatherer))
+	for _, side := range []string{"ingest", "plugin"} {
+		assert.Equal(t, uint64(1), counts[side]["Configure"], side)
+		assert.Equal(t, uint64(1), counts[side]["Reset"], side)
+		assert.Equal(t, uint64(1), counts[side]["Next"], side)
+	}
+	assert.Eventually(t, func() bool {
+		counts := rpcCounts(t, d.(prometheus.Gatherer))
+		return counts["ingest"]["Store"] == 1 && counts["plugin"]["Store"] == 1
+	}, 5*time.Second, time.Millisecond)
+
+	// The manager reports the calls with the labels of the sources and destinations.
+	mfs, err := pm.Gather()
+	require.NoError(t, err)
+	var sources, destinations int
+	for _, mf := range mfs {
+		if mf.GetName() != "ingest_plugin_rpc_duration_seconds" {
+			continue
+		}
+		for _, m := range mf.Metric {
+			for _, lp := range m.Label {
+				switch lp.GetName() {
+				case "source":
+					sources++
+				case "destination":
+					destinations++
+				}
+			}
+		}
+	}
+	assert.NotZero(t, sources)
+	assert.NotZero(t, destinations)
+}
@@ -0,0 +1,103 @@
+package plugin
+
+import (
+	"bytes"
+	"io"
+	stdlog "log"
+	"sync"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/hashicorp/go-hclog"
+)
+
+var _ hclog.Logger = &hclogger{}
+
+// hclogger is the logger of go-plugin for the clients of plugins. It logs with a go-kit logger,
+// so that the logs of plugins, which go-plugin parses from their stderr, share the output and the level filter of ingest.
+type hclogger struct {
+	l    log.Logger
+	args []interface{}
+}
+
+func (h *hclogger) Log(lvl hclog.Level, msg string, args ...interface{}) {
+	l := h.l
+	switch lvl {
+	case hclog.Trace, hclog.Debug:
+		// go-kit has no trace level.
+		l = level.Debug(l)
+	case hclog.Warn:
+		l = level.Warn(l)
+	case hclog.Error:
+		l = level.Error(l)
+	case hclog.Off:
+		return
+	default:
+		l = level.Info(l)
+	}
+	l.Log(append([]interface{}{"msg", msg}, args...)...)
+}
+
+func (h *hclogger) Trace(msg string, args ...interface{}) { h.Log(hclog.Trace, msg, args...) }
+func (h *hclogger) Debug(msg string, args ...interface{}) { h.Log(hclog.Debug, msg, args...) }
+func (h *hclogger) Info(msg string, args ...interface{})  { h.Log(hclog.Info, msg, args...) }
+func (h *hclogger) Warn(msg string, args ...interface{})  { h.Log(hclog.Warn, msg, args...) }
+func (h *hclogger) Error(msg string, args ...interface{}) { h.Log(hclog.Error, msg, args...) }
+
+// The go-kit logger filters the levels, so all levels are enabled.
+func (h *hclogger) IsTrace() bool { return true }
+func (h *hclogger) IsDebug() bool { return true }
+func (h *hclogger) IsInfo() bool  { return true }
+func (h *hclogger) IsWarn() bool  { return true }
+func (h *hclogger) IsError() bool { return true }
+
+func (h *hclogger) ImpliedArgs() []interface{} { return h.args }
+
+func (h *hclogger) With(args ...interface{}) hclog.Logger {
+	return &hclogger{
+		l:    log.With(h.l, args...),
+		args: append(append([]interface{}{}, h.args...), args...),
+	}
+}
+
+// The go-kit logger already carries the name of the plugin, so the names of loggers are dropped.
+func (h *hclogger) Name() string                   { return "" }
+func (h *hclogger) Named(string) hclog.Logger      { return h }
+func (h *hclogger) ResetNamed(string) hclog.Logger { return h }
+func (h *hclogger) SetLevel(hclog.Level)           {}
+
+func (h *hclogger) StandardWriter(*hclog.StandardLoggerOptions) io.Writer {
+	return newLineWriter(level.Info(h.l))
+}
+
+func (h *hclogger) StandardLogger(opts *hclog.StandardLoggerOptions) *stdlog.Logger {
+	return stdlog.New(h.StandardWriter(opts), "", 0)
+}
+
+// lineWriter logs every line that is written to it as a message.
+type lineWriter struct {
+	mu  sync.Mutex
+	l   log.Logger
+	buf []byte
+}
+
+func newLineWriter(l log.Logger) *lineWriter {
+	return &lineWriter{l: l}
+}
+
+// Write logs the complete lines of p and keeps an incomplete last line until it is completed.
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		if line := bytes.TrimRight(w.buf[:i], "\r"); len(line) > 0 {
+			w.l.Log("msg", string(line))
+		}
+		w.buf = w.buf[i+1:]
+	}
+}
@@ -0,0 +1,71 @@
+package plugin
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// syncBuffer is a buffer that can be written and read concurrently.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestHCLogger(t *testing.T) {
+	var b bytes.Buffer
+	h := &hclogger{l: level.NewFilter(log.NewLogfmtLogger(&b), level.AllowInfo())}
+	h.Trace("trace")
+	h.Debug("debug")
+	h.With("component", "source").Info("info", "id", "foo")
+	h.Log(hclog.Warn, "warn")
+	h.Named("noop").Error("error")
+	assert.Equal(t, "level=info component=source msg=info id=foo\nlevel=warn msg=warn\nlevel=error msg=error\n", b.String())
+	assert.Equal(t, []interface{}{"component", "source"}, h.With("component", "source").ImpliedArgs())
+
+	b.Reset()
+	w := newLineWriter(log.NewLogfmtLogger(&b))
+	_, err := w.Write([]byte("foo\nb"))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("ar\r\n\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "msg=foo\nmsg=bar\n", b.String())
+}
+
+func TestPluginManagerLogs(t *testing.T) {
+	var b syncBuffer
+	pm := NewPluginManager(0, log.NewLogfmtLogger(&b))
+	t.Cleanup(pm.Stop)
+	_, err := pm.NewSource(noopPath, nil, nil)
+	require.NoError(t, err)
+
+	// The noop plugin logs when it is configured.
+	assert.Eventually(t, func() bool {
+		for _, l := range strings.Split(b.String(), "\n") {
+			if strings.Contains(l, `msg="configuring plugin"`) && strings.Contains(l, "level=debug") && strings.Contains(l, "plugin=noop") {
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 10*time.Millisecond, b.String())
+}
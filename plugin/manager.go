@@ -2,22 +2,25 @@ package plugin
 
 import (
 	"context"
-	"errors"
 	"fmt"
-	"os"
-	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
-	hclog "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/go-multierror"
 	hplugin "github.com/hashicorp/go-plugin"
 	"github.com/prometheus/client_golang/prometheus"
 	dto "github.com/prometheus/client_model/go"
 )
 
+// resolveTimeout is the maximum duration for resolving the secrets of a plugin.
+const resolveTimeout = time.Minute
+
 func NewPluginManager(i time.Duration, l log.Logger) *PluginManager {
 	if l == nil {
 		l = log.NewNopLogger()
@@ -29,155 +32,506 @@ func NewPluginManager(i time.Duration, l log.Logger) *PluginManager {
 	}
 }
 
+// SecretResolver replaces references to secrets in the configuration of a plugin with the values of the secrets.
+type SecretResolver interface {
+	Resolve(context.Context, map[string]any) (map[string]any, error)
+}
+
 // PluginManager can start new plugins watch and kill all plugins.
 type PluginManager struct {
 	Interval time.Duration
+	// Secrets resolves the references to secrets in the configuration of plugins
+	// right before they are configured, so that the secrets are never stored in the configuration.
+	Secrets SecretResolver
+	// Verifier verifies plugin files before they are started.
+	// Built-in plugins are not verified and plugin files are not verified if it is nil.
+	// Once plugins are watched, it must only be replaced with SetVerification.
+	Verifier Verifier
+	// Restart restarts plugins that stop responding.
+	// If it is nil, then Watch returns an error as soon as a plugin stops responding.
+	Restart *RestartPolicy
+	// Limits are the resource limits of plugin files by their names, i.e. the types of sources and destinations.
+	// Built-in plugins run in the process of the manager and are not limited.
+	// Once plugins are watched, they must only be replaced with SetVerification.
+	Limits map[string]Limits
+	// Cgroup is a cgroup v2 directory, in which the plugins with limits get their own cgroups on Linux.
+	// If it is empty, then only the memory of plugins is limited with an rlimit and CPU limits are refused.
+	Cgroup string
+	// HotSwap makes Watch swap the plugins whose files were replaced, e.g. by an upgrade,
+	// for new plugins of the same configuration. It must be set before plugins are started.
+	HotSwap bool
 
 	sources      []withClient[Source]
 	destinations []withClient[Destination]
 	l            log.Logger
 	m            sync.Mutex
+	// draining are the processes of swapped plugins that still serve calls.
+	draining []*process
 }
 
 func ptr[T any](t T) *T {
 	return &t
 }
 
+// Gather implements the prometheus.Gatherer interface.
+// It collects the metrics of all managed plugins and adds the labels
+// that were given when the plugin was created to every metric.
+// If a plugin metric already carries one of these labels, then the
+// plugin's label is renamed to "exported_<label>", so that labels never collide.
+// The manager adds the resident memory of the process of every plugin file that it measures
+// and the health status of every source and destination.
+// Metric families of the same name are merged across plugins; metrics of
+// a family whose type does not match the first occurrence are dropped.
 func (pm *PluginManager) Gather() ([]*dto.MetricFamily, error) {
+	return pm.gather(func(any) bool { return true }), nil
+}
+
+// gather collects the metrics of the managed plugins for which match returns true like Gather.
+func (pm *PluginManager) gather(match func(any) bool) []*dto.MetricFamily {
 	g := multierror.Group{}
 	pm.m.Lock()
 	defer pm.m.Unlock()
 
+	gather := func(t any, c *process, path, mode string, labels prometheus.Labels) []*dto.MetricFamily {
+		mfs := []*dto.MetricFamily{healthFamily(healthOf(context.Background(), t), labels)}
+		if c != nil {
+			if mf := residentMemoryFamily(c, labels); mf != nil {
+				mfs = append(mfs, mf)
+			}
+		}
+		g, ok := t.(prometheus.Gatherer)
+		if !ok {
+			level.Warn(pm.l).Log("msg", "plugin does not implement the prometheus.Gatherer interface", "path", path, "mode", mode)
+			return mfs
+		}
+		pmfs, err := g.Gather()
+		if err != nil {
+			level.Error(pm.l).Log("msg", "failed to gather metrics for plugin", "err", err.Error(), "path", path, "mode", mode)
+			return mfs
+		}
+		for _, mf := range pmfs {
+			for _, m := range mf.Metric {
+				m.Label = relabel(m.Label, labels)
+			}
+		}
+		return append(mfs, pmfs...)
+	}
+
 	all := make([][]*dto.MetricFamily, len(pm.sources)+len(pm.destinations))
 	for i := range pm.sources {
 		i := i
+		if !match(pm.sources[i].t) {
+			continue
+		}
 		g.Go(func() error {
-			g, ok := pm.sources[i].t.(prometheus.Gatherer)
-			if !ok {
-				return errors.New("failed to cast")
-			}
-			mfs, err := g.Gather()
-			if err != nil {
-				level.Error(pm.l).Log("msg", "failed to gather metrics for plugin", "err", err.Error(), "path", pm.sources[i].path, "mode", "source")
-				return nil
-			}
-			for _, mf := range mfs {
-				for _, m := range mf.Metric {
-					for k, v := range pm.sources[i].labels {
-						m.Label = append(m.Label, &dto.LabelPair{Name: ptr(k), Value: ptr(v)})
-					}
-				}
-			}
-			all[i] = mfs
+			all[i] = gather(pm.sources[i].t, pm.sources[i].c, pm.sources[i].path, "source", pm.sources[i].labels)
 			return nil
 		})
 	}
 	for i := range pm.destinations {
 		i := i
+		if !match(pm.destinations[i].t) {
+			continue
+		}
 		g.Go(func() error {
-			g, ok := pm.destinations[i].t.(prometheus.Gatherer)
+			all[i+len(pm.sources)] = gather(pm.destinations[i].t, pm.destinations[i].c, pm.destinations[i].path, "destination", pm.destinations[i].labels)
+			return nil
+		})
+	}
+	// None of the go routines in the group return errors.
+	g.Wait() //nolint:errcheck
+
+	merged := make([]*dto.MetricFamily, 0)
+	byName := make(map[string]*dto.MetricFamily)
+	for _, mfs := range all {
+		for _, mf := range mfs {
+			existing, ok := byName[mf.GetName()]
 			if !ok {
-				return errors.New("failed to cast")
+				byName[mf.GetName()] = mf
+				merged = append(merged, mf)
+				continue
 			}
+			if existing.GetType() != mf.GetType() {
+				level.Warn(pm.l).Log("msg", "dropping plugin metrics with conflicting type", "metric", mf.GetName(), "type", mf.GetType().String(), "expected", existing.GetType().String())
+				continue
+			}
+			existing.Metric = append(existing.Metric, mf.Metric...)
+		}
+	}
+	return merged
+}
 
-			mfs, err := g.Gather()
-			if err != nil {
-				level.Error(pm.l).Log("msg", "failed to gather metrics for plugin", "err", err.Error(), "path", pm.destinations[i].path, "mode", "destination")
-				return nil
+// Collector returns a collector of the metrics that Gather collects for the given sources and destinations,
+// which were returned by the manager, including all instances of pools. The collector can be registered
+// with a registerer that adds labels, e.g. the workflow that uses the plugins, with prometheus.WrapRegistererWith.
+func (pm *PluginManager) Collector(plugins ...any) prometheus.Collector {
+	return &pluginCollector{pm: pm, plugins: plugins}
+}
 
+type pluginCollector struct {
+	pm      *PluginManager
+	plugins []any
+}
+
+// Describe sends no descriptions, so that the collector is unchecked,
+// since the metrics of plugins are not known before they are gathered.
+func (c *pluginCollector) Describe(chan<- *prometheus.Desc) {}
+
+// Collect implements the prometheus.Collector interface.
+func (c *pluginCollector) Collect(ch chan<- prometheus.Metric) {
+	plugins := make(map[any]bool)
+	var add func(p any)
+	add = func(p any) {
+		if pl, ok := p.(pool); ok {
+			for _, m := range pl.members() {
+				add(m)
 			}
-			for _, mf := range mfs {
-				for _, m := range mf.Metric {
-					for k, v := range pm.destinations[i].labels {
-						m.Label = append(m.Label, &dto.LabelPair{Name: ptr(k), Value: ptr(v)})
-					}
-				}
-			}
-			all[i+len(pm.sources)] = mfs
-			return nil
-		})
+			return
+		}
+		plugins[p] = true
 	}
-
-	if err := g.Wait().ErrorOrNil(); err != nil {
-		return nil, err
+	for _, p := range c.plugins {
+		add(p)
 	}
+	for _, mf := range c.pm.gather(func(t any) bool { return plugins[t] }) {
+		desc := prometheus.NewDesc(mf.GetName(), mf.GetHelp(), nil, nil)
+		for _, m := range mf.Metric {
+			ch <- gatheredMetric{desc: desc, m: m}
+		}
+	}
+}
 
-	merged := make([]*dto.MetricFamily, 0)
-	for _, m := range all {
-		merged = append(merged, m...)
+// gatheredMetric is a metric that was gathered from a plugin.
+type gatheredMetric struct {
+	desc *prometheus.Desc
+	m    *dto.Metric
+}
+
+func (g gatheredMetric) Desc() *prometheus.Desc {
+	return g.desc
+}
+
+func (g gatheredMetric) Write(out *dto.Metric) error {
+	out.Label = append([]*dto.LabelPair(nil), g.m.Label...)
+	out.Counter = g.m.Counter
+	out.Gauge = g.m.Gauge
+	out.Summary = g.m.Summary
+	out.Untyped = g.m.Untyped
+	out.Histogram = g.m.Histogram
+	out.TimestampMs = g.m.TimestampMs
+	return nil
+}
+
+// relabel adds the given labels to the label pairs.
+// Existing labels with the same name are renamed to "exported_<name>".
+func relabel(lps []*dto.LabelPair, labels prometheus.Labels) []*dto.LabelPair {
+	for _, lp := range lps {
+		if _, ok := labels[lp.GetName()]; ok {
+			lp.Name = ptr("exported_" + lp.GetName())
+		}
+	}
+	for k, v := range labels {
+		lps = append(lps, &dto.LabelPair{Name: ptr(k), Value: ptr(v)})
 	}
-	return merged, g.Wait().ErrorOrNil()
+	sort.Slice(lps, func(i, j int) bool {
+		return lps[i].GetName() < lps[j].GetName()
+	})
+	return lps
 }
 
-// NewDestination returns a new Destination interface from a plugin path and configuration.
+// NewDestination returns a new Destination interface from a plugin path and configuration
+// whose calls are limited by the default timeouts.
 func (pm *PluginManager) NewDestination(path string, config map[string]any, labels prometheus.Labels) (Destination, error) {
+	return pm.NewDestinationWithOptions(path, config, labels, Options{})
+}
+
+// NewDestinationWithOptions returns a new Destination interface like NewDestination with the given options.
+func (pm *PluginManager) NewDestinationWithOptions(path string, config map[string]any, labels prometheus.Labels, o Options) (Destination, error) {
+	if _, ok := builtin(path); !ok && o.Instances > 1 {
+		return pm.newDestinationPool(path, config, labels, o)
+	}
+	return pm.newDestination(path, config, labels, o.Timeouts)
+}
+
+// newDestination returns a new Destination with a single instance of its plugin.
+func (pm *PluginManager) newDestination(path string, config map[string]any, labels prometheus.Labels, t Timeouts) (Destination, error) {
+	t = t.withDefaults()
+	resolved, err := pm.resolve(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if b, ok := builtin(path); ok {
+		return pm.newBuiltinDestination(b, path, resolved, config, labels, t)
+	}
+
+	// The lock of the manager is not held while the plugin starts, so that many plugins can start at the same time.
+	c, d, err := pm.startDestination(pm.verifier(), pm.limits(path), path, resolved, t.Configure)
+	if err != nil {
+		return nil, err
+	}
+	r := newTimeoutDestination(newRestartableDestination(d), t)
 	pm.m.Lock()
 	defer pm.m.Unlock()
+	pm.destinations = append(pm.destinations, withClient[Destination]{t: r, c: c, path: path, config: config, labels: labels})
+	return r, nil
+}
+
+// startDestination starts the plugin of a destination and configures it within the timeout.
+func (pm *PluginManager) startDestination(v Verifier, l Limits, path string, resolved map[string]any, timeout time.Duration) (*process, Destination, error) {
+	if v != nil {
+		if err := v.Verify(path); err != nil {
+			return nil, nil, err
+		}
+	}
 
-	c := client(path)
+	c, err := pm.client(path, l)
+	if err != nil {
+		return nil, nil, err
+	}
 	cp, err := c.Client()
 	if err != nil {
 		c.Kill()
-		return nil, fmt.Errorf("failed to create rpc client interface: %w", err)
+		return nil, nil, fmt.Errorf("failed to create plugin client: %w", err)
+	}
+	pm.logProtocolVersion(c, path, "destination")
+	caps, err := capabilities(cp)
+	if err != nil {
+		c.Kill()
+		return nil, nil, fmt.Errorf("failed to get plugin capabilities: %w", err)
+	}
+	if !caps.Destination {
+		c.Kill()
+		return nil, nil, fmt.Errorf("plugin %q does not implement a destination: %w", filepath.Base(path), ErrNotImplemented)
 	}
 	d, err := newDestination(cp)
 	if err != nil {
 		c.Kill()
-		return nil, err
+		return nil, nil, err
 	}
-
-	if err := d.Configure(config); err != nil {
+	if err := validate(d, resolved); err != nil {
 		c.Kill()
-		return nil, fmt.Errorf("failed to configure destination: %w", err)
+		return nil, nil, err
 	}
+	if err := configure(d, resolved, timeout); err != nil {
+		c.Kill()
+		return nil, nil, fmt.Errorf("failed to configure destination: %w", err)
+	}
+	return c, d, nil
+}
 
-	pm.destinations = append(pm.destinations, withClient[Destination]{t: d, c: c, path: path, config: config, labels: labels})
+// validate validates the configuration of a plugin that implements Schemer against its schema.
+func validate(p any, config map[string]any) error {
+	schema, err := schemaOf(p)
+	if err != nil {
+		return fmt.Errorf("failed to get configuration schema: %w", err)
+	}
+	return validateConfig(schema, config)
+}
 
-	return d, nil
+// resolve resolves the references to secrets in the configuration of a plugin.
+func (pm *PluginManager) resolve(config map[string]any) (map[string]any, error) {
+	if pm.Secrets == nil {
+		return config, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+	resolved, err := pm.Secrets.Resolve(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve secrets: %w", err)
+	}
+	return resolved, nil
 }
 
-// NewSource returns a new Source interface from a plugin path and configuration.
+// NewSource returns a new Source interface from a plugin path and configuration
+// whose calls are limited by the default timeouts.
 func (pm *PluginManager) NewSource(path string, config map[string]any, labels prometheus.Labels) (Source, error) {
+	return pm.NewSourceWithOptions(path, config, labels, Options{})
+}
+
+// NewSourceWithOptions returns a new Source interface like NewSource with the given options.
+func (pm *PluginManager) NewSourceWithOptions(path string, config map[string]any, labels prometheus.Labels, o Options) (Source, error) {
+	if _, ok := builtin(path); !ok && o.Instances > 1 {
+		return pm.newSourcePool(path, config, labels, o)
+	}
+	return pm.newSource(path, config, labels, o.Timeouts)
+}
+
+// newSource returns a new Source with a single instance of its plugin.
+func (pm *PluginManager) newSource(path string, config map[string]any, labels prometheus.Labels, t Timeouts) (Source, error) {
+	t = t.withDefaults()
+	resolved, err := pm.resolve(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if b, ok := builtin(path); ok {
+		return pm.newBuiltinSource(b, path, resolved, config, labels, t)
+	}
+
+	// The lock of the manager is not held while the plugin starts, so that many plugins can start at the same time.
+	c, s, err := pm.startSource(pm.verifier(), pm.limits(path), path, resolved, t.Configure)
+	if err != nil {
+		return nil, err
+	}
+	r := newTimeoutSource(newRestartableSource(s), t)
 	pm.m.Lock()
 	defer pm.m.Unlock()
+	pm.sources = append(pm.sources, withClient[Source]{t: r, c: c, path: path, config: config, labels: labels})
+	return r, nil
+}
+
+// startSource starts the plugin of a source and configures it within the timeout.
+func (pm *PluginManager) startSource(v Verifier, l Limits, path string, resolved map[string]any, timeout time.Duration) (*process, Source, error) {
+	if v != nil {
+		if err := v.Verify(path); err != nil {
+			return nil, nil, err
+		}
+	}
 
-	c := client(path)
+	c, err := pm.client(path, l)
+	if err != nil {
+		return nil, nil, err
+	}
 	cp, err := c.Client()
 	if err != nil {
 		c.Kill()
-		return nil, fmt.Errorf("failed to create rpc client interface: %w", err)
+		return nil, nil, fmt.Errorf("failed to create plugin client: %w", err)
+	}
+	pm.logProtocolVersion(c, path, "source")
+	caps, err := capabilities(cp)
+	if err != nil {
+		c.Kill()
+		return nil, nil, fmt.Errorf("failed to get plugin capabilities: %w", err)
+	}
+	if !caps.Source {
+		c.Kill()
+		return nil, nil, fmt.Errorf("plugin %q does not implement a source: %w", filepath.Base(path), ErrNotImplemented)
 	}
 	s, err := newSource(cp)
 	if err != nil {
 		c.Kill()
-		return nil, err
+		return nil, nil, err
+	}
+	if err := validate(s, resolved); err != nil {
+		c.Kill()
+		return nil, nil, err
 	}
-	if err := s.Configure(config); err != nil {
+	if err := configure(s, resolved, timeout); err != nil {
 		c.Kill()
+		return nil, nil, fmt.Errorf("failed to configure source: %w", err)
+	}
+	return c, s, nil
+}
+
+// builtinLogger returns the logger of a built-in plugin, which logs with the logger of the manager,
+// so that the logs of built-in plugins share the output and the level filter of ingest.
+func (pm *PluginManager) builtinLogger(path string) hclog.Logger {
+	return &hclogger{l: log.With(pm.l, "plugin", strings.TrimPrefix(path, builtinPrefix))}
+}
+
+// newBuiltinSource creates the source of a built-in plugin in the process of the manager.
+func (pm *PluginManager) newBuiltinSource(b Builtin, path string, resolved, config map[string]any, labels prometheus.Labels, t Timeouts) (Source, error) {
+	if b.NewSource == nil {
+		return nil, fmt.Errorf("plugin %q does not implement a source: %w", strings.TrimPrefix(path, builtinPrefix), ErrNotImplemented)
+	}
+	reg := prometheus.NewRegistry()
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &builtinSource{Source: b.NewSource(pm.builtinLogger(path), reg), g: reg, ctx: ctx}
+	if err := validate(s, resolved); err != nil {
+		cancel()
+		return nil, err
+	}
+	if err := configure(s, resolved, t.Configure); err != nil {
+		cancel()
 		return nil, fmt.Errorf("failed to configure source: %w", err)
 	}
-	pm.sources = append(pm.sources, withClient[Source]{t: s, c: c, path: path, config: config, labels: labels})
-	return s, nil
+	level.Debug(pm.l).Log("msg", "started built-in plugin", "path", path, "mode", "source")
+	r := newTimeoutSource(s, t)
+	pm.m.Lock()
+	defer pm.m.Unlock()
+	pm.sources = append(pm.sources, withClient[Source]{t: r, cancel: cancel, path: path, config: config, labels: labels})
+	return r, nil
 }
 
-// Stop will block until all rpc clients are closed.
+// newBuiltinDestination creates the destination of a built-in plugin in the process of the manager.
+func (pm *PluginManager) newBuiltinDestination(b Builtin, path string, resolved, config map[string]any, labels prometheus.Labels, t Timeouts) (Destination, error) {
+	if b.NewDestination == nil {
+		return nil, fmt.Errorf("plugin %q does not implement a destination: %w", strings.TrimPrefix(path, builtinPrefix), ErrNotImplemented)
+	}
+	reg := prometheus.NewRegistry()
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &builtinDestination{Destination: b.NewDestination(pm.builtinLogger(path), reg), g: reg, ctx: ctx}
+	if err := validate(d, resolved); err != nil {
+		cancel()
+		return nil, err
+	}
+	if err := configure(d, resolved, t.Configure); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to configure destination: %w", err)
+	}
+	level.Debug(pm.l).Log("msg", "started built-in plugin", "path", path, "mode", "destination")
+	r := newTimeoutDestination(d, t)
+	pm.m.Lock()
+	defer pm.m.Unlock()
+	pm.destinations = append(pm.destinations, withClient[Destination]{t: r, cancel: cancel, path: path, config: config, labels: labels})
+	return r, nil
+}
+
+// logProtocolVersion logs the version of the plugin protocol that a plugin uses
+// and warns about plugins that use a deprecated version.
+func (pm *PluginManager) logProtocolVersion(c *process, path, mode string) {
+	v := c.NegotiatedVersion()
+	if v < PluginMagicProtocalVersion {
+		level.Warn(pm.l).Log("msg", "plugin uses a deprecated protocol version; rebuild the plugin with the current version of ingest", "path", path, "mode", mode, "protocol", v, "current", PluginMagicProtocalVersion)
+		return
+	}
+	level.Debug(pm.l).Log("msg", "started plugin", "path", path, "mode", mode, "protocol", v)
+}
+
+// ProtocolVersion returns the version of the plugin protocol that the plugin of a source or destination
+// that was returned by NewSource or NewDestination uses or 0 if the plugin is built in or not managed.
+func (pm *PluginManager) ProtocolVersion(p any) int {
+	if pl, ok := p.(pool); ok {
+		return pm.ProtocolVersion(pl.members()[0])
+	}
+	pm.m.Lock()
+	defer pm.m.Unlock()
+
+	for i := range pm.sources {
+		if any(pm.sources[i].t) == p && pm.sources[i].c != nil {
+			return pm.sources[i].c.NegotiatedVersion()
+		}
+	}
+	for i := range pm.destinations {
+		if any(pm.destinations[i].t) == p && pm.destinations[i].c != nil {
+			return pm.destinations[i].c.NegotiatedVersion()
+		}
+	}
+	return 0
+}
+
+// Stop will block until all plugin clients are closed.
 // After Stop was called all currently managed plugins cannot be used anymore.
 func (pm *PluginManager) Stop() {
 	pm.m.Lock()
 	defer pm.m.Unlock()
 
 	g := &multierror.Group{}
-	f := func(c *hplugin.Client) func() error {
+	f := func(kill func()) func() error {
 		return func() error {
-			c.Kill()
+			kill()
 			return nil
 		}
 	}
 	for _, c := range pm.sources {
-		g.Go(f(c.c))
+		g.Go(f(c.kill))
 	}
 	for _, c := range pm.destinations {
-		g.Go(f(c.c))
+		g.Go(f(c.kill))
+	}
+	for _, c := range pm.draining {
+		g.Go(f(c.Kill))
 	}
 	if err := g.Wait().ErrorOrNil(); err != nil {
 		// We can panic here because none of the go routines in the group return errors.
@@ -185,9 +539,60 @@ func (pm *PluginManager) Stop() {
 	}
 	pm.destinations = nil
 	pm.sources = nil
+	pm.draining = nil
 }
 
-// Watch will return an error when a plugin can not be pinged anymore or return when ctx is done.
+// Kill stops the plugin of a source or destination that was returned by NewSource or NewDestination,
+// e.g. because its configuration changed. The plugins of all instances of a pool are stopped.
+// Plugins that are not managed are ignored.
+func (pm *PluginManager) Kill(p any) {
+	if pl, ok := p.(pool); ok {
+		for _, m := range pl.members() {
+			pm.Kill(m)
+		}
+		return
+	}
+	pm.m.Lock()
+	defer pm.m.Unlock()
+
+	for i := range pm.sources {
+		if any(pm.sources[i].t) == p {
+			pm.sources[i].kill()
+			pm.sources = append(pm.sources[:i], pm.sources[i+1:]...)
+			return
+		}
+	}
+	for i := range pm.destinations {
+		if any(pm.destinations[i].t) == p {
+			pm.destinations[i].kill()
+			pm.destinations = append(pm.destinations[:i], pm.destinations[i+1:]...)
+			return
+		}
+	}
+}
+
+// managed returns true if the client of a plugin was not killed.
+func (pm *PluginManager) managed(c *process) bool {
+	pm.m.Lock()
+	defer pm.m.Unlock()
+
+	for i := range pm.sources {
+		if pm.sources[i].c == c {
+			return true
+		}
+	}
+	for i := range pm.destinations {
+		if pm.destinations[i].c == c {
+			return true
+		}
+	}
+	return false
+}
+
+// Watch pings all plugins at the interval of the manager and returns when ctx is done.
+// Plugins that can not be pinged anymore are restarted according to the restart policy of the manager.
+// Watch returns an error if such a plugin is crash-looping or if the manager has no restart policy.
+// If HotSwap is set, then plugins whose files were replaced are swapped.
 func (pm *PluginManager) Watch(ctx context.Context) error {
 	t := time.NewTicker(pm.Interval)
 	for {
@@ -195,35 +600,52 @@ func (pm *PluginManager) Watch(ctx context.Context) error {
 		case <-ctx.Done():
 			return nil
 		case start := <-t.C:
+			// Plugins can be killed while they are pinged, so ping a snapshot of the plugins
+			// and ignore the errors of plugins that were killed in the meantime.
+			pm.m.Lock()
+			sources := append([]withClient[Source](nil), pm.sources...)
+			destinations := append([]withClient[Destination](nil), pm.destinations...)
+			pm.m.Unlock()
 			g := multierror.Group{}
-			for i := range pm.sources {
+			for i := range sources {
 				i := i
+				if sources[i].c == nil {
+					// Built-in plugins run in this process.
+					continue
+				}
 				g.Go(func() error {
-					cp, err := pm.sources[i].c.Client()
-					if err != nil {
-						return fmt.Errorf("source client not initialized: %w", err)
+					if err := ping(sources[i].c); err != nil && pm.managed(sources[i].c) {
+						if pm.Restart == nil {
+							return fmt.Errorf("failed to ping source: %w", err)
+						}
+						return pm.restartSource(ctx, sources[i])
 					}
-					if err := cp.Ping(); err != nil {
-						return fmt.Errorf("failed to ping source: %w", err)
+					if sum, ok := fileReplaced(sources[i].c); ok {
+						pm.swapSource(ctx, sources[i], sum)
 					}
 					return nil
 				})
 			}
-			for i := range pm.destinations {
+			for i := range destinations {
 				i := i
+				if destinations[i].c == nil {
+					continue
+				}
 				g.Go(func() error {
-					cp, err := pm.destinations[i].c.Client()
-					if err != nil {
-						return fmt.Errorf("destination client not initialized: %w", err)
+					if err := ping(destinations[i].c); err != nil && pm.managed(destinations[i].c) {
+						if pm.Restart == nil {
+							return fmt.Errorf("failed to ping destination: %w", err)
+						}
+						return pm.restartDestination(ctx, destinations[i])
 					}
-					if err := cp.Ping(); err != nil {
-						return fmt.Errorf("failed to ping destination: %w", err)
+					if sum, ok := fileReplaced(destinations[i].c); ok {
+						pm.swapDestination(destinations[i], sum)
 					}
 					return nil
 				})
 			}
 
-			level.Debug(pm.l).Log("msg", "successfully pinged all plugins", "duration", time.Since(start), "source plugins", len(pm.sources), "destination plugins", len(pm.destinations))
+			level.Debug(pm.l).Log("msg", "successfully pinged all plugins", "duration", time.Since(start), "source plugins", len(sources), "destination plugins", len(destinations))
 
 			err := g.Wait().ErrorOrNil()
 			if err != nil {
@@ -234,43 +656,72 @@ func (pm *PluginManager) Watch(ctx context.Context) error {
 	}
 }
 
-func client(path string) *hplugin.Client {
+func ping(c *process) error {
+	cp, err := c.Client()
+	if err != nil {
+		return fmt.Errorf("client not initialized: %w", err)
+	}
+	return cp.Ping()
+}
+
+// client returns the client of the plugin file at path, which is started within the limits.
+func (pm *PluginManager) client(path string, l Limits) (*process, error) {
+	cmd, cgroup, err := command(path, l, pm.Cgroup)
+	if err != nil {
+		return nil, err
+	}
+
 	handshakeConfig := hplugin.HandshakeConfig{
 		ProtocolVersion:  PluginMagicProtocalVersion,
 		MagicCookieKey:   PluginMagicCookieKey,
 		MagicCookieValue: PluginCookieValue,
 	}
 
-	logger := hclog.New(&hclog.LoggerOptions{
-		Name:       "plugin",
-		JSONFormat: true,
-		Output:     os.Stdout,
-		Level:      hclog.Debug,
-	})
+	// The logs that plugins write to stderr and the output of plugins are logged with the logger of the manager.
+	logger := log.With(pm.l, "plugin", filepath.Base(path))
 
-	pluginMap := map[string]hplugin.Plugin{
-		"destination": &pluginDestination{},
-		"source":      &pluginSource{},
+	var file *pluginFile
+	if pm.HotSwap {
+		// The file is hashed before it is started, so that a file that is replaced in the meantime is swapped later.
+		if file, err = newPluginFile(path); err != nil {
+			level.Warn(logger).Log("msg", "failed to hash plugin file; it is not swapped when it is replaced", "path", path, "err", err.Error())
+		}
 	}
 
-	return hplugin.NewClient(&hplugin.ClientConfig{
-		HandshakeConfig: handshakeConfig,
-		Plugins:         pluginMap,
-		Cmd:             exec.Command(path),
-		Logger:          logger.With("path", path),
-		AutoMTLS:        true,
-		Managed:         true,
-	})
+	return &process{client: hplugin.NewClient(&hplugin.ClientConfig{
+		HandshakeConfig:  handshakeConfig,
+		VersionedPlugins: versionedPlugins(context.Background(), nil, nil, nil, nil),
+		Cmd:              cmd,
+		Logger:           &hclogger{l: log.With(logger, "path", path)},
+		SyncStdout:       newLineWriter(level.Info(log.With(logger, "stream", "stdout"))),
+		SyncStderr:       newLineWriter(level.Info(log.With(logger, "stream", "stderr"))),
+		AllowedProtocols: []hplugin.Protocol{hplugin.ProtocolGRPC, hplugin.ProtocolNetRPC},
+		AutoMTLS:         true,
+		Managed:          true,
+		GRPCDialOptions:  grpcDialOptions,
+	}), cgroup: cgroup, file: file}, nil
 }
 
 type withClient[T any] struct {
-	t      T
-	path   string
-	c      *hplugin.Client
+	t    T
+	path string
+	c    *process
+	// cancel cancels the context of a built-in plugin, which has no client.
+	cancel context.CancelFunc
 	config map[string]any
 	labels prometheus.Labels
 }
 
+// kill stops the plugin.
+func (w withClient[T]) kill() {
+	if w.c != nil {
+		w.c.Kill()
+	}
+	if w.cancel != nil {
+		w.cancel()
+	}
+}
+
 func newDestination(cp hplugin.ClientProtocol) (Destination, error) {
 	raw, err := cp.Dispense("destination")
 	if err != nil {
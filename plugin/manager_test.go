@@ -2,6 +2,8 @@ package plugin
 
 import (
 	"context"
+	"errors"
+	"strings"
 	"testing"
 	"time"
 
@@ -30,7 +32,8 @@ func TestPluginManagerWatch(t *testing.T) {
 		}()
 
 		assert.NoError(t, pm.Watch(ctx))
-		assert.NoError(t, p.Reset(ctx))
+		// Calls are canceled with their context, so use a new one.
+		assert.NoError(t, p.Reset(context.Background()))
 	})
 	t.Run("killed plugin", func(t *testing.T) {
 		pm := NewPluginManager(time.Millisecond, nil)
@@ -67,4 +70,108 @@ func TestPluginManagerWatch(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Empty(t, p)
 	})
+	t.Run("colliding labels", func(t *testing.T) {
+		pm := NewPluginManager(time.Millisecond, nil)
+		t.Cleanup(pm.Stop)
+
+		_, err := pm.NewSource(noopPath, nil, prometheus.Labels{"noop": "source"})
+		require.NoError(t, err)
+		_, err = pm.NewDestination(noopPath, nil, prometheus.Labels{"noop": "destination"})
+		require.NoError(t, err)
+
+		expected := `
+# HELP noop show that the noop plugin can add its own collectors
+# TYPE noop gauge
+noop{exported_noop="noop",noop="destination"} 1
+noop{exported_noop="noop",noop="source"} 1
+`
+		assert.NoError(t, testutil.GatherAndCompare(prometheus.Gatherers{pm}, strings.NewReader(expected), "noop"))
+	})
+	t.Run("workflow labels", func(t *testing.T) {
+		pm := NewPluginManager(time.Millisecond, nil)
+		t.Cleanup(pm.Stop)
+
+		s, err := pm.NewSource(noopPath, nil, prometheus.Labels{"component": "source", "plugin": "noop", "name": "foo"})
+		require.NoError(t, err)
+		d, err := pm.NewDestinationWithOptions(noopPath, nil, prometheus.Labels{"component": "destination", "plugin": "noop", "name": "bar"}, Options{Instances: 2})
+		require.NoError(t, err)
+		// The plugins of other workflows are not collected.
+		_, err = pm.NewSource(noopPath, nil, prometheus.Labels{"component": "source", "plugin": "noop", "name": "baz"})
+		require.NoError(t, err)
+
+		reg := prometheus.NewRegistry()
+		require.NoError(t, prometheus.WrapRegistererWith(prometheus.Labels{"workflow": "foo-bar"}, reg).Register(pm.Collector(s, d)))
+		expected := `
+# HELP noop show that the noop plugin can add its own collectors
+# TYPE noop gauge
+noop{component="destination",instance="0",name="bar",noop="noop",plugin="noop",workflow="foo-bar"} 1
+noop{component="destination",instance="1",name="bar",noop="noop",plugin="noop",workflow="foo-bar"} 1
+noop{component="source",name="foo",noop="noop",plugin="noop",workflow="foo-bar"} 1
+`
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expected), "noop"))
+	})
+}
+
+func TestPluginManagerKill(t *testing.T) {
+	pm := NewPluginManager(time.Millisecond, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		pm.Stop()
+	})
+
+	s, err := pm.NewSource(noopPath, nil, nil)
+	require.NoError(t, err)
+	d, err := pm.NewDestination(noopPath, nil, nil)
+	require.NoError(t, err)
+
+	pm.Kill(s)
+	pm.Kill(d)
+	pm.Kill(s)
+	assert.Empty(t, pm.sources)
+	assert.Empty(t, pm.destinations)
+	assert.Error(t, s.Reset(ctx))
+
+	// Killed plugins are no longer watched.
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		cancel()
+	}()
+	assert.NoError(t, pm.Watch(ctx))
+}
+
+type secretResolverFunc func(context.Context, map[string]any) (map[string]any, error)
+
+func (f secretResolverFunc) Resolve(ctx context.Context, config map[string]any) (map[string]any, error) {
+	return f(ctx, config)
+}
+
+func TestPluginManagerSecrets(t *testing.T) {
+	pm := NewPluginManager(0, nil)
+	t.Cleanup(pm.Stop)
+
+	config := map[string]any{"token": "vault:secret#token"}
+	var resolved []map[string]any
+	pm.Secrets = secretResolverFunc(func(_ context.Context, c map[string]any) (map[string]any, error) {
+		resolved = append(resolved, c)
+		return map[string]any{"token": "secret"}, nil
+	})
+	_, err := pm.NewSource(noopPath, config, nil)
+	require.NoError(t, err)
+	_, err = pm.NewDestination(noopPath, config, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]any{config, config}, resolved)
+	// The plugin manager keeps the references instead of the secrets.
+	assert.Equal(t, config, pm.sources[0].config)
+	assert.Equal(t, config, pm.destinations[0].config)
+
+	pm.Secrets = secretResolverFunc(func(context.Context, map[string]any) (map[string]any, error) {
+		return nil, errors.New("forbidden")
+	})
+	_, err = pm.NewSource(noopPath, config, nil)
+	assert.Error(t, err)
+	_, err = pm.NewDestination(noopPath, config, nil)
+	assert.Error(t, err)
+	assert.Len(t, pm.sources, 1)
+	assert.Len(t, pm.destinations, 1)
 }
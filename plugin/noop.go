@@ -11,20 +11,21 @@ import (
 	"sync"
 
 	"github.com/hashicorp/go-hclog"
+	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/connylabs/ingest"
 	"github.com/connylabs/ingest/storage"
 )
 
-var (
-	// defaultCodec can be used for testing against this noop plugin.
-	defaultCodec  = ingest.NewCodec("id", "name", nil)
-	DefaultLogger = hclog.New(&hclog.LoggerOptions{
-		Level:      hclog.Trace,
-		Output:     os.Stderr,
-		JSONFormat: true,
+// defaultCodec can be used for testing against this noop plugin.
+var defaultCodec = ingest.NewCodec("id", "name", nil)
+
+func init() {
+	RegisterBuiltin("noop", Builtin{
+		NewSource:      func(l hclog.Logger, _ prometheus.Registerer) Source { return NewNoopSource(l) },
+		NewDestination: func(l hclog.Logger, _ prometheus.Registerer) Destination { return NewNoopDestination(l) },
 	})
-)
+}
 
 const (
 	defaultObjContent = "content of the default object"
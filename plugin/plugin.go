@@ -8,8 +8,10 @@ import (
 	hclog "github.com/hashicorp/go-hclog"
 	hplugin "github.com/hashicorp/go-plugin"
 	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
 
 	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/plugin/proto"
 	"github.com/connylabs/ingest/storage"
 )
 
@@ -31,31 +33,69 @@ type Destination interface {
 }
 
 type pluginSource struct {
+	hplugin.NetRPCUnsupportedPlugin
 	impl Source
 	g    prometheus.Gatherer
 	l    hclog.Logger
 	ctx  context.Context
 }
 
-func (p *pluginSource) Server(mb *hplugin.MuxBroker) (interface{}, error) {
-	return &pluginSourceRPCServer{Impl: p.impl, mb: mb, l: p.l, ctx: p.ctx, g: p.g}, nil
+func (p *pluginSource) GRPCServer(_ *hplugin.GRPCBroker, s *grpc.Server) error {
+	proto.RegisterSourceServer(s, &sourceGRPCServer{impl: p.impl, l: p.l, g: p.g, ctx: p.ctx})
+	return nil
 }
 
-func (p *pluginSource) Client(mb *hplugin.MuxBroker, c *rpc.Client) (interface{}, error) {
-	return &pluginSourceRPC{client: c, mb: mb}, nil
+func (p *pluginSource) GRPCClient(ctx context.Context, _ *hplugin.GRPCBroker, c *grpc.ClientConn) (interface{}, error) {
+	rpcs := newRPCMetrics("ingest")
+	return &sourceGRPCClient{client: proto.NewSourceClient(rpcs.instrument(c)), ctx: ctx, transfers: newTransferMetrics("download"), rpcs: rpcs}, nil
 }
 
 type pluginDestination struct {
+	hplugin.NetRPCUnsupportedPlugin
 	impl Destination
 	g    prometheus.Gatherer
 	l    hclog.Logger
 	ctx  context.Context
 }
 
-func (p *pluginDestination) Client(mb *hplugin.MuxBroker, c *rpc.Client) (interface{}, error) {
-	return &pluginDestinationRPC{client: c, mb: mb}, nil
+func (p *pluginDestination) GRPCServer(_ *hplugin.GRPCBroker, s *grpc.Server) error {
+	proto.RegisterDestinationServer(s, &destinationGRPCServer{impl: p.impl, l: p.l, g: p.g, ctx: p.ctx})
+	return nil
+}
+
+func (p *pluginDestination) GRPCClient(ctx context.Context, _ *hplugin.GRPCBroker, c *grpc.ClientConn) (interface{}, error) {
+	rpcs := newRPCMetrics("ingest")
+	return &destinationGRPCClient{client: proto.NewDestinationClient(rpcs.instrument(c)), ctx: ctx, transfers: newTransferMetrics("store"), rpcs: rpcs}, nil
+}
+
+// rpcPluginSource serves sources with the net/rpc protocol.
+type rpcPluginSource struct {
+	impl Source
+	g    prometheus.Gatherer
+	l    hclog.Logger
+	ctx  context.Context
+}
+
+func (p *rpcPluginSource) Server(mb *hplugin.MuxBroker) (interface{}, error) {
+	return &pluginSourceRPCServer{Impl: p.impl, mb: mb, l: p.l, ctx: p.ctx, g: p.g}, nil
+}
+
+func (p *rpcPluginSource) Client(mb *hplugin.MuxBroker, c *rpc.Client) (interface{}, error) {
+	return &pluginSourceRPC{client: c, mb: mb}, nil
 }
 
-func (p *pluginDestination) Server(mb *hplugin.MuxBroker) (interface{}, error) {
+// rpcPluginDestination serves destinations with the net/rpc protocol.
+type rpcPluginDestination struct {
+	impl Destination
+	g    prometheus.Gatherer
+	l    hclog.Logger
+	ctx  context.Context
+}
+
+func (p *rpcPluginDestination) Server(mb *hplugin.MuxBroker) (interface{}, error) {
 	return &pluginDestinationRPCServer{Impl: p.impl, mb: mb, l: p.l, ctx: p.ctx, g: p.g}, nil
 }
+
+func (p *rpcPluginDestination) Client(mb *hplugin.MuxBroker, c *rpc.Client) (interface{}, error) {
+	return &pluginDestinationRPC{client: c, mb: mb}, nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"runtime"
 	"strings"
@@ -15,6 +16,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/storage"
 )
 
 var noopPath string = fmt.Sprintf("../bin/plugin/%s/%s/noop", runtime.GOOS, runtime.GOARCH)
@@ -58,6 +60,68 @@ func TestNewPluginSource(t *testing.T) {
 		assert.Error(t, p.Reset(ctx))
 	})
 
+	t.Run("NextN", func(t *testing.T) {
+		pm := NewPluginManager(0, nil)
+		ctx := context.Background()
+		t.Cleanup(pm.Stop)
+
+		p, err := pm.NewSource(noopPath, nil, nil)
+		require.NoError(t, err)
+		b, ok := p.(ingest.BatchNexter)
+		require.True(t, ok)
+
+		codecs, err := b.NextN(ctx, 10)
+		assert.ErrorIs(t, err, io.EOF)
+		assert.Equal(t, []ingest.Codec{defaultCodec}, codecs)
+		codecs, err = b.NextN(ctx, 10)
+		assert.ErrorIs(t, err, io.EOF)
+		assert.Empty(t, codecs)
+
+		// The plugin lists the source with Next, but in a single call of NextN.
+		counts := rpcCounts(t, p.(prometheus.Gatherer))
+		assert.Equal(t, uint64(2), counts["plugin"]["NextN"])
+		assert.Zero(t, counts["plugin"]["Next"])
+	})
+
+	t.Run("Locate and CopyFrom", func(t *testing.T) {
+		pm := NewPluginManager(0, nil)
+		ctx := context.Background()
+		t.Cleanup(pm.Stop)
+
+		s, err := pm.NewSource(noopPath, nil, nil)
+		require.NoError(t, err)
+		d, err := pm.NewDestination(noopPath, nil, nil)
+		require.NoError(t, err)
+
+		// The noop plugin cannot locate objects or copy them, so they are downloaded and stored instead.
+		_, err = ingest.Locate(ctx, s, defaultCodec)
+		assert.ErrorIs(t, err, ingest.ErrLocateNotSupported)
+		_, err = storage.CopyFrom(ctx, d, defaultCodec, &url.URL{Scheme: "s3", Host: "bucket", Path: "/foo"})
+		assert.ErrorIs(t, err, storage.ErrCopyNotImplemented)
+
+		// Destinations that cannot copy one object can be told apart from ones that cannot copy any.
+		assert.ErrorIs(t, fromStatus(toStatus(storage.ErrCopyNotSupported)), storage.ErrCopyNotSupported)
+		assert.NotErrorIs(t, fromStatus(toStatus(storage.ErrCopyNotImplemented)), storage.ErrCopyNotSupported)
+	})
+
+	t.Run("Checkpoint and Restore", func(t *testing.T) {
+		pm := NewPluginManager(0, nil)
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(pm.Stop)
+		t.Cleanup(cancel)
+
+		p, err := pm.NewSource(noopPath, nil, nil)
+		require.NoError(t, err)
+
+		// The noop source does not implement ingest.Checkpointer.
+		cp, ok := p.(ingest.Checkpointer)
+		require.True(t, ok)
+		c, err := cp.Checkpoint(ctx)
+		assert.NoError(t, err)
+		assert.Nil(t, c)
+		assert.NoError(t, cp.Restore(ctx, []byte("checkpoint")))
+	})
+
 	t.Run("Download and CleanUp", func(t *testing.T) {
 		pm := NewPluginManager(0, nil)
 		ctx, cancel := context.WithCancel(context.Background())
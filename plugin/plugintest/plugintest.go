@@ -0,0 +1,214 @@
+// Package plugintest verifies that the sources and destinations of plugins behave as ingest expects,
+// so that plugin authors can check their plugins before they ship them.
+//
+// The checks call the source or destination directly. This is equivalent to calling it through the plugin protocol,
+// because the protocol preserves the errors that ingest checks for, i.e. io.EOF and os.ErrNotExist.
+package plugintest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/plugin"
+)
+
+const (
+	// MaxObjects is the number of objects after which the checks stop listing the objects of a source.
+	MaxObjects = 100
+	// objectSize is the size of the object that is stored in destinations,
+	// which spans several of the chunks in which objects are streamed between ingest and plugins.
+	objectSize = 200 << 10
+)
+
+// TestSource configures the source with config and fails the test if it does not behave as ingest expects, see VerifySource.
+func TestSource(t testing.TB, s plugin.Source, config map[string]any) {
+	t.Helper()
+	if err := VerifySource(context.Background(), s, config); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestDestination configures the destination with config and fails the test if it does not behave as ingest expects, see VerifyDestination.
+func TestDestination(t testing.TB, d plugin.Destination, config map[string]any) {
+	t.Helper()
+	if err := VerifyDestination(context.Background(), d, config); err != nil {
+		t.Error(err)
+	}
+}
+
+// VerifySource configures the source with config and returns an error that lists every way in which it does not behave as ingest expects:
+//   - Next returns the objects of the source and then io.EOF until the source is reset.
+//   - Reset lists the objects from the beginning again.
+//   - Download returns the content of every listed object with the announced length
+//     and an error that wraps os.ErrNotExist for objects that do not exist.
+//   - CleanUp succeeds for every listed object, also if the object was already cleaned up,
+//     because ingest cleans up objects again if a message is redelivered.
+//
+// Only the first MaxObjects objects are verified, and the objects can only be verified if the source lists some.
+// CleanUp is called for all verified objects, so the source must be configured with test data.
+func VerifySource(ctx context.Context, s plugin.Source, config map[string]any) error {
+	if err := s.Configure(config); err != nil {
+		return fmt.Errorf("failed to configure source: %w", err)
+	}
+	if err := s.Reset(ctx); err != nil {
+		return fmt.Errorf("failed to reset source: %w", err)
+	}
+	codecs, eof, err := list(ctx, s)
+	if err != nil {
+		return err
+	}
+
+	var errs *multierror.Error
+	if eof {
+		if _, err := s.Next(ctx); !errors.Is(err, io.EOF) {
+			errs = multierror.Append(errs, fmt.Errorf("Next must keep returning io.EOF after all objects were listed, got %v", err))
+		}
+	}
+	if err := s.Reset(ctx); err != nil {
+		errs = multierror.Append(errs, fmt.Errorf("failed to reset source again: %w", err))
+	} else if len(codecs) == 0 {
+		if _, err := s.Next(ctx); !errors.Is(err, io.EOF) {
+			errs = multierror.Append(errs, fmt.Errorf("Next must return io.EOF after Reset for a source without objects, got %v", err))
+		}
+	} else if c, err := s.Next(ctx); err != nil {
+		errs = multierror.Append(errs, fmt.Errorf("Next must list the objects again after Reset, got %w", err))
+	} else if c.ID != codecs[0].ID {
+		errs = multierror.Append(errs, fmt.Errorf("Next must list the objects from the beginning after Reset, got %q instead of %q", c.ID, codecs[0].ID))
+	}
+
+	for _, c := range codecs {
+		if err := download(ctx, s, c); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+	missing := missingCodec()
+	if _, err := s.Download(ctx, missing); !errors.Is(err, os.ErrNotExist) {
+		errs = multierror.Append(errs, fmt.Errorf("Download must return an error that wraps os.ErrNotExist for object %q that does not exist, got %v", missing.ID, err))
+	}
+
+	for _, c := range codecs {
+		if err := s.CleanUp(ctx, c); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("failed to clean up object %q: %w", c.ID, err))
+			continue
+		}
+		if err := s.CleanUp(ctx, c); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("CleanUp must succeed for object %q that was already cleaned up, got %w", c.ID, err))
+		}
+	}
+	return errs.ErrorOrNil()
+}
+
+// list returns the first MaxObjects objects of the source and whether Next returned io.EOF after them.
+func list(ctx context.Context, s plugin.Source) ([]ingest.Codec, bool, error) {
+	var codecs []ingest.Codec
+	for len(codecs) < MaxObjects {
+		c, err := s.Next(ctx)
+		if errors.Is(err, io.EOF) {
+			return codecs, true, nil
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to list objects: %w", err)
+		}
+		if c == nil {
+			return nil, false, errors.New("Next must return an object or an error")
+		}
+		if c.ID == "" {
+			return nil, false, fmt.Errorf("Next must return objects with IDs, got object %q without ID", c.Name)
+		}
+		codecs = append(codecs, *c)
+	}
+	return codecs, false, nil
+}
+
+// download reads the object and checks that it has the length that the source announced.
+func download(ctx context.Context, s plugin.Source, c ingest.Codec) error {
+	obj, err := s.Download(ctx, c)
+	if err != nil {
+		return fmt.Errorf("failed to download object %q: %w", c.ID, err)
+	}
+	if obj == nil || obj.Reader == nil {
+		return fmt.Errorf("Download must return an object with a reader for object %q", c.ID)
+	}
+	if rc, ok := obj.Reader.(io.Closer); ok {
+		defer rc.Close()
+	}
+	n, err := io.Copy(io.Discard, obj.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to read object %q: %w", c.ID, err)
+	}
+	if obj.Len > 0 && n != obj.Len {
+		return fmt.Errorf("the length of object %q is %d, but %d bytes were read", c.ID, obj.Len, n)
+	}
+	return nil
+}
+
+// VerifyDestination configures the destination with config and returns an error that lists every way in which it does not behave as ingest expects:
+//   - Stat returns an error that wraps os.ErrNotExist for objects that were not stored.
+//   - Store stores objects that span several chunks, empty objects and objects that were already stored,
+//     because ingest stores objects again if a message is redelivered.
+//   - Stat succeeds for stored objects, so that ingest does not store them again.
+//
+// The objects that are stored have IDs and names starting with plugintest-, so the destination must be configured for test data.
+func VerifyDestination(ctx context.Context, d plugin.Destination, config map[string]any) error {
+	if err := d.Configure(config); err != nil {
+		return fmt.Errorf("failed to configure destination: %w", err)
+	}
+
+	var errs *multierror.Error
+	missing := missingCodec()
+	if _, err := d.Stat(ctx, missing); !errors.Is(err, os.ErrNotExist) {
+		errs = multierror.Append(errs, fmt.Errorf("Stat must return an error that wraps os.ErrNotExist for object %q that was not stored, got %v", missing.ID, err))
+	}
+
+	content := make([]byte, objectSize)
+	for i := range content {
+		content[i] = byte(i)
+	}
+	c := ingest.NewCodec(fmt.Sprintf("plugintest-%d", time.Now().UnixNano()), "plugintest-object", nil)
+	if err := store(ctx, d, c, content); err != nil {
+		return multierror.Append(errs, err).ErrorOrNil()
+	}
+	if oi, err := d.Stat(ctx, c); err != nil {
+		errs = multierror.Append(errs, fmt.Errorf("failed to stat stored object %q: %w", c.ID, err))
+	} else if oi == nil {
+		errs = multierror.Append(errs, fmt.Errorf("Stat must return information about stored object %q", c.ID))
+	}
+	if err := store(ctx, d, c, content); err != nil {
+		errs = multierror.Append(errs, fmt.Errorf("Store must store object %q again: %w", c.ID, err))
+	}
+	empty := ingest.NewCodec(c.ID+"-empty", "plugintest-empty", nil)
+	if err := store(ctx, d, empty, nil); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+	return errs.ErrorOrNil()
+}
+
+func store(ctx context.Context, d plugin.Destination, c ingest.Codec, content []byte) error {
+	u, err := d.Store(ctx, c, ingest.Object{
+		MimeType: "application/octet-stream",
+		Len:      int64(len(content)),
+		Reader:   bytes.NewReader(content),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store object %q of %d bytes: %w", c.ID, len(content), err)
+	}
+	if u == nil {
+		return fmt.Errorf("Store must return the URL of stored object %q", c.ID)
+	}
+	return nil
+}
+
+// missingCodec returns a codec of an object that does not exist.
+func missingCodec() ingest.Codec {
+	id := fmt.Sprintf("plugintest-missing-%d", time.Now().UnixNano())
+	return ingest.NewCodec(id, id, nil)
+}
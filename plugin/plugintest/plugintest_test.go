@@ -0,0 +1,153 @@
+package plugintest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/storage"
+)
+
+// memory is a source and destination that keeps objects in memory and behaves as ingest expects.
+type memory struct {
+	objects map[string]string
+	ids     []string
+	next    int
+	// The fields below break the plugin in the ways that the checks detect.
+	rewind     bool
+	anyError   bool
+	cleanUpErr bool
+	shortLen   bool
+}
+
+func newMemory(ids ...string) *memory {
+	m := &memory{objects: make(map[string]string)}
+	for _, id := range ids {
+		m.objects[id] = "content of " + id
+		m.ids = append(m.ids, id)
+	}
+	return m
+}
+
+func (m *memory) Configure(map[string]any) error { return nil }
+
+func (m *memory) Reset(context.Context) error {
+	m.next = 0
+	return nil
+}
+
+func (m *memory) Next(context.Context) (*ingest.Codec, error) {
+	if m.next >= len(m.ids) {
+		if m.rewind {
+			m.next = 0
+		}
+		return nil, io.EOF
+	}
+	c := ingest.NewCodec(m.ids[m.next], m.ids[m.next], nil)
+	m.next++
+	return &c, nil
+}
+
+func (m *memory) Download(_ context.Context, c ingest.Codec) (*ingest.Object, error) {
+	content, ok := m.objects[c.ID]
+	if !ok {
+		if m.anyError {
+			return nil, fmt.Errorf("object %q not found", c.ID)
+		}
+		return nil, fmt.Errorf("object %q: %w", c.ID, os.ErrNotExist)
+	}
+	l := int64(len(content))
+	if m.shortLen {
+		l++
+	}
+	return &ingest.Object{Len: l, Reader: strings.NewReader(content)}, nil
+}
+
+func (m *memory) CleanUp(_ context.Context, c ingest.Codec) error {
+	if _, ok := m.objects[c.ID]; !ok && m.cleanUpErr {
+		return errors.New("already cleaned up")
+	}
+	delete(m.objects, c.ID)
+	return nil
+}
+
+func (m *memory) Stat(_ context.Context, c ingest.Codec) (*storage.ObjectInfo, error) {
+	if _, ok := m.objects[c.ID]; !ok {
+		if m.anyError {
+			return nil, errors.New("not found")
+		}
+		return nil, os.ErrNotExist
+	}
+	return &storage.ObjectInfo{URI: "mem://" + c.ID}, nil
+}
+
+func (m *memory) Store(_ context.Context, c ingest.Codec, obj ingest.Object) (*url.URL, error) {
+	buf, err := io.ReadAll(obj.Reader)
+	if err != nil {
+		return nil, err
+	}
+	m.objects[c.ID] = string(buf)
+	return url.Parse("mem://" + c.ID)
+}
+
+func TestVerifySource(t *testing.T) {
+	ctx := context.Background()
+	TestSource(t, newMemory("foo", "bar"), nil)
+	TestSource(t, newMemory(), nil)
+
+	for _, tc := range []struct {
+		name  string
+		m     *memory
+		error string
+	}{
+		{
+			name:  "Next does not keep returning io.EOF",
+			m:     &memory{rewind: true, objects: map[string]string{"foo": "foo"}, ids: []string{"foo"}},
+			error: "Next must keep returning io.EOF after all objects were listed",
+		},
+		{
+			name:  "missing objects do not wrap os.ErrNotExist",
+			m:     &memory{anyError: true, objects: map[string]string{}},
+			error: "Download must return an error that wraps os.ErrNotExist",
+		},
+		{
+			name:  "CleanUp is not idempotent",
+			m:     &memory{cleanUpErr: true, objects: map[string]string{"foo": "foo"}, ids: []string{"foo"}},
+			error: `CleanUp must succeed for object "foo" that was already cleaned up`,
+		},
+		{
+			name:  "wrong length",
+			m:     &memory{shortLen: true, objects: map[string]string{"foo": "foo"}, ids: []string{"foo"}},
+			error: `the length of object "foo" is 4, but 3 bytes were read`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.ErrorContains(t, VerifySource(ctx, tc.m, nil), tc.error)
+		})
+	}
+}
+
+func TestVerifyDestination(t *testing.T) {
+	ctx := context.Background()
+	m := newMemory()
+	TestDestination(t, m, nil)
+	require.Len(t, m.objects, 2)
+	for id, content := range m.objects {
+		if strings.HasSuffix(id, "-empty") {
+			assert.Empty(t, content)
+		} else {
+			assert.Len(t, content, objectSize)
+		}
+	}
+
+	assert.ErrorContains(t, VerifyDestination(ctx, &memory{anyError: true, objects: map[string]string{}}, nil), "Stat must return an error that wraps os.ErrNotExist")
+}
@@ -0,0 +1,252 @@
+package plugin
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/storage"
+)
+
+// Options configure the sources and destinations that the PluginManager creates.
+type Options struct {
+	Timeouts Timeouts
+	// Instances is the number of processes of the plugin file that serve the source or destination.
+	// Objects are downloaded and stored with all instances in turn, so that concurrent transfers
+	// do not share the connection to a single process. Built-in plugins always have one instance.
+	Instances int
+}
+
+// instanceLabels returns the labels of the i-th instance of a pool, which tell the metrics of the instances apart.
+func instanceLabels(labels prometheus.Labels, i int) prometheus.Labels {
+	l := prometheus.Labels{"instance": strconv.Itoa(i)}
+	for k, v := range labels {
+		l[k] = v
+	}
+	return l
+}
+
+// startPool starts n instances concurrently and kills the instances that were started if any of them fails.
+func (pm *PluginManager) startPool(n int, start func(i int) (any, error)) ([]any, error) {
+	instances := make([]any, n)
+	errs := make([]error, n)
+	g := multierror.Group{}
+	for i := range instances {
+		i := i
+		g.Go(func() error {
+			instances[i], errs[i] = start(i)
+			return nil
+		})
+	}
+	// None of the go routines in the group return errors.
+	g.Wait() //nolint:errcheck
+	for _, err := range errs {
+		if err != nil {
+			for i := range instances {
+				if errs[i] == nil {
+					pm.Kill(instances[i])
+				}
+			}
+			return nil, err
+		}
+	}
+	return instances, nil
+}
+
+// pool is implemented by the sources and destinations with several instances.
+type pool interface {
+	members() []any
+}
+
+// newSourcePool returns a source whose plugin runs in o.Instances processes.
+func (pm *PluginManager) newSourcePool(path string, config map[string]any, labels prometheus.Labels, o Options) (Source, error) {
+	instances, err := pm.startPool(o.Instances, func(i int) (any, error) {
+		return pm.newSource(path, config, instanceLabels(labels, i), o.Timeouts)
+	})
+	if err != nil {
+		return nil, err
+	}
+	p := &sourcePool{instances: make([]Source, len(instances))}
+	for i := range instances {
+		p.instances[i] = instances[i].(Source)
+	}
+	p.Source = p.instances[0]
+	return p, nil
+}
+
+var (
+	_ Source              = &sourcePool{}
+	_ ingest.BatchNexter  = &sourcePool{}
+	_ ingest.Checkpointer = &sourcePool{}
+	_ ingest.Locator      = &sourcePool{}
+	_ prometheus.Gatherer = &sourcePool{}
+	_ HealthChecker       = &sourcePool{}
+)
+
+// sourcePool lists a source with its first instance, which holds the state of the listing,
+// and downloads and cleans up objects with all instances in turn.
+type sourcePool struct {
+	Source
+	instances []Source
+	n         uint32
+}
+
+func (p *sourcePool) members() []any {
+	m := make([]any, len(p.instances))
+	for i := range p.instances {
+		m[i] = p.instances[i]
+	}
+	return m
+}
+
+func (p *sourcePool) instance() Source {
+	return p.instances[atomic.AddUint32(&p.n, 1)%uint32(len(p.instances))]
+}
+
+// Gather returns the metrics of the first instance.
+// The PluginManager gathers the metrics of all instances with an instance label.
+func (p *sourcePool) Gather() ([]*dto.MetricFamily, error) {
+	if g, ok := p.Source.(prometheus.Gatherer); ok {
+		return g.Gather()
+	}
+	return nil, nil
+}
+
+// Health returns the worst health of the instances.
+func (p *sourcePool) Health(ctx context.Context) (Health, error) {
+	var h Health
+	for _, s := range p.instances {
+		if ih := healthOf(ctx, s); ih.Status > h.Status {
+			h = ih
+		}
+	}
+	return h, nil
+}
+
+func (p *sourcePool) Checkpoint(ctx context.Context) ([]byte, error) {
+	if cp, ok := p.Source.(ingest.Checkpointer); ok {
+		return cp.Checkpoint(ctx)
+	}
+	return nil, nil
+}
+
+func (p *sourcePool) Restore(ctx context.Context, c []byte) error {
+	if cp, ok := p.Source.(ingest.Checkpointer); ok {
+		return cp.Restore(ctx, c)
+	}
+	return nil
+}
+
+// Configure configures all instances.
+func (p *sourcePool) Configure(config map[string]any) error {
+	var errs *multierror.Error
+	for _, s := range p.instances {
+		errs = multierror.Append(errs, s.Configure(config))
+	}
+	return errs.ErrorOrNil()
+}
+
+func (p *sourcePool) NextN(ctx context.Context, n int) ([]ingest.Codec, error) {
+	return ingest.NextN(ctx, p.Source, n)
+}
+
+func (p *sourcePool) Download(ctx context.Context, c ingest.Codec) (*ingest.Object, error) {
+	return p.instance().Download(ctx, c)
+}
+
+func (p *sourcePool) CleanUp(ctx context.Context, c ingest.Codec) error {
+	return p.instance().CleanUp(ctx, c)
+}
+
+func (p *sourcePool) Locate(ctx context.Context, c ingest.Codec) (*url.URL, error) {
+	return ingest.Locate(ctx, p.instance(), c)
+}
+
+// newDestinationPool returns a destination whose plugin runs in o.Instances processes.
+func (pm *PluginManager) newDestinationPool(path string, config map[string]any, labels prometheus.Labels, o Options) (Destination, error) {
+	instances, err := pm.startPool(o.Instances, func(i int) (any, error) {
+		return pm.newDestination(path, config, instanceLabels(labels, i), o.Timeouts)
+	})
+	if err != nil {
+		return nil, err
+	}
+	p := &destinationPool{instances: make([]Destination, len(instances))}
+	for i := range instances {
+		p.instances[i] = instances[i].(Destination)
+	}
+	p.Destination = p.instances[0]
+	return p, nil
+}
+
+var (
+	_ Destination         = &destinationPool{}
+	_ storage.Copier      = &destinationPool{}
+	_ prometheus.Gatherer = &destinationPool{}
+	_ HealthChecker       = &destinationPool{}
+)
+
+// destinationPool stats and stores objects with all instances of a destination in turn.
+type destinationPool struct {
+	Destination
+	instances []Destination
+	n         uint32
+}
+
+func (p *destinationPool) members() []any {
+	m := make([]any, len(p.instances))
+	for i := range p.instances {
+		m[i] = p.instances[i]
+	}
+	return m
+}
+
+func (p *destinationPool) instance() Destination {
+	return p.instances[atomic.AddUint32(&p.n, 1)%uint32(len(p.instances))]
+}
+
+// Gather returns the metrics of the first instance.
+// The PluginManager gathers the metrics of all instances with an instance label.
+func (p *destinationPool) Gather() ([]*dto.MetricFamily, error) {
+	if g, ok := p.Destination.(prometheus.Gatherer); ok {
+		return g.Gather()
+	}
+	return nil, nil
+}
+
+// Health returns the worst health of the instances.
+func (p *destinationPool) Health(ctx context.Context) (Health, error) {
+	var h Health
+	for _, d := range p.instances {
+		if ih := healthOf(ctx, d); ih.Status > h.Status {
+			h = ih
+		}
+	}
+	return h, nil
+}
+
+// Configure configures all instances.
+func (p *destinationPool) Configure(config map[string]any) error {
+	var errs *multierror.Error
+	for _, d := range p.instances {
+		errs = multierror.Append(errs, d.Configure(config))
+	}
+	return errs.ErrorOrNil()
+}
+
+func (p *destinationPool) Stat(ctx context.Context, c ingest.Codec) (*storage.ObjectInfo, error) {
+	return p.instance().Stat(ctx, c)
+}
+
+func (p *destinationPool) Store(ctx context.Context, c ingest.Codec, obj ingest.Object) (*url.URL, error) {
+	return p.instance().Store(ctx, c, obj)
+}
+
+func (p *destinationPool) CopyFrom(ctx context.Context, c ingest.Codec, uri *url.URL) (*url.URL, error) {
+	return storage.CopyFrom(ctx, p.instance(), c, uri)
+}
@@ -0,0 +1,92 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/connylabs/ingest"
+)
+
+func TestPool(t *testing.T) {
+	pm := NewPluginManager(time.Millisecond, nil)
+	t.Cleanup(pm.Stop)
+	ctx := context.Background()
+
+	s, err := pm.NewSourceWithOptions(noopPath, nil, prometheus.Labels{"source": "foo"}, Options{Instances: 3})
+	require.NoError(t, err)
+	p, ok := s.(*sourcePool)
+	require.True(t, ok)
+	require.Len(t, p.instances, 3)
+	assert.NotZero(t, pm.ProtocolVersion(s))
+
+	// The first instance lists the source and all instances download objects.
+	require.NoError(t, s.Reset(ctx))
+	c, err := s.Next(ctx)
+	require.NoError(t, err)
+	for i := 0; i < len(p.instances); i++ {
+		obj, err := s.Download(ctx, *c)
+		require.NoError(t, err)
+		buf, err := io.ReadAll(obj.Reader)
+		require.NoError(t, err)
+		assert.Equal(t, defaultObjContent, string(buf))
+	}
+	h, err := s.(HealthChecker).Health(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, Healthy, h.Status)
+
+	d, err := pm.NewDestinationWithOptions(noopPath, nil, prometheus.Labels{"destination": "bar"}, Options{Instances: 2})
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		_, err = d.Store(ctx, defaultCodec, ingest.Object{Reader: bytes.NewBufferString(defaultObjContent), Len: int64(len(defaultObjContent))})
+		require.NoError(t, err)
+	}
+
+	// The manager reports the metrics of every instance.
+	mfs, err := pm.Gather()
+	require.NoError(t, err)
+	var instances []string
+	for _, mf := range mfs {
+		if mf.GetName() != "ingest_plugin_health_status" {
+			continue
+		}
+		for _, m := range mf.Metric {
+			for _, lp := range m.Label {
+				if lp.GetName() == "instance" {
+					instances = append(instances, lp.GetValue())
+				}
+			}
+		}
+	}
+	sort.Strings(instances)
+	assert.Equal(t, []string{"0", "0", "1", "1", "2"}, instances)
+	assert.Len(t, pm.Health(ctx), 5)
+
+	// Killing the pool stops all instances.
+	pm.Kill(s)
+	assert.Len(t, pm.Health(ctx), 2)
+	for _, i := range p.instances {
+		_, err := i.(prometheus.Gatherer).Gather()
+		assert.Error(t, err)
+	}
+
+	// Built-in plugins have a single instance.
+	noop, ok := BuiltinPath("noop")
+	require.True(t, ok)
+	s, err = pm.NewSourceWithOptions(noop, nil, nil, Options{Instances: 3})
+	require.NoError(t, err)
+	_, ok = s.(*sourcePool)
+	assert.False(t, ok)
+
+	// A pool is not created if any of its instances fails.
+	_, err = pm.NewSourceWithOptions(noopPath, map[string]any{"error": "an error"}, nil, Options{Instances: 2})
+	assert.Error(t, err)
+	assert.Len(t, pm.Health(ctx), 3)
+}
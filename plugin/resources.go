@@ -0,0 +1,152 @@
+package plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+
+	hplugin "github.com/hashicorp/go-plugin"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Limits are the resource limits of the process of a plugin.
+type Limits struct {
+	// Memory is the maximum memory of the plugin in bytes.
+	Memory int64
+	// CPU is the maximum number of CPUs that the plugin uses, e.g. 0.5 for half of a CPU.
+	CPU float64
+}
+
+// Validate returns an error if the limits are negative.
+func (l Limits) Validate() error {
+	if l.Memory < 0 {
+		return errors.New("the memory limit must not be negative")
+	}
+	if l.CPU < 0 {
+		return errors.New("the CPU limit must not be negative")
+	}
+	return nil
+}
+
+// limitsEnv makes ingest limit its own process with the limits in the variable and execute the plugin file,
+// so that the limits apply to the plugin before it runs.
+const limitsEnv = "INGEST_PLUGIN_LIMITS"
+
+// launch describes how ingest limits its process before it executes a plugin file.
+type launch struct {
+	Path   string `json:"path"`
+	Memory int64  `json:"memory,omitempty"`
+	Cgroup string `json:"cgroup,omitempty"`
+}
+
+func init() {
+	v, ok := os.LookupEnv(limitsEnv)
+	if !ok {
+		return
+	}
+	if err := execLimited(v); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to start plugin with resource limits: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// execLimited limits the process and replaces it with the plugin file.
+// It only returns if the plugin file could not be executed.
+func execLimited(v string) error {
+	var l launch
+	if err := json.Unmarshal([]byte(v), &l); err != nil {
+		return err
+	}
+	if err := os.Unsetenv(limitsEnv); err != nil {
+		return err
+	}
+	if l.Cgroup != "" {
+		if err := enterCgroup(l.Cgroup); err != nil {
+			return err
+		}
+	} else if l.Memory > 0 {
+		// The data segment contains the heap, but not the address space that the Go runtime reserves.
+		if err := syscall.Setrlimit(syscall.RLIMIT_DATA, &syscall.Rlimit{Cur: uint64(l.Memory), Max: uint64(l.Memory)}); err != nil {
+			return fmt.Errorf("failed to limit memory: %w", err)
+		}
+	}
+	return syscall.Exec(l.Path, []string{l.Path}, os.Environ())
+}
+
+// client is an alias of the client of go-plugin, so that process can embed it
+// without the name of the embedded field shadowing the Client method.
+type client = hplugin.Client
+
+// process is the process of a plugin file.
+type process struct {
+	*client
+	// cgroup is the directory of the cgroup that limits the resources of the process, if any.
+	cgroup string
+	// file is the plugin file that the process was started from, if the manager swaps replaced plugin files.
+	file *pluginFile
+}
+
+// Kill stops the process and removes its cgroup.
+func (p *process) Kill() {
+	p.client.Kill()
+	if p.cgroup != "" {
+		os.Remove(p.cgroup) //nolint:errcheck
+	}
+}
+
+// command returns the command that starts the plugin file at path within the limits
+// and the cgroup that was created for it, if any.
+// Plugins get their own cgroups under the cgroup directory root. Without cgroups,
+// only the memory of plugins can be limited and CPU limits are refused.
+func command(path string, l Limits, root string) (*exec.Cmd, string, error) {
+	if l == (Limits{}) {
+		return exec.Command(path), "", nil
+	}
+	if root == "" && l.CPU > 0 {
+		return nil, "", fmt.Errorf("the CPU limit of plugin %q requires a cgroup for plugins", filepath.Base(path))
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return nil, "", err
+	}
+	ln := launch{Path: path, Memory: l.Memory}
+	if root != "" {
+		if ln.Cgroup, err = newCgroup(root, filepath.Base(path), l); err != nil {
+			return nil, "", fmt.Errorf("failed to create cgroup for plugin %q: %w", filepath.Base(path), err)
+		}
+	}
+	buf, err := json.Marshal(ln)
+	if err != nil {
+		return nil, "", err
+	}
+	cmd := exec.Command(self)
+	cmd.Env = []string{limitsEnv + "=" + string(buf)}
+	return cmd, ln.Cgroup, nil
+}
+
+// residentMemoryFamily returns the metric family with the resident memory of the process of a plugin,
+// which is measured by the manager, so that it is also reported for plugins that do not report it themselves.
+func residentMemoryFamily(p *process, labels prometheus.Labels) *dto.MetricFamily {
+	rc := p.ReattachConfig()
+	if rc == nil {
+		return nil
+	}
+	rss, err := residentMemory(rc.Pid)
+	if err != nil {
+		return nil
+	}
+	return &dto.MetricFamily{
+		Name: ptr("ingest_plugin_resident_memory_bytes"),
+		Help: ptr("The resident memory of the process of the plugin in bytes."),
+		Type: dto.MetricType_GAUGE.Enum(),
+		Metric: []*dto.Metric{{
+			Label: relabel(nil, labels),
+			Gauge: &dto.Gauge{Value: ptr(float64(rss))},
+		}},
+	}
+}
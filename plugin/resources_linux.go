@@ -0,0 +1,60 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// cpuPeriod is the period of the CPU limits of cgroups in microseconds.
+const cpuPeriod = 100000
+
+// newCgroup creates a cgroup v2 for a plugin with the limits under root and returns its directory.
+func newCgroup(root, name string, l Limits) (string, error) {
+	// The controllers must be enabled for the children of root to limit the cgroups of plugins.
+	if err := os.WriteFile(filepath.Join(root, "cgroup.subtree_control"), []byte("+cpu +memory"), 0o644); err != nil {
+		return "", err
+	}
+	dir, err := os.MkdirTemp(root, name+"-")
+	if err != nil {
+		return "", err
+	}
+	files := make(map[string]string)
+	if l.Memory > 0 {
+		files["memory.max"] = strconv.FormatInt(l.Memory, 10)
+	}
+	if l.CPU > 0 {
+		files["cpu.max"] = fmt.Sprintf("%d %d", int64(l.CPU*cpuPeriod), cpuPeriod)
+	}
+	for f, v := range files {
+		if err := os.WriteFile(filepath.Join(dir, f), []byte(v), 0o644); err != nil {
+			os.Remove(dir) //nolint:errcheck
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
+// enterCgroup moves the process into the cgroup.
+func enterCgroup(dir string) error {
+	return os.WriteFile(filepath.Join(dir, "cgroup.procs"), []byte(strconv.Itoa(os.Getpid())), 0o644)
+}
+
+// residentMemory returns the resident memory of a process in bytes.
+func residentMemory(pid int) (int64, error) {
+	buf, err := os.ReadFile(fmt.Sprintf("/proc/%d/statm", pid))
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(buf))
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("unexpected content of /proc/%d/statm", pid)
+	}
+	pages, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return pages * int64(os.Getpagesize()), nil
+}
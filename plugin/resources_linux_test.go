@@ -0,0 +1,85 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimits(t *testing.T) {
+	assert.NoError(t, Limits{}.Validate())
+	assert.NoError(t, Limits{Memory: 1 << 30, CPU: 0.5}.Validate())
+	assert.Error(t, Limits{Memory: -1}.Validate())
+	assert.Error(t, Limits{CPU: -1}.Validate())
+}
+
+func TestPluginManagerLimits(t *testing.T) {
+	pm := NewPluginManager(0, nil)
+	t.Cleanup(pm.Stop)
+	pm.Limits = map[string]Limits{"noop": {Memory: 512 << 20}}
+
+	// The test binary limits its process and executes the plugin file like ingest does.
+	s, err := pm.NewSource(noopPath, nil, prometheus.Labels{"source": "foo"})
+	require.NoError(t, err)
+	pid := pm.sources[0].c.ReattachConfig().Pid
+	buf, err := os.ReadFile(fmt.Sprintf("/proc/%d/limits", pid))
+	require.NoError(t, err)
+	assert.Regexp(t, `Max data size\s+536870912\s+536870912\s+bytes`, string(buf))
+
+	// The manager reports the resident memory of the plugin.
+	mfs, err := pm.Gather()
+	require.NoError(t, err)
+	var found bool
+	for _, mf := range mfs {
+		if mf.GetName() == "ingest_plugin_resident_memory_bytes" {
+			found = true
+			require.Len(t, mf.Metric, 1)
+			assert.Greater(t, mf.Metric[0].GetGauge().GetValue(), 0.0)
+			assert.Equal(t, "foo", mf.Metric[0].Label[0].GetValue())
+		}
+	}
+	assert.True(t, found)
+	pm.Kill(s)
+
+	// A plugin cannot start with too little memory.
+	pm.Limits = map[string]Limits{"noop": {Memory: 1 << 20}}
+	_, err = pm.NewSource(noopPath, nil, nil)
+	assert.Error(t, err)
+
+	// CPU limits require cgroups.
+	pm.Limits = map[string]Limits{"noop": {CPU: 1}}
+	_, err = pm.NewSource(noopPath, nil, nil)
+	assert.EqualError(t, err, `the CPU limit of plugin "noop" requires a cgroup for plugins`)
+}
+
+func TestCgroup(t *testing.T) {
+	// The files of cgroups are written like regular files, so a directory can stand in for the cgroup root.
+	root := t.TempDir()
+	dir, err := newCgroup(root, "noop", Limits{Memory: 1 << 30, CPU: 0.5})
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(filepath.Base(dir), "noop-"))
+	for f, v := range map[string]string{
+		filepath.Join(root, "cgroup.subtree_control"): "+cpu +memory",
+		filepath.Join(dir, "memory.max"):              "1073741824",
+		filepath.Join(dir, "cpu.max"):                 "50000 100000",
+	} {
+		buf, err := os.ReadFile(f)
+		require.NoError(t, err)
+		assert.Equal(t, v, string(buf), f)
+	}
+
+	require.NoError(t, enterCgroup(dir))
+	buf, err := os.ReadFile(filepath.Join(dir, "cgroup.procs"))
+	require.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(os.Getpid()), string(buf))
+
+	_, err = newCgroup(filepath.Join(root, "missing"), "noop", Limits{Memory: 1 << 30})
+	assert.Error(t, err)
+}
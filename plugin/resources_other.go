@@ -0,0 +1,22 @@
+//go:build !linux
+
+package plugin
+
+import "errors"
+
+// errNoCgroups is returned on operating systems without cgroups.
+var errNoCgroups = errors.New("cgroups are only supported on Linux")
+
+func newCgroup(string, string, Limits) (string, error) {
+	return "", errNoCgroups
+}
+
+func enterCgroup(string) error {
+	return errNoCgroups
+}
+
+// residentMemory is only measured on Linux.
+// Plugins report the resident memory of their processes themselves where their process collectors support it.
+func residentMemory(int) (int64, error) {
+	return 0, errors.New("the resident memory of processes is only measured on Linux")
+}
@@ -0,0 +1,450 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/storage"
+)
+
+// RestartPolicy configures how the PluginManager restarts plugins that stop responding.
+type RestartPolicy struct {
+	// Backoff is the delay before the first restart of a plugin,
+	// which doubles with every further restart within Window up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// MaxRestarts is the number of restarts within Window after which a plugin is crash-looping,
+	// so that Watch gives up and returns an error.
+	MaxRestarts int
+	Window      time.Duration
+}
+
+// backoff returns the delay before the next restart of a plugin that was restarted n times within the window.
+func (rp *RestartPolicy) backoff(n int) time.Duration {
+	d := rp.Backoff
+	for i := 0; i < n && (rp.MaxBackoff <= 0 || d < rp.MaxBackoff); i++ {
+		d *= 2
+	}
+	if rp.MaxBackoff > 0 && d > rp.MaxBackoff {
+		d = rp.MaxBackoff
+	}
+	return d
+}
+
+// restart replaces the client of a plugin that stopped responding with the client that start returns,
+// until start succeeds or the plugin is crash-looping. start must not commit the new instance of the plugin
+// before the returned function is called, which happens only if the plugin is still managed.
+// The restarts are only accessed by Watch, which restarts every plugin at most once at a time.
+func (pm *PluginManager) restart(ctx context.Context, old *process, path, mode string, restarts *[]time.Time, start func() (*process, func(), error)) error {
+	for {
+		now := time.Now()
+		n := 0
+		for _, t := range *restarts {
+			if now.Sub(t) < pm.Restart.Window {
+				(*restarts)[n] = t
+				n++
+			}
+		}
+		*restarts = (*restarts)[:n]
+		if n >= pm.Restart.MaxRestarts {
+			return fmt.Errorf("%s plugin %q is crash-looping: it was restarted %d times within %s", mode, path, n, pm.Restart.Window)
+		}
+
+		d := pm.Restart.backoff(n)
+		level.Warn(pm.l).Log("msg", "plugin stopped responding; restarting it", "path", path, "mode", mode, "restarts", n, "backoff", d)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(d):
+		}
+		*restarts = append(*restarts, time.Now())
+		if !pm.managed(old) {
+			// The plugin was killed in the meantime.
+			return nil
+		}
+		old.Kill()
+		c, commit, err := start()
+		if err != nil {
+			level.Error(pm.l).Log("msg", "failed to restart plugin", "path", path, "mode", mode, "err", err.Error())
+			continue
+		}
+
+		pm.m.Lock()
+		replaced := pm.replace(old, c)
+		if replaced {
+			commit()
+		}
+		pm.m.Unlock()
+		if !replaced {
+			c.Kill()
+			return nil
+		}
+		level.Info(pm.l).Log("msg", "restarted plugin", "path", path, "mode", mode)
+		return nil
+	}
+}
+
+// replace replaces the client of a managed plugin and returns false if the plugin is no longer managed.
+// The lock of the manager must be held.
+func (pm *PluginManager) replace(old, c *process) bool {
+	for i := range pm.sources {
+		if pm.sources[i].c == old {
+			pm.sources[i].c = c
+			return true
+		}
+	}
+	for i := range pm.destinations {
+		if pm.destinations[i].c == old {
+			pm.destinations[i].c = c
+			return true
+		}
+	}
+	return false
+}
+
+// restartSource restarts the plugin of a source, configures it again and restores the last checkpoint of the source,
+// so that the workflows of the source continue with the new instance.
+func (pm *PluginManager) restartSource(ctx context.Context, w withClient[Source]) error {
+	t, ok := w.t.(*timeoutSource)
+	if !ok {
+		return fmt.Errorf("source plugin %q cannot be restarted", w.path)
+	}
+	r, ok := t.Source.(*restartableSource)
+	if !ok {
+		return fmt.Errorf("source plugin %q cannot be restarted", w.path)
+	}
+	return pm.restart(ctx, w.c, w.path, "source", &r.restarts, func() (*process, func(), error) {
+		resolved, err := pm.resolve(w.config)
+		if err != nil {
+			return nil, nil, err
+		}
+		c, s, err := pm.startSource(pm.verifier(), pm.limits(w.path), w.path, resolved, t.timeouts.Configure)
+		if err != nil {
+			if isConfigureTimeout(err) {
+				t.metrics.total.WithLabelValues("configure").Inc()
+			}
+			return nil, nil, err
+		}
+		if cp, ok := s.(ingest.Checkpointer); ok && r.lastCheckpoint() != nil {
+			if err := cp.Restore(ctx, r.lastCheckpoint()); err != nil {
+				c.Kill()
+				return nil, nil, fmt.Errorf("failed to restore checkpoint: %w", err)
+			}
+		}
+		return c, func() { r.set(s) }, nil
+	})
+}
+
+// restartDestination restarts the plugin of a destination and configures it again.
+func (pm *PluginManager) restartDestination(ctx context.Context, w withClient[Destination]) error {
+	t, ok := w.t.(*timeoutDestination)
+	if !ok {
+		return fmt.Errorf("destination plugin %q cannot be restarted", w.path)
+	}
+	r, ok := t.Destination.(*restartableDestination)
+	if !ok {
+		return fmt.Errorf("destination plugin %q cannot be restarted", w.path)
+	}
+	return pm.restart(ctx, w.c, w.path, "destination", &r.restarts, func() (*process, func(), error) {
+		resolved, err := pm.resolve(w.config)
+		if err != nil {
+			return nil, nil, err
+		}
+		c, d, err := pm.startDestination(pm.verifier(), pm.limits(w.path), w.path, resolved, t.timeouts.Configure)
+		if err != nil {
+			if isConfigureTimeout(err) {
+				t.metrics.total.WithLabelValues("configure").Inc()
+			}
+			return nil, nil, err
+		}
+		return c, func() { r.set(d) }, nil
+	})
+}
+
+// verifier returns the verifier of the manager, which can be replaced when the configuration is reloaded.
+func (pm *PluginManager) verifier() Verifier {
+	pm.m.Lock()
+	defer pm.m.Unlock()
+	return pm.Verifier
+}
+
+// limits returns the resource limits of the plugin file at path, which can be replaced when the configuration is reloaded.
+func (pm *PluginManager) limits(path string) Limits {
+	pm.m.Lock()
+	defer pm.m.Unlock()
+	return pm.Limits[filepath.Base(path)]
+}
+
+// SetVerification replaces the verifier and the resource limits that are used to start and restart plugins
+// and returns the previous ones, so that they can be restored if a reload fails.
+// Plugins that are already running are not verified or limited again.
+func (pm *PluginManager) SetVerification(v Verifier, limits map[string]Limits) (Verifier, map[string]Limits) {
+	pm.m.Lock()
+	defer pm.m.Unlock()
+	prev, prevLimits := pm.Verifier, pm.Limits
+	pm.Verifier, pm.Limits = v, limits
+	return prev, prevLimits
+}
+
+var (
+	_ Source              = &restartableSource{}
+	_ ingest.BatchNexter  = &restartableSource{}
+	_ ingest.Checkpointer = &restartableSource{}
+	_ ingest.Locator      = &restartableSource{}
+	_ prometheus.Gatherer = &restartableSource{}
+	_ HealthChecker       = &restartableSource{}
+)
+
+// restartableSource is the source that the PluginManager returns for a source plugin.
+// It forwards all calls to the current instance of the plugin, which is replaced when the plugin is restarted.
+type restartableSource struct {
+	mu sync.RWMutex
+	s  Source
+	// active counts the calls to the current instance, so that a replaced instance can be drained.
+	active *sync.WaitGroup
+	// checkpoint is the last checkpoint of the source, which is restored when the plugin is restarted.
+	checkpoint []byte
+	restarts   []time.Time
+}
+
+func newRestartableSource(s Source) *restartableSource {
+	return &restartableSource{s: s, active: new(sync.WaitGroup)}
+}
+
+func (r *restartableSource) source() Source {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.s
+}
+
+// acquire returns the current instance and a function that must be called when the call to the instance ended.
+func (r *restartableSource) acquire() (Source, func()) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	r.active.Add(1)
+	return r.s, r.active.Done
+}
+
+// set replaces the current instance and returns the calls to the replaced instance.
+func (r *restartableSource) set(s Source) *sync.WaitGroup {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	active := r.active
+	r.s, r.active = s, new(sync.WaitGroup)
+	return active
+}
+
+func (r *restartableSource) lastCheckpoint() []byte {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.checkpoint
+}
+
+func (r *restartableSource) setCheckpoint(c []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkpoint = c
+}
+
+func (r *restartableSource) Gather() ([]*dto.MetricFamily, error) {
+	if g, ok := r.source().(prometheus.Gatherer); ok {
+		return g.Gather()
+	}
+	return nil, nil
+}
+
+func (r *restartableSource) Health(ctx context.Context) (Health, error) {
+	if hc, ok := r.source().(HealthChecker); ok {
+		return hc.Health(ctx)
+	}
+	return Health{}, nil
+}
+
+func (r *restartableSource) Configure(config map[string]any) error {
+	return r.source().Configure(config)
+}
+
+func (r *restartableSource) Reset(ctx context.Context) error {
+	s, done := r.acquire()
+	defer done()
+	return s.Reset(ctx)
+}
+
+func (r *restartableSource) Next(ctx context.Context) (*ingest.Codec, error) {
+	s, done := r.acquire()
+	defer done()
+	return s.Next(ctx)
+}
+
+func (r *restartableSource) NextN(ctx context.Context, n int) ([]ingest.Codec, error) {
+	s, done := r.acquire()
+	defer done()
+	return ingest.NextN(ctx, s, n)
+}
+
+// Download ends the call to the instance when the content of the object was read or its reader is closed.
+func (r *restartableSource) Download(ctx context.Context, c ingest.Codec) (*ingest.Object, error) {
+	s, done := r.acquire()
+	obj, err := s.Download(ctx, c)
+	if err != nil {
+		done()
+		return nil, err
+	}
+	obj.Reader = &releaseReader{r: obj.Reader, release: done}
+	return obj, nil
+}
+
+func (r *restartableSource) CleanUp(ctx context.Context, c ingest.Codec) error {
+	s, done := r.acquire()
+	defer done()
+	return s.CleanUp(ctx, c)
+}
+
+func (r *restartableSource) Locate(ctx context.Context, c ingest.Codec) (*url.URL, error) {
+	s, done := r.acquire()
+	defer done()
+	return ingest.Locate(ctx, s, c)
+}
+
+func (r *restartableSource) Checkpoint(ctx context.Context) ([]byte, error) {
+	s, done := r.acquire()
+	defer done()
+	cp, ok := s.(ingest.Checkpointer)
+	if !ok {
+		return nil, nil
+	}
+	c, err := cp.Checkpoint(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.setCheckpoint(c)
+	return c, nil
+}
+
+func (r *restartableSource) Restore(ctx context.Context, c []byte) error {
+	s, done := r.acquire()
+	defer done()
+	cp, ok := s.(ingest.Checkpointer)
+	if !ok {
+		return nil
+	}
+	if err := cp.Restore(ctx, c); err != nil {
+		return err
+	}
+	r.setCheckpoint(c)
+	return nil
+}
+
+var (
+	_ Destination         = &restartableDestination{}
+	_ storage.Copier      = &restartableDestination{}
+	_ prometheus.Gatherer = &restartableDestination{}
+	_ HealthChecker       = &restartableDestination{}
+)
+
+// restartableDestination is the destination that the PluginManager returns for a destination plugin.
+// It forwards all calls to the current instance of the plugin, which is replaced when the plugin is restarted.
+type restartableDestination struct {
+	mu sync.RWMutex
+	d  Destination
+	// active counts the calls to the current instance, so that a replaced instance can be drained.
+	active   *sync.WaitGroup
+	restarts []time.Time
+}
+
+func newRestartableDestination(d Destination) *restartableDestination {
+	return &restartableDestination{d: d, active: new(sync.WaitGroup)}
+}
+
+func (r *restartableDestination) destination() Destination {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.d
+}
+
+// acquire returns the current instance and a function that must be called when the call to the instance ended.
+func (r *restartableDestination) acquire() (Destination, func()) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	r.active.Add(1)
+	return r.d, r.active.Done
+}
+
+// set replaces the current instance and returns the calls to the replaced instance.
+func (r *restartableDestination) set(d Destination) *sync.WaitGroup {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	active := r.active
+	r.d, r.active = d, new(sync.WaitGroup)
+	return active
+}
+
+func (r *restartableDestination) Gather() ([]*dto.MetricFamily, error) {
+	if g, ok := r.destination().(prometheus.Gatherer); ok {
+		return g.Gather()
+	}
+	return nil, nil
+}
+
+func (r *restartableDestination) Health(ctx context.Context) (Health, error) {
+	if hc, ok := r.destination().(HealthChecker); ok {
+		return hc.Health(ctx)
+	}
+	return Health{}, nil
+}
+
+func (r *restartableDestination) Configure(config map[string]any) error {
+	return r.destination().Configure(config)
+}
+
+func (r *restartableDestination) Stat(ctx context.Context, c ingest.Codec) (*storage.ObjectInfo, error) {
+	d, done := r.acquire()
+	defer done()
+	return d.Stat(ctx, c)
+}
+
+func (r *restartableDestination) Store(ctx context.Context, c ingest.Codec, obj ingest.Object) (*url.URL, error) {
+	d, done := r.acquire()
+	defer done()
+	return d.Store(ctx, c, obj)
+}
+
+func (r *restartableDestination) CopyFrom(ctx context.Context, c ingest.Codec, uri *url.URL) (*url.URL, error) {
+	d, done := r.acquire()
+	defer done()
+	return storage.CopyFrom(ctx, d, c, uri)
+}
+
+// releaseReader releases the instance that an object was downloaded from
+// once the content of the object was read or the reader is closed.
+type releaseReader struct {
+	r       io.Reader
+	release func()
+	once    sync.Once
+}
+
+func (r *releaseReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil {
+		r.once.Do(r.release)
+	}
+	return n, err
+}
+
+func (r *releaseReader) Close() error {
+	defer r.once.Do(r.release)
+	if c, ok := r.r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
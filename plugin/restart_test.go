@@ -0,0 +1,141 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRestartPolicyBackoff(t *testing.T) {
+	rp := &RestartPolicy{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	for n, d := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		assert.Equal(t, d, rp.backoff(n), n)
+	}
+}
+
+type verifierFunc func(string) error
+
+func (f verifierFunc) Verify(path string) error { return f(path) }
+
+func TestPluginManagerRestart(t *testing.T) {
+	t.Run("restarted plugins", func(t *testing.T) {
+		pm := NewPluginManager(time.Millisecond, nil)
+		pm.Restart = &RestartPolicy{Backoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond, MaxRestarts: 3, Window: time.Minute}
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(func() {
+			cancel()
+			pm.Stop()
+		})
+
+		s, err := pm.NewSource(noopPath, nil, nil)
+		require.NoError(t, err)
+		d, err := pm.NewDestination(noopPath, nil, nil)
+		require.NoError(t, err)
+		oldSource, oldDestination := pm.sources[0].c, pm.destinations[0].c
+		oldSource.Kill()
+		oldDestination.Kill()
+
+		done := make(chan error)
+		go func() {
+			done <- pm.Watch(ctx)
+		}()
+		// The returned source and destination use the restarted plugins.
+		assert.Eventually(t, func() bool {
+			pm.m.Lock()
+			defer pm.m.Unlock()
+			return pm.sources[0].c != oldSource && pm.destinations[0].c != oldDestination
+		}, 5*time.Second, time.Millisecond)
+		assert.NoError(t, s.Reset(context.Background()))
+		_, err = d.Stat(context.Background(), defaultCodec)
+		assert.NoError(t, err)
+
+		cancel()
+		assert.NoError(t, <-done)
+	})
+
+	t.Run("crash loop", func(t *testing.T) {
+		pm := NewPluginManager(time.Millisecond, nil)
+		pm.Restart = &RestartPolicy{Backoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond, MaxRestarts: 3, Window: time.Minute}
+		t.Cleanup(pm.Stop)
+
+		_, err := pm.NewSource(noopPath, nil, nil)
+		require.NoError(t, err)
+		// The plugin cannot be started again.
+		var starts int
+		pm.Verifier = verifierFunc(func(string) error {
+			starts++
+			return errors.New("failed")
+		})
+		pm.sources[0].c.Kill()
+
+		assert.ErrorContains(t, pm.Watch(context.Background()), `source plugin "`+noopPath+`" is crash-looping: it was restarted 3 times within 1m0s`)
+		assert.Equal(t, 3, starts)
+	})
+}
+
+func TestPluginManagerSetVerification(t *testing.T) {
+	pm := NewPluginManager(time.Millisecond, nil)
+	v := verifierFunc(func(string) error { return nil })
+	limits := map[string]Limits{"noop": {Memory: 1 << 30}}
+
+	// The verifier and limits are read by restarts while a reload replaces them; run with -race to detect unlocked access.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			pm.verifier()
+			pm.limits(noopPath)
+		}
+	}()
+	prev, prevLimits := pm.SetVerification(v, limits)
+	<-done
+	assert.Nil(t, prev)
+	assert.Nil(t, prevLimits)
+	assert.NotNil(t, pm.verifier())
+	assert.Equal(t, Limits{Memory: 1 << 30}, pm.limits(noopPath))
+
+	// The previous values are returned so that a failed reload can restore them.
+	prev, prevLimits = pm.SetVerification(prev, prevLimits)
+	assert.NotNil(t, prev)
+	assert.Equal(t, limits, prevLimits)
+	assert.Nil(t, pm.verifier())
+	assert.Equal(t, Limits{}, pm.limits(noopPath))
+}
+
+type checkpointSource struct {
+	noopSource
+	checkpoint []byte
+}
+
+func (s *checkpointSource) Checkpoint(context.Context) ([]byte, error) { return s.checkpoint, nil }
+
+func (s *checkpointSource) Restore(_ context.Context, c []byte) error {
+	s.checkpoint = c
+	return nil
+}
+
+func TestRestartableSourceCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	r := newRestartableSource(&checkpointSource{})
+	require.NoError(t, r.Restore(ctx, []byte("restored")))
+	assert.Equal(t, []byte("restored"), r.lastCheckpoint())
+
+	// The last checkpoint is kept to restore it after a restart.
+	r.set(&checkpointSource{checkpoint: []byte("listed")})
+	c, err := r.Checkpoint(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("listed"), c)
+	assert.Equal(t, []byte("listed"), r.lastCheckpoint())
+
+	// Sources that are not Checkpointers have no checkpoint.
+	r = newRestartableSource(&noopSource{})
+	c, err = r.Checkpoint(ctx)
+	assert.NoError(t, err)
+	assert.Nil(t, c)
+	assert.NoError(t, r.Restore(ctx, []byte("ignored")))
+	assert.Nil(t, r.lastCheckpoint())
+}
@@ -2,12 +2,11 @@ package plugin
 
 import (
 	"context"
-	"errors"
 	"io"
 	"net/rpc"
 	"net/url"
 	"os"
-	"time"
+	"sync"
 
 	"github.com/hashicorp/go-hclog"
 	hplugin "github.com/hashicorp/go-plugin"
@@ -18,7 +17,9 @@ import (
 	"github.com/connylabs/ingest/storage"
 )
 
-const DefaultTimeOut = 5 * time.Second
+// The net/rpc implementation of the plugin protocol serves version PluginLegacyProtocolVersion,
+// so that ingest can run plugins that were built for earlier versions of ingest
+// and plugins can run with earlier versions of ingest.
 
 type pluginSourceRPCServer struct {
 	Impl Source
@@ -28,7 +29,6 @@ type pluginSourceRPCServer struct {
 	mb         *hplugin.MuxBroker
 	ctx        context.Context
 	configured bool
-	timeOut    time.Duration
 }
 
 func (s *pluginSourceRPCServer) Gather(c *any, resp *[]*dto.MetricFamily) error {
@@ -48,9 +48,6 @@ func (s *pluginSourceRPCServer) CleanUp(c *ingest.Codec, resp *any) error {
 }
 
 func (s *pluginSourceRPCServer) Configure(c *map[string]any, resp *any) error {
-	// override timeout from conf?
-	s.timeOut = DefaultTimeOut
-
 	if err := s.Impl.Configure(*c); err != nil {
 		return err
 	}
@@ -65,8 +62,12 @@ func (s *pluginSourceRPCServer) Download(c *ingest.Codec, resp *DownloadResponse
 		return ErrNotConfigured
 	}
 
-	obj, err := s.Impl.Download(s.ctx, *c)
+	// The context of the download is canceled when the object was copied or the connection was closed,
+	// e.g. because ingest gave up on the download, since net/rpc does not propagate the context of the caller.
+	ctx, cancel := context.WithCancel(s.ctx)
+	obj, err := s.Impl.Download(ctx, *c)
 	if err != nil {
+		cancel()
 		return err
 	}
 
@@ -78,12 +79,21 @@ func (s *pluginSourceRPCServer) Download(c *ingest.Codec, resp *DownloadResponse
 	}
 
 	go func() {
+		defer cancel()
 		con, err := s.mb.Accept(id)
 		if err != nil {
 			s.l.Error("failed to accept connection", "id", id, "error", err.Error())
 			return
 		}
 		defer con.Close()
+		if c, ok := obj.Reader.(io.Closer); ok {
+			defer c.Close()
+		}
+		// ingest never writes to the connection, but closes it when it gives up on the download.
+		go func() {
+			io.Copy(io.Discard, con) //nolint:errcheck
+			cancel()
+		}()
 
 		if _, err := io.Copy(con, obj.Reader); err != nil {
 			s.l.Error("failed copy from connection", "id", id, "error", err.Error())
@@ -116,8 +126,41 @@ func (s *pluginSourceRPCServer) Reset(args any, resp *any) error {
 	return s.Impl.Reset(s.ctx)
 }
 
+// Checkpoint returns the checkpoint of the source or nil if the source does not implement ingest.Checkpointer.
+func (s *pluginSourceRPCServer) Checkpoint(args any, resp *[]byte) error {
+	if !s.configured {
+		return ErrNotConfigured
+	}
+	cp, ok := s.Impl.(ingest.Checkpointer)
+	if !ok {
+		return nil
+	}
+	c, err := cp.Checkpoint(s.ctx)
+	if err != nil {
+		return err
+	}
+
+	*resp = c
+
+	return nil
+}
+
+// Restore is a no-op if the source does not implement ingest.Checkpointer.
+func (s *pluginSourceRPCServer) Restore(c *[]byte, resp *any) error {
+	if !s.configured {
+		return ErrNotConfigured
+	}
+	cp, ok := s.Impl.(ingest.Checkpointer)
+	if !ok {
+		return nil
+	}
+
+	return cp.Restore(s.ctx, *c)
+}
+
 var (
 	_ Source              = &pluginSourceRPC{}
+	_ ingest.Checkpointer = &pluginSourceRPC{}
 	_ prometheus.Gatherer = &pluginSourceRPC{}
 )
 
@@ -130,6 +173,10 @@ func (p *pluginSourceRPC) call(serviceMethod string, args any, reply any) (err e
 	return mapErrMsg(p.client.Call(serviceMethod, args, reply))
 }
 
+func (p *pluginSourceRPC) callContext(ctx context.Context, serviceMethod string, args any, reply any) error {
+	return mapErrMsg(callRPC(ctx, p.client, serviceMethod, args, reply))
+}
+
 func (c *pluginSourceRPC) Gather() (resp []*dto.MetricFamily, err error) {
 	err = c.call("Plugin.Gather", new(any), &resp)
 
@@ -149,7 +196,7 @@ func (c *pluginSourceRPC) Configure(conf map[string]any) error {
 
 func (c *pluginSourceRPC) Download(ctx context.Context, s ingest.Codec) (*ingest.Object, error) {
 	var resp DownloadResponse
-	if err := c.call("Plugin.Download", s, &resp); err != nil {
+	if err := c.callContext(ctx, "Plugin.Download", s, &resp); err != nil {
 		return nil, err
 	}
 	con, err := c.mb.Dial(resp.Reader)
@@ -159,16 +206,16 @@ func (c *pluginSourceRPC) Download(ctx context.Context, s ingest.Codec) (*ingest
 	obj := &ingest.Object{
 		MimeType: resp.MimeType,
 		Len:      resp.Len,
-		Reader:   con, // TODO: do we need to io.Copy here?
+		Reader:   &contextReader{ReadCloser: con, ctx: ctx, stop: closeOnDone(ctx, con)},
 	}
 
 	return obj, nil
 }
 
-func (c *pluginSourceRPC) Next(context.Context) (*ingest.Codec, error) {
+func (c *pluginSourceRPC) Next(ctx context.Context) (*ingest.Codec, error) {
 	var resp ingest.Codec
 
-	if err := mapErrMsg(c.call("Plugin.Next", new(any), &resp)); err != nil {
+	if err := c.callContext(ctx, "Plugin.Next", new(any), &resp); err != nil {
 		return nil, err
 	}
 
@@ -179,6 +226,19 @@ func (c *pluginSourceRPC) Reset(ctx context.Context) error {
 	return mapErrMsg(c.call("Plugin.Reset", new(any), new(any)))
 }
 
+func (c *pluginSourceRPC) Checkpoint(context.Context) ([]byte, error) {
+	var resp []byte
+	if err := c.call("Plugin.Checkpoint", new(any), &resp); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (c *pluginSourceRPC) Restore(ctx context.Context, cp []byte) error {
+	return c.call("Plugin.Restore", &cp, new(any))
+}
+
 type DownloadResponse struct {
 	MimeType string
 	Len      int64
@@ -193,11 +253,8 @@ type pluginDestinationRPCServer struct {
 	mb         *hplugin.MuxBroker
 	ctx        context.Context
 	configured bool
-	timeOut    time.Duration
 }
 
-var ErrNotConfigured = errors.New("not configured")
-
 func (s *pluginDestinationRPCServer) Gather(c *any, resp *[]*dto.MetricFamily) error {
 	m, err := s.g.Gather()
 
@@ -207,8 +264,6 @@ func (s *pluginDestinationRPCServer) Gather(c *any, resp *[]*dto.MetricFamily) e
 }
 
 func (s *pluginDestinationRPCServer) Configure(c *map[string]any, resp *any) error {
-	s.timeOut = DefaultTimeOut
-
 	if err := s.Impl.Configure(*c); err != nil {
 		return err
 	}
@@ -276,6 +331,14 @@ func (p *pluginDestinationRPC) call(serviceMethod string, args any, reply any) (
 	return
 }
 
+func (p *pluginDestinationRPC) callContext(ctx context.Context, serviceMethod string, args any, reply any) error {
+	err := callRPC(ctx, p.client, serviceMethod, args, reply)
+	if err != nil && err.Error() == ErrNotConfigured.Error() {
+		err = ErrNotConfigured
+	}
+	return err
+}
+
 func (c *pluginDestinationRPC) Gather() (resp []*dto.MetricFamily, err error) {
 	err = c.call("Plugin.Gather", new(any), &resp)
 
@@ -291,7 +354,7 @@ func (c *pluginDestinationRPC) Configure(conf map[string]any) error {
 
 func (c *pluginDestinationRPC) Stat(ctx context.Context, s ingest.Codec) (*storage.ObjectInfo, error) {
 	var resp storage.ObjectInfo
-	if err := c.call("Plugin.Stat", s, &resp); err != nil {
+	if err := c.callContext(ctx, "Plugin.Stat", s, &resp); err != nil {
 		if err.Error() == os.ErrNotExist.Error() {
 			err = os.ErrNotExist
 		}
@@ -321,17 +384,71 @@ func (c *pluginDestinationRPC) Store(ctx context.Context, s ingest.Codec, obj in
 			return
 		}
 		defer con.Close()
+		// Closing the connection aborts the upload in the plugin.
+		defer closeOnDone(ctx, con)()
 		if _, err := io.Copy(con, obj.Reader); err != nil {
 			return
 		}
 	}()
 
-	if err := c.call("Plugin.Store", req, &resp); err != nil {
+	if err := c.callContext(ctx, "Plugin.Store", req, &resp); err != nil {
 		return nil, err
 	}
 	return &resp, nil
 }
 
+// callRPC calls the method of a plugin and returns when the call is done or ctx is done.
+// net/rpc cannot propagate the context to the plugin, so the call continues in the plugin if ctx is done,
+// but its result is discarded.
+func callRPC(ctx context.Context, c *rpc.Client, serviceMethod string, args any, reply any) error {
+	call := c.Go(serviceMethod, args, reply, make(chan *rpc.Call, 1))
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-call.Done:
+		return call.Error
+	}
+}
+
+// closeOnDone closes c when ctx is done until stop is called.
+func closeOnDone(ctx context.Context, c io.Closer) (stop func()) {
+	done := make(chan struct{})
+	var once sync.Once
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.Close()
+		case <-done:
+		}
+	}()
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+// contextReader reads an object from a connection that is closed when ctx is done.
+type contextReader struct {
+	io.ReadCloser
+	ctx  context.Context
+	stop func()
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if err != nil {
+		if r.ctx.Err() != nil {
+			err = r.ctx.Err()
+		}
+		r.stop()
+	}
+	return n, err
+}
+
+func (r *contextReader) Close() error {
+	r.stop()
+	return r.ReadCloser.Close()
+}
+
 type StoreRequest struct {
 	C   ingest.Codec
 	Obj struct {
@@ -0,0 +1,97 @@
+package plugin
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	hplugin "github.com/hashicorp/go-plugin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/connylabs/ingest"
+)
+
+// blockingReader blocks until its context is done.
+type blockingReader struct {
+	ctx  context.Context
+	errs chan error
+}
+
+func (r *blockingReader) Read([]byte) (int, error) {
+	<-r.ctx.Done()
+	r.errs <- r.ctx.Err()
+	return 0, r.ctx.Err()
+}
+
+// blockingDownloadPlugin returns objects whose readers block until the context of the download is done.
+type blockingDownloadPlugin struct {
+	blockingPlugin
+}
+
+func (p *blockingDownloadPlugin) Download(ctx context.Context, _ ingest.Codec) (*ingest.Object, error) {
+	return &ingest.Object{Reader: &blockingReader{ctx: ctx, errs: p.errs}}, nil
+}
+
+func TestRPCContext(t *testing.T) {
+	p := &blockingDownloadPlugin{blockingPlugin{errs: make(chan error, 1)}}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	c, _ := hplugin.TestPluginRPCConn(t, map[string]hplugin.Plugin{
+		"source":      &rpcPluginSource{impl: p, g: prometheus.NewRegistry(), l: hclog.NewNullLogger(), ctx: ctx},
+		"destination": &rpcPluginDestination{impl: p, g: prometheus.NewRegistry(), l: hclog.NewNullLogger(), ctx: ctx},
+	}, nil)
+	t.Cleanup(func() { c.Close() })
+	raw, err := c.Dispense("source")
+	require.NoError(t, err)
+	src := raw.(Source)
+	require.NoError(t, src.Configure(nil))
+	raw, err = c.Dispense("destination")
+	require.NoError(t, err)
+	dst := raw.(Destination)
+	require.NoError(t, dst.Configure(nil))
+	codec := ingest.NewCodec("id", "name", nil)
+
+	// net/rpc cannot propagate contexts, but the calls return when the contexts of the callers are done.
+	timeout, cancelTimeout := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancelTimeout()
+	_, err = src.Next(timeout)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	_, err = dst.Stat(timeout, codec)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	// The calls continue in the plugin until the plugin stops.
+	cancel()
+	for i := 0; i < 2; i++ {
+		<-p.errs
+	}
+
+	// Giving up on a download aborts it in the plugin.
+	p.errs = make(chan error, 1)
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	c2, _ := hplugin.TestPluginRPCConn(t, map[string]hplugin.Plugin{
+		"source": &rpcPluginSource{impl: p, g: prometheus.NewRegistry(), l: hclog.NewNullLogger(), ctx: context.Background()},
+	}, nil)
+	t.Cleanup(func() { c2.Close() })
+	raw, err = c2.Dispense("source")
+	require.NoError(t, err)
+	src = raw.(Source)
+	require.NoError(t, src.Configure(nil))
+	obj, err := src.Download(ctx, codec)
+	require.NoError(t, err)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	_, err = io.ReadAll(obj.Reader)
+	assert.ErrorIs(t, err, context.Canceled)
+	select {
+	case err := <-p.errs:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the download was not aborted in the plugin")
+	}
+}
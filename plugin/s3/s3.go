@@ -0,0 +1,327 @@
+// Package s3 implements the s3 plugin, which copies objects from and to S3-compatible buckets.
+package s3
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/log"
+	"github.com/hashicorp/go-hclog"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/mitchellh/mapstructure"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/plugin"
+	"github.com/connylabs/ingest/storage"
+	s3storage "github.com/connylabs/ingest/storage/s3"
+)
+
+const defaultEndpoint = "s3.amazonaws.com"
+
+var (
+	//go:embed source.schema.json
+	sourceSchema []byte
+	//go:embed destination.schema.json
+	destinationSchema []byte
+)
+
+type destinationConfig struct {
+	sourceConfig    `mapstructure:",squash"`
+	MetafilesPrefix string
+	// StorageClass is the storage class of stored objects, e.g. STANDARD_IA, GLACIER or DEEP_ARCHIVE.
+	// It defaults to the default storage class of the bucket.
+	StorageClass string
+}
+
+// storageClasses are the storage classes that S3 accepts.
+var storageClasses = map[string]struct{}{
+	"STANDARD":            {},
+	"REDUCED_REDUNDANCY":  {},
+	"STANDARD_IA":         {},
+	"ONEZONE_IA":          {},
+	"INTELLIGENT_TIERING": {},
+	"GLACIER":             {},
+	"GLACIER_IR":          {},
+	"DEEP_ARCHIVE":        {},
+	"OUTPOSTS":            {},
+}
+
+type sourceConfig struct {
+	Endpoint        string
+	Insecure        bool
+	AccessKeyID     string `json:"accessKeyID"`
+	SecretAccessKey string
+	Bucket          string
+	Prefix          string
+	Recursive       bool
+	// Versions lists all versions of the objects in a versioned bucket instead of only the latest.
+	// One Codec is emitted per version and the version ID is appended to its name.
+	Versions bool
+}
+
+var (
+	_ plugin.Destination = &destination{}
+	_ plugin.Schemer     = &destination{}
+	_ storage.Copier     = &destination{}
+)
+
+type destination struct {
+	storage.Storage
+}
+
+// Schema returns the JSON schema of the configuration of the destination.
+func (d *destination) Schema() ([]byte, error) {
+	return destinationSchema, nil
+}
+
+func (d *destination) Configure(config map[string]interface{}) error {
+	dc := new(destinationConfig)
+	err := mapstructure.Decode(config, dc)
+	if err != nil {
+		return err
+	}
+	if dc.Endpoint == "" {
+		dc.Endpoint = defaultEndpoint
+	}
+	opts := []s3storage.Option{s3storage.WithEndpoint(dc.Endpoint)}
+	if dc.StorageClass != "" {
+		dc.StorageClass = strings.ToUpper(dc.StorageClass)
+		// S3-compatible services may support other storage classes,
+		// so only the endpoint of AWS is validated.
+		if _, ok := storageClasses[dc.StorageClass]; !ok && dc.Endpoint == defaultEndpoint {
+			return fmt.Errorf("unknown storage class %q", dc.StorageClass)
+		}
+		opts = append(opts, s3storage.WithStorageClass(dc.StorageClass))
+	}
+	mc, err := minio.New(dc.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(dc.AccessKeyID, dc.SecretAccessKey, ""),
+		Secure: !dc.Insecure,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create minio client:% w", err)
+	}
+
+	d.Storage = s3storage.New(dc.Bucket, dc.Prefix, dc.MetafilesPrefix, mc, log.NewNopLogger(), opts...)
+
+	return nil
+}
+
+// CopyFrom copies objects of sources on the same endpoint on the server side.
+func (d *destination) CopyFrom(ctx context.Context, element ingest.Codec, uri *url.URL) (*url.URL, error) {
+	return storage.CopyFrom(ctx, d.Storage, element, uri)
+}
+
+// Schema returns the JSON schema of the configuration of the source.
+func (s *source) Schema() ([]byte, error) {
+	return sourceSchema, nil
+}
+
+// Configure will configure the source with the values given by config.
+func (s *source) Configure(config map[string]interface{}) error {
+	sc := new(sourceConfig)
+	err := mapstructure.Decode(config, sc)
+	if err != nil {
+		return err
+	}
+	if sc.Endpoint == "" {
+		sc.Endpoint = defaultEndpoint
+	}
+	mc, err := minio.New(sc.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(sc.AccessKeyID, sc.SecretAccessKey, ""),
+		Secure: !sc.Insecure,
+	})
+	if err != nil {
+		return err
+	}
+	s.bucket = sc.Bucket
+	s.endpoint = sc.Endpoint
+	s.mc = mc
+	s.prefix = sc.Prefix
+	s.recursive = sc.Recursive
+	s.versions = sc.Versions
+
+	return nil
+}
+
+// meta is stored in the Meta field of a Codec of an object version.
+type meta struct {
+	Key       string `json:"key"`
+	VersionID string `json:"versionID"`
+}
+
+// An Element is pushed and popped from the queue.
+type Element struct {
+	bucket    string
+	prefix    string
+	name      string
+	versionID string
+}
+
+// ID returns a unique ID for the Element.
+func (e Element) ID() string {
+	if e.versionID != "" {
+		return path.Join(e.prefix, e.name) + "?versionId=" + e.versionID
+	}
+	return path.Join(e.prefix, e.name)
+}
+
+// Name returns the name to use when storing the Element.
+func (e Element) Name() string {
+	if e.versionID != "" {
+		return e.name + "@" + e.versionID
+	}
+	return e.name
+}
+
+// Meta returns the metadata of the Element.
+func (e Element) Meta() ([]byte, error) {
+	if e.versionID == "" {
+		return nil, nil
+	}
+	return json.Marshal(meta{Key: path.Join(e.prefix, e.name), VersionID: e.versionID})
+}
+
+// source can fetch elements from the S3 API.
+type source struct {
+	mu sync.Mutex
+	// TODO: instrument later
+	mc        *minio.Client
+	c         <-chan minio.ObjectInfo
+	bucket    string
+	endpoint  string
+	prefix    string
+	recursive bool
+	versions  bool
+}
+
+// Reset resets the Nexter as if it was newly created.
+func (s *source) Reset(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.c = s.mc.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix:       s.prefix,
+		Recursive:    s.recursive,
+		WithVersions: s.versions,
+	})
+
+	return nil
+}
+
+// Next ignores the context in this implementation
+func (s *source) Next(_ context.Context) (*ingest.Codec, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for oi := range s.c {
+		if oi.Err != nil {
+			return nil, oi.Err
+		}
+		if oi.IsDeleteMarker {
+			continue
+		}
+		e := Element{
+			bucket: s.bucket,
+			prefix: s.prefix,
+			name:   strings.TrimPrefix(oi.Key, s.prefix),
+		}
+		if s.versions {
+			e.versionID = oi.VersionID
+		}
+		m, err := e.Meta()
+		if err != nil {
+			return nil, err
+		}
+		c := ingest.NewCodec(e.ID(), e.Name(), m)
+		c.Size, c.MimeType, c.Hash = oi.Size, oi.ContentType, oi.ETag
+		if !oi.LastModified.IsZero() {
+			lm := oi.LastModified
+			c.LastModified = &lm
+		}
+		return &c, nil
+	}
+
+	return nil, io.EOF
+}
+
+func (s *source) CleanUp(ctx context.Context, i ingest.Codec) error {
+	key, versionID, err := parse(i)
+	if err != nil {
+		return err
+	}
+	return s.mc.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{VersionID: versionID})
+}
+
+// Locate returns the URI of the object on the endpoint of the source,
+// so that destinations on the same endpoint can copy it on the server side.
+func (s *source) Locate(_ context.Context, i ingest.Codec) (*url.URL, error) {
+	key, versionID, err := parse(i)
+	if err != nil {
+		return nil, err
+	}
+	q := url.Values{"endpoint": {s.endpoint}}
+	if versionID != "" {
+		q.Set("versionId", versionID)
+	}
+	return &url.URL{Scheme: "s3", Host: s.bucket, Path: "/" + key, RawQuery: q.Encode()}, nil
+}
+
+// Download will take an Element and download it from S3
+func (s *source) Download(ctx context.Context, i ingest.Codec) (*ingest.Object, error) {
+	key, versionID, err := parse(i)
+	if err != nil {
+		return nil, err
+	}
+	o, err := s.mc.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{VersionID: versionID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object: %w", err)
+	}
+	stat, err := o.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stat: %w", err)
+	}
+
+	return &ingest.Object{
+		Reader:   o,
+		Len:      stat.Size,
+		MimeType: stat.ContentType,
+	}, nil
+}
+
+// parse returns the key and the optional version ID of the object that a Codec refers to.
+func parse(i ingest.Codec) (string, string, error) {
+	if len(i.Meta) == 0 {
+		return i.ID, "", nil
+	}
+	var m meta
+	if err := json.Unmarshal(i.Meta, &m); err != nil {
+		return "", "", fmt.Errorf("failed to unmarshal meta: %w", err)
+	}
+	return m.Key, m.VersionID, nil
+}
+
+func init() {
+	plugin.RegisterBuiltin("s3", plugin.Builtin{
+		NewSource:      func(hclog.Logger, prometheus.Registerer) plugin.Source { return NewSource() },
+		NewDestination: func(hclog.Logger, prometheus.Registerer) plugin.Destination { return NewDestination() },
+	})
+}
+
+// NewSource returns a source that must be configured before it is used.
+func NewSource() plugin.Source {
+	return &source{}
+}
+
+// NewDestination returns a destination that must be configured before it is used.
+func NewDestination() plugin.Destination {
+	return &destination{}
+}
@@ -0,0 +1,108 @@
+package plugin
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"go/format"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+//go:embed scaffold
+var scaffoldFS embed.FS
+
+// pluginNamePattern matches the names of plugin files that can be used as the type of sources and destinations.
+var pluginNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// A Scaffold describes the Go module of a new plugin.
+type Scaffold struct {
+	// Name is the name of the plugin file, with which sources and destinations select the plugin.
+	Name string
+	// Module is the path of the module, e.g. github.com/example/ingest-plugin-foo.
+	Module string
+	// Version is the version of ingest that the module requires, e.g. v0.5.0.
+	// If it is empty, go mod tidy adds the latest version.
+	Version string
+}
+
+// Validate returns an error if the name or the module path cannot be used.
+func (s *Scaffold) Validate() error {
+	if !pluginNamePattern.MatchString(s.Name) {
+		return fmt.Errorf("plugin name %q must consist of lower case letters, digits, dashes and underscores", s.Name)
+	}
+	if err := module.CheckPath(s.Module); err != nil {
+		return err
+	}
+	if s.Version != "" && !semver.IsValid(s.Version) {
+		return fmt.Errorf("ingest version %q must be a semantic version, e.g. v0.5.0", s.Version)
+	}
+	return nil
+}
+
+// Write writes the module to dir, which is created if it does not exist.
+// The module contains stubs of a source and a destination, the struct and the JSON schema of their configuration,
+// a Makefile that builds the plugin file and tests that run the conformance suite of the plugintest package against the stubs.
+// Write fails if any of the files already exists, so that it never overwrites the work of plugin authors.
+// It returns the paths of the files that it wrote.
+func (s *Scaffold) Write(dir string) ([]string, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	var paths []string
+	err := fs.WalkDir(scaffoldFS, "scaffold", func(p string, e fs.DirEntry, err error) error {
+		if err != nil || e.IsDir() {
+			return err
+		}
+		buf, err := s.render(p)
+		if err != nil {
+			return err
+		}
+		name := filepath.Join(dir, strings.TrimSuffix(path.Base(p), ".tmpl"))
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			if errors.Is(err, fs.ErrExist) {
+				return fmt.Errorf("%q already exists", name)
+			}
+			return err
+		}
+		if _, err := f.Write(buf); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		paths = append(paths, name)
+		return nil
+	})
+	return paths, err
+}
+
+// render executes the template at p and formats Go files.
+func (s *Scaffold) render(p string) ([]byte, error) {
+	t, err := template.ParseFS(scaffoldFS, p)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, s); err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(p, ".go.tmpl") {
+		return format.Source(buf.Bytes())
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,59 @@
+package plugin
+
+import (
+	"go/format"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScaffold(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "foo")
+	s := &Scaffold{Name: "foo", Module: "github.com/example/ingest-plugin-foo", Version: "v0.5.0"}
+	paths, err := s.Write(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, p := range paths {
+		names = append(names, filepath.Base(p))
+	}
+	assert.ElementsMatch(t, []string{"Makefile", "config.go", "config.schema.json", "destination.go", "go.mod", "main.go", "main_test.go", "source.go"}, names)
+
+	buf, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+	require.NoError(t, err)
+	assert.Equal(t, "module github.com/example/ingest-plugin-foo\n\ngo 1.18\n\nrequire github.com/connylabs/ingest v0.5.0\n", string(buf))
+	buf, err = os.ReadFile(filepath.Join(dir, "Makefile"))
+	require.NoError(t, err)
+	assert.Contains(t, string(buf), "PLUGIN := $(BIN_DIR)/foo\n")
+	for _, p := range paths {
+		if !strings.HasSuffix(p, ".go") {
+			continue
+		}
+		buf, err := os.ReadFile(p)
+		require.NoError(t, err)
+		formatted, err := format.Source(buf)
+		require.NoError(t, err, p)
+		assert.Equal(t, string(formatted), string(buf), p)
+	}
+
+	// Existing files are not overwritten.
+	_, err = s.Write(dir)
+	assert.ErrorContains(t, err, "already exists")
+
+	// Without a version, go mod tidy adds the latest version of ingest.
+	s.Version = ""
+	_, err = s.Write(filepath.Join(t.TempDir(), "foo"))
+	require.NoError(t, err)
+
+	for _, s := range []Scaffold{
+		{Name: "Foo", Module: "github.com/example/foo"},
+		{Name: "../foo", Module: "github.com/example/foo"},
+		{Name: "foo", Module: "github.com/example/foo bar"},
+		{Name: "foo", Module: "github.com/example/foo", Version: "latest"},
+	} {
+		assert.Error(t, s.Validate(), s)
+	}
+}
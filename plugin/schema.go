@@ -0,0 +1,238 @@
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// schemaURL is the URL under which the schema of a plugin is compiled.
+const schemaURL = "plugin.schema.json"
+
+// A Schemer describes the configuration of a plugin with a JSON schema.
+// The PluginManager validates the configuration of plugins that implement Schemer
+// against the schema before it configures them.
+type Schemer interface {
+	// Schema returns the JSON schema of the configuration.
+	// It is called before the plugin is configured and returns nil if the plugin has no schema.
+	Schema() ([]byte, error)
+}
+
+// validateConfig validates the configuration of a plugin against its JSON schema.
+// Fields are matched case-insensitively against the properties of the schema,
+// because plugins decode their configuration with mapstructure, which ignores the case of fields.
+// The errors name the fields that fail the validation, e.g. unknown field "secertAccessKey".
+func validateConfig(schema []byte, config map[string]any) error {
+	if len(bytes.TrimSpace(schema)) == 0 {
+		return nil
+	}
+	var raw struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	if err := json.Unmarshal(schema, &raw); err != nil {
+		return fmt.Errorf("invalid plugin schema: %w", err)
+	}
+	c := jsonschema.NewCompiler()
+	c.AssertFormat = true
+	// Schemas must be self-contained, so that plugins cannot make ingest fetch documents.
+	c.LoadURL = func(s string) (io.ReadCloser, error) {
+		return nil, fmt.Errorf("cannot load %q: plugin schemas must not reference other documents", s)
+	}
+	if err := c.AddResource(schemaURL, bytes.NewReader(schema)); err != nil {
+		return fmt.Errorf("invalid plugin schema: %w", err)
+	}
+	s, err := c.Compile(schemaURL)
+	if err != nil {
+		return fmt.Errorf("invalid plugin schema: %w", err)
+	}
+
+	properties := make([]string, 0, len(raw.Properties))
+	for p := range raw.Properties {
+		properties = append(properties, p)
+	}
+	sort.Strings(properties)
+	// Convert the configuration to the types of encoding/json and match the fields to the properties.
+	buf, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	d := json.NewDecoder(bytes.NewReader(buf))
+	d.UseNumber()
+	var v map[string]any
+	if err := d.Decode(&v); err != nil {
+		return err
+	}
+	for k, val := range v {
+		if _, ok := raw.Properties[k]; ok {
+			continue
+		}
+		for _, p := range properties {
+			if _, ok := v[p]; !ok && strings.EqualFold(k, p) {
+				delete(v, k)
+				v[p] = val
+				break
+			}
+		}
+	}
+	if v == nil {
+		v = make(map[string]any)
+	}
+
+	err = s.Validate(v)
+	var ve *jsonschema.ValidationError
+	if !errors.As(err, &ve) {
+		return err
+	}
+	var msgs []string
+	for _, l := range leaves(ve) {
+		msgs = append(msgs, describe(l, v, properties)...)
+	}
+	sort.Strings(msgs)
+	return fmt.Errorf("invalid configuration: %s", strings.Join(msgs, "; "))
+}
+
+// leaves returns the validation errors without causes.
+func leaves(ve *jsonschema.ValidationError) []*jsonschema.ValidationError {
+	if len(ve.Causes) == 0 {
+		return []*jsonschema.ValidationError{ve}
+	}
+	var ls []*jsonschema.ValidationError
+	for _, c := range ve.Causes {
+		ls = append(ls, leaves(c)...)
+	}
+	return ls
+}
+
+// describe turns a validation error into messages that name the fields of the configuration.
+// Unknown fields at the top level come with the most similar property of the schema, if any.
+func describe(ve *jsonschema.ValidationError, config map[string]any, properties []string) []string {
+	path := fieldPath(ve.InstanceLocation)
+	if !strings.HasSuffix(ve.KeywordLocation, "/additionalProperties") {
+		if path == "" {
+			return []string{ve.Message}
+		}
+		return []string{fmt.Sprintf("field %q: %s", path, ve.Message)}
+	}
+	obj, ok := instance(config, ve.InstanceLocation).(map[string]any)
+	if !ok {
+		return []string{ve.Message}
+	}
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		// The message quotes the names of the unknown fields.
+		if strings.Contains(ve.Message, "'"+k+"'") {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	msgs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		name := k
+		if path != "" {
+			name = path + "." + k
+		}
+		if s := similar(k, properties); path == "" && s != "" {
+			msgs = append(msgs, fmt.Sprintf("unknown field %q, did you mean %q?", name, s))
+			continue
+		}
+		msgs = append(msgs, fmt.Sprintf("unknown field %q", name))
+	}
+	return msgs
+}
+
+// fieldPath converts a JSON pointer like /tls/certificates/0 to a path like tls.certificates[0].
+func fieldPath(pointer string) string {
+	var b strings.Builder
+	for _, t := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		if t == "" {
+			continue
+		}
+		t = strings.NewReplacer("~1", "/", "~0", "~").Replace(t)
+		if _, err := strconv.Atoi(t); err == nil {
+			fmt.Fprintf(&b, "[%s]", t)
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(t)
+	}
+	return b.String()
+}
+
+// instance returns the value at the JSON pointer in v.
+func instance(v any, pointer string) any {
+	for _, t := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		if t == "" {
+			continue
+		}
+		t = strings.NewReplacer("~1", "/", "~0", "~").Replace(t)
+		switch vv := v.(type) {
+		case map[string]any:
+			v = vv[t]
+		case []any:
+			i, err := strconv.Atoi(t)
+			if err != nil || i < 0 || i >= len(vv) {
+				return nil
+			}
+			v = vv[i]
+		default:
+			return nil
+		}
+	}
+	return v
+}
+
+// similar returns the property that is most similar to the field, e.g. secretAccessKey for secertAccessKey,
+// or an empty string if no property is similar enough to be a likely typo.
+func similar(field string, properties []string) string {
+	var best string
+	limit := len(field)/3 + 1
+	for _, p := range properties {
+		if d := distance(strings.ToLower(field), strings.ToLower(p)); d < limit {
+			best, limit = p, d
+		}
+	}
+	return best
+}
+
+// distance returns the Damerau-Levenshtein distance of a and b, which counts swapped letters as one edit.
+func distance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = minInt(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = minInt(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
+
+func minInt(v int, vs ...int) int {
+	for _, w := range vs {
+		if w < v {
+			v = w
+		}
+	}
+	return v
+}
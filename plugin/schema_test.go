@@ -0,0 +1,123 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSchema = `{
+  "type": "object",
+  "additionalProperties": false,
+  "properties": {
+    "accessKeyID": {"type": "string"},
+    "secretAccessKey": {"type": "string"},
+    "insecure": {"type": "boolean"},
+    "tls": {
+      "type": "object",
+      "additionalProperties": false,
+      "properties": {"ca": {"type": "string"}}
+    },
+    "hosts": {"type": "array", "items": {"type": "string"}}
+  }
+}`
+
+func TestValidateConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		schema string
+		config map[string]any
+		err    string
+	}{
+		{
+			name:   "valid",
+			schema: testSchema,
+			config: map[string]any{"accessKeyID": "key", "insecure": true, "tls": map[string]any{"ca": "ca.pem"}, "hosts": []any{"a", "b"}},
+		},
+		{
+			name:   "no schema",
+			config: map[string]any{"anything": 1},
+		},
+		{
+			name:   "empty configuration",
+			schema: testSchema,
+		},
+		{
+			name:   "case-insensitive fields",
+			schema: testSchema,
+			config: map[string]any{"accessKeyId": "key", "SecretAccessKey": "secret"},
+		},
+		{
+			name:   "unknown field",
+			schema: testSchema,
+			config: map[string]any{"secertAccessKey": "secret"},
+			err:    `invalid configuration: unknown field "secertAccessKey", did you mean "secretAccessKey"?`,
+		},
+		{
+			name:   "unknown fields",
+			schema: testSchema,
+			config: map[string]any{"foo": "bar", "insecur": true},
+			err:    `invalid configuration: unknown field "foo"; unknown field "insecur", did you mean "insecure"?`,
+		},
+		{
+			name:   "unknown nested field",
+			schema: testSchema,
+			config: map[string]any{"tls": map[string]any{"cert": "cert.pem"}},
+			err:    `invalid configuration: unknown field "tls.cert"`,
+		},
+		{
+			name:   "wrong type",
+			schema: testSchema,
+			config: map[string]any{"insecure": "yes", "hosts": []any{"a", 1}},
+			err:    `invalid configuration: field "hosts[1]": expected string, but got number; field "insecure": expected boolean, but got string`,
+		},
+		{
+			name:   "invalid schema",
+			schema: `{"type": 1}`,
+			err:    "invalid plugin schema",
+		},
+		{
+			name:   "remote reference",
+			schema: `{"$ref": "https://example.com/schema.json"}`,
+			err:    "must not reference other documents",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateConfig([]byte(tc.schema), tc.config)
+			if tc.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.err)
+		})
+	}
+}
+
+// schemaSource is a noop source with a schema.
+type schemaSource struct {
+	Source
+}
+
+func (s *schemaSource) Schema() ([]byte, error) {
+	return []byte(testSchema), nil
+}
+
+func TestPluginManagerSchema(t *testing.T) {
+	RegisterBuiltin("test-schema", Builtin{
+		NewSource: func(l hclog.Logger, _ prometheus.Registerer) Source { return &schemaSource{Source: NewNoopSource(l)} },
+	})
+	path, ok := BuiltinPath("test-schema")
+	require.True(t, ok)
+	pm := NewPluginManager(0, nil)
+	t.Cleanup(pm.Stop)
+
+	_, err := pm.NewSource(path, map[string]any{"secertAccessKey": "secret"}, prometheus.Labels{})
+	assert.EqualError(t, err, `invalid configuration: unknown field "secertAccessKey", did you mean "secretAccessKey"?`)
+	s, err := pm.NewSource(path, map[string]any{"secretAccessKey": "secret"}, prometheus.Labels{})
+	require.NoError(t, err)
+	pm.Kill(s)
+}
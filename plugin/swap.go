@@ -0,0 +1,210 @@
+package plugin
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log/level"
+
+	"github.com/connylabs/ingest"
+)
+
+// swapDrainTimeout is the maximum duration for which the calls to a swapped plugin may run
+// before its process is killed, e.g. a download of a large object.
+const swapDrainTimeout = time.Hour
+
+// pluginFile is the plugin file that a process was started from.
+type pluginFile struct {
+	path string
+	// info is the last seen state of the file, which is only hashed again when the state changes.
+	info os.FileInfo
+	sum  string
+	// failed is the checksum of a replacing file that could not be started, which is not tried again.
+	failed string
+}
+
+// newPluginFile hashes the plugin file at path.
+func newPluginFile(path string) (*pluginFile, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	sum, err := hashFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &pluginFile{path: path, info: info, sum: sum}, nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// replaced returns the checksum of the plugin file if it was replaced since the process was started.
+// Files that cannot be read, e.g. while they are being replaced, are checked again later.
+// It is only called by Watch, which checks every process at most once at a time.
+func (f *pluginFile) replaced() (string, bool) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return "", false
+	}
+	if os.SameFile(info, f.info) && info.ModTime().Equal(f.info.ModTime()) && info.Size() == f.info.Size() {
+		return "", false
+	}
+	sum, err := hashFile(f.path)
+	if err != nil {
+		return "", false
+	}
+	f.info = info
+	if sum == f.sum || sum == f.failed {
+		return "", false
+	}
+	return sum, true
+}
+
+// swap replaces the process of a plugin whose file was replaced with the process that start returns.
+// Unlike a restart, the old process keeps serving the calls that started before the swap
+// and is only killed once they ended. If the new process cannot be started, then the old process
+// keeps running and the file is not tried again until it changes.
+func (pm *PluginManager) swap(old *process, path, mode, sum string, start func() (*process, func() *sync.WaitGroup, error)) {
+	level.Info(pm.l).Log("msg", "plugin file was replaced; swapping plugin", "path", path, "mode", mode, "sha256", sum)
+	c, commit, err := start()
+	if err != nil {
+		pm.m.Lock()
+		old.file.failed = sum
+		pm.m.Unlock()
+		level.Error(pm.l).Log("msg", "failed to swap plugin; the running plugin is kept", "path", path, "mode", mode, "sha256", sum, "err", err.Error())
+		return
+	}
+
+	pm.m.Lock()
+	replaced := pm.replace(old, c)
+	var active *sync.WaitGroup
+	if replaced {
+		active = commit()
+		pm.draining = append(pm.draining, old)
+	}
+	pm.m.Unlock()
+	if !replaced {
+		// The plugin was killed in the meantime.
+		c.Kill()
+		return
+	}
+	level.Info(pm.l).Log("msg", "swapped plugin", "path", path, "mode", mode, "sha256", sum)
+	go pm.drain(old, active, path, mode)
+}
+
+// drain kills the process of a swapped plugin once the calls to it ended or after swapDrainTimeout.
+func (pm *PluginManager) drain(old *process, active *sync.WaitGroup, path, mode string) {
+	done := make(chan struct{})
+	go func() {
+		active.Wait()
+		close(done)
+	}()
+	t := time.NewTimer(swapDrainTimeout)
+	defer t.Stop()
+	select {
+	case <-done:
+	case <-t.C:
+		level.Warn(pm.l).Log("msg", "calls to swapped plugin did not end; killing it", "path", path, "mode", mode, "timeout", swapDrainTimeout)
+	}
+	old.Kill()
+
+	pm.m.Lock()
+	defer pm.m.Unlock()
+	for i := range pm.draining {
+		if pm.draining[i] == old {
+			pm.draining = append(pm.draining[:i], pm.draining[i+1:]...)
+			break
+		}
+	}
+}
+
+// swapSource starts the replaced plugin file of a source, configures it and restores the current checkpoint
+// of the source, so that the workflows of the source continue with the new plugin.
+func (pm *PluginManager) swapSource(ctx context.Context, w withClient[Source], sum string) {
+	t, ok := w.t.(*timeoutSource)
+	if !ok {
+		return
+	}
+	r, ok := t.Source.(*restartableSource)
+	if !ok {
+		return
+	}
+	pm.swap(w.c, w.path, "source", sum, func() (*process, func() *sync.WaitGroup, error) {
+		resolved, err := pm.resolve(w.config)
+		if err != nil {
+			return nil, nil, err
+		}
+		c, s, err := pm.startSource(pm.verifier(), pm.limits(w.path), w.path, resolved, t.timeouts.Configure)
+		if err != nil {
+			if isConfigureTimeout(err) {
+				t.metrics.total.WithLabelValues("configure").Inc()
+			}
+			return nil, nil, err
+		}
+		if cp, ok := s.(ingest.Checkpointer); ok {
+			// Take the checkpoint from the running plugin, so that the listing continues where it is.
+			checkpoint, err := r.Checkpoint(ctx)
+			if err != nil {
+				checkpoint = r.lastCheckpoint()
+			}
+			if checkpoint != nil {
+				if err := cp.Restore(ctx, checkpoint); err != nil {
+					c.Kill()
+					return nil, nil, fmt.Errorf("failed to restore checkpoint: %w", err)
+				}
+			}
+		}
+		return c, func() *sync.WaitGroup { return r.set(s) }, nil
+	})
+}
+
+// swapDestination starts the replaced plugin file of a destination and configures it.
+func (pm *PluginManager) swapDestination(w withClient[Destination], sum string) {
+	t, ok := w.t.(*timeoutDestination)
+	if !ok {
+		return
+	}
+	r, ok := t.Destination.(*restartableDestination)
+	if !ok {
+		return
+	}
+	pm.swap(w.c, w.path, "destination", sum, func() (*process, func() *sync.WaitGroup, error) {
+		resolved, err := pm.resolve(w.config)
+		if err != nil {
+			return nil, nil, err
+		}
+		c, d, err := pm.startDestination(pm.verifier(), pm.limits(w.path), w.path, resolved, t.timeouts.Configure)
+		if err != nil {
+			if isConfigureTimeout(err) {
+				t.metrics.total.WithLabelValues("configure").Inc()
+			}
+			return nil, nil, err
+		}
+		return c, func() *sync.WaitGroup { return r.set(d) }, nil
+	})
+}
+
+// fileReplaced returns the checksum of the plugin file of a process if the file was replaced since the process was started.
+func fileReplaced(c *process) (string, bool) {
+	if c.file == nil {
+		return "", false
+	}
+	return c.file.replaced()
+}
@@ -0,0 +1,93 @@
+package plugin
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// replaceFile atomically replaces the file at path with the given content, like an upgrade of a plugin.
+func replaceFile(t *testing.T, path string, content []byte) {
+	tmp := path + ".tmp"
+	require.NoError(t, os.WriteFile(tmp, content, 0o755))
+	require.NoError(t, os.Rename(tmp, path))
+}
+
+func TestPluginManagerHotSwap(t *testing.T) {
+	noop, err := os.ReadFile(noopPath)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "noop")
+	require.NoError(t, os.WriteFile(path, noop, 0o755))
+
+	pm := NewPluginManager(time.Millisecond, nil)
+	pm.HotSwap = true
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		pm.Stop()
+	})
+
+	s, err := pm.NewSource(path, nil, nil)
+	require.NoError(t, err)
+	d, err := pm.NewDestination(path, nil, nil)
+	require.NoError(t, err)
+	oldSource, oldDestination := pm.sources[0].c, pm.destinations[0].c
+	require.NoError(t, s.Reset(ctx))
+	c, err := s.Next(ctx)
+	require.NoError(t, err)
+	// The download is in flight while the plugin is swapped.
+	obj, err := s.Download(ctx, *c)
+	require.NoError(t, err)
+
+	done := make(chan error)
+	go func() {
+		done <- pm.Watch(ctx)
+	}()
+	// Files that are touched but not changed are not swapped.
+	now := time.Now().Add(time.Second)
+	require.NoError(t, os.Chtimes(path, now, now))
+	time.Sleep(50 * time.Millisecond)
+	pm.m.Lock()
+	assert.Equal(t, oldSource, pm.sources[0].c)
+	pm.m.Unlock()
+
+	// Trailing bytes change the checksum without changing the plugin.
+	replaceFile(t, path, append(noop, 0))
+	assert.Eventually(t, func() bool {
+		pm.m.Lock()
+		defer pm.m.Unlock()
+		return pm.sources[0].c != oldSource && pm.destinations[0].c != oldDestination
+	}, 10*time.Second, time.Millisecond)
+	_, err = d.Stat(ctx, defaultCodec)
+	assert.NoError(t, err)
+
+	// The swapped source keeps serving the download until it ends and is killed afterwards.
+	assert.False(t, oldSource.Exited())
+	buf, err := io.ReadAll(obj.Reader)
+	require.NoError(t, err)
+	assert.Equal(t, defaultObjContent, string(buf))
+	assert.Eventually(t, oldSource.Exited, 5*time.Second, time.Millisecond)
+	assert.Eventually(t, oldDestination.Exited, 5*time.Second, time.Millisecond)
+
+	// Files that cannot be started are not swapped and not tried again until they change.
+	current := pm.sources[0].c
+	replaceFile(t, path, []byte("#!/bin/sh\nexit 1\n"))
+	assert.Eventually(t, func() bool {
+		pm.m.Lock()
+		defer pm.m.Unlock()
+		return pm.sources[0].c.file.failed != ""
+	}, 10*time.Second, time.Millisecond)
+	pm.m.Lock()
+	assert.Equal(t, current, pm.sources[0].c)
+	pm.m.Unlock()
+	assert.NoError(t, s.Reset(ctx))
+
+	cancel()
+	assert.NoError(t, <-done)
+}
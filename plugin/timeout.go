@@ -0,0 +1,367 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/storage"
+)
+
+// The default timeouts of the calls to sources and destinations.
+// Downloads and stores include the transfer of the content of the object, so their timeouts are long.
+const (
+	DefaultConfigureTimeout = time.Minute
+	DefaultNextTimeout      = time.Minute
+	DefaultDownloadTimeout  = time.Hour
+	DefaultStoreTimeout     = time.Hour
+)
+
+// Timeouts limit the duration of the calls to a source or destination.
+// A call that exceeds its timeout fails with an error that wraps context.DeadlineExceeded.
+// Zero durations are replaced with the defaults.
+type Timeouts struct {
+	// Configure limits the configuration of the plugin, also when it is restarted.
+	Configure time.Duration
+	// Next limits every call to Next of a source.
+	Next time.Duration
+	// Download limits the download of an object from a source, including reading its content.
+	Download time.Duration
+	// Store limits the storage of an object in a destination, including reading its content.
+	Store time.Duration
+}
+
+// withDefaults returns the timeouts with the defaults instead of zero durations.
+func (t Timeouts) withDefaults() Timeouts {
+	if t.Configure <= 0 {
+		t.Configure = DefaultConfigureTimeout
+	}
+	if t.Next <= 0 {
+		t.Next = DefaultNextTimeout
+	}
+	if t.Download <= 0 {
+		t.Download = DefaultDownloadTimeout
+	}
+	if t.Store <= 0 {
+		t.Store = DefaultStoreTimeout
+	}
+	return t
+}
+
+// configure configures a source or destination and gives up after timeout.
+// The configuration continues in the background then, so the caller must stop the plugin.
+func configure(p interface{ Configure(map[string]any) error }, config map[string]any, timeout time.Duration) error {
+	errc := make(chan error, 1)
+	go func() {
+		errc <- p.Configure(config)
+	}()
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case err := <-errc:
+		return err
+	case <-t.C:
+		return &timeoutError{call: "configure", timeout: timeout}
+	}
+}
+
+// timeoutError is returned by calls that exceeded their timeouts.
+// It wraps context.DeadlineExceeded.
+type timeoutError struct {
+	call    string
+	timeout time.Duration
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("%s timed out after %s", e.call, e.timeout)
+}
+
+func (e *timeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// isConfigureTimeout returns true if the configuration of a plugin exceeded its timeout.
+func isConfigureTimeout(err error) bool {
+	var te *timeoutError
+	return errors.As(err, &te) && te.call == "configure"
+}
+
+// exceeded returns true if ctx, which was derived from parent, is done because its own deadline passed.
+func exceeded(parent, ctx context.Context) bool {
+	return ctx.Err() == context.DeadlineExceeded && parent.Err() == nil
+}
+
+// timeoutMetrics count the calls to a source or destination that exceeded their timeouts.
+type timeoutMetrics struct {
+	r     *prometheus.Registry
+	total *prometheus.CounterVec
+}
+
+// newTimeoutMetrics returns the metrics of the given calls, which are initialized with zero.
+func newTimeoutMetrics(calls ...string) *timeoutMetrics {
+	t := &timeoutMetrics{
+		r: prometheus.NewRegistry(),
+		total: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "ingest_plugin_timeouts_total",
+			Help: "Number of calls to the plugin that exceeded their timeouts.",
+		}, []string{"call"}),
+	}
+	for _, c := range calls {
+		t.total.WithLabelValues(c)
+	}
+	t.r.MustRegister(t.total)
+	return t
+}
+
+// gather appends the timeout metrics to the metric families of a plugin.
+func (t *timeoutMetrics) gather(g any) ([]*dto.MetricFamily, error) {
+	var mfs []*dto.MetricFamily
+	if g, ok := g.(prometheus.Gatherer); ok {
+		var err error
+		if mfs, err = g.Gather(); err != nil {
+			return nil, err
+		}
+	}
+	tmfs, err := t.r.Gather()
+	if err != nil {
+		return nil, err
+	}
+	return append(mfs, tmfs...), nil
+}
+
+// timedOut counts a call that exceeded its timeout and returns an error that says so.
+func (t *timeoutMetrics) timedOut(call string, timeout time.Duration) error {
+	t.total.WithLabelValues(call).Inc()
+	return &timeoutError{call: call, timeout: timeout}
+}
+
+var (
+	_ Source              = &timeoutSource{}
+	_ ingest.BatchNexter  = &timeoutSource{}
+	_ ingest.Checkpointer = &timeoutSource{}
+	_ ingest.Locator      = &timeoutSource{}
+	_ prometheus.Gatherer = &timeoutSource{}
+	_ HealthChecker       = &timeoutSource{}
+)
+
+// timeoutSource is the source that the PluginManager returns.
+// It applies the timeouts of the source to the calls of the wrapped source.
+type timeoutSource struct {
+	Source
+	timeouts Timeouts
+	metrics  *timeoutMetrics
+}
+
+func newTimeoutSource(s Source, t Timeouts) *timeoutSource {
+	return &timeoutSource{Source: s, timeouts: t, metrics: newTimeoutMetrics("configure", "next", "download")}
+}
+
+func (s *timeoutSource) Gather() ([]*dto.MetricFamily, error) {
+	return s.metrics.gather(s.Source)
+}
+
+func (s *timeoutSource) Health(ctx context.Context) (Health, error) {
+	if hc, ok := s.Source.(HealthChecker); ok {
+		return hc.Health(ctx)
+	}
+	return Health{}, nil
+}
+
+func (s *timeoutSource) Checkpoint(ctx context.Context) ([]byte, error) {
+	if cp, ok := s.Source.(ingest.Checkpointer); ok {
+		return cp.Checkpoint(ctx)
+	}
+	return nil, nil
+}
+
+func (s *timeoutSource) Restore(ctx context.Context, c []byte) error {
+	if cp, ok := s.Source.(ingest.Checkpointer); ok {
+		return cp.Restore(ctx, c)
+	}
+	return nil
+}
+
+func (s *timeoutSource) Configure(config map[string]any) error {
+	err := configure(s.Source, config, s.timeouts.Configure)
+	if isConfigureTimeout(err) {
+		s.metrics.total.WithLabelValues("configure").Inc()
+	}
+	return err
+}
+
+func (s *timeoutSource) Next(ctx context.Context) (*ingest.Codec, error) {
+	tctx, cancel := context.WithTimeout(ctx, s.timeouts.Next)
+	defer cancel()
+	c, err := s.Source.Next(tctx)
+	if err != nil && exceeded(ctx, tctx) {
+		return nil, s.metrics.timedOut("next", s.timeouts.Next)
+	}
+	return c, err
+}
+
+// NextN limits the listing of all n objects with the timeout of Next.
+func (s *timeoutSource) NextN(ctx context.Context, n int) ([]ingest.Codec, error) {
+	tctx, cancel := context.WithTimeout(ctx, s.timeouts.Next)
+	defer cancel()
+	codecs, err := ingest.NextN(tctx, s.Source, n)
+	if err != nil && !errors.Is(err, io.EOF) && exceeded(ctx, tctx) {
+		return codecs, s.metrics.timedOut("next", s.timeouts.Next)
+	}
+	return codecs, err
+}
+
+// Locate limits locating an object with the timeout of Next,
+// since it only describes the object like listing it does.
+func (s *timeoutSource) Locate(ctx context.Context, c ingest.Codec) (*url.URL, error) {
+	tctx, cancel := context.WithTimeout(ctx, s.timeouts.Next)
+	defer cancel()
+	u, err := ingest.Locate(tctx, s.Source, c)
+	if err != nil && exceeded(ctx, tctx) {
+		return nil, s.metrics.timedOut("next", s.timeouts.Next)
+	}
+	return u, err
+}
+
+// Download limits the download including the reads of the content of the object,
+// which fail once the timeout passed.
+func (s *timeoutSource) Download(ctx context.Context, c ingest.Codec) (*ingest.Object, error) {
+	tctx, cancel := context.WithTimeout(ctx, s.timeouts.Download)
+	obj, err := s.Source.Download(tctx, c)
+	if err != nil {
+		if exceeded(ctx, tctx) {
+			err = s.metrics.timedOut("download", s.timeouts.Download)
+		}
+		cancel()
+		return nil, err
+	}
+	obj.Reader = &timeoutReader{r: obj.Reader, parent: ctx, ctx: tctx, cancel: cancel, timedOut: func() error {
+		return s.metrics.timedOut("download", s.timeouts.Download)
+	}}
+	return obj, nil
+}
+
+// timeoutReader reads the content of a downloaded object until the timeout of the download passed.
+type timeoutReader struct {
+	r           io.Reader
+	parent, ctx context.Context
+	cancel      context.CancelFunc
+	timedOut    func() error
+	err         error
+}
+
+func (r *timeoutReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	// Readers that do not watch the context of the download are stopped between reads.
+	if err := r.ctx.Err(); err != nil {
+		return 0, r.finish(err)
+	}
+	n, err := r.r.Read(p)
+	if err != nil {
+		err = r.finish(err)
+	}
+	return n, err
+}
+
+// finish ends the download with err, unless the timeout of the download caused err.
+func (r *timeoutReader) finish(err error) error {
+	if err != io.EOF && exceeded(r.parent, r.ctx) {
+		err = r.timedOut()
+	}
+	r.err = err
+	r.cancel()
+	return err
+}
+
+// Close ends the download and closes the reader of the object, if it is an io.Closer.
+func (r *timeoutReader) Close() error {
+	r.cancel()
+	if c, ok := r.r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+var (
+	_ Destination         = &timeoutDestination{}
+	_ storage.Copier      = &timeoutDestination{}
+	_ prometheus.Gatherer = &timeoutDestination{}
+	_ HealthChecker       = &timeoutDestination{}
+)
+
+// timeoutDestination is the destination that the PluginManager returns.
+// It applies the timeouts of the destination to the calls of the wrapped destination.
+type timeoutDestination struct {
+	Destination
+	timeouts Timeouts
+	metrics  *timeoutMetrics
+}
+
+func newTimeoutDestination(d Destination, t Timeouts) *timeoutDestination {
+	return &timeoutDestination{Destination: d, timeouts: t, metrics: newTimeoutMetrics("configure", "store")}
+}
+
+func (d *timeoutDestination) Gather() ([]*dto.MetricFamily, error) {
+	return d.metrics.gather(d.Destination)
+}
+
+func (d *timeoutDestination) Health(ctx context.Context) (Health, error) {
+	if hc, ok := d.Destination.(HealthChecker); ok {
+		return hc.Health(ctx)
+	}
+	return Health{}, nil
+}
+
+func (d *timeoutDestination) Configure(config map[string]any) error {
+	err := configure(d.Destination, config, d.timeouts.Configure)
+	if isConfigureTimeout(err) {
+		d.metrics.total.WithLabelValues("configure").Inc()
+	}
+	return err
+}
+
+// Store limits the storage including the reads of the content of the object,
+// which fail once the timeout passed.
+func (d *timeoutDestination) Store(ctx context.Context, c ingest.Codec, obj ingest.Object) (*url.URL, error) {
+	tctx, cancel := context.WithTimeout(ctx, d.timeouts.Store)
+	defer cancel()
+	obj.Reader = &deadlineReader{r: obj.Reader, ctx: tctx}
+	u, err := d.Destination.Store(tctx, c, obj)
+	if err != nil && exceeded(ctx, tctx) {
+		return nil, d.metrics.timedOut("store", d.timeouts.Store)
+	}
+	return u, err
+}
+
+// CopyFrom limits the copy with the timeout of Store, since it stores the object like Store does.
+func (d *timeoutDestination) CopyFrom(ctx context.Context, c ingest.Codec, uri *url.URL) (*url.URL, error) {
+	tctx, cancel := context.WithTimeout(ctx, d.timeouts.Store)
+	defer cancel()
+	u, err := storage.CopyFrom(tctx, d.Destination, c, uri)
+	if err != nil && exceeded(ctx, tctx) {
+		return nil, d.metrics.timedOut("store", d.timeouts.Store)
+	}
+	return u, err
+}
+
+// deadlineReader fails the reads of the content of an object once ctx is done,
+// so that destinations that do not watch the context stop storing the object.
+type deadlineReader struct {
+	r   io.Reader
+	ctx context.Context
+}
+
+func (r *deadlineReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
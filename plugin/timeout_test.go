@@ -0,0 +1,139 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/connylabs/ingest"
+)
+
+// slowSource is a noop source whose calls block until their contexts are done.
+type slowSource struct {
+	*noopSource
+	configure chan struct{}
+}
+
+func (s *slowSource) Configure(map[string]any) error {
+	<-s.configure
+	return nil
+}
+
+func (s *slowSource) Next(ctx context.Context) (*ingest.Codec, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// Download returns an object whose reader does not watch the context.
+func (s *slowSource) Download(context.Context, ingest.Codec) (*ingest.Object, error) {
+	return &ingest.Object{Reader: &slowReader{}}, nil
+}
+
+// slowReader returns a byte every 10ms.
+type slowReader struct{}
+
+func (slowReader) Read(p []byte) (int, error) {
+	time.Sleep(10 * time.Millisecond)
+	return copy(p, "a"), nil
+}
+
+// slowDestination is a noop destination that reads objects until it fails.
+type slowDestination struct {
+	*noopDestination
+}
+
+func (d *slowDestination) Store(_ context.Context, _ ingest.Codec, obj ingest.Object) (*url.URL, error) {
+	_, err := io.Copy(io.Discard, obj.Reader)
+	return nil, err
+}
+
+func timeouts(t *testing.T, g prometheus.Gatherer) map[string]float64 {
+	mfs, err := g.Gather()
+	require.NoError(t, err)
+	m := make(map[string]float64)
+	for _, mf := range mfs {
+		if mf.GetName() != "ingest_plugin_timeouts_total" {
+			continue
+		}
+		for _, metric := range mf.Metric {
+			for _, lp := range metric.Label {
+				if lp.GetName() == "call" {
+					m[lp.GetValue()] += metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return m
+}
+
+func TestTimeouts(t *testing.T) {
+	s := &slowSource{noopSource: NewNoopSource(hclog.NewNullLogger()), configure: make(chan struct{})}
+	RegisterBuiltin("test-timeouts", Builtin{
+		NewSource: func(hclog.Logger, prometheus.Registerer) Source { return s },
+		NewDestination: func(l hclog.Logger, _ prometheus.Registerer) Destination {
+			return &slowDestination{NewNoopDestination(l)}
+		},
+	})
+	path, ok := BuiltinPath("test-timeouts")
+	require.True(t, ok)
+	pm := NewPluginManager(time.Millisecond, nil)
+	t.Cleanup(pm.Stop)
+
+	_, err := pm.NewSourceWithOptions(path, nil, nil, Options{Timeouts: Timeouts{Configure: 10 * time.Millisecond}})
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.EqualError(t, err, "failed to configure source: configure timed out after 10ms")
+	close(s.configure)
+
+	src, err := pm.NewSourceWithOptions(path, nil, prometheus.Labels{"source": "foo"}, Options{Timeouts: Timeouts{Next: 10 * time.Millisecond, Download: 50 * time.Millisecond}})
+	require.NoError(t, err)
+	_, err = src.Next(context.Background())
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	// The timeouts of calls are not counted if the context of the caller is done first.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = src.Next(ctx)
+	assert.Equal(t, context.Canceled, err)
+
+	obj, err := src.Download(context.Background(), ingest.Codec{})
+	require.NoError(t, err)
+	buf, err := io.ReadAll(obj.Reader)
+	assert.EqualError(t, err, "download timed out after 50ms")
+	assert.NotEmpty(t, buf)
+	assert.Equal(t, map[string]float64{"configure": 0, "next": 1, "download": 1}, timeouts(t, src.(prometheus.Gatherer)))
+
+	dst, err := pm.NewDestinationWithOptions(path, nil, prometheus.Labels{"destination": "bar"}, Options{Timeouts: Timeouts{Store: 50 * time.Millisecond}})
+	require.NoError(t, err)
+	_, err = dst.Store(context.Background(), ingest.Codec{}, ingest.Object{Reader: &slowReader{}})
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	// The manager reports the timeouts with the labels of the sources and destinations.
+	mfs, err := pm.Gather()
+	require.NoError(t, err)
+	var found bool
+	for _, mf := range mfs {
+		if mf.GetName() != "ingest_plugin_timeouts_total" {
+			continue
+		}
+		found = true
+		assert.Len(t, mf.Metric, 5)
+	}
+	assert.True(t, found)
+	assert.Equal(t, map[string]float64{"configure": 0, "store": 1}, timeouts(t, dst.(prometheus.Gatherer)))
+}
+
+func TestTimeoutsWithDefaults(t *testing.T) {
+	assert.Equal(t, Timeouts{
+		Configure: DefaultConfigureTimeout,
+		Next:      time.Second,
+		Download:  DefaultDownloadTimeout,
+		Store:     DefaultStoreTimeout,
+	}, Timeouts{Next: time.Second}.withDefaults())
+}
@@ -0,0 +1,106 @@
+package plugin
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+
+	hplugin "github.com/hashicorp/go-plugin"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/grpc"
+)
+
+// transferWindow is the flow control window of every stream between ingest and a plugin in bytes.
+// The receiver of an object grants the sender this many bytes beyond what it has read,
+// so a slow receiver holds the sender back and a transfer buffers at most transferWindow bytes,
+// instead of gRPC growing the window up to many megabytes to match the bandwidth of the connection.
+const transferWindow = 16 * chunkSize
+
+// transferConnWindow is the flow control window of the connection to a plugin, which is shared by all of its streams.
+const transferConnWindow = 4 * transferWindow
+
+// grpcDialOptions configure the connections of ingest to its plugins.
+var grpcDialOptions = []grpc.DialOption{
+	grpc.WithInitialWindowSize(transferWindow),
+	grpc.WithInitialConnWindowSize(transferConnWindow),
+}
+
+// grpcServer is the gRPC server of plugins with the flow control windows of ingest.
+func grpcServer(opts []grpc.ServerOption) *grpc.Server {
+	return hplugin.DefaultGRPCServer(append(opts,
+		grpc.InitialWindowSize(transferWindow),
+		grpc.InitialConnWindowSize(transferConnWindow),
+	))
+}
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// errChecksumMismatch is returned when a chunk of an object was corrupted between ingest and a plugin.
+var errChecksumMismatch = errors.New("the checksum of a chunk does not match its content")
+
+// checksum returns the big-endian CRC-32C of a chunk.
+func checksum(chunk []byte) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, crc32.Checksum(chunk, crc32c))
+	return b
+}
+
+// verifyChecksum returns errChecksumMismatch if sum is not the checksum of chunk.
+// Chunks without checksums, which peers that were built before checksums were added send, are not verified.
+func verifyChecksum(chunk, sum []byte) error {
+	if len(sum) == 0 || bytes.Equal(sum, checksum(chunk)) {
+		return nil
+	}
+	return errChecksumMismatch
+}
+
+// transferMetrics count the objects that are streamed between ingest and a plugin.
+// The clients of plugins record them, so that the PluginManager reports them with the labels of the source or destination.
+type transferMetrics struct {
+	r              *prometheus.Registry
+	bytes          prometheus.Counter
+	chunks         prometheus.Counter
+	checksumErrors prometheus.Counter
+}
+
+// newTransferMetrics returns the metrics of the transfers in the given direction, i.e. download or store.
+func newTransferMetrics(direction string) *transferMetrics {
+	labels := prometheus.Labels{"direction": direction}
+	t := &transferMetrics{
+		r: prometheus.NewRegistry(),
+		bytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name:        "ingest_plugin_transfer_bytes_total",
+			Help:        "Number of bytes of objects streamed between ingest and the plugin.",
+			ConstLabels: labels,
+		}),
+		chunks: prometheus.NewCounter(prometheus.CounterOpts{
+			Name:        "ingest_plugin_transfer_chunks_total",
+			Help:        "Number of chunks of objects streamed between ingest and the plugin.",
+			ConstLabels: labels,
+		}),
+		checksumErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name:        "ingest_plugin_transfer_checksum_errors_total",
+			Help:        "Number of chunks of objects whose checksums did not match their content.",
+			ConstLabels: labels,
+		}),
+	}
+	t.r.MustRegister(t.bytes, t.chunks, t.checksumErrors)
+	return t
+}
+
+// observe records a chunk that was transferred.
+func (t *transferMetrics) observe(chunk []byte) {
+	t.bytes.Add(float64(len(chunk)))
+	t.chunks.Inc()
+}
+
+// gather appends the transfer metrics to the metric families of a plugin.
+func (t *transferMetrics) gather(mfs []*dto.MetricFamily) ([]*dto.MetricFamily, error) {
+	tmfs, err := t.r.Gather()
+	if err != nil {
+		return nil, err
+	}
+	return append(mfs, tmfs...), nil
+}
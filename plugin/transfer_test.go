@@ -0,0 +1,55 @@
+package plugin
+
+import (
+	"io"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+
+	"github.com/connylabs/ingest/plugin/proto"
+)
+
+// chunkStream is a download stream that returns a fixed list of messages.
+type chunkStream struct {
+	grpc.ClientStream
+	res []*proto.DownloadResponse
+}
+
+func (s *chunkStream) Recv() (*proto.DownloadResponse, error) {
+	if len(s.res) == 0 {
+		return nil, io.EOF
+	}
+	res := s.res[0]
+	s.res = s.res[1:]
+	return res, nil
+}
+
+func TestChecksum(t *testing.T) {
+	chunk := []byte("foo")
+	assert.NoError(t, verifyChecksum(chunk, checksum(chunk)))
+	assert.NoError(t, verifyChecksum(chunk, nil), "chunks without checksums are not verified")
+	assert.ErrorIs(t, verifyChecksum([]byte("bar"), checksum(chunk)), errChecksumMismatch)
+
+	// The reader of a download fails at the first corrupted chunk.
+	tm := newTransferMetrics("download")
+	r := &downloadReader{
+		stream: &chunkStream{res: []*proto.DownloadResponse{
+			{Chunk: chunk, Checksum: checksum(chunk)},
+			{Chunk: []byte("bar"), Checksum: checksum(chunk)},
+			{Chunk: chunk, Checksum: checksum(chunk)},
+		}},
+		cancel:    func() {},
+		transfers: tm,
+	}
+	buf, err := io.ReadAll(r)
+	assert.ErrorIs(t, err, errChecksumMismatch)
+	assert.Equal(t, chunk, buf)
+	assert.Equal(t, 3.0, testutil.ToFloat64(tm.bytes))
+	assert.Equal(t, 1.0, testutil.ToFloat64(tm.chunks))
+	assert.Equal(t, 1.0, testutil.ToFloat64(tm.checksumErrors))
+
+	// The error survives the plugin connection.
+	assert.ErrorIs(t, fromStatus(toStatus(errChecksumMismatch)), errChecksumMismatch)
+}
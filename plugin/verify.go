@@ -0,0 +1,182 @@
+package plugin
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// minisignExtension is the extension of the minisign signature files next to plugin files.
+const minisignExtension = ".minisig"
+
+// ErrUnverified is returned when a plugin file cannot be verified.
+var ErrUnverified = errors.New("plugin is not verified")
+
+// A Verifier verifies plugin files before the PluginManager starts them,
+// so that only trusted binaries are executed.
+type Verifier interface {
+	Verify(path string) error
+}
+
+var _ Verifier = Verification{}
+
+// A Verification declares the checksum or the signature with which a plugin file is verified.
+// If both are declared, then both must match.
+type Verification struct {
+	// SHA256 is the hex-encoded sha256 checksum of the plugin file.
+	SHA256 string
+	// MinisignKey is a minisign public key, either the base64-encoded key or the content of a minisign .pub file.
+	// The signature is read from the file next to the plugin file with the extension .minisig.
+	MinisignKey string
+}
+
+// Validate checks that the verification declares a valid checksum or key.
+func (v Verification) Validate() error {
+	if v.SHA256 == "" && v.MinisignKey == "" {
+		return errors.New("a sha256 checksum or a minisign key is required")
+	}
+	if v.SHA256 != "" {
+		if sum, err := hex.DecodeString(v.SHA256); err != nil || len(sum) != sha256.Size {
+			return fmt.Errorf("invalid sha256 checksum %q", v.SHA256)
+		}
+	}
+	if v.MinisignKey != "" {
+		if _, err := parseMinisignKey(v.MinisignKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Verify checks the checksum and the signature of the plugin file at path.
+func (v Verification) Verify(path string) error {
+	if err := v.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrUnverified, err)
+	}
+	if v.SHA256 != "" {
+		if err := verifySHA256(path, v.SHA256); err != nil {
+			return err
+		}
+	}
+	if v.MinisignKey != "" {
+		if err := verifyMinisign(path, v.MinisignKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func verifySHA256(path, checksum string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return fmt.Errorf("failed to read plugin %q: %w", path, err)
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(sum, checksum) {
+		return fmt.Errorf("%w: the sha256 checksum of %q is %s but %s is expected", ErrUnverified, path, sum, checksum)
+	}
+	return nil
+}
+
+// minisignKey is a minisign Ed25519 public key.
+type minisignKey struct {
+	id [8]byte
+	pk ed25519.PublicKey
+}
+
+// parseMinisignKey parses a base64-encoded minisign public key.
+// The untrusted comment of a .pub file is skipped.
+func parseMinisignKey(s string) (*minisignKey, error) {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[len(lines)-1]))
+	if err != nil || len(b) != 2+8+ed25519.PublicKeySize || string(b[:2]) != "Ed" {
+		return nil, errors.New("invalid minisign public key")
+	}
+	k := &minisignKey{pk: ed25519.PublicKey(b[10:])}
+	copy(k.id[:], b[2:10])
+	return k, nil
+}
+
+// verifyMinisign verifies the plugin file at path with the minisign signature next to it.
+// Both legacy signatures of the file and signatures of its BLAKE2b-512 hash are supported.
+func verifyMinisign(path, key string) error {
+	k, err := parseMinisignKey(key)
+	if err != nil {
+		return err
+	}
+	sigPath := path + minisignExtension
+	f, err := os.Open(sigPath)
+	if err != nil {
+		return fmt.Errorf("%w: failed to read minisign signature: %v", ErrUnverified, err)
+	}
+	defer f.Close()
+	var lines []string
+	s := bufio.NewScanner(io.LimitReader(f, 1<<16))
+	for s.Scan() {
+		lines = append(lines, s.Text())
+	}
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("%w: failed to read minisign signature: %v", ErrUnverified, err)
+	}
+	if len(lines) < 4 || !strings.HasPrefix(lines[2], "trusted comment: ") {
+		return fmt.Errorf("%w: invalid minisign signature %q", ErrUnverified, sigPath)
+	}
+	sig, err := base64.StdEncoding.DecodeString(lines[1])
+	if err != nil || len(sig) != 2+8+ed25519.SignatureSize {
+		return fmt.Errorf("%w: invalid minisign signature %q", ErrUnverified, sigPath)
+	}
+	global, err := base64.StdEncoding.DecodeString(lines[3])
+	if err != nil || len(global) != ed25519.SignatureSize {
+		return fmt.Errorf("%w: invalid minisign signature %q", ErrUnverified, sigPath)
+	}
+	if !bytes.Equal(sig[2:10], k.id[:]) {
+		return fmt.Errorf("%w: %q was signed with a different minisign key", ErrUnverified, path)
+	}
+
+	var msg []byte
+	switch string(sig[:2]) {
+	case "Ed":
+		if msg, err = os.ReadFile(path); err != nil {
+			return fmt.Errorf("failed to read plugin %q: %w", path, err)
+		}
+	case "ED":
+		var h hash.Hash
+		if h, err = blake2b.New512(nil); err != nil {
+			return err
+		}
+		p, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer p.Close()
+		if _, err := io.Copy(h, p); err != nil {
+			return fmt.Errorf("failed to read plugin %q: %w", path, err)
+		}
+		msg = h.Sum(nil)
+	default:
+		return fmt.Errorf("%w: unsupported minisign signature algorithm %q", ErrUnverified, sig[:2])
+	}
+	if !ed25519.Verify(k.pk, msg, sig[10:]) {
+		return fmt.Errorf("%w: the minisign signature of %q is invalid", ErrUnverified, path)
+	}
+	trusted := append(append([]byte(nil), sig[10:]...), strings.TrimPrefix(lines[2], "trusted comment: ")...)
+	if !ed25519.Verify(k.pk, trusted, global) {
+		return fmt.Errorf("%w: the trusted comment of the minisign signature of %q is invalid", ErrUnverified, path)
+	}
+	return nil
+}
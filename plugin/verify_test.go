@@ -0,0 +1,102 @@
+package plugin
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/blake2b"
+)
+
+// minisign signs content like minisign does and returns the public key and the signature file.
+func minisign(t *testing.T, content []byte, prehash bool, trustedComment string) (string, []byte) {
+	pk, sk, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	id := []byte("12345678")
+	alg, msg := "Ed", content
+	if prehash {
+		sum := blake2b.Sum512(content)
+		alg, msg = "ED", sum[:]
+	}
+	sig := append(append([]byte(alg), id...), ed25519.Sign(sk, msg)...)
+	global := ed25519.Sign(sk, append(append([]byte(nil), sig[10:]...), trustedComment...))
+	key := base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), id...), pk...))
+	return "untrusted comment: minisign public key\n" + key + "\n", []byte(fmt.Sprintf("untrusted comment: signature\n%s\ntrusted comment: %s\n%s\n",
+		base64.StdEncoding.EncodeToString(sig), trustedComment, base64.StdEncoding.EncodeToString(global)))
+}
+
+func TestVerification(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "plugin")
+	content := []byte("plugin")
+	require.NoError(t, os.WriteFile(path, content, 0o755))
+	checksum := fmt.Sprintf("%x", sha256.Sum256(content))
+
+	key, sig := minisign(t, content, true, "timestamp:1 file:plugin")
+	legacyKey, legacySig := minisign(t, content, false, "timestamp:1 file:plugin")
+	otherKey, _ := minisign(t, content, true, "")
+
+	for _, tc := range []struct {
+		name string
+		v    Verification
+		sig  []byte
+		err  bool
+	}{
+		{name: "empty", err: true},
+		{name: "checksum", v: Verification{SHA256: checksum}},
+		{name: "wrong checksum", v: Verification{SHA256: fmt.Sprintf("%x", sha256.Sum256(nil))}, err: true},
+		{name: "invalid checksum", v: Verification{SHA256: "foo"}, err: true},
+		{name: "minisign", v: Verification{MinisignKey: key}, sig: sig},
+		{name: "legacy minisign", v: Verification{MinisignKey: legacyKey}, sig: legacySig},
+		{name: "checksum and minisign", v: Verification{SHA256: checksum, MinisignKey: key}, sig: sig},
+		{name: "missing signature", v: Verification{MinisignKey: key}, err: true},
+		{name: "other key", v: Verification{MinisignKey: otherKey}, sig: sig, err: true},
+		{name: "modified trusted comment", v: Verification{MinisignKey: key}, sig: bytes.Replace(sig, []byte("file:plugin"), []byte("file:other"), 1), err: true},
+		{name: "invalid key", v: Verification{MinisignKey: "foo"}, err: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			os.Remove(path + minisignExtension)
+			if tc.sig != nil {
+				require.NoError(t, os.WriteFile(path+minisignExtension, tc.sig, 0o644))
+			}
+			err := tc.v.Verify(path)
+			if tc.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	// A modified plugin does not match its signature.
+	require.NoError(t, os.WriteFile(path+minisignExtension, sig, 0o644))
+	require.NoError(t, os.WriteFile(path, []byte("modified"), 0o755))
+	assert.ErrorIs(t, Verification{MinisignKey: key}.Verify(path), ErrUnverified)
+}
+
+func TestPluginManagerVerifier(t *testing.T) {
+	pm := NewPluginManager(0, nil)
+	t.Cleanup(pm.Stop)
+	pm.Verifier = Verification{SHA256: fmt.Sprintf("%x", sha256.Sum256(nil))}
+
+	_, err := pm.NewSource(noopPath, nil, prometheus.Labels{})
+	assert.ErrorIs(t, err, ErrUnverified)
+	_, err = pm.NewDestination(noopPath, nil, prometheus.Labels{})
+	assert.ErrorIs(t, err, ErrUnverified)
+
+	// Built-in plugins are compiled into the binary and are not verified.
+	noop, ok := BuiltinPath("noop")
+	require.True(t, ok)
+	s, err := pm.NewSource(noop, nil, prometheus.Labels{})
+	require.NoError(t, err)
+	pm.Kill(s)
+}
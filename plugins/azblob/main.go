@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/plugin"
+	"github.com/connylabs/ingest/storage"
+	"github.com/connylabs/ingest/storage/azblob"
+)
+
+type sourceConfig struct {
+	// ConnectionString is an Azure Storage connection string.
+	// If given, AccountName, AccountURL and the credentials below are ignored.
+	ConnectionString string
+	AccountName      string
+	// AccountURL overrides the URL of the Blob service, e.g. for Azurite.
+	// It defaults to https://<AccountName>.blob.core.windows.net.
+	AccountURL string `mapstructure:"accountURL"`
+	// SASToken is a shared access signature.
+	SASToken string `mapstructure:"sasToken"`
+	// AccountKey is the storage account key.
+	AccountKey string
+	// ManagedIdentity authorizes requests with the managed identity of the host.
+	ManagedIdentity bool
+	// ClientID selects a user-assigned managed identity.
+	ClientID  string `mapstructure:"clientID"`
+	Container string
+	Prefix    string
+	Recursive bool
+}
+
+// newClient creates a Blob service client from the configuration.
+func (sc *sourceConfig) newClient() (*azblob.Client, error) {
+	if sc.ConnectionString != "" {
+		return azblob.NewClientFromConnectionString(sc.ConnectionString, nil)
+	}
+	u := sc.AccountURL
+	if u == "" {
+		if sc.AccountName == "" {
+			return nil, errors.New("either a connection string, an account name or an account URL must be given")
+		}
+		u = fmt.Sprintf("https://%s.blob.core.windows.net", sc.AccountName)
+	}
+	var c azblob.Credential
+	switch {
+	case sc.SASToken != "":
+		c = azblob.NewSASCredential(sc.SASToken)
+	case sc.AccountKey != "":
+		var err error
+		if c, err = azblob.NewSharedKeyCredential(sc.AccountName, sc.AccountKey); err != nil {
+			return nil, err
+		}
+	case sc.ManagedIdentity:
+		c = azblob.NewManagedIdentityCredential(sc.ClientID, nil)
+	}
+	return azblob.NewClient(u, c, nil)
+}
+
+type destinationConfig struct {
+	sourceConfig `mapstructure:",squash"`
+	// BlockSize is the size in bytes of the blocks in which large objects are uploaded.
+	// It defaults to 8 MiB.
+	BlockSize int64
+}
+
+var _ plugin.Destination = &destination{}
+
+type destination struct {
+	storage.Storage
+}
+
+// Configure will configure the destination with the values given by config.
+func (d *destination) Configure(config map[string]interface{}) error {
+	dc := new(destinationConfig)
+	if err := mapstructure.Decode(config, dc); err != nil {
+		return err
+	}
+	if dc.Container == "" {
+		return errors.New("container must not be empty")
+	}
+	c, err := dc.newClient()
+	if err != nil {
+		return fmt.Errorf("failed to create blob client: %w", err)
+	}
+
+	d.Storage = azblob.New(dc.Container, dc.Prefix, dc.BlockSize, c)
+
+	return nil
+}
+
+var _ plugin.Source = &source{}
+
+// source can fetch blobs from the Azure Blob service.
+type source struct {
+	mu        sync.Mutex
+	c         *azblob.Client
+	container string
+	prefix    string
+	recursive bool
+	// blobs is the current page of listed blobs.
+	blobs []azblob.Blob
+	// marker is the marker of the next page. If empty, there are no more pages.
+	marker  string
+	started bool
+}
+
+// Configure will configure the source with the values given by config.
+func (s *source) Configure(config map[string]interface{}) error {
+	sc := new(sourceConfig)
+	if err := mapstructure.Decode(config, sc); err != nil {
+		return err
+	}
+	if sc.Container == "" {
+		return errors.New("container must not be empty")
+	}
+	c, err := sc.newClient()
+	if err != nil {
+		return fmt.Errorf("failed to create blob client: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.c = c
+	s.container = sc.Container
+	s.prefix = sc.Prefix
+	s.recursive = sc.Recursive
+
+	return nil
+}
+
+// Reset resets the Nexter as if it was newly created.
+func (s *source) Reset(_ context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.blobs = nil
+	s.marker = ""
+	s.started = false
+
+	return nil
+}
+
+// Next lists one page of blobs at a time.
+func (s *source) Next(ctx context.Context) (*ingest.Codec, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(s.blobs) == 0 {
+		if s.started && s.marker == "" {
+			return nil, io.EOF
+		}
+		delimiter := ""
+		if !s.recursive {
+			delimiter = "/"
+		}
+		r, err := s.c.ListBlobs(ctx, s.container, s.prefix, delimiter, s.marker)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list blobs: %w", err)
+		}
+		s.started = true
+		s.blobs = r.Blobs
+		s.marker = r.NextMarker
+	}
+
+	b := s.blobs[0]
+	s.blobs = s.blobs[1:]
+	c := ingest.NewCodec(b.Name, strings.TrimPrefix(b.Name, s.prefix), nil)
+	c.Size = b.Properties.ContentLength
+	if t, err := http.ParseTime(b.Properties.LastModified); err == nil {
+		c.LastModified = &t
+	}
+	return &c, nil
+}
+
+// CleanUp deletes the blob from the container.
+func (s *source) CleanUp(ctx context.Context, i ingest.Codec) error {
+	return s.c.DeleteBlob(ctx, s.container, i.ID)
+}
+
+// Download will take an Element and download it from the Blob service.
+func (s *source) Download(ctx context.Context, i ingest.Codec) (*ingest.Object, error) {
+	res, err := s.c.GetBlob(ctx, s.container, i.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get blob: %w", err)
+	}
+
+	return &ingest.Object{
+		Reader:   res.Body,
+		Len:      res.ContentLength,
+		MimeType: res.Header.Get("Content-Type"),
+	}, nil
+}
+
+func main() {
+	plugin.RunPluginServer(&source{}, &destination{})
+}
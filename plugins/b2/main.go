@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/kurin/blazer/b2"
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/plugin"
+	"github.com/connylabs/ingest/storage"
+	sb2 "github.com/connylabs/ingest/storage/b2"
+)
+
+const (
+	cleanUpHide   = "hide"
+	cleanUpDelete = "delete"
+)
+
+type sourceConfig struct {
+	// KeyID and ApplicationKey are the credentials of a B2 application key.
+	// The key may be restricted to the bucket.
+	KeyID          string `mapstructure:"keyID"`
+	ApplicationKey string
+	Bucket         string
+	Prefix         string
+	Recursive      bool
+	// CleanUp is either "hide" or "delete". It defaults to "hide".
+	// Hiding a file keeps its versions, while deleting removes the latest version.
+	CleanUp string
+}
+
+type destinationConfig struct {
+	KeyID          string `mapstructure:"keyID"`
+	ApplicationKey string
+	Bucket         string
+	Prefix         string
+	// ChunkSize is the size in bytes of the parts of large files. It defaults to 100 MB.
+	ChunkSize int
+	// ConcurrentUploads is the number of parts of a large file that are uploaded concurrently.
+	ConcurrentUploads int
+}
+
+var _ plugin.Destination = &destination{}
+
+type destination struct {
+	storage.Storage
+}
+
+// Configure will configure the destination with the values given by config.
+func (d *destination) Configure(config map[string]interface{}) error {
+	dc := new(destinationConfig)
+	if err := mapstructure.Decode(config, dc); err != nil {
+		return err
+	}
+	if dc.Bucket == "" {
+		return errors.New("bucket must not be empty")
+	}
+	ctx := context.TODO()
+	c, err := b2.NewClient(ctx, dc.KeyID, dc.ApplicationKey)
+	if err != nil {
+		return fmt.Errorf("failed to create B2 client: %w", err)
+	}
+	b, err := c.Bucket(ctx, dc.Bucket)
+	if err != nil {
+		return fmt.Errorf("failed to get bucket: %w", err)
+	}
+
+	d.Storage = sb2.New(b, dc.Prefix, sb2.Options{
+		ChunkSize:         dc.ChunkSize,
+		ConcurrentUploads: dc.ConcurrentUploads,
+	})
+
+	return nil
+}
+
+var _ plugin.Source = &source{}
+
+// source can fetch files from a Backblaze B2 bucket using the native B2 API.
+type source struct {
+	mu        sync.Mutex
+	b         *b2.Bucket
+	prefix    string
+	recursive bool
+	delete    bool
+	i         *b2.ObjectIterator
+}
+
+// Configure will configure the source with the values given by config.
+func (s *source) Configure(config map[string]interface{}) error {
+	sc := new(sourceConfig)
+	if err := mapstructure.Decode(config, sc); err != nil {
+		return err
+	}
+	if sc.Bucket == "" {
+		return errors.New("bucket must not be empty")
+	}
+	switch sc.CleanUp {
+	case "":
+		sc.CleanUp = cleanUpHide
+	case cleanUpHide, cleanUpDelete:
+	default:
+		return fmt.Errorf("unknown clean up %q", sc.CleanUp)
+	}
+	ctx := context.TODO()
+	c, err := b2.NewClient(ctx, sc.KeyID, sc.ApplicationKey)
+	if err != nil {
+		return fmt.Errorf("failed to create B2 client: %w", err)
+	}
+	b, err := c.Bucket(ctx, sc.Bucket)
+	if err != nil {
+		return fmt.Errorf("failed to get bucket: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.b = b
+	s.prefix = sc.Prefix
+	s.recursive = sc.Recursive
+	s.delete = sc.CleanUp == cleanUpDelete
+
+	return nil
+}
+
+// Reset resets the Nexter as if it was newly created.
+func (s *source) Reset(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	opts := []b2.ListOption{b2.ListPrefix(s.prefix)}
+	if !s.recursive {
+		opts = append(opts, b2.ListDelimiter("/"))
+	}
+	s.i = s.b.List(ctx, opts...)
+
+	return nil
+}
+
+// Next returns the next file of the listing.
+func (s *source) Next(ctx context.Context) (*ingest.Codec, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for s.i.Next() {
+		name := s.i.Object().Name()
+		// With a delimiter, "sub-directories" are returned as names ending in the delimiter.
+		if strings.HasSuffix(name, "/") {
+			continue
+		}
+		// The attributes of listed files are part of the listing, so they do not need another request.
+		a, err := s.i.Object().Attrs(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get attributes of file %q: %w", name, err)
+		}
+		c := ingest.NewCodec(name, strings.TrimPrefix(name, s.prefix), nil)
+		// The modification time of the source of the file is only known if the uploader recorded it.
+		mt := a.LastModified
+		if mt.IsZero() {
+			mt = a.UploadTimestamp
+		}
+		c.Size, c.LastModified = a.Size, &mt
+		return &c, nil
+	}
+	if err := s.i.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+
+	return nil, io.EOF
+}
+
+// CleanUp hides or deletes the file.
+func (s *source) CleanUp(ctx context.Context, i ingest.Codec) error {
+	o := s.b.Object(i.ID)
+	var err error
+	if s.delete {
+		err = o.Delete(ctx)
+	} else {
+		err = o.Hide(ctx)
+	}
+	if err != nil && !b2.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Download will take an Element and download it from B2.
+func (s *source) Download(ctx context.Context, i ingest.Codec) (*ingest.Object, error) {
+	o := s.b.Object(i.ID)
+	attrs, err := o.Attrs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attributes: %w", err)
+	}
+
+	return &ingest.Object{
+		Reader:   o.NewReader(ctx),
+		Len:      attrs.Size,
+		MimeType: attrs.ContentType,
+	}, nil
+}
+
+func main() {
+	plugin.RunPluginServer(&source{}, &destination{})
+}
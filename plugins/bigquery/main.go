@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	bq "google.golang.org/api/bigquery/v2"
+	"google.golang.org/api/option"
+	gcs "google.golang.org/api/storage/v1"
+
+	"github.com/connylabs/ingest/plugin"
+	"github.com/connylabs/ingest/storage"
+	"github.com/connylabs/ingest/storage/bigquery"
+)
+
+type destinationConfig struct {
+	// CredentialsFile is the path to a service account JSON key file.
+	CredentialsFile string
+	// CredentialsJSON is the content of a service account JSON key file.
+	CredentialsJSON string `mapstructure:"credentialsJSON"`
+	// If neither of the above is given, then the application default credentials are used.
+	Project  string
+	Dataset  string
+	Table    string
+	Location string
+	// Bucket is the GCS bucket in which objects are staged.
+	Bucket string
+	Prefix string
+	// Format is either ndjson or csv.
+	// If empty, it is inferred from the MIME type or the extension of every object.
+	Format            string
+	Autodetect        bool
+	SkipLeadingRows   int64
+	WriteDisposition  string
+	CreateDisposition string
+	// DeleteStaged deletes staged objects once they were loaded.
+	DeleteStaged bool
+	// PollInterval is the interval at which the status of load jobs is checked. It defaults to 5s.
+	PollInterval string
+}
+
+var _ plugin.Destination = &destination{}
+
+// destination loads objects into a BigQuery table.
+type destination struct {
+	storage.Storage
+}
+
+// Configure will configure the destination with the values given by config.
+func (d *destination) Configure(config map[string]interface{}) error {
+	dc := new(destinationConfig)
+	if err := mapstructure.Decode(config, dc); err != nil {
+		return err
+	}
+	if dc.Project == "" || dc.Dataset == "" || dc.Table == "" {
+		return errors.New("project, dataset and table must not be empty")
+	}
+	if dc.Bucket == "" {
+		return errors.New("bucket must not be empty")
+	}
+	o := bigquery.Options{
+		Autodetect:        dc.Autodetect,
+		SkipLeadingRows:   dc.SkipLeadingRows,
+		WriteDisposition:  strings.ToUpper(dc.WriteDisposition),
+		CreateDisposition: strings.ToUpper(dc.CreateDisposition),
+		DeleteStaged:      dc.DeleteStaged,
+	}
+	switch strings.ToLower(dc.Format) {
+	case "":
+	case "ndjson", "json":
+		o.Format = bigquery.FormatNDJSON
+	case "csv":
+		o.Format = bigquery.FormatCSV
+	default:
+		return fmt.Errorf("unknown format %q", dc.Format)
+	}
+	if dc.PollInterval != "" {
+		var err error
+		if o.PollInterval, err = time.ParseDuration(dc.PollInterval); err != nil {
+			return fmt.Errorf("failed to parse poll interval: %w", err)
+		}
+	}
+	var co []option.ClientOption
+	if dc.CredentialsFile != "" {
+		co = append(co, option.WithCredentialsFile(dc.CredentialsFile))
+	}
+	if dc.CredentialsJSON != "" {
+		co = append(co, option.WithCredentialsJSON([]byte(dc.CredentialsJSON)))
+	}
+	gs, err := gcs.NewService(context.TODO(), append(co, option.WithScopes(gcs.DevstorageReadWriteScope))...)
+	if err != nil {
+		return fmt.Errorf("failed to create storage service: %w", err)
+	}
+	bs, err := bq.NewService(context.TODO(), append(co, option.WithScopes(bq.BigqueryScope))...)
+	if err != nil {
+		return fmt.Errorf("failed to create bigquery service: %w", err)
+	}
+
+	d.Storage = bigquery.New(dc.Bucket, dc.Prefix, bigquery.Table{
+		Project:  dc.Project,
+		Dataset:  dc.Dataset,
+		Table:    dc.Table,
+		Location: dc.Location,
+	}, o, gs, bs)
+
+	return nil
+}
+
+func main() {
+	plugin.RunPluginServer(nil, &destination{})
+}
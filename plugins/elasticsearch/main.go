@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/plugin"
+	"github.com/connylabs/ingest/storage"
+	"github.com/connylabs/ingest/storage/elasticsearch"
+)
+
+const (
+	defaultBatchSize = 1000
+	defaultScroll    = "5m"
+)
+
+type sourceConfig struct {
+	// URL is the URL of the Elasticsearch cluster.
+	URL      string `mapstructure:"url"`
+	Username string
+	Password string
+	// APIKey is the base64 encoded ID and key of an API key.
+	APIKey string `mapstructure:"apiKey"`
+	// Index is the name of an index, an alias or a pattern.
+	Index string
+	// Query is an optional query in the Elasticsearch query DSL.
+	// It defaults to matching all documents.
+	Query map[string]interface{}
+	// BatchSize is the number of documents in each object.
+	BatchSize int
+	// Scroll is the keep alive of the search context. It defaults to 5m.
+	Scroll string
+}
+
+type destinationConfig struct {
+	URL      string `mapstructure:"url"`
+	Username string
+	Password string
+	APIKey   string `mapstructure:"apiKey"`
+	// Index is the name of the index in which the documents are stored.
+	Index string
+	// URITemplate is an optional template for the URI of the object in another destination,
+	// e.g. s3://bucket/prefix/{{.Name}}. The template is executed with the Codec.
+	URITemplate string `mapstructure:"uriTemplate"`
+}
+
+var _ plugin.Destination = &destination{}
+
+// destination indexes a document with the metadata of every object.
+type destination struct {
+	storage.Storage
+}
+
+// Configure will configure the destination with the values given by config.
+func (d *destination) Configure(config map[string]interface{}) error {
+	dc := new(destinationConfig)
+	if err := mapstructure.Decode(config, dc); err != nil {
+		return err
+	}
+	if dc.URL == "" {
+		return errors.New("url must not be empty")
+	}
+	if dc.Index == "" {
+		return errors.New("index must not be empty")
+	}
+	var t *template.Template
+	if dc.URITemplate != "" {
+		var err error
+		if t, err = template.New("uri").Option("missingkey=error").Parse(dc.URITemplate); err != nil {
+			return fmt.Errorf("failed to parse URI template: %w", err)
+		}
+	}
+	c, err := newClient(dc.URL, dc.Username, dc.Password, dc.APIKey)
+	if err != nil {
+		return err
+	}
+
+	d.Storage = elasticsearch.New(dc.Index, t, c)
+
+	return nil
+}
+
+// newClient creates a client that authenticates with an API key or basic authentication.
+func newClient(u, username, password, apiKey string) (*elasticsearch.Client, error) {
+	var h http.Header
+	switch {
+	case apiKey != "":
+		h = elasticsearch.APIKey(apiKey)
+	case username != "":
+		h = elasticsearch.BasicAuth(username, password)
+	}
+	c, err := elasticsearch.NewClient(u, h, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create elasticsearch client: %w", err)
+	}
+	return c, nil
+}
+
+// meta is stored in the Meta field of a Codec.
+// It contains the documents of a batch.
+type meta struct {
+	Docs []elasticsearch.Hit `json:"docs"`
+}
+
+var _ plugin.Source = &source{}
+
+// source exports the documents of an Elasticsearch index as NDJSON objects.
+// Every call to Reset starts a new snapshot.
+type source struct {
+	mu        sync.Mutex
+	c         *elasticsearch.Client
+	index     string
+	query     map[string]interface{}
+	batchSize int
+	scroll    string
+	// snapshot identifies the current export and is part of the object names.
+	snapshot string
+	scrollID string
+	batch    int
+	done     bool
+}
+
+// Configure will configure the source with the values given by config.
+func (s *source) Configure(config map[string]interface{}) error {
+	sc := new(sourceConfig)
+	if err := mapstructure.Decode(config, sc); err != nil {
+		return err
+	}
+	if sc.URL == "" {
+		return errors.New("url must not be empty")
+	}
+	if sc.Index == "" {
+		return errors.New("index must not be empty")
+	}
+	if sc.BatchSize <= 0 {
+		sc.BatchSize = defaultBatchSize
+	}
+	if sc.Scroll == "" {
+		sc.Scroll = defaultScroll
+	}
+	if sc.Query == nil {
+		sc.Query = map[string]interface{}{"match_all": map[string]interface{}{}}
+	}
+	c, err := newClient(sc.URL, sc.Username, sc.Password, sc.APIKey)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.c = c
+	s.index = sc.Index
+	s.query = sc.Query
+	s.batchSize = sc.BatchSize
+	s.scroll = sc.Scroll
+
+	return nil
+}
+
+// Reset starts a new snapshot and frees the search context of the previous one.
+func (s *source) Reset(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.clear(ctx)
+	s.snapshot = time.Now().UTC().Format("20060102T150405Z")
+	s.batch = 0
+	s.done = false
+
+	return nil
+}
+
+// clear frees the search context, if there is one.
+// It must be called with the mutex held.
+func (s *source) clear(ctx context.Context) {
+	if s.scrollID != "" {
+		// The search context expires anyway, so errors are ignored.
+		s.c.ClearScroll(ctx, s.scrollID) //nolint:errcheck
+		s.scrollID = ""
+	}
+}
+
+// Next scrolls through the index and returns one batch of documents at a time.
+// Only the IDs of the documents are carried in the Codec;
+// the documents themselves are requested when the batch is downloaded.
+func (s *source) Next(ctx context.Context) (*ingest.Codec, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.done {
+		return nil, io.EOF
+	}
+	var r *elasticsearch.SearchResult
+	var err error
+	if s.scrollID == "" {
+		r, err = s.c.Search(ctx, s.index, map[string]interface{}{
+			"size":    s.batchSize,
+			"query":   s.query,
+			"sort":    []string{"_doc"},
+			"_source": false,
+		}, s.scroll)
+	} else {
+		r, err = s.c.Scroll(ctx, s.scrollID, s.scroll)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to search index %q: %w", s.index, err)
+	}
+	s.scrollID = r.ScrollID
+	if len(r.Hits.Hits) == 0 {
+		s.done = true
+		s.clear(ctx)
+		return nil, io.EOF
+	}
+
+	docs := make([]elasticsearch.Hit, len(r.Hits.Hits))
+	for i, h := range r.Hits.Hits {
+		docs[i] = elasticsearch.Hit{Index: h.Index, ID: h.ID}
+	}
+	buf, err := json.Marshal(meta{Docs: docs})
+	if err != nil {
+		return nil, err
+	}
+	s.batch++
+	name := fmt.Sprintf("%s/%s/%06d.ndjson", s.index, s.snapshot, s.batch)
+	c := ingest.NewCodec(name, name, buf)
+	return &c, nil
+}
+
+// CleanUp is a no-op because documents are exported, not moved.
+func (s *source) CleanUp(_ context.Context, _ ingest.Codec) error {
+	return nil
+}
+
+// Download requests the documents of the batch and serializes them as NDJSON.
+func (s *source) Download(ctx context.Context, i ingest.Codec) (*ingest.Object, error) {
+	var m meta
+	if err := json.Unmarshal(i.Meta, &m); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal meta: %w", err)
+	}
+	hits, err := s.c.MGet(ctx, m.Docs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get documents: %w", err)
+	}
+	buf := new(bytes.Buffer)
+	e := json.NewEncoder(buf)
+	for _, h := range hits {
+		if err := e.Encode(h); err != nil {
+			return nil, err
+		}
+	}
+
+	return &ingest.Object{
+		Reader:   buf,
+		Len:      int64(buf.Len()),
+		MimeType: "application/x-ndjson",
+	}, nil
+}
+
+func main() {
+	plugin.RunPluginServer(&source{}, &destination{})
+}
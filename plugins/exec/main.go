@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"os/exec"
+	"path"
+	"sync"
+
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/plugin"
+)
+
+// maxStderr is the number of bytes of the standard error of a command that are included in errors.
+const maxStderr = 1024
+
+type sourceConfig struct {
+	// List is the command, followed by its arguments, that lists the objects.
+	// It must print one JSON object per line with the fields "id", "name" and optionally "meta",
+	// where meta can be any JSON value.
+	List []string
+	// Download is the command that writes the object to its standard output.
+	// The ID of the object is appended to the arguments.
+	Download []string
+	// CleanUp is an optional command that cleans up the object.
+	// The ID of the object is appended to the arguments.
+	CleanUp []string
+	// Dir is the working directory of the commands.
+	Dir string
+	// Env holds additional environment variables for the commands.
+	Env map[string]string
+}
+
+// item is a line of the output of the list command.
+type item struct {
+	ID   string          `json:"id"`
+	Name string          `json:"name"`
+	Meta json.RawMessage `json:"meta"`
+}
+
+var _ plugin.Source = &source{}
+
+// source delegates listing, downloading and cleaning up objects to external commands.
+// In addition to the configured environment, the download and clean up commands
+// receive the ID, name and meta of the object in the variables INGEST_ID, INGEST_NAME and INGEST_META.
+type source struct {
+	mu sync.Mutex
+	sc *sourceConfig
+	// items is the output of the last run of the list command that was not yet returned.
+	items []ingest.Codec
+}
+
+// Configure will configure the source with the values given by config.
+func (s *source) Configure(config map[string]interface{}) error {
+	sc := new(sourceConfig)
+	if err := mapstructure.Decode(config, sc); err != nil {
+		return err
+	}
+	if len(sc.List) == 0 {
+		return errors.New("list command must not be empty")
+	}
+	if len(sc.Download) == 0 {
+		return errors.New("download command must not be empty")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sc = sc
+
+	return nil
+}
+
+// Reset runs the list command.
+func (s *source) Reset(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.items = nil
+	stdout := new(bytes.Buffer)
+	if err := s.run(ctx, s.sc.List, nil, stdout); err != nil {
+		return fmt.Errorf("failed to run list command: %w", err)
+	}
+	sc := bufio.NewScanner(stdout)
+	sc.Buffer(nil, 1024*1024)
+	for n := 1; sc.Scan(); n++ {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		var i item
+		if err := json.Unmarshal(sc.Bytes(), &i); err != nil {
+			return fmt.Errorf("failed to decode line %d of list command output: %w", n, err)
+		}
+		if i.ID == "" {
+			return fmt.Errorf("line %d of list command output has no id", n)
+		}
+		if i.Name == "" {
+			i.Name = i.ID
+		}
+		s.items = append(s.items, ingest.NewCodec(i.ID, i.Name, i.Meta))
+	}
+	return sc.Err()
+}
+
+// Next ignores the context in this implementation.
+func (s *source) Next(_ context.Context) (*ingest.Codec, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.items) == 0 {
+		return nil, io.EOF
+	}
+	c := s.items[0]
+	s.items = s.items[1:]
+	return &c, nil
+}
+
+// CleanUp runs the clean up command, if one is configured.
+func (s *source) CleanUp(ctx context.Context, i ingest.Codec) error {
+	if len(s.sc.CleanUp) == 0 {
+		return nil
+	}
+	if err := s.run(ctx, withID(s.sc.CleanUp, i.ID), &i, io.Discard); err != nil {
+		return fmt.Errorf("failed to run clean up command: %w", err)
+	}
+	return nil
+}
+
+// Download runs the download command.
+// The output is buffered in a temporary file, so that the object
+// is only returned if the command succeeds.
+func (s *source) Download(ctx context.Context, i ingest.Codec) (*ingest.Object, error) {
+	f, err := os.CreateTemp("", "ingest-exec-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	// The file remains readable until it is closed.
+	os.Remove(f.Name())
+	if err := s.run(ctx, withID(s.sc.Download, i.ID), &i, f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to run download command: %w", err)
+	}
+	n, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &ingest.Object{
+		Reader:   f,
+		Len:      n,
+		MimeType: mime.TypeByExtension(path.Ext(i.Name)),
+	}, nil
+}
+
+// run runs the given command and writes its standard output to stdout.
+// If a Codec is given, then it is exposed to the command in environment variables.
+func (s *source) run(ctx context.Context, args []string, i *ingest.Codec, stdout io.Writer) error {
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = s.sc.Dir
+	cmd.Env = os.Environ()
+	for k, v := range s.sc.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	if i != nil {
+		cmd.Env = append(cmd.Env, "INGEST_ID="+i.ID, "INGEST_NAME="+i.Name, "INGEST_META="+string(i.Meta))
+	}
+	stderr := new(bytes.Buffer)
+	cmd.Stdout = stdout
+	cmd.Stderr = &limitedWriter{w: stderr, n: maxStderr}
+	if err := cmd.Run(); err != nil {
+		if stderr.Len() != 0 {
+			return fmt.Errorf("%w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+		}
+		return err
+	}
+	return nil
+}
+
+// withID returns a copy of the arguments with the ID appended.
+func withID(args []string, id string) []string {
+	return append(append(make([]string, 0, len(args)+1), args...), id)
+}
+
+// limitedWriter discards everything after the first n bytes.
+type limitedWriter struct {
+	w io.Writer
+	n int
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if l.n > 0 {
+		q := p
+		if len(q) > l.n {
+			q = q[:l.n]
+		}
+		n, err := l.w.Write(q)
+		l.n -= n
+		if err != nil {
+			return n, err
+		}
+	}
+	return len(p), nil
+}
+
+func main() {
+	plugin.RunPluginServer(&source{}, nil)
+}
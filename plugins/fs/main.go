@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/plugin"
+	"github.com/connylabs/ingest/storage"
+	"github.com/connylabs/ingest/storage/filesystem"
+)
+
+type sourceConfig struct {
+	// Directory is the directory in which to look for files.
+	Directory string
+	Recursive bool
+	// Include is a list of glob patterns. If given, only files matching
+	// at least one of the patterns are returned.
+	Include []string
+	// Exclude is a list of glob patterns. Files matching any of the patterns are skipped.
+	Exclude []string
+	// Archive is a directory to which files are moved on clean up.
+	// If empty, files are deleted instead. It is not listed if it is inside of Directory.
+	Archive string
+	// MinAge is the time that must have passed since a file was last modified before it is listed, e.g. 30s,
+	// so that files that are still being written are not ingested truncated and cleaned up.
+	// It defaults to 1m; 0s lists files as soon as they appear.
+	MinAge string
+}
+
+const defaultMinAge = time.Minute
+
+type destinationConfig struct {
+	// Directory is the directory in which to store files.
+	// It is created if it does not exist.
+	Directory string
+}
+
+var _ plugin.Destination = &destination{}
+
+type destination struct {
+	storage.Storage
+}
+
+// Configure will configure the destination with the values given by config.
+func (d *destination) Configure(config map[string]interface{}) error {
+	dc := new(destinationConfig)
+	if err := mapstructure.Decode(config, dc); err != nil {
+		return err
+	}
+	if dc.Directory == "" {
+		return errors.New("directory must not be empty")
+	}
+	if err := os.MkdirAll(dc.Directory, 0o755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	st, err := filesystem.New(dc.Directory)
+	if err != nil {
+		return err
+	}
+
+	d.Storage = st
+
+	return nil
+}
+
+var _ plugin.Source = &source{}
+
+// source can fetch files from a local directory.
+type source struct {
+	mu        sync.Mutex
+	dir       string
+	recursive bool
+	include   []string
+	exclude   []string
+	archive   string
+	minAge    time.Duration
+	now       func() time.Time
+	// dirs is the stack of directories that still need to be read.
+	dirs []string
+	// files is the queue of files that were not yet returned.
+	files []ingest.Codec
+}
+
+// Configure will configure the source with the values given by config.
+func (s *source) Configure(config map[string]interface{}) error {
+	sc := new(sourceConfig)
+	if err := mapstructure.Decode(config, sc); err != nil {
+		return err
+	}
+	if sc.Directory == "" {
+		return errors.New("directory must not be empty")
+	}
+	for _, p := range append(sc.Include, sc.Exclude...) {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", p, err)
+		}
+	}
+	if fi, err := os.Stat(sc.Directory); err != nil {
+		return fmt.Errorf("failed to stat directory: %w", err)
+	} else if !fi.IsDir() {
+		return fmt.Errorf("%q is not a directory", sc.Directory)
+	}
+	dir, err := filepath.Abs(sc.Directory)
+	if err != nil {
+		return fmt.Errorf("failed to resolve directory: %w", err)
+	}
+	minAge := defaultMinAge
+	if sc.MinAge != "" {
+		if minAge, err = time.ParseDuration(sc.MinAge); err != nil {
+			return fmt.Errorf("failed to parse min age: %w", err)
+		}
+	}
+	var archive string
+	if sc.Archive != "" {
+		// The archive is compared with the directories that are listed, so both paths are absolute.
+		if archive, err = filepath.Abs(sc.Archive); err != nil {
+			return fmt.Errorf("failed to resolve archive directory: %w", err)
+		}
+		if archive == dir {
+			return errors.New("archive directory must differ from directory")
+		}
+		if err := os.MkdirAll(archive, 0o755); err != nil {
+			return fmt.Errorf("failed to create archive directory: %w", err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dir = dir
+	s.recursive = sc.Recursive
+	s.include = sc.Include
+	s.exclude = sc.Exclude
+	s.archive = archive
+	s.minAge = minAge
+	if s.now == nil {
+		s.now = time.Now
+	}
+
+	return nil
+}
+
+// Reset resets the Nexter as if it was newly created.
+func (s *source) Reset(_ context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.dirs = []string{s.dir}
+	s.files = nil
+
+	return nil
+}
+
+// Next reads one directory at a time and returns the matching files in it
+// that were not modified within the minimum age.
+// The ID of the returned Codec is the path relative to the configured directory.
+func (s *source) Next(_ context.Context) (*ingest.Codec, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(s.files) == 0 {
+		if len(s.dirs) == 0 {
+			return nil, io.EOF
+		}
+		dir := s.dirs[len(s.dirs)-1]
+		s.dirs = s.dirs[:len(s.dirs)-1]
+		des, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read directory %q: %w", dir, err)
+		}
+		for _, de := range des {
+			p := filepath.Join(dir, de.Name())
+			if de.IsDir() {
+				// Archived files must not be listed again, if the archive is inside the directory.
+				if s.recursive && p != s.archive {
+					s.dirs = append(s.dirs, p)
+				}
+				continue
+			}
+			if !de.Type().IsRegular() {
+				continue
+			}
+			rel, err := filepath.Rel(s.dir, p)
+			if err != nil {
+				return nil, err
+			}
+			if rel = filepath.ToSlash(rel); s.matches(rel) {
+				fi, err := de.Info()
+				if errors.Is(err, fs.ErrNotExist) {
+					continue
+				}
+				if err != nil {
+					return nil, fmt.Errorf("failed to stat file %q: %w", p, err)
+				}
+				mt := fi.ModTime()
+				// The file may still be written, so it is listed again later.
+				if s.now().Sub(mt) < s.minAge {
+					continue
+				}
+				c := ingest.NewCodec(rel, rel, nil)
+				c.Size, c.LastModified = fi.Size(), &mt
+				s.files = append(s.files, c)
+			}
+		}
+	}
+
+	c := s.files[0]
+	s.files = s.files[1:]
+	return &c, nil
+}
+
+// matches checks the include and exclude patterns against
+// the relative path as well as the base name of the file.
+func (s *source) matches(rel string) bool {
+	match := func(patterns []string) bool {
+		for _, p := range patterns {
+			if ok, _ := path.Match(p, rel); ok {
+				return true
+			}
+			if ok, _ := path.Match(p, path.Base(rel)); ok {
+				return true
+			}
+		}
+		return false
+	}
+	if len(s.include) != 0 && !match(s.include) {
+		return false
+	}
+	return !match(s.exclude)
+}
+
+// CleanUp deletes the file or moves it to the archive directory.
+func (s *source) CleanUp(_ context.Context, i ingest.Codec) error {
+	p, err := s.path(i.ID)
+	if err != nil {
+		return err
+	}
+	if s.archive == "" {
+		if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	dst := filepath.Join(s.archive, filepath.FromSlash(i.ID))
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	if err := os.Rename(p, dst); err != nil {
+		// If the file is already in the archive, then the clean up already happened.
+		if _, serr := os.Stat(dst); errors.Is(err, fs.ErrNotExist) && serr == nil {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// Download will open the file.
+func (s *source) Download(_ context.Context, i ingest.Codec) (*ingest.Object, error) {
+	p, err := s.path(i.ID)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to get stat: %w", err)
+	}
+
+	return &ingest.Object{
+		Reader:   f,
+		Len:      stat.Size(),
+		MimeType: mime.TypeByExtension(filepath.Ext(p)),
+	}, nil
+}
+
+// path resolves the ID of a Codec to a path in the configured directory.
+func (s *source) path(id string) (string, error) {
+	p := filepath.Join(s.dir, filepath.FromSlash(id))
+	if rel, err := filepath.Rel(s.dir, p); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%q is not in directory %q", id, s.dir)
+	}
+	return p, nil
+}
+
+func main() {
+	plugin.RunPluginServer(&source{}, &destination{})
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/connylabs/ingest"
+)
+
+// list returns the IDs of all files that the source lists.
+func list(t *testing.T, s *source) []string {
+	t.Helper()
+	require.NoError(t, s.Reset(context.Background()))
+	var ids []string
+	for {
+		c, err := s.Next(context.Background())
+		if err == io.EOF {
+			return ids
+		}
+		require.NoError(t, err)
+		ids = append(ids, c.ID)
+	}
+}
+
+func TestSourceArchive(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "a"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "foo"), []byte("foo"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a", "bar"), []byte("bar"), 0o644))
+
+	s := &source{}
+	require.NoError(t, s.Configure(map[string]interface{}{"directory": dir, "recursive": true, "archive": filepath.Join(dir, "archive"), "minAge": "0s"}))
+	ids := list(t, s)
+	assert.ElementsMatch(t, []string{"foo", "a/bar"}, ids)
+	for _, id := range ids {
+		require.NoError(t, s.CleanUp(context.Background(), ingest.NewCodec(id, id, nil)))
+	}
+	assert.FileExists(t, filepath.Join(dir, "archive", "foo"))
+	assert.FileExists(t, filepath.Join(dir, "archive", "a", "bar"))
+
+	// The archive inside of the directory is not listed again.
+	assert.Empty(t, list(t, s))
+
+	assert.Error(t, s.Configure(map[string]interface{}{"directory": dir, "archive": dir + string(filepath.Separator)}))
+}
+
+func TestSourceMinAge(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "foo"), []byte("foo"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bar"), []byte("bar"), 0o644))
+	old := time.Now().Add(-2 * time.Minute)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "foo"), old, old))
+
+	// Files that were modified within the default minimum age are still being written.
+	s := &source{}
+	require.NoError(t, s.Configure(map[string]interface{}{"directory": dir}))
+	assert.Equal(t, []string{"foo"}, list(t, s))
+
+	s.now = func() time.Time { return time.Now().Add(time.Minute) }
+	assert.ElementsMatch(t, []string{"foo", "bar"}, list(t, s))
+
+	require.NoError(t, s.Configure(map[string]interface{}{"directory": dir, "minAge": "5m"}))
+	assert.Empty(t, list(t, s))
+
+	assert.Error(t, s.Configure(map[string]interface{}{"directory": dir, "minAge": "soon"}))
+}
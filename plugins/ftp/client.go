@@ -0,0 +1,436 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	tlsNone     = "none"
+	tlsExplicit = "explicit"
+	tlsImplicit = "implicit"
+
+	modePassive = "passive"
+	modeActive  = "active"
+
+	dialTimeout = 30 * time.Second
+)
+
+// entry is a single entry of a directory listing.
+type entry struct {
+	name string
+	dir  bool
+	size int64
+}
+
+// conn is a minimal FTP client that supports plain FTP as well as
+// explicit and implicit FTPS in passive and active mode.
+// A conn is not safe for concurrent use.
+type conn struct {
+	nc     net.Conn
+	c      *textproto.Conn
+	tls    *tls.Config
+	active bool
+	// activeHost is the IP address to advertise for active mode data connections.
+	activeHost string
+	noMLSD     bool
+}
+
+type dialConfig struct {
+	address    string
+	user       string
+	password   string
+	tlsMode    string
+	tls        *tls.Config
+	mode       string
+	activeHost string
+}
+
+// dial connects and logs into the FTP server.
+func dial(ctx context.Context, dc *dialConfig) (*conn, error) {
+	d := &net.Dialer{Timeout: dialTimeout}
+	nc, err := d.DialContext(ctx, "tcp", dc.address)
+	if err != nil {
+		return nil, err
+	}
+	if dc.tlsMode == tlsImplicit {
+		nc = tls.Client(nc, dc.tls)
+	}
+	c := &conn{
+		nc:         nc,
+		c:          textproto.NewConn(nc),
+		active:     dc.mode == modeActive,
+		activeHost: dc.activeHost,
+	}
+	if dc.tlsMode != tlsNone {
+		c.tls = dc.tls
+	}
+	if err := c.login(dc); err != nil {
+		c.c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *conn) login(dc *dialConfig) error {
+	if _, _, err := c.c.ReadResponse(220); err != nil {
+		return err
+	}
+	if dc.tlsMode == tlsExplicit {
+		if _, _, err := c.cmd(234, "AUTH TLS"); err != nil {
+			return fmt.Errorf("failed to negotiate TLS: %w", err)
+		}
+		c.nc = tls.Client(c.nc, dc.tls)
+		c.c = textproto.NewConn(c.nc)
+	}
+	user := dc.user
+	if user == "" {
+		user = "anonymous"
+	}
+	code, msg, err := c.cmd(0, "USER %s", user)
+	if err != nil {
+		return err
+	}
+	switch code {
+	case 230:
+	case 331:
+		if _, _, err := c.cmd(230, "PASS %s", dc.password); err != nil {
+			return fmt.Errorf("failed to log in: %w", err)
+		}
+	default:
+		return fmt.Errorf("failed to log in: %d %s", code, msg)
+	}
+	if c.tls != nil {
+		if _, _, err := c.cmd(200, "PBSZ 0"); err != nil {
+			return err
+		}
+		if _, _, err := c.cmd(200, "PROT P"); err != nil {
+			return err
+		}
+	}
+	if _, _, err := c.cmd(200, "TYPE I"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// cmd sends a command and reads the response.
+// If expect is 0, then any response code is accepted.
+func (c *conn) cmd(expect int, format string, args ...interface{}) (int, string, error) {
+	if err := c.nc.SetDeadline(time.Now().Add(dialTimeout)); err != nil {
+		return 0, "", err
+	}
+	defer c.nc.SetDeadline(time.Time{}) //nolint:errcheck
+	id, err := c.c.Cmd(format, args...)
+	if err != nil {
+		return 0, "", err
+	}
+	c.c.StartResponse(id)
+	defer c.c.EndResponse(id)
+	if expect == 0 {
+		return c.c.ReadResponse(-1)
+	}
+	return c.c.ReadResponse(expect)
+}
+
+// transfer opens a data connection for the given command.
+func (c *conn) transfer(format string, args ...interface{}) (net.Conn, error) {
+	var dc net.Conn
+	if c.active {
+		l, err := c.listen()
+		if err != nil {
+			return nil, err
+		}
+		defer l.Close()
+		code, msg, err := c.cmd(0, format, args...)
+		if err != nil {
+			return nil, err
+		}
+		if code != 125 && code != 150 {
+			return nil, &textproto.Error{Code: code, Msg: msg}
+		}
+		if err := l.(*net.TCPListener).SetDeadline(time.Now().Add(dialTimeout)); err != nil {
+			return nil, err
+		}
+		if dc, err = l.Accept(); err != nil {
+			return nil, fmt.Errorf("failed to accept data connection: %w", err)
+		}
+	} else {
+		addr, err := c.passive()
+		if err != nil {
+			return nil, err
+		}
+		if dc, err = net.DialTimeout("tcp", addr, dialTimeout); err != nil {
+			return nil, fmt.Errorf("failed to open data connection: %w", err)
+		}
+		code, msg, err := c.cmd(0, format, args...)
+		if err != nil {
+			dc.Close()
+			return nil, err
+		}
+		if code != 125 && code != 150 {
+			dc.Close()
+			return nil, &textproto.Error{Code: code, Msg: msg}
+		}
+	}
+	if c.tls != nil {
+		cfg := c.tls.Clone()
+		if cfg.ServerName == "" {
+			cfg.ServerName, _, _ = net.SplitHostPort(c.nc.RemoteAddr().String())
+		}
+		dc = tls.Client(dc, cfg)
+	}
+	return dc, nil
+}
+
+// passive requests a passive data connection and returns the address to dial.
+// The host of the control connection is always used, since servers behind NAT
+// often advertise unreachable addresses.
+func (c *conn) passive() (string, error) {
+	host, _, err := net.SplitHostPort(c.nc.RemoteAddr().String())
+	if err != nil {
+		return "", err
+	}
+	if code, msg, err := c.cmd(0, "EPSV"); err == nil && code == 229 {
+		if port, ok := parseEPSV(msg); ok {
+			return net.JoinHostPort(host, port), nil
+		}
+	}
+	_, msg, err := c.cmd(227, "PASV")
+	if err != nil {
+		return "", err
+	}
+	port, err := parsePASV(msg)
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// parseEPSV returns the port of a reply like "229 Entering Extended Passive Mode (|||6446|)".
+func parseEPSV(msg string) (string, bool) {
+	start, end := strings.Index(msg, "("), strings.LastIndex(msg, ")")
+	if start < 0 || end < start {
+		return "", false
+	}
+	parts := strings.Split(msg[start+1:end], "|")
+	if len(parts) != 5 {
+		return "", false
+	}
+	if _, err := strconv.ParseUint(parts[3], 10, 16); err != nil {
+		return "", false
+	}
+	return parts[3], true
+}
+
+// parsePASV returns the port of a reply like "227 Entering Passive Mode (h1,h2,h3,h4,p1,p2)".
+// The host is ignored.
+func parsePASV(msg string) (string, error) {
+	start, end := strings.Index(msg, "("), strings.LastIndex(msg, ")")
+	if start < 0 || end < start {
+		return "", fmt.Errorf("invalid PASV response: %s", msg)
+	}
+	parts := strings.Split(msg[start+1:end], ",")
+	if len(parts) != 6 {
+		return "", fmt.Errorf("invalid PASV response: %s", msg)
+	}
+	p1, err := strconv.ParseUint(strings.TrimSpace(parts[4]), 10, 8)
+	if err != nil {
+		return "", fmt.Errorf("invalid PASV response: %s", msg)
+	}
+	p2, err := strconv.ParseUint(strings.TrimSpace(parts[5]), 10, 8)
+	if err != nil {
+		return "", fmt.Errorf("invalid PASV response: %s", msg)
+	}
+	return strconv.FormatUint(p1<<8|p2, 10), nil
+}
+
+// listen opens a listener for an active data connection and announces it with PORT or EPRT.
+func (c *conn) listen() (net.Listener, error) {
+	host := c.activeHost
+	if host == "" {
+		var err error
+		if host, _, err = net.SplitHostPort(c.nc.LocalAddr().String()); err != nil {
+			return nil, err
+		}
+	}
+	l, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for data connection: %w", err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	ip := net.ParseIP(host)
+	if ip4 := ip.To4(); ip4 != nil {
+		_, _, err = c.cmd(200, "PORT %d,%d,%d,%d,%d,%d", ip4[0], ip4[1], ip4[2], ip4[3], port>>8, port&0xff)
+	} else {
+		_, _, err = c.cmd(200, "EPRT |2|%s|%d|", host, port)
+	}
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// list returns the entries of the given directory.
+// MLSD is preferred; if the server does not support it,
+// then the output of LIST is parsed.
+func (c *conn) list(dir string) ([]entry, error) {
+	if !c.noMLSD {
+		es, err := c.read(parseMLSD, "MLSD %s", dir)
+		var terr *textproto.Error
+		if !errors.As(err, &terr) || terr.Code < 500 {
+			return es, err
+		}
+		c.noMLSD = true
+	}
+	return c.read(parseLIST, "LIST %s", dir)
+}
+
+func (c *conn) read(parse func(string) (entry, bool), format string, args ...interface{}) ([]entry, error) {
+	dc, err := c.transfer(format, args...)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := io.ReadAll(dc)
+	dc.Close()
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := c.c.ReadResponse(2); err != nil {
+		return nil, err
+	}
+	var es []entry
+	for _, l := range strings.Split(string(buf), "\n") {
+		l = strings.TrimRight(l, "\r")
+		if l == "" {
+			continue
+		}
+		if e, ok := parse(l); ok && e.name != "." && e.name != ".." {
+			es = append(es, e)
+		}
+	}
+	return es, nil
+}
+
+// parseMLSD parses a line like "type=file;size=42;modify=20220101000000; name".
+func parseMLSD(l string) (entry, bool) {
+	i := strings.Index(l, " ")
+	if i < 0 {
+		return entry{}, false
+	}
+	e := entry{name: path.Base(l[i+1:])}
+	for _, f := range strings.Split(l[:i], ";") {
+		kv := strings.SplitN(f, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch strings.ToLower(kv[0]) {
+		case "type":
+			switch strings.ToLower(kv[1]) {
+			case "file":
+			case "dir":
+				e.dir = true
+			default:
+				return entry{}, false
+			}
+		case "size":
+			e.size, _ = strconv.ParseInt(kv[1], 10, 64)
+		}
+	}
+	return e, true
+}
+
+// parseLIST parses the Unix and DOS style output of LIST.
+func parseLIST(l string) (entry, bool) {
+	fields := strings.Fields(l)
+	switch {
+	case len(fields) >= 9 && strings.ContainsAny(l[:1], "-dl"):
+		// -rw-r--r-- 1 user group 42 Jan 1 12:00 name
+		if l[0] == 'l' {
+			return entry{}, false
+		}
+		size, _ := strconv.ParseInt(fields[4], 10, 64)
+		name := l
+		for i := 0; i < 8; i++ {
+			name = strings.TrimLeft(name, " ")
+			name = name[strings.Index(name, " "):]
+		}
+		return entry{name: strings.TrimLeft(name, " "), dir: l[0] == 'd', size: size}, true
+	case len(fields) >= 4:
+		// 01-01-22  12:00PM  <DIR>  name
+		// 01-01-22  12:00PM  42 name
+		name := l
+		for i := 0; i < 3; i++ {
+			name = strings.TrimLeft(name, " ")
+			name = name[strings.Index(name, " "):]
+		}
+		e := entry{name: strings.TrimLeft(name, " ")}
+		if fields[2] == "<DIR>" {
+			e.dir = true
+		} else {
+			var err error
+			if e.size, err = strconv.ParseInt(fields[2], 10, 64); err != nil {
+				return entry{}, false
+			}
+		}
+		return e, true
+	}
+	return entry{}, false
+}
+
+// retrieve opens the file for reading.
+// The returned ReadCloser must be closed to complete the transfer.
+func (c *conn) retrieve(name string) (io.ReadCloser, error) {
+	dc, err := c.transfer("RETR %s", name)
+	if err != nil {
+		return nil, err
+	}
+	return &response{Conn: dc, c: c}, nil
+}
+
+// response completes a transfer on the control connection when closed.
+type response struct {
+	net.Conn
+	c *conn
+}
+
+func (r *response) Close() error {
+	if err := r.Conn.Close(); err != nil {
+		return err
+	}
+	_, _, err := r.c.c.ReadResponse(2)
+	return err
+}
+
+func (c *conn) size(name string) (int64, error) {
+	_, msg, err := c.cmd(213, "SIZE %s", name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(msg), 10, 64)
+}
+
+func (c *conn) delete(name string) error {
+	_, _, err := c.cmd(250, "DELE %s", name)
+	return err
+}
+
+func (c *conn) noop() error {
+	_, _, err := c.cmd(200, "NOOP")
+	return err
+}
+
+func (c *conn) close() error {
+	c.cmd(221, "QUIT") //nolint:errcheck
+	return c.c.Close()
+}
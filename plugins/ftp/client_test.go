@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMLSD(t *testing.T) {
+	for _, tc := range []struct {
+		line string
+		e    entry
+		ok   bool
+	}{
+		{line: "type=file;size=42;modify=20220101000000; foo.txt", e: entry{name: "foo.txt", size: 42}, ok: true},
+		{line: "Type=DIR;Modify=20220101000000; bar", e: entry{name: "bar", dir: true}, ok: true},
+		{line: "type=file;size=1; with spaces.txt", e: entry{name: "with spaces.txt", size: 1}, ok: true},
+		{line: "type=file;size=1; /abs/path/baz", e: entry{name: "baz", size: 1}, ok: true},
+		{line: "type=cdir; .", ok: false},
+		{line: "type=pdir; ..", ok: false},
+		{line: "type=OS.unix=symlink; link", ok: false},
+		{line: "nospace", ok: false},
+	} {
+		e, ok := parseMLSD(tc.line)
+		assert.Equal(t, tc.ok, ok, tc.line)
+		if tc.ok {
+			assert.Equal(t, tc.e, e, tc.line)
+		}
+	}
+}
+
+func TestParseLIST(t *testing.T) {
+	for _, tc := range []struct {
+		line string
+		e    entry
+		ok   bool
+	}{
+		{line: "-rw-r--r--    1 user     group          42 Jan  1 12:00 foo.txt", e: entry{name: "foo.txt", size: 42}, ok: true},
+		{line: "drwxr-xr-x    2 user     group        4096 Jan  1  2022 bar", e: entry{name: "bar", dir: true, size: 4096}, ok: true},
+		{line: "-rw-r--r--    1 user     group           1 Jan  1 12:00 with  spaces.txt", e: entry{name: "with  spaces.txt", size: 1}, ok: true},
+		{line: "lrwxrwxrwx    1 user     group           3 Jan  1 12:00 link -> foo", ok: false},
+		{line: "01-01-22  12:00PM       <DIR>          bar", e: entry{name: "bar", dir: true}, ok: true},
+		{line: "01-01-22  12:00PM                   42 foo.txt", e: entry{name: "foo.txt", size: 42}, ok: true},
+		{line: "01-01-22  12:00PM             invalid foo.txt", ok: false},
+		{line: "total 42", ok: false},
+	} {
+		e, ok := parseLIST(tc.line)
+		assert.Equal(t, tc.ok, ok, tc.line)
+		if tc.ok {
+			assert.Equal(t, tc.e, e, tc.line)
+		}
+	}
+}
+
+func TestParsePassive(t *testing.T) {
+	for _, tc := range []struct {
+		msg  string
+		port string
+		ok   bool
+	}{
+		{msg: "Entering Extended Passive Mode (|||6446|)", port: "6446", ok: true},
+		{msg: "Entering Extended Passive Mode (|||6446)", ok: false},
+		{msg: "Entering Extended Passive Mode (|||port|)", ok: false},
+		{msg: "Entering Extended Passive Mode", ok: false},
+	} {
+		port, ok := parseEPSV(tc.msg)
+		assert.Equal(t, tc.ok, ok, tc.msg)
+		assert.Equal(t, tc.port, port, tc.msg)
+	}
+	for _, tc := range []struct {
+		msg  string
+		port string
+		ok   bool
+	}{
+		{msg: "Entering Passive Mode (192,168,1,2,25,46).", port: "6446", ok: true},
+		{msg: "Entering Passive Mode (10,0,0,1, 0, 21)", port: "21", ok: true},
+		{msg: "Entering Passive Mode (192,168,1,2,25)", ok: false},
+		{msg: "Entering Passive Mode (192,168,1,2,256,46)", ok: false},
+		{msg: "Entering Passive Mode 192,168,1,2,25,46", ok: false},
+	} {
+		port, err := parsePASV(tc.msg)
+		if !tc.ok {
+			assert.Error(t, err, tc.msg)
+			continue
+		}
+		assert.NoError(t, err, tc.msg)
+		assert.Equal(t, tc.port, port, tc.msg)
+	}
+}
+
+// fakeServer is an FTP server that serves files from memory over plain FTP in passive mode.
+type fakeServer struct {
+	l net.Listener
+
+	mu    sync.Mutex
+	files map[string]string
+	// noSize and noMLSD make the server reject the SIZE and MLSD extensions like legacy servers.
+	noSize bool
+	noMLSD bool
+	// deleteCode overrides the reply to DELE, if it is not 0.
+	deleteCode int
+}
+
+func newFakeServer(t *testing.T, files map[string]string) *fakeServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &fakeServer{l: l, files: files}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(c)
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) addr() string {
+	return s.l.Addr().String()
+}
+
+func (s *fakeServer) serve(nc net.Conn) {
+	defer nc.Close()
+	c := textproto.NewConn(nc)
+	reply := func(code int, msg string) {
+		c.PrintfLine("%d %s", code, msg) //nolint:errcheck
+	}
+	reply(220, "ready")
+	var data net.Listener
+	defer func() {
+		if data != nil {
+			data.Close()
+		}
+	}()
+	// send writes the output of a transfer to the data connection.
+	send := func(out string) {
+		if data == nil {
+			reply(425, "use EPSV first")
+			return
+		}
+		reply(150, "opening data connection")
+		dc, err := data.Accept()
+		data.Close()
+		data = nil
+		if err != nil {
+			return
+		}
+		w := bufio.NewWriter(dc)
+		w.WriteString(out) //nolint:errcheck
+		w.Flush()          //nolint:errcheck
+		dc.Close()
+		reply(226, "transfer complete")
+	}
+	for {
+		l, err := c.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(l, " ")
+		s.mu.Lock()
+		content, exists := s.files[arg]
+		noSize, noMLSD := s.noSize, s.noMLSD
+		s.mu.Unlock()
+		switch strings.ToUpper(cmd) {
+		case "USER":
+			reply(331, "password required")
+		case "PASS":
+			reply(230, "logged in")
+		case "TYPE", "NOOP":
+			reply(200, "ok")
+		case "QUIT":
+			reply(221, "bye")
+			return
+		case "EPSV":
+			if data, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+				reply(425, err.Error())
+				continue
+			}
+			reply(229, fmt.Sprintf("Entering Extended Passive Mode (|||%d|)", data.Addr().(*net.TCPAddr).Port))
+		case "SIZE":
+			switch {
+			case noSize:
+				reply(502, "command not implemented")
+			case !exists:
+				reply(550, "no such file")
+			default:
+				reply(213, fmt.Sprint(len(content)))
+			}
+		case "RETR":
+			if !exists {
+				reply(550, "no such file")
+				continue
+			}
+			send(content)
+		case "MLSD":
+			if noMLSD {
+				reply(500, "unknown command")
+				continue
+			}
+			send(s.list(arg, func(e entry) string {
+				if e.dir {
+					return "type=dir;modify=20220101000000; " + e.name
+				}
+				return fmt.Sprintf("type=file;size=%d;modify=20220101000000; %s", e.size, e.name)
+			}))
+		case "LIST":
+			send(s.list(arg, func(e entry) string {
+				if e.dir {
+					return "drwxr-xr-x    2 user     group        4096 Jan  1 12:00 " + e.name
+				}
+				return fmt.Sprintf("-rw-r--r--    1 user     group    %8d Jan  1 12:00 %s", e.size, e.name)
+			}))
+		case "DELE":
+			s.mu.Lock()
+			switch {
+			case s.deleteCode != 0:
+				reply(s.deleteCode, "cannot delete")
+			case !exists:
+				reply(550, "no such file")
+			default:
+				delete(s.files, arg)
+				reply(250, "deleted")
+			}
+			s.mu.Unlock()
+		default:
+			reply(502, "command not implemented")
+		}
+	}
+}
+
+// list formats the files and directories in the given directory.
+func (s *fakeServer) list(dir string, format func(entry) string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	es := make(map[string]entry)
+	for p, content := range s.files {
+		rel := strings.TrimPrefix(p, path.Clean(dir)+"/")
+		if rel == p {
+			continue
+		}
+		if name, _, ok := strings.Cut(rel, "/"); ok {
+			es[name] = entry{name: name, dir: true}
+			continue
+		}
+		es[rel] = entry{name: rel, size: int64(len(content))}
+	}
+	lines := make([]string, 0, len(es))
+	for _, e := range es {
+		lines = append(lines, format(e)+"\r\n")
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "")
+}
+
+func TestConn(t *testing.T) {
+	s := newFakeServer(t, map[string]string{"dir/foo": "hello", "dir/sub/bar": "world"})
+	dc := &dialConfig{address: s.addr(), user: "user", password: "password", tlsMode: tlsNone, mode: modePassive}
+
+	for _, noMLSD := range []bool{false, true} {
+		s.mu.Lock()
+		s.noMLSD = noMLSD
+		s.mu.Unlock()
+		c, err := dial(context.Background(), dc)
+		require.NoError(t, err)
+		es, err := c.list("dir")
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []entry{{name: "foo", size: 5}, {name: "sub", dir: true, size: func() int64 {
+			if noMLSD {
+				return 4096
+			}
+			return 0
+		}()}}, es, "noMLSD=%t", noMLSD)
+		require.NoError(t, c.close())
+	}
+
+	c, err := dial(context.Background(), dc)
+	require.NoError(t, err)
+	t.Cleanup(func() { c.close() })
+	size, err := c.size("dir/foo")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), size)
+
+	r, err := c.retrieve("dir/foo")
+	require.NoError(t, err)
+	b, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	assert.Equal(t, "hello", string(b))
+
+	_, err = c.retrieve("dir/missing")
+	var terr *textproto.Error
+	require.ErrorAs(t, err, &terr)
+	assert.Equal(t, 550, terr.Code)
+
+	require.NoError(t, c.delete("dir/foo"))
+	require.ErrorAs(t, c.delete("dir/foo"), &terr)
+	assert.Equal(t, 550, terr.Code)
+	require.NoError(t, c.noop())
+}
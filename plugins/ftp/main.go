@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/textproto"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/plugin"
+)
+
+type sourceConfig struct {
+	// Address is the host and optional port of the FTP server.
+	Address  string
+	User     string
+	Password string
+	// TLS is either "none", "explicit" or "implicit".
+	TLS                string
+	InsecureSkipVerify bool
+	// CAFile is the path to a PEM encoded certificate bundle used to verify the server.
+	CAFile string
+	// Mode is either "passive" or "active".
+	Mode string
+	// ActiveAddress is the IP address to announce for active mode data connections.
+	// It defaults to the local address of the control connection.
+	ActiveAddress string
+	// Root is the directory in which to look for files.
+	Root      string
+	Recursive bool
+}
+
+var _ plugin.Source = &source{}
+
+// source can fetch files from an FTP server.
+type source struct {
+	mu        sync.Mutex
+	dc        *dialConfig
+	c         *conn
+	root      string
+	recursive bool
+	// dirs is the stack of directories that still need to be listed.
+	dirs []string
+	// files is the queue of listed files that were not yet returned.
+	files []file
+}
+
+// file is a listed file and its path.
+type file struct {
+	entry
+	path string
+}
+
+// Configure will configure the source with the values given by config.
+func (s *source) Configure(config map[string]interface{}) error {
+	sc := new(sourceConfig)
+	if err := mapstructure.Decode(config, sc); err != nil {
+		return err
+	}
+	if sc.Address == "" {
+		return errors.New("address must not be empty")
+	}
+	if sc.TLS == "" {
+		sc.TLS = tlsNone
+	}
+	if sc.Mode == "" {
+		sc.Mode = modePassive
+	}
+	host, _, err := net.SplitHostPort(sc.Address)
+	if err != nil {
+		host = sc.Address
+		port := "21"
+		if sc.TLS == tlsImplicit {
+			port = "990"
+		}
+		sc.Address = net.JoinHostPort(host, port)
+	}
+
+	dc := &dialConfig{
+		address:    sc.Address,
+		user:       sc.User,
+		password:   sc.Password,
+		tlsMode:    sc.TLS,
+		activeHost: sc.ActiveAddress,
+		mode:       sc.Mode,
+	}
+	switch sc.Mode {
+	case modePassive, modeActive:
+	default:
+		return fmt.Errorf("unknown mode %q; possible values are: %s, %s", sc.Mode, modePassive, modeActive)
+	}
+	switch sc.TLS {
+	case tlsNone:
+	case tlsExplicit, tlsImplicit:
+		dc.tls = &tls.Config{
+			ServerName:         host,
+			InsecureSkipVerify: sc.InsecureSkipVerify, //nolint:gosec
+			// Many servers require data connections to reuse the TLS session of the control connection.
+			ClientSessionCache: tls.NewLRUClientSessionCache(0),
+		}
+		if sc.CAFile != "" {
+			ca, err := os.ReadFile(sc.CAFile)
+			if err != nil {
+				return fmt.Errorf("failed to read CA file: %w", err)
+			}
+			dc.tls.RootCAs = x509.NewCertPool()
+			if !dc.tls.RootCAs.AppendCertsFromPEM(ca) {
+				return errors.New("failed to parse CA file")
+			}
+		}
+	default:
+		return fmt.Errorf("unknown TLS mode %q; possible values are: %s, %s, %s", sc.TLS, tlsNone, tlsExplicit, tlsImplicit)
+	}
+
+	c, err := dial(context.Background(), dc)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %q: %w", sc.Address, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.c != nil {
+		s.c.close()
+	}
+	s.dc = dc
+	s.c = c
+	s.root = sc.Root
+	if s.root == "" {
+		s.root = "."
+	}
+	s.recursive = sc.Recursive
+
+	return nil
+}
+
+// Reset resets the Nexter as if it was newly created.
+// If the connection to the server was lost, Reset will reconnect.
+func (s *source) Reset(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.c.noop(); err != nil {
+		s.c.close()
+		c, err := dial(ctx, s.dc)
+		if err != nil {
+			return fmt.Errorf("failed to reconnect: %w", err)
+		}
+		s.c = c
+	}
+	s.dirs = []string{s.root}
+	s.files = nil
+
+	return nil
+}
+
+// Next lists one directory at a time and returns the files in it.
+func (s *source) Next(_ context.Context) (*ingest.Codec, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(s.files) == 0 {
+		if len(s.dirs) == 0 {
+			return nil, io.EOF
+		}
+		dir := s.dirs[len(s.dirs)-1]
+		s.dirs = s.dirs[:len(s.dirs)-1]
+		es, err := s.c.list(dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %q: %w", dir, err)
+		}
+		for _, e := range es {
+			p := path.Join(dir, e.name)
+			if e.dir {
+				if s.recursive {
+					s.dirs = append(s.dirs, p)
+				}
+				continue
+			}
+			s.files = append(s.files, file{entry: e, path: p})
+		}
+	}
+
+	f := s.files[0]
+	s.files = s.files[1:]
+	name := strings.TrimPrefix(f.path, strings.TrimSuffix(path.Clean(s.root), "/")+"/")
+	c := ingest.NewCodec(f.path, name, nil)
+	c.Size = f.size
+	return &c, nil
+}
+
+// CleanUp deletes the file from the server.
+func (s *source) CleanUp(ctx context.Context, i ingest.Codec) error {
+	c, err := dial(ctx, s.dc)
+	if err != nil {
+		return err
+	}
+	defer c.close()
+	if err := c.delete(i.ID); err != nil {
+		// If the file does not exist anymore, then the clean up already happened.
+		var terr *textproto.Error
+		if errors.As(err, &terr) && terr.Code == 550 {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// Download opens a dedicated connection for every download,
+// since an FTP control connection can only serve one transfer at a time.
+func (s *source) Download(ctx context.Context, i ingest.Codec) (*ingest.Object, error) {
+	c, err := dial(ctx, s.dc)
+	if err != nil {
+		return nil, err
+	}
+	// SIZE is an extension that legacy servers may not support,
+	// so the size falls back to the size in the listing, if any, or is unknown.
+	size, err := c.size(i.ID)
+	if err != nil {
+		size = -1
+		if i.Size > 0 {
+			size = i.Size
+		}
+	}
+	r, err := c.retrieve(i.ID)
+	if err != nil {
+		c.close()
+		return nil, fmt.Errorf("failed to retrieve file: %w", err)
+	}
+
+	return &ingest.Object{
+		Reader:   &object{ReadCloser: r, c: c},
+		Len:      size,
+		MimeType: mime.TypeByExtension(path.Ext(i.ID)),
+	}, nil
+}
+
+// object closes the connection once the transfer is complete.
+type object struct {
+	io.ReadCloser
+	c *conn
+}
+
+func (o *object) Close() error {
+	defer o.c.close()
+	return o.ReadCloser.Close()
+}
+
+func main() {
+	plugin.RunPluginServer(&source{}, nil)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/connylabs/ingest"
+)
+
+func TestSource(t *testing.T) {
+	ctx := context.Background()
+	srv := newFakeServer(t, map[string]string{"dir/foo": "hello", "dir/sub/bar": "world"})
+	s := &source{}
+	require.NoError(t, s.Configure(map[string]interface{}{"address": srv.addr(), "root": "dir", "recursive": true}))
+	t.Cleanup(func() { s.c.close() })
+
+	require.NoError(t, s.Reset(ctx))
+	var codecs []ingest.Codec
+	for {
+		c, err := s.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		codecs = append(codecs, *c)
+	}
+	require.Len(t, codecs, 2)
+	byName := map[string]ingest.Codec{}
+	for _, c := range codecs {
+		byName[c.Name] = c
+	}
+	assert.Equal(t, "dir/foo", byName["foo"].ID)
+	assert.Equal(t, int64(5), byName["foo"].Size)
+	assert.Equal(t, "dir/sub/bar", byName["sub/bar"].ID)
+
+	t.Run("Download", func(t *testing.T) {
+		for _, tc := range []struct {
+			name   string
+			noSize bool
+			codec  ingest.Codec
+			len    int64
+		}{
+			{name: "SIZE", codec: byName["foo"], len: 5},
+			// Legacy servers without SIZE fall back to the size in the listing.
+			{name: "listing", noSize: true, codec: byName["foo"], len: 5},
+			{name: "unknown", noSize: true, codec: ingest.NewCodec("dir/foo", "foo", nil), len: -1},
+		} {
+			srv.mu.Lock()
+			srv.noSize = tc.noSize
+			srv.mu.Unlock()
+			o, err := s.Download(ctx, tc.codec)
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, tc.len, o.Len, tc.name)
+			b, err := io.ReadAll(o.Reader)
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, "hello", string(b), tc.name)
+			require.NoError(t, o.Reader.(io.Closer).Close(), tc.name)
+		}
+	})
+
+	t.Run("CleanUp", func(t *testing.T) {
+		// Errors other than a missing file are returned, even if the server does not support SIZE.
+		srv.mu.Lock()
+		srv.noSize, srv.deleteCode = true, 450
+		srv.mu.Unlock()
+		assert.Error(t, s.CleanUp(ctx, byName["foo"]))
+
+		srv.mu.Lock()
+		srv.deleteCode = 0
+		srv.mu.Unlock()
+		require.NoError(t, s.CleanUp(ctx, byName["foo"]))
+		srv.mu.Lock()
+		_, ok := srv.files["dir/foo"]
+		srv.mu.Unlock()
+		assert.False(t, ok)
+		// The file was already deleted.
+		assert.NoError(t, s.CleanUp(ctx, byName["foo"]))
+	})
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	storage "google.golang.org/api/storage/v1"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/plugin"
+)
+
+type sourceConfig struct {
+	// APIKey can be used to access public buckets.
+	APIKey string
+	// CredentialsFile is the path to a service account JSON key file.
+	CredentialsFile string
+	// CredentialsJSON is the content of a service account JSON key file.
+	CredentialsJSON string `mapstructure:"credentialsJSON"`
+	// If neither of the above is given, then the application default credentials
+	// are used, e.g. workload identity when running in GKE.
+	Bucket    string
+	Prefix    string
+	Recursive bool
+}
+
+var _ plugin.Source = &source{}
+
+// source can fetch objects from the Google Cloud Storage API.
+type source struct {
+	mu        sync.Mutex
+	s         *storage.Service
+	bucket    string
+	prefix    string
+	recursive bool
+	// objects is the current page of listed objects.
+	objects []*storage.Object
+	// pageToken is the token of the next page. If empty, there are no more pages.
+	pageToken string
+	started   bool
+}
+
+// Configure will configure the source with the values given by config.
+func (s *source) Configure(config map[string]interface{}) error {
+	sc := new(sourceConfig)
+	if err := mapstructure.Decode(config, sc); err != nil {
+		return err
+	}
+	if sc.Bucket == "" {
+		return errors.New("bucket must not be empty")
+	}
+	o := []option.ClientOption{option.WithScopes(storage.DevstorageReadWriteScope)}
+	if sc.APIKey != "" {
+		o = append(o, option.WithAPIKey(sc.APIKey))
+	}
+	if sc.CredentialsFile != "" {
+		o = append(o, option.WithCredentialsFile(sc.CredentialsFile))
+	}
+	if sc.CredentialsJSON != "" {
+		o = append(o, option.WithCredentialsJSON([]byte(sc.CredentialsJSON)))
+	}
+	gs, err := storage.NewService(context.TODO(), o...)
+	if err != nil {
+		return fmt.Errorf("failed to create storage service: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.s = gs
+	s.bucket = sc.Bucket
+	s.prefix = sc.Prefix
+	s.recursive = sc.Recursive
+
+	return nil
+}
+
+// Reset resets the Nexter as if it was newly created.
+func (s *source) Reset(_ context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.objects = nil
+	s.pageToken = ""
+	s.started = false
+
+	return nil
+}
+
+// Next lists one page of objects at a time.
+func (s *source) Next(ctx context.Context) (*ingest.Codec, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(s.objects) == 0 {
+		if s.started && s.pageToken == "" {
+			return nil, io.EOF
+		}
+		call := s.s.Objects.List(s.bucket).Prefix(s.prefix).PageToken(s.pageToken).Fields("nextPageToken", "items(name,size,updated)").Context(ctx)
+		if !s.recursive {
+			call = call.Delimiter("/")
+		}
+		objs, err := call.Do()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects: %w", err)
+		}
+		s.started = true
+		s.objects = objs.Items
+		s.pageToken = objs.NextPageToken
+	}
+
+	o := s.objects[0]
+	s.objects = s.objects[1:]
+	c := ingest.NewCodec(o.Name, strings.TrimPrefix(o.Name, s.prefix), nil)
+	c.Size = int64(o.Size)
+	if t, err := time.Parse(time.RFC3339, o.Updated); err == nil {
+		c.LastModified = &t
+	}
+	return &c, nil
+}
+
+// CleanUp deletes the object from the bucket.
+func (s *source) CleanUp(ctx context.Context, i ingest.Codec) error {
+	if err := s.s.Objects.Delete(s.bucket, i.ID).Context(ctx).Do(); err != nil && !isNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// Download will take an Element and download it from GCS.
+func (s *source) Download(ctx context.Context, i ingest.Codec) (*ingest.Object, error) {
+	res, err := s.s.Objects.Get(s.bucket, i.ID).Context(ctx).Download()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object: %w", err)
+	}
+
+	return &ingest.Object{
+		Reader:   res.Body,
+		Len:      res.ContentLength,
+		MimeType: res.Header.Get("Content-Type"),
+	}, nil
+}
+
+func isNotFound(err error) bool {
+	var gerr *googleapi.Error
+	return errors.As(err, &gerr) && gerr.Code == http.StatusNotFound
+}
+
+func main() {
+	plugin.RunPluginServer(&source{}, nil)
+}
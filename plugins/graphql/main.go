@@ -0,0 +1,363 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/plugin"
+)
+
+type sourceConfig struct {
+	// URL is the GraphQL endpoint.
+	URL string `mapstructure:"url"`
+	// Headers are added to all requests to the endpoint, e.g. for API keys.
+	Headers     map[string]string
+	BearerToken string
+	Username    string
+	Password    string
+	// Query is the GraphQL query that lists the items.
+	Query string
+	// Variables are passed to the query.
+	Variables map[string]interface{}
+	// CursorVariable is the name of the variable that is set to the cursor of the next page.
+	// It is omitted for the first page. If empty, only one page is requested.
+	CursorVariable string
+	// Items, CursorField and HasNextPageField are dot separated paths in the data of the response.
+	Items string
+	// CursorField is the path to the cursor of the next page, e.g. repository.releases.pageInfo.endCursor.
+	CursorField string
+	// HasNextPageField is the optional path to a boolean that is false on the last page.
+	// If empty, pages are requested until a page contains no items or no cursor.
+	HasNextPageField string
+	// IDField, NameField and URLField are dot separated paths in an item.
+	// NameField defaults to IDField.
+	IDField   string `mapstructure:"idField"`
+	NameField string
+	// URLField is the path to the URL from which the object is downloaded.
+	// Relative URLs are resolved against the URL of the endpoint.
+	URLField string `mapstructure:"urlField"`
+	// AuthenticateDownloads sends the headers and credentials also when downloading objects.
+	// It is disabled by default because objects are often served from pre-signed URLs
+	// that reject additional credentials.
+	AuthenticateDownloads bool
+	// CleanUpMutation is an optional GraphQL mutation that is sent to clean up an item.
+	// The ID of the item is passed as the variable "id".
+	CleanUpMutation string
+}
+
+// meta is stored in the Meta field of a Codec.
+type meta struct {
+	URL string `json:"url"`
+}
+
+type request struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables,omitempty"`
+}
+
+type response struct {
+	Data   interface{} `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+var _ plugin.Source = &source{}
+
+// source can list items with a paginated GraphQL query and download the objects they reference.
+type source struct {
+	mu   sync.Mutex
+	sc   *sourceConfig
+	base *url.URL
+	c    *http.Client
+	// items is the current page of items.
+	items []ingest.Codec
+	// cursor is the cursor of the next page.
+	cursor  string
+	done    bool
+	started bool
+}
+
+// Configure will configure the source with the values given by config.
+func (s *source) Configure(config map[string]interface{}) error {
+	sc := new(sourceConfig)
+	if err := mapstructure.Decode(config, sc); err != nil {
+		return err
+	}
+	if sc.URL == "" {
+		return errors.New("url must not be empty")
+	}
+	u, err := url.Parse(sc.URL)
+	if err != nil {
+		return fmt.Errorf("failed to parse url: %w", err)
+	}
+	if sc.Query == "" {
+		return errors.New("query must not be empty")
+	}
+	if sc.CursorVariable != "" && sc.CursorField == "" {
+		return errors.New("cursorField must not be empty if cursorVariable is given")
+	}
+	if sc.IDField == "" {
+		return errors.New("idField must not be empty")
+	}
+	if sc.URLField == "" {
+		return errors.New("urlField must not be empty")
+	}
+	if sc.NameField == "" {
+		sc.NameField = sc.IDField
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sc = sc
+	s.base = u
+	s.c = http.DefaultClient
+
+	return nil
+}
+
+// Reset resets the Nexter as if it was newly created.
+func (s *source) Reset(_ context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.items = nil
+	s.cursor = ""
+	s.done = false
+	s.started = false
+
+	return nil
+}
+
+// Next requests one page of items at a time.
+func (s *source) Next(ctx context.Context) (*ingest.Codec, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(s.items) == 0 {
+		if s.done {
+			return nil, io.EOF
+		}
+		if err := s.list(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	c := s.items[0]
+	s.items = s.items[1:]
+	return &c, nil
+}
+
+// list requests the next page and determines the cursor of the page after it.
+// It must be called with the mutex held.
+func (s *source) list(ctx context.Context) error {
+	vars := make(map[string]interface{}, len(s.sc.Variables)+1)
+	for k, v := range s.sc.Variables {
+		vars[k] = v
+	}
+	if s.started && s.sc.CursorVariable != "" {
+		vars[s.sc.CursorVariable] = s.cursor
+	}
+	s.started = true
+	data, err := s.query(ctx, request{Query: s.sc.Query, Variables: vars})
+	if err != nil {
+		return fmt.Errorf("failed to list items: %w", err)
+	}
+
+	v, ok := lookup(data, s.sc.Items)
+	if !ok {
+		return fmt.Errorf("response has no field %q", s.sc.Items)
+	}
+	items, ok := v.([]interface{})
+	if !ok {
+		return fmt.Errorf("field %q in response is not an array", s.sc.Items)
+	}
+	for _, item := range items {
+		id, ok := lookupString(item, s.sc.IDField)
+		if !ok {
+			return fmt.Errorf("item has no field %q", s.sc.IDField)
+		}
+		name, ok := lookupString(item, s.sc.NameField)
+		if !ok {
+			name = id
+		}
+		ref, ok := lookupString(item, s.sc.URLField)
+		if !ok {
+			return fmt.Errorf("item %q has no field %q", id, s.sc.URLField)
+		}
+		u, err := s.base.Parse(ref)
+		if err != nil {
+			return fmt.Errorf("failed to parse URL of item %q: %w", id, err)
+		}
+		m, err := json.Marshal(meta{URL: u.String()})
+		if err != nil {
+			return err
+		}
+		s.items = append(s.items, ingest.NewCodec(id, name, m))
+	}
+
+	s.done = true
+	if s.sc.CursorVariable == "" || len(items) == 0 {
+		return nil
+	}
+	if s.sc.HasNextPageField != "" {
+		if hasNext, ok := lookup(data, s.sc.HasNextPageField); !ok || hasNext != true {
+			return nil
+		}
+	}
+	if cursor, ok := lookupString(data, s.sc.CursorField); ok && cursor != "" {
+		s.cursor = cursor
+		s.done = false
+	}
+	return nil
+}
+
+// query sends a GraphQL request and returns the data of the response.
+func (s *source) query(ctx context.Context, r request) (interface{}, error) {
+	buf, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.base.String(), bytes.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	res, err := s.do(req, true)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	var gr response
+	if err := json.NewDecoder(res.Body).Decode(&gr); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if len(gr.Errors) != 0 {
+		msgs := make([]string, len(gr.Errors))
+		for i := range gr.Errors {
+			msgs[i] = gr.Errors[i].Message
+		}
+		return nil, fmt.Errorf("query failed: %s", strings.Join(msgs, "; "))
+	}
+	return gr.Data, nil
+}
+
+// CleanUp sends the clean up mutation for the item, if one is configured.
+func (s *source) CleanUp(ctx context.Context, i ingest.Codec) error {
+	if s.sc.CleanUpMutation == "" {
+		return nil
+	}
+	if _, err := s.query(ctx, request{Query: s.sc.CleanUpMutation, Variables: map[string]interface{}{"id": i.ID}}); err != nil {
+		return fmt.Errorf("failed to clean up item: %w", err)
+	}
+	return nil
+}
+
+// Download will take an Element and download the object it references.
+func (s *source) Download(ctx context.Context, i ingest.Codec) (*ingest.Object, error) {
+	var m meta
+	if err := json.Unmarshal(i.Meta, &m); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal meta: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.do(req, s.sc.AuthenticateDownloads)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download object: %w", err)
+	}
+
+	return &ingest.Object{
+		Reader:   res.Body,
+		Len:      res.ContentLength,
+		MimeType: res.Header.Get("Content-Type"),
+	}, nil
+}
+
+// do sends a request, optionally with the configured headers and credentials,
+// and fails if the response is not successful.
+func (s *source) do(req *http.Request, authenticate bool) (*http.Response, error) {
+	if authenticate {
+		for k, v := range s.sc.Headers {
+			req.Header.Set(k, v)
+		}
+		switch {
+		case s.sc.BearerToken != "":
+			req.Header.Set("Authorization", "Bearer "+s.sc.BearerToken)
+		case s.sc.Username != "":
+			req.SetBasicAuth(s.sc.Username, s.sc.Password)
+		}
+	}
+	res, err := s.c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		defer res.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return nil, fmt.Errorf("unexpected status %q for %s: %s", res.Status, req.URL, body)
+	}
+	return res, nil
+}
+
+// lookup resolves a dot separated path in a decoded JSON value.
+// Elements of arrays are selected by their index.
+func lookup(v interface{}, path string) (interface{}, bool) {
+	if path == "" {
+		return v, true
+	}
+	for _, k := range strings.Split(path, ".") {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if v, ok = t[k]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(k)
+			if err != nil || i < 0 || i >= len(t) {
+				return nil, false
+			}
+			v = t[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// lookupString is like lookup but formats the value as a string.
+func lookupString(v interface{}, path string) (string, bool) {
+	v, ok := lookup(v, path)
+	if !ok {
+		return "", false
+	}
+	switch t := v.(type) {
+	case string:
+		return t, true
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(t), true
+	default:
+		return "", false
+	}
+}
+
+func main() {
+	plugin.RunPluginServer(&source{}, nil)
+}
@@ -0,0 +1,444 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/plugin"
+)
+
+const (
+	paginationNone   = "none"
+	paginationPage   = "page"
+	paginationCursor = "cursor"
+	paginationLink   = "link"
+)
+
+type paginationConfig struct {
+	// Type is one of "none", "page", "cursor" or "link". It defaults to "none".
+	// "page" increments the Param query parameter until a page contains no items.
+	// "cursor" sets the Param query parameter to the value at Field in the previous response.
+	// "link" follows the URL at Field in the response or the Link header with rel="next".
+	Type string
+	// Param is the name of the page or cursor query parameter.
+	Param string
+	// Start is the number of the first page. It defaults to 1.
+	Start int
+	// SizeParam and Size optionally set the page size.
+	SizeParam string
+	Size      int
+	// Field is the path to the next cursor or URL in the response.
+	Field string
+}
+
+type sourceConfig struct {
+	// URL is the endpoint that lists the items.
+	URL string `mapstructure:"url"`
+	// Headers are added to all requests, e.g. for API keys.
+	Headers     map[string]string
+	BearerToken string
+	Username    string
+	Password    string
+	// Items is the dot separated path to the array of items in the response.
+	// If empty, the response itself must be an array.
+	Items string
+	// IDField, NameField and URLField are dot separated paths in an item.
+	// NameField defaults to IDField.
+	IDField   string `mapstructure:"idField"`
+	NameField string
+	// URLField is the path to the URL from which the object is downloaded.
+	// Relative URLs are resolved against the URL of the listing.
+	URLField   string `mapstructure:"urlField"`
+	Pagination paginationConfig
+	// CleanUpURL is an optional template for a URL that is requested to clean up an item,
+	// e.g. https://example.com/api/artifacts/{{.ID}}. The template is executed with the Codec.
+	CleanUpURL string `mapstructure:"cleanUpURL"`
+	// CleanUpMethod is the HTTP method used for clean up. It defaults to DELETE.
+	CleanUpMethod string
+}
+
+// meta is stored in the Meta field of a Codec.
+type meta struct {
+	URL string `json:"url"`
+}
+
+var _ plugin.Source = &source{}
+
+// source can list items from a paginated JSON API and download the objects they reference.
+type source struct {
+	mu      sync.Mutex
+	sc      *sourceConfig
+	c       *http.Client
+	cleanUp *template.Template
+	// items is the current page of items.
+	items []ingest.Codec
+	// next is the URL of the next page. If empty, there are no more pages.
+	next    string
+	page    int
+	started bool
+}
+
+// Configure will configure the source with the values given by config.
+func (s *source) Configure(config map[string]interface{}) error {
+	sc := new(sourceConfig)
+	if err := mapstructure.Decode(config, sc); err != nil {
+		return err
+	}
+	if sc.URL == "" {
+		return errors.New("url must not be empty")
+	}
+	if _, err := url.Parse(sc.URL); err != nil {
+		return fmt.Errorf("failed to parse url: %w", err)
+	}
+	if sc.IDField == "" {
+		return errors.New("idField must not be empty")
+	}
+	if sc.URLField == "" {
+		return errors.New("urlField must not be empty")
+	}
+	if sc.NameField == "" {
+		sc.NameField = sc.IDField
+	}
+	switch sc.Pagination.Type {
+	case "":
+		sc.Pagination.Type = paginationNone
+	case paginationNone, paginationLink:
+	case paginationPage, paginationCursor:
+		if sc.Pagination.Param == "" {
+			return fmt.Errorf("pagination param must not be empty for pagination type %q", sc.Pagination.Type)
+		}
+		if sc.Pagination.Type == paginationCursor && sc.Pagination.Field == "" {
+			return errors.New("pagination field must not be empty for pagination type \"cursor\"")
+		}
+	default:
+		return fmt.Errorf("unknown pagination type %q", sc.Pagination.Type)
+	}
+	if sc.Pagination.Start == 0 {
+		sc.Pagination.Start = 1
+	}
+	if sc.CleanUpMethod == "" {
+		sc.CleanUpMethod = http.MethodDelete
+	}
+	var t *template.Template
+	if sc.CleanUpURL != "" {
+		var err error
+		if t, err = template.New("cleanUpURL").Option("missingkey=error").Parse(sc.CleanUpURL); err != nil {
+			return fmt.Errorf("failed to parse clean up URL template: %w", err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sc = sc
+	s.c = http.DefaultClient
+	s.cleanUp = t
+
+	return nil
+}
+
+// Reset resets the Nexter as if it was newly created.
+func (s *source) Reset(_ context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.items = nil
+	s.next = ""
+	s.page = 0
+	s.started = false
+
+	return nil
+}
+
+// Next requests one page of items at a time.
+func (s *source) Next(ctx context.Context) (*ingest.Codec, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(s.items) == 0 {
+		if !s.started {
+			s.page = s.sc.Pagination.Start
+			u, err := s.pageURL(s.sc.URL, "")
+			if err != nil {
+				return nil, err
+			}
+			s.next = u
+			s.started = true
+		}
+		if s.next == "" {
+			return nil, io.EOF
+		}
+		if err := s.list(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	c := s.items[0]
+	s.items = s.items[1:]
+	return &c, nil
+}
+
+// list requests the next page and determines the URL of the page after it.
+// It must be called with the mutex held.
+func (s *source) list(ctx context.Context) error {
+	res, err := s.do(ctx, http.MethodGet, s.next)
+	if err != nil {
+		return fmt.Errorf("failed to list items: %w", err)
+	}
+	defer res.Body.Close()
+	var body interface{}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	base := res.Request.URL
+
+	v, ok := lookup(body, s.sc.Items)
+	if !ok {
+		return fmt.Errorf("response has no field %q", s.sc.Items)
+	}
+	items, ok := v.([]interface{})
+	if !ok {
+		return fmt.Errorf("field %q in response is not an array", s.sc.Items)
+	}
+	for _, item := range items {
+		id, ok := lookupString(item, s.sc.IDField)
+		if !ok {
+			return fmt.Errorf("item has no field %q", s.sc.IDField)
+		}
+		name, ok := lookupString(item, s.sc.NameField)
+		if !ok {
+			name = id
+		}
+		ref, ok := lookupString(item, s.sc.URLField)
+		if !ok {
+			return fmt.Errorf("item %q has no field %q", id, s.sc.URLField)
+		}
+		u, err := base.Parse(ref)
+		if err != nil {
+			return fmt.Errorf("failed to parse URL of item %q: %w", id, err)
+		}
+		m, err := json.Marshal(meta{URL: u.String()})
+		if err != nil {
+			return err
+		}
+		s.items = append(s.items, ingest.NewCodec(id, name, m))
+	}
+
+	next := ""
+	switch s.sc.Pagination.Type {
+	case paginationPage:
+		if len(items) != 0 {
+			s.page++
+			if next, err = s.pageURL(s.next, ""); err != nil {
+				return err
+			}
+		}
+	case paginationCursor:
+		if cursor, ok := lookupString(body, s.sc.Pagination.Field); ok && cursor != "" {
+			if next, err = s.pageURL(s.next, cursor); err != nil {
+				return err
+			}
+		}
+	case paginationLink:
+		var ref string
+		var ok bool
+		if s.sc.Pagination.Field != "" {
+			ref, ok = lookupString(body, s.sc.Pagination.Field)
+		} else {
+			ref, ok = nextLink(res.Header.Values("Link"))
+		}
+		if ok && ref != "" {
+			u, err := base.Parse(ref)
+			if err != nil {
+				return fmt.Errorf("failed to parse URL of next page: %w", err)
+			}
+			next = u.String()
+		}
+	}
+	s.next = next
+	return nil
+}
+
+// pageURL sets the pagination query parameters of u.
+func (s *source) pageURL(raw, cursor string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	switch s.sc.Pagination.Type {
+	case paginationPage:
+		q.Set(s.sc.Pagination.Param, strconv.Itoa(s.page))
+	case paginationCursor:
+		if cursor == "" {
+			q.Del(s.sc.Pagination.Param)
+		} else {
+			q.Set(s.sc.Pagination.Param, cursor)
+		}
+	}
+	if s.sc.Pagination.SizeParam != "" && s.sc.Pagination.Size > 0 {
+		q.Set(s.sc.Pagination.SizeParam, strconv.Itoa(s.sc.Pagination.Size))
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// CleanUp requests the clean up URL of the item, if one is configured.
+func (s *source) CleanUp(ctx context.Context, i ingest.Codec) error {
+	if s.cleanUp == nil {
+		return nil
+	}
+	buf := new(bytes.Buffer)
+	if err := s.cleanUp.Execute(buf, i); err != nil {
+		return fmt.Errorf("failed to execute clean up URL template: %w", err)
+	}
+	res, err := s.do(ctx, s.sc.CleanUpMethod, buf.String())
+	if err != nil {
+		var herr *httpError
+		if errors.As(err, &herr) && herr.code == http.StatusNotFound {
+			return nil
+		}
+		return fmt.Errorf("failed to clean up item: %w", err)
+	}
+	res.Body.Close()
+	return nil
+}
+
+// Download will take an Element and download the object it references.
+func (s *source) Download(ctx context.Context, i ingest.Codec) (*ingest.Object, error) {
+	var m meta
+	if err := json.Unmarshal(i.Meta, &m); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal meta: %w", err)
+	}
+	res, err := s.do(ctx, http.MethodGet, m.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download object: %w", err)
+	}
+
+	return &ingest.Object{
+		Reader:   res.Body,
+		Len:      res.ContentLength,
+		MimeType: res.Header.Get("Content-Type"),
+	}, nil
+}
+
+type httpError struct {
+	code   int
+	status string
+	url    string
+}
+
+func (e *httpError) Error() string {
+	return fmt.Sprintf("unexpected status %q for %s", e.status, e.url)
+}
+
+// do sends an authenticated request and fails if the response is not successful.
+func (s *source) do(ctx context.Context, method, u string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range s.sc.Headers {
+		req.Header.Set(k, v)
+	}
+	switch {
+	case s.sc.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+s.sc.BearerToken)
+	case s.sc.Username != "":
+		req.SetBasicAuth(s.sc.Username, s.sc.Password)
+	}
+	res, err := s.c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		res.Body.Close()
+		return nil, &httpError{code: res.StatusCode, status: res.Status, url: u}
+	}
+	return res, nil
+}
+
+// lookup resolves a dot separated path in a decoded JSON value.
+// Elements of arrays are selected by their index.
+func lookup(v interface{}, path string) (interface{}, bool) {
+	if path == "" {
+		return v, true
+	}
+	for _, k := range strings.Split(path, ".") {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if v, ok = t[k]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(k)
+			if err != nil || i < 0 || i >= len(t) {
+				return nil, false
+			}
+			v = t[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// lookupString is like lookup but formats the value as a string.
+func lookupString(v interface{}, path string) (string, bool) {
+	v, ok := lookup(v, path)
+	if !ok {
+		return "", false
+	}
+	switch t := v.(type) {
+	case string:
+		return t, true
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(t), true
+	default:
+		return "", false
+	}
+}
+
+// nextLink finds the URL with rel="next" in Link headers as defined in RFC 8288.
+func nextLink(headers []string) (string, bool) {
+	for _, h := range headers {
+		for _, link := range strings.Split(h, ",") {
+			fields := strings.Split(link, ";")
+			ref := strings.TrimSpace(fields[0])
+			if !strings.HasPrefix(ref, "<") || !strings.HasSuffix(ref, ">") {
+				continue
+			}
+			for _, p := range fields[1:] {
+				k, v, ok := strings.Cut(strings.TrimSpace(p), "=")
+				if !ok || !strings.EqualFold(k, "rel") {
+					continue
+				}
+				for _, rel := range strings.Fields(strings.Trim(v, `"`)) {
+					if strings.EqualFold(rel, "next") {
+						return ref[1 : len(ref)-1], true
+					}
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+func main() {
+	plugin.RunPluginServer(&source{}, nil)
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/plugin"
+)
+
+const (
+	securityTLS      = "tls"
+	securityStartTLS = "starttls"
+	securityNone     = "none"
+)
+
+type sourceConfig struct {
+	// Address is the host and port of the IMAP server, e.g. imap.example.com:993.
+	Address string
+	// Security is one of "tls", "starttls" or "none". It defaults to "tls".
+	Security              string
+	InsecureSkipTLSVerify bool `mapstructure:"insecureSkipTLSVerify"`
+	Username              string
+	Password              string
+	// Mailbox is the mailbox in which to look for unread messages. It defaults to INBOX.
+	Mailbox string
+	// Processed is a mailbox to which messages are moved on clean up.
+	// If empty, messages are marked as read instead.
+	Processed string
+}
+
+// meta is stored in the Meta field of a Codec.
+type meta struct {
+	// Encoding is the content transfer encoding of the attachment.
+	Encoding string `json:"encoding"`
+	MimeType string `json:"mimeType"`
+}
+
+var _ plugin.Source = &source{}
+
+// source yields the attachments of unread messages in an IMAP mailbox.
+// The ID of a Codec has the form <uidvalidity>/<uid>/<part>.
+type source struct {
+	mu sync.Mutex
+	sc *sourceConfig
+	c  *imapclient.Client
+	// uidValidity is the UIDVALIDITY of the selected mailbox.
+	uidValidity uint32
+	// attachments is the queue of attachments that were not yet returned.
+	attachments []ingest.Codec
+	started     bool
+	// pending tracks the parts of each message that were not yet cleaned up,
+	// so that a message is only marked or moved once all of its attachments are processed.
+	pending map[imap.UID]map[string]struct{}
+}
+
+// Configure will configure the source with the values given by config.
+func (s *source) Configure(config map[string]interface{}) error {
+	sc := new(sourceConfig)
+	if err := mapstructure.Decode(config, sc); err != nil {
+		return err
+	}
+	if sc.Address == "" {
+		return errors.New("address must not be empty")
+	}
+	switch sc.Security {
+	case "":
+		sc.Security = securityTLS
+	case securityTLS, securityStartTLS, securityNone:
+	default:
+		return fmt.Errorf("unknown security %q", sc.Security)
+	}
+	if sc.Mailbox == "" {
+		sc.Mailbox = "INBOX"
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.c != nil {
+		s.c.Close()
+		s.c = nil
+	}
+	s.sc = sc
+	s.pending = make(map[imap.UID]map[string]struct{})
+	if err := s.connect(); err != nil {
+		return fmt.Errorf("failed to connect to IMAP server: %w", err)
+	}
+
+	return nil
+}
+
+// connect dials the server, logs in and selects the mailbox.
+// It must be called with the mutex held.
+func (s *source) connect() error {
+	o := &imapclient.Options{TLSConfig: &tls.Config{InsecureSkipVerify: s.sc.InsecureSkipTLSVerify}}
+	var c *imapclient.Client
+	var err error
+	switch s.sc.Security {
+	case securityTLS:
+		c, err = imapclient.DialTLS(s.sc.Address, o)
+	case securityStartTLS:
+		c, err = imapclient.DialStartTLS(s.sc.Address, o)
+	default:
+		c, err = imapclient.DialInsecure(s.sc.Address, o)
+	}
+	if err != nil {
+		return err
+	}
+	if err := c.Login(s.sc.Username, s.sc.Password).Wait(); err != nil {
+		c.Close()
+		return fmt.Errorf("failed to log in: %w", err)
+	}
+	sd, err := c.Select(s.sc.Mailbox, nil).Wait()
+	if err != nil {
+		c.Close()
+		return fmt.Errorf("failed to select mailbox %q: %w", s.sc.Mailbox, err)
+	}
+	s.c = c
+	s.uidValidity = sd.UIDValidity
+	return nil
+}
+
+// client returns a connected client and reconnects if the connection was lost.
+// It must be called with the mutex held.
+func (s *source) client() (*imapclient.Client, error) {
+	if s.c != nil {
+		if err := s.c.Noop().Wait(); err == nil {
+			return s.c, nil
+		}
+		s.c.Close()
+		s.c = nil
+	}
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	return s.c, nil
+}
+
+// Reset resets the Nexter as if it was newly created.
+func (s *source) Reset(_ context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.attachments = nil
+	s.started = false
+
+	return nil
+}
+
+// Next searches for unread messages once and then returns their attachments one at a time.
+func (s *source) Next(_ context.Context) (*ingest.Codec, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.started {
+		if err := s.list(); err != nil {
+			return nil, err
+		}
+		s.started = true
+	}
+	if len(s.attachments) == 0 {
+		return nil, io.EOF
+	}
+
+	c := s.attachments[0]
+	s.attachments = s.attachments[1:]
+	return &c, nil
+}
+
+// list finds all attachments of unread messages.
+// It must be called with the mutex held.
+func (s *source) list() error {
+	c, err := s.client()
+	if err != nil {
+		return fmt.Errorf("failed to connect to IMAP server: %w", err)
+	}
+	sd, err := c.UIDSearch(&imap.SearchCriteria{NotFlag: []imap.Flag{imap.FlagSeen}}, nil).Wait()
+	if err != nil {
+		return fmt.Errorf("failed to search for unread messages: %w", err)
+	}
+	uids := sd.AllUIDs()
+	if len(uids) == 0 {
+		return nil
+	}
+	msgs, err := c.Fetch(imap.UIDSetNum(uids...), &imap.FetchOptions{
+		UID:           true,
+		BodyStructure: &imap.FetchItemBodyStructure{Extended: true},
+	}).Collect()
+	if err != nil {
+		return fmt.Errorf("failed to fetch messages: %w", err)
+	}
+
+	for _, msg := range msgs {
+		if msg.BodyStructure == nil {
+			continue
+		}
+		parts := make(map[string]struct{})
+		msg.BodyStructure.Walk(func(path []int, bs imap.BodyStructure) bool {
+			sp, ok := bs.(*imap.BodyStructureSinglePart)
+			if !ok {
+				return true
+			}
+			filename := sp.Filename()
+			if filename == "" {
+				return true
+			}
+			m, err := json.Marshal(meta{Encoding: sp.Encoding, MimeType: sp.MediaType()})
+			if err != nil {
+				return true
+			}
+			part := formatPart(path)
+			parts[part] = struct{}{}
+			s.attachments = append(s.attachments, ingest.NewCodec(
+				fmt.Sprintf("%d/%d/%s", s.uidValidity, msg.UID, part),
+				fmt.Sprintf("%d/%s", msg.UID, filename),
+				m,
+			))
+			return true
+		})
+		if len(parts) != 0 {
+			s.pending[msg.UID] = parts
+		}
+	}
+	return nil
+}
+
+// CleanUp marks the message as read or moves it to the processed mailbox
+// once all of the message's attachments were cleaned up.
+func (s *source) CleanUp(_ context.Context, i ingest.Codec) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	uid, part, err := s.parseID(i.ID)
+	if err != nil {
+		return err
+	}
+	// If the message is unknown, e.g. because the plugin was restarted,
+	// then it is finished right away.
+	if parts, ok := s.pending[uid]; ok {
+		delete(parts, part)
+		if len(parts) != 0 {
+			return nil
+		}
+	}
+
+	c, err := s.client()
+	if err != nil {
+		return fmt.Errorf("failed to connect to IMAP server: %w", err)
+	}
+	set := imap.UIDSetNum(uid)
+	if s.sc.Processed != "" {
+		if _, err := c.Move(set, s.sc.Processed).Wait(); err != nil {
+			return fmt.Errorf("failed to move message: %w", err)
+		}
+	} else {
+		if err := c.Store(set, &imap.StoreFlags{Op: imap.StoreFlagsAdd, Silent: true, Flags: []imap.Flag{imap.FlagSeen}}, nil).Close(); err != nil {
+			return fmt.Errorf("failed to mark message as read: %w", err)
+		}
+	}
+	delete(s.pending, uid)
+	return nil
+}
+
+// Download fetches the attachment without marking the message as read and decodes it.
+func (s *source) Download(_ context.Context, i ingest.Codec) (*ingest.Object, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	uid, part, err := s.parseID(i.ID)
+	if err != nil {
+		return nil, err
+	}
+	var m meta
+	if len(i.Meta) != 0 {
+		if err := json.Unmarshal(i.Meta, &m); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal meta: %w", err)
+		}
+	}
+	p, err := parsePart(part)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := s.client()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to IMAP server: %w", err)
+	}
+	section := &imap.FetchItemBodySection{Part: p, Peek: true}
+	msgs, err := c.Fetch(imap.UIDSetNum(uid), &imap.FetchOptions{
+		UID:         true,
+		BodySection: []*imap.FetchItemBodySection{section},
+	}).Collect()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch attachment: %w", err)
+	}
+	if len(msgs) == 0 {
+		return nil, fmt.Errorf("message %d not found", uid)
+	}
+	buf, err := decode(m.Encoding, msgs[0].FindBodySection(section))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode attachment: %w", err)
+	}
+
+	mt := m.MimeType
+	if mt == "" || mt == "application/octet-stream" {
+		if t := mime.TypeByExtension(path.Ext(i.Name)); t != "" {
+			mt = t
+		}
+	}
+	return &ingest.Object{
+		Reader:   bytes.NewReader(buf),
+		Len:      int64(len(buf)),
+		MimeType: mt,
+	}, nil
+}
+
+// parseID splits the ID of a Codec into the UID of the message and the part of the attachment.
+// It fails if the UIDVALIDITY of the mailbox changed.
+func (s *source) parseID(id string) (imap.UID, string, error) {
+	fields := strings.SplitN(id, "/", 3)
+	if len(fields) != 3 {
+		return 0, "", fmt.Errorf("invalid ID %q", id)
+	}
+	v, err := strconv.ParseUint(fields[0], 10, 32)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid UIDVALIDITY in ID %q: %w", id, err)
+	}
+	if uint32(v) != s.uidValidity {
+		return 0, "", fmt.Errorf("UIDVALIDITY of mailbox %q changed from %d to %d", s.sc.Mailbox, v, s.uidValidity)
+	}
+	uid, err := strconv.ParseUint(fields[1], 10, 32)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid UID in ID %q: %w", id, err)
+	}
+	return imap.UID(uid), fields[2], nil
+}
+
+// formatPart formats a body part path as a section specification, e.g. 2.1.
+func formatPart(path []int) string {
+	s := make([]string, len(path))
+	for i := range path {
+		s[i] = strconv.Itoa(path[i])
+	}
+	return strings.Join(s, ".")
+}
+
+// parsePart is the inverse of formatPart.
+func parsePart(part string) ([]int, error) {
+	fields := strings.Split(part, ".")
+	path := make([]int, len(fields))
+	for i := range fields {
+		n, err := strconv.Atoi(fields[i])
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid part %q", part)
+		}
+		path[i] = n
+	}
+	return path, nil
+}
+
+// decode reverses the content transfer encoding of a body part.
+func decode(encoding string, buf []byte) ([]byte, error) {
+	switch strings.ToLower(encoding) {
+	case "base64":
+		return io.ReadAll(base64.NewDecoder(base64.StdEncoding, bytes.NewReader(buf)))
+	case "quoted-printable":
+		return io.ReadAll(quotedprintable.NewReader(bytes.NewReader(buf)))
+	default:
+		return buf, nil
+	}
+}
+
+func main() {
+	plugin.RunPluginServer(&source{}, nil)
+}
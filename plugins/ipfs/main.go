@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/connylabs/ingest/plugin"
+	"github.com/connylabs/ingest/storage"
+	"github.com/connylabs/ingest/storage/ipfs"
+)
+
+const defaultRoot = "/ingest"
+
+type destinationConfig struct {
+	// URL is the URL of the RPC API of the IPFS node, e.g. http://127.0.0.1:5001.
+	URL      string `mapstructure:"url"`
+	Username string
+	Password string
+	// Token is a bearer token for the RPC API.
+	Token string
+	// Root is the directory in the MFS of the node under which objects are linked.
+	// It defaults to /ingest.
+	Root string
+	// CIDVersion is the CID version of added objects. It defaults to 1.
+	CIDVersion *int `mapstructure:"cidVersion"`
+	// PinningService optionally configures a remote pinning service
+	// that implements the IPFS Pinning Service API.
+	PinningService struct {
+		URL   string `mapstructure:"url"`
+		Token string
+	}
+}
+
+var _ plugin.Destination = &destination{}
+
+// destination adds objects to an IPFS node.
+type destination struct {
+	storage.Storage
+}
+
+// Configure will configure the destination with the values given by config.
+func (d *destination) Configure(config map[string]interface{}) error {
+	dc := new(destinationConfig)
+	if err := mapstructure.Decode(config, dc); err != nil {
+		return err
+	}
+	if dc.URL == "" {
+		return errors.New("url must not be empty")
+	}
+	if dc.Root == "" {
+		dc.Root = defaultRoot
+	}
+	cidVersion := 1
+	if dc.CIDVersion != nil {
+		cidVersion = *dc.CIDVersion
+	}
+	if cidVersion != 0 && cidVersion != 1 {
+		return fmt.Errorf("invalid CID version %d", cidVersion)
+	}
+	var h http.Header
+	switch {
+	case dc.Token != "":
+		h = ipfs.Bearer(dc.Token)
+	case dc.Username != "":
+		h = ipfs.BasicAuth(dc.Username, dc.Password)
+	}
+	c, err := ipfs.NewClient(dc.URL, h, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create IPFS client: %w", err)
+	}
+	var pc *ipfs.PinningClient
+	if dc.PinningService.URL != "" {
+		if pc, err = ipfs.NewPinningClient(dc.PinningService.URL, dc.PinningService.Token, nil); err != nil {
+			return fmt.Errorf("failed to create pinning service client: %w", err)
+		}
+	}
+
+	d.Storage = ipfs.New(dc.Root, cidVersion, c, pc)
+
+	return nil
+}
+
+func main() {
+	plugin.RunPluginServer(nil, &destination{})
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+
+	"github.com/connylabs/ingest/plugin"
+	"github.com/connylabs/ingest/storage"
+	"github.com/connylabs/ingest/storage/kafka"
+)
+
+type destinationConfig struct {
+	// Brokers are the addresses of the Kafka brokers used to bootstrap the connection.
+	Brokers []string
+	Topic   string
+	// URITemplate is an optional template for the URI of the object in another destination,
+	// e.g. s3://bucket/prefix/{{.Name}}. The template is executed with the Codec.
+	// If given, a JSON pointer record is published instead of the content of the object.
+	URITemplate string `mapstructure:"uriTemplate"`
+	// TLS enables TLS for the connections to the brokers.
+	TLS bool `mapstructure:"tls"`
+	// SASLMechanism is one of PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512.
+	SASLMechanism string `mapstructure:"saslMechanism"`
+	Username      string
+	Password      string
+	// Compression is one of gzip, snappy, lz4 or zstd.
+	Compression string
+}
+
+var _ plugin.Destination = &destination{}
+
+// destination publishes a message for every object to a Kafka topic.
+type destination struct {
+	storage.Storage
+}
+
+// Configure will configure the destination with the values given by config.
+func (d *destination) Configure(config map[string]interface{}) error {
+	dc := new(destinationConfig)
+	if err := mapstructure.Decode(config, dc); err != nil {
+		return err
+	}
+	if len(dc.Brokers) == 0 {
+		return errors.New("brokers must not be empty")
+	}
+	if dc.Topic == "" {
+		return errors.New("topic must not be empty")
+	}
+	var t *template.Template
+	if dc.URITemplate != "" {
+		var err error
+		if t, err = template.New("uri").Option("missingkey=error").Parse(dc.URITemplate); err != nil {
+			return fmt.Errorf("failed to parse URI template: %w", err)
+		}
+	}
+	m, err := newMechanism(dc.SASLMechanism, dc.Username, dc.Password)
+	if err != nil {
+		return err
+	}
+	var c kafkago.Compression
+	if dc.Compression != "" {
+		if err := c.UnmarshalText([]byte(dc.Compression)); err != nil {
+			return fmt.Errorf("invalid compression %q: %w", dc.Compression, err)
+		}
+	}
+	tr := &kafkago.Transport{SASL: m}
+	if dc.TLS {
+		tr.TLS = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	w := &kafkago.Writer{
+		Addr: kafkago.TCP(dc.Brokers...),
+		// Messages with the same key, i.e. the same object name, go to the same partition.
+		Balancer:     &kafkago.Hash{},
+		RequiredAcks: kafkago.RequireAll,
+		// Messages are written one at a time, so waiting for a batch to fill up only adds latency.
+		BatchTimeout: 10 * time.Millisecond,
+		Compression:  c,
+		Transport:    tr,
+	}
+
+	d.Storage = kafka.New(dc.Topic, dc.Brokers[0], t, w)
+
+	return nil
+}
+
+// newMechanism returns the SASL mechanism with the given name.
+// If the name is empty, then no mechanism is returned.
+func newMechanism(name, username, password string) (sasl.Mechanism, error) {
+	switch strings.ToUpper(name) {
+	case "":
+		return nil, nil
+	case "PLAIN":
+		return plain.Mechanism{Username: username, Password: password}, nil
+	case "SCRAM-SHA-256":
+		return scram.Mechanism(scram.SHA256, username, password)
+	case "SCRAM-SHA-512":
+		return scram.Mechanism(scram.SHA512, username, password)
+	default:
+		return nil, fmt.Errorf("unknown SASL mechanism %q", name)
+	}
+}
+
+func main() {
+	plugin.RunPluginServer(nil, &destination{})
+}
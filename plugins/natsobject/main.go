@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/nats-io/nats.go"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/plugin"
+)
+
+type sourceConfig struct {
+	// URL is the URL of the NATS server.
+	URL string `mapstructure:"url"`
+	// CredentialsFile is an optional NATS user credentials file.
+	CredentialsFile string
+	// Bucket is the name of the object store bucket.
+	Bucket string
+	// Prefix optionally restricts the objects to those whose names start with the prefix.
+	Prefix string
+}
+
+var _ plugin.Source = &source{}
+
+// source can fetch objects from a NATS JetStream object store.
+type source struct {
+	mu     sync.Mutex
+	nc     *nats.Conn
+	os     nats.ObjectStore
+	prefix string
+	// objects is the queue of objects that were not yet returned.
+	objects []*nats.ObjectInfo
+}
+
+// Configure will configure the source with the values given by config.
+func (s *source) Configure(config map[string]interface{}) error {
+	sc := new(sourceConfig)
+	if err := mapstructure.Decode(config, sc); err != nil {
+		return err
+	}
+	if sc.URL == "" {
+		sc.URL = nats.DefaultURL
+	}
+	if sc.Bucket == "" {
+		return errors.New("bucket must not be empty")
+	}
+	var opts []nats.Option
+	if sc.CredentialsFile != "" {
+		opts = append(opts, nats.UserCredentials(sc.CredentialsFile))
+	}
+	nc, err := nats.Connect(sc.URL, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	js, err := nc.JetStream()
+	if err != nil {
+		nc.Close()
+		return fmt.Errorf("failed to create JetStream context: %w", err)
+	}
+	os, err := js.ObjectStore(sc.Bucket)
+	if err != nil {
+		nc.Close()
+		return fmt.Errorf("failed to bind to object store %q: %w", sc.Bucket, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.nc != nil {
+		s.nc.Close()
+	}
+	s.nc = nc
+	s.os = os
+	s.prefix = sc.Prefix
+
+	return nil
+}
+
+// Reset lists all objects in the bucket.
+func (s *source) Reset(_ context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	objs, err := s.os.List()
+	if err != nil && !errors.Is(err, nats.ErrNoObjectsFound) {
+		return fmt.Errorf("failed to list objects: %w", err)
+	}
+	s.objects = objs
+
+	return nil
+}
+
+// Next ignores the context in this implementation.
+func (s *source) Next(_ context.Context) (*ingest.Codec, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(s.objects) != 0 {
+		o := s.objects[0]
+		s.objects = s.objects[1:]
+		// Links to other objects or buckets are skipped.
+		if o.Deleted || (o.Opts != nil && o.Opts.Link != nil) || !strings.HasPrefix(o.Name, s.prefix) {
+			continue
+		}
+		c := ingest.NewCodec(o.Name, strings.TrimPrefix(o.Name, s.prefix), nil)
+		mt := o.ModTime
+		c.Size, c.LastModified = int64(o.Size), &mt
+		return &c, nil
+	}
+
+	return nil, io.EOF
+}
+
+// CleanUp deletes the object from the bucket.
+func (s *source) CleanUp(_ context.Context, i ingest.Codec) error {
+	if err := s.os.Delete(i.ID); err != nil && !errors.Is(err, nats.ErrObjectNotFound) {
+		return err
+	}
+	return nil
+}
+
+// Download will take an Element and download it from the object store.
+func (s *source) Download(ctx context.Context, i ingest.Codec) (*ingest.Object, error) {
+	r, err := s.os.Get(i.ID, nats.Context(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object: %w", err)
+	}
+	info, err := r.Info()
+	if err != nil {
+		r.Close()
+		return nil, fmt.Errorf("failed to get object info: %w", err)
+	}
+	mt := mime.TypeByExtension(path.Ext(i.ID))
+	if info.Headers != nil && info.Headers.Get("Content-Type") != "" {
+		mt = info.Headers.Get("Content-Type")
+	}
+
+	return &ingest.Object{
+		Reader:   r,
+		Len:      int64(info.Size),
+		MimeType: mt,
+	}, nil
+}
+
+func main() {
+	plugin.RunPluginServer(&source{}, nil)
+}
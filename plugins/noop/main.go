@@ -1,6 +1,9 @@
 package main
 
 import (
+	"os"
+
+	"github.com/hashicorp/go-hclog"
 	"github.com/prometheus/client_golang/prometheus"
 
 	iplugin "github.com/connylabs/ingest/plugin"
@@ -15,5 +18,11 @@ func main() {
 	})
 	reg.MustRegister(c)
 	c.Set(1)
-	iplugin.RunPluginServer(iplugin.NewNoopSource(iplugin.DefaultLogger), iplugin.NewNoopDestination(iplugin.DefaultLogger), iplugin.WithGatherer(reg), iplugin.WithLogger(iplugin.DefaultLogger))
+	// ingest filters the logs of plugins by their level.
+	l := hclog.New(&hclog.LoggerOptions{
+		Level:      hclog.Trace,
+		Output:     os.Stderr,
+		JSONFormat: true,
+	})
+	iplugin.RunPluginServer(iplugin.NewNoopSource(l), iplugin.NewNoopDestination(l), iplugin.WithGatherer(reg), iplugin.WithLogger(l))
 }
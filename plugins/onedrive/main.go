@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/mitchellh/mapstructure"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/plugin"
+	"github.com/connylabs/ingest/storage"
+	"github.com/connylabs/ingest/storage/onedrive"
+)
+
+type sourceConfig struct {
+	// TenantID, ClientID and ClientSecret are the credentials of an
+	// Azure AD application that is used with the client credentials flow.
+	TenantID     string `mapstructure:"tenantID"`
+	ClientID     string `mapstructure:"clientID"`
+	ClientSecret string
+	// AccessToken can be given instead of client credentials.
+	AccessToken string
+	// Exactly one of DriveID, SiteID and UserID selects the drive.
+	// SiteID selects the default document library of a SharePoint site.
+	DriveID string `mapstructure:"driveID"`
+	SiteID  string `mapstructure:"siteID"`
+	UserID  string `mapstructure:"userID"`
+	// Folder is the folder relative to the root of the drive in which to look for files.
+	Folder    string
+	Recursive bool
+	// Delete deletes files on clean up.
+	// Otherwise, clean up is a no-op because the delta query only returns changed files.
+	Delete bool
+	// StateFile is an optional file in which the delta link is persisted,
+	// so that only changed files are returned after a restart.
+	StateFile string
+}
+
+// driveURL returns the Graph API URL of the configured drive.
+func (sc *sourceConfig) driveURL() (string, error) {
+	var u string
+	n := 0
+	if sc.DriveID != "" {
+		u = onedrive.GraphURL + "/drives/" + sc.DriveID
+		n++
+	}
+	if sc.SiteID != "" {
+		u = onedrive.GraphURL + "/sites/" + sc.SiteID + "/drive"
+		n++
+	}
+	if sc.UserID != "" {
+		u = onedrive.GraphURL + "/users/" + sc.UserID + "/drive"
+		n++
+	}
+	if n != 1 {
+		return "", errors.New("exactly one of driveID, siteID and userID must be given")
+	}
+	return u, nil
+}
+
+// httpClient returns an http.Client that authorizes requests against the Graph API.
+func (sc *sourceConfig) httpClient() (*http.Client, error) {
+	if sc.AccessToken != "" {
+		return oauth2.NewClient(context.Background(), oauth2.StaticTokenSource(&oauth2.Token{AccessToken: sc.AccessToken})), nil
+	}
+	if sc.TenantID == "" || sc.ClientID == "" || sc.ClientSecret == "" {
+		return nil, errors.New("either an access token or a tenant ID, client ID and client secret must be given")
+	}
+	cc := &clientcredentials.Config{
+		ClientID:     sc.ClientID,
+		ClientSecret: sc.ClientSecret,
+		TokenURL:     fmt.Sprintf("https://login.microsoftonline.com/%s/oauth2/v2.0/token", sc.TenantID),
+		Scopes:       []string{"https://graph.microsoft.com/.default"},
+	}
+	return cc.Client(context.Background()), nil
+}
+
+type destinationConfig struct {
+	sourceConfig `mapstructure:",squash"`
+	// ChunkSize is the size in bytes of the chunks of upload sessions.
+	// It is rounded down to a multiple of 320 KiB and defaults to 10 MiB.
+	ChunkSize int64
+}
+
+var _ plugin.Destination = &destination{}
+
+type destination struct {
+	storage.Storage
+}
+
+// Configure will configure the destination with the values given by config.
+func (d *destination) Configure(config map[string]interface{}) error {
+	dc := new(destinationConfig)
+	if err := mapstructure.Decode(config, dc); err != nil {
+		return err
+	}
+	u, err := dc.driveURL()
+	if err != nil {
+		return err
+	}
+	h, err := dc.httpClient()
+	if err != nil {
+		return err
+	}
+	c, err := onedrive.NewClient(u, h)
+	if err != nil {
+		return err
+	}
+
+	d.Storage = onedrive.New(dc.Folder, dc.ChunkSize, c)
+
+	return nil
+}
+
+var _ plugin.Source = &source{}
+
+// source can fetch files from OneDrive or a SharePoint document library.
+type source struct {
+	mu        sync.Mutex
+	c         *onedrive.Client
+	folder    string
+	recursive bool
+	delete    bool
+	stateFile string
+	// deltaLink is the delta link of the last complete query.
+	deltaLink string
+	// link is the link of the next page of the current query.
+	// If empty, the current query is complete.
+	link string
+	// pendingDeltaLink is committed once all items of the current query were returned.
+	pendingDeltaLink string
+	// paths caches the paths of folders by ID.
+	paths map[string]string
+	items []ingest.Codec
+}
+
+// Configure will configure the source with the values given by config.
+func (s *source) Configure(config map[string]interface{}) error {
+	sc := new(sourceConfig)
+	if err := mapstructure.Decode(config, sc); err != nil {
+		return err
+	}
+	u, err := sc.driveURL()
+	if err != nil {
+		return err
+	}
+	h, err := sc.httpClient()
+	if err != nil {
+		return err
+	}
+	c, err := onedrive.NewClient(u, h)
+	if err != nil {
+		return fmt.Errorf("failed to create graph client: %w", err)
+	}
+	var deltaLink string
+	if sc.StateFile != "" {
+		buf, err := os.ReadFile(sc.StateFile)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to read state file: %w", err)
+		}
+		deltaLink = strings.TrimSpace(string(buf))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.c = c
+	s.folder = strings.Trim(sc.Folder, "/")
+	s.recursive = sc.Recursive
+	s.delete = sc.Delete
+	s.stateFile = sc.StateFile
+	s.deltaLink = deltaLink
+	s.paths = make(map[string]string)
+
+	return nil
+}
+
+// Reset starts a new delta query from the last complete query.
+func (s *source) Reset(_ context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.items = nil
+	s.link = s.deltaLink
+	s.pendingDeltaLink = ""
+
+	return nil
+}
+
+// Next requests one page of changes at a time and returns the changed files.
+// Once all files were returned, the delta link is committed.
+func (s *source) Next(ctx context.Context) (*ingest.Codec, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(s.items) == 0 {
+		if s.pendingDeltaLink != "" {
+			if err := s.commit(); err != nil {
+				return nil, err
+			}
+			return nil, io.EOF
+		}
+		p, err := s.c.Delta(ctx, s.link)
+		if err != nil {
+			// An expired delta link requires a full resynchronization.
+			var gerr *onedrive.Error
+			if errors.As(err, &gerr) && gerr.StatusCode == http.StatusGone && s.link != "" {
+				s.link = ""
+				continue
+			}
+			return nil, fmt.Errorf("failed to query changes: %w", err)
+		}
+		for i := range p.Items {
+			if err := s.add(ctx, &p.Items[i]); err != nil {
+				return nil, err
+			}
+		}
+		s.link = p.NextLink
+		s.pendingDeltaLink = p.DeltaLink
+		if s.link == "" && s.pendingDeltaLink == "" {
+			return nil, errors.New("delta page has neither a next link nor a delta link")
+		}
+	}
+
+	c := s.items[0]
+	s.items = s.items[1:]
+	return &c, nil
+}
+
+// add records the path of folders and queues files in the configured folder.
+// It must be called with the mutex held.
+func (s *source) add(ctx context.Context, i *onedrive.Item) error {
+	if i.Root != nil {
+		s.paths[i.ID] = ""
+		return nil
+	}
+	if i.Deleted != nil {
+		delete(s.paths, i.ID)
+		return nil
+	}
+	parent, err := s.path(ctx, i.ParentReference.ID)
+	if err != nil {
+		return err
+	}
+	p := path.Join(parent, i.Name)
+	if i.Folder != nil {
+		s.paths[i.ID] = p
+		return nil
+	}
+	if i.File == nil {
+		return nil
+	}
+	name := p
+	if s.folder != "" {
+		if !strings.HasPrefix(p, s.folder+"/") {
+			return nil
+		}
+		name = strings.TrimPrefix(p, s.folder+"/")
+	}
+	if !s.recursive && strings.Contains(name, "/") {
+		return nil
+	}
+	c := ingest.NewCodec(i.ID, name, nil)
+	c.Size = i.Size
+	if !i.LastModifiedDateTime.IsZero() {
+		mt := i.LastModifiedDateTime
+		c.LastModified = &mt
+	}
+	s.items = append(s.items, c)
+	return nil
+}
+
+// path resolves the path of a folder.
+// Items returned by delta queries do not contain the path of their parent,
+// so unknown folders are requested from the API.
+// It must be called with the mutex held.
+func (s *source) path(ctx context.Context, id string) (string, error) {
+	if id == "" {
+		return "", nil
+	}
+	if p, ok := s.paths[id]; ok {
+		return p, nil
+	}
+	i, err := s.c.GetItem(ctx, id)
+	if err != nil {
+		return "", fmt.Errorf("failed to get folder %q: %w", id, err)
+	}
+	p := ""
+	if i.Root == nil {
+		p = i.Path()
+	}
+	s.paths[id] = p
+	return p, nil
+}
+
+// commit stores the delta link of the current query.
+// It must be called with the mutex held.
+func (s *source) commit() error {
+	s.deltaLink = s.pendingDeltaLink
+	s.link = s.deltaLink
+	s.pendingDeltaLink = ""
+	if s.stateFile == "" {
+		return nil
+	}
+	tmp := s.stateFile + ".tmp"
+	if err := os.WriteFile(tmp, []byte(s.deltaLink), 0o600); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := os.Rename(tmp, s.stateFile); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	return nil
+}
+
+// CleanUp deletes the file if configured to do so.
+func (s *source) CleanUp(ctx context.Context, i ingest.Codec) error {
+	if !s.delete {
+		return nil
+	}
+	return s.c.DeleteItem(ctx, i.ID)
+}
+
+// Download will take an Element and download it from the drive.
+func (s *source) Download(ctx context.Context, i ingest.Codec) (*ingest.Object, error) {
+	res, err := s.c.Download(ctx, i.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file: %w", err)
+	}
+
+	return &ingest.Object{
+		Reader:   res.Body,
+		Len:      res.ContentLength,
+		MimeType: res.Header.Get("Content-Type"),
+	}, nil
+}
+
+func main() {
+	plugin.RunPluginServer(&source{}, &destination{})
+}
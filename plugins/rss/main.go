@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/plugin"
+)
+
+type sourceConfig struct {
+	// URLs are the RSS or Atom feeds to poll.
+	URLs []string `mapstructure:"urls"`
+	// Headers are added to all requests.
+	Headers map[string]string
+	// StateFile is an optional file in which the GUIDs of returned items are persisted,
+	// so that items are not returned again after a restart.
+	StateFile string
+}
+
+// feed can decode both RSS 2.0 and Atom documents.
+type feed struct {
+	Items   []rssItem   `xml:"channel>item"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type rssItem struct {
+	GUID       string         `xml:"guid"`
+	Link       string         `xml:"link"`
+	Enclosures []rssEnclosure `xml:"enclosure"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length string `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+type atomEntry struct {
+	ID    string     `xml:"id"`
+	Links []atomLink `xml:"link"`
+}
+
+type atomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr"`
+	Length string `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// enclosure is an attachment of a feed item.
+type enclosure struct {
+	// guid identifies the enclosure across polls.
+	guid   string
+	url    string
+	length string
+	typ    string
+}
+
+// meta is stored in the Meta field of a Codec.
+type meta struct {
+	URL    string `json:"url"`
+	Length int64  `json:"length"`
+	Type   string `json:"type"`
+}
+
+var (
+	_ plugin.Source       = &source{}
+	_ ingest.Checkpointer = &source{}
+)
+
+// source downloads the enclosures of RSS and Atom feeds.
+type source struct {
+	mu        sync.Mutex
+	c         *http.Client
+	urls      []string
+	headers   map[string]string
+	stateFile string
+	// seen contains the GUIDs of all enclosures that were already returned.
+	seen map[string]struct{}
+	// current contains the GUIDs of all enclosures in the current poll.
+	current    map[string]struct{}
+	enclosures []enclosure
+	// feeds is the queue of feeds that were not yet polled.
+	feeds []string
+}
+
+// Configure will configure the source with the values given by config.
+func (s *source) Configure(config map[string]interface{}) error {
+	sc := new(sourceConfig)
+	if err := mapstructure.Decode(config, sc); err != nil {
+		return err
+	}
+	if len(sc.URLs) == 0 {
+		return errors.New("urls must not be empty")
+	}
+	for _, u := range sc.URLs {
+		if _, err := url.Parse(u); err != nil {
+			return fmt.Errorf("failed to parse feed URL %q: %w", u, err)
+		}
+	}
+	seen := make(map[string]struct{})
+	if sc.StateFile != "" {
+		buf, err := os.ReadFile(sc.StateFile)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to read state file: %w", err)
+		}
+		if err == nil {
+			var guids []string
+			if err := json.Unmarshal(buf, &guids); err != nil {
+				return fmt.Errorf("failed to decode state file: %w", err)
+			}
+			for _, g := range guids {
+				seen[g] = struct{}{}
+			}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.c = http.DefaultClient
+	s.urls = sc.URLs
+	s.headers = sc.Headers
+	s.stateFile = sc.StateFile
+	s.seen = seen
+
+	return nil
+}
+
+// Reset starts a new poll of all feeds.
+func (s *source) Reset(_ context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.feeds = append([]string(nil), s.urls...)
+	s.enclosures = nil
+	s.current = make(map[string]struct{})
+
+	return nil
+}
+
+// Next polls one feed at a time and returns the enclosures that were not returned before.
+// Once all feeds were polled, GUIDs that are no longer part of any feed are forgotten.
+func (s *source) Next(ctx context.Context) (*ingest.Codec, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(s.enclosures) == 0 {
+		if len(s.feeds) == 0 {
+			if err := s.prune(); err != nil {
+				return nil, err
+			}
+			return nil, io.EOF
+		}
+		u := s.feeds[0]
+		es, err := s.poll(ctx, u)
+		if err != nil {
+			return nil, fmt.Errorf("failed to poll feed %q: %w", u, err)
+		}
+		s.feeds = s.feeds[1:]
+		for _, e := range es {
+			s.current[e.guid] = struct{}{}
+			if _, ok := s.seen[e.guid]; !ok {
+				s.enclosures = append(s.enclosures, e)
+			}
+		}
+	}
+
+	e := s.enclosures[0]
+	s.enclosures = s.enclosures[1:]
+	s.seen[e.guid] = struct{}{}
+	n, _ := strconv.ParseInt(e.length, 10, 64)
+	buf, err := json.Marshal(meta{URL: e.url, Length: n, Type: e.typ})
+	if err != nil {
+		return nil, err
+	}
+	c := ingest.NewCodec(e.guid, name(e), buf)
+	return &c, nil
+}
+
+// poll requests a feed and returns its enclosures.
+func (s *source) poll(ctx context.Context, u string) ([]enclosure, error) {
+	res, err := s.get(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	var f feed
+	if err := xml.NewDecoder(res.Body).Decode(&f); err != nil {
+		return nil, fmt.Errorf("failed to decode feed: %w", err)
+	}
+	base := res.Request.URL
+
+	var es []enclosure
+	add := func(guid string, i int, ref, length, typ string) {
+		r, err := base.Parse(strings.TrimSpace(ref))
+		if err != nil || ref == "" {
+			return
+		}
+		if guid == "" {
+			guid = r.String()
+		} else if i > 0 {
+			guid = fmt.Sprintf("%s#%d", guid, i)
+		}
+		es = append(es, enclosure{guid: guid, url: r.String(), length: length, typ: typ})
+	}
+	for _, item := range f.Items {
+		guid := strings.TrimSpace(item.GUID)
+		for i, e := range item.Enclosures {
+			add(guid, i, e.URL, e.Length, e.Type)
+		}
+	}
+	for _, entry := range f.Entries {
+		i := 0
+		for _, l := range entry.Links {
+			if l.Rel != "enclosure" {
+				continue
+			}
+			add(strings.TrimSpace(entry.ID), i, l.Href, l.Length, l.Type)
+			i++
+		}
+	}
+	return es, nil
+}
+
+// prune forgets the GUIDs of enclosures that are no longer in any feed and persists the rest.
+// It must be called with the mutex held.
+func (s *source) prune() error {
+	for g := range s.seen {
+		if _, ok := s.current[g]; !ok {
+			delete(s.seen, g)
+		}
+	}
+	if s.stateFile == "" {
+		return nil
+	}
+	guids := make([]string, 0, len(s.seen))
+	for g := range s.seen {
+		guids = append(guids, g)
+	}
+	buf, err := json.Marshal(guids)
+	if err != nil {
+		return err
+	}
+	tmp := s.stateFile + ".tmp"
+	if err := os.WriteFile(tmp, buf, 0o600); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := os.Rename(tmp, s.stateFile); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	return nil
+}
+
+// Checkpoint returns the GUIDs of the enclosures that were already returned,
+// so that the enqueuer can persist them instead of a state file.
+func (s *source) Checkpoint(_ context.Context) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	guids := make([]string, 0, len(s.seen))
+	for g := range s.seen {
+		guids = append(guids, g)
+	}
+	sort.Strings(guids)
+	return json.Marshal(guids)
+}
+
+// Restore adds the GUIDs of a checkpoint to the enclosures that were already returned.
+func (s *source) Restore(_ context.Context, c []byte) error {
+	var guids []string
+	if err := json.Unmarshal(c, &guids); err != nil {
+		return fmt.Errorf("failed to decode checkpoint: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, g := range guids {
+		s.seen[g] = struct{}{}
+	}
+	return nil
+}
+
+// CleanUp is a no-op because feeds are read-only.
+func (s *source) CleanUp(_ context.Context, _ ingest.Codec) error {
+	return nil
+}
+
+// Download will take an Element and download the enclosure.
+func (s *source) Download(ctx context.Context, i ingest.Codec) (*ingest.Object, error) {
+	var m meta
+	if err := json.Unmarshal(i.Meta, &m); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal meta: %w", err)
+	}
+	res, err := s.get(ctx, m.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download enclosure: %w", err)
+	}
+	mt := res.Header.Get("Content-Type")
+	if mt == "" {
+		mt = m.Type
+	}
+
+	return &ingest.Object{
+		Reader:   res.Body,
+		Len:      res.ContentLength,
+		MimeType: mt,
+	}, nil
+}
+
+// get sends a GET request and fails if the response is not successful.
+func (s *source) get(ctx context.Context, u string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+	res, err := s.c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		res.Body.Close()
+		return nil, fmt.Errorf("unexpected status %q for %s", res.Status, u)
+	}
+	return res, nil
+}
+
+// name derives the object name from the URL of the enclosure.
+func name(e enclosure) string {
+	if u, err := url.Parse(e.url); err == nil {
+		if b := path.Base(u.Path); b != "." && b != "/" {
+			return u.Host + "/" + b
+		}
+	}
+	return url.PathEscape(e.guid)
+}
+
+func main() {
+	plugin.RunPluginServer(&source{}, nil)
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/mitchellh/mapstructure"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/plugin"
+)
+
+const (
+	objectContentVersion = "ContentVersion"
+	objectAttachment     = "Attachment"
+
+	defaultAPIVersion = "57.0"
+	defaultLoginURL   = "https://login.salesforce.com"
+)
+
+type sourceConfig struct {
+	// InstanceURL is the URL of the Salesforce instance, e.g. https://example.my.salesforce.com.
+	// It is required for the access token and client credentials flows.
+	InstanceURL string `mapstructure:"instanceURL"`
+	// AccessToken can be given instead of OAuth2 client credentials.
+	AccessToken string
+	// ClientID and ClientSecret are the credentials of a connected app.
+	// If Username and Password are given, then the username-password flow is used,
+	// otherwise the client credentials flow.
+	ClientID     string `mapstructure:"clientID"`
+	ClientSecret string
+	Username     string
+	// Password must include the security token, if required.
+	Password string
+	// LoginURL is the URL of the token endpoint's host for the username-password flow.
+	// It defaults to https://login.salesforce.com.
+	LoginURL   string `mapstructure:"loginURL"`
+	APIVersion string `mapstructure:"apiVersion"`
+	// Objects is a list of "ContentVersion" and "Attachment". It defaults to both.
+	Objects []string
+	// Where is an optional SOQL condition that is added to the queries,
+	// e.g. CreatedDate = LAST_N_DAYS:7.
+	Where string
+	// Delete deletes the records on clean up.
+	// For ContentVersion records, the whole ContentDocument is deleted.
+	Delete bool
+}
+
+// record is a ContentVersion or Attachment record.
+type record struct {
+	ID                string `json:"Id"`
+	Name              string `json:"Name"`
+	ContentType       string `json:"ContentType"`
+	BodyLength        int64  `json:"BodyLength"`
+	Title             string `json:"Title"`
+	PathOnClient      string `json:"PathOnClient"`
+	FileType          string `json:"FileType"`
+	ContentSize       int64  `json:"ContentSize"`
+	ContentDocumentID string `json:"ContentDocumentId"`
+}
+
+type queryResponse struct {
+	Records        []record `json:"records"`
+	Done           bool     `json:"done"`
+	NextRecordsURL string   `json:"nextRecordsUrl"`
+}
+
+// meta is stored in the Meta field of a Codec.
+type meta struct {
+	Object            string `json:"object"`
+	ContentDocumentID string `json:"contentDocumentID,omitempty"`
+	ContentType       string `json:"contentType"`
+	Size              int64  `json:"size"`
+}
+
+var _ plugin.Source = &source{}
+
+// source can fetch the binary bodies of Salesforce records.
+type source struct {
+	mu sync.Mutex
+	c  *http.Client
+	// base is the URL of the REST API, e.g. https://example.my.salesforce.com/services/data/v57.0.
+	base    string
+	objects []string
+	where   string
+	delete  bool
+	// queue is the queue of objects that were not yet queried.
+	queue []string
+	// next is the URL of the next page of the current query.
+	next    string
+	records []ingest.Codec
+}
+
+// Configure will configure the source with the values given by config.
+func (s *source) Configure(config map[string]interface{}) error {
+	sc := new(sourceConfig)
+	if err := mapstructure.Decode(config, sc); err != nil {
+		return err
+	}
+	if sc.APIVersion == "" {
+		sc.APIVersion = defaultAPIVersion
+	}
+	if len(sc.Objects) == 0 {
+		sc.Objects = []string{objectContentVersion, objectAttachment}
+	}
+	for _, o := range sc.Objects {
+		if o != objectContentVersion && o != objectAttachment {
+			return fmt.Errorf("unsupported object %q", o)
+		}
+	}
+	c, instanceURL, err := sc.client()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.c = c
+	s.base = strings.TrimSuffix(instanceURL, "/") + "/services/data/v" + sc.APIVersion
+	s.objects = sc.Objects
+	s.where = sc.Where
+	s.delete = sc.Delete
+
+	return nil
+}
+
+// client returns an authorized http.Client and the URL of the instance.
+func (sc *sourceConfig) client() (*http.Client, string, error) {
+	ctx := context.Background()
+	switch {
+	case sc.AccessToken != "":
+		if sc.InstanceURL == "" {
+			return nil, "", errors.New("instance URL must not be empty")
+		}
+		return oauth2.NewClient(ctx, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: sc.AccessToken})), sc.InstanceURL, nil
+	case sc.ClientID == "" || sc.ClientSecret == "":
+		return nil, "", errors.New("either an access token or a client ID and client secret must be given")
+	case sc.Username != "":
+		loginURL := sc.LoginURL
+		if loginURL == "" {
+			loginURL = defaultLoginURL
+		}
+		oc := &oauth2.Config{
+			ClientID:     sc.ClientID,
+			ClientSecret: sc.ClientSecret,
+			Endpoint: oauth2.Endpoint{
+				TokenURL:  strings.TrimSuffix(loginURL, "/") + "/services/oauth2/token",
+				AuthStyle: oauth2.AuthStyleInParams,
+			},
+		}
+		t, err := oc.PasswordCredentialsToken(ctx, sc.Username, sc.Password)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to get token: %w", err)
+		}
+		instanceURL := sc.InstanceURL
+		if u, ok := t.Extra("instance_url").(string); ok && instanceURL == "" {
+			instanceURL = u
+		}
+		if instanceURL == "" {
+			return nil, "", errors.New("instance URL must not be empty")
+		}
+		// The username-password flow does not issue refresh tokens,
+		// so the token is requested again once it expires.
+		ts := oauth2.ReuseTokenSource(t, tokenSourceFunc(func() (*oauth2.Token, error) {
+			return oc.PasswordCredentialsToken(ctx, sc.Username, sc.Password)
+		}))
+		return oauth2.NewClient(ctx, ts), instanceURL, nil
+	default:
+		if sc.InstanceURL == "" {
+			return nil, "", errors.New("instance URL must not be empty")
+		}
+		cc := &clientcredentials.Config{
+			ClientID:     sc.ClientID,
+			ClientSecret: sc.ClientSecret,
+			TokenURL:     strings.TrimSuffix(sc.InstanceURL, "/") + "/services/oauth2/token",
+			AuthStyle:    oauth2.AuthStyleInParams,
+		}
+		return cc.Client(ctx), sc.InstanceURL, nil
+	}
+}
+
+type tokenSourceFunc func() (*oauth2.Token, error)
+
+func (f tokenSourceFunc) Token() (*oauth2.Token, error) {
+	return f()
+}
+
+// Reset resets the Nexter as if it was newly created.
+func (s *source) Reset(_ context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.queue = append([]string(nil), s.objects...)
+	s.next = ""
+	s.records = nil
+
+	return nil
+}
+
+// Next requests one page of records at a time.
+func (s *source) Next(ctx context.Context) (*ingest.Codec, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(s.records) == 0 {
+		if len(s.queue) == 0 {
+			return nil, io.EOF
+		}
+		if err := s.list(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	c := s.records[0]
+	s.records = s.records[1:]
+	return &c, nil
+}
+
+// list requests the next page of records of the current object.
+// It must be called with the mutex held.
+func (s *source) list(ctx context.Context) error {
+	object := s.queue[0]
+	u := s.next
+	if u == "" {
+		u = s.base + "/query?q=" + url.QueryEscape(s.soql(object))
+	} else {
+		// nextRecordsUrl is relative to the instance.
+		u = s.base[:strings.Index(s.base, "/services/")] + u
+	}
+	res, err := s.do(ctx, http.MethodGet, u)
+	if err != nil {
+		return fmt.Errorf("failed to query %s records: %w", object, err)
+	}
+	defer res.Body.Close()
+	var qr queryResponse
+	if err := json.NewDecoder(res.Body).Decode(&qr); err != nil {
+		return fmt.Errorf("failed to decode query response: %w", err)
+	}
+
+	for _, r := range qr.Records {
+		m := meta{Object: object}
+		var name string
+		if object == objectContentVersion {
+			name = r.PathOnClient
+			if name == "" {
+				name = r.Title
+			}
+			m.ContentDocumentID = r.ContentDocumentID
+			m.Size = r.ContentSize
+		} else {
+			name = r.Name
+			m.ContentType = r.ContentType
+			m.Size = r.BodyLength
+		}
+		buf, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		s.records = append(s.records, ingest.NewCodec(r.ID, fmt.Sprintf("%s/%s/%s", object, r.ID, name), buf))
+	}
+
+	if qr.Done || qr.NextRecordsURL == "" {
+		s.queue = s.queue[1:]
+		s.next = ""
+	} else {
+		s.next = qr.NextRecordsURL
+	}
+	return nil
+}
+
+// soql returns the query for the records of an object.
+func (s *source) soql(object string) string {
+	var q string
+	if object == objectContentVersion {
+		q = "SELECT Id, Title, PathOnClient, FileType, ContentSize, ContentDocumentId FROM ContentVersion WHERE IsLatest = true"
+	} else {
+		q = "SELECT Id, Name, ContentType, BodyLength FROM Attachment"
+	}
+	if s.where != "" {
+		if object == objectContentVersion {
+			q += " AND (" + s.where + ")"
+		} else {
+			q += " WHERE " + s.where
+		}
+	}
+	return q + " ORDER BY Id"
+}
+
+// CleanUp deletes the record if configured to do so.
+func (s *source) CleanUp(ctx context.Context, i ingest.Codec) error {
+	if !s.delete {
+		return nil
+	}
+	var m meta
+	if err := json.Unmarshal(i.Meta, &m); err != nil {
+		return fmt.Errorf("failed to unmarshal meta: %w", err)
+	}
+	u := s.base + "/sobjects/" + objectAttachment + "/" + i.ID
+	if m.Object == objectContentVersion {
+		u = s.base + "/sobjects/ContentDocument/" + m.ContentDocumentID
+	}
+	res, err := s.do(ctx, http.MethodDelete, u)
+	if err != nil {
+		var herr *httpError
+		if errors.As(err, &herr) && herr.code == http.StatusNotFound {
+			return nil
+		}
+		return fmt.Errorf("failed to delete record: %w", err)
+	}
+	res.Body.Close()
+	return nil
+}
+
+// Download will take an Element and download the binary body of the record.
+func (s *source) Download(ctx context.Context, i ingest.Codec) (*ingest.Object, error) {
+	var m meta
+	if err := json.Unmarshal(i.Meta, &m); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal meta: %w", err)
+	}
+	u := s.base + "/sobjects/" + objectAttachment + "/" + i.ID + "/Body"
+	if m.Object == objectContentVersion {
+		u = s.base + "/sobjects/" + objectContentVersion + "/" + i.ID + "/VersionData"
+	}
+	res, err := s.do(ctx, http.MethodGet, u)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download body: %w", err)
+	}
+	mt := m.ContentType
+	if mt == "" {
+		mt = res.Header.Get("Content-Type")
+	}
+	n := res.ContentLength
+	if n < 0 {
+		n = m.Size
+	}
+
+	return &ingest.Object{
+		Reader:   res.Body,
+		Len:      n,
+		MimeType: mt,
+	}, nil
+}
+
+type httpError struct {
+	code   int
+	status string
+	body   string
+}
+
+func (e *httpError) Error() string {
+	return fmt.Sprintf("unexpected status %q: %s", e.status, e.body)
+}
+
+// do sends a request and fails if the response is not successful.
+func (s *source) do(ctx context.Context, method, u string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		defer res.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return nil, &httpError{code: res.StatusCode, status: res.Status, body: string(body)}
+	}
+	return res, nil
+}
+
+func main() {
+	plugin.RunPluginServer(&source{}, nil)
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/kr/fs"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/plugin"
+)
+
+const defaultPort = "22"
+
+type sourceConfig struct {
+	// Address is the host and optional port of the SFTP server.
+	Address  string
+	User     string
+	Password string
+	// PrivateKey is a PEM encoded private key used for public key authentication.
+	PrivateKey string
+	// PrivateKeyFile is the path to a PEM encoded private key used for public key authentication.
+	PrivateKeyFile string
+	// Passphrase decrypts the private key if it is encrypted.
+	Passphrase string
+	// HostKey is the expected public key of the server in authorized_keys format.
+	HostKey string
+	// InsecureIgnoreHostKey disables the verification of the server's host key.
+	InsecureIgnoreHostKey bool
+	// Root is the directory in which to look for files.
+	Root      string
+	Recursive bool
+}
+
+var _ plugin.Source = &source{}
+
+// source can fetch files from an SFTP server.
+type source struct {
+	mu        sync.Mutex
+	cc        *ssh.ClientConfig
+	address   string
+	sc        *ssh.Client
+	c         *sftp.Client
+	w         *fs.Walker
+	root      string
+	recursive bool
+}
+
+// Configure will configure the source with the values given by config.
+func (s *source) Configure(config map[string]interface{}) error {
+	sc := new(sourceConfig)
+	if err := mapstructure.Decode(config, sc); err != nil {
+		return err
+	}
+	if sc.Address == "" {
+		return errors.New("address must not be empty")
+	}
+	if _, _, err := net.SplitHostPort(sc.Address); err != nil {
+		sc.Address = strings.Join([]string{sc.Address, defaultPort}, ":")
+	}
+
+	var auth []ssh.AuthMethod
+	key := []byte(sc.PrivateKey)
+	if sc.PrivateKeyFile != "" {
+		var err error
+		if key, err = os.ReadFile(sc.PrivateKeyFile); err != nil {
+			return fmt.Errorf("failed to read private key file: %w", err)
+		}
+	}
+	if len(key) != 0 {
+		var signer ssh.Signer
+		var err error
+		if sc.Passphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(sc.Passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(key)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to parse private key: %w", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if sc.Password != "" {
+		auth = append(auth, ssh.Password(sc.Password))
+	}
+	if len(auth) == 0 {
+		return errors.New("either a password or a private key must be given")
+	}
+
+	var hkc ssh.HostKeyCallback
+	switch {
+	case sc.HostKey != "":
+		hk, _, _, _, err := ssh.ParseAuthorizedKey([]byte(sc.HostKey))
+		if err != nil {
+			return fmt.Errorf("failed to parse host key: %w", err)
+		}
+		hkc = ssh.FixedHostKey(hk)
+	case sc.InsecureIgnoreHostKey:
+		hkc = ssh.InsecureIgnoreHostKey() //nolint:gosec
+	default:
+		return errors.New("either a host key must be given or host key verification must be disabled explicitly")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cc = &ssh.ClientConfig{
+		User:            sc.User,
+		Auth:            auth,
+		HostKeyCallback: hkc,
+	}
+	s.address = sc.Address
+	s.root = sc.Root
+	if s.root == "" {
+		s.root = "."
+	}
+	s.recursive = sc.Recursive
+
+	return s.connect()
+}
+
+// connect (re-)establishes the connection to the SFTP server.
+// The caller must hold the lock.
+func (s *source) connect() error {
+	if s.c != nil {
+		s.c.Close()
+		s.sc.Close()
+	}
+	sc, err := ssh.Dial("tcp", s.address, s.cc)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %q: %w", s.address, err)
+	}
+	c, err := sftp.NewClient(sc)
+	if err != nil {
+		sc.Close()
+		return fmt.Errorf("failed to create SFTP client: %w", err)
+	}
+	s.sc = sc
+	s.c = c
+	return nil
+}
+
+// client returns the current SFTP client.
+func (s *source) client() *sftp.Client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.c
+}
+
+// Reset resets the Nexter as if it was newly created.
+// If the connection to the server was lost, Reset will reconnect.
+func (s *source) Reset(_ context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.c.Getwd(); err != nil {
+		if err := s.connect(); err != nil {
+			return err
+		}
+	}
+	s.w = s.c.Walk(s.root)
+
+	return nil
+}
+
+// Next ignores the context in this implementation.
+func (s *source) Next(_ context.Context) (*ingest.Codec, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for s.w.Step() {
+		if err := s.w.Err(); err != nil {
+			return nil, err
+		}
+		if s.w.Stat().IsDir() {
+			if !s.recursive && path.Clean(s.w.Path()) != path.Clean(s.root) {
+				s.w.SkipDir()
+			}
+			continue
+		}
+		if !s.w.Stat().Mode().IsRegular() {
+			continue
+		}
+		name := strings.TrimPrefix(s.w.Path(), strings.TrimSuffix(path.Clean(s.root), "/")+"/")
+		c := ingest.NewCodec(s.w.Path(), name, nil)
+		mt := s.w.Stat().ModTime()
+		c.Size, c.LastModified = s.w.Stat().Size(), &mt
+		return &c, nil
+	}
+
+	return nil, io.EOF
+}
+
+// CleanUp removes the file from the server.
+func (s *source) CleanUp(_ context.Context, i ingest.Codec) error {
+	if err := s.client().Remove(i.ID); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Download will open the file on the server.
+func (s *source) Download(_ context.Context, i ingest.Codec) (*ingest.Object, error) {
+	f, err := s.client().Open(i.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to get stat: %w", err)
+	}
+
+	return &ingest.Object{
+		Reader:   f,
+		Len:      stat.Size(),
+		MimeType: mime.TypeByExtension(path.Ext(i.ID)),
+	}, nil
+}
+
+func main() {
+	plugin.RunPluginServer(&source{}, nil)
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/plugin"
+)
+
+const (
+	apiURL   = "https://slack.com/api/"
+	pageSize = 200
+)
+
+type sourceConfig struct {
+	// Token is a bot or user token with the files:read scope.
+	// Deleting files requires the files:write scope.
+	Token string
+	// Channels are the IDs of the channels whose files are listed.
+	Channels []string
+	// Types optionally filters files by type, e.g. "images,pdfs".
+	Types string
+	// Delete deletes files from Slack on clean up.
+	Delete bool
+}
+
+type file struct {
+	ID                 string `json:"id"`
+	Name               string `json:"name"`
+	MimeType           string `json:"mimetype"`
+	Size               int64  `json:"size"`
+	URLPrivateDownload string `json:"url_private_download"`
+	URLPrivate         string `json:"url_private"`
+}
+
+type response struct {
+	OK               bool   `json:"ok"`
+	Error            string `json:"error"`
+	Files            []file `json:"files"`
+	ResponseMetadata struct {
+		NextCursor string `json:"next_cursor"`
+	} `json:"response_metadata"`
+	Paging struct {
+		Page  int `json:"page"`
+		Pages int `json:"pages"`
+	} `json:"paging"`
+}
+
+// meta is stored in the Meta field of a Codec.
+type meta struct {
+	URL      string `json:"url"`
+	MimeType string `json:"mimeType"`
+	Size     int64  `json:"size"`
+}
+
+var _ plugin.Source = &source{}
+
+// source can fetch files that were uploaded to Slack channels.
+type source struct {
+	mu       sync.Mutex
+	c        *http.Client
+	token    string
+	channels []string
+	types    string
+	delete   bool
+	// queue is the queue of channels that were not yet completely listed.
+	queue []string
+	// cursor and page identify the next page of the current channel.
+	cursor string
+	page   int
+	files  []ingest.Codec
+}
+
+// Configure will configure the source with the values given by config.
+func (s *source) Configure(config map[string]interface{}) error {
+	sc := new(sourceConfig)
+	if err := mapstructure.Decode(config, sc); err != nil {
+		return err
+	}
+	if sc.Token == "" {
+		return errors.New("token must not be empty")
+	}
+	if len(sc.Channels) == 0 {
+		return errors.New("channels must not be empty")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.c = http.DefaultClient
+	s.token = sc.Token
+	s.channels = sc.Channels
+	s.types = sc.Types
+	s.delete = sc.Delete
+
+	return nil
+}
+
+// Reset resets the Nexter as if it was newly created.
+func (s *source) Reset(_ context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.queue = append([]string(nil), s.channels...)
+	s.cursor = ""
+	s.page = 1
+	s.files = nil
+
+	return nil
+}
+
+// Next lists one page of files of one channel at a time.
+func (s *source) Next(ctx context.Context) (*ingest.Codec, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(s.files) == 0 {
+		if len(s.queue) == 0 {
+			return nil, io.EOF
+		}
+		if err := s.list(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	c := s.files[0]
+	s.files = s.files[1:]
+	return &c, nil
+}
+
+// list requests the next page of files of the current channel.
+// It must be called with the mutex held.
+func (s *source) list(ctx context.Context) error {
+	channel := s.queue[0]
+	q := url.Values{}
+	q.Set("channel", channel)
+	q.Set("limit", strconv.Itoa(pageSize))
+	q.Set("count", strconv.Itoa(pageSize))
+	if s.types != "" {
+		q.Set("types", s.types)
+	}
+	if s.cursor != "" {
+		q.Set("cursor", s.cursor)
+	} else {
+		q.Set("page", strconv.Itoa(s.page))
+	}
+	r, err := s.call(ctx, http.MethodGet, "files.list", q)
+	if err != nil {
+		return fmt.Errorf("failed to list files of channel %q: %w", channel, err)
+	}
+	for _, f := range r.Files {
+		u := f.URLPrivateDownload
+		if u == "" {
+			u = f.URLPrivate
+		}
+		if u == "" {
+			continue
+		}
+		buf, err := json.Marshal(meta{URL: u, MimeType: f.MimeType, Size: f.Size})
+		if err != nil {
+			return err
+		}
+		s.files = append(s.files, ingest.NewCodec(f.ID, fmt.Sprintf("%s/%s-%s", channel, f.ID, f.Name), buf))
+	}
+
+	switch {
+	case r.ResponseMetadata.NextCursor != "":
+		s.cursor = r.ResponseMetadata.NextCursor
+	case s.cursor == "" && r.Paging.Page < r.Paging.Pages:
+		s.page = r.Paging.Page + 1
+	default:
+		s.queue = s.queue[1:]
+		s.cursor = ""
+		s.page = 1
+	}
+	return nil
+}
+
+// CleanUp deletes the file from Slack if configured to do so.
+func (s *source) CleanUp(ctx context.Context, i ingest.Codec) error {
+	if !s.delete {
+		return nil
+	}
+	_, err := s.call(ctx, http.MethodPost, "files.delete", url.Values{"file": []string{i.ID}})
+	var serr slackError
+	if errors.As(err, &serr) && (serr == "file_not_found" || serr == "file_deleted") {
+		return nil
+	}
+	return err
+}
+
+// Download will take an Element and download the file from Slack.
+func (s *source) Download(ctx context.Context, i ingest.Codec) (*ingest.Object, error) {
+	var m meta
+	if err := json.Unmarshal(i.Meta, &m); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal meta: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.token)
+	res, err := s.c.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file: %w", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("failed to download file: unexpected status %q", res.Status)
+	}
+	// Without the files:read scope, Slack responds with a login page instead of the file.
+	if m.MimeType != "" && !strings.HasPrefix(m.MimeType, "text/html") && strings.HasPrefix(res.Header.Get("Content-Type"), "text/html") {
+		res.Body.Close()
+		return nil, errors.New("failed to download file: received HTML instead of the file; check the scopes of the token")
+	}
+
+	return &ingest.Object{
+		Reader:   res.Body,
+		Len:      m.Size,
+		MimeType: m.MimeType,
+	}, nil
+}
+
+// slackError is an error code returned by the Slack API.
+type slackError string
+
+func (e slackError) Error() string {
+	return "slack API error: " + string(e)
+}
+
+// call calls a method of the Slack Web API.
+func (s *source) call(ctx context.Context, httpMethod, method string, q url.Values) (*response, error) {
+	var req *http.Request
+	var err error
+	if httpMethod == http.MethodGet {
+		req, err = http.NewRequestWithContext(ctx, httpMethod, apiURL+method+"?"+q.Encode(), nil)
+	} else {
+		req, err = http.NewRequestWithContext(ctx, httpMethod, apiURL+method, strings.NewReader(q.Encode()))
+		if req != nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.token)
+	res, err := s.c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusTooManyRequests {
+		return nil, fmt.Errorf("rate limited; retry after %s seconds", res.Header.Get("Retry-After"))
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %q", res.Status)
+	}
+	r := new(response)
+	if err := json.NewDecoder(res.Body).Decode(r); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if !r.OK {
+		return nil, slackError(r.Error)
+	}
+	return r, nil
+}
+
+func main() {
+	plugin.RunPluginServer(&source{}, nil)
+}
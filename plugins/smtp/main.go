@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/connylabs/ingest/plugin"
+	"github.com/connylabs/ingest/storage"
+	"github.com/connylabs/ingest/storage/email"
+)
+
+const (
+	defaultMaxSize = 10 << 20
+	defaultSubject = "{{.Name}}"
+)
+
+type recipientConfig struct {
+	Address string
+	// Subject and Body override the templates of the destination for this recipient.
+	Subject string
+	Body    string
+}
+
+type destinationConfig struct {
+	Host string
+	// Port defaults to 465 for implicit TLS and to 587 otherwise.
+	Port     int
+	Username string
+	Password string
+	// TLS is one of none, starttls and implicit. It defaults to starttls.
+	TLS  string `mapstructure:"tls"`
+	From string
+	// Recipients receive an individual message for every object.
+	Recipients []recipientConfig
+	// Subject and Body are templates that are executed with the Codec of the object
+	// as well as the fields Size, MimeType and Recipient.
+	// Subject defaults to {{.Name}}.
+	Subject string
+	Body    string
+	// MaxSize is the maximum size in bytes of attachments. It defaults to 10 MiB.
+	MaxSize int64
+}
+
+var _ plugin.Destination = &destination{}
+
+// destination emails objects as attachments.
+type destination struct {
+	storage.Storage
+}
+
+// Configure will configure the destination with the values given by config.
+func (d *destination) Configure(config map[string]interface{}) error {
+	dc := new(destinationConfig)
+	if err := mapstructure.Decode(config, dc); err != nil {
+		return err
+	}
+	if dc.Host == "" {
+		return errors.New("host must not be empty")
+	}
+	if dc.From == "" {
+		return errors.New("from must not be empty")
+	}
+	if len(dc.Recipients) == 0 {
+		return errors.New("recipients must not be empty")
+	}
+	switch dc.TLS = strings.ToLower(dc.TLS); dc.TLS {
+	case "":
+		dc.TLS = email.TLSStartTLS
+	case email.TLSNone, email.TLSStartTLS, email.TLSImplicit:
+	default:
+		return fmt.Errorf("unknown TLS mode %q", dc.TLS)
+	}
+	if dc.Port == 0 {
+		dc.Port = 587
+		if dc.TLS == email.TLSImplicit {
+			dc.Port = 465
+		}
+	}
+	if dc.MaxSize <= 0 {
+		dc.MaxSize = defaultMaxSize
+	}
+	if dc.Subject == "" {
+		dc.Subject = defaultSubject
+	}
+	subject, err := parse("subject", dc.Subject)
+	if err != nil {
+		return err
+	}
+	body, err := parse("body", dc.Body)
+	if err != nil {
+		return err
+	}
+	rs := make([]email.Recipient, len(dc.Recipients))
+	for i, rc := range dc.Recipients {
+		if rc.Address == "" {
+			return fmt.Errorf("address of recipient %d must not be empty", i)
+		}
+		rs[i].Address = rc.Address
+		if rs[i].Subject, err = parse("subject", rc.Subject); err != nil {
+			return err
+		}
+		if rs[i].Body, err = parse("body", rc.Body); err != nil {
+			return err
+		}
+	}
+	s := &email.SMTPSender{
+		Addr: net.JoinHostPort(dc.Host, strconv.Itoa(dc.Port)),
+		TLS:  dc.TLS,
+	}
+	if dc.Username != "" {
+		s.Auth = smtp.PlainAuth("", dc.Username, dc.Password, dc.Host)
+	}
+
+	d.Storage = email.New(dc.From, rs, subject, body, dc.MaxSize, s)
+
+	return nil
+}
+
+// parse parses the given template. If the template is empty, then nil is returned.
+func parse(name, text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	t, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s template: %w", name, err)
+	}
+	return t, nil
+}
+
+func main() {
+	plugin.RunPluginServer(nil, &destination{})
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/plugin"
+)
+
+const maxMessages = 10
+
+type sourceConfig struct {
+	// QueueURL is the URL of the SQS queue.
+	QueueURL string `mapstructure:"queueURL"`
+	Region   string
+	// AccessKeyID and SecretAccessKey are optional.
+	// If they are not given, then the default credential chain is used.
+	AccessKeyID     string `mapstructure:"accessKeyID"`
+	SecretAccessKey string
+	// Endpoint optionally overrides the endpoint of SQS and S3, e.g. for LocalStack.
+	Endpoint       string
+	ForcePathStyle bool
+	// WaitTimeSeconds enables long polling when the queue is empty.
+	// It defaults to 0, i.e. short polling.
+	WaitTimeSeconds int64
+	// VisibilityTimeout is the number of seconds for which received messages are hidden from other consumers.
+	// It defaults to the visibility timeout of the queue.
+	VisibilityTimeout int64
+}
+
+// event is an S3 event notification.
+// See https://docs.aws.amazon.com/AmazonS3/latest/userguide/notification-content-structure.html.
+type event struct {
+	// Event is only set for test events.
+	Event   string `json:"Event"`
+	Records []struct {
+		EventName string `json:"eventName"`
+		S3        struct {
+			Bucket struct {
+				Name string `json:"name"`
+			} `json:"bucket"`
+			Object struct {
+				// Key is URL encoded.
+				Key       string `json:"key"`
+				Size      int64  `json:"size"`
+				VersionID string `json:"versionId"`
+			} `json:"object"`
+		} `json:"s3"`
+	} `json:"Records"`
+}
+
+// notification is an SNS notification that wraps an S3 event notification
+// when the bucket publishes to an SNS topic that the queue is subscribed to.
+type notification struct {
+	Type    string `json:"Type"`
+	Message string `json:"Message"`
+}
+
+// meta is stored in the Meta field of a Codec.
+type meta struct {
+	Bucket        string `json:"bucket"`
+	Key           string `json:"key"`
+	VersionID     string `json:"versionID,omitempty"`
+	Size          int64  `json:"size"`
+	ReceiptHandle string `json:"receiptHandle"`
+	// Last is true for the last object referenced by a message.
+	Last bool `json:"last"`
+}
+
+var _ plugin.Source = &source{}
+
+// source yields the S3 objects that are referenced by the event notifications in an SQS queue.
+type source struct {
+	mu                sync.Mutex
+	sqs               *sqs.SQS
+	s3                *s3.S3
+	queueURL          string
+	waitTimeSeconds   int64
+	visibilityTimeout int64
+	// objects is the queue of objects of received messages that were not yet returned.
+	objects []ingest.Codec
+}
+
+// Configure will configure the source with the values given by config.
+func (s *source) Configure(config map[string]interface{}) error {
+	sc := new(sourceConfig)
+	if err := mapstructure.Decode(config, sc); err != nil {
+		return err
+	}
+	if sc.QueueURL == "" {
+		return errors.New("queue URL must not be empty")
+	}
+	c := aws.NewConfig().WithS3ForcePathStyle(sc.ForcePathStyle)
+	if sc.Region != "" {
+		c = c.WithRegion(sc.Region)
+	}
+	if sc.Endpoint != "" {
+		c = c.WithEndpoint(sc.Endpoint)
+	}
+	if sc.AccessKeyID != "" {
+		c = c.WithCredentials(credentials.NewStaticCredentials(sc.AccessKeyID, sc.SecretAccessKey, ""))
+	}
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            *c,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create AWS session: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sqs = sqs.New(sess)
+	s.s3 = s3.New(sess)
+	s.queueURL = sc.QueueURL
+	s.waitTimeSeconds = sc.WaitTimeSeconds
+	s.visibilityTimeout = sc.VisibilityTimeout
+
+	return nil
+}
+
+// Reset drops the objects of received messages that were not yet returned.
+// The messages become visible again once their visibility timeout expires.
+func (s *source) Reset(_ context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.objects = nil
+
+	return nil
+}
+
+// Next receives messages until one references an object.
+// It returns io.EOF when the queue is empty.
+func (s *source) Next(ctx context.Context) (*ingest.Codec, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(s.objects) == 0 {
+		in := &sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(s.queueURL),
+			MaxNumberOfMessages: aws.Int64(maxMessages),
+			WaitTimeSeconds:     aws.Int64(s.waitTimeSeconds),
+		}
+		if s.visibilityTimeout > 0 {
+			in.VisibilityTimeout = aws.Int64(s.visibilityTimeout)
+		}
+		out, err := s.sqs.ReceiveMessageWithContext(ctx, in)
+		if err != nil {
+			return nil, fmt.Errorf("failed to receive messages: %w", err)
+		}
+		if len(out.Messages) == 0 {
+			return nil, io.EOF
+		}
+		for _, m := range out.Messages {
+			cs, err := codecs(m)
+			if err != nil {
+				return nil, err
+			}
+			if len(cs) == 0 {
+				// Messages that do not reference any objects, e.g. test events, are dropped.
+				if err := s.delete(ctx, aws.StringValue(m.ReceiptHandle)); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			s.objects = append(s.objects, cs...)
+		}
+	}
+
+	c := s.objects[0]
+	s.objects = s.objects[1:]
+	return &c, nil
+}
+
+// codecs returns a Codec for every created object in the message.
+func codecs(m *sqs.Message) ([]ingest.Codec, error) {
+	body := []byte(aws.StringValue(m.Body))
+	var n notification
+	if err := json.Unmarshal(body, &n); err == nil && n.Type == "Notification" {
+		body = []byte(n.Message)
+	}
+	var e event
+	if err := json.Unmarshal(body, &e); err != nil {
+		// Messages that are not event notifications would otherwise be received forever.
+		return nil, nil
+	}
+
+	var cs []ingest.Codec
+	var ms []meta
+	for _, r := range e.Records {
+		if !strings.HasPrefix(r.EventName, "ObjectCreated:") {
+			continue
+		}
+		key, err := url.QueryUnescape(r.S3.Object.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unescape key %q: %w", r.S3.Object.Key, err)
+		}
+		ms = append(ms, meta{
+			Bucket:        r.S3.Bucket.Name,
+			Key:           key,
+			VersionID:     r.S3.Object.VersionID,
+			Size:          r.S3.Object.Size,
+			ReceiptHandle: aws.StringValue(m.ReceiptHandle),
+		})
+	}
+	for i := range ms {
+		ms[i].Last = i == len(ms)-1
+		buf, err := json.Marshal(ms[i])
+		if err != nil {
+			return nil, err
+		}
+		id := ms[i].Bucket + "/" + ms[i].Key
+		if ms[i].VersionID != "" {
+			id += "?versionId=" + ms[i].VersionID
+		}
+		cs = append(cs, ingest.NewCodec(id, ms[i].Key, buf))
+	}
+	return cs, nil
+}
+
+// CleanUp deletes the message once its last object is cleaned up.
+// The objects themselves are not deleted.
+func (s *source) CleanUp(ctx context.Context, i ingest.Codec) error {
+	var m meta
+	if err := json.Unmarshal(i.Meta, &m); err != nil {
+		return fmt.Errorf("failed to unmarshal meta: %w", err)
+	}
+	if !m.Last {
+		return nil
+	}
+	return s.delete(ctx, m.ReceiptHandle)
+}
+
+// delete deletes a message from the queue.
+// Receipt handles of messages that were received again in the meantime are no longer valid,
+// in which case the message is deleted when it is cleaned up the next time.
+func (s *source) delete(ctx context.Context, receiptHandle string) error {
+	_, err := s.sqs.DeleteMessageWithContext(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(s.queueURL),
+		ReceiptHandle: aws.String(receiptHandle),
+	})
+	var aerr awserr.Error
+	if errors.As(err, &aerr) && aerr.Code() == sqs.ErrCodeReceiptHandleIsInvalid {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete message: %w", err)
+	}
+	return nil
+}
+
+// Download will take an Element and download the referenced object from S3.
+func (s *source) Download(ctx context.Context, i ingest.Codec) (*ingest.Object, error) {
+	var m meta
+	if err := json.Unmarshal(i.Meta, &m); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal meta: %w", err)
+	}
+	in := &s3.GetObjectInput{
+		Bucket: aws.String(m.Bucket),
+		Key:    aws.String(m.Key),
+	}
+	if m.VersionID != "" {
+		in.VersionId = aws.String(m.VersionID)
+	}
+	out, err := s.s3.GetObjectWithContext(ctx, in)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object: %w", err)
+	}
+
+	return &ingest.Object{
+		Reader:   out.Body,
+		Len:      aws.Int64Value(out.ContentLength),
+		MimeType: aws.StringValue(out.ContentType),
+	}, nil
+}
+
+func main() {
+	plugin.RunPluginServer(&source{}, nil)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/studio-b12/gowebdav"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/plugin"
+)
+
+type sourceConfig struct {
+	// URL is the root of the WebDAV share,
+	// e.g. https://cloud.example.com/remote.php/dav/files/user for Nextcloud.
+	URL string `mapstructure:"url"`
+	// Username and Password are used for basic or digest authentication.
+	// The scheme is negotiated with the server.
+	Username string
+	Password string
+	// Directory is the directory relative to URL in which to look for files.
+	Directory string
+	Recursive bool
+}
+
+var _ plugin.Source = &source{}
+
+// source can fetch files from a WebDAV server.
+type source struct {
+	mu        sync.Mutex
+	c         *gowebdav.Client
+	dir       string
+	recursive bool
+	// dirs is the stack of directories that still need to be listed.
+	dirs []string
+	// files is the queue of files that were not yet returned.
+	files []ingest.Codec
+}
+
+// Configure will configure the source with the values given by config.
+func (s *source) Configure(config map[string]interface{}) error {
+	sc := new(sourceConfig)
+	if err := mapstructure.Decode(config, sc); err != nil {
+		return err
+	}
+	if sc.URL == "" {
+		return errors.New("url must not be empty")
+	}
+	if _, err := url.Parse(sc.URL); err != nil {
+		return fmt.Errorf("failed to parse url: %w", err)
+	}
+	c := gowebdav.NewClient(sc.URL, sc.Username, sc.Password)
+	dir := path.Clean("/" + sc.Directory)
+	fi, err := c.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("failed to stat directory: %w", err)
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%q is not a directory", dir)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.c = c
+	s.dir = dir
+	s.recursive = sc.Recursive
+
+	return nil
+}
+
+// Reset resets the Nexter as if it was newly created.
+func (s *source) Reset(_ context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.dirs = []string{s.dir}
+	s.files = nil
+
+	return nil
+}
+
+// Next lists one directory at a time using PROPFIND and returns the files in it.
+// The ID of the returned Codec is the path of the file on the server.
+func (s *source) Next(_ context.Context) (*ingest.Codec, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(s.files) == 0 {
+		if len(s.dirs) == 0 {
+			return nil, io.EOF
+		}
+		dir := s.dirs[len(s.dirs)-1]
+		s.dirs = s.dirs[:len(s.dirs)-1]
+		fis, err := s.c.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read directory %q: %w", dir, err)
+		}
+		for _, fi := range fis {
+			p := path.Join(dir, fi.Name())
+			if fi.IsDir() {
+				if s.recursive {
+					s.dirs = append(s.dirs, p)
+				}
+				continue
+			}
+			name := strings.TrimPrefix(p, strings.TrimSuffix(s.dir, "/")+"/")
+			c := ingest.NewCodec(p, name, nil)
+			mt := fi.ModTime()
+			c.Size, c.LastModified = fi.Size(), &mt
+			s.files = append(s.files, c)
+		}
+	}
+
+	c := s.files[0]
+	s.files = s.files[1:]
+	return &c, nil
+}
+
+// CleanUp deletes the file from the server.
+func (s *source) CleanUp(_ context.Context, i ingest.Codec) error {
+	if err := s.c.Remove(i.ID); err != nil && !gowebdav.IsErrNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// Download will take an Element and download it from the server.
+func (s *source) Download(_ context.Context, i ingest.Codec) (*ingest.Object, error) {
+	fi, err := s.c.Stat(i.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	mt := mime.TypeByExtension(path.Ext(i.ID))
+	if f, ok := fi.(*gowebdav.File); ok && f.ContentType() != "" {
+		mt = f.ContentType()
+	}
+	r, err := s.c.ReadStream(i.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	return &ingest.Object{
+		Reader:   r,
+		Len:      fi.Size(),
+		MimeType: mt,
+	}, nil
+}
+
+func main() {
+	plugin.RunPluginServer(&source{}, nil)
+}
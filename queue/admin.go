@@ -0,0 +1,148 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/connylabs/ingest"
+)
+
+// apiStreamPurge is the JetStream API subject that purges a stream.
+// It is used directly, because the NATS client cannot purge single subjects.
+const apiStreamPurge = "$JS.API.STREAM.PURGE.%s"
+
+// Admin inspects and purges the streams of a NATS JetStream queue.
+// Unlike New, it never creates or updates streams or consumers.
+type Admin struct {
+	conn *nats.Conn
+	js   nats.JetStreamContext
+}
+
+// StreamState describes the messages that a stream holds.
+type StreamState struct {
+	Messages  uint64
+	Bytes     uint64
+	FirstSeq  uint64
+	LastSeq   uint64
+	Consumers int
+}
+
+// PeekedMessage is a message that was read from a stream without consuming it.
+type PeekedMessage struct {
+	Sequence uint64
+	Subject  string
+	Header   ingest.Header
+	Data     []byte
+}
+
+// NewAdmin connects to the NATS server at the given URL.
+func NewAdmin(url string, auth NATSAuth) (*Admin, error) {
+	opts, err := auth.Options()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := nats.Connect(url, opts...)
+	if err != nil {
+		return nil, err
+	}
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &Admin{conn: conn, js: js}, nil
+}
+
+// Close closes the connection to the NATS server.
+func (a *Admin) Close() {
+	a.conn.Close()
+}
+
+// StreamState returns the state of the stream.
+func (a *Admin) StreamState(ctx context.Context, stream string) (*StreamState, error) {
+	info, err := a.js.StreamInfo(stream, nats.Context(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stream %q: %w", stream, err)
+	}
+	return &StreamState{
+		Messages:  info.State.Msgs,
+		Bytes:     info.State.Bytes,
+		FirstSeq:  info.State.FirstSeq,
+		LastSeq:   info.State.LastSeq,
+		Consumers: info.State.Consumers,
+	}, nil
+}
+
+// ConsumerStats returns the statistics of the durable consumer of the stream
+// or nil if the consumer does not exist.
+func (a *Admin) ConsumerStats(ctx context.Context, stream, durable string) (*ConsumerStats, error) {
+	return consumerStats(ctx, a.js, stream, durable)
+}
+
+// Purge removes all messages of the subject from the stream
+// and returns the number of removed messages.
+func (a *Admin) Purge(ctx context.Context, stream, subject string) (uint64, error) {
+	req, err := json.Marshal(struct {
+		Subject string `json:"filter"`
+	}{subject})
+	if err != nil {
+		return 0, err
+	}
+	msg, err := a.conn.RequestWithContext(ctx, fmt.Sprintf(apiStreamPurge, stream), req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge stream %q: %w", stream, err)
+	}
+	var resp struct {
+		Error *struct {
+			Description string `json:"description"`
+		} `json:"error,omitempty"`
+		Purged uint64 `json:"purged"`
+	}
+	if err := json.Unmarshal(msg.Data, &resp); err != nil {
+		return 0, fmt.Errorf("failed to decode purge response: %w", err)
+	}
+	if resp.Error != nil {
+		return 0, fmt.Errorf("failed to purge stream %q: %s", stream, resp.Error.Description)
+	}
+	return resp.Purged, nil
+}
+
+// Peek returns up to n messages of the subject whose sequences follow the given sequence.
+// It reads the messages one by one, so it is meant for debugging rather than for large streams.
+func (a *Admin) Peek(ctx context.Context, stream, subject string, after uint64, n int) ([]PeekedMessage, error) {
+	s, err := a.StreamState(ctx, stream)
+	if err != nil {
+		return nil, err
+	}
+	seq := after + 1
+	if seq < s.FirstSeq {
+		seq = s.FirstSeq
+	}
+	var ms []PeekedMessage
+	for ; seq <= s.LastSeq && len(ms) < n; seq++ {
+		m, err := a.js.GetMsg(stream, seq, nats.Context(ctx))
+		if errors.Is(err, nats.ErrMsgNotFound) {
+			// The message was already removed.
+			continue
+		}
+		if err != nil {
+			return ms, fmt.Errorf("failed to get message %d of stream %q: %w", seq, stream, err)
+		}
+		if m.Subject != subject {
+			continue
+		}
+		pm := PeekedMessage{Sequence: m.Sequence, Subject: m.Subject, Data: m.Data}
+		if len(m.Header) > 0 {
+			pm.Header = make(ingest.Header, len(m.Header))
+			for k := range m.Header {
+				pm.Header[k] = m.Header.Get(k)
+			}
+		}
+		ms = append(ms, pm)
+	}
+	return ms, nil
+}
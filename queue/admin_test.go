@@ -0,0 +1,66 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/connylabs/ingest"
+)
+
+func TestAdmin(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	e, err := StartEmbedded("nats://127.0.0.1:0", t.TempDir(), NATSAuth{}, nil)
+	require.NoError(t, err)
+	t.Cleanup(e.Shutdown)
+	q, err := New(e.ClientURL(), Options{Stream: "ingest", Replicas: 1, Subjects: []string{"ingest.*"}, Retention: "limits"}, prometheus.NewRegistry())
+	require.NoError(t, err)
+	t.Cleanup(func() { q.Close(ctx) }) //nolint:errcheck
+	sub, err := q.PullSubscribe("ingest.foo", "con")
+	require.NoError(t, err)
+	for _, d := range []string{"a", "b", "c"} {
+		require.NoError(t, q.Publish("ingest.foo", []byte(d), ingest.Header{ingest.HeaderID: d}))
+		require.NoError(t, q.Publish("ingest.bar", []byte(d), nil))
+	}
+	ms, err := sub.Pop(ctx, 1)
+	require.NoError(t, err)
+	require.NoError(t, ms[0].Ack(ctx))
+
+	a, err := NewAdmin(e.ClientURL(), NATSAuth{})
+	require.NoError(t, err)
+	t.Cleanup(a.Close)
+
+	s, err := a.StreamState(ctx, "ingest")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(6), s.Messages)
+	assert.Equal(t, 1, s.Consumers)
+
+	cs, err := a.ConsumerStats(ctx, "ingest", "con")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), cs.Pending)
+	missing, err := a.ConsumerStats(ctx, "ingest", "missing")
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+
+	pms, err := a.Peek(ctx, "ingest", "ingest.foo", cs.AckFloor, 10)
+	require.NoError(t, err)
+	require.Len(t, pms, 2)
+	assert.Equal(t, "b", string(pms[0].Data))
+	assert.Equal(t, "b", pms[0].Header[ingest.HeaderID])
+	assert.Equal(t, "c", string(pms[1].Data))
+
+	n, err := a.Purge(ctx, "ingest", "ingest.bar")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), n)
+	s, err = a.StreamState(ctx, "ingest")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), s.Messages)
+
+	_, err = a.Purge(ctx, "missing", "ingest.bar")
+	assert.Error(t, err)
+}
@@ -0,0 +1,129 @@
+package queue
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/connylabs/ingest"
+)
+
+// collectTimeout bounds the duration of a single collection of consumer statistics.
+const collectTimeout = 5 * time.Second
+
+// ConsumerStats describes the backlog of a durable consumer.
+type ConsumerStats struct {
+	// Pending is the number of messages that were not yet delivered to the consumer.
+	Pending uint64
+	// AckPending is the number of messages that were delivered but not yet acknowledged.
+	AckPending int
+	// Redelivered is the number of messages that were delivered more than once and not yet acknowledged.
+	Redelivered int
+	// AckFloor is the sequence of the stream up to which all messages were acknowledged.
+	AckFloor uint64
+}
+
+// Inspector is implemented by queues that can report the backlog of their consumers.
+type Inspector interface {
+	// ConsumerStats returns the statistics of the durable consumer of the subject.
+	// It returns nil if the consumer does not exist yet.
+	ConsumerStats(ctx context.Context, subject, durable string) (*ConsumerStats, error)
+}
+
+// AsInspector returns the queue as an Inspector if it or any queue that it wraps,
+// e.g. an encrypted queue, can report the backlog of its consumers.
+func AsInspector(q ingest.Queue) (Inspector, bool) {
+	for {
+		if i, ok := q.(Inspector); ok {
+			return i, true
+		}
+		u, ok := q.(interface{ Unwrap() ingest.Queue })
+		if !ok {
+			return nil, false
+		}
+		q = u.Unwrap()
+	}
+}
+
+type collector struct {
+	i Inspector
+	// consumers maps the names of durable consumers to their subjects.
+	consumers map[string]string
+
+	pending     *prometheus.Desc
+	ackPending  *prometheus.Desc
+	redelivered *prometheus.Desc
+	ackFloor    *prometheus.Desc
+	errorsTotal prometheus.Counter
+}
+
+// NewCollector creates a prometheus.Collector that queries the statistics of the given
+// durable consumers, which are mapped to their subjects, whenever metrics are gathered.
+// Consumers that do not exist yet are skipped and failed queries are counted
+// instead of failing the whole collection.
+func NewCollector(i Inspector, consumers map[string]string) prometheus.Collector {
+	return &collector{
+		i:         i,
+		consumers: consumers,
+		pending: prometheus.NewDesc(
+			"ingest_queue_consumer_pending_messages",
+			"The number of messages that were not yet delivered to the consumer.",
+			[]string{"consumer"}, nil,
+		),
+		ackPending: prometheus.NewDesc(
+			"ingest_queue_consumer_ack_pending_messages",
+			"The number of messages that were delivered to the consumer but not yet acknowledged.",
+			[]string{"consumer"}, nil,
+		),
+		redelivered: prometheus.NewDesc(
+			"ingest_queue_consumer_redelivered_messages",
+			"The number of messages that were delivered to the consumer more than once and not yet acknowledged.",
+			[]string{"consumer"}, nil,
+		),
+		ackFloor: prometheus.NewDesc(
+			"ingest_queue_consumer_ack_floor_sequence",
+			"The sequence of the stream up to which the consumer acknowledged all messages.",
+			[]string{"consumer"}, nil,
+		),
+		errorsTotal: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "ingest_queue_consumer_stats_errors_total",
+			Help: "The total number of failed queries of consumer statistics.",
+		}),
+	}
+}
+
+func (c *collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.pending
+	ch <- c.ackPending
+	ch <- c.redelivered
+	ch <- c.ackFloor
+	c.errorsTotal.Describe(ch)
+}
+
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), collectTimeout)
+	defer cancel()
+
+	durables := make([]string, 0, len(c.consumers))
+	for d := range c.consumers {
+		durables = append(durables, d)
+	}
+	sort.Strings(durables)
+	for _, d := range durables {
+		s, err := c.i.ConsumerStats(ctx, c.consumers[d], d)
+		if err != nil {
+			c.errorsTotal.Inc()
+			continue
+		}
+		if s == nil {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(c.pending, prometheus.GaugeValue, float64(s.Pending), d)
+		ch <- prometheus.MustNewConstMetric(c.ackPending, prometheus.GaugeValue, float64(s.AckPending), d)
+		ch <- prometheus.MustNewConstMetric(c.redelivered, prometheus.GaugeValue, float64(s.Redelivered), d)
+		ch <- prometheus.MustNewConstMetric(c.ackFloor, prometheus.GaugeValue, float64(s.AckFloor), d)
+	}
+	c.errorsTotal.Collect(ch)
+}
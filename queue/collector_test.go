@@ -0,0 +1,49 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeInspector map[string]*ConsumerStats
+
+func (f fakeInspector) ConsumerStats(_ context.Context, subject, durable string) (*ConsumerStats, error) {
+	if subject == "broken" {
+		return nil, errors.New("some error")
+	}
+	return f[durable], nil
+}
+
+func TestCollector(t *testing.T) {
+	c := NewCollector(fakeInspector{
+		"con": {Pending: 5, AckPending: 2, Redelivered: 1, AckFloor: 10},
+	}, map[string]string{"con": "ingest.foo", "missing": "ingest.foo", "other": "broken"})
+
+	require.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(`
+# HELP ingest_queue_consumer_ack_floor_sequence The sequence of the stream up to which the consumer acknowledged all messages.
+# TYPE ingest_queue_consumer_ack_floor_sequence gauge
+ingest_queue_consumer_ack_floor_sequence{consumer="con"} 10
+# HELP ingest_queue_consumer_ack_pending_messages The number of messages that were delivered to the consumer but not yet acknowledged.
+# TYPE ingest_queue_consumer_ack_pending_messages gauge
+ingest_queue_consumer_ack_pending_messages{consumer="con"} 2
+# HELP ingest_queue_consumer_pending_messages The number of messages that were not yet delivered to the consumer.
+# TYPE ingest_queue_consumer_pending_messages gauge
+ingest_queue_consumer_pending_messages{consumer="con"} 5
+# HELP ingest_queue_consumer_redelivered_messages The number of messages that were delivered to the consumer more than once and not yet acknowledged.
+# TYPE ingest_queue_consumer_redelivered_messages gauge
+ingest_queue_consumer_redelivered_messages{consumer="con"} 1
+# HELP ingest_queue_consumer_stats_errors_total The total number of failed queries of consumer statistics.
+# TYPE ingest_queue_consumer_stats_errors_total counter
+ingest_queue_consumer_stats_errors_total 1
+`)))
+
+	lps, err := testutil.CollectAndLint(c)
+	require.NoError(t, err)
+	assert.Empty(t, lps)
+}
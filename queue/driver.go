@@ -0,0 +1,161 @@
+package queue
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/connylabs/ingest"
+)
+
+// Options configures a Queue independently of its driver.
+// Drivers ignore the options that do not apply to their broker.
+type Options struct {
+	// Stream is the name of the stream that holds the messages.
+	Stream string
+	// Replicas is the number of replicas of the stream.
+	Replicas int
+	// Subjects are the subjects of the messages that the stream holds.
+	Subjects []string
+	// MaxMsgs is the maximum number of messages in the stream.
+	MaxMsgs int64
+	// MaxAge is the maximum age of messages in the stream.
+	MaxAge time.Duration
+	// MaxBytes is the maximum size of the stream.
+	MaxBytes int64
+	// Retention is the retention policy of the stream,
+	// i.e. interest, limits or workqueue. It defaults to interest.
+	Retention string
+	// Discard selects which messages are discarded when the stream reaches a limit,
+	// i.e. old or new. It defaults to old.
+	Discard string
+	// DedupWindow is the duration for which the IDs of published messages are remembered
+	// to drop duplicates. If it is 0, then the default of the broker is used.
+	DedupWindow time.Duration
+	// Streams are additional streams, e.g. to isolate workflows from each other.
+	// Their subjects must not overlap with Subjects.
+	Streams []Stream
+	// Consumers configure the redelivery of the durable consumers with the given names.
+	// Consumers that are not listed use the defaults of the broker.
+	Consumers []Consumer
+	// NATSAuth configures the authentication of the NATS driver.
+	NATSAuth NATSAuth
+	// PublishRetries is the number of times that publishing a message is retried after a transient error.
+	PublishRetries int
+	// PublishRetryWait is the duration before the first retry, which doubles with every retry.
+	// It defaults to 100ms.
+	PublishRetryWait time.Duration
+	// PublishBufferSize is the maximum number of messages that are buffered while the connection
+	// to the broker is interrupted. If it is 0, then publishing fails while the connection is interrupted.
+	PublishBufferSize int
+	// Logger logs events of the connection to the broker. It may be nil.
+	Logger log.Logger
+}
+
+// Stream configures an additional stream that only holds the messages of its subjects.
+// The limits of the stream are independent of the limits of the Options
+// and a limit of 0 means that there is no limit.
+type Stream struct {
+	Name     string
+	Subjects []string
+	// Replicas defaults to the replicas of the Options.
+	Replicas int
+	MaxMsgs  int64
+	MaxAge   time.Duration
+	MaxBytes int64
+	// Retention defaults to the retention policy of the Options.
+	Retention string
+	// Discard defaults to the discard policy of the Options.
+	Discard string
+}
+
+// Consumer configures when the messages of a durable consumer are delivered again.
+// A value of 0 means that the default of the broker is used.
+type Consumer struct {
+	Name string
+	// AckWait is the duration after which a message that was not acknowledged is delivered again.
+	AckWait time.Duration
+	// MaxDeliver is the maximum number of times that a message is delivered.
+	MaxDeliver int
+	// Backoff are the durations after which a message is delivered again
+	// for consecutive deliveries. It takes precedence over AckWait.
+	Backoff []time.Duration
+}
+
+// Driver creates a Queue for the given URL.
+type Driver func(u *url.URL, o Options, reg prometheus.Registerer) (ingest.Queue, error)
+
+var (
+	driversMu sync.RWMutex
+	drivers   = make(map[string]Driver)
+	// local are the schemes of the drivers whose queues cannot be shared between processes.
+	local = make(map[string]bool)
+)
+
+// Register makes a driver available for URLs with the given scheme.
+// It panics if the scheme is empty or a driver is already registered for it.
+func Register(scheme string, d Driver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	if scheme == "" || d == nil {
+		panic("queue: Register requires a scheme and a driver")
+	}
+	if _, ok := drivers[scheme]; ok {
+		panic(fmt.Sprintf("queue: Register called twice for scheme %q", scheme))
+	}
+	drivers[scheme] = d
+}
+
+// RegisterLocal makes a driver available like Register, whose queues only exist in the process
+// that opens them, e.g. because they are held in memory or in a file that is locked by the process.
+func RegisterLocal(scheme string, d Driver) {
+	Register(scheme, d)
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	local[scheme] = true
+}
+
+// Local reports whether the queue of the given URL only exists in the process that opens it,
+// so that its messages cannot be published and consumed by different processes.
+func Local(rawURL string) (bool, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse queue URL: %w", err)
+	}
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	return local[u.Scheme], nil
+}
+
+// Schemes returns the sorted schemes for which drivers are registered.
+func Schemes() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	s := make([]string, 0, len(drivers))
+	for scheme := range drivers {
+		s = append(s, scheme)
+	}
+	sort.Strings(s)
+	return s
+}
+
+// Open creates a Queue for the given URL with the driver registered for its scheme,
+// e.g. nats://localhost:4222.
+func Open(rawURL string, o Options, reg prometheus.Registerer) (ingest.Queue, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse queue URL: %w", err)
+	}
+	driversMu.RLock()
+	d, ok := drivers[u.Scheme]
+	driversMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no queue driver registered for scheme %q; registered schemes are %v", u.Scheme, Schemes())
+	}
+	return d(u, o, reg)
+}
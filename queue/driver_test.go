@@ -0,0 +1,73 @@
+package queue
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/mocks"
+)
+
+func TestOpen(t *testing.T) {
+	q := new(mocks.Queue)
+	var got *url.URL
+	var gotOptions Options
+	Register("fake", func(u *url.URL, o Options, _ prometheus.Registerer) (ingest.Queue, error) {
+		got, gotOptions = u, o
+		return q, nil
+	})
+
+	o := Options{Stream: "str", Subjects: []string{"sub.*"}}
+	r, err := Open("fake://host/path?a=b", o, nil)
+	require.NoError(t, err)
+	assert.Equal(t, q, r)
+	assert.Equal(t, "host", got.Host)
+	assert.Equal(t, o, gotOptions)
+
+	_, err = Open("unknown://host", o, nil)
+	assert.ErrorContains(t, err, `"unknown"`)
+
+	assert.Contains(t, Schemes(), "nats")
+	assert.Panics(t, func() { Register("fake", nil) })
+}
+
+func TestLocal(t *testing.T) {
+	for _, tc := range []struct {
+		url   string
+		local bool
+	}{
+		{url: "mem://", local: true},
+		{url: "file:///var/lib/ingest/queue.db", local: true},
+		{url: "nats://localhost:4222"},
+		{url: "sqs://eu-central-1/prod"},
+	} {
+		local, err := Local(tc.url)
+		require.NoError(t, err)
+		assert.Equal(t, tc.local, local, tc.url)
+	}
+	_, err := Local("://")
+	assert.Error(t, err)
+}
+
+func TestIsNATS(t *testing.T) {
+	for _, tc := range []struct {
+		url  string
+		nats bool
+	}{
+		{url: "nats://localhost:4222", nats: true},
+		{url: "tls://localhost:4222", nats: true},
+		{url: "mem://"},
+		{url: "file:///var/lib/ingest/queue.db"},
+		{url: "sqs://eu-central-1/prod"},
+	} {
+		nats, err := IsNATS(tc.url)
+		require.NoError(t, err)
+		assert.Equal(t, tc.nats, nats, tc.url)
+	}
+	_, err := IsNATS("://")
+	assert.Error(t, err)
+}
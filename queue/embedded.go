@@ -0,0 +1,116 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+// embeddedStartTimeout is the maximum duration for which to wait for the embedded server to accept connections.
+const embeddedStartTimeout = 10 * time.Second
+
+// Embedded is a NATS server with JetStream that runs in the process.
+type Embedded struct {
+	s *server.Server
+}
+
+// StartEmbedded starts a NATS server with JetStream that stores its data in dir,
+// so that messages survive restarts without an external NATS server.
+// The server listens at the host and port of the URL, e.g. nats://127.0.0.1:4222,
+// where the port 0 selects a random port.
+// A user and password or a token of the auth are required from clients;
+// other authentication methods are not supported.
+func StartEmbedded(rawURL, dir string, auth NATSAuth, logger log.Logger) (*Embedded, error) {
+	if dir == "" {
+		return nil, errors.New("the data directory of the embedded NATS server must not be empty")
+	}
+	if auth.CredentialsFile != "" || auth.NKeySeedFile != "" {
+		return nil, errors.New("the embedded NATS server only supports authentication with a user and password or a token")
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse queue URL: %w", err)
+	}
+	host, p, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the address of the embedded NATS server: %w", err)
+	}
+	port, err := strconv.Atoi(p)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q: %w", p, err)
+	}
+	if port == 0 {
+		port = server.RANDOM_PORT
+	}
+
+	s, err := server.NewServer(&server.Options{
+		ServerName:    "ingest",
+		Host:          host,
+		Port:          port,
+		JetStream:     true,
+		StoreDir:      dir,
+		Username:      auth.User,
+		Password:      auth.Password,
+		Authorization: auth.Token,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create embedded NATS server: %w", err)
+	}
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	s.SetLogger(&serverLogger{log.With(logger, "component", "nats-server")}, false, false)
+	go s.Start()
+	if !s.ReadyForConnections(embeddedStartTimeout) {
+		s.Shutdown()
+		return nil, fmt.Errorf("embedded NATS server did not accept connections within %s", embeddedStartTimeout)
+	}
+	return &Embedded{s: s}, nil
+}
+
+// ClientURL returns the URL at which clients can connect to the server.
+func (e *Embedded) ClientURL() string {
+	return e.s.ClientURL()
+}
+
+// Shutdown stops the server and waits until its data is flushed.
+func (e *Embedded) Shutdown() {
+	e.s.Shutdown()
+	e.s.WaitForShutdown()
+}
+
+// serverLogger adapts a log.Logger to the logger of the NATS server.
+type serverLogger struct {
+	l log.Logger
+}
+
+func (l *serverLogger) Noticef(format string, v ...interface{}) {
+	level.Info(l.l).Log("msg", fmt.Sprintf(format, v...))
+}
+
+func (l *serverLogger) Warnf(format string, v ...interface{}) {
+	level.Warn(l.l).Log("msg", fmt.Sprintf(format, v...))
+}
+
+func (l *serverLogger) Fatalf(format string, v ...interface{}) {
+	level.Error(l.l).Log("msg", fmt.Sprintf(format, v...))
+}
+
+func (l *serverLogger) Errorf(format string, v ...interface{}) {
+	level.Error(l.l).Log("msg", fmt.Sprintf(format, v...))
+}
+
+func (l *serverLogger) Debugf(format string, v ...interface{}) {
+	level.Debug(l.l).Log("msg", fmt.Sprintf(format, v...))
+}
+
+func (l *serverLogger) Tracef(format string, v ...interface{}) {
+	level.Debug(l.l).Log("msg", fmt.Sprintf(format, v...))
+}
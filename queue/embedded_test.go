@@ -0,0 +1,57 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/connylabs/ingest"
+)
+
+func TestEmbedded(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	o := Options{Stream: "ingest", Replicas: 1, Subjects: []string{"ingest.*"}, Retention: "workqueue"}
+
+	e, err := StartEmbedded("nats://127.0.0.1:0", dir, NATSAuth{}, nil)
+	require.NoError(t, err)
+	q, err := New(e.ClientURL(), o, prometheus.NewRegistry())
+	require.NoError(t, err)
+	require.NoError(t, q.Publish("ingest.foo", []byte("a"), nil))
+	require.NoError(t, q.Close(ctx))
+	e.Shutdown()
+
+	// The message survives a restart of the server.
+	e, err = StartEmbedded("nats://127.0.0.1:0", dir, NATSAuth{}, nil)
+	require.NoError(t, err)
+	t.Cleanup(e.Shutdown)
+	q, err = New(e.ClientURL(), o, prometheus.NewRegistry())
+	require.NoError(t, err)
+	t.Cleanup(func() { q.Close(ctx) }) //nolint:errcheck
+	sub, err := q.PullSubscribe("ingest.foo", "con")
+	require.NoError(t, err)
+	ms, err := sub.Pop(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, ms, 1)
+	assert.Equal(t, "a", string(ms[0].Data()))
+	assert.Equal(t, 1, ingest.Deliveries(ms[0]))
+
+	// Negatively acknowledged messages are delivered again.
+	require.NoError(t, ingest.Nak(ctx, ms[0], 0))
+	ms, err = sub.Pop(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, ms, 1)
+	assert.Equal(t, "a", string(ms[0].Data()))
+	assert.Equal(t, 2, ingest.Deliveries(ms[0]))
+	require.NoError(t, ms[0].Ack(ctx))
+
+	_, err = StartEmbedded("nats://127.0.0.1:0", "", NATSAuth{}, nil)
+	assert.Error(t, err)
+	_, err = StartEmbedded("nats://127.0.0.1:0", dir, NATSAuth{CredentialsFile: "creds"}, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,203 @@
+package queue
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/connylabs/ingest"
+)
+
+// Keyring encrypts and decrypts the data of messages with AES-GCM.
+// It encrypts with its primary key and decrypts with any of its keys,
+// so that keys can be rotated while messages that were encrypted
+// with a previous key are still queued.
+type Keyring struct {
+	primary string
+	aeads   map[string]cipher.AEAD
+}
+
+// NewKeyring creates a Keyring from AES keys of 16, 24 or 32 bytes.
+// The key is used for encryption and the previous keys are only used for decryption.
+func NewKeyring(key []byte, previous ...[]byte) (*Keyring, error) {
+	k := &Keyring{aeads: make(map[string]cipher.AEAD, len(previous)+1)}
+	for i, b := range append([][]byte{key}, previous...) {
+		block, err := aes.NewCipher(b)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption key: %w", err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		id := keyID(b)
+		if i == 0 {
+			k.primary = id
+		}
+		k.aeads[id] = aead
+	}
+	return k, nil
+}
+
+// keyID derives an identifier from the key that reveals nothing about the key itself.
+func keyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// associatedData returns the data that is authenticated with the data of a message with the given subject and header,
+// so that the data cannot be moved to another subject or message.
+func associatedData(subject string, h ingest.Header) []byte {
+	return []byte(subject + "\x00" + h[ingest.HeaderID])
+}
+
+// Encrypt encrypts the data of a message with the given subject and header with the primary key
+// and returns the ID of the key and the random nonce followed by the ciphertext.
+// The subject and the ID of the message are authenticated as associated data.
+func (k *Keyring) Encrypt(subject string, h ingest.Header, data []byte) (string, []byte, error) {
+	aead := k.aeads[k.primary]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(data)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return k.primary, aead.Seal(nonce, nonce, data, associatedData(subject, h)), nil
+}
+
+// Decrypt decrypts the data of a message with the given subject with the key that the header names.
+func (k *Keyring) Decrypt(subject string, h ingest.Header, data []byte) ([]byte, error) {
+	id, ok := h[ingest.HeaderEncryptionKey]
+	if !ok {
+		return nil, errors.New("message is not encrypted")
+	}
+	aead, ok := k.aeads[id]
+	if !ok {
+		return nil, fmt.Errorf("message is encrypted with unknown key %q", id)
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("encrypted message is too short")
+	}
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], associatedData(subject, h))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt message: %w", err)
+	}
+	return plain, nil
+}
+
+type encryptedQueue struct {
+	ingest.Queue
+	k *Keyring
+}
+
+// NewEncrypted wraps the queue, so that the data of messages is encrypted before it is published
+// and decrypted when it is popped. Headers are not encrypted, but the subject and the ID of a message
+// are authenticated with its data, and the hash header is replaced with the hash of the ciphertext,
+// so that it does not reveal which messages have the same data.
+// Popped messages carry the hash of their decrypted data again.
+// Messages that cannot be decrypted are returned without data and with the error.
+func NewEncrypted(q ingest.Queue, k *Keyring) ingest.Queue {
+	return &encryptedQueue{Queue: q, k: k}
+}
+
+// Unwrap returns the wrapped queue.
+func (q *encryptedQueue) Unwrap() ingest.Queue {
+	return q.Queue
+}
+
+func (q *encryptedQueue) Publish(subject string, data []byte, header ingest.Header) error {
+	id, ciphertext, err := q.k.Encrypt(subject, header, data)
+	if err != nil {
+		return err
+	}
+	h := make(ingest.Header, len(header)+1)
+	for k, v := range header {
+		h[k] = v
+	}
+	h[ingest.HeaderEncryptionKey] = id
+	if _, ok := h[ingest.HeaderHash]; ok {
+		h[ingest.HeaderHash] = hash(ciphertext)
+	}
+	return q.Queue.Publish(subject, ciphertext, h)
+}
+
+func (q *encryptedQueue) PullSubscribe(subject, durable string) (ingest.Subscription, error) {
+	s, err := q.Queue.PullSubscribe(subject, durable)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptedSubscription{Subscription: s, k: q.k, subject: subject}, nil
+}
+
+type encryptedSubscription struct {
+	ingest.Subscription
+	k       *Keyring
+	subject string
+}
+
+func (s *encryptedSubscription) Pop(ctx context.Context, n int) ([]ingest.Message, error) {
+	msgs, err := s.Subscription.Pop(ctx, n)
+	for i := range msgs {
+		msgs[i] = s.decrypt(msgs[i])
+	}
+	return msgs, err
+}
+
+// decrypt verifies the hash of the ciphertext of the message and decrypts it.
+func (s *encryptedSubscription) decrypt(m ingest.Message) *decryptedMessage {
+	h := make(ingest.Header, len(m.Header()))
+	for k, v := range m.Header() {
+		h[k] = v
+	}
+	if v, ok := h[ingest.HeaderHash]; ok && v != hash(m.Data()) {
+		return &decryptedMessage{Message: m, header: h, err: fmt.Errorf("encrypted message does not match its hash %q", v)}
+	}
+	data, err := s.k.Decrypt(s.subject, h, m.Data())
+	if _, ok := h[ingest.HeaderHash]; ok && err == nil {
+		h[ingest.HeaderHash] = hash(data)
+	}
+	return &decryptedMessage{Message: m, header: h, data: data, err: err}
+}
+
+// hash returns the value of the hash header for the given data.
+func hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// decryptedMessage is a message whose data was decrypted.
+type decryptedMessage struct {
+	ingest.Message
+	header ingest.Header
+	data   []byte
+	err    error
+}
+
+func (m *decryptedMessage) Data() []byte {
+	return m.data
+}
+
+// Header returns the header of the message with the hash of the decrypted data.
+func (m *decryptedMessage) Header() ingest.Header {
+	return m.header
+}
+
+// Err returns the reason why the message could not be decrypted.
+func (m *decryptedMessage) Err() error {
+	return m.err
+}
+
+// Nak forwards to the wrapped message if it implements ingest.Naker.
+func (m *decryptedMessage) Nak(ctx context.Context, delay time.Duration) error {
+	return ingest.Nak(ctx, m.Message, delay)
+}
+
+// Deliveries forwards to the wrapped message if it implements ingest.Naker.
+func (m *decryptedMessage) Deliveries() int {
+	return ingest.Deliveries(m.Message)
+}
@@ -0,0 +1,70 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/connylabs/ingest"
+)
+
+func TestEncrypted(t *testing.T) {
+	oldKey := bytes.Repeat([]byte{1}, 32)
+	newKey := bytes.Repeat([]byte{2}, 16)
+
+	old, err := NewKeyring(oldKey)
+	require.NoError(t, err)
+	k, err := NewKeyring(newKey, oldKey)
+	require.NoError(t, err)
+	_, err = NewKeyring([]byte("short"))
+	assert.Error(t, err)
+
+	ctx := context.Background()
+	inner := NewMemory(10, prometheus.NewRegistry())
+	raw, err := inner.PullSubscribe("ingest.raw", "raw")
+	require.NoError(t, err)
+	require.NoError(t, NewEncrypted(inner, k).Publish("ingest.raw", []byte("a"), ingest.Header{ingest.HeaderID: "a", ingest.HeaderHash: hash([]byte("a"))}))
+	ms, err := raw.Pop(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, ms, 1)
+	assert.NotEqual(t, "a", string(ms[0].Data()))
+	// The hash of the data would reveal messages with the same data.
+	assert.Equal(t, hash(ms[0].Data()), ms[0].Header()[ingest.HeaderHash])
+	_, err = old.Decrypt("ingest.raw", ms[0].Header(), ms[0].Data())
+	assert.Error(t, err, "messages must not be decrypted with an unknown key")
+	plain, err := k.Decrypt("ingest.raw", ms[0].Header(), ms[0].Data())
+	require.NoError(t, err)
+	assert.Equal(t, "a", string(plain))
+	_, err = k.Decrypt("ingest.foo", ms[0].Header(), ms[0].Data())
+	assert.Error(t, err, "messages must not be moved to another subject")
+	_, err = k.Decrypt("ingest.raw", ingest.Header{ingest.HeaderID: "b", ingest.HeaderEncryptionKey: keyID(newKey)}, ms[0].Data())
+	assert.Error(t, err, "the data of messages must not be moved to another message")
+
+	sub, err := NewEncrypted(inner, k).PullSubscribe("ingest.foo", "con")
+	require.NoError(t, err)
+	header := ingest.Header{ingest.HeaderID: "a", ingest.HeaderHash: hash([]byte("a"))}
+	require.NoError(t, NewEncrypted(inner, k).Publish("ingest.foo", []byte("a"), header))
+	assert.Equal(t, ingest.Header{ingest.HeaderID: "a", ingest.HeaderHash: hash([]byte("a"))}, header, "the header of the caller must not be modified")
+	// Messages that were encrypted with a previous key can still be decrypted.
+	require.NoError(t, NewEncrypted(inner, old).Publish("ingest.foo", []byte("b"), nil))
+	require.NoError(t, inner.Publish("ingest.foo", []byte("c"), nil))
+
+	ms, err = sub.Pop(ctx, 3)
+	require.NoError(t, err)
+	require.Len(t, ms, 3)
+	assert.Equal(t, "a", string(ms[0].Data()))
+	assert.Equal(t, "a", ms[0].Header()[ingest.HeaderID])
+	assert.Equal(t, hash([]byte("a")), ms[0].Header()[ingest.HeaderHash])
+	assert.Equal(t, keyID(newKey), ms[0].Header()[ingest.HeaderEncryptionKey])
+	assert.NoError(t, ms[0].(interface{ Err() error }).Err())
+	assert.Equal(t, "b", string(ms[1].Data()))
+	assert.Nil(t, ms[2].Data())
+	assert.Error(t, ms[2].(interface{ Err() error }).Err())
+
+	_, ok := AsInspector(NewEncrypted(inner, k))
+	assert.False(t, ok)
+}
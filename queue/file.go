@@ -0,0 +1,294 @@
+package queue
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/connylabs/ingest"
+)
+
+// inflightSuffix is appended to the name of the bucket of a subject
+// to name the bucket of its popped messages that were not yet acknowledged.
+const inflightSuffix = "\x00inflight"
+
+// deadSuffix is appended to the name of the bucket of a subject
+// to name the bucket of its records that cannot be decoded.
+const deadSuffix = "\x00dead"
+
+func init() {
+	RegisterLocal("file", func(u *url.URL, o Options, reg prometheus.Registerer) (ingest.Queue, error) {
+		if u.Path == "" {
+			return nil, errors.New("the path of the queue file must not be empty")
+		}
+		return NewFile(u.Path, o.Logger, reg)
+	})
+}
+
+type fileQueue struct {
+	db                          *bolt.DB
+	logger                      log.Logger
+	queueOperationsTotalCounter *prometheus.CounterVec
+
+	mu sync.Mutex
+	// wake is closed and replaced whenever a message is published.
+	wake chan struct{}
+}
+
+// NewFile creates a Queue that stores the messages of every subject in a BoltDB file at the given path,
+// e.g. file:///var/lib/ingest/queue.db, so that messages survive restarts without a NATS server.
+// The file can only be opened by one process at a time.
+// Messages that were popped but not acknowledged are delivered again
+// when the file is opened the next time.
+// Records that cannot be decoded are moved out of the way and logged to the logger, which may be nil.
+func NewFile(path string, logger log.Logger, reg prometheus.Registerer) (ingest.Queue, error) {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open queue file: %w", err)
+	}
+	if err := db.Update(requeue); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to requeue unacknowledged messages: %w", err)
+	}
+	return &fileQueue{
+		db:                          db,
+		logger:                      logger,
+		queueOperationsTotalCounter: newOperationsCounter(reg),
+		wake:                        make(chan struct{}),
+	}, nil
+}
+
+// requeue moves all messages that were not acknowledged back to the buckets of their subjects.
+func requeue(tx *bolt.Tx) error {
+	var inflight [][]byte
+	if err := tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+		if n := len(name) - len(inflightSuffix); n > 0 && string(name[n:]) == inflightSuffix {
+			inflight = append(inflight, append([]byte(nil), name...))
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, name := range inflight {
+		b, err := tx.CreateBucketIfNotExists(name[:len(name)-len(inflightSuffix)])
+		if err != nil {
+			return err
+		}
+		if err := tx.Bucket(name).ForEach(func(k, v []byte) error {
+			return b.Put(k, v)
+		}); err != nil {
+			return err
+		}
+		if err := tx.DeleteBucket(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the queue file.
+func (q *fileQueue) Close(_ context.Context) error {
+	return q.db.Close()
+}
+
+// Publish appends the message to the bucket of the subject.
+// The message is synced to disk before Publish returns.
+func (q *fileQueue) Publish(subject string, data []byte, header ingest.Header) error {
+	value, err := encode(data, header)
+	if err != nil {
+		q.queueOperationsTotalCounter.WithLabelValues("publish", "error").Inc()
+		return err
+	}
+	err = q.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(subject))
+		if err != nil {
+			return err
+		}
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		return b.Put(key(seq), value)
+	})
+	if err != nil {
+		q.queueOperationsTotalCounter.WithLabelValues("publish", "error").Inc()
+		return fmt.Errorf("failed to store message: %w", err)
+	}
+	q.queueOperationsTotalCounter.WithLabelValues("publish", "success").Inc()
+
+	q.mu.Lock()
+	close(q.wake)
+	q.wake = make(chan struct{})
+	q.mu.Unlock()
+	return nil
+}
+
+// PullSubscribe creates a Subscription for the bucket of the subject.
+// All subscribers of a subject compete for its messages regardless of the durable name.
+func (q *fileQueue) PullSubscribe(subject string, _ string) (ingest.Subscription, error) {
+	return &fileSubscription{q: q, subject: subject, popsTotalCounter: q.queueOperationsTotalCounter.MustCurryWith(prometheus.Labels{"operation": "pop"})}, nil
+}
+
+// encode prefixes the data with the length of the JSON encoded header and the header itself.
+func encode(data []byte, header ingest.Header) ([]byte, error) {
+	var h []byte
+	if len(header) > 0 {
+		var err error
+		if h, err = json.Marshal(header); err != nil {
+			return nil, fmt.Errorf("failed to encode header: %w", err)
+		}
+	}
+	buf := binary.AppendUvarint(make([]byte, 0, binary.MaxVarintLen64+len(h)+len(data)), uint64(len(h)))
+	buf = append(buf, h...)
+	return append(buf, data...), nil
+}
+
+// decode is the inverse of encode.
+func decode(value []byte) ([]byte, ingest.Header, error) {
+	n, i := binary.Uvarint(value)
+	if i <= 0 || uint64(len(value)-i) < n {
+		return nil, nil, errors.New("invalid message")
+	}
+	var header ingest.Header
+	if n > 0 {
+		if err := json.Unmarshal(value[i:i+int(n)], &header); err != nil {
+			return nil, nil, fmt.Errorf("failed to decode header: %w", err)
+		}
+	}
+	return value[i+int(n):], header, nil
+}
+
+// key encodes a sequence number so that keys are sorted in the order of publication.
+func key(seq uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, seq)
+	return k
+}
+
+type fileSubscription struct {
+	q                *fileQueue
+	subject          string
+	popsTotalCounter *prometheus.CounterVec
+}
+
+func (s *fileSubscription) Close() error {
+	return nil
+}
+
+// Pop blocks until at least one message is available or the context is done
+// and returns up to batch messages in the order in which they were published.
+// Popped messages are delivered again after a restart unless they are acknowledged.
+func (s *fileSubscription) Pop(ctx context.Context, batch int) ([]ingest.Message, error) {
+	for {
+		s.q.mu.Lock()
+		wake := s.q.wake
+		s.q.mu.Unlock()
+
+		ms, err := s.pop(batch)
+		if err != nil {
+			s.popsTotalCounter.WithLabelValues("error").Inc()
+			return nil, err
+		}
+		if len(ms) > 0 {
+			s.popsTotalCounter.WithLabelValues("success").Inc()
+			return ms, nil
+		}
+		select {
+		case <-ctx.Done():
+			s.popsTotalCounter.WithLabelValues("error").Inc()
+			return nil, ctx.Err()
+		case <-wake:
+		}
+	}
+}
+
+// pop moves up to batch messages from the bucket of the subject to its inflight bucket.
+// Records that cannot be decoded are moved to the dead bucket of the subject,
+// so that they do not block the messages that were published after them.
+func (s *fileSubscription) pop(batch int) ([]ingest.Message, error) {
+	var ms []ingest.Message
+	var dead []deadRecord
+	err := s.q.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(s.subject))
+		if b == nil {
+			return nil
+		}
+		inflight, err := tx.CreateBucketIfNotExists([]byte(s.subject + inflightSuffix))
+		if err != nil {
+			return err
+		}
+		c := b.Cursor()
+		for k, v := c.First(); k != nil && len(ms) < batch; k, v = c.First() {
+			// Slices returned by BoltDB are only valid during the transaction.
+			to := inflight
+			data, header, derr := decode(append([]byte(nil), v...))
+			if derr != nil {
+				if to, err = tx.CreateBucketIfNotExists([]byte(s.subject + deadSuffix)); err != nil {
+					return err
+				}
+				dead = append(dead, deadRecord{key: binary.BigEndian.Uint64(k), err: derr})
+			}
+			if err := to.Put(k, v); err != nil {
+				return err
+			}
+			if err := c.Delete(); err != nil {
+				return err
+			}
+			if to == inflight {
+				ms = append(ms, &fileMessage{s: s, key: append([]byte(nil), k...), data: data, header: header})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to pop messages: %w", err)
+	}
+	for _, d := range dead {
+		level.Error(s.q.logger).Log("msg", "moved undecodable record to the dead bucket", "subject", s.subject, "key", d.key, "err", d.err.Error())
+	}
+	return ms, nil
+}
+
+// deadRecord is a record that could not be decoded.
+type deadRecord struct {
+	key uint64
+	err error
+}
+
+type fileMessage struct {
+	s      *fileSubscription
+	key    []byte
+	data   []byte
+	header ingest.Header
+}
+
+func (m *fileMessage) Data() []byte {
+	return m.data
+}
+
+func (m *fileMessage) Header() ingest.Header {
+	return m.header
+}
+
+// Ack removes the message from the queue file.
+func (m *fileMessage) Ack(_ context.Context) error {
+	return m.s.q.db.Update(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(m.s.subject + inflightSuffix)); b != nil {
+			return b.Delete(m.key)
+		}
+		return nil
+	})
+}
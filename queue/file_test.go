@@ -0,0 +1,96 @@
+package queue
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/connylabs/ingest"
+)
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.db")
+	ctx := context.Background()
+
+	q, err := Open("file://"+path, Options{}, prometheus.NewRegistry())
+	require.NoError(t, err)
+	for _, d := range []string{"a", "b", "c"} {
+		require.NoError(t, q.Publish("ingest.foo", []byte(d), ingest.Header{ingest.HeaderID: d}))
+	}
+	sub, err := q.PullSubscribe("ingest.foo", "con")
+	require.NoError(t, err)
+	ms, err := sub.Pop(ctx, 2)
+	require.NoError(t, err)
+	require.Len(t, ms, 2)
+	assert.Equal(t, "a", string(ms[0].Data()))
+	assert.Equal(t, "b", string(ms[1].Data()))
+	require.NoError(t, ms[0].Ack(ctx))
+	require.NoError(t, q.Close(ctx))
+
+	// The message that was not acknowledged is delivered again after a restart.
+	q, err = NewFile(path, nil, prometheus.NewRegistry())
+	require.NoError(t, err)
+	t.Cleanup(func() { q.Close(ctx) }) //nolint:errcheck
+	sub, err = q.PullSubscribe("ingest.foo", "con")
+	require.NoError(t, err)
+	ms, err = sub.Pop(ctx, 3)
+	require.NoError(t, err)
+	require.Len(t, ms, 2)
+	assert.Equal(t, "b", string(ms[0].Data()))
+	assert.Equal(t, "c", string(ms[1].Data()))
+	assert.Equal(t, ingest.Header{ingest.HeaderID: "c"}, ms[1].Header())
+
+	// Pop waits for messages to be published.
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		q.Publish("ingest.foo", []byte("d"), nil) //nolint:errcheck
+	}()
+	ms, err = sub.Pop(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, ms, 1)
+	assert.Equal(t, "d", string(ms[0].Data()))
+	assert.Nil(t, ms[0].Header())
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = sub.Pop(cctx, 1)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestFileUndecodable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.db")
+	ctx := context.Background()
+
+	q, err := NewFile(path, nil, prometheus.NewRegistry())
+	require.NoError(t, err)
+	for _, d := range []string{"a", "b", "c"} {
+		require.NoError(t, q.Publish("ingest.foo", []byte(d), nil))
+	}
+	// Corrupt the record of the first message.
+	require.NoError(t, q.(*fileQueue).db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("ingest.foo")).Put(key(1), []byte{0xff})
+	}))
+
+	// The undecodable record does not block the messages that were published after it.
+	sub, err := q.PullSubscribe("ingest.foo", "con")
+	require.NoError(t, err)
+	ms, err := sub.Pop(ctx, 3)
+	require.NoError(t, err)
+	require.Len(t, ms, 2)
+	assert.Equal(t, "b", string(ms[0].Data()))
+	assert.Equal(t, "c", string(ms[1].Data()))
+
+	// The record was moved to the dead bucket.
+	require.NoError(t, q.(*fileQueue).db.View(func(tx *bolt.Tx) error {
+		assert.Equal(t, []byte{0xff}, tx.Bucket([]byte("ingest.foo"+deadSuffix)).Get(key(1)))
+		assert.Nil(t, tx.Bucket([]byte("ingest.foo")).Get(key(1)))
+		return nil
+	}))
+	require.NoError(t, q.Close(ctx))
+}
@@ -0,0 +1,194 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/connylabs/ingest"
+)
+
+// DefaultMemorySize is the default number of messages that a subject of an in-memory queue can hold.
+const DefaultMemorySize = 1024
+
+// ErrFull is returned when a message is published to a subject of an in-memory queue that is full.
+var ErrFull = errors.New("queue is full")
+
+func init() {
+	RegisterLocal("mem", func(u *url.URL, o Options, reg prometheus.Registerer) (ingest.Queue, error) {
+		size := o.MaxMsgs
+		if s := u.Query().Get("size"); s != "" {
+			var err error
+			if size, err = strconv.ParseInt(s, 10, 64); err != nil || size < 1 {
+				return nil, fmt.Errorf("invalid size %q", s)
+			}
+		}
+		return NewMemory(int(size), reg), nil
+	})
+}
+
+type memoryQueue struct {
+	size                        int
+	queueOperationsTotalCounter *prometheus.CounterVec
+
+	mu       sync.Mutex
+	subjects map[string]*memorySubject
+}
+
+// NewMemory creates a Queue that holds up to size messages of every subject in memory.
+// The memory of messages is only allocated when they are published, so a large size does not cost memory up front.
+// It only connects enqueuers and dequeuers within the same process
+// and all messages are lost when the process exits.
+// Messages are removed from the queue when they are popped, so acknowledging them has no effect
+// and messages that fail to be processed are not delivered again.
+// If size is not positive, then DefaultMemorySize is used.
+func NewMemory(size int, reg prometheus.Registerer) ingest.Queue {
+	if size < 1 {
+		size = DefaultMemorySize
+	}
+	return &memoryQueue{
+		size:                        size,
+		queueOperationsTotalCounter: newOperationsCounter(reg),
+		subjects:                    make(map[string]*memorySubject),
+	}
+}
+
+// Close is a no-op. Messages that were not popped are dropped.
+func (q *memoryQueue) Close(_ context.Context) error {
+	return nil
+}
+
+// Publish adds the message to the subject.
+// It does not block and returns ErrFull if the subject is full.
+func (q *memoryQueue) Publish(subject string, data []byte, header ingest.Header) error {
+	if !q.subject(subject).push(&memoryMessage{data: data, header: header}) {
+		q.queueOperationsTotalCounter.WithLabelValues("publish", "error").Inc()
+		return ErrFull
+	}
+	q.queueOperationsTotalCounter.WithLabelValues("publish", "success").Inc()
+	return nil
+}
+
+// PullSubscribe creates a Subscription for the subject.
+// All subscribers of a subject compete for its messages regardless of the durable name.
+func (q *memoryQueue) PullSubscribe(subject string, _ string) (ingest.Subscription, error) {
+	return &memorySubscription{s: q.subject(subject), popsTotalCounter: q.queueOperationsTotalCounter.MustCurryWith(prometheus.Labels{"operation": "pop"})}, nil
+}
+
+// subject returns the subject and creates it if it does not exist.
+func (q *memoryQueue) subject(subject string) *memorySubject {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	s, ok := q.subjects[subject]
+	if !ok {
+		s = &memorySubject{size: q.size, ready: make(chan struct{}, 1)}
+		q.subjects[subject] = s
+	}
+	return s
+}
+
+// memorySubject holds the messages of a subject in a slice that grows up to size messages.
+type memorySubject struct {
+	size int
+	// ready holds a value while messages may be available, so that one waiting subscriber pops them.
+	ready chan struct{}
+
+	mu   sync.Mutex
+	msgs []*memoryMessage
+}
+
+// push adds the message or returns false if the subject is full.
+func (s *memorySubject) push(m *memoryMessage) bool {
+	s.mu.Lock()
+	if len(s.msgs) >= s.size {
+		s.mu.Unlock()
+		return false
+	}
+	s.msgs = append(s.msgs, m)
+	s.mu.Unlock()
+	s.notify()
+	return true
+}
+
+// pop removes and returns up to n messages.
+func (s *memorySubject) pop(n int) []ingest.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n > len(s.msgs) {
+		n = len(s.msgs)
+	}
+	ms := make([]ingest.Message, n)
+	for i := range ms {
+		ms[i] = s.msgs[i]
+		// Release the popped messages, since the slice keeps its backing array.
+		s.msgs[i] = nil
+	}
+	s.msgs = s.msgs[n:]
+	if len(s.msgs) == 0 {
+		s.msgs = nil
+	} else {
+		// Let other subscribers pop the remaining messages.
+		s.notify()
+	}
+	return ms
+}
+
+func (s *memorySubject) notify() {
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+type memorySubscription struct {
+	s                *memorySubject
+	popsTotalCounter *prometheus.CounterVec
+}
+
+func (s *memorySubscription) Close() error {
+	return nil
+}
+
+// Pop blocks until at least one message is available or the context is done
+// and returns up to batch messages.
+func (s *memorySubscription) Pop(ctx context.Context, batch int) ([]ingest.Message, error) {
+	if batch < 1 {
+		batch = 1
+	}
+	for {
+		if ms := s.s.pop(batch); len(ms) > 0 {
+			s.popsTotalCounter.WithLabelValues("success").Inc()
+			return ms, nil
+		}
+		select {
+		case <-ctx.Done():
+			s.popsTotalCounter.WithLabelValues("error").Inc()
+			return nil, ctx.Err()
+		case <-s.s.ready:
+		}
+	}
+}
+
+// memoryMessage is a message of an in-memory queue.
+type memoryMessage struct {
+	data   []byte
+	header ingest.Header
+}
+
+func (m *memoryMessage) Data() []byte {
+	return m.data
+}
+
+func (m *memoryMessage) Header() ingest.Header {
+	return m.header
+}
+
+// Ack is a no-op, because messages are removed from the queue when they are popped.
+func (m *memoryMessage) Ack(_ context.Context) error {
+	return nil
+}
@@ -0,0 +1,85 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/connylabs/ingest"
+)
+
+func TestMemory(t *testing.T) {
+	q, err := Open("mem://?size=2", Options{}, prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	sub, err := q.PullSubscribe("ingest.foo", "con")
+	require.NoError(t, err)
+	require.NoError(t, q.Publish("ingest.foo", []byte("a"), nil))
+	require.NoError(t, q.Publish("ingest.foo", []byte("b"), ingest.Header{ingest.HeaderID: "b"}))
+	assert.ErrorIs(t, q.Publish("ingest.foo", []byte("c"), nil), ErrFull)
+	require.NoError(t, q.Publish("ingest.bar", []byte("d"), nil))
+
+	ms, err := sub.Pop(context.Background(), 3)
+	require.NoError(t, err)
+	require.Len(t, ms, 2)
+	assert.Equal(t, "a", string(ms[0].Data()))
+	assert.Equal(t, "b", string(ms[1].Data()))
+	assert.Equal(t, ingest.Header{ingest.HeaderID: "b"}, ms[1].Header())
+	require.NoError(t, ms[0].Ack(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = sub.Pop(ctx, 1)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	_, err = Open("mem://?size=0", Options{}, prometheus.NewRegistry())
+	assert.Error(t, err)
+}
+
+func TestMemoryGrows(t *testing.T) {
+	// The memory of a large size is not allocated up front.
+	q, err := Open("mem://", Options{MaxMsgs: math.MaxInt32}, prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	const n = 100
+	for i := 0; i < n; i++ {
+		require.NoError(t, q.Publish("ingest.foo", []byte(fmt.Sprint(i)), nil))
+	}
+	// Competing subscribers pop every message once.
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	seen := make(map[string]int)
+	for i := 0; i < 4; i++ {
+		sub, err := q.PullSubscribe("ingest.foo", "con")
+		require.NoError(t, err)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			for {
+				ms, err := sub.Pop(ctx, 7)
+				if err != nil {
+					return
+				}
+				mu.Lock()
+				for _, m := range ms {
+					seen[string(m.Data())]++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	require.Len(t, seen, n)
+	for d, c := range seen {
+		assert.Equal(t, 1, c, d)
+	}
+}
@@ -0,0 +1,115 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/connylabs/ingest"
+)
+
+func TestNATSAuthOptions(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		auth NATSAuth
+		n    int
+		err  bool
+	}{
+		{name: "none"},
+		{name: "credentials", auth: NATSAuth{CredentialsFile: "user.creds"}, n: 1},
+		{name: "user", auth: NATSAuth{User: "foo", Password: "bar"}, n: 1},
+		{name: "token", auth: NATSAuth{Token: "foo"}, n: 1},
+		{name: "password without user", auth: NATSAuth{Password: "bar"}, err: true},
+		{name: "missing seed", auth: NATSAuth{NKeySeedFile: "missing.nk"}, err: true},
+		{name: "conflict", auth: NATSAuth{User: "foo", Token: "bar"}, err: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts, err := tc.auth.Options()
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, opts, tc.n)
+		})
+	}
+}
+
+func TestPublishBuffer(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	e, err := StartEmbedded("nats://127.0.0.1:0", dir, NATSAuth{}, nil)
+	require.NoError(t, err)
+	url := e.ClientURL()
+	reg := prometheus.NewRegistry()
+	q, err := New(url, Options{Stream: "ingest", Replicas: 1, Subjects: []string{"ingest.*"}, Retention: "limits", PublishRetries: 2, PublishBufferSize: 1}, reg)
+	require.NoError(t, err)
+	qc := q.(*queue)
+	t.Cleanup(func() { q.Close(ctx) }) //nolint:errcheck
+
+	// While the server is down, one message is buffered and the next one is rejected.
+	e.Shutdown()
+	require.Eventually(t, qc.conn.IsReconnecting, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, q.Publish("ingest.foo", []byte("a"), ingest.Header{ingest.HeaderID: "a"}))
+	assert.ErrorIs(t, q.Publish("ingest.foo", []byte("b"), ingest.Header{ingest.HeaderID: "b"}), ErrPublishBufferFull)
+	assert.Equal(t, 1.0, testutil.ToFloat64(qc.pendingPublishes))
+
+	// The buffered message is published once the connection is reestablished.
+	e, err = StartEmbedded(url, dir, NATSAuth{}, nil)
+	require.NoError(t, err)
+	t.Cleanup(e.Shutdown)
+	require.Eventually(t, func() bool { return testutil.ToFloat64(qc.pendingPublishes) == 0 }, 10*time.Second, 10*time.Millisecond)
+	sub, err := q.PullSubscribe("ingest.foo", "con")
+	require.NoError(t, err)
+	ms, err := sub.Pop(ctx, 2)
+	require.NoError(t, err)
+	require.Len(t, ms, 1)
+	assert.Equal(t, "a", string(ms[0].Data()))
+
+	c, err := testutil.GatherAndCount(reg, "ingest_queue_connection_events_total")
+	require.NoError(t, err)
+	assert.Equal(t, 3, c)
+	assert.Equal(t, 0.0, testutil.ToFloat64(qc.droppedPublishesTotal))
+}
+
+func TestPublishDeduplication(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	e, err := StartEmbedded("nats://127.0.0.1:0", t.TempDir(), NATSAuth{}, nil)
+	require.NoError(t, err)
+	t.Cleanup(e.Shutdown)
+	q, err := New(e.ClientURL(), Options{Stream: "ingest", Replicas: 1, Subjects: []string{"ingest.*"}, Retention: "limits", DedupWindow: time.Minute}, prometheus.NewRegistry())
+	require.NoError(t, err)
+	t.Cleanup(func() { q.Close(ctx) }) //nolint:errcheck
+
+	// The same element is published twice by the first workflow and once by the second one.
+	require.NoError(t, q.Publish("ingest.foo", []byte("a"), ingest.Header{ingest.HeaderID: "a"}))
+	require.NoError(t, q.Publish("ingest.foo", []byte("a"), ingest.Header{ingest.HeaderID: "a"}))
+	require.NoError(t, q.Publish("ingest.bar", []byte("a"), ingest.Header{ingest.HeaderID: "a"}))
+
+	for _, subject := range []string{"ingest.foo", "ingest.bar"} {
+		sub, err := q.PullSubscribe(subject, "con-"+subject[len("ingest."):])
+		require.NoError(t, err)
+		ms, err := sub.Pop(ctx, 2)
+		require.NoError(t, err)
+		require.Len(t, ms, 1, subject)
+		assert.Equal(t, "a", string(ms[0].Data()))
+		assert.Equal(t, "a", ms[0].Header()[ingest.HeaderID])
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	qc := &queue{publishRetryWait: 100 * time.Millisecond}
+	for i, max := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond} {
+		d := qc.backoff(i)
+		assert.GreaterOrEqual(t, d, max/2)
+		assert.LessOrEqual(t, d, max)
+	}
+	assert.LessOrEqual(t, qc.backoff(100), maxPublishRetryWait)
+}
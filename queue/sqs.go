@@ -0,0 +1,377 @@
+package queue
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/connylabs/ingest"
+)
+
+const (
+	// sqsMaxQueueNameLength is the maximum length of the names of SQS queues.
+	sqsMaxQueueNameLength = 80
+	// sqsQueueNameHashLength is the length of the hash that replaces the tail of names that are too long.
+	sqsQueueNameHashLength = 16
+	// sqsMaxMessages is the maximum number of messages that SQS returns for a single receive.
+	sqsMaxMessages = 10
+	// sqsMaxWaitTimeSeconds is the maximum duration of long polling.
+	sqsMaxWaitTimeSeconds = 20
+	// sqsMaxVisibilityTimeoutSeconds is the maximum visibility timeout of messages, i.e. 12 hours.
+	sqsMaxVisibilityTimeoutSeconds = 43200
+)
+
+// sqsBodyEncodingAttribute is the message attribute that marks base64 encoded message bodies.
+const sqsBodyEncodingAttribute = "Ingest-Body-Encoding"
+
+// sqsInvalidChars matches the characters that are not allowed in the names of SQS queues.
+var sqsInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+func init() {
+	Register("sqs", func(u *url.URL, _ Options, reg prometheus.Registerer) (ingest.Queue, error) {
+		return NewSQS(u, reg)
+	})
+}
+
+// sqsAPI is the subset of the SQS API that the queue uses.
+type sqsAPI interface {
+	GetQueueUrlWithContext(aws.Context, *sqs.GetQueueUrlInput, ...request.Option) (*sqs.GetQueueUrlOutput, error)
+	CreateQueueWithContext(aws.Context, *sqs.CreateQueueInput, ...request.Option) (*sqs.CreateQueueOutput, error)
+	SendMessageWithContext(aws.Context, *sqs.SendMessageInput, ...request.Option) (*sqs.SendMessageOutput, error)
+	ReceiveMessageWithContext(aws.Context, *sqs.ReceiveMessageInput, ...request.Option) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessageWithContext(aws.Context, *sqs.DeleteMessageInput, ...request.Option) (*sqs.DeleteMessageOutput, error)
+	ChangeMessageVisibilityWithContext(aws.Context, *sqs.ChangeMessageVisibilityInput, ...request.Option) (*sqs.ChangeMessageVisibilityOutput, error)
+}
+
+type sqsQueue struct {
+	api                         sqsAPI
+	prefix                      string
+	visibilityTimeout           int64
+	waitTimeSeconds             int64
+	queueOperationsTotalCounter *prometheus.CounterVec
+
+	mu   sync.Mutex
+	urls map[string]string
+}
+
+// NewSQS creates a Queue that is backed by Amazon SQS.
+// The URL has the form sqs://<region>/<prefix>, where the region is optional.
+// Every subject is mapped to its own SQS queue, which is named after the prefix and the subject,
+// e.g. the subject ingest.foo with the prefix prod maps to the queue prod-ingest-foo.
+// Missing SQS queues are created.
+// The following query parameters are supported:
+// - endpoint: overrides the endpoint of SQS, e.g. for LocalStack;
+// - visibilityTimeout: the number of seconds for which popped messages are hidden from other subscribers
+// before they are delivered again, unless they are acknowledged, which defaults to the value of the SQS queue; and
+// - waitTimeSeconds: the maximum duration of long polling, which defaults to 20.
+// Credentials are read from the default credential chain.
+func NewSQS(u *url.URL, reg prometheus.Registerer) (ingest.Queue, error) {
+	q := u.Query()
+	c := aws.NewConfig()
+	if u.Host != "" {
+		c = c.WithRegion(u.Host)
+	}
+	if e := q.Get("endpoint"); e != "" {
+		c = c.WithEndpoint(e)
+	}
+	var visibilityTimeout, waitTimeSeconds int64 = 0, sqsMaxWaitTimeSeconds
+	var err error
+	if v := q.Get("visibilityTimeout"); v != "" {
+		if visibilityTimeout, err = strconv.ParseInt(v, 10, 64); err != nil || visibilityTimeout < 0 {
+			return nil, fmt.Errorf("invalid visibility timeout %q", v)
+		}
+	}
+	if v := q.Get("waitTimeSeconds"); v != "" {
+		if waitTimeSeconds, err = strconv.ParseInt(v, 10, 64); err != nil || waitTimeSeconds < 0 || waitTimeSeconds > sqsMaxWaitTimeSeconds {
+			return nil, fmt.Errorf("invalid wait time %q: must be between 0 and %d", v, sqsMaxWaitTimeSeconds)
+		}
+	}
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            *c,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AWS session: %w", err)
+	}
+
+	return newSQSQueue(sqs.New(sess), strings.Trim(u.Path, "/"), visibilityTimeout, waitTimeSeconds, reg), nil
+}
+
+func newSQSQueue(api sqsAPI, prefix string, visibilityTimeout, waitTimeSeconds int64, reg prometheus.Registerer) *sqsQueue {
+	return &sqsQueue{
+		api:                         api,
+		prefix:                      prefix,
+		visibilityTimeout:           visibilityTimeout,
+		waitTimeSeconds:             waitTimeSeconds,
+		queueOperationsTotalCounter: newOperationsCounter(reg),
+		urls:                        make(map[string]string),
+	}
+}
+
+// Close is a no-op, because SQS does not hold connections.
+func (q *sqsQueue) Close(_ context.Context) error {
+	return nil
+}
+
+// Publish sends the message to the SQS queue of the subject.
+// SQS only accepts some Unicode characters in message bodies,
+// so other data, e.g. encrypted messages, is sent base64 encoded.
+// The header is sent as string message attributes.
+func (q *sqsQueue) Publish(subject string, data []byte, header ingest.Header) error {
+	err := q.publish(context.Background(), subject, data, header)
+	if err != nil {
+		q.queueOperationsTotalCounter.WithLabelValues("publish", "error").Inc()
+		return err
+	}
+	q.queueOperationsTotalCounter.WithLabelValues("publish", "success").Inc()
+	return nil
+}
+
+func (q *sqsQueue) publish(ctx context.Context, subject string, data []byte, header ingest.Header) error {
+	u, err := q.queueURL(ctx, subject)
+	if err != nil {
+		return err
+	}
+	in := &sqs.SendMessageInput{
+		QueueUrl:    aws.String(u),
+		MessageBody: aws.String(string(data)),
+	}
+	if len(header) > 0 {
+		in.MessageAttributes = make(map[string]*sqs.MessageAttributeValue, len(header)+1)
+		for k, v := range header {
+			in.MessageAttributes[k] = &sqs.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(v)}
+		}
+	}
+	if !sqsValidBody(data) {
+		if in.MessageAttributes == nil {
+			in.MessageAttributes = make(map[string]*sqs.MessageAttributeValue, 1)
+		}
+		in.MessageBody = aws.String(base64.StdEncoding.EncodeToString(data))
+		in.MessageAttributes[sqsBodyEncodingAttribute] = &sqs.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String("base64")}
+	}
+	if _, err := q.api.SendMessageWithContext(ctx, in); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	return nil
+}
+
+// sqsValidBody reports whether SQS accepts the data as a message body.
+// See https://docs.aws.amazon.com/AWSSimpleQueueService/latest/APIReference/API_SendMessage.html.
+func sqsValidBody(data []byte) bool {
+	if !utf8.Valid(data) {
+		return false
+	}
+	for _, r := range string(data) {
+		switch {
+		case r == 0x9, r == 0xa, r == 0xd:
+		case r >= 0x20 && r <= 0xd7ff:
+		case r >= 0xe000 && r <= 0xfffd:
+		case r >= 0x10000 && r <= 0x10ffff:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// PullSubscribe creates a Subscription for the SQS queue of the subject.
+// SQS queues do not have consumers, so all subscribers of a subject
+// compete for its messages regardless of the durable name.
+func (q *sqsQueue) PullSubscribe(subject string, _ string) (ingest.Subscription, error) {
+	u, err := q.queueURL(context.Background(), subject)
+	if err != nil {
+		return nil, err
+	}
+	return &sqsSubscription{q: q, url: u, popsTotalCounter: q.queueOperationsTotalCounter.MustCurryWith(prometheus.Labels{"operation": "pop"})}, nil
+}
+
+// queueURL returns the URL of the SQS queue of the subject and creates the queue if it does not exist.
+func (q *sqsQueue) queueURL(ctx context.Context, subject string) (string, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if u, ok := q.urls[subject]; ok {
+		return u, nil
+	}
+
+	name := sqsQueueName(q.prefix, subject)
+	var u string
+	out, err := q.api.GetQueueUrlWithContext(ctx, &sqs.GetQueueUrlInput{QueueName: aws.String(name)})
+	var aerr awserr.Error
+	switch {
+	case err == nil:
+		u = aws.StringValue(out.QueueUrl)
+	case errors.As(err, &aerr) && aerr.Code() == sqs.ErrCodeQueueDoesNotExist:
+		in := &sqs.CreateQueueInput{QueueName: aws.String(name)}
+		if q.visibilityTimeout > 0 {
+			in.Attributes = map[string]*string{sqs.QueueAttributeNameVisibilityTimeout: aws.String(strconv.FormatInt(q.visibilityTimeout, 10))}
+		}
+		out, err := q.api.CreateQueueWithContext(ctx, in)
+		if err != nil {
+			return "", fmt.Errorf("failed to create SQS queue %q: %w", name, err)
+		}
+		u = aws.StringValue(out.QueueUrl)
+	default:
+		return "", fmt.Errorf("failed to get URL of SQS queue %q: %w", name, err)
+	}
+	q.urls[subject] = u
+	return u, nil
+}
+
+// sqsQueueName returns the name of the SQS queue for the subject.
+// If the name is too long, then its tail is replaced with a hash of the full name,
+// so that subjects that share a long prefix do not share a queue.
+func sqsQueueName(prefix, subject string) string {
+	full := subject
+	if prefix != "" {
+		full = prefix + "-" + subject
+	}
+	name := sqsInvalidChars.ReplaceAllString(full, "-")
+	if len(name) > sqsMaxQueueNameLength {
+		sum := sha256.Sum256([]byte(full))
+		name = name[:sqsMaxQueueNameLength-sqsQueueNameHashLength-1] + "-" + hex.EncodeToString(sum[:])[:sqsQueueNameHashLength]
+	}
+	return name
+}
+
+type sqsSubscription struct {
+	q                *sqsQueue
+	url              string
+	popsTotalCounter *prometheus.CounterVec
+}
+
+// Close is a no-op. Messages that were popped but not acknowledged
+// are delivered again once their visibility timeout expires.
+func (s *sqsSubscription) Close() error {
+	return nil
+}
+
+// Pop receives up to batch messages and blocks until at least one message is available
+// or the context is done.
+// The messages are hidden from other subscribers for the visibility timeout.
+func (s *sqsSubscription) Pop(ctx context.Context, batch int) ([]ingest.Message, error) {
+	if batch > sqsMaxMessages {
+		batch = sqsMaxMessages
+	}
+	in := &sqs.ReceiveMessageInput{
+		QueueUrl:              aws.String(s.url),
+		MaxNumberOfMessages:   aws.Int64(int64(batch)),
+		WaitTimeSeconds:       aws.Int64(s.q.waitTimeSeconds),
+		MessageAttributeNames: []*string{aws.String(sqs.QueueAttributeNameAll)},
+		AttributeNames:        []*string{aws.String(sqs.MessageSystemAttributeNameApproximateReceiveCount)},
+	}
+	if s.q.visibilityTimeout > 0 {
+		in.VisibilityTimeout = aws.Int64(s.q.visibilityTimeout)
+	}
+	for {
+		out, err := s.q.api.ReceiveMessageWithContext(ctx, in)
+		if err != nil {
+			s.popsTotalCounter.WithLabelValues("error").Inc()
+			return nil, fmt.Errorf("failed to receive messages: %w", err)
+		}
+		if len(out.Messages) == 0 {
+			if err := ctx.Err(); err != nil {
+				s.popsTotalCounter.WithLabelValues("error").Inc()
+				return nil, err
+			}
+			continue
+		}
+		s.popsTotalCounter.WithLabelValues("success").Inc()
+		ms := make([]ingest.Message, len(out.Messages))
+		for i, m := range out.Messages {
+			ms[i] = &sqsMessage{s: s, m: m}
+		}
+		return ms, nil
+	}
+}
+
+var _ ingest.Naker = &sqsMessage{}
+
+type sqsMessage struct {
+	s *sqsSubscription
+	m *sqs.Message
+}
+
+// Data returns the body of the message and decodes base64 encoded bodies.
+// Bodies that cannot be decoded are returned as is, so that they fail like other invalid messages.
+func (m *sqsMessage) Data() []byte {
+	body := aws.StringValue(m.m.Body)
+	if v, ok := m.m.MessageAttributes[sqsBodyEncodingAttribute]; ok && aws.StringValue(v.StringValue) == "base64" {
+		if data, err := base64.StdEncoding.DecodeString(body); err == nil {
+			return data
+		}
+	}
+	return []byte(body)
+}
+
+// Header returns the string message attributes of the message
+// except for the attribute that marks the encoding of the body.
+func (m *sqsMessage) Header() ingest.Header {
+	h := make(ingest.Header, len(m.m.MessageAttributes))
+	for k, v := range m.m.MessageAttributes {
+		if v.StringValue != nil && k != sqsBodyEncodingAttribute {
+			h[k] = *v.StringValue
+		}
+	}
+	if len(h) == 0 {
+		return nil
+	}
+	return h
+}
+
+// Ack deletes the message from the SQS queue.
+func (m *sqsMessage) Ack(ctx context.Context) error {
+	if _, err := m.s.q.api.DeleteMessageWithContext(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(m.s.url),
+		ReceiptHandle: m.m.ReceiptHandle,
+	}); err != nil {
+		return fmt.Errorf("failed to delete message: %w", err)
+	}
+	return nil
+}
+
+// Nak changes the visibility timeout of the message to the given delay,
+// after which it is delivered again.
+// The delay is clamped to the visibility timeouts that SQS accepts.
+func (m *sqsMessage) Nak(ctx context.Context, delay time.Duration) error {
+	seconds := int64(delay.Seconds())
+	if seconds < 0 {
+		seconds = 0
+	}
+	if seconds > sqsMaxVisibilityTimeoutSeconds {
+		seconds = sqsMaxVisibilityTimeoutSeconds
+	}
+	if _, err := m.s.q.api.ChangeMessageVisibilityWithContext(ctx, &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String(m.s.url),
+		ReceiptHandle:     m.m.ReceiptHandle,
+		VisibilityTimeout: aws.Int64(seconds),
+	}); err != nil {
+		return fmt.Errorf("failed to change the visibility of message: %w", err)
+	}
+	return nil
+}
+
+// Deliveries returns the approximate number of times that SQS delivered the message.
+func (m *sqsMessage) Deliveries() int {
+	n, err := strconv.Atoi(aws.StringValue(m.m.Attributes[sqs.MessageSystemAttributeNameApproximateReceiveCount]))
+	if err != nil {
+		return 0
+	}
+	return n
+}
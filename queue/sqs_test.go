@@ -0,0 +1,216 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/connylabs/ingest"
+)
+
+// fakeSQS keeps the visible messages of every queue in memory.
+type fakeSQS struct {
+	mu       sync.Mutex
+	queues   map[string][]*sqs.Message
+	inflight map[string]*sqs.Message
+	n        int
+	// visibility are the visibility timeouts of all changes of the visibility of messages.
+	visibility []int64
+}
+
+func (f *fakeSQS) GetQueueUrlWithContext(_ aws.Context, in *sqs.GetQueueUrlInput, _ ...request.Option) (*sqs.GetQueueUrlOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.queues[*in.QueueName]; !ok {
+		return nil, awserr.New(sqs.ErrCodeQueueDoesNotExist, "queue does not exist", nil)
+	}
+	return &sqs.GetQueueUrlOutput{QueueUrl: in.QueueName}, nil
+}
+
+func (f *fakeSQS) CreateQueueWithContext(_ aws.Context, in *sqs.CreateQueueInput, _ ...request.Option) (*sqs.CreateQueueOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queues[*in.QueueName] = nil
+	return &sqs.CreateQueueOutput{QueueUrl: in.QueueName}, nil
+}
+
+// SendMessageWithContext rejects bodies with characters that SQS does not allow, like SQS.
+func (f *fakeSQS) SendMessageWithContext(_ aws.Context, in *sqs.SendMessageInput, _ ...request.Option) (*sqs.SendMessageOutput, error) {
+	if !sqsValidBody([]byte(aws.StringValue(in.MessageBody))) {
+		return nil, awserr.New(sqs.ErrCodeInvalidMessageContents, "invalid characters in message body", nil)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.n++
+	f.queues[*in.QueueUrl] = append(f.queues[*in.QueueUrl], &sqs.Message{Body: in.MessageBody, MessageAttributes: in.MessageAttributes, ReceiptHandle: aws.String(strconv.Itoa(f.n))})
+	return &sqs.SendMessageOutput{}, nil
+}
+
+func (f *fakeSQS) ReceiveMessageWithContext(ctx aws.Context, in *sqs.ReceiveMessageInput, _ ...request.Option) (*sqs.ReceiveMessageOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ms := f.queues[*in.QueueUrl]
+	if len(ms) == 0 {
+		<-ctx.Done()
+		return &sqs.ReceiveMessageOutput{}, nil
+	}
+	n := int(*in.MaxNumberOfMessages)
+	if n > len(ms) {
+		n = len(ms)
+	}
+	f.queues[*in.QueueUrl] = ms[n:]
+	for _, m := range ms[:n] {
+		f.inflight[*m.ReceiptHandle] = m
+		count, _ := strconv.Atoi(aws.StringValue(m.Attributes[sqs.MessageSystemAttributeNameApproximateReceiveCount]))
+		m.Attributes = map[string]*string{sqs.MessageSystemAttributeNameApproximateReceiveCount: aws.String(strconv.Itoa(count + 1))}
+	}
+	return &sqs.ReceiveMessageOutput{Messages: ms[:n]}, nil
+}
+
+func (f *fakeSQS) DeleteMessageWithContext(_ aws.Context, in *sqs.DeleteMessageInput, _ ...request.Option) (*sqs.DeleteMessageOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.inflight, *in.ReceiptHandle)
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+// ChangeMessageVisibilityWithContext makes the message visible again immediately, regardless of the timeout.
+func (f *fakeSQS) ChangeMessageVisibilityWithContext(_ aws.Context, in *sqs.ChangeMessageVisibilityInput, _ ...request.Option) (*sqs.ChangeMessageVisibilityOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.visibility = append(f.visibility, aws.Int64Value(in.VisibilityTimeout))
+	if m, ok := f.inflight[*in.ReceiptHandle]; ok {
+		delete(f.inflight, *in.ReceiptHandle)
+		f.queues[*in.QueueUrl] = append(f.queues[*in.QueueUrl], m)
+	}
+	return &sqs.ChangeMessageVisibilityOutput{}, nil
+}
+
+func TestSQS(t *testing.T) {
+	f := &fakeSQS{queues: make(map[string][]*sqs.Message), inflight: make(map[string]*sqs.Message)}
+	q := newSQSQueue(f, "prod", 30, 1, prometheus.NewRegistry())
+
+	for _, d := range []string{"a", "b", "c"} {
+		require.NoError(t, q.Publish("ingest.foo", []byte(d), ingest.Header{ingest.HeaderID: d}))
+	}
+	require.NoError(t, q.Publish("ingest.bar", []byte("d"), nil))
+	assert.Len(t, f.queues["prod-ingest-foo"], 3)
+	assert.Len(t, f.queues["prod-ingest-bar"], 1)
+
+	sub, err := q.PullSubscribe("ingest.foo", "con")
+	require.NoError(t, err)
+	ms, err := sub.Pop(context.Background(), 2)
+	require.NoError(t, err)
+	require.Len(t, ms, 2)
+	assert.Equal(t, "a", string(ms[0].Data()))
+	assert.Equal(t, "b", string(ms[1].Data()))
+	assert.Equal(t, ingest.Header{ingest.HeaderID: "b"}, ms[1].Header())
+	assert.Len(t, f.inflight, 2)
+	require.NoError(t, ms[0].Ack(context.Background()))
+	assert.Len(t, f.inflight, 1)
+
+	ms, err = sub.Pop(context.Background(), 2)
+	require.NoError(t, err)
+	require.Len(t, ms, 1)
+	assert.Equal(t, "c", string(ms[0].Data()))
+	assert.Equal(t, 1, ingest.Deliveries(ms[0]))
+
+	// Negatively acknowledged messages are delivered again.
+	require.NoError(t, ingest.Nak(context.Background(), ms[0], time.Second))
+	ms, err = sub.Pop(context.Background(), 2)
+	require.NoError(t, err)
+	require.Len(t, ms, 1)
+	assert.Equal(t, "c", string(ms[0].Data()))
+	assert.Equal(t, 2, ingest.Deliveries(ms[0]))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = sub.Pop(ctx, 2)
+	assert.ErrorIs(t, err, context.Canceled)
+	require.NoError(t, sub.Close())
+}
+
+func TestSQSNak(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		delay      time.Duration
+		visibility int64
+	}{
+		{
+			name:       "delay",
+			delay:      time.Minute,
+			visibility: 60,
+		},
+		{
+			name:       "negative delay",
+			delay:      -time.Second,
+			visibility: 0,
+		},
+		{
+			name:       "delay above the limit",
+			delay:      24 * time.Hour,
+			visibility: sqsMaxVisibilityTimeoutSeconds,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := &fakeSQS{queues: make(map[string][]*sqs.Message), inflight: make(map[string]*sqs.Message)}
+			q := newSQSQueue(f, "prod", 30, 1, prometheus.NewRegistry())
+			require.NoError(t, q.Publish("ingest.foo", []byte("a"), nil))
+			sub, err := q.PullSubscribe("ingest.foo", "con")
+			require.NoError(t, err)
+			ms, err := sub.Pop(context.Background(), 1)
+			require.NoError(t, err)
+			require.Len(t, ms, 1)
+
+			require.NoError(t, ingest.Nak(context.Background(), ms[0], tc.delay))
+			assert.Equal(t, []int64{tc.visibility}, f.visibility)
+			require.NoError(t, sub.Close())
+		})
+	}
+}
+
+func TestSQSEncrypted(t *testing.T) {
+	f := &fakeSQS{queues: make(map[string][]*sqs.Message), inflight: make(map[string]*sqs.Message)}
+	k, err := NewKeyring(bytes.Repeat([]byte{1}, 32))
+	require.NoError(t, err)
+	q := NewEncrypted(newSQSQueue(f, "prod", 30, 1, prometheus.NewRegistry()), k)
+
+	// Encrypted messages are binary, so they are sent base64 encoded.
+	require.NoError(t, q.Publish("ingest.foo", []byte("a"), ingest.Header{ingest.HeaderID: "a"}))
+	require.NoError(t, q.Publish("ingest.foo", []byte("b"), nil))
+	sub, err := q.PullSubscribe("ingest.foo", "con")
+	require.NoError(t, err)
+	ms, err := sub.Pop(context.Background(), 2)
+	require.NoError(t, err)
+	require.Len(t, ms, 2)
+	assert.Equal(t, "a", string(ms[0].Data()))
+	assert.Equal(t, "a", ms[0].Header()[ingest.HeaderID])
+	assert.NotContains(t, ms[0].Header(), sqsBodyEncodingAttribute)
+	assert.Equal(t, "b", string(ms[1].Data()))
+}
+
+func TestSQSQueueName(t *testing.T) {
+	assert.Equal(t, "ingest-foo", sqsQueueName("", "ingest.foo"))
+	assert.Equal(t, "p-ingest-f-o-o", sqsQueueName("p", "ingest.f o*o"))
+
+	// Long names that only differ after the maximum length do not collide.
+	long := "ingest." + strings.Repeat("a", 100)
+	a, b := sqsQueueName("p", long+"-a"), sqsQueueName("p", long+"-b")
+	assert.Len(t, a, sqsMaxQueueNameLength)
+	assert.Len(t, b, sqsMaxQueueNameLength)
+	assert.NotEqual(t, a, b)
+	assert.Equal(t, a, sqsQueueName("p", long+"-a"))
+	assert.Regexp(t, `^p-ingest-a+-[0-9a-f]{16}$`, a)
+}
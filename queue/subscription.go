@@ -3,6 +3,7 @@ package queue
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/nats-io/nats.go"
 	"github.com/prometheus/client_golang/prometheus"
@@ -29,22 +30,66 @@ func (s *subscription) Close() error {
 	return s.sub.Drain()
 }
 
-func (s *subscription) Pop(ctx context.Context, batch int) ([]*nats.Msg, error) {
+func (s *subscription) Pop(ctx context.Context, batch int) ([]ingest.Message, error) {
 	msgs, err := s.sub.Fetch(batch, nats.Context(ctx))
-	for ; errors.Is(err, context.DeadlineExceeded); msgs, err = s.sub.Fetch(batch, nats.Context(ctx)) {
-		select {
-		case <-ctx.Done():
-			// If the given context is done, then break.
-			break
-		default:
-			// If the given context is not done, then NATS's internal timeout
-			// was exceeded, so let's try again.
-		}
+	for errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		// If the given context is not done, then NATS's internal timeout
+		// was exceeded, so let's try again.
+		msgs, err = s.sub.Fetch(batch, nats.Context(ctx))
 	}
 	if err != nil {
 		s.popsTotalCounter.WithLabelValues("error").Inc()
 		return nil, err
 	}
 	s.popsTotalCounter.WithLabelValues("success").Inc()
-	return msgs, nil
+	ms := make([]ingest.Message, len(msgs))
+	for i := range msgs {
+		ms[i] = &message{msgs[i]}
+	}
+	return ms, nil
+}
+
+var _ ingest.Naker = &message{}
+
+// message adapts a JetStream message to the ingest.Message interface.
+type message struct {
+	m *nats.Msg
+}
+
+func (m *message) Data() []byte {
+	return m.m.Data
+}
+
+func (m *message) Header() ingest.Header {
+	if len(m.m.Header) == 0 {
+		return nil
+	}
+	h := make(ingest.Header, len(m.m.Header))
+	for k := range m.m.Header {
+		h[k] = m.m.Header.Get(k)
+	}
+	return h
+}
+
+func (m *message) Ack(ctx context.Context) error {
+	// Without a deadline, the context could block forever,
+	// so the default timeout of the NATS client is used instead.
+	if _, ok := ctx.Deadline(); !ok {
+		return m.m.AckSync()
+	}
+	return m.m.AckSync(nats.Context(ctx))
+}
+
+// Nak makes JetStream deliver the message again after the given delay.
+func (m *message) Nak(_ context.Context, delay time.Duration) error {
+	return m.m.NakWithDelay(delay)
+}
+
+// Deliveries returns the number of deliveries from the metadata of the message.
+func (m *message) Deliveries() int {
+	md, err := m.m.Metadata()
+	if err != nil {
+		return 0
+	}
+	return int(md.NumDelivered)
 }
@@ -0,0 +1,134 @@
+package secret
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/aws/aws-sdk-go/private/protocol/jsonrpc"
+)
+
+const (
+	// AWSPrefix marks string values in the configuration of plugins that reference a secret in AWS Secrets Manager,
+	// e.g. awssm://ingest#accessKey references the field accessKey of the JSON object in the secret ingest.
+	// The secret can also be named by its ARN.
+	AWSPrefix = "awssm://"
+
+	awsEndpointsID = "secretsmanager"
+)
+
+// AWSSecretsManager reads secrets from AWS Secrets Manager.
+// Credentials are read from the default credential chain.
+type AWSSecretsManager struct {
+	c *aws.Config
+
+	mu      sync.Mutex
+	clients map[string]*client.Client
+}
+
+// NewAWSSecretsManager creates an AWSSecretsManager provider.
+// The configuration is optional and overrides the configuration of the default session, e.g. the region or endpoint.
+func NewAWSSecretsManager(c *aws.Config) *AWSSecretsManager {
+	if c == nil {
+		c = aws.NewConfig()
+	}
+	return &AWSSecretsManager{c: c, clients: make(map[string]*client.Client)}
+}
+
+// client returns the client for the region, which is created on first use,
+// so that no AWS session is needed unless secrets are read from AWS Secrets Manager.
+// An empty region selects the region of the default session.
+func (sm *AWSSecretsManager) client(region string) (*client.Client, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if c, ok := sm.clients[region]; ok {
+		return c, nil
+	}
+	c := sm.c.Copy()
+	if region != "" {
+		c = c.WithRegion(region)
+	}
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            *c,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AWS session: %w", err)
+	}
+	cc := sess.ClientConfig(awsEndpointsID)
+	if cc.SigningNameDerived || len(cc.SigningName) == 0 {
+		cc.SigningName = awsEndpointsID
+	}
+	// The AWS SDK is only vendored with some services, so the client for
+	// the JSON protocol of Secrets Manager is assembled like the generated clients.
+	sc := client.New(*cc.Config, metadata.ClientInfo{
+		ServiceName:    "Secrets Manager",
+		ServiceID:      "Secrets Manager",
+		SigningName:    cc.SigningName,
+		SigningRegion:  cc.SigningRegion,
+		PartitionID:    cc.PartitionID,
+		Endpoint:       cc.Endpoint,
+		APIVersion:     "2017-10-17",
+		ResolvedRegion: cc.ResolvedRegion,
+		JSONVersion:    "1.1",
+		TargetPrefix:   "secretsmanager",
+	}, cc.Handlers)
+	sc.Handlers.Sign.PushBackNamed(v4.SignRequestHandler)
+	sc.Handlers.Build.PushBackNamed(jsonrpc.BuildHandler)
+	sc.Handlers.Unmarshal.PushBackNamed(jsonrpc.UnmarshalHandler)
+	sc.Handlers.UnmarshalMeta.PushBackNamed(jsonrpc.UnmarshalMetaHandler)
+	sc.Handlers.UnmarshalError.PushBackNamed(jsonrpc.UnmarshalErrorHandler)
+	sm.clients[region] = sc
+	return sc, nil
+}
+
+type getSecretValueInput struct {
+	_        struct{} `type:"structure"`
+	SecretID *string  `locationName:"SecretId" type:"string" required:"true"`
+}
+
+type getSecretValueOutput struct {
+	_            struct{} `type:"structure"`
+	SecretBinary []byte   `type:"blob" sensitive:"true"`
+	SecretString *string  `type:"string" sensitive:"true"`
+}
+
+// Get returns the secret that the reference names, e.g. ingest, or the field of the JSON object in the secret, e.g. ingest#accessKey.
+// Secrets that are named by their ARN are read from the region of the ARN.
+func (sm *AWSSecretsManager) Get(ctx context.Context, ref string) (any, error) {
+	id, field, _ := strings.Cut(ref, "#")
+	if id == "" {
+		return nil, fmt.Errorf("invalid AWS Secrets Manager reference %q: must have the form %ssecret[#field]", ref, AWSPrefix)
+	}
+	var region string
+	if a, err := arn.Parse(id); err == nil {
+		region = a.Region
+	}
+	c, err := sm.client(region)
+	if err != nil {
+		return nil, err
+	}
+	out := new(getSecretValueOutput)
+	req := c.NewRequest(&request.Operation{
+		Name:       "GetSecretValue",
+		HTTPMethod: "POST",
+		HTTPPath:   "/",
+	}, &getSecretValueInput{SecretID: aws.String(id)}, out)
+	req.SetContext(ctx)
+	if err := req.Send(); err != nil {
+		return nil, fmt.Errorf("failed to read secret %q: %w", id, err)
+	}
+	s := string(out.SecretBinary)
+	if out.SecretString != nil {
+		s = *out.SecretString
+	}
+	return jsonField(id, s, field)
+}
@@ -0,0 +1,60 @@
+package secret
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAWSSecretsManager(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" || r.Header.Get("Authorization") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var in struct{ SecretId string }
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		switch in.SecretId {
+		case "ingest", "arn:aws:secretsmanager:eu-central-1:123456789012:secret:ingest-AbCdEf":
+			io.WriteString(w, `{"Name":"ingest","SecretString":"{\"accessKey\":\"foo\"}"}`)
+		case "binary":
+			io.WriteString(w, `{"Name":"binary","SecretBinary":"YmFy"}`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"__type":"ResourceNotFoundException","message":"Secrets Manager can't find the specified secret."}`)
+		}
+	}))
+	t.Cleanup(s.Close)
+	ctx := context.Background()
+	sm := NewAWSSecretsManager(aws.NewConfig().
+		WithEndpoint(s.URL).
+		WithRegion("us-east-1").
+		WithCredentials(credentials.NewStaticCredentials("id", "secret", "")))
+
+	for ref, value := range map[string]any{
+		"ingest":           `{"accessKey":"foo"}`,
+		"ingest#accessKey": "foo",
+		"arn:aws:secretsmanager:eu-central-1:123456789012:secret:ingest-AbCdEf#accessKey": "foo",
+		"binary": "bar",
+	} {
+		got, err := sm.Get(ctx, ref)
+		require.NoError(t, err, ref)
+		assert.Equal(t, value, got, ref)
+	}
+	for _, ref := range []string{"", "missing", "ingest#missing", "binary#foo"} {
+		_, err := sm.Get(ctx, ref)
+		assert.Error(t, err, ref)
+	}
+}
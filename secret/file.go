@@ -0,0 +1,33 @@
+package secret
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	// FilePrefix marks string values in the configuration of plugins that reference a file that holds a secret,
+	// e.g. file:///run/secrets/access-key, which is how Kubernetes and Docker mount secrets.
+	FilePrefix = "file://"
+	// FileSuffix marks keys in the configuration of plugins whose values are the paths of files that hold secrets,
+	// e.g. accessKey_file: /run/secrets/access-key sets accessKey to the content of the file.
+	FileSuffix = "_file"
+)
+
+// File reads secrets from files.
+type File struct{}
+
+// Get returns the content of the file at the path without a trailing line break,
+// which most editors and `echo` append.
+func (File) Get(_ context.Context, path string) (any, error) {
+	if path == "" {
+		return nil, fmt.Errorf("invalid file reference: must have the form %spath", FilePrefix)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret file: %w", err)
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(string(b), "\n"), "\r"), nil
+}
@@ -0,0 +1,49 @@
+package secret
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFile(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "key"), []byte("foo\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "token"), []byte("bar\r\n"), 0o600))
+	ctx := context.Background()
+
+	v, err := File{}.Get(ctx, filepath.Join(dir, "key"))
+	require.NoError(t, err)
+	assert.Equal(t, "foo", v)
+	_, err = File{}.Get(ctx, filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+
+	r := Resolver{FilePrefix: File{}}
+	resolved, err := r.Resolve(ctx, map[string]any{
+		"accessKey_file": filepath.Join(dir, "key"),
+		"nested": map[string]any{
+			"token": FilePrefix + filepath.Join(dir, "token"),
+		},
+		"_file": "foo",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{
+		"accessKey": "foo",
+		"nested": map[string]any{
+			"token": "bar",
+		},
+		"_file": "foo",
+	}, resolved)
+
+	_, err = r.Resolve(ctx, map[string]any{"accessKey": "foo", "accessKey_file": filepath.Join(dir, "key")})
+	assert.Error(t, err)
+
+	// Without a file provider, keys with the suffix are passed on.
+	resolved, err = Resolver{}.Resolve(ctx, map[string]any{"accessKey_file": "foo"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"accessKey_file": "foo"}, resolved)
+}
@@ -0,0 +1,106 @@
+package secret
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"google.golang.org/api/option"
+	"google.golang.org/api/option/internaloption"
+	htransport "google.golang.org/api/transport/http"
+)
+
+const (
+	// GCPPrefix marks string values in the configuration of plugins that reference a secret in GCP Secret Manager,
+	// e.g. gcpsm://my-project/ingest#accessKey references the field accessKey of the JSON object in
+	// the latest version of the secret ingest in the project my-project.
+	// A version can be given after the name of the secret, e.g. gcpsm://my-project/ingest/3.
+	GCPPrefix = "gcpsm://"
+
+	gcpEndpoint = "https://secretmanager.googleapis.com/"
+	gcpScope    = "https://www.googleapis.com/auth/cloud-platform"
+)
+
+// GCPSecretManager reads secrets from GCP Secret Manager.
+// Credentials are read from the application default credentials.
+type GCPSecretManager struct {
+	opts []option.ClientOption
+
+	mu       sync.Mutex
+	c        *http.Client
+	endpoint string
+}
+
+// NewGCPSecretManager creates a GCPSecretManager provider.
+// The options are optional and override the defaults of the client, e.g. the credentials or endpoint.
+func NewGCPSecretManager(opts ...option.ClientOption) *GCPSecretManager {
+	return &GCPSecretManager{opts: opts}
+}
+
+// client returns the HTTP client, which is created on first use,
+// so that no credentials are needed unless secrets are read from GCP Secret Manager.
+func (sm *GCPSecretManager) client() (*http.Client, string, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if sm.c != nil {
+		return sm.c, sm.endpoint, nil
+	}
+	// The context must outlive the request, because the client keeps refreshing its token with it.
+	c, endpoint, err := htransport.NewClient(context.Background(), append([]option.ClientOption{
+		option.WithScopes(gcpScope),
+		internaloption.WithDefaultEndpoint(gcpEndpoint),
+	}, sm.opts...)...)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create GCP client: %w", err)
+	}
+	sm.c, sm.endpoint = c, strings.TrimSuffix(endpoint, "/")
+	return sm.c, sm.endpoint, nil
+}
+
+// Get returns the secret that the reference names, e.g. my-project/ingest, or the field of the JSON object in the secret, e.g. my-project/ingest#accessKey.
+func (sm *GCPSecretManager) Get(ctx context.Context, ref string) (any, error) {
+	name, field, _ := strings.Cut(ref, "#")
+	parts := strings.Split(name, "/")
+	if len(parts) == 2 {
+		parts = append(parts, "latest")
+	}
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return nil, fmt.Errorf("invalid GCP Secret Manager reference %q: must have the form %sproject/secret[/version][#field]", ref, GCPPrefix)
+	}
+	c, endpoint, err := sm.client()
+	if err != nil {
+		return nil, err
+	}
+	u := fmt.Sprintf("%s/v1/projects/%s/secrets/%s/versions/%s:access", endpoint, url.PathEscape(parts[0]), url.PathEscape(parts[1]), url.PathEscape(parts[2]))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret %q: %w", name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to read secret %q: unexpected status %s", name, resp.Status)
+	}
+
+	var body struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode secret %q: %w", name, err)
+	}
+	data, err := base64.StdEncoding.DecodeString(body.Payload.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode secret %q: %w", name, err)
+	}
+	return jsonField(name, string(data), field)
+}
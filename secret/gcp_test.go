@@ -0,0 +1,42 @@
+package secret
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+)
+
+func TestGCPSecretManager(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/projects/foo/secrets/ingest/versions/latest:access", "/v1/projects/foo/secrets/ingest/versions/2:access":
+			// {"accessKey":"foo"}
+			io.WriteString(w, `{"name":"projects/foo/secrets/ingest/versions/2","payload":{"data":"eyJhY2Nlc3NLZXkiOiJmb28ifQ=="}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(s.Close)
+	ctx := context.Background()
+	sm := NewGCPSecretManager(option.WithHTTPClient(s.Client()), option.WithEndpoint(s.URL+"/"))
+
+	for ref, value := range map[string]any{
+		"foo/ingest":             `{"accessKey":"foo"}`,
+		"foo/ingest#accessKey":   "foo",
+		"foo/ingest/2#accessKey": "foo",
+	} {
+		got, err := sm.Get(ctx, ref)
+		require.NoError(t, err, ref)
+		assert.Equal(t, value, got, ref)
+	}
+	for _, ref := range []string{"", "foo", "foo/ingest/2/3", "foo/missing", "foo/ingest#missing"} {
+		_, err := sm.Get(ctx, ref)
+		assert.Error(t, err, ref)
+	}
+}
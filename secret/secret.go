@@ -0,0 +1,111 @@
+package secret
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Provider reads secrets from a secret store.
+type Provider interface {
+	// Get returns the value of the secret that the reference names.
+	// The reference does not include the prefix of the provider.
+	Get(ctx context.Context, ref string) (any, error)
+}
+
+// Resolver replaces references to secrets in the configuration of plugins with the values of the secrets.
+// It maps the prefixes of references, e.g. vault:, to the providers that read them.
+type Resolver map[string]Provider
+
+// NewResolver returns a Resolver for references to secrets in files, Vault, AWS Secrets Manager and GCP Secret Manager.
+// The providers are configured from the environment and only connect to their secret stores once a reference is resolved.
+func NewResolver() Resolver {
+	return Resolver{
+		FilePrefix:  File{},
+		VaultPrefix: NewVaultFromEnv(),
+		AWSPrefix:   NewAWSSecretsManager(nil),
+		GCPPrefix:   NewGCPSecretManager(),
+	}
+}
+
+// Resolve returns a copy of the configuration in which all references to secrets
+// in strings, nested maps and lists are replaced with the values of the secrets.
+// If the Resolver reads files, then keys with the suffix _file are replaced with
+// the keys without the suffix and the content of the files that their values name.
+// Every reference is resolved only once.
+func (r Resolver) Resolve(ctx context.Context, config map[string]any) (map[string]any, error) {
+	if config == nil {
+		return nil, nil
+	}
+	v, err := r.resolve(ctx, config, make(map[string]any))
+	if err != nil {
+		return nil, err
+	}
+	return v.(map[string]any), nil
+}
+
+func (r Resolver) resolve(ctx context.Context, v any, values map[string]any) (any, error) {
+	switch t := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(t))
+		for k := range t {
+			v := t[k]
+			if path, ok := v.(string); ok && len(k) > len(FileSuffix) && strings.HasSuffix(k, FileSuffix) && r[FilePrefix] != nil {
+				if _, ok := t[strings.TrimSuffix(k, FileSuffix)]; ok {
+					return nil, fmt.Errorf("%s: cannot be combined with %s", k, strings.TrimSuffix(k, FileSuffix))
+				}
+				k, v = strings.TrimSuffix(k, FileSuffix), FilePrefix+path
+			}
+			var err error
+			if m[k], err = r.resolve(ctx, v, values); err != nil {
+				return nil, fmt.Errorf("%s: %w", k, err)
+			}
+		}
+		return m, nil
+	case []any:
+		l := make([]any, len(t))
+		for i := range t {
+			var err error
+			if l[i], err = r.resolve(ctx, t[i], values); err != nil {
+				return nil, fmt.Errorf("%d: %w", i, err)
+			}
+		}
+		return l, nil
+	case string:
+		for prefix, p := range r {
+			if !strings.HasPrefix(t, prefix) {
+				continue
+			}
+			if value, ok := values[t]; ok {
+				return value, nil
+			}
+			value, err := p.Get(ctx, strings.TrimPrefix(t, prefix))
+			if err != nil {
+				return nil, err
+			}
+			values[t] = value
+			return value, nil
+		}
+		return t, nil
+	default:
+		return v, nil
+	}
+}
+
+// jsonField returns the value of the field of a secret that holds a JSON object.
+// If the field is empty, then the secret is returned as is.
+func jsonField(name, secret, field string) (any, error) {
+	if field == "" {
+		return secret, nil
+	}
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(secret), &fields); err != nil {
+		return nil, fmt.Errorf("secret %q does not hold a JSON object: %w", name, err)
+	}
+	v, ok := fields[field]
+	if !ok {
+		return nil, fmt.Errorf("secret %q has no field %q", name, field)
+	}
+	return v, nil
+}
@@ -0,0 +1,71 @@
+package secret
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type providerFunc func(context.Context, string) (any, error)
+
+func (f providerFunc) Get(ctx context.Context, ref string) (any, error) {
+	return f(ctx, ref)
+}
+
+func TestResolver(t *testing.T) {
+	var refs []string
+	r := Resolver{
+		"foo:": providerFunc(func(_ context.Context, ref string) (any, error) {
+			refs = append(refs, ref)
+			if ref == "missing" {
+				return nil, errors.New("not found")
+			}
+			return "secret-" + ref, nil
+		}),
+	}
+	ctx := context.Background()
+
+	config := map[string]any{
+		"bucket": "foo",
+		"key":    "foo:key",
+		"nested": map[string]any{
+			"key":    "foo:key",
+			"tokens": []any{"foo:token", 1},
+		},
+	}
+	resolved, err := r.Resolve(ctx, config)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{
+		"bucket": "foo",
+		"key":    "secret-key",
+		"nested": map[string]any{
+			"key":    "secret-key",
+			"tokens": []any{"secret-token", 1},
+		},
+	}, resolved)
+	assert.Equal(t, "foo:key", config["key"], "the configuration must not be modified")
+	assert.ElementsMatch(t, []string{"key", "token"}, refs, "every reference must be resolved once")
+
+	resolved, err = r.Resolve(ctx, nil)
+	require.NoError(t, err)
+	assert.Nil(t, resolved)
+
+	_, err = r.Resolve(ctx, map[string]any{"nested": []any{"foo:missing"}})
+	assert.EqualError(t, err, "nested: 0: not found")
+}
+
+func TestJSONField(t *testing.T) {
+	v, err := jsonField("foo", "bar", "")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", v)
+	v, err = jsonField("foo", `{"bar":"baz"}`, "bar")
+	require.NoError(t, err)
+	assert.Equal(t, "baz", v)
+	_, err = jsonField("foo", `{"bar":"baz"}`, "qux")
+	assert.Error(t, err)
+	_, err = jsonField("foo", "bar", "bar")
+	assert.Error(t, err)
+}
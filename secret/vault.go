@@ -0,0 +1,100 @@
+package secret
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// VaultPrefix marks string values in the configuration of plugins that reference a secret in Vault,
+	// e.g. vault:secret/data/ingest#accessKey references the field accessKey of the secret at secret/data/ingest.
+	VaultPrefix = "vault:"
+
+	requestTimeout = 30 * time.Second
+)
+
+// Vault reads secrets from the HTTP API of a HashiCorp Vault server.
+type Vault struct {
+	addr  string
+	token string
+	c     *http.Client
+}
+
+// NewVault creates a Vault provider for the Vault server at addr that authenticates with the token.
+func NewVault(addr, token string) *Vault {
+	return &Vault{
+		addr:  strings.TrimSuffix(addr, "/"),
+		token: token,
+		c:     &http.Client{Timeout: requestTimeout},
+	}
+}
+
+// NewVaultFromEnv creates a Vault provider from the VAULT_ADDR and VAULT_TOKEN environment variables
+// like the Vault CLI does. If VAULT_ADDR is not set, then reading any secret fails.
+func NewVaultFromEnv() *Vault {
+	return NewVault(os.Getenv("VAULT_ADDR"), os.Getenv("VAULT_TOKEN"))
+}
+
+// Get returns the field of the secret that the reference names, e.g. secret/data/ingest#accessKey.
+func (v *Vault) Get(ctx context.Context, ref string) (any, error) {
+	path, field, ok := strings.Cut(ref, "#")
+	if !ok || path == "" || field == "" {
+		return nil, fmt.Errorf("invalid Vault reference %q: must have the form %spath#field", ref, VaultPrefix)
+	}
+	s, err := v.Read(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	f, ok := s[field]
+	if !ok {
+		return nil, fmt.Errorf("secret %q has no field %q", path, field)
+	}
+	return f, nil
+}
+
+// Read returns the fields of the secret at the path.
+// The fields of secrets in KV version 2 engines are unwrapped from their metadata.
+func (v *Vault) Read(ctx context.Context, path string) (map[string]any, error) {
+	if v.addr == "" {
+		return nil, fmt.Errorf("cannot read secret %q: no Vault address configured", path)
+	}
+	u, err := url.Parse(v.addr + "/v1/" + strings.TrimPrefix(path, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Vault address: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+	resp, err := v.c.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret %q: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to read secret %q: unexpected status %s", path, resp.Status)
+	}
+
+	var body struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode secret %q: %w", path, err)
+	}
+	if body.Data == nil {
+		return nil, fmt.Errorf("secret %q has no data", path)
+	}
+	if data, ok := body.Data["data"].(map[string]any); ok {
+		if _, ok := body.Data["metadata"]; ok {
+			return data, nil
+		}
+	}
+	return body.Data, nil
+}
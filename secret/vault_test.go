@@ -0,0 +1,54 @@
+package secret
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVault(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/ingest":
+			w.Write([]byte(`{"data":{"data":{"accessKey":"foo","secretKey":"bar"},"metadata":{"version":1}}}`))
+		case "/v1/kv/ingest":
+			w.Write([]byte(`{"data":{"token":"baz"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(s.Close)
+	ctx := context.Background()
+	v := NewVault(s.URL+"/", "token")
+
+	for ref, value := range map[string]any{
+		"secret/data/ingest#accessKey": "foo",
+		"secret/data/ingest#secretKey": "bar",
+		"kv/ingest#token":              "baz",
+	} {
+		got, err := v.Get(ctx, ref)
+		require.NoError(t, err, ref)
+		assert.Equal(t, value, got, ref)
+	}
+
+	for _, ref := range []string{
+		"secret/data/ingest",
+		"secret/data/ingest#missing",
+		"secret/data/missing#accessKey",
+	} {
+		_, err := v.Get(ctx, ref)
+		assert.Error(t, err, ref)
+	}
+	_, err := NewVault(s.URL, "wrong").Get(ctx, "kv/ingest#token")
+	assert.Error(t, err)
+	_, err = NewVault("", "").Get(ctx, "kv/ingest#token")
+	assert.Error(t, err)
+}
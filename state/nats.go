@@ -0,0 +1,68 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+)
+
+type natsStore struct {
+	conn *nats.Conn
+	kv   nats.KeyValue
+}
+
+// New connects to NATS and returns a Store that persists values in the given JetStream KV bucket.
+// The bucket is created if it does not exist yet.
+// Only the latest value of every key is kept.
+func New(url, bucket string, replicas int, opts ...nats.Option) (Store, error) {
+	conn, err := nats.Connect(url, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	kv, err := js.KeyValue(bucket)
+	if errors.Is(err, nats.ErrBucketNotFound) {
+		kv, err = js.CreateKeyValue(&nats.KeyValueConfig{
+			Bucket:      bucket,
+			Description: "State of ingest workflows",
+			Replicas:    replicas,
+		})
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to open key-value bucket %q: %w", bucket, err)
+	}
+
+	return &natsStore{conn: conn, kv: kv}, nil
+}
+
+// Get returns the latest value of the key.
+func (s *natsStore) Get(_ context.Context, key string) ([]byte, error) {
+	e, err := s.kv.Get(key)
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return e.Value(), nil
+}
+
+// Put stores the value as the new revision of the key.
+func (s *natsStore) Put(_ context.Context, key string, value []byte) error {
+	_, err := s.kv.Put(key, value)
+	return err
+}
+
+// Close closes the connection to NATS.
+func (s *natsStore) Close(ctx context.Context) error {
+	defer s.conn.Close()
+	return s.conn.FlushWithContext(ctx)
+}
@@ -0,0 +1,64 @@
+package state
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNotFound is returned if no value is stored under a key.
+var ErrNotFound = errors.New("key not found")
+
+// Store is able to persist small values, e.g. the checkpoints of sources, across restarts.
+type Store interface {
+	// Get returns the value of the key or ErrNotFound.
+	Get(context.Context, string) ([]byte, error)
+	Put(context.Context, string, []byte) error
+	Close(context.Context) error
+}
+
+// Checkpoints is able to persist the checkpoint of the source of a single workflow.
+type Checkpoints interface {
+	// Load returns the checkpoint or nil if none was saved yet.
+	Load(context.Context) ([]byte, error)
+	Save(context.Context, []byte) error
+}
+
+type workflowCheckpoints struct {
+	s   Store
+	key string
+}
+
+func (w *workflowCheckpoints) Load(ctx context.Context) ([]byte, error) {
+	v, err := w.s.Get(ctx, w.key)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	return v, err
+}
+
+func (w *workflowCheckpoints) Save(ctx context.Context, v []byte) error {
+	return w.s.Put(ctx, w.key, v)
+}
+
+// NewCheckpoints returns Checkpoints that persist the checkpoint of the given workflow in the Store.
+func NewCheckpoints(s Store, workflow string) Checkpoints {
+	if s == nil {
+		return NewNopCheckpoints()
+	}
+	return &workflowCheckpoints{s: s, key: workflow + ".checkpoint"}
+}
+
+type nopCheckpoints struct{}
+
+func (nopCheckpoints) Load(context.Context) ([]byte, error) {
+	return nil, nil
+}
+
+func (nopCheckpoints) Save(context.Context, []byte) error {
+	return nil
+}
+
+// NewNopCheckpoints returns Checkpoints that discard all checkpoints.
+func NewNopCheckpoints() Checkpoints {
+	return nopCheckpoints{}
+}
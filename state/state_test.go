@@ -0,0 +1,52 @@
+package state
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/connylabs/ingest/queue"
+)
+
+func TestCheckpoints(t *testing.T) {
+	e, err := queue.StartEmbedded("nats://127.0.0.1:0", t.TempDir(), queue.NATSAuth{}, nil)
+	require.NoError(t, err)
+	defer e.Shutdown()
+
+	s, err := New(e.ClientURL(), "ingest_state", 1)
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	defer s.Close(ctx) //nolint:errcheck
+
+	_, err = s.Get(ctx, "foo.checkpoint")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	foo, bar := NewCheckpoints(s, "foo"), NewCheckpoints(s, "bar")
+	c, err := foo.Load(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, c)
+	require.NoError(t, foo.Save(ctx, []byte("1")))
+	require.NoError(t, foo.Save(ctx, []byte("2")))
+	require.NoError(t, bar.Save(ctx, []byte("3")))
+	c, err = foo.Load(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "2", string(c))
+
+	// The bucket is reopened after a restart.
+	s2, err := New(e.ClientURL(), "ingest_state", 1)
+	require.NoError(t, err)
+	defer s2.Close(ctx) //nolint:errcheck
+	c, err = NewCheckpoints(s2, "bar").Load(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "3", string(c))
+
+	nop := NewCheckpoints(nil, "foo")
+	require.NoError(t, nop.Save(ctx, []byte("1")))
+	c, err = nop.Load(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, c)
+}
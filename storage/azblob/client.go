@@ -0,0 +1,474 @@
+package azblob
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// apiVersion is the version of the Blob service REST API that is used.
+const apiVersion = "2020-10-02"
+
+// Credential authorizes requests against the Blob service.
+type Credential interface {
+	Authorize(*http.Request) error
+}
+
+// Client is a minimal client for the Azure Blob service REST API.
+type Client struct {
+	// u is the URL of the Blob service of the storage account.
+	u *url.URL
+	c Credential
+	h *http.Client
+}
+
+// NewClient creates a new Client for the Blob service at the given URL.
+// If the given http.Client is nil, then http.DefaultClient is used.
+func NewClient(serviceURL string, c Credential, h *http.Client) (*Client, error) {
+	u, err := url.Parse(serviceURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse service URL: %w", err)
+	}
+	if c == nil {
+		c = anonymousCredential{}
+	}
+	if h == nil {
+		h = http.DefaultClient
+	}
+	return &Client{u: u, c: c, h: h}, nil
+}
+
+// NewClientFromConnectionString creates a new Client from an Azure Storage connection string.
+func NewClientFromConnectionString(cs string, h *http.Client) (*Client, error) {
+	values := make(map[string]string)
+	for _, kv := range strings.Split(cs, ";") {
+		if kv == "" {
+			continue
+		}
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid connection string segment %q", kv)
+		}
+		values[parts[0]] = parts[1]
+	}
+	endpoint := values["BlobEndpoint"]
+	if endpoint == "" {
+		if values["AccountName"] == "" {
+			return nil, errors.New("connection string must contain either BlobEndpoint or AccountName")
+		}
+		protocol := values["DefaultEndpointsProtocol"]
+		if protocol == "" {
+			protocol = "https"
+		}
+		suffix := values["EndpointSuffix"]
+		if suffix == "" {
+			suffix = "core.windows.net"
+		}
+		endpoint = fmt.Sprintf("%s://%s.blob.%s", protocol, values["AccountName"], suffix)
+	}
+	var c Credential
+	switch {
+	case values["SharedAccessSignature"] != "":
+		c = NewSASCredential(values["SharedAccessSignature"])
+	case values["AccountKey"] != "":
+		var err error
+		if c, err = NewSharedKeyCredential(values["AccountName"], values["AccountKey"]); err != nil {
+			return nil, err
+		}
+	}
+	return NewClient(endpoint, c, h)
+}
+
+// BlobProperties describes a blob.
+type BlobProperties struct {
+	ContentLength int64  `xml:"Content-Length"`
+	ContentType   string `xml:"Content-Type"`
+	ContentMD5    string `xml:"Content-MD5"`
+	LastModified  string `xml:"Last-Modified"`
+	ETag          string `xml:"Etag"`
+	AccessTier    string `xml:"AccessTier"`
+}
+
+// Blob is an item of a blob listing.
+type Blob struct {
+	Name       string         `xml:"Name"`
+	Properties BlobProperties `xml:"Properties"`
+}
+
+// ListBlobsResult is a single page of a blob listing.
+type ListBlobsResult struct {
+	Blobs      []Blob `xml:"Blobs>Blob"`
+	Prefixes   []Blob `xml:"Blobs>BlobPrefix"`
+	NextMarker string `xml:"NextMarker"`
+}
+
+// ListBlobs lists a single page of blobs in the container.
+// If delimiter is not empty, then blobs in "sub-directories" are returned as prefixes.
+func (c *Client) ListBlobs(ctx context.Context, container, prefix, delimiter, marker string) (*ListBlobsResult, error) {
+	q := url.Values{}
+	q.Set("restype", "container")
+	q.Set("comp", "list")
+	if prefix != "" {
+		q.Set("prefix", prefix)
+	}
+	if delimiter != "" {
+		q.Set("delimiter", delimiter)
+	}
+	if marker != "" {
+		q.Set("marker", marker)
+	}
+	res, err := c.do(ctx, http.MethodGet, container, "", q, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	r := new(ListBlobsResult)
+	if err := xml.NewDecoder(res.Body).Decode(r); err != nil {
+		return nil, fmt.Errorf("failed to decode blob listing: %w", err)
+	}
+	return r, nil
+}
+
+// GetBlob downloads the blob.
+// The caller must close the body of the returned response.
+func (c *Client) GetBlob(ctx context.Context, container, name string) (*http.Response, error) {
+	return c.do(ctx, http.MethodGet, container, name, nil, nil, nil)
+}
+
+// GetBlobProperties returns the properties of the blob.
+// If the blob does not exist, then an error satisfying os.IsNotExist is returned.
+func (c *Client) GetBlobProperties(ctx context.Context, container, name string) (*BlobProperties, error) {
+	res, err := c.do(ctx, http.MethodHead, container, name, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+	return &BlobProperties{
+		ContentLength: res.ContentLength,
+		ContentType:   res.Header.Get("Content-Type"),
+		ContentMD5:    res.Header.Get("Content-MD5"),
+		LastModified:  res.Header.Get("Last-Modified"),
+		ETag:          res.Header.Get("ETag"),
+		AccessTier:    res.Header.Get("x-ms-access-tier"),
+	}, nil
+}
+
+// DeleteBlob deletes the blob.
+// Deleting a blob that does not exist is not an error.
+func (c *Client) DeleteBlob(ctx context.Context, container, name string) error {
+	res, err := c.do(ctx, http.MethodDelete, container, name, nil, nil, nil)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// PutBlob uploads a block blob in a single request, replacing any existing blob.
+func (c *Client) PutBlob(ctx context.Context, container, name string, body []byte, contentType string) error {
+	h := make(http.Header)
+	h.Set("x-ms-blob-type", "BlockBlob")
+	if contentType != "" {
+		h.Set("Content-Type", contentType)
+	}
+	res, err := c.do(ctx, http.MethodPut, container, name, nil, h, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// PutBlock uploads a block that becomes part of the blob once it is committed with PutBlockList.
+// The ID is encoded by the client; all IDs of a blob must have the same length.
+func (c *Client) PutBlock(ctx context.Context, container, name, id string, body []byte) error {
+	q := url.Values{}
+	q.Set("comp", "block")
+	q.Set("blockid", base64.StdEncoding.EncodeToString([]byte(id)))
+	res, err := c.do(ctx, http.MethodPut, container, name, q, nil, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// PutBlockList commits the uploaded blocks with the given IDs, in order, as the content of the blob.
+func (c *Client) PutBlockList(ctx context.Context, container, name string, ids []string, contentType string) error {
+	bl := struct {
+		XMLName xml.Name `xml:"BlockList"`
+		Latest  []string `xml:"Latest"`
+	}{Latest: make([]string, len(ids))}
+	for i := range ids {
+		bl.Latest[i] = base64.StdEncoding.EncodeToString([]byte(ids[i]))
+	}
+	buf, err := xml.Marshal(bl)
+	if err != nil {
+		return err
+	}
+	q := url.Values{}
+	q.Set("comp", "blocklist")
+	h := make(http.Header)
+	h.Set("Content-Type", "application/xml")
+	if contentType != "" {
+		h.Set("x-ms-blob-content-type", contentType)
+	}
+	res, err := c.do(ctx, http.MethodPut, container, name, q, h, bytes.NewReader(append([]byte(xml.Header), buf...)))
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// URL returns the URL of the blob.
+func (c *Client) URL(container, name string) *url.URL {
+	u := *c.u
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + container
+	if name != "" {
+		u.Path += "/" + name
+	}
+	return &u
+}
+
+// Error is returned when the Blob service responds with an error.
+type Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("blob service responded with status code %d", e.StatusCode)
+	}
+	return fmt.Sprintf("blob service responded with status code %d: %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Is allows errors.Is(err, fs.ErrNotExist) to match missing blobs and containers.
+func (e *Error) Is(target error) bool {
+	return target == fs.ErrNotExist && e.StatusCode == http.StatusNotFound
+}
+
+func (c *Client) do(ctx context.Context, method, container, name string, q url.Values, h http.Header, body io.Reader) (*http.Response, error) {
+	u := c.URL(container, name)
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range h {
+		req.Header[k] = vs
+	}
+	req.Header.Set("x-ms-version", apiVersion)
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	if err := c.c.Authorize(req); err != nil {
+		return nil, fmt.Errorf("failed to authorize request: %w", err)
+	}
+	res, err := c.h.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode >= 300 {
+		defer res.Body.Close()
+		e := &Error{StatusCode: res.StatusCode}
+		if method != http.MethodHead {
+			xml.NewDecoder(res.Body).Decode(e) //nolint:errcheck
+		}
+		return nil, e
+	}
+	return res, nil
+}
+
+type anonymousCredential struct{}
+
+func (anonymousCredential) Authorize(*http.Request) error {
+	return nil
+}
+
+type sasCredential string
+
+// NewSASCredential returns a Credential that appends the given shared access signature to requests.
+func NewSASCredential(token string) Credential {
+	return sasCredential(strings.TrimPrefix(token, "?"))
+}
+
+func (s sasCredential) Authorize(req *http.Request) error {
+	sas, err := url.ParseQuery(string(s))
+	if err != nil {
+		return err
+	}
+	q := req.URL.Query()
+	for k, vs := range sas {
+		q[k] = vs
+	}
+	req.URL.RawQuery = q.Encode()
+	return nil
+}
+
+type sharedKeyCredential struct {
+	account string
+	key     []byte
+}
+
+// NewSharedKeyCredential returns a Credential that signs requests with the storage account key.
+func NewSharedKeyCredential(account, key string) (Credential, error) {
+	if account == "" {
+		return nil, errors.New("account name must not be empty")
+	}
+	k, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode account key: %w", err)
+	}
+	return &sharedKeyCredential{account: account, key: k}, nil
+}
+
+// Authorize signs the request as described in
+// https://learn.microsoft.com/en-us/rest/api/storageservices/authorize-with-shared-key.
+func (s *sharedKeyCredential) Authorize(req *http.Request) error {
+	cl := ""
+	if req.ContentLength > 0 {
+		cl = strconv.FormatInt(req.ContentLength, 10)
+	}
+	var xms []string
+	for k := range req.Header {
+		if k := strings.ToLower(k); strings.HasPrefix(k, "x-ms-") {
+			xms = append(xms, k)
+		}
+	}
+	sort.Strings(xms)
+	var b strings.Builder
+	for _, h := range []string{
+		req.Method,
+		req.Header.Get("Content-Encoding"),
+		req.Header.Get("Content-Language"),
+		cl,
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		"", // Date is empty since x-ms-date is set.
+		req.Header.Get("If-Modified-Since"),
+		req.Header.Get("If-Match"),
+		req.Header.Get("If-None-Match"),
+		req.Header.Get("If-Unmodified-Since"),
+		req.Header.Get("Range"),
+	} {
+		b.WriteString(h)
+		b.WriteByte('\n')
+	}
+	for _, k := range xms {
+		b.WriteString(k)
+		b.WriteByte(':')
+		b.WriteString(strings.TrimSpace(req.Header.Get(k)))
+		b.WriteByte('\n')
+	}
+	b.WriteByte('/')
+	b.WriteString(s.account)
+	b.WriteString(req.URL.EscapedPath())
+	q := req.URL.Query()
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		vs := q[k]
+		sort.Strings(vs)
+		b.WriteByte('\n')
+		b.WriteString(strings.ToLower(k))
+		b.WriteByte(':')
+		b.WriteString(strings.Join(vs, ","))
+	}
+
+	m := hmac.New(sha256.New, s.key)
+	m.Write([]byte(b.String()))
+	req.Header.Set("Authorization", fmt.Sprintf("SharedKey %s:%s", s.account, base64.StdEncoding.EncodeToString(m.Sum(nil))))
+	return nil
+}
+
+// imdsEndpoint is the token endpoint of the Azure Instance Metadata Service.
+const imdsEndpoint = "http://169.254.169.254/metadata/identity/oauth2/token"
+
+type managedIdentityCredential struct {
+	clientID string
+	h        *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// NewManagedIdentityCredential returns a Credential that authorizes requests with
+// a token of the managed identity of the Azure VM or container.
+// The clientID selects a user-assigned identity and may be empty.
+func NewManagedIdentityCredential(clientID string, h *http.Client) Credential {
+	if h == nil {
+		h = http.DefaultClient
+	}
+	return &managedIdentityCredential{clientID: clientID, h: h}
+}
+
+func (m *managedIdentityCredential) Authorize(req *http.Request) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.token == "" || time.Now().Add(5*time.Minute).After(m.expires) {
+		if err := m.refresh(req.Context()); err != nil {
+			return err
+		}
+	}
+	req.Header.Set("Authorization", "Bearer "+m.token)
+	return nil
+}
+
+func (m *managedIdentityCredential) refresh(ctx context.Context) error {
+	q := url.Values{}
+	q.Set("api-version", "2018-02-01")
+	q.Set("resource", "https://storage.azure.com/")
+	if m.clientID != "" {
+		q.Set("client_id", m.clientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, imdsEndpoint+"?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Metadata", "true")
+	res, err := m.h.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to request token: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("token request failed with status code %d", res.StatusCode)
+	}
+	var t struct {
+		AccessToken string `json:"access_token"`
+		ExpiresOn   string `json:"expires_on"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&t); err != nil {
+		return fmt.Errorf("failed to decode token: %w", err)
+	}
+	expires, err := strconv.ParseInt(t.ExpiresOn, 10, 64)
+	if err != nil {
+		return fmt.Errorf("failed to parse token expiry: %w", err)
+	}
+	m.token = t.AccessToken
+	m.expires = time.Unix(expires, 0)
+	return nil
+}
@@ -0,0 +1,89 @@
+package azblob
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const listing = `<?xml version="1.0" encoding="utf-8"?>
+<EnumerationResults ServiceEndpoint="http://127.0.0.1/" ContainerName="container">
+  <Prefix>prefix/</Prefix>
+  <Blobs>
+    <Blob>
+      <Name>prefix/foo</Name>
+      <Properties>
+        <Content-Length>3</Content-Length>
+        <Content-Type>text/plain</Content-Type>
+      </Properties>
+    </Blob>
+    <BlobPrefix>
+      <Name>prefix/bar/</Name>
+    </BlobPrefix>
+  </Blobs>
+  <NextMarker>marker</NextMarker>
+</EnumerationResults>`
+
+func TestClient(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, apiVersion, r.Header.Get("x-ms-version"))
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "SharedKey account:"))
+		switch {
+		case r.URL.Path == "/container" && r.URL.Query().Get("comp") == "list":
+			assert.Equal(t, "prefix/", r.URL.Query().Get("prefix"))
+			assert.Equal(t, "/", r.URL.Query().Get("delimiter"))
+			w.Write([]byte(listing)) //nolint:errcheck
+		case r.URL.Path == "/container/prefix/foo" && r.Method == http.MethodGet:
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("foo")) //nolint:errcheck
+		case r.URL.Path == "/container/prefix/foo" && r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`<?xml version="1.0" encoding="utf-8"?><Error><Code>BlobNotFound</Code><Message>The specified blob does not exist.</Message></Error>`)) //nolint:errcheck
+		}
+	}))
+	t.Cleanup(s.Close)
+
+	c, err := NewClientFromConnectionString("AccountName=account;AccountKey=a2V5;BlobEndpoint="+s.URL, nil)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	r, err := c.ListBlobs(ctx, "container", "prefix/", "/", "")
+	require.NoError(t, err)
+	require.Len(t, r.Blobs, 1)
+	assert.Equal(t, "prefix/foo", r.Blobs[0].Name)
+	assert.Equal(t, int64(3), r.Blobs[0].Properties.ContentLength)
+	require.Len(t, r.Prefixes, 1)
+	assert.Equal(t, "prefix/bar/", r.Prefixes[0].Name)
+	assert.Equal(t, "marker", r.NextMarker)
+
+	res, err := c.GetBlob(ctx, "container", "prefix/foo")
+	require.NoError(t, err)
+	buf, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(buf))
+
+	_, err = c.GetBlob(ctx, "container", "prefix/baz")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	assert.ErrorContains(t, err, "BlobNotFound")
+
+	assert.NoError(t, c.DeleteBlob(ctx, "container", "prefix/foo"))
+	assert.NoError(t, c.DeleteBlob(ctx, "container", "prefix/baz"))
+}
+
+func TestSASCredential(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "https://account.blob.core.windows.net/container?comp=list", nil)
+	require.NoError(t, NewSASCredential("?sv=2020-10-02&sig=abc").Authorize(req))
+	assert.Equal(t, "list", req.URL.Query().Get("comp"))
+	assert.Equal(t, "2020-10-02", req.URL.Query().Get("sv"))
+	assert.Equal(t, "abc", req.URL.Query().Get("sig"))
+}
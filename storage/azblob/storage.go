@@ -0,0 +1,91 @@
+package azblob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"path"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/storage"
+)
+
+// DefaultBlockSize is the size of the blocks in which large objects are uploaded.
+const DefaultBlockSize = 8 << 20
+
+type blobStorage struct {
+	c         *Client
+	container string
+	prefix    string
+	blockSize int64
+}
+
+// New returns a new Storage that can store objects in a container of the Azure Blob service.
+// Objects that are larger than the block size, or whose size is unknown,
+// are uploaded in blocks of the given size. If the block size is not positive,
+// then DefaultBlockSize is used.
+func New(container, prefix string, blockSize int64, c *Client) storage.Storage {
+	if blockSize <= 0 {
+		blockSize = DefaultBlockSize
+	}
+	return &blobStorage{
+		c:         c,
+		container: container,
+		prefix:    prefix,
+		blockSize: blockSize,
+	}
+}
+
+func (bs *blobStorage) Stat(ctx context.Context, element ingest.Codec) (*storage.ObjectInfo, error) {
+	name := path.Join(bs.prefix, element.Name)
+	if _, err := bs.c.GetBlobProperties(ctx, bs.container, name); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fs.ErrNotExist
+		}
+		return nil, fmt.Errorf("failed to get blob properties: %w", err)
+	}
+
+	return &storage.ObjectInfo{URI: bs.c.URL(bs.container, name).String()}, nil
+}
+
+func (bs *blobStorage) Store(ctx context.Context, element ingest.Codec, obj ingest.Object) (*url.URL, error) {
+	name := path.Join(bs.prefix, element.Name)
+	if obj.Len >= 0 && obj.Len <= bs.blockSize {
+		buf := make([]byte, obj.Len)
+		if _, err := io.ReadFull(obj.Reader, buf); err != nil {
+			return nil, fmt.Errorf("failed to read object: %w", err)
+		}
+		if err := bs.c.PutBlob(ctx, bs.container, name, buf, obj.MimeType); err != nil {
+			return nil, fmt.Errorf("failed to put blob: %w", err)
+		}
+		return bs.c.URL(bs.container, name), nil
+	}
+
+	var ids []string
+	buf := make([]byte, bs.blockSize)
+	for {
+		n, err := io.ReadFull(obj.Reader, buf)
+		if n > 0 {
+			// Block IDs must have the same length for all blocks of a blob.
+			id := fmt.Sprintf("%08d", len(ids))
+			if err := bs.c.PutBlock(ctx, bs.container, name, id, buf[:n]); err != nil {
+				return nil, fmt.Errorf("failed to put block: %w", err)
+			}
+			ids = append(ids, id)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read object: %w", err)
+		}
+	}
+	if err := bs.c.PutBlockList(ctx, bs.container, name, ids, obj.MimeType); err != nil {
+		return nil, fmt.Errorf("failed to put block list: %w", err)
+	}
+
+	return bs.c.URL(bs.container, name), nil
+}
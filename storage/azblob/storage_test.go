@@ -0,0 +1,108 @@
+package azblob
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/connylabs/ingest"
+)
+
+// fakeBlobService implements the subset of the Blob service that is used to store objects.
+type fakeBlobService struct {
+	mu     sync.Mutex
+	blobs  map[string]string
+	types  map[string]string
+	blocks map[string]string
+}
+
+func (f *fakeBlobService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	body, _ := io.ReadAll(r.Body)
+	q := r.URL.Query()
+	switch {
+	case r.Method == http.MethodHead:
+		if _, ok := f.blobs[r.URL.Path]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", f.types[r.URL.Path])
+	case r.Method == http.MethodPut && q.Get("comp") == "block":
+		id, err := base64.StdEncoding.DecodeString(q.Get("blockid"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.blocks[r.URL.Path+"#"+string(id)] = string(body)
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodPut && q.Get("comp") == "blocklist":
+		var content strings.Builder
+		for _, l := range strings.Split(string(body), "<Latest>")[1:] {
+			id, err := base64.StdEncoding.DecodeString(strings.SplitN(l, "<", 2)[0])
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			content.WriteString(f.blocks[r.URL.Path+"#"+string(id)])
+		}
+		f.blobs[r.URL.Path] = content.String()
+		f.types[r.URL.Path] = r.Header.Get("x-ms-blob-content-type")
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodPut:
+		if r.Header.Get("x-ms-blob-type") != "BlockBlob" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.blobs[r.URL.Path] = string(body)
+		f.types[r.URL.Path] = r.Header.Get("Content-Type")
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestStorage(t *testing.T) {
+	f := &fakeBlobService{blobs: make(map[string]string), types: make(map[string]string), blocks: make(map[string]string)}
+	s := httptest.NewServer(f)
+	t.Cleanup(s.Close)
+
+	c, err := NewClient(s.URL, nil, nil)
+	require.NoError(t, err)
+	bs := New("container", "prefix", 4, c)
+	ctx := context.Background()
+
+	small := ingest.NewCodec("small", "small.txt", nil)
+	_, err = bs.Stat(ctx, small)
+	assert.True(t, os.IsNotExist(err))
+
+	u, err := bs.Store(ctx, small, ingest.Object{Reader: strings.NewReader("foo"), Len: 3, MimeType: "text/plain"})
+	require.NoError(t, err)
+	assert.Equal(t, s.URL+"/container/prefix/small.txt", u.String())
+	assert.Equal(t, "foo", f.blobs["/container/prefix/small.txt"])
+	assert.Equal(t, "text/plain", f.types["/container/prefix/small.txt"])
+
+	oi, err := bs.Stat(ctx, small)
+	require.NoError(t, err)
+	assert.Equal(t, u.String(), oi.URI)
+
+	large := ingest.NewCodec("large", "large.txt", nil)
+	_, err = bs.Store(ctx, large, ingest.Object{Reader: strings.NewReader("foobarbaz"), Len: 9, MimeType: "text/plain"})
+	require.NoError(t, err)
+	assert.Equal(t, "foobarbaz", f.blobs["/container/prefix/large.txt"])
+	assert.Equal(t, "text/plain", f.types["/container/prefix/large.txt"])
+
+	unknown := ingest.NewCodec("unknown", "unknown.txt", nil)
+	_, err = bs.Store(ctx, unknown, ingest.Object{Reader: strings.NewReader("foo"), Len: -1})
+	require.NoError(t, err)
+	assert.Equal(t, "foo", f.blobs["/container/prefix/unknown.txt"])
+}
@@ -0,0 +1,97 @@
+package b2
+
+import (
+	"context"
+	"crypto/sha1" //nolint:gosec
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+
+	"github.com/kurin/blazer/b2"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/internal/spool"
+	"github.com/connylabs/ingest/storage"
+)
+
+// Options configure uploads.
+type Options struct {
+	// ChunkSize is the size in bytes of the parts of large files.
+	// Files larger than ChunkSize are uploaded with the large file API.
+	// It defaults to 100 MB.
+	ChunkSize int
+	// ConcurrentUploads is the number of parts that are uploaded concurrently.
+	ConcurrentUploads int
+}
+
+type b2Storage struct {
+	b      *b2.Bucket
+	prefix string
+	o      Options
+}
+
+// New returns a new Storage that can store objects in a B2 bucket using the native B2 API.
+// Objects are spooled to a temporary file first to compute their SHA1 checksum,
+// which B2 verifies for simple uploads and records as large_file_sha1 for large files.
+// Every part of a large file is verified with its own SHA1 checksum.
+func New(b *b2.Bucket, prefix string, o Options) storage.Storage {
+	return &b2Storage{b: b, prefix: prefix, o: o}
+}
+
+func (bs *b2Storage) Stat(ctx context.Context, element ingest.Codec) (*storage.ObjectInfo, error) {
+	o := bs.b.Object(bs.name(element))
+	attrs, err := o.Attrs(ctx)
+	if err != nil {
+		if b2.IsNotExist(err) {
+			return nil, fs.ErrNotExist
+		}
+		return nil, fmt.Errorf("failed to get attributes: %w", err)
+	}
+	// Unfinished large files and hidden files do not count as stored.
+	if attrs.Status != b2.Uploaded {
+		return nil, fs.ErrNotExist
+	}
+
+	return &storage.ObjectInfo{URI: bs.url(element).String()}, nil
+}
+
+func (bs *b2Storage) Store(ctx context.Context, element ingest.Codec, obj ingest.Object) (*url.URL, error) {
+	h := sha1.New() //nolint:gosec
+	f, _, err := spool.Temp(obj.Reader, "ingest-b2-*", h)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object: %w", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	w := bs.b.Object(bs.name(element)).NewWriter(ctx, b2.WithAttrsOption(&b2.Attrs{
+		ContentType: obj.MimeType,
+		SHA1:        sum,
+	}))
+	w.ChunkSize = bs.o.ChunkSize
+	w.ConcurrentUploads = bs.o.ConcurrentUploads
+	// Buffer parts in temporary files instead of memory.
+	w.UseFileBuffer = true
+	if _, err := io.Copy(w, f); err != nil {
+		w.Close()
+		return nil, fmt.Errorf("failed to upload file: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to upload file: %w", err)
+	}
+
+	return bs.url(element), nil
+}
+
+func (bs *b2Storage) name(element ingest.Codec) string {
+	return path.Join(bs.prefix, element.Name)
+}
+
+func (bs *b2Storage) url(element ingest.Codec) *url.URL {
+	return &url.URL{Scheme: "b2", Host: bs.b.Name(), Path: "/" + bs.name(element)}
+}
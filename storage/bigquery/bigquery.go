@@ -0,0 +1,238 @@
+package bigquery
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	bq "google.golang.org/api/bigquery/v2"
+	"google.golang.org/api/googleapi"
+	gcs "google.golang.org/api/storage/v1"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/storage"
+)
+
+// Source formats of load jobs.
+const (
+	FormatNDJSON = "NEWLINE_DELIMITED_JSON"
+	FormatCSV    = "CSV"
+)
+
+// Table identifies a BigQuery table.
+type Table struct {
+	Project string
+	Dataset string
+	Table   string
+	// Location is the location of the dataset, e.g. EU.
+	// It is required to look up jobs outside of the US and EU multi-regions.
+	Location string
+}
+
+// Options configure the load jobs.
+type Options struct {
+	// Format is the source format of the objects.
+	// If empty, it is inferred from the MIME type or the extension of every object.
+	Format string
+	// Autodetect lets BigQuery infer the schema of the data.
+	Autodetect bool
+	// SkipLeadingRows is the number of header rows of CSV objects.
+	SkipLeadingRows int64
+	// WriteDisposition defaults to WRITE_APPEND.
+	WriteDisposition string
+	// CreateDisposition defaults to CREATE_IF_NEEDED.
+	CreateDisposition string
+	// DeleteStaged deletes the staged object once it was loaded.
+	DeleteStaged bool
+	// PollInterval is the interval at which the status of load jobs is checked.
+	PollInterval time.Duration
+}
+
+type bqStorage struct {
+	gcs    *gcs.Service
+	bq     *bq.Service
+	bucket string
+	prefix string
+	table  Table
+	o      Options
+}
+
+// New returns a new Storage that stages objects in a GCS bucket
+// and loads them into a BigQuery table.
+// Store only returns once the load job finished.
+// Load jobs have a deterministic ID derived from the table and the name of the object,
+// so that Stat can tell whether an object was already loaded and
+// objects are not loaded twice when they are redelivered.
+func New(bucket, prefix string, table Table, o Options, gs *gcs.Service, bs *bq.Service) storage.Storage {
+	if o.PollInterval <= 0 {
+		o.PollInterval = 5 * time.Second
+	}
+	if o.WriteDisposition == "" {
+		o.WriteDisposition = "WRITE_APPEND"
+	}
+	if o.CreateDisposition == "" {
+		o.CreateDisposition = "CREATE_IF_NEEDED"
+	}
+	return &bqStorage{
+		gcs:    gs,
+		bq:     bs,
+		bucket: bucket,
+		prefix: prefix,
+		table:  table,
+		o:      o,
+	}
+}
+
+// Stat considers an object to exist if its load job finished successfully.
+func (bs *bqStorage) Stat(ctx context.Context, element ingest.Codec) (*storage.ObjectInfo, error) {
+	id := bs.jobID(element)
+	j, err := bs.getJob(ctx, id)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, fs.ErrNotExist
+		}
+		return nil, fmt.Errorf("failed to get load job: %w", err)
+	}
+	if j.Status == nil || j.Status.State != "DONE" || j.Status.ErrorResult != nil {
+		return nil, fs.ErrNotExist
+	}
+
+	return &storage.ObjectInfo{URI: bs.url(id).String()}, nil
+}
+
+func (bs *bqStorage) Store(ctx context.Context, element ingest.Codec, obj ingest.Object) (*url.URL, error) {
+	format, err := bs.format(element, obj)
+	if err != nil {
+		return nil, err
+	}
+	name := path.Join(bs.prefix, element.Name)
+	if _, err := bs.gcs.Objects.Insert(bs.bucket, &gcs.Object{Name: name, ContentType: obj.MimeType}).Media(obj.Reader).Context(ctx).Do(); err != nil {
+		return nil, fmt.Errorf("failed to stage object: %w", err)
+	}
+
+	id := bs.jobID(element)
+	j, err := bs.insertJob(ctx, id, fmt.Sprintf("gs://%s/%s", bs.bucket, name), format)
+	if isConflict(err) {
+		// The job was already inserted by a previous attempt.
+		if j, err = bs.getJob(ctx, id); err == nil && j.Status != nil && j.Status.State == "DONE" && j.Status.ErrorResult != nil {
+			// Job IDs cannot be reused, so a failed job must be retried under a new ID.
+			id = fmt.Sprintf("%s_%d", id, time.Now().UnixNano())
+			j, err = bs.insertJob(ctx, id, fmt.Sprintf("gs://%s/%s", bs.bucket, name), format)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert load job: %w", err)
+	}
+	if err := bs.wait(ctx, j); err != nil {
+		return nil, err
+	}
+
+	if bs.o.DeleteStaged {
+		if err := bs.gcs.Objects.Delete(bs.bucket, name).Context(ctx).Do(); err != nil && !isNotFound(err) {
+			return nil, fmt.Errorf("failed to delete staged object: %w", err)
+		}
+	}
+
+	return bs.url(id), nil
+}
+
+func (bs *bqStorage) insertJob(ctx context.Context, id, uri, format string) (*bq.Job, error) {
+	l := &bq.JobConfigurationLoad{
+		SourceUris:        []string{uri},
+		SourceFormat:      format,
+		Autodetect:        bs.o.Autodetect,
+		WriteDisposition:  bs.o.WriteDisposition,
+		CreateDisposition: bs.o.CreateDisposition,
+		DestinationTable: &bq.TableReference{
+			ProjectId: bs.table.Project,
+			DatasetId: bs.table.Dataset,
+			TableId:   bs.table.Table,
+		},
+	}
+	if format == FormatCSV {
+		l.SkipLeadingRows = bs.o.SkipLeadingRows
+	}
+	return bs.bq.Jobs.Insert(bs.table.Project, &bq.Job{
+		JobReference:  &bq.JobReference{ProjectId: bs.table.Project, JobId: id, Location: bs.table.Location},
+		Configuration: &bq.JobConfiguration{Load: l},
+	}).Context(ctx).Do()
+}
+
+func (bs *bqStorage) getJob(ctx context.Context, id string) (*bq.Job, error) {
+	call := bs.bq.Jobs.Get(bs.table.Project, id).Context(ctx)
+	if bs.table.Location != "" {
+		call = call.Location(bs.table.Location)
+	}
+	return call.Do()
+}
+
+// wait polls the job until it is done and returns the error of a failed job.
+func (bs *bqStorage) wait(ctx context.Context, j *bq.Job) error {
+	t := time.NewTicker(bs.o.PollInterval)
+	defer t.Stop()
+	for {
+		if j.Status != nil && j.Status.State == "DONE" {
+			if e := j.Status.ErrorResult; e != nil {
+				return fmt.Errorf("load job %s failed: %s: %s", j.JobReference.JobId, e.Reason, e.Message)
+			}
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+		var err error
+		if j, err = bs.getJob(ctx, j.JobReference.JobId); err != nil {
+			return fmt.Errorf("failed to get load job: %w", err)
+		}
+	}
+}
+
+// format returns the configured source format or infers it from the object.
+func (bs *bqStorage) format(element ingest.Codec, obj ingest.Object) (string, error) {
+	if bs.o.Format != "" {
+		return bs.o.Format, nil
+	}
+	switch {
+	case obj.MimeType == "text/csv", strings.HasSuffix(element.Name, ".csv"):
+		return FormatCSV, nil
+	case obj.MimeType == "application/x-ndjson", strings.HasSuffix(element.Name, ".ndjson"), strings.HasSuffix(element.Name, ".jsonl"):
+		return FormatNDJSON, nil
+	default:
+		return "", fmt.Errorf("cannot infer the format of %q with MIME type %q", element.Name, obj.MimeType)
+	}
+}
+
+// jobID returns a valid job ID that is unique for the table and the name of the element.
+func (bs *bqStorage) jobID(element ingest.Codec) string {
+	h := sha256.Sum256([]byte(strings.Join([]string{bs.table.Project, bs.table.Dataset, bs.table.Table, element.Name}, "\x00")))
+	return "ingest_" + hex.EncodeToString(h[:])
+}
+
+func (bs *bqStorage) url(id string) *url.URL {
+	return &url.URL{
+		Scheme:   "bigquery",
+		Host:     bs.table.Project,
+		Path:     "/" + bs.table.Dataset + "/" + bs.table.Table,
+		RawQuery: url.Values{"job": []string{id}}.Encode(),
+	}
+}
+
+func isNotFound(err error) bool {
+	var gerr *googleapi.Error
+	return errors.As(err, &gerr) && gerr.Code == http.StatusNotFound
+}
+
+func isConflict(err error) bool {
+	var gerr *googleapi.Error
+	return errors.As(err, &gerr) && gerr.Code == http.StatusConflict
+}
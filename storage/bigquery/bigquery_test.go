@@ -0,0 +1,104 @@
+package bigquery
+
+import (
+	"context"
+	"encoding/json"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bq "google.golang.org/api/bigquery/v2"
+	"google.golang.org/api/option"
+	gcs "google.golang.org/api/storage/v1"
+
+	"github.com/connylabs/ingest"
+)
+
+func TestStorage(t *testing.T) {
+	var mu sync.Mutex
+	staged := make(map[string]bool)
+	jobs := make(map[string]*bq.Job)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/upload/storage/v1/b/bucket/o":
+			// The first part of the multipart upload is the metadata of the object.
+			_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			require.NoError(t, err)
+			p, err := multipart.NewReader(r.Body, params["boundary"]).NextPart()
+			require.NoError(t, err)
+			o := new(gcs.Object)
+			require.NoError(t, json.NewDecoder(p).Decode(o))
+			staged[o.Name] = true
+			json.NewEncoder(w).Encode(o) //nolint:errcheck
+		case r.Method == http.MethodPost && r.URL.Path == "/bigquery/v2/projects/project/jobs":
+			j := new(bq.Job)
+			require.NoError(t, json.NewDecoder(r.Body).Decode(j))
+			if _, ok := jobs[j.JobReference.JobId]; ok {
+				w.WriteHeader(http.StatusConflict)
+				w.Write([]byte(`{"error":{"code":409,"message":"Already Exists"}}`)) //nolint:errcheck
+				return
+			}
+			// The job is running when it is created and done when it is requested the next time.
+			j.Status = &bq.JobStatus{State: "RUNNING"}
+			jobs[j.JobReference.JobId] = j
+			json.NewEncoder(w).Encode(j) //nolint:errcheck
+		case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/bigquery/v2/projects/project/jobs/"):
+			j, ok := jobs[strings.TrimPrefix(r.URL.Path, "/bigquery/v2/projects/project/jobs/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"error":{"code":404,"message":"Not found"}}`)) //nolint:errcheck
+				return
+			}
+			j.Status.State = "DONE"
+			json.NewEncoder(w).Encode(j) //nolint:errcheck
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(s.Close)
+
+	ctx := context.Background()
+	gs, err := gcs.NewService(ctx, option.WithEndpoint(s.URL+"/storage/v1/"), option.WithoutAuthentication())
+	require.NoError(t, err)
+	bs, err := bq.NewService(ctx, option.WithEndpoint(s.URL+"/bigquery/v2/"), option.WithoutAuthentication())
+	require.NoError(t, err)
+	st := New("bucket", "staging", Table{Project: "project", Dataset: "dataset", Table: "table"}, Options{PollInterval: time.Millisecond}, gs, bs)
+
+	e := ingest.NewCodec("foo", "rows/1.ndjson", nil)
+	_, err = st.Stat(ctx, e)
+	assert.True(t, os.IsNotExist(err))
+
+	u, err := st.Store(ctx, e, ingest.Object{Reader: strings.NewReader(`{"a":1}`), Len: 7, MimeType: "application/x-ndjson"})
+	require.NoError(t, err)
+	assert.Equal(t, "bigquery", u.Scheme)
+	assert.Equal(t, "/dataset/table", u.Path)
+	assert.True(t, staged["staging/rows/1.ndjson"])
+	require.Len(t, jobs, 1)
+	for _, j := range jobs {
+		assert.Equal(t, []string{"gs://bucket/staging/rows/1.ndjson"}, j.Configuration.Load.SourceUris)
+		assert.Equal(t, FormatNDJSON, j.Configuration.Load.SourceFormat)
+		assert.Equal(t, "table", j.Configuration.Load.DestinationTable.TableId)
+	}
+
+	oi, err := st.Stat(ctx, e)
+	require.NoError(t, err)
+	assert.Equal(t, u.String(), oi.URI)
+
+	// Storing the object again must not insert a second job.
+	_, err = st.Store(ctx, e, ingest.Object{Reader: strings.NewReader(`{"a":1}`), Len: 7, MimeType: "application/x-ndjson"})
+	require.NoError(t, err)
+	assert.Len(t, jobs, 1)
+
+	_, err = st.Store(ctx, ingest.NewCodec("bar", "rows/2.bin", nil), ingest.Object{Reader: strings.NewReader(""), MimeType: "application/octet-stream"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,225 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Client is a minimal client for the Elasticsearch REST API.
+type Client struct {
+	u *url.URL
+	// header is added to all requests, e.g. for authentication.
+	header http.Header
+	h      *http.Client
+}
+
+// NewClient creates a new Client for the cluster at the given URL.
+// The given header is added to all requests.
+// If the given http.Client is nil, then http.DefaultClient is used.
+func NewClient(rawURL string, header http.Header, h *http.Client) (*Client, error) {
+	u, err := url.Parse(strings.TrimSuffix(rawURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse URL: %w", err)
+	}
+	if h == nil {
+		h = http.DefaultClient
+	}
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &Client{u: u, header: header, h: h}, nil
+}
+
+// BasicAuth returns a header for basic authentication.
+func BasicAuth(username, password string) http.Header {
+	h := make(http.Header)
+	h.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(username+":"+password)))
+	return h
+}
+
+// APIKey returns a header for API key authentication.
+// The key must be the base64 encoded ID and key as returned by the create API key API.
+func APIKey(key string) http.Header {
+	h := make(http.Header)
+	h.Set("Authorization", "ApiKey "+key)
+	return h
+}
+
+// Hit is a document.
+type Hit struct {
+	Index  string          `json:"_index"`
+	ID     string          `json:"_id"`
+	Source json.RawMessage `json:"_source,omitempty"`
+}
+
+// SearchResult is the response of a search or scroll request.
+type SearchResult struct {
+	ScrollID string `json:"_scroll_id"`
+	Hits     struct {
+		Hits []Hit `json:"hits"`
+	} `json:"hits"`
+}
+
+// Search starts a scroll search in the given index with the given request body.
+// Scroll is the keep alive of the search context, e.g. 5m.
+func (c *Client) Search(ctx context.Context, index string, body interface{}, scroll string) (*SearchResult, error) {
+	q := url.Values{}
+	q.Set("scroll", scroll)
+	r := new(SearchResult)
+	if err := c.do(ctx, http.MethodPost, "/"+url.PathEscape(index)+"/_search", q, body, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Scroll requests the next page of a scroll search.
+func (c *Client) Scroll(ctx context.Context, scrollID, scroll string) (*SearchResult, error) {
+	r := new(SearchResult)
+	if err := c.do(ctx, http.MethodPost, "/_search/scroll", nil, map[string]string{"scroll": scroll, "scroll_id": scrollID}, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ClearScroll frees the search context of a scroll search.
+func (c *Client) ClearScroll(ctx context.Context, scrollID string) error {
+	return c.do(ctx, http.MethodDelete, "/_search/scroll", nil, map[string][]string{"scroll_id": {scrollID}}, nil)
+}
+
+// MGet returns the given documents. Documents that were not found are omitted.
+func (c *Client) MGet(ctx context.Context, docs []Hit) ([]Hit, error) {
+	type doc struct {
+		Index string `json:"_index"`
+		ID    string `json:"_id"`
+	}
+	req := struct {
+		Docs []doc `json:"docs"`
+	}{make([]doc, len(docs))}
+	for i := range docs {
+		req.Docs[i] = doc{Index: docs[i].Index, ID: docs[i].ID}
+	}
+	var res struct {
+		Docs []struct {
+			Hit
+			Found bool `json:"found"`
+		} `json:"docs"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/_mget", nil, req, &res); err != nil {
+		return nil, err
+	}
+	hits := make([]Hit, 0, len(res.Docs))
+	for _, d := range res.Docs {
+		if d.Found {
+			hits = append(hits, d.Hit)
+		}
+	}
+	return hits, nil
+}
+
+// Index creates or replaces the document with the given ID in the index.
+func (c *Client) Index(ctx context.Context, index, id string, doc interface{}) error {
+	return c.do(ctx, http.MethodPut, documentPath(index, id), nil, doc, nil)
+}
+
+// Exists returns an error satisfying errors.Is(err, fs.ErrNotExist)
+// if the document or the index does not exist.
+func (c *Client) Exists(ctx context.Context, index, id string) error {
+	return c.do(ctx, http.MethodHead, documentPath(index, id), nil, nil, nil)
+}
+
+// DocumentURL returns the URL of the document with the given ID in the index.
+func (c *Client) DocumentURL(index, id string) *url.URL {
+	return c.url(documentPath(index, id))
+}
+
+// url appends the given escaped path to the URL of the cluster.
+func (c *Client) url(p string) *url.URL {
+	u := *c.u
+	u.RawQuery = ""
+	ref, err := url.Parse(u.String() + p)
+	if err != nil {
+		// Paths are escaped, so this cannot happen.
+		u.Path += p
+		return &u
+	}
+	return ref
+}
+
+func documentPath(index, id string) string {
+	return "/" + url.PathEscape(index) + "/_doc/" + url.PathEscape(id)
+}
+
+// Error is an error response of Elasticsearch.
+type Error struct {
+	StatusCode int
+	Type       string `json:"type"`
+	Reason     string `json:"reason"`
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	if e.Type == "" {
+		return fmt.Sprintf("elasticsearch responded with status code %d", e.StatusCode)
+	}
+	return fmt.Sprintf("elasticsearch responded with status code %d: %s: %s", e.StatusCode, e.Type, e.Reason)
+}
+
+// Is allows errors.Is(err, fs.ErrNotExist) to match missing documents and indices.
+func (e *Error) Is(target error) bool {
+	return target == fs.ErrNotExist && e.StatusCode == http.StatusNotFound
+}
+
+// do sends a JSON request and decodes the JSON response into out, if it is not nil.
+func (c *Client) do(ctx context.Context, method, p string, q url.Values, in, out interface{}) error {
+	u := c.url(p)
+	u.RawQuery = q.Encode()
+	var body io.Reader
+	if in != nil {
+		buf, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(buf)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return err
+	}
+	for k, vs := range c.header {
+		req.Header[k] = vs
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	res, err := c.h.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		e := struct {
+			Error *Error `json:"error"`
+		}{}
+		json.NewDecoder(res.Body).Decode(&e) //nolint:errcheck
+		if e.Error == nil {
+			e.Error = &Error{}
+		}
+		e.Error.StatusCode = res.StatusCode
+		return e.Error
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "ApiKey key", r.Header.Get("Authorization"))
+		var body map[string]interface{}
+		if r.Body != nil {
+			json.NewDecoder(r.Body).Decode(&body) //nolint:errcheck
+		}
+		switch {
+		case r.URL.Path == "/index/_search":
+			assert.Equal(t, "1m", r.URL.Query().Get("scroll"))
+			assert.Equal(t, float64(1), body["size"])
+			w.Write([]byte(`{"_scroll_id":"s1","hits":{"hits":[{"_index":"index","_id":"1","_source":{"foo":"bar"}}]}}`)) //nolint:errcheck
+		case r.URL.Path == "/_search/scroll" && r.Method == http.MethodPost:
+			assert.Equal(t, "s1", body["scroll_id"])
+			w.Write([]byte(`{"_scroll_id":"s2","hits":{"hits":[]}}`)) //nolint:errcheck
+		case r.URL.Path == "/_search/scroll" && r.Method == http.MethodDelete:
+			w.Write([]byte(`{"succeeded":true}`)) //nolint:errcheck
+		case r.URL.Path == "/_mget":
+			w.Write([]byte(`{"docs":[{"_index":"index","_id":"1","found":true,"_source":{"foo":"bar"}},{"_index":"index","_id":"2","found":false}]}`)) //nolint:errcheck
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"type":"index_not_found_exception","reason":"no such index [missing]"},"status":404}`)) //nolint:errcheck
+		}
+	}))
+	t.Cleanup(s.Close)
+
+	c, err := NewClient(s.URL, APIKey("key"), nil)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	r, err := c.Search(ctx, "index", map[string]interface{}{"size": 1}, "1m")
+	require.NoError(t, err)
+	assert.Equal(t, "s1", r.ScrollID)
+	require.Len(t, r.Hits.Hits, 1)
+	assert.Equal(t, "1", r.Hits.Hits[0].ID)
+	assert.JSONEq(t, `{"foo":"bar"}`, string(r.Hits.Hits[0].Source))
+
+	r, err = c.Scroll(ctx, r.ScrollID, "1m")
+	require.NoError(t, err)
+	assert.Empty(t, r.Hits.Hits)
+	assert.NoError(t, c.ClearScroll(ctx, r.ScrollID))
+
+	hits, err := c.MGet(ctx, []Hit{{Index: "index", ID: "1"}, {Index: "index", ID: "2"}})
+	require.NoError(t, err)
+	require.Len(t, hits, 1)
+	assert.Equal(t, "1", hits[0].ID)
+
+	_, err = c.Search(ctx, "missing", nil, "1m")
+	assert.ErrorContains(t, err, "index_not_found_exception")
+}
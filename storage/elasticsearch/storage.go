@@ -0,0 +1,89 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"text/template"
+	"time"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/storage"
+)
+
+// Document is the document that is indexed for every stored object.
+type Document struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	URI      string `json:"uri,omitempty"`
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType,omitempty"`
+	// Timestamp is the time at which the object was stored.
+	Timestamp time.Time `json:"@timestamp"`
+}
+
+type esStorage struct {
+	c     *Client
+	index string
+	uri   *template.Template
+	now   func() time.Time
+}
+
+// New returns a new Storage that indexes a Document for every object
+// instead of storing the object itself.
+// It is meant to be combined with a storage for the objects,
+// so that the stored objects become searchable.
+// If the given template is not nil, then it is executed with the Codec
+// of the object to determine the URI of the object in the other storage,
+// e.g. s3://bucket/prefix/{{.Name}}.
+// Documents are identified by the names of the objects.
+func New(index string, uri *template.Template, c *Client) storage.Storage {
+	return &esStorage{
+		c:     c,
+		index: index,
+		uri:   uri,
+		now:   time.Now,
+	}
+}
+
+func (es *esStorage) Stat(ctx context.Context, element ingest.Codec) (*storage.ObjectInfo, error) {
+	if err := es.c.Exists(ctx, es.index, element.Name); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fs.ErrNotExist
+		}
+		return nil, fmt.Errorf("failed to check for document: %w", err)
+	}
+
+	return &storage.ObjectInfo{URI: es.c.DocumentURL(es.index, element.Name).String()}, nil
+}
+
+func (es *esStorage) Store(ctx context.Context, element ingest.Codec, obj ingest.Object) (*url.URL, error) {
+	// The object is read completely to determine its actual size.
+	n, err := io.Copy(io.Discard, obj.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object: %w", err)
+	}
+	d := Document{
+		ID:        element.ID,
+		Name:      element.Name,
+		Size:      n,
+		MimeType:  obj.MimeType,
+		Timestamp: es.now().UTC(),
+	}
+	if es.uri != nil {
+		buf := new(bytes.Buffer)
+		if err := es.uri.Execute(buf, element); err != nil {
+			return nil, fmt.Errorf("failed to execute URI template: %w", err)
+		}
+		d.URI = buf.String()
+	}
+	if err := es.c.Index(ctx, es.index, element.Name, d); err != nil {
+		return nil, fmt.Errorf("failed to index document: %w", err)
+	}
+
+	return es.c.DocumentURL(es.index, element.Name), nil
+}
@@ -0,0 +1,66 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/connylabs/ingest"
+)
+
+func TestStorage(t *testing.T) {
+	docs := make(map[string]Document)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodHead:
+			if _, ok := docs[r.URL.EscapedPath()]; !ok {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case http.MethodPut:
+			var d Document
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&d))
+			docs[r.URL.EscapedPath()] = d
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"result":"created"}`)) //nolint:errcheck
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	t.Cleanup(s.Close)
+
+	c, err := NewClient(s.URL, nil, nil)
+	require.NoError(t, err)
+	now := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	es := New("objects", template.Must(template.New("uri").Parse("s3://bucket/{{.Name}}")), c).(*esStorage)
+	es.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	e := ingest.NewCodec("foo", "bar/baz.txt", nil)
+	_, err = es.Stat(ctx, e)
+	assert.True(t, os.IsNotExist(err))
+
+	u, err := es.Store(ctx, e, ingest.Object{Reader: strings.NewReader("foo"), Len: -1, MimeType: "text/plain"})
+	require.NoError(t, err)
+	assert.Equal(t, s.URL+"/objects/_doc/bar%2Fbaz.txt", u.String())
+	assert.Equal(t, Document{
+		ID:        "foo",
+		Name:      "bar/baz.txt",
+		URI:       "s3://bucket/bar/baz.txt",
+		Size:      3,
+		MimeType:  "text/plain",
+		Timestamp: now,
+	}, docs["/objects/_doc/bar%2Fbaz.txt"])
+
+	oi, err := es.Stat(ctx, e)
+	require.NoError(t, err)
+	assert.Equal(t, u.String(), oi.URI)
+}
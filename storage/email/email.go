@@ -0,0 +1,257 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net"
+	"net/smtp"
+	"net/url"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/storage"
+)
+
+// TLS modes of the connection to the SMTP server.
+const (
+	TLSNone     = "none"
+	TLSStartTLS = "starttls"
+	TLSImplicit = "implicit"
+)
+
+// Sender sends a message to the given recipients.
+type Sender interface {
+	Send(ctx context.Context, from string, to []string, msg []byte) error
+}
+
+// Recipient receives every object.
+// The templates are executed with TemplateData.
+// If a template is nil, then the default template of the storage is used.
+type Recipient struct {
+	Address string
+	Subject *template.Template
+	Body    *template.Template
+}
+
+// TemplateData is passed to the subject and body templates.
+type TemplateData struct {
+	ingest.Codec
+	Size      int64
+	MimeType  string
+	Recipient string
+}
+
+type emailStorage struct {
+	s          Sender
+	from       string
+	recipients []Recipient
+	subject    *template.Template
+	body       *template.Template
+	maxSize    int64
+	now        func() time.Time
+}
+
+// ErrTooLarge is returned when an object exceeds the maximum size of attachments.
+var ErrTooLarge = errors.New("object exceeds the maximum attachment size")
+
+// New returns a new Storage that emails every object as an attachment to every recipient.
+// Every recipient receives an individual message, so that the subject
+// and body can be rendered per recipient.
+// Objects larger than maxSize bytes are rejected with ErrTooLarge.
+// Since sent messages cannot be looked up, Stat always reports that
+// the object does not exist, so redelivered objects are sent again.
+func New(from string, recipients []Recipient, subject, body *template.Template, maxSize int64, s Sender) storage.Storage {
+	return &emailStorage{
+		s:          s,
+		from:       from,
+		recipients: recipients,
+		subject:    subject,
+		body:       body,
+		maxSize:    maxSize,
+		now:        time.Now,
+	}
+}
+
+// Stat always reports that the object does not exist.
+func (es *emailStorage) Stat(_ context.Context, _ ingest.Codec) (*storage.ObjectInfo, error) {
+	return nil, fs.ErrNotExist
+}
+
+func (es *emailStorage) Store(ctx context.Context, element ingest.Codec, obj ingest.Object) (*url.URL, error) {
+	if obj.Len > es.maxSize {
+		return nil, fmt.Errorf("%w: %d > %d", ErrTooLarge, obj.Len, es.maxSize)
+	}
+	// The length of the object is not trusted, so one more byte than allowed is read.
+	buf, err := io.ReadAll(io.LimitReader(obj.Reader, es.maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object: %w", err)
+	}
+	if int64(len(buf)) > es.maxSize {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrTooLarge, es.maxSize)
+	}
+	to := make([]string, 0, len(es.recipients))
+	for _, r := range es.recipients {
+		d := TemplateData{Codec: element, Size: int64(len(buf)), MimeType: obj.MimeType, Recipient: r.Address}
+		msg, err := es.message(r, d, buf)
+		if err != nil {
+			return nil, err
+		}
+		if err := es.s.Send(ctx, es.from, []string{r.Address}, msg); err != nil {
+			return nil, fmt.Errorf("failed to send message to %q: %w", r.Address, err)
+		}
+		to = append(to, r.Address)
+	}
+
+	return &url.URL{Scheme: "mailto", Opaque: strings.Join(to, ",")}, nil
+}
+
+// message renders a MIME message with the object as attachment.
+func (es *emailStorage) message(r Recipient, d TemplateData, content []byte) ([]byte, error) {
+	subject, err := execute(r.Subject, es.subject, d)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute subject template: %w", err)
+	}
+	body, err := execute(r.Body, es.body, d)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute body template: %w", err)
+	}
+	boundary, err := randomBoundary()
+	if err != nil {
+		return nil, err
+	}
+	ct := d.MimeType
+	if ct == "" {
+		ct = "application/octet-stream"
+	}
+	name := path.Base(d.Name)
+
+	msg := new(bytes.Buffer)
+	fmt.Fprintf(msg, "From: %s\r\n", es.from)
+	fmt.Fprintf(msg, "To: %s\r\n", r.Address)
+	fmt.Fprintf(msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(msg, "Date: %s\r\n", es.now().Format(time.RFC1123Z))
+	fmt.Fprintf(msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(msg, "Content-Type: multipart/mixed; boundary=%q\r\n\r\n", boundary)
+	fmt.Fprintf(msg, "--%s\r\n", boundary)
+	fmt.Fprintf(msg, "Content-Type: text/plain; charset=utf-8\r\n")
+	fmt.Fprintf(msg, "Content-Transfer-Encoding: base64\r\n\r\n")
+	writeBase64(msg, []byte(body))
+	fmt.Fprintf(msg, "--%s\r\n", boundary)
+	fmt.Fprintf(msg, "Content-Type: %s\r\n", mime.FormatMediaType(ct, map[string]string{"name": name}))
+	fmt.Fprintf(msg, "Content-Disposition: %s\r\n", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	fmt.Fprintf(msg, "Content-Transfer-Encoding: base64\r\n\r\n")
+	writeBase64(msg, content)
+	fmt.Fprintf(msg, "--%s--\r\n", boundary)
+	return msg.Bytes(), nil
+}
+
+// execute executes the first template that is not nil.
+func execute(t, fallback *template.Template, d TemplateData) (string, error) {
+	if t == nil {
+		t = fallback
+	}
+	if t == nil {
+		return "", nil
+	}
+	buf := new(bytes.Buffer)
+	if err := t.Execute(buf, d); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// writeBase64 writes the base64 encoding of the data in lines of 76 characters.
+func writeBase64(w *bytes.Buffer, data []byte) {
+	enc := base64.StdEncoding.EncodeToString(data)
+	for len(enc) > 76 {
+		w.WriteString(enc[:76] + "\r\n")
+		enc = enc[76:]
+	}
+	w.WriteString(enc + "\r\n")
+}
+
+func randomBoundary() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// SMTPSender sends messages using an SMTP server.
+type SMTPSender struct {
+	// Addr is the host and port of the SMTP server.
+	Addr string
+	// Auth is used if it is not nil.
+	Auth smtp.Auth
+	// TLS is one of TLSNone, TLSStartTLS and TLSImplicit.
+	TLS string
+}
+
+// Send implements the Sender interface.
+func (ss *SMTPSender) Send(ctx context.Context, from string, to []string, msg []byte) error {
+	host, _, err := net.SplitHostPort(ss.Addr)
+	if err != nil {
+		return err
+	}
+	tc := &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+	var conn net.Conn
+	if ss.TLS == TLSImplicit {
+		conn, err = (&tls.Dialer{Config: tc}).DialContext(ctx, "tcp", ss.Addr)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", ss.Addr)
+	}
+	if err != nil {
+		return err
+	}
+	if d, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(d) //nolint:errcheck
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if ss.TLS == TLSStartTLS {
+		if err := c.StartTLS(tc); err != nil {
+			return err
+		}
+	}
+	if ss.Auth != nil {
+		if err := c.Auth(ss.Auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, addr := range to {
+		if err := c.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
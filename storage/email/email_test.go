@@ -0,0 +1,85 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/connylabs/ingest"
+)
+
+type message struct {
+	from string
+	to   []string
+	msg  []byte
+}
+
+type fakeSender struct {
+	msgs []message
+}
+
+func (f *fakeSender) Send(_ context.Context, from string, to []string, msg []byte) error {
+	f.msgs = append(f.msgs, message{from, to, msg})
+	return nil
+}
+
+func TestStorage(t *testing.T) {
+	ctx := context.Background()
+	fs := new(fakeSender)
+	es := New("ingest@example.com", []Recipient{
+		{Address: "a@example.com"},
+		{Address: "b@example.com", Subject: template.Must(template.New("").Parse("Hi {{.Recipient}}: {{.Name}}"))},
+	}, template.Must(template.New("").Parse("Report {{.Name}}")), template.Must(template.New("").Parse("{{.Size}} bytes")), 10, fs)
+
+	e := ingest.NewCodec("foo", "reports/bar.csv", nil)
+	_, err := es.Stat(ctx, e)
+	assert.True(t, os.IsNotExist(err))
+
+	u, err := es.Store(ctx, e, ingest.Object{Reader: strings.NewReader("a,b"), Len: 3, MimeType: "text/csv"})
+	require.NoError(t, err)
+	assert.Equal(t, "mailto:a@example.com,b@example.com", u.String())
+	require.Len(t, fs.msgs, 2)
+
+	for i, subject := range []string{"Report reports/bar.csv", "Hi b@example.com: reports/bar.csv"} {
+		assert.Equal(t, "ingest@example.com", fs.msgs[i].from)
+		m, err := mail.ReadMessage(bytes.NewReader(fs.msgs[i].msg))
+		require.NoError(t, err)
+		s, err := new(mime.WordDecoder).DecodeHeader(m.Header.Get("Subject"))
+		require.NoError(t, err)
+		assert.Equal(t, subject, s)
+		_, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+		require.NoError(t, err)
+		mr := multipart.NewReader(m.Body, params["boundary"])
+		var parts []string
+		for {
+			p, err := mr.NextPart()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			require.NoError(t, err)
+			buf, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, p))
+			require.NoError(t, err)
+			parts = append(parts, string(buf))
+			if p.FileName() != "" {
+				assert.Equal(t, "bar.csv", p.FileName())
+			}
+		}
+		assert.Equal(t, []string{"3 bytes", "a,b"}, parts)
+	}
+
+	_, err = es.Store(ctx, e, ingest.Object{Reader: strings.NewReader("01234567890"), Len: -1})
+	assert.ErrorIs(t, err, ErrTooLarge)
+	assert.Len(t, fs.msgs, 2)
+}
@@ -0,0 +1,106 @@
+package filesystem
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/storage"
+)
+
+type fsStorage struct {
+	dir string
+}
+
+// New returns a new Storage that can store objects as files in a local directory.
+// Files are written to a temporary file in the target directory, synced to disk
+// and then renamed, so that other processes never observe partially written files.
+func New(dir string) (storage.Storage, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine absolute path of %q: %w", dir, err)
+	}
+	return &fsStorage{dir: abs}, nil
+}
+
+// Stat considers an object to exist if a regular file exists at its path.
+// Since files are renamed only after they were written completely,
+// the existence of the file implies that it has its full size.
+func (fss *fsStorage) Stat(_ context.Context, element ingest.Codec) (*storage.ObjectInfo, error) {
+	p := fss.path(element)
+	fi, err := os.Stat(p)
+	if os.IsNotExist(err) {
+		return nil, fs.ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, fmt.Errorf("%q is not a regular file", p)
+	}
+
+	return &storage.ObjectInfo{URI: fileURL(p).String()}, nil
+}
+
+func (fss *fsStorage) Store(_ context.Context, element ingest.Codec, obj ingest.Object) (*url.URL, error) {
+	p := fss.path(element)
+	dir := filepath.Dir(p)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+	f, err := os.CreateTemp(dir, "."+filepath.Base(p)+".tmp-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	// Removing the temporary file fails harmlessly once it was renamed.
+	defer os.Remove(f.Name())
+	if _, err := io.Copy(f, obj.Reader); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to sync file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close file: %w", err)
+	}
+	// Temporary files are created with mode 0600.
+	if err := os.Chmod(f.Name(), 0o644); err != nil {
+		return nil, fmt.Errorf("failed to change file mode: %w", err)
+	}
+	if err := os.Rename(f.Name(), p); err != nil {
+		return nil, fmt.Errorf("failed to rename file: %w", err)
+	}
+	// The rename is only durable once the directory is synced.
+	if err := syncDir(dir); err != nil {
+		return nil, fmt.Errorf("failed to sync directory: %w", err)
+	}
+
+	return fileURL(p), nil
+}
+
+// path returns the path of the file for the element.
+// Names are cleaned so that files cannot be written outside of the directory.
+func (fss *fsStorage) path(element ingest.Codec) string {
+	return filepath.Join(fss.dir, filepath.FromSlash(path.Join("/", element.Name)))
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+func fileURL(p string) *url.URL {
+	return &url.URL{Scheme: "file", Path: filepath.ToSlash(p)}
+}
@@ -0,0 +1,52 @@
+package filesystem
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/connylabs/ingest"
+)
+
+func TestStorage(t *testing.T) {
+	dir := t.TempDir()
+	s, err := New(dir)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	c := ingest.NewCodec("foo", "bar/baz.txt", nil)
+	_, err = s.Stat(ctx, c)
+	assert.True(t, os.IsNotExist(err))
+
+	u, err := s.Store(ctx, c, ingest.Object{Reader: strings.NewReader("foo"), Len: 3})
+	require.NoError(t, err)
+	p := filepath.Join(dir, "bar", "baz.txt")
+	assert.Equal(t, "file://"+filepath.ToSlash(p), u.String())
+	buf, err := os.ReadFile(p)
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(buf))
+
+	oi, err := s.Stat(ctx, c)
+	require.NoError(t, err)
+	assert.Equal(t, u.String(), oi.URI)
+
+	// No temporary files are left behind.
+	entries, err := os.ReadDir(filepath.Join(dir, "bar"))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	// Names cannot escape the directory.
+	_, err = s.Store(ctx, ingest.NewCodec("qux", "../../qux.txt", nil), ingest.Object{Reader: strings.NewReader("qux"), Len: 3})
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(dir, "qux.txt"))
+	assert.NoError(t, err)
+
+	_, err = s.Stat(ctx, ingest.NewCodec("bar", "bar", nil))
+	assert.Error(t, err)
+	assert.False(t, os.IsNotExist(err))
+}
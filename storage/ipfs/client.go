@@ -0,0 +1,238 @@
+package ipfs
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Client is a minimal client for the RPC API of an IPFS node, e.g. Kubo.
+type Client struct {
+	u *url.URL
+	// header is added to all requests, e.g. for authentication.
+	header http.Header
+	h      *http.Client
+}
+
+// NewClient creates a new Client for the RPC API at the given URL, e.g. http://127.0.0.1:5001.
+// The given header is added to all requests.
+// If the given http.Client is nil, then http.DefaultClient is used.
+func NewClient(rawURL string, header http.Header, h *http.Client) (*Client, error) {
+	u, err := url.Parse(strings.TrimSuffix(rawURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse URL: %w", err)
+	}
+	if h == nil {
+		h = http.DefaultClient
+	}
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &Client{u: u, header: header, h: h}, nil
+}
+
+// BasicAuth returns a header for basic authentication.
+func BasicAuth(username, password string) http.Header {
+	h := make(http.Header)
+	h.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(username+":"+password)))
+	return h
+}
+
+// Bearer returns a header for bearer token authentication.
+func Bearer(token string) http.Header {
+	h := make(http.Header)
+	h.Set("Authorization", "Bearer "+token)
+	return h
+}
+
+// AddResult is the response of the add API.
+type AddResult struct {
+	Name string `json:"Name"`
+	Hash string `json:"Hash"`
+	Size string `json:"Size"`
+}
+
+// Add adds the content of the reader to the node and pins it.
+// It returns the CID of the content.
+func (c *Client) Add(ctx context.Context, name string, r io.Reader, cidVersion int) (string, error) {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		fw, err := mw.CreateFormFile("file", name)
+		if err == nil {
+			_, err = io.Copy(fw, r)
+		}
+		if err == nil {
+			err = mw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	q := url.Values{}
+	q.Set("pin", "true")
+	q.Set("cid-version", fmt.Sprint(cidVersion))
+	res := new(AddResult)
+	if err := c.do(ctx, "/add", q, mw.FormDataContentType(), pr, res); err != nil {
+		// Unblock the writing goroutine if the request failed before reading the body.
+		pr.CloseWithError(err)
+		return "", err
+	}
+	return res.Hash, nil
+}
+
+// FileStat is the response of the files/stat API.
+type FileStat struct {
+	Hash           string `json:"Hash"`
+	Size           uint64 `json:"Size"`
+	CumulativeSize uint64 `json:"CumulativeSize"`
+	Type           string `json:"Type"`
+}
+
+// FilesStat returns information about the given path in the mutable file system (MFS).
+// If the path does not exist, then the error satisfies errors.Is(err, fs.ErrNotExist).
+func (c *Client) FilesStat(ctx context.Context, p string) (*FileStat, error) {
+	q := url.Values{}
+	q.Set("arg", p)
+	fi := new(FileStat)
+	if err := c.do(ctx, "/files/stat", q, "", nil, fi); err != nil {
+		return nil, err
+	}
+	return fi, nil
+}
+
+// FilesCp copies the given CID to the given path in the MFS.
+// Parent directories are created as needed.
+func (c *Client) FilesCp(ctx context.Context, cid, p string) error {
+	q := url.Values{}
+	q.Add("arg", "/ipfs/"+cid)
+	q.Add("arg", p)
+	q.Set("parents", "true")
+	return c.do(ctx, "/files/cp", q, "", nil, nil)
+}
+
+// FilesRm removes the given path from the MFS.
+func (c *Client) FilesRm(ctx context.Context, p string) error {
+	q := url.Values{}
+	q.Set("arg", p)
+	q.Set("force", "true")
+	return c.do(ctx, "/files/rm", q, "", nil, nil)
+}
+
+// Error is an error response of the RPC API.
+type Error struct {
+	StatusCode int
+	Message    string `json:"Message"`
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("ipfs responded with status code %d", e.StatusCode)
+	}
+	return fmt.Sprintf("ipfs responded with status code %d: %s", e.StatusCode, e.Message)
+}
+
+// Is allows errors.Is(err, fs.ErrNotExist) to match missing files.
+// The RPC API responds with status code 500 for missing files,
+// so the message must be inspected.
+func (e *Error) Is(target error) bool {
+	return target == fs.ErrNotExist && (e.StatusCode == http.StatusNotFound || strings.Contains(e.Message, "does not exist"))
+}
+
+// do sends a POST request to the RPC API and decodes the JSON response into out, if it is not nil.
+func (c *Client) do(ctx context.Context, p string, q url.Values, contentType string, body io.Reader, out interface{}) error {
+	u := *c.u
+	u.Path += "/api/v0" + p
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), body)
+	if err != nil {
+		return err
+	}
+	for k, vs := range c.header {
+		req.Header[k] = vs
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	res, err := c.h.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		e := &Error{}
+		json.NewDecoder(res.Body).Decode(e) //nolint:errcheck
+		e.StatusCode = res.StatusCode
+		return e
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// PinningClient is a minimal client for the IPFS Pinning Service API.
+type PinningClient struct {
+	u     *url.URL
+	token string
+	h     *http.Client
+}
+
+// NewPinningClient creates a new PinningClient for the service at the given URL.
+// If the given http.Client is nil, then http.DefaultClient is used.
+func NewPinningClient(rawURL, token string, h *http.Client) (*PinningClient, error) {
+	u, err := url.Parse(strings.TrimSuffix(rawURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse URL: %w", err)
+	}
+	if h == nil {
+		h = http.DefaultClient
+	}
+	return &PinningClient{u: u, token: token, h: h}, nil
+}
+
+// Pin asks the pinning service to pin the given CID under the given name.
+// The pinning service pins the content asynchronously.
+func (pc *PinningClient) Pin(ctx context.Context, cid, name string) error {
+	buf, err := json.Marshal(struct {
+		CID  string `json:"cid"`
+		Name string `json:"name,omitempty"`
+	}{cid, name})
+	if err != nil {
+		return err
+	}
+	u := *pc.u
+	u.Path += "/pins"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+pc.token)
+	res, err := pc.h.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		e := struct {
+			Error struct {
+				Reason  string `json:"reason"`
+				Details string `json:"details"`
+			} `json:"error"`
+		}{}
+		json.NewDecoder(res.Body).Decode(&e) //nolint:errcheck
+		return fmt.Errorf("pinning service responded with status code %d: %s %s", res.StatusCode, e.Error.Reason, e.Error.Details)
+	}
+	return nil
+}
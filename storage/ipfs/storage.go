@@ -0,0 +1,78 @@
+package ipfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"path"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/storage"
+)
+
+type ipfsStorage struct {
+	c          *Client
+	pc         *PinningClient
+	root       string
+	cidVersion int
+}
+
+// New returns a new Storage that adds objects to an IPFS node.
+// The content is pinned on the node and the returned URL is ipfs://<CID>.
+// To be able to stat objects by name, every object is additionally linked
+// into the mutable file system (MFS) of the node under the given root directory.
+// If the given PinningClient is not nil, then the CID is also pinned with the pinning service.
+func New(root string, cidVersion int, c *Client, pc *PinningClient) storage.Storage {
+	return &ipfsStorage{
+		c:          c,
+		pc:         pc,
+		root:       path.Join("/", root),
+		cidVersion: cidVersion,
+	}
+}
+
+func (is *ipfsStorage) Stat(ctx context.Context, element ingest.Codec) (*storage.ObjectInfo, error) {
+	fi, err := is.c.FilesStat(ctx, is.path(element))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fs.ErrNotExist
+		}
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	return &storage.ObjectInfo{URI: cidURL(fi.Hash).String()}, nil
+}
+
+func (is *ipfsStorage) Store(ctx context.Context, element ingest.Codec, obj ingest.Object) (*url.URL, error) {
+	cid, err := is.c.Add(ctx, path.Base(element.Name), obj.Reader, is.cidVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add object: %w", err)
+	}
+	if is.pc != nil {
+		if err := is.pc.Pin(ctx, cid, element.Name); err != nil {
+			return nil, fmt.Errorf("failed to pin object with pinning service: %w", err)
+		}
+	}
+	p := is.path(element)
+	// The copy fails if the path already exists, e.g. when a previous attempt was interrupted.
+	if err := is.c.FilesRm(ctx, p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to remove existing file: %w", err)
+	}
+	if err := is.c.FilesCp(ctx, cid, p); err != nil {
+		return nil, fmt.Errorf("failed to link object into MFS: %w", err)
+	}
+
+	return cidURL(cid), nil
+}
+
+// path returns the path of the element in the MFS.
+// Names are cleaned so that files cannot be linked outside of the root directory.
+func (is *ipfsStorage) path(element ingest.Codec) string {
+	return path.Join(is.root, path.Join("/", element.Name))
+}
+
+func cidURL(cid string) *url.URL {
+	return &url.URL{Scheme: "ipfs", Host: cid}
+}
@@ -0,0 +1,84 @@
+package ipfs
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/connylabs/ingest"
+)
+
+func TestStorage(t *testing.T) {
+	files := make(map[string]string)
+	var pins []string
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch r.URL.Path {
+		case "/api/v0/add":
+			assert.Equal(t, "true", q.Get("pin"))
+			assert.Equal(t, "1", q.Get("cid-version"))
+			f, _, err := r.FormFile("file")
+			require.NoError(t, err)
+			buf, err := io.ReadAll(f)
+			require.NoError(t, err)
+			json.NewEncoder(w).Encode(AddResult{Name: "baz.txt", Hash: "cid-" + string(buf)}) //nolint:errcheck
+		case "/api/v0/files/stat":
+			cid, ok := files[q.Get("arg")]
+			if !ok {
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte(`{"Message":"file does not exist","Code":0,"Type":"error"}`)) //nolint:errcheck
+				return
+			}
+			json.NewEncoder(w).Encode(FileStat{Hash: cid, Type: "file"}) //nolint:errcheck
+		case "/api/v0/files/rm":
+			delete(files, q.Get("arg"))
+		case "/api/v0/files/cp":
+			args := q["arg"]
+			require.Len(t, args, 2)
+			files[args[1]] = strings.TrimPrefix(args[0], "/ipfs/")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(node.Close)
+	ps := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/pins", r.URL.Path)
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		var p struct {
+			CID string `json:"cid"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&p))
+		pins = append(pins, p.CID)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(ps.Close)
+
+	c, err := NewClient(node.URL, nil, nil)
+	require.NoError(t, err)
+	pc, err := NewPinningClient(ps.URL, "token", nil)
+	require.NoError(t, err)
+	is := New("ingest", 1, c, pc)
+	ctx := context.Background()
+
+	e := ingest.NewCodec("foo", "bar/baz.txt", nil)
+	_, err = is.Stat(ctx, e)
+	assert.True(t, os.IsNotExist(err))
+
+	u, err := is.Store(ctx, e, ingest.Object{Reader: strings.NewReader("foo"), Len: 3})
+	require.NoError(t, err)
+	assert.Equal(t, "ipfs://cid-foo", u.String())
+	assert.Equal(t, map[string]string{"/ingest/bar/baz.txt": "cid-foo"}, files)
+	assert.Equal(t, []string{"cid-foo"}, pins)
+
+	oi, err := is.Stat(ctx, e)
+	require.NoError(t, err)
+	assert.Equal(t, u.String(), oi.URI)
+}
@@ -0,0 +1,119 @@
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"text/template"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/storage"
+)
+
+// Header keys of the published messages.
+const (
+	HeaderID       = "ingest-id"
+	HeaderName     = "ingest-name"
+	HeaderMimeType = "content-type"
+)
+
+// Writer is able to write messages to Kafka.
+// It is satisfied by *kafkago.Writer.
+type Writer interface {
+	WriteMessages(context.Context, ...kafkago.Message) error
+}
+
+// Pointer is the record that is published for every object
+// when the object itself is not published.
+type Pointer struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	URI      string `json:"uri,omitempty"`
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType,omitempty"`
+	// Timestamp is the time at which the object was stored.
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type kafkaStorage struct {
+	w     Writer
+	topic string
+	host  string
+	uri   *template.Template
+	now   func() time.Time
+}
+
+// New returns a new Storage that publishes a message to a Kafka topic for every object.
+// The key of every message is the name of the object.
+// If the given template is nil, then the value of the message is the content of the object.
+// Otherwise, the template is executed with the Codec of the object to determine the URI
+// of the object in another storage, e.g. s3://bucket/prefix/{{.Name}}, and the value is
+// a JSON encoded Pointer.
+// The given host is only used to build the URLs of the published messages.
+func New(topic, host string, uri *template.Template, w Writer) storage.Storage {
+	return &kafkaStorage{
+		w:     w,
+		topic: topic,
+		host:  host,
+		uri:   uri,
+		now:   time.Now,
+	}
+}
+
+// Stat always reports that the object does not exist,
+// because Kafka topics cannot be queried for individual messages.
+// Consequently, messages are published at least once and consumers
+// must be able to handle duplicates.
+func (ks *kafkaStorage) Stat(_ context.Context, _ ingest.Codec) (*storage.ObjectInfo, error) {
+	return nil, fs.ErrNotExist
+}
+
+func (ks *kafkaStorage) Store(ctx context.Context, element ingest.Codec, obj ingest.Object) (*url.URL, error) {
+	value, err := io.ReadAll(obj.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object: %w", err)
+	}
+	if ks.uri != nil {
+		p := Pointer{
+			ID:        element.ID,
+			Name:      element.Name,
+			Size:      int64(len(value)),
+			MimeType:  obj.MimeType,
+			Timestamp: ks.now().UTC(),
+		}
+		buf := new(bytes.Buffer)
+		if err := ks.uri.Execute(buf, element); err != nil {
+			return nil, fmt.Errorf("failed to execute URI template: %w", err)
+		}
+		p.URI = buf.String()
+		if value, err = json.Marshal(p); err != nil {
+			return nil, fmt.Errorf("failed to encode pointer: %w", err)
+		}
+	}
+	headers := []kafkago.Header{
+		{Key: HeaderID, Value: []byte(element.ID)},
+		{Key: HeaderName, Value: []byte(element.Name)},
+	}
+	if ks.uri != nil {
+		headers = append(headers, kafkago.Header{Key: HeaderMimeType, Value: []byte("application/json")})
+	} else if obj.MimeType != "" {
+		headers = append(headers, kafkago.Header{Key: HeaderMimeType, Value: []byte(obj.MimeType)})
+	}
+	if err := ks.w.WriteMessages(ctx, kafkago.Message{
+		Topic:   ks.topic,
+		Key:     []byte(element.Name),
+		Value:   value,
+		Headers: headers,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to write message: %w", err)
+	}
+
+	return &url.URL{Scheme: "kafka", Host: ks.host, Path: "/" + ks.topic, RawQuery: url.Values{"key": []string{element.Name}}.Encode()}, nil
+}
@@ -0,0 +1,73 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/connylabs/ingest"
+)
+
+type fakeWriter struct {
+	msgs []kafkago.Message
+}
+
+func (f *fakeWriter) WriteMessages(_ context.Context, msgs ...kafkago.Message) error {
+	f.msgs = append(f.msgs, msgs...)
+	return nil
+}
+
+func TestStorage(t *testing.T) {
+	ctx := context.Background()
+	e := ingest.NewCodec("foo", "bar/baz.txt", nil)
+
+	t.Run("object", func(t *testing.T) {
+		w := new(fakeWriter)
+		ks := New("objects", "localhost:9092", nil, w)
+
+		_, err := ks.Stat(ctx, e)
+		assert.True(t, os.IsNotExist(err))
+
+		u, err := ks.Store(ctx, e, ingest.Object{Reader: strings.NewReader("foo"), Len: 3, MimeType: "text/plain"})
+		require.NoError(t, err)
+		assert.Equal(t, "kafka://localhost:9092/objects?key=bar%2Fbaz.txt", u.String())
+		require.Len(t, w.msgs, 1)
+		assert.Equal(t, "objects", w.msgs[0].Topic)
+		assert.Equal(t, "bar/baz.txt", string(w.msgs[0].Key))
+		assert.Equal(t, "foo", string(w.msgs[0].Value))
+		assert.Equal(t, []kafkago.Header{
+			{Key: HeaderID, Value: []byte("foo")},
+			{Key: HeaderName, Value: []byte("bar/baz.txt")},
+			{Key: HeaderMimeType, Value: []byte("text/plain")},
+		}, w.msgs[0].Headers)
+	})
+
+	t.Run("pointer", func(t *testing.T) {
+		w := new(fakeWriter)
+		now := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+		ks := New("objects", "localhost:9092", template.Must(template.New("uri").Parse("s3://bucket/{{.Name}}")), w).(*kafkaStorage)
+		ks.now = func() time.Time { return now }
+
+		_, err := ks.Store(ctx, e, ingest.Object{Reader: strings.NewReader("foo"), Len: -1, MimeType: "text/plain"})
+		require.NoError(t, err)
+		require.Len(t, w.msgs, 1)
+		var p Pointer
+		require.NoError(t, json.Unmarshal(w.msgs[0].Value, &p))
+		assert.Equal(t, Pointer{
+			ID:        "foo",
+			Name:      "bar/baz.txt",
+			URI:       "s3://bucket/bar/baz.txt",
+			Size:      3,
+			MimeType:  "text/plain",
+			Timestamp: now,
+		}, p)
+	})
+}
@@ -0,0 +1,328 @@
+package onedrive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// GraphURL is the base URL of the Microsoft Graph API.
+const GraphURL = "https://graph.microsoft.com/v1.0"
+
+// Client is a minimal client for the drive resources of the Microsoft Graph API.
+// It works for OneDrive as well as SharePoint document libraries.
+type Client struct {
+	// u is the URL of the drive, e.g. https://graph.microsoft.com/v1.0/drives/{drive-id}.
+	u *url.URL
+	h *http.Client
+}
+
+// NewClient creates a new Client for the drive at the given URL.
+// The given http.Client must authorize requests, e.g. using OAuth2.
+// If it is nil, then http.DefaultClient is used.
+func NewClient(driveURL string, h *http.Client) (*Client, error) {
+	u, err := url.Parse(strings.TrimSuffix(driveURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse drive URL: %w", err)
+	}
+	if h == nil {
+		h = http.DefaultClient
+	}
+	return &Client{u: u, h: h}, nil
+}
+
+// ItemReference references the parent of an item.
+type ItemReference struct {
+	DriveID string `json:"driveId"`
+	ID      string `json:"id"`
+	// Path is the path of the parent, e.g. /drive/root:/Documents.
+	Path string `json:"path"`
+}
+
+// Item is a file or folder in a drive.
+type Item struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	// LastModifiedDateTime is the time at which the item was last modified.
+	LastModifiedDateTime time.Time     `json:"lastModifiedDateTime"`
+	ETag                 string        `json:"eTag"`
+	WebURL               string        `json:"webUrl"`
+	ParentReference      ItemReference `json:"parentReference"`
+	File                 *struct {
+		MimeType string `json:"mimeType"`
+	} `json:"file,omitempty"`
+	Folder *struct {
+		ChildCount int `json:"childCount"`
+	} `json:"folder,omitempty"`
+	Deleted *struct {
+		State string `json:"state"`
+	} `json:"deleted,omitempty"`
+	// Root is set if the item is the root folder of the drive.
+	Root *struct{} `json:"root,omitempty"`
+}
+
+// Path returns the path of the item relative to the root of the drive.
+// Note that items returned by a delta query do not contain the path of their parent.
+func (i *Item) Path() string {
+	p := i.ParentReference.Path
+	if j := strings.Index(p, "root:"); j >= 0 {
+		p = p[j+len("root:"):]
+	}
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return i.Name
+	}
+	return p + "/" + i.Name
+}
+
+// DeltaPage is a single page of a delta query.
+type DeltaPage struct {
+	Items []Item `json:"value"`
+	// NextLink is set if there are more pages.
+	NextLink string `json:"@odata.nextLink"`
+	// DeltaLink is set on the last page and can be used to query
+	// the changes that happened after the current query.
+	DeltaLink string `json:"@odata.deltaLink"`
+}
+
+// Delta requests a page of changed items in the drive.
+// If link is empty, then the query starts from scratch and returns all items.
+// Otherwise it must be a NextLink or DeltaLink of a previous page.
+func (c *Client) Delta(ctx context.Context, link string) (*DeltaPage, error) {
+	if link == "" {
+		link = c.u.String() + "/root/delta"
+	}
+	res, err := c.do(ctx, http.MethodGet, link, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	p := new(DeltaPage)
+	if err := json.NewDecoder(res.Body).Decode(p); err != nil {
+		return nil, fmt.Errorf("failed to decode delta page: %w", err)
+	}
+	return p, nil
+}
+
+// GetItem returns the metadata of an item.
+func (c *Client) GetItem(ctx context.Context, id string) (*Item, error) {
+	res, err := c.do(ctx, http.MethodGet, c.itemURL(id, ""), nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	i := new(Item)
+	if err := json.NewDecoder(res.Body).Decode(i); err != nil {
+		return nil, fmt.Errorf("failed to decode item: %w", err)
+	}
+	return i, nil
+}
+
+// Download downloads the content of a file.
+// The caller must close the body of the response.
+func (c *Client) Download(ctx context.Context, id string) (*http.Response, error) {
+	return c.do(ctx, http.MethodGet, c.itemURL(id, "/content"), nil, "")
+}
+
+// DeleteItem moves an item to the recycle bin.
+// It does not fail if the item does not exist.
+func (c *Client) DeleteItem(ctx context.Context, id string) error {
+	res, err := c.do(ctx, http.MethodDelete, c.itemURL(id, ""), nil, "")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// GetItemByPath returns the metadata of the item at the given path relative to the root of the drive.
+func (c *Client) GetItemByPath(ctx context.Context, p string) (*Item, error) {
+	res, err := c.do(ctx, http.MethodGet, c.pathURL(p, ""), nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	i := new(Item)
+	if err := json.NewDecoder(res.Body).Decode(i); err != nil {
+		return nil, fmt.Errorf("failed to decode item: %w", err)
+	}
+	return i, nil
+}
+
+// PutContent creates or replaces the file at the given path with a single request.
+// The Graph API only accepts up to 4 MB in this way.
+func (c *Client) PutContent(ctx context.Context, p string, r io.Reader, contentType string) (*Item, error) {
+	res, err := c.do(ctx, http.MethodPut, c.pathURL(p, "/content"), r, contentType)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	i := new(Item)
+	if err := json.NewDecoder(res.Body).Decode(i); err != nil {
+		return nil, fmt.Errorf("failed to decode item: %w", err)
+	}
+	return i, nil
+}
+
+// UploadSession is a resumable upload of a file.
+type UploadSession struct {
+	UploadURL string `json:"uploadUrl"`
+	// NextExpectedRanges are the ranges that were not yet received, e.g. 1024-.
+	NextExpectedRanges []string `json:"nextExpectedRanges"`
+}
+
+// CreateUploadSession starts a resumable upload of the file at the given path.
+// An existing file is replaced once the upload is complete.
+func (c *Client) CreateUploadSession(ctx context.Context, p string) (*UploadSession, error) {
+	body := strings.NewReader(`{"item":{"@microsoft.graph.conflictBehavior":"replace"}}`)
+	res, err := c.do(ctx, http.MethodPost, c.pathURL(p, ":/createUploadSession"), body, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	us := new(UploadSession)
+	if err := json.NewDecoder(res.Body).Decode(us); err != nil {
+		return nil, fmt.Errorf("failed to decode upload session: %w", err)
+	}
+	return us, nil
+}
+
+// GetUploadSession returns the status of an upload session.
+func (c *Client) GetUploadSession(ctx context.Context, uploadURL string) (*UploadSession, error) {
+	res, err := c.doUpload(ctx, http.MethodGet, uploadURL, nil, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	us := &UploadSession{UploadURL: uploadURL}
+	if err := json.NewDecoder(res.Body).Decode(us); err != nil {
+		return nil, fmt.Errorf("failed to decode upload session: %w", err)
+	}
+	return us, nil
+}
+
+// UploadRange uploads the given range of a file of the given total size to an upload session.
+// When the last range was uploaded, the created item is returned. Otherwise the item is nil.
+func (c *Client) UploadRange(ctx context.Context, uploadURL string, r io.Reader, start, n, total int64) (*Item, error) {
+	res, err := c.doUpload(ctx, http.MethodPut, uploadURL, r, n, fmt.Sprintf("bytes %d-%d/%d", start, start+n-1, total))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusAccepted {
+		return nil, nil
+	}
+	i := new(Item)
+	if err := json.NewDecoder(res.Body).Decode(i); err != nil {
+		return nil, fmt.Errorf("failed to decode item: %w", err)
+	}
+	return i, nil
+}
+
+// CancelUploadSession cancels an upload session and discards the uploaded data.
+func (c *Client) CancelUploadSession(ctx context.Context, uploadURL string) error {
+	res, err := c.doUpload(ctx, http.MethodDelete, uploadURL, nil, 0, "")
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+func (c *Client) itemURL(id, suffix string) string {
+	return c.u.String() + "/items/" + url.PathEscape(id) + suffix
+}
+
+// pathURL returns the URL of the item at the given path.
+// Suffixes of path-based URLs must be separated by a colon, e.g. :/content.
+func (c *Client) pathURL(p, suffix string) string {
+	segments := strings.Split(strings.Trim(p, "/"), "/")
+	for i := range segments {
+		segments[i] = url.PathEscape(segments[i])
+	}
+	if suffix != "" && !strings.HasPrefix(suffix, ":") {
+		suffix = ":" + suffix
+	} else if suffix == "" {
+		suffix = ":"
+	}
+	return c.u.String() + "/root:/" + strings.Join(segments, "/") + suffix
+}
+
+// Error is an error response of the Graph API.
+type Error struct {
+	StatusCode int
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("graph API responded with status code %d", e.StatusCode)
+	}
+	return fmt.Sprintf("graph API responded with status code %d: %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Is allows to check for missing items with errors.Is(err, fs.ErrNotExist).
+func (e *Error) Is(target error) bool {
+	return target == fs.ErrNotExist && e.StatusCode == http.StatusNotFound
+}
+
+// do sends a request to the given URL and converts unsuccessful responses into errors.
+func (c *Client) do(ctx context.Context, method, u string, body io.Reader, contentType string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return c.send(c.h, req)
+}
+
+// doUpload sends a request to the URL of an upload session.
+// The URL is pre-authenticated and must not receive the Authorization header,
+// so the default client is used instead of the authorizing client.
+func (c *Client) doUpload(ctx context.Context, method, u string, body io.Reader, n int64, contentRange string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentRange != "" {
+		req.ContentLength = n
+		req.Header.Set("Content-Range", contentRange)
+	}
+	return c.send(http.DefaultClient, req)
+}
+
+// send sends the request and converts unsuccessful responses into errors.
+func (c *Client) send(h *http.Client, req *http.Request) (*http.Response, error) {
+	res, err := h.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode >= 300 {
+		defer res.Body.Close()
+		e := struct {
+			Error *Error `json:"error"`
+		}{&Error{}}
+		json.NewDecoder(res.Body).Decode(&e) //nolint:errcheck
+		if e.Error == nil {
+			e.Error = &Error{}
+		}
+		e.Error.StatusCode = res.StatusCode
+		return nil, e.Error
+	}
+	return res, nil
+}
@@ -0,0 +1,67 @@
+package onedrive
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient(t *testing.T) {
+	var s *httptest.Server
+	s = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/drives/d/root/delta" && r.URL.Query().Get("token") == "":
+			w.Write([]byte(`{"value":[{"id":"1","name":"foo.txt","size":3,"file":{"mimeType":"text/plain"},"parentReference":{"path":"/drive/root:/docs"}}],"@odata.nextLink":"` + s.URL + `/drives/d/root/delta?token=next"}`)) //nolint:errcheck
+		case r.URL.Path == "/drives/d/root/delta" && r.URL.Query().Get("token") == "next":
+			w.Write([]byte(`{"value":[{"id":"2","name":"docs","folder":{"childCount":1},"parentReference":{"path":"/drive/root:"}}],"@odata.deltaLink":"` + s.URL + `/drives/d/root/delta?token=delta"}`)) //nolint:errcheck
+		case r.URL.Path == "/drives/d/items/1/content":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("foo")) //nolint:errcheck
+		case r.URL.Path == "/drives/d/items/1" && r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"code":"itemNotFound","message":"The resource could not be found."}}`)) //nolint:errcheck
+		}
+	}))
+	t.Cleanup(s.Close)
+
+	c, err := NewClient(s.URL+"/drives/d/", nil)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	p, err := c.Delta(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, p.Items, 1)
+	assert.Equal(t, "docs/foo.txt", p.Items[0].Path())
+	require.NotNil(t, p.Items[0].File)
+	assert.Equal(t, "text/plain", p.Items[0].File.MimeType)
+	assert.Empty(t, p.DeltaLink)
+
+	p, err = c.Delta(ctx, p.NextLink)
+	require.NoError(t, err)
+	require.Len(t, p.Items, 1)
+	assert.Equal(t, "docs", p.Items[0].Path())
+	assert.NotNil(t, p.Items[0].Folder)
+	assert.Equal(t, s.URL+"/drives/d/root/delta?token=delta", p.DeltaLink)
+
+	res, err := c.Download(ctx, "1")
+	require.NoError(t, err)
+	buf, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(buf))
+
+	_, err = c.Download(ctx, "3")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	assert.ErrorContains(t, err, "itemNotFound")
+
+	assert.NoError(t, c.DeleteItem(ctx, "1"))
+	assert.NoError(t, c.DeleteItem(ctx, "3"))
+}
@@ -0,0 +1,141 @@
+package onedrive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/connylabs/ingest"
+	"github.com/connylabs/ingest/internal/spool"
+	"github.com/connylabs/ingest/storage"
+)
+
+const (
+	// chunkMultiple is the size of which all chunks except the last must be a multiple.
+	chunkMultiple = 320 << 10
+	// DefaultChunkSize is the default size of the chunks of upload sessions.
+	DefaultChunkSize = 32 * chunkMultiple
+	// maxRetries is the number of times that a chunk is retried.
+	maxRetries = 3
+)
+
+type odStorage struct {
+	c         *Client
+	folder    string
+	chunkSize int64
+}
+
+// New returns a new Storage that can store objects in OneDrive or a SharePoint document library.
+// Objects are uploaded with resumable upload sessions in chunks of the given size,
+// which is rounded down to a multiple of 320 KiB.
+// Failed chunks are retried from the position that the upload session expects next.
+func New(folder string, chunkSize int64, c *Client) storage.Storage {
+	if chunkSize < chunkMultiple {
+		chunkSize = DefaultChunkSize
+	}
+	return &odStorage{
+		c:         c,
+		folder:    strings.Trim(folder, "/"),
+		chunkSize: chunkSize - chunkSize%chunkMultiple,
+	}
+}
+
+func (ods *odStorage) Stat(ctx context.Context, element ingest.Codec) (*storage.ObjectInfo, error) {
+	i, err := ods.c.GetItemByPath(ctx, ods.path(element))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fs.ErrNotExist
+		}
+		return nil, fmt.Errorf("failed to get item: %w", err)
+	}
+	if i.File == nil {
+		return nil, fmt.Errorf("%q is not a file", ods.path(element))
+	}
+
+	return &storage.ObjectInfo{URI: i.WebURL}, nil
+}
+
+func (ods *odStorage) Store(ctx context.Context, element ingest.Codec, obj ingest.Object) (*url.URL, error) {
+	// The object is spooled to a temporary file, because the total size
+	// must be known and chunks must be seekable to be retried.
+	f, n, err := spool.Temp(obj.Reader, "ingest-onedrive-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object: %w", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	p := ods.path(element)
+	var i *Item
+	if n == 0 {
+		// Upload sessions do not accept empty files.
+		i, err = ods.c.PutContent(ctx, p, f, obj.MimeType)
+	} else {
+		i, err = ods.upload(ctx, p, f, n)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload file: %w", err)
+	}
+
+	return url.Parse(i.WebURL)
+}
+
+// upload uploads the file with an upload session.
+func (ods *odStorage) upload(ctx context.Context, p string, f *os.File, n int64) (*Item, error) {
+	us, err := ods.c.CreateUploadSession(ctx, p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upload session: %w", err)
+	}
+	var start int64
+	retries := 0
+	for {
+		size := ods.chunkSize
+		if start+size > n {
+			size = n - start
+		}
+		i, err := ods.c.UploadRange(ctx, us.UploadURL, io.NewSectionReader(f, start, size), start, size, n)
+		if err == nil {
+			if i != nil {
+				return i, nil
+			}
+			start += size
+			retries = 0
+			continue
+		}
+		if ctx.Err() != nil || retries == maxRetries {
+			ods.c.CancelUploadSession(context.Background(), us.UploadURL) //nolint:errcheck
+			return nil, err
+		}
+		retries++
+		// Resume from the position that the upload session expects.
+		s, serr := ods.c.GetUploadSession(ctx, us.UploadURL)
+		if serr != nil {
+			return nil, fmt.Errorf("failed to get upload session after %v: %w", err, serr)
+		}
+		if start, err = nextExpected(s); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// path returns the path of the file for the element.
+// Names are cleaned so that files cannot be written outside of the folder.
+func (ods *odStorage) path(element ingest.Codec) string {
+	return strings.TrimPrefix(path.Join("/", ods.folder, path.Join("/", element.Name)), "/")
+}
+
+// nextExpected returns the start of the first range that the upload session expects.
+func nextExpected(us *UploadSession) (int64, error) {
+	if len(us.NextExpectedRanges) == 0 {
+		return 0, errors.New("upload session does not expect any more ranges")
+	}
+	start, _, _ := strings.Cut(us.NextExpectedRanges[0], "-")
+	return strconv.ParseInt(start, 10, 64)
+}
@@ -0,0 +1,89 @@
+package onedrive
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/connylabs/ingest"
+)
+
+func TestStorage(t *testing.T) {
+	var s *httptest.Server
+	var uploaded []byte
+	var stored bool
+	failed := false
+	s = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		item := Item{ID: "1", Name: "baz.txt", WebURL: "https://example.com/folder/bar/baz.txt", File: &struct {
+			MimeType string `json:"mimeType"`
+		}{"text/plain"}}
+		switch {
+		case r.URL.Path == "/drives/d/root:/folder/bar/baz.txt:" && r.Method == http.MethodGet:
+			if !stored {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"error":{"code":"itemNotFound","message":"The resource could not be found."}}`)) //nolint:errcheck
+				return
+			}
+			json.NewEncoder(w).Encode(item) //nolint:errcheck
+		case r.URL.Path == "/drives/d/root:/folder/bar/baz.txt:/createUploadSession":
+			json.NewEncoder(w).Encode(UploadSession{UploadURL: s.URL + "/upload/1"}) //nolint:errcheck
+		case r.URL.Path == "/upload/1" && r.Method == http.MethodGet:
+			json.NewEncoder(w).Encode(UploadSession{NextExpectedRanges: []string{fmt.Sprintf("%d-", len(uploaded))}}) //nolint:errcheck
+		case r.URL.Path == "/upload/1" && r.Method == http.MethodPut:
+			assert.Empty(t, r.Header.Get("Authorization"))
+			var start, end, total int
+			_, err := fmt.Sscanf(r.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &total)
+			require.NoError(t, err)
+			require.Equal(t, len(uploaded), start)
+			buf, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			require.Len(t, buf, end-start+1)
+			// Fail the second chunk once to exercise resumption.
+			if start > 0 && !failed {
+				failed = true
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			uploaded = append(uploaded, buf...)
+			if len(uploaded) < total {
+				w.WriteHeader(http.StatusAccepted)
+				return
+			}
+			stored = true
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(item) //nolint:errcheck
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(s.Close)
+
+	c, err := NewClient(s.URL+"/drives/d", nil)
+	require.NoError(t, err)
+	st := New("/folder/", chunkMultiple, c)
+	ctx := context.Background()
+
+	e := ingest.NewCodec("foo", "bar/baz.txt", nil)
+	_, err = st.Stat(ctx, e)
+	assert.True(t, os.IsNotExist(err))
+
+	content := bytes.Repeat([]byte("a"), chunkMultiple+10)
+	u, err := st.Store(ctx, e, ingest.Object{Reader: bytes.NewReader(content), Len: -1, MimeType: "text/plain"})
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/folder/bar/baz.txt", u.String())
+	assert.True(t, failed)
+	assert.Equal(t, content, uploaded)
+
+	oi, err := st.Stat(ctx, e)
+	require.NoError(t, err)
+	assert.Equal(t, u.String(), oi.URI)
+}
@@ -8,20 +8,26 @@ import (
 	"io/fs"
 	"net/url"
 	"path"
+	"strings"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/tags"
 
 	"github.com/connylabs/ingest"
 	"github.com/connylabs/ingest/storage"
 )
 
+// hashKey is the key of the user metadata under which the hash of the Codec of an object is stored.
+const hashKey = "Ingest-Hash"
+
 // MinioClient must be implemented by the storage client.
 // The minio.Client implements this interface.
 type MinioClient interface {
 	PutObject(context.Context, string, string, io.Reader, int64, minio.PutObjectOptions) (minio.UploadInfo, error)
 	StatObject(context.Context, string, string, minio.StatObjectOptions) (minio.ObjectInfo, error)
+	ComposeObject(context.Context, minio.CopyDestOptions, ...minio.CopySrcOptions) (minio.UploadInfo, error)
 }
 
 type minioStorage struct {
@@ -31,11 +37,34 @@ type minioStorage struct {
 	prefix          string
 	metafilesPrefix string
 	useDone         bool
+	storageClass    string
+	endpoint        string
+}
+
+// Option configures the Storage.
+type Option func(*minioStorage)
+
+// WithStorageClass sets the storage class of stored objects, e.g. STANDARD_IA or GLACIER,
+// so that objects can be stored directly in cold storage.
+// Meta objects are always stored with the default storage class of the bucket,
+// since they are small and read frequently.
+func WithStorageClass(class string) Option {
+	return func(ms *minioStorage) {
+		ms.storageClass = class
+	}
+}
+
+// WithEndpoint sets the endpoint of the client, e.g. s3.amazonaws.com,
+// so that objects of sources on the same endpoint are copied on the server side instead of being stored from a stream.
+func WithEndpoint(endpoint string) Option {
+	return func(ms *minioStorage) {
+		ms.endpoint = endpoint
+	}
 }
 
 // New returns a new Storage that can store objects to S3.
-func New(bucket, prefix, metafilesPrefix string, mc MinioClient, l log.Logger) storage.Storage {
-	return &minioStorage{
+func New(bucket, prefix, metafilesPrefix string, mc MinioClient, l log.Logger, opts ...Option) storage.Storage {
+	ms := &minioStorage{
 		bucket:          bucket,
 		mc:              mc,
 		l:               l,
@@ -43,6 +72,10 @@ func New(bucket, prefix, metafilesPrefix string, mc MinioClient, l log.Logger) s
 		metafilesPrefix: metafilesPrefix,
 		useDone:         metafilesPrefix != "",
 	}
+	for _, o := range opts {
+		o(ms)
+	}
+	return ms
 }
 
 func (ms *minioStorage) Stat(ctx context.Context, element ingest.Codec) (*storage.ObjectInfo, error) {
@@ -55,6 +88,16 @@ func (ms *minioStorage) Stat(ctx context.Context, element ingest.Codec) (*storag
 		return nil, fs.ErrNotExist
 	}
 
+	if element.Hash != "" {
+		changed, err := ms.isObjectChanged(ctx, element)
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			return nil, fs.ErrNotExist
+		}
+	}
+
 	// If the file exists but the done file does not,
 	// let's patch this up.
 	if !done && ms.useDone {
@@ -69,13 +112,18 @@ func (ms *minioStorage) Stat(ctx context.Context, element ingest.Codec) (*storag
 func (ms *minioStorage) Store(ctx context.Context, element ingest.Codec, obj ingest.Object) (*url.URL, error) {
 	u := ms.url(element)
 
+	opts := minio.PutObjectOptions{ContentType: obj.MimeType, StorageClass: ms.storageClass} // I guess we can remove the mime type detection because we always use tar.gz files.
+	if element.Hash != "" {
+		opts.UserMetadata = map[string]string{hashKey: element.Hash}
+	}
+	opts.UserTags = ms.tags(element, u.Path)
 	if _, err := ms.mc.PutObject(
 		ctx,
 		ms.bucket,
 		u.Path,
 		obj.Reader,
 		obj.Len,
-		minio.PutObjectOptions{ContentType: obj.MimeType}, // I guess we can remove the mime type detection because we always use tar.gz files.
+		opts,
 	); err != nil {
 		return nil, err
 	}
@@ -89,6 +137,64 @@ func (ms *minioStorage) Store(ctx context.Context, element ingest.Codec, obj ing
 	return u, nil
 }
 
+// CopyFrom copies an object with a server-side copy from a URI like s3://bucket/key?endpoint=s3.amazonaws.com&versionId=1.
+// It returns storage.ErrCopyNotSupported if the object is on another endpoint or cannot be read with the credentials of the storage,
+// and if the objects are stored with a storage class, which a copy cannot set without replacing the metadata of the object.
+func (ms *minioStorage) CopyFrom(ctx context.Context, element ingest.Codec, uri *url.URL) (*url.URL, error) {
+	q := uri.Query()
+	if uri.Scheme != "s3" || ms.endpoint == "" || q.Get("endpoint") != ms.endpoint || ms.storageClass != "" {
+		return nil, storage.ErrCopyNotSupported
+	}
+	u := ms.url(element)
+	src := minio.CopySrcOptions{
+		Bucket:    uri.Host,
+		Object:    strings.TrimPrefix(uri.Path, "/"),
+		VersionID: q.Get("versionId"),
+	}
+	dst := minio.CopyDestOptions{Bucket: ms.bucket, Object: u.Path}
+	// Like stored objects, copies carry the hash and the tags of the element instead of the ones of the source object,
+	// so that Stat can tell when the element changed.
+	if element.Hash != "" {
+		dst.ReplaceMetadata = true
+		dst.UserMetadata = map[string]string{hashKey: element.Hash}
+		if element.MimeType != "" {
+			// Replacing the metadata also replaces the content type of the source object.
+			dst.UserMetadata["Content-Type"] = element.MimeType
+		}
+	}
+	if t := ms.tags(element, u.Path); t != nil {
+		dst.ReplaceTags = true
+		dst.UserTags = t
+	}
+	if _, err := ms.mc.ComposeObject(ctx, dst, src); err != nil {
+		if minio.ToErrorResponse(err).Code == "AccessDenied" {
+			level.Warn(ms.l).Log("msg", "access to the source of the copy was denied", "bucket", src.Bucket, "object", src.Object, "err", err.Error())
+			return nil, storage.ErrCopyNotSupported
+		}
+		return nil, err
+	}
+
+	if ms.useDone {
+		if _, err := ms.mc.PutObject(ctx, ms.bucket, path.Join(ms.metafilesPrefix, doneKey(element.Name)), bytes.NewReader(make([]byte, 0)), 0, minio.PutObjectOptions{ContentType: "text/plain"}); err != nil {
+			return nil, fmt.Errorf("failed to create matching meta object for copied file: %w", err)
+		}
+	}
+
+	return u, nil
+}
+
+// tags returns the tags of the element if S3 accepts them and nil otherwise.
+func (ms *minioStorage) tags(element ingest.Codec, object string) map[string]string {
+	if len(element.Tags) == 0 {
+		return nil
+	}
+	if _, err := tags.MapToObjectTags(element.Tags); err != nil {
+		level.Warn(ms.l).Log("msg", "storing object without its tags, since S3 does not accept them", "object", object, "err", err.Error())
+		return nil
+	}
+	return element.Tags
+}
+
 func (ms *minioStorage) url(element ingest.Codec) *url.URL {
 	return &url.URL{
 		Scheme: "s3",
@@ -121,6 +227,25 @@ func (ms *minioStorage) isObjectSynced(ctx context.Context, name string, checkDo
 	return false, checkDone, err
 }
 
+// isObjectChanged returns whether the stored object of the element was stored with another hash than the element has.
+// Objects that were stored without a hash are not considered changed.
+func (ms *minioStorage) isObjectChanged(ctx context.Context, element ingest.Codec) (bool, error) {
+	name := path.Join(ms.prefix, element.Name)
+	oi, err := ms.mc.StatObject(ctx, ms.bucket, name, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			// The done file exists, but the object does not.
+			return true, nil
+		}
+		return false, err
+	}
+	if h, ok := oi.UserMetadata[hashKey]; ok && h != element.Hash {
+		level.Debug(ms.l).Log("msg", "object changed since it was stored", "object", name, "stored", h, "hash", element.Hash)
+		return true, nil
+	}
+	return false, nil
+}
+
 func doneKey(name string) string {
 	return fmt.Sprintf("%s.done", name)
 }
@@ -2,16 +2,20 @@ package s3
 
 import (
 	"context"
+	"net/url"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/go-kit/log"
 	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 
 	"github.com/connylabs/ingest"
 	"github.com/connylabs/ingest/mocks"
+	"github.com/connylabs/ingest/storage"
 )
 
 func TestStore(t *testing.T) {
@@ -79,6 +83,56 @@ func TestStore(t *testing.T) {
 			t.Errorf("expected %q, got %q", key, u.String())
 		}
 
+		mc.AssertExpectations(t)
+	})
+	t.Run("with storage class", func(t *testing.T) {
+		mc := new(mocks.MinioClient)
+		_t := ingest.NewCodec("foo", "bar", nil)
+		obj := &ingest.Object{
+			MimeType: "plain/text",
+			Len:      64,
+		}
+
+		mc.On("PutObject", mock.Anything, "bucket", "prefix/bar", mock.Anything, int64(64), mock.MatchedBy(func(o minio.PutObjectOptions) bool {
+			return o.StorageClass == "GLACIER"
+		})).Return(minio.UploadInfo{}, nil).Once().
+			On("PutObject", mock.Anything, "bucket", "meta/bar.done", mock.Anything, int64(0), mock.MatchedBy(func(o minio.PutObjectOptions) bool {
+				return o.StorageClass == ""
+			})).Return(minio.UploadInfo{}, nil).Once()
+
+		s := New("bucket", "prefix", "meta", mc, log.NewJSONLogger(log.NewSyncWriter(os.Stdout)), WithStorageClass("GLACIER"))
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		defer cancel()
+		if _, err := s.Store(ctx, _t, *obj); err != nil {
+			t.Error(err)
+		}
+
+		mc.AssertExpectations(t)
+	})
+	t.Run("with hash and tags", func(t *testing.T) {
+		mc := new(mocks.MinioClient)
+		_t := ingest.NewCodec("foo", "bar", nil)
+		_t.Hash = "1"
+		_t.Tags = map[string]string{"team": "a"}
+
+		mc.On("PutObject", mock.Anything, "bucket", "prefix/bar", mock.Anything, int64(64), mock.MatchedBy(func(o minio.PutObjectOptions) bool {
+			return o.UserMetadata[hashKey] == "1" && o.UserTags["team"] == "a"
+		})).Return(minio.UploadInfo{}, nil).Once()
+		// Tags that S3 does not accept are not stored.
+		_u := _t
+		_u.Name = "baz"
+		_u.Tags = map[string]string{"": "a"}
+		mc.On("PutObject", mock.Anything, "bucket", "prefix/baz", mock.Anything, int64(64), mock.MatchedBy(func(o minio.PutObjectOptions) bool {
+			return o.UserMetadata[hashKey] == "1" && o.UserTags == nil
+		})).Return(minio.UploadInfo{}, nil).Once()
+
+		s := New("bucket", "prefix", "", mc, log.NewNopLogger())
+		for _, c := range []ingest.Codec{_t, _u} {
+			_, err := s.Store(context.Background(), c, ingest.Object{Len: 64})
+			require.NoError(t, err)
+		}
+
 		mc.AssertExpectations(t)
 	})
 }
@@ -228,6 +282,103 @@ func TestStat(t *testing.T) {
 			t.Errorf("expected nil, got %v", o)
 		}
 
+		mc.AssertExpectations(t)
+	})
+	t.Run("changed object", func(t *testing.T) {
+		mc := new(mocks.MinioClient)
+		s := New("bucket", "prefix", "", mc, log.NewNopLogger())
+		mc.On("StatObject", mock.Anything, "bucket", "prefix/bar", mock.Anything).Return(minio.ObjectInfo{UserMetadata: minio.StringMap{hashKey: "1"}}, nil)
+		mc.On("StatObject", mock.Anything, "bucket", "prefix/old", mock.Anything).Return(minio.ObjectInfo{}, nil)
+
+		for _, c := range []struct {
+			name, hash string
+			exists     bool
+		}{
+			{"bar", "", true},
+			{"bar", "1", true},
+			{"bar", "2", false},
+			// Objects that were stored without a hash are not stored again.
+			{"old", "2", true},
+		} {
+			_t := ingest.NewCodec("foo", c.name, nil)
+			_t.Hash = c.hash
+			_, err := s.Stat(context.Background(), _t)
+			if c.exists {
+				assert.NoError(t, err, "%+v", c)
+			} else {
+				assert.True(t, os.IsNotExist(err), "%+v", c)
+			}
+		}
+	})
+}
+
+func TestCopyFrom(t *testing.T) {
+	_t := ingest.NewCodec("foo", "bar", nil)
+	loc := &url.URL{Scheme: "s3", Host: "source", Path: "/src/foo", RawQuery: "endpoint=s3.amazonaws.com&versionId=1"}
+
+	t.Run("same endpoint", func(t *testing.T) {
+		mc := new(mocks.MinioClient)
+		mc.On("ComposeObject", mock.Anything, minio.CopyDestOptions{Bucket: "bucket", Object: "prefix/bar"}, minio.CopySrcOptions{Bucket: "source", Object: "src/foo", VersionID: "1"}).Return(minio.UploadInfo{}, nil).Once().
+			On("PutObject", mock.Anything, "bucket", "meta/bar.done", mock.Anything, int64(0), mock.Anything).Return(minio.UploadInfo{}, nil).Once()
+
+		s := New("bucket", "prefix", "meta", mc, log.NewNopLogger(), WithEndpoint("s3.amazonaws.com"))
+		u, err := s.(storage.Copier).CopyFrom(context.Background(), _t, loc)
+		require.NoError(t, err)
+		assert.Equal(t, "s3://bucket/prefix/bar", u.String())
+
+		mc.AssertExpectations(t)
+	})
+	t.Run("with hash and tags", func(t *testing.T) {
+		_t := ingest.NewCodec("foo", "bar", nil)
+		_t.Hash, _t.MimeType, _t.Tags = "1", "text/plain", map[string]string{"team": "a"}
+		var dst minio.CopyDestOptions
+		mc := new(mocks.MinioClient)
+		mc.On("ComposeObject", mock.Anything, mock.Anything, minio.CopySrcOptions{Bucket: "source", Object: "src/foo", VersionID: "1"}).Return(minio.UploadInfo{}, nil).Once().
+			Run(func(args mock.Arguments) { dst = args.Get(1).(minio.CopyDestOptions) })
+
+		s := New("bucket", "prefix", "", mc, log.NewNopLogger(), WithEndpoint("s3.amazonaws.com"))
+		_, err := s.(storage.Copier).CopyFrom(context.Background(), _t, loc)
+		require.NoError(t, err)
+		assert.Equal(t, minio.CopyDestOptions{
+			Bucket:          "bucket",
+			Object:          "prefix/bar",
+			ReplaceMetadata: true,
+			UserMetadata:    map[string]string{hashKey: "1", "Content-Type": "text/plain"},
+			ReplaceTags:     true,
+			UserTags:        map[string]string{"team": "a"},
+		}, dst)
+
+		// The copy is stored again once the element changed.
+		mc.On("StatObject", mock.Anything, "bucket", "prefix/bar", mock.Anything).Return(minio.ObjectInfo{UserMetadata: minio.StringMap(dst.UserMetadata)}, nil)
+		_, err = s.Stat(context.Background(), _t)
+		assert.NoError(t, err)
+		_t.Hash = "2"
+		_, err = s.Stat(context.Background(), _t)
+		assert.True(t, os.IsNotExist(err))
+
+		mc.AssertExpectations(t)
+	})
+	t.Run("not supported", func(t *testing.T) {
+		for name, opts := range map[string][]Option{
+			"no endpoint":    nil,
+			"other endpoint": {WithEndpoint("minio.example.com")},
+			"storage class":  {WithEndpoint("s3.amazonaws.com"), WithStorageClass("GLACIER")},
+		} {
+			mc := new(mocks.MinioClient)
+			s := New("bucket", "prefix", "", mc, log.NewNopLogger(), opts...)
+			_, err := s.(storage.Copier).CopyFrom(context.Background(), _t, loc)
+			assert.ErrorIs(t, err, storage.ErrCopyNotSupported, name)
+			mc.AssertExpectations(t)
+		}
+	})
+	t.Run("access denied", func(t *testing.T) {
+		mc := new(mocks.MinioClient)
+		mc.On("ComposeObject", mock.Anything, mock.Anything, mock.Anything).Return(minio.UploadInfo{}, minio.ErrorResponse{Code: "AccessDenied"}).Once()
+
+		s := New("bucket", "prefix", "", mc, log.NewNopLogger(), WithEndpoint("s3.amazonaws.com"))
+		_, err := s.(storage.Copier).CopyFrom(context.Background(), _t, loc)
+		assert.ErrorIs(t, err, storage.ErrCopyNotSupported)
+
 		mc.AssertExpectations(t)
 	})
 }
@@ -28,6 +28,36 @@ type Storage interface {
 	Store(ctx context.Context, element ingest.Codec, obj ingest.Object) (*url.URL, error)
 }
 
+// ErrCopyNotSupported is returned by a Copier that cannot copy from a URI,
+// e.g. because the URI belongs to another endpoint.
+var ErrCopyNotSupported = errors.New("copy not supported")
+
+// ErrCopyNotImplemented is returned by CopyFrom for a Storage that cannot copy from any URI,
+// e.g. because it does not implement Copier.
+var ErrCopyNotImplemented = errors.New("copy not implemented")
+
+// Copier can be implemented by a Storage that can store an object from the URI
+// that an ingest.Locator returned without streaming its content through ingest,
+// e.g. with a server-side copy when the source and the storage are on the same S3 endpoint.
+type Copier interface {
+	// CopyFrom stores the object at the URI as the given element.
+	// If the object cannot be copied from the URI, then CopyFrom returns ErrCopyNotSupported
+	// and the object must be stored with Store instead.
+	// If the Copier cannot copy from any URI, e.g. because a wrapped Storage does not implement Copier,
+	// then CopyFrom returns ErrCopyNotImplemented.
+	CopyFrom(ctx context.Context, element ingest.Codec, uri *url.URL) (*url.URL, error)
+}
+
+// CopyFrom copies the object at the URI with the Storage,
+// or returns ErrCopyNotImplemented if the Storage does not implement Copier.
+func CopyFrom(ctx context.Context, s Storage, element ingest.Codec, uri *url.URL) (*url.URL, error) {
+	c, ok := s.(Copier)
+	if !ok {
+		return nil, ErrCopyNotImplemented
+	}
+	return c.CopyFrom(ctx, element, uri)
+}
+
 type instrumentedStorage struct {
 	Storage
 	operationsTotal   *prometheus.CounterVec
@@ -64,6 +94,21 @@ func (i instrumentedStorage) Store(ctx context.Context, element ingest.Codec, ob
 	return u, err
 }
 
+func (i instrumentedStorage) CopyFrom(ctx context.Context, element ingest.Codec, uri *url.URL) (*url.URL, error) {
+	start := time.Now()
+	u, err := CopyFrom(ctx, i.Storage, element, uri)
+	if errors.Is(err, ErrCopyNotSupported) || errors.Is(err, ErrCopyNotImplemented) {
+		return nil, err
+	}
+	i.operationDuration.WithLabelValues("copy").Observe(time.Since(start).Seconds())
+	if err == nil {
+		i.operationsTotal.WithLabelValues("copy", "success").Inc()
+	} else if !errors.Is(err, context.Canceled) {
+		i.operationsTotal.WithLabelValues("copy", "error").Inc()
+	}
+	return u, err
+}
+
 // NewInstrumentedStorage adds Prometheus metrics to any Storage.
 func NewInstrumentedStorage(s Storage, r prometheus.Registerer) Storage {
 	operationsTotal := promauto.With(r).NewCounterVec(prometheus.CounterOpts{
@@ -77,7 +122,7 @@ func NewInstrumentedStorage(s Storage, r prometheus.Registerer) Storage {
 		Buckets: []float64{0.01, 0.1, 0.3, 1, 3, 10, 30, 60, 90, 120, 240, 360, 600},
 	}, []string{"operation"})
 
-	for _, o := range []string{"stat", "store"} {
+	for _, o := range []string{"stat", "store", "copy"} {
 		operationDuration.WithLabelValues(o).Observe(0)
 		for _, r := range []string{"error", "success"} {
 			operationsTotal.WithLabelValues(o, r).Add(0)